@@ -0,0 +1,174 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// zip creator systems that store unix permissions in the archive
+const (
+	zipCreatorUnix  = 3
+	zipCreatorMacOS = 19
+)
+
+var zipMagic = []byte("PK\x03\x04")
+
+// scriptNames are made executable when they come from an archive without unix permissions, such as a zip made on Windows
+var scriptNames = map[string]bool{"mvnw": true, "gradlew": true}
+
+// archiveEntry is a directory or regular file of a template archive
+type archiveEntry struct {
+	name string
+	dir  bool
+	// mode is 0 when the archive has no unix permissions for the entry
+	mode os.FileMode
+	// open reads the file. For a .tar.gz it can only be read while the entry is walked.
+	open func() (io.ReadCloser, error)
+}
+
+// walkArchive calls walkFn with the directories and regular files of a .tar.gz or .zip archive, in archive order.
+// Other entries, such as links, are skipped.
+func walkArchive(file string, walkFn func(entry archiveEntry) error) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	magic := make([]byte, len(zipMagic))
+	if _, err = io.ReadFull(reader, magic); err != nil {
+		return errors.Errorf("Could not read the archive %s: %v", file, err)
+	}
+	if bytes.Equal(magic, zipMagic) {
+		return walkZip(file, walkFn)
+	}
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return walkTarGz(reader, walkFn)
+}
+
+func walkTarGz(reader io.Reader, walkFn func(entry archiveEntry) error) error {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeDir && header.Typeflag != tar.TypeReg {
+			Debug.log("Skipping archive entry ", header.Name)
+			continue
+		}
+		entry := archiveEntry{
+			name: header.Name,
+			dir:  header.Typeflag == tar.TypeDir,
+			mode: os.FileMode(header.Mode).Perm(),
+			open: func() (io.ReadCloser, error) { return ioutil.NopCloser(tarReader), nil },
+		}
+		if err = walkFn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(file string, walkFn func(entry archiveEntry) error) error {
+	zipReader, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	for _, zipFile := range zipReader.File {
+		if !zipFile.Mode().IsDir() && !zipFile.Mode().IsRegular() {
+			Debug.log("Skipping archive entry ", zipFile.Name)
+			continue
+		}
+		entry := archiveEntry{name: zipFile.Name, dir: zipFile.Mode().IsDir(), open: zipFile.Open}
+		if creator := zipFile.CreatorVersion >> 8; creator == zipCreatorUnix || creator == zipCreatorMacOS {
+			entry.mode = zipFile.Mode().Perm()
+		}
+		if err = walkFn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeArchivePath returns the local path of an archive entry, refusing the entries that would be
+// written outside of the directory the archive is extracted in
+func safeArchivePath(name string) (string, error) {
+	path := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(name, "/") ||
+		path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("The archive entry %s is outside of the project directory", name)
+	}
+	return path, nil
+}
+
+// extractArchiveFile writes a file of the archive, converting the line endings of its text files as
+// the line endings mode says. Without unix permissions in the archive, scripts, recognized by their #!
+// line, extension or name, are made executable.
+func extractArchiveFile(path string, entry archiveEntry, endings string) error {
+	source, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	reader := bufio.NewReaderSize(source, textSniffLength)
+	head, _ := reader.Peek(textSniffLength)
+	mode := entry.mode
+	if mode == 0 {
+		mode = 0644
+		if isShellScript(path, head) {
+			mode = 0755
+		}
+	}
+	var content io.Reader = reader
+	if needsLineEndings(endings, path, head) {
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(convertLineEndings(endings, path, data))
+	}
+	path = longPath(path)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, content)
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Generic artifact servers, such as Artifactory and Nexus, can host repositories:
+// - downloads are redirected to storage, such as S3, which must not get the headers of the repository
+// - the checksum of a file is in a response header, or in a .sha256 file next to it
+// - a directory of stack packages can be added as a repository without an index.yaml
+
+// checksumHeader is set by Artifactory on downloads
+const checksumHeader = "X-Checksum-Sha256"
+
+// packageFile matches the template archives appsody stack ci packages: <stack>.v<version>.templates.<template>.tar.gz
+var packageFile = regexp.MustCompile(`^([a-z0-9-]+)\.v([0-9]+\.[0-9]+\.[0-9]+)\.templates\.([a-zA-Z0-9_-]+)\.(tar\.gz|zip)$`)
+
+var listingLink = regexp.MustCompile(`(?i)href="([^"]+)"`)
+
+// dropHeadersOnRedirect keeps the repository headers on redirects to the same server only. The client already
+// drops the Authorization header when redirected to another host.
+func dropHeadersOnRedirect(headers map[string]string) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !sameServer(via[0].URL, req.URL) {
+			for name := range headers {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// isArtifactServer recognizes the artifact servers that keep .sha256 files next to the files
+func isArtifactServer(resp *http.Response) bool {
+	server := strings.ToLower(resp.Header.Get("Server"))
+	return resp.Header.Get("X-Artifactory-Id") != "" || strings.HasPrefix(server, "artifactory") || strings.HasPrefix(server, "nexus")
+}
+
+// verifyDownloadChecksum compares the sha256 of a download with the one the server publishes, if any
+func verifyDownloadChecksum(client *http.Client, req *http.Request, resp *http.Response, actual string) error {
+	expected := resp.Header.Get(checksumHeader)
+	if expected == "" && isArtifactServer(resp) {
+		expected = checksumSidecar(client, req)
+	}
+	if expected == "" {
+		return nil
+	}
+	if !strings.EqualFold(expected, actual) {
+		return errors.Errorf("The checksum of %s is sha256:%s, the server publishes sha256:%s", req.URL, actual, expected)
+	}
+	Debug.log("Verified the checksum of ", req.URL)
+	return nil
+}
+
+// checksumSidecar reads the .sha256 file next to the download, which holds the hex checksum, possibly followed by the file name
+func checksumSidecar(client *http.Client, req *http.Request) string {
+	sidecar, err := newRequestWithContext(req.Context(), "GET", req.URL.String()+".sha256", nil)
+	if err != nil {
+		return ""
+	}
+	sidecar.Header = req.Header
+	resp, err := client.Do(sidecar)
+	if err != nil {
+		Debug.log("Could not download the checksum file: ", err)
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		Debug.logf("No checksum file for %s: %s", req.URL, resp.Status)
+		return ""
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if fields := strings.Fields(string(data)); err == nil && len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// listingIndex builds the index of a repository directory from the stack packages in its listing
+func listingIndex(dirURL string, headers map[string]string, timeout time.Duration) (*RepoIndex, error) {
+	base, err := url.Parse(dirURL)
+	if err != nil {
+		return nil, err
+	}
+	var listing bytes.Buffer
+	if err = downloadFileWithTimeout(dirURL, &listing, headers, timeout); err != nil {
+		return nil, errors.Wrap(err, "Failed to get repository index or directory listing")
+	}
+	index := &RepoIndex{APIVersion: "v1", Projects: map[string]ProjectVersions{}}
+	for _, link := range listingLink.FindAllStringSubmatch(listing.String(), -1) {
+		ref, err := url.Parse(link[1])
+		if err != nil {
+			continue
+		}
+		fileURL := base.ResolveReference(ref)
+		name := fileURL.Path[strings.LastIndex(fileURL.Path, "/")+1:]
+		match := packageFile.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		id, version := match[1], match[2]
+		var project *ProjectVersion
+		for _, existing := range index.Projects[id] {
+			if existing.Version == version {
+				project = existing
+			}
+		}
+		if project == nil {
+			project = &ProjectVersion{APIVersion: "v1", Name: id, Version: version}
+			index.Projects[id] = append(index.Projects[id], project)
+		}
+		project.URLs = append(project.URLs, fileURL.String())
+	}
+	if len(index.Projects) == 0 {
+		return nil, errors.Errorf("There is no index.yaml and no stack package in %s", dirURL)
+	}
+	// the latest version first, as in an index
+	for _, versions := range index.Projects {
+		sort.SliceStable(versions, func(i, j int) bool { return versionLess(versions[j].Version, versions[i].Version) })
+		for _, project := range versions {
+			// init uses the first template
+			sort.SliceStable(project.URLs, func(i, j int) bool {
+				return defaultTemplate(project.URLs[i]) && !defaultTemplate(project.URLs[j]) ||
+					defaultTemplate(project.URLs[i]) == defaultTemplate(project.URLs[j]) && project.URLs[i] < project.URLs[j]
+			})
+		}
+	}
+	return index, nil
+}
+
+func defaultTemplate(packageURL string) bool {
+	return strings.Contains(packageURL, ".templates.default.") || strings.Contains(packageURL, ".templates.simple.")
+}
+
+// versionLess compares major.minor.patch versions numerically
+func versionLess(a string, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNumber, _ := strconv.Atoi(aParts[i])
+		bNumber, _ := strconv.Atoi(bParts[i])
+		if aNumber != bNumber {
+			return aNumber < bNumber
+		}
+	}
+	return len(aParts) < len(bParts)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The audit log is turned on with the audit setting of the CLI configuration, or APPSODY_AUDIT:
+// "file" appends to audit.log in the Appsody home directory, "syslog" sends to the system log.
+const (
+	auditFile   = "file"
+	auditSyslog = "syslog"
+	auditLog    = "audit.log"
+)
+
+// auditRecord is one line of the audit log. A command writes a start record when it begins and an end record
+// with the same id and its outcome when it returns. A start record without an end record is a command that
+// exited on an error.
+type auditRecord struct {
+	ID           string   `json:"id"`
+	Time         string   `json:"time"`
+	Event        string   `json:"event"`
+	User         string   `json:"user"`
+	Host         string   `json:"host"`
+	Command      string   `json:"command"`
+	Args         []string `json:"args"`
+	Dir          string   `json:"dir"`
+	Stack        string   `json:"stack,omitempty"`
+	StackVersion string   `json:"stackVersion,omitempty"`
+	Outcome      string   `json:"outcome,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Seconds      float64  `json:"seconds,omitempty"`
+}
+
+// currentAudit is the start record of the running command, nil when auditing is off
+var currentAudit *auditRecord
+var auditStarted time.Time
+
+// secretFlag matches the flags whose values are never written to the audit log
+var secretFlag = regexp.MustCompile(`(?i)^--?[a-z-]*(password|token|credential|auth)[a-z-]*`)
+
+// redactArgs hides the values of secret flags, given as --flag=value or --flag value
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		redacted[i] = arg
+		if !secretFlag.MatchString(arg) {
+			continue
+		}
+		if eq := strings.Index(arg, "="); eq >= 0 {
+			redacted[i] = arg[:eq+1] + "***"
+		} else if i+1 < len(args) {
+			i++
+			redacted[i] = "***"
+		}
+	}
+	return redacted
+}
+
+func auditMode() string {
+	if cliConfig == nil {
+		return ""
+	}
+	return strings.ToLower(cliConfig.GetString("audit"))
+}
+
+// initAudit writes the start record of the command when the audit log is on
+func initAudit() {
+	mode := auditMode()
+	if mode == "" {
+		return
+	}
+	if mode != auditFile && mode != auditSyslog {
+		Warning.logf("Unknown audit setting %q, use %s or %s", mode, auditFile, auditSyslog)
+		return
+	}
+	auditStarted = time.Now()
+	record := &auditRecord{
+		ID:    fmt.Sprintf("%d-%d", auditStarted.UnixNano(), os.Getpid()),
+		Event: "start",
+		Args:  redactArgs(os.Args[1:]),
+	}
+	if current, err := user.Current(); err == nil {
+		record.User = current.Username
+	}
+	record.Host, _ = os.Hostname()
+	record.Dir, _ = os.Getwd()
+	if command, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		record.Command = command.CommandPath()
+	}
+	if config, err := readProjectConfig(); err == nil {
+		record.Stack = config.Platform
+		record.StackVersion = stackVersion(record.Stack)
+	}
+	currentAudit = record
+	writeAudit(mode, *record)
+}
+
+// finishAudit writes the end record of the command with its outcome
+func finishAudit(err error) {
+	if currentAudit == nil {
+		return
+	}
+	record := *currentAudit
+	record.Event = "end"
+	record.Seconds = time.Since(auditStarted).Round(time.Millisecond).Seconds()
+	record.Outcome = "succeeded"
+	if err != nil {
+		record.Outcome = "failed"
+		record.Error = err.Error()
+	}
+	writeAudit(auditMode(), record)
+}
+
+// auditSecurityEvent adds a record of a security relevant event of the running command, such as a quarantined
+// download, when the audit log is on
+func auditSecurityEvent(event string, details string) {
+	if currentAudit == nil {
+		return
+	}
+	record := *currentAudit
+	record.Event = event
+	record.Error = details
+	writeAudit(auditMode(), record)
+}
+
+// writeAudit adds the record to the audit log. The command goes on if it cannot be written.
+func writeAudit(mode string, record auditRecord) {
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(record)
+	if err != nil {
+		Warning.log("Could not encode the audit record: ", err)
+		return
+	}
+	if dryrun {
+		Debug.log("Dry Run - Skipping writing the audit record ", string(data))
+		return
+	}
+	if mode == auditSyslog {
+		err = writeAuditSyslog(string(data))
+	} else {
+		err = appendAuditFile(filepath.Join(getStateDir(), auditLog), data)
+	}
+	if err != nil {
+		Warning.log("Could not write the audit log: ", err)
+	}
+}
+
+func appendAuditFile(file string, data []byte) error {
+	auditFile, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer auditFile.Close()
+	if _, err = auditFile.Write(append(data, '\n')); err != nil {
+		return errors.Errorf("could not append to %s: %v", file, err)
+	}
+	return nil
+}
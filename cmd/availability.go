@@ -0,0 +1,150 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Availability declares how many pods of the deployed application must stay up during voluntary disruptions,
+// such as node drains, and how they are spread across the zones of the cluster:
+//
+//   availability:
+//     minAvailable: 2
+//     zoneSpread: true
+//
+// minAvailable is a number of pods or a percentage, such as 50%.
+type Availability struct {
+	MinAvailable string `yaml:"minAvailable,omitempty"`
+	ZoneSpread   bool   `yaml:"zoneSpread,omitempty"`
+	// MaxSkew is the largest difference of the number of pods between two zones, 1 by default
+	MaxSkew int `yaml:"maxSkew,omitempty"`
+}
+
+// TopologySpreadConstraint spreads the pods of the application, as in the pod spec
+type TopologySpreadConstraint struct {
+	MaxSkew           int         `yaml:"maxSkew"`
+	TopologyKey       string      `yaml:"topologyKey"`
+	WhenUnsatisfiable string      `yaml:"whenUnsatisfiable"`
+	LabelSelector     podSelector `yaml:"labelSelector"`
+}
+
+// pdbFile is the manifest of the PodDisruptionBudget deploy writes in the project directory
+const pdbFile = "appsody-pdb.yaml"
+
+// zoneTopologyKey is the label of the nodes with their zone
+const zoneTopologyKey = "topology.kubernetes.io/zone"
+
+var minAvailableFormat = regexp.MustCompile(`^[0-9]+%?$`)
+
+// deployAvailability is the availability of the project being deployed, GenKnativeYaml spreads its pods
+// and keeps enough of them
+var deployAvailability *Availability
+
+func (a *Availability) validate() error {
+	if a.MinAvailable != "" && !minAvailableFormat.MatchString(a.MinAvailable) {
+		return errors.Errorf("availability.minAvailable in %s must be a number of pods or a percentage, not %q", ConfigFile, a.MinAvailable)
+	}
+	if a.MaxSkew < 0 {
+		return errors.Errorf("availability.maxSkew in %s can not be negative", ConfigFile)
+	}
+	return nil
+}
+
+// serviceSelector selects the pods of a Knative service
+func serviceSelector(serviceName string) podSelector {
+	return podSelector{MatchLabels: map[string]string{"serving.knative.dev/service": serviceName}}
+}
+
+// topologySpreadConstraints returns the constraints spreading the pods of a service across the zones.
+// Knative only accepts them with its kubernetes.podspec-topologyspreadconstraints feature enabled.
+func (a *Availability) topologySpreadConstraints(serviceName string) []TopologySpreadConstraint {
+	if a == nil || !a.ZoneSpread {
+		return nil
+	}
+	maxSkew := a.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = 1
+	}
+	return []TopologySpreadConstraint{{
+		MaxSkew:           maxSkew,
+		TopologyKey:       zoneTopologyKey,
+		WhenUnsatisfiable: "ScheduleAnyway",
+		LabelSelector:     serviceSelector(serviceName),
+	}}
+}
+
+// minScale returns the number of pods Knative must keep for the disruption budget to allow evicting one,
+// or 0 when it can not tell from a percentage
+func (a *Availability) minScale() int {
+	if a == nil {
+		return 0
+	}
+	minAvailable, err := strconv.Atoi(a.MinAvailable)
+	if err != nil || minAvailable == 0 {
+		return 0
+	}
+	return minAvailable + 1
+}
+
+// genPodDisruptionBudget returns the manifest of the PodDisruptionBudget of a service
+func genPodDisruptionBudget(serviceName string, availability *Availability) ([]byte, error) {
+	var minAvailable interface{} = availability.MinAvailable
+	if number, err := strconv.Atoi(availability.MinAvailable); err == nil {
+		minAvailable = number
+	}
+	pdb := map[string]interface{}{
+		"apiVersion": "policy/v1",
+		"kind":       "PodDisruptionBudget",
+		"metadata": map[string]interface{}{
+			"name":   serviceName,
+			"labels": managedLabels(serviceName),
+		},
+		"spec": map[string]interface{}{
+			"minAvailable": minAvailable,
+			"selector":     serviceSelector(serviceName),
+		},
+	}
+	return yaml.Marshal(pdb)
+}
+
+// writePodDisruptionBudget writes the PodDisruptionBudget of the project in its directory, and returns the
+// file, or an empty string when the project does not declare a minAvailable
+func writePodDisruptionBudget(serviceName string, availability *Availability) (string, error) {
+	if availability == nil || availability.MinAvailable == "" {
+		return "", nil
+	}
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := genPodDisruptionBudget(serviceName, availability)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(projectDir, pdbFile)
+	if dryrun {
+		planned(planWrite, file, "pod disruption budget")
+		return file, nil
+	}
+	Debug.logf("Generated pod disruption budget:\n%s", manifest)
+	return file, ioutil.WriteFile(file, manifest, 0644)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"gopkg.in/yaml.v2"
+)
+
+var availabilityValidateTests = []struct {
+	testName      string
+	availability  cmd.Availability
+	expectedError string // empty when the availability is valid
+}{
+	{"Pods", cmd.Availability{MinAvailable: "2", ZoneSpread: true}, ""},
+	{"Percentage", cmd.Availability{MinAvailable: "50%", MaxSkew: 2}, ""},
+	{"Not a number", cmd.Availability{MinAvailable: "two"}, `must be a number of pods or a percentage, not "two"`},
+	{"Negative percentage", cmd.Availability{MinAvailable: "-50%"}, `must be a number of pods or a percentage, not "-50%"`},
+	{"Negative skew", cmd.Availability{MaxSkew: -1}, "availability.maxSkew in .appsody-config.yaml can not be negative"},
+}
+
+func TestAvailabilityValidate(t *testing.T) {
+	for _, tt := range availabilityValidateTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := tt.availability.Validate()
+
+			if tt.expectedError == "" && err != nil {
+				t.Error(err)
+			}
+			if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+				t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+var podDisruptionBudgetTests = []struct {
+	testName             string
+	minAvailable         string
+	expectedMinAvailable interface{}
+}{
+	{"Pods", "2", 2},
+	{"Percentage", "50%", "50%"},
+}
+
+func TestGenPodDisruptionBudget(t *testing.T) {
+	for _, tt := range podDisruptionBudgetTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			manifest, err := cmd.GenPodDisruptionBudget("shop", &cmd.Availability{MinAvailable: tt.minAvailable})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pdb struct {
+				Kind     string `yaml:"kind"`
+				Metadata struct {
+					Name string `yaml:"name"`
+				} `yaml:"metadata"`
+				Spec struct {
+					MinAvailable interface{} `yaml:"minAvailable"`
+					Selector     struct {
+						MatchLabels map[string]string `yaml:"matchLabels"`
+					} `yaml:"selector"`
+				} `yaml:"spec"`
+			}
+			if err = yaml.Unmarshal(manifest, &pdb); err != nil {
+				t.Fatal(err)
+			}
+
+			if pdb.Kind != "PodDisruptionBudget" || pdb.Metadata.Name != "shop" {
+				t.Errorf("Expected the shop PodDisruptionBudget, got the %s %s", pdb.Metadata.Name, pdb.Kind)
+			}
+			if pdb.Spec.MinAvailable != tt.expectedMinAvailable {
+				t.Errorf("Expected minAvailable %v, got %v", tt.expectedMinAvailable, pdb.Spec.MinAvailable)
+			}
+			if selector := pdb.Spec.Selector.MatchLabels; !reflect.DeepEqual(selector, map[string]string{"serving.knative.dev/service": "shop"}) {
+				t.Errorf("Expected the pods of the shop service to be selected, got %v", selector)
+			}
+		})
+	}
+}
+
+var availabilityServiceTests = []struct {
+	testName         string
+	availability     *cmd.Availability
+	expectedMinScale string // empty when the service sets none
+	expectedMaxSkew  int    // 0 when the pods are not spread
+}{
+	{"No availability", nil, "", 0},
+	{"Pods", &cmd.Availability{MinAvailable: "2"}, "3", 0},
+	{"Percentage", &cmd.Availability{MinAvailable: "50%", ZoneSpread: true}, "", 1},
+	{"Skew", &cmd.Availability{ZoneSpread: true, MaxSkew: 2}, "", 2},
+}
+
+func TestAvailabilityService(t *testing.T) {
+	for _, tt := range availabilityServiceTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			restore := cmd.UseDeployAvailability(tt.availability)
+			defer restore()
+			service := genKnativeService(t, getKNativeTemplate1(), "app", true)
+
+			revision := service.Spec.RunLatest.Configuration.RevisionTemplate
+			if minScale := revision.Metadata.Annotations["autoscaling.knative.dev/minScale"]; minScale != tt.expectedMinScale {
+				t.Errorf("Expected the minScale %q, got %q", tt.expectedMinScale, minScale)
+			}
+			constraints := revision.Spec.TopologySpreadConstraints
+			if tt.expectedMaxSkew == 0 {
+				if len(constraints) != 0 {
+					t.Errorf("Expected the pods not to be spread, got %+v", constraints)
+				}
+				return
+			}
+			if len(constraints) != 1 || constraints[0].MaxSkew != tt.expectedMaxSkew || constraints[0].TopologyKey != "topology.kubernetes.io/zone" {
+				t.Errorf("Expected the pods to be spread across the zones with a skew of %d, got %+v", tt.expectedMaxSkew, constraints)
+			}
+		})
+	}
+}
@@ -17,44 +17,242 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var buildAll bool
+
 // buildCmd provides the ability run local builds, or setup/delete Tekton builds, for an appsody project
 var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Locally build a docker image of your appsody project",
-	Long:  `This allows you to build a local Docker image from your Appsody project. Extract is run before the docker build.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// This needs to do:
-		// 1. appsody Extract
-		// 2. docker build -t <project name> -f Dockerfile ./extracted
-
-		extractCmd.Run(cmd, args)
-
-		projectName, perr := getProjectName()
-		if perr != nil {
-			Error.log(perr)
-			os.Exit(1)
-		}
-		extractDir := filepath.Join(getHome(), "extract", projectName)
-		dockerfile := filepath.Join(extractDir, "Dockerfile")
-		buildImage := projectName //Lowercased
-		// If a tag is specified, change the buildImage
-		if tag != "" {
-			buildImage = tag
-		}
-		cmdName := "docker"
-		cmdArgs := []string{"build", "-t", buildImage, "-f", dockerfile, extractDir}
-		execAndWait(cmdName, cmdArgs, DockerLog)
-		if !dryrun {
-			Info.log("Built docker image ", buildImage)
+	Long: `This allows you to build a local Docker image from your Appsody project. Extract is run before the docker build.
+
+In a workspace with an ` + "`" + `appsody-workspace.yaml` + "`" + ` file, use --project to build one of its projects, or --all to build
+every project in dependency order. --parallel N builds N projects at a time, each in its own appsody process, once
+the projects it depends on are built. Their output is interleaved, each line prefixed with its project, and a
+summary of the builds ends it.
+
+With --watch, the image is built again whenever a file of the project changes, reusing the dependency caches of
+the stack, until Ctrl-C. --watch-tag-suffix also tags every rebuilt image with a suffix added to its tag, such
+as myapp:latest-dev, for tools that run the production image continuously.
+
+--scan scans the built image for the known vulnerabilities of its packages with trivy, and --scan-report writes them
+to a SARIF file, which code scanning tools such as GitHub code scanning show on the .appsody-config.yaml.
+
+The notifications of the CLI and project configuration, on the desktop, to a webhook or to a Slack channel, tell
+when the build ends. --no-notify leaves them out.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkBuildWatchFlags(); err != nil {
+			return err
+		}
+		if buildAll {
+			if tag != "" {
+				return errors.New("--tag cannot be used with --all, each project is tagged with its own name")
+			}
+			if provenanceFile != "" || licenseReportFile != "" || metadataFile != "" || scanReportFile != "" {
+				return errors.New("--provenance, --license-report, --metadata-file and --scan-report cannot be used with --all, build the projects one at a time")
+			}
+			if workspaceParallel > 1 {
+				return runWorkspaceCommand(cmd)
+			}
+			return buildWorkspace(cmd, args)
+		}
+		if cmd.Flags().Changed("parallel") {
+			return errors.New("--parallel is for --all, to build several projects of the workspace at a time")
 		}
+		if workspaceProject != "" {
+			if err := enterWorkspaceProject(cmd, workspaceProject); err != nil {
+				return err
+			}
+		}
+		if buildWatch {
+			projectName, err := getProjectName()
+			if err != nil {
+				return err
+			}
+			return watchBuild(projectName)
+		}
+		return buildProject(cmd, args)
 	},
 }
 
+// buildProject builds the project in the current directory
+func buildProject(cmd *cobra.Command, args []string) error {
+	// This needs to do:
+	// 1. appsody Extract
+	// 2. docker build -t <project name> -f Dockerfile ./extracted
+
+	if err := lockProject("build"); err != nil {
+		return err
+	}
+	// builds extract the project in their own scratch directory, so parallel builds never share it
+	scratch, err := scratchDir()
+	if err != nil {
+		return errors.Errorf("Could not create the scratch directory: %v", err)
+	}
+	extractRoot = filepath.Join(scratch, "extract")
+	extractStarted := time.Now()
+	doneExtract := startPhase("extract")
+	if err = extractProject(); err != nil {
+		return err
+	}
+	doneExtract()
+	extractDuration := time.Since(extractStarted)
+	projectConfig, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	hintStackUpdate(projectConfig.Platform)
+	checkDockerResources()
+
+	projectName, err := getProjectName()
+	if err != nil {
+		return err
+	}
+	extractDir := filepath.Join(extractRoot, projectName)
+	dockerfile := filepath.Join(extractDir, "Dockerfile")
+	buildImage := projectName //Lowercased
+	// If a tag is specified, change the buildImage
+	if tag != "" {
+		buildImage = tag
+	}
+	dockerfile, buildKit, err := buildKitDockerfile(dockerfile)
+	if err != nil {
+		return err
+	}
+	if buildKit {
+		os.Setenv("DOCKER_BUILDKIT", "1")
+	}
+	cmdName := "docker"
+	cmdArgs := append([]string{"build", "-t", buildImage, "-f", dockerfile, "--label", devProjectLabel + "=" + projectName}, buildKitArgs()...)
+	cmdArgs = append(cmdArgs, extractDir)
+	started := time.Now()
+	doneBuild := startPhase("build")
+	if err = execAndWaitReturnErr(cmdName, cmdArgs, DockerLog); err != nil {
+		return errors.Errorf("Error running %s command: %v", cmdName, err)
+	}
+	doneBuild()
+	buildDuration := time.Since(started)
+	if !dryrun {
+		Info.log("Built docker image ", buildImage)
+		recordProjectActivity(func(state *projectState) {
+			state.LastBuild = &projectActivity{Image: buildImage, Time: started, Seconds: (extractDuration + buildDuration).Round(time.Millisecond).Seconds()}
+		})
+	}
+	if err := runHooks(hookPostBuild, cmd.Name(), buildImage); err != nil {
+		return err
+	}
+	if licenseReportFile != "" {
+		doneLicenses := startPhase("license-report")
+		if err := generateLicenseReport(projectConfig.Platform, projectName, licenseReportFile); err != nil {
+			return err
+		}
+		doneLicenses()
+	}
+	if scanImage || scanReportFile != "" {
+		doneScan := startPhase("scan")
+		projectDir, _ := getProjectDir()
+		if err := scanBuiltImage(buildImage, projectDir); err != nil {
+			return err
+		}
+		doneScan()
+	}
+	if signImage {
+		if tag == "" {
+			return errors.New("--sign needs --tag to name the image in the registry it is pushed to")
+		}
+		donePush := startPhase("push")
+		if err := DockerPush(buildImage); err != nil {
+			return errors.Errorf("Could not push the image to sign it: %v", err)
+		}
+		donePush()
+		doneSign := startPhase("sign")
+		if err := cosignSign(buildImage); err != nil {
+			return errors.Errorf("Could not sign the image: %v", err)
+		}
+		doneSign()
+	}
+	if metadataFile != "" {
+		if dryrun {
+			planned(planWrite, metadataFile, "build metadata")
+		} else {
+			projectDir, _ := getProjectDir()
+			timings := phaseDurations()
+			timings["total"] = extractDuration + buildDuration
+			if err := writeBuildMetadata(metadataFile, buildImage, projectName, projectDir, timings); err != nil {
+				return errors.Errorf("Could not write the build metadata: %v", err)
+			}
+			Info.log("Build metadata written to ", metadataFile)
+		}
+	}
+	if provenanceFile != "" {
+		if dryrun {
+			planned(planWrite, provenanceFile, "provenance")
+			return nil
+		}
+		projectDir, _ := getProjectDir()
+		stackImage := projectConfig.Platform
+		parameters := map[string]string{"project": projectName, "stack": stackImage, "tag": buildImage}
+		statement, err := generateProvenance(buildImage, stackImage, projectDir, started, parameters)
+		if err != nil {
+			return errors.Errorf("Could not generate the build provenance: %v", err)
+		}
+		if err = writeProvenance(statement, provenanceFile); err != nil {
+			return errors.Errorf("Could not write the build provenance: %v", err)
+		}
+		lastProvenance = statement
+		Info.log("Build provenance written to ", provenanceFile)
+	}
+	return nil
+}
+
+// buildWorkspace builds every project of the workspace, dependencies first
+func buildWorkspace(cmd *cobra.Command, args []string) error {
+	workspaceDir, workspace, err := findWorkspace()
+	if err != nil {
+		return err
+	}
+	projects, err := workspace.buildOrder()
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		Info.logf("Building workspace project %s", project.Name)
+		if err = enterProjectDir(cmd, filepath.Join(workspaceDir, project.Path)); err != nil {
+			return err
+		}
+		if err = buildProject(cmd, args); err != nil {
+			return err
+		}
+	}
+	Info.logf("Built %d workspace projects", len(projects))
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.PersistentFlags().StringVarP(&tag, "tag", "t", "", "Docker image name and optionally a tag in the 'name:tag' format")
+	buildCmd.PersistentFlags().StringVar(&workspaceProject, "project", "", "Build the named project of the "+WorkspaceFile+" workspace instead of the project in the current directory.")
+	buildCmd.PersistentFlags().StringVar(&metadataFile, "metadata-file", "", "Write the image name, tag, digest, stack version, git revision and timings of the build to this JSON file.")
+	buildCmd.PersistentFlags().StringVar(&provenanceFile, "provenance", "", "Write a SLSA provenance statement describing how the image was built to this file.")
+	buildCmd.PersistentFlags().BoolVar(&noNotify, "no-notify", false, "Do not send the notifications of the CLI and project configuration when the build ends.")
+	buildCmd.PersistentFlags().BoolVar(&checkUpdates, "check-updates", false, "Tell when the repositories have a newer version of the stack of the project. Set checkUpdates: true in the CLI configuration to always check.")
+	buildCmd.PersistentFlags().StringVar(&licenseReportFile, "license-report", "", "Write the licenses of the application dependencies and the stack image to this file, as CSV if it ends in .csv, JSON otherwise.")
+	buildCmd.PersistentFlags().BoolVar(&noCacheMounts, "no-cache-mounts", false, "Do not reuse the dependency caches the stack declares between builds.")
+	buildCmd.PersistentFlags().StringArrayVar(&buildSecrets, "secret", nil, "Pass a BuildKit secret to the build, as id=<id>,src=<file>. It is never stored in the image.")
+	buildCmd.PersistentFlags().BoolVar(&scanImage, "scan", false, "Scan the built image for known vulnerabilities with trivy.")
+	buildCmd.PersistentFlags().StringVar(&scanReportFile, "scan-report", "", "Scan the built image with trivy and write the vulnerabilities found to this file, as SARIF.")
+	buildCmd.PersistentFlags().BoolVar(&signImage, "sign", false, "Push the image named by --tag and sign it with cosign.")
+	buildCmd.PersistentFlags().StringVar(&signKey, "sign-key", "", "Cosign private key file to sign with. By default the image is signed keyless.")
+	addJSONEventsFlag(buildCmd)
+	buildCmd.PersistentFlags().BoolVar(&noHooks, "no-hooks", false, "Do not run the post-build hooks of the project.")
+	buildCmd.PersistentFlags().BoolVar(&buildWatch, "watch", false, "Build the image again whenever a file of the project changes, until interrupted.")
+	buildCmd.PersistentFlags().StringVar(&buildWatchTagSuffix, "watch-tag-suffix", "", "With --watch, also tag every rebuilt image with this suffix added to its tag, such as -dev.")
+	buildCmd.PersistentFlags().BoolVar(&forceLock, "force", false, "Build even when another appsody operation, such as a run, is in progress in the project.")
+	buildCmd.PersistentFlags().BoolVar(&buildAll, "all", false, "Build every project of the "+WorkspaceFile+" workspace, in dependency order.")
+	buildCmd.PersistentFlags().IntVar(&workspaceParallel, "parallel", 1, "With --all, build this many projects at a time, each once the projects it depends on are built.")
 }
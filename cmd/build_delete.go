@@ -17,9 +17,8 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"os"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -30,46 +29,44 @@ var deleteCmd = &cobra.Command{
 	Hidden: true,
 	Short:  "Delete a Githook and build pipeline for your Appsody project",
 	Long:   `This allows you to delete a Githook for your Appsody project.`,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// projectDir := getProjectDir()
 		// projectName := filepath.Base(projectDir)
 		projectName, perr := getProjectName()
 		if perr != nil {
-			Error.log(perr)
-			os.Exit(1)
+			return perr
 		}
 		tektonServer := cliConfig.GetString("tektonserver")
 		if tektonServer == "" {
-			Error.log("No target Tekton server specified in the configuration.")
-			os.Exit(1)
+			return errors.New("No target Tekton server specified in the configuration.")
 		}
 		url := fmt.Sprintf("%s/v1/namespaces/default/githubsource/%s", tektonServer, projectName)
 		if dryrun {
 			Info.log("Dry Run appsody build delete")
 		} else {
-			req, _ := http.NewRequest("DELETE", url, nil)
+			req, _ := newRequestWithContext(cliContext(), "DELETE", url, nil)
 			req.Header.Set("Content-Type", "application/json")
 
-			client := &http.Client{}
+			client, err := newHTTPClient(0)
+			if err != nil {
+				return err
+			}
 			Info.log("Making request to ", url)
 			resp, err := client.Do(req)
 			if err != nil {
-				Error.log(err)
-				os.Exit(1)
+				return err
 			}
 			defer resp.Body.Close()
 			body, _ := ioutil.ReadAll(resp.Body)
 			bodyStr := string(body)
 
 			if resp.StatusCode >= 300 {
-				Error.log(resp.Status)
-				Error.log(string(bodyStr))
-				os.Exit(1)
-			} else {
-				Info.log(resp.Status)
-				Info.log(string(bodyStr))
+				return errors.Errorf("%s\n%s", resp.Status, bodyStr)
 			}
+			Info.log(resp.Status)
+			Info.log(string(bodyStr))
 		}
+		return nil
 	},
 }
 
@@ -0,0 +1,88 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+var metadataFile string
+
+// buildMetadata is written by build --metadata-file for the steps of a pipeline that follow the build
+type buildMetadata struct {
+	Image        string       `json:"image"`
+	Tag          string       `json:"tag"`
+	Digest       string       `json:"digest,omitempty"`
+	Project      string       `json:"project"`
+	Stack        string       `json:"stack"`
+	StackVersion string       `json:"stackVersion,omitempty"`
+	Git          *gitMetadata `json:"git,omitempty"`
+	// Timings are the durations of the build steps, in seconds
+	Timings map[string]float64 `json:"timings"`
+}
+
+// stackVersion returns the version of the stack image from its dev.appsody.stack.version label, or its tag
+func stackVersion(stackImage string) string {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", `{{index .Config.Labels "dev.appsody.stack.version"}}`, stackImage).Output()
+	if version := strings.TrimSpace(string(out)); err == nil && version != "" && version != "<no value>" {
+		return version
+	}
+	if i := strings.LastIndex(stackImage, ":"); i > strings.LastIndex(stackImage, "/") {
+		return stackImage[i+1:]
+	}
+	return ""
+}
+
+// splitImageTag splits name:tag, defaulting the tag to latest
+func splitImageTag(image string) (string, string) {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+func writeBuildMetadata(file string, buildImage string, projectName string, projectDir string, timings map[string]time.Duration) error {
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	stackImage := config.Platform
+	name, imageTag := splitImageTag(buildImage)
+	metadata := buildMetadata{
+		Image:        name,
+		Tag:          imageTag,
+		Project:      projectName,
+		Stack:        stackImage,
+		StackVersion: stackVersion(stackImage),
+		Git:          getGitMetadata(projectDir),
+		Timings:      make(map[string]float64),
+	}
+	if _, digest, err := imageDigest(buildImage); err == nil {
+		metadata.Digest = digest
+	} else {
+		Warning.log("The build metadata has no image digest: ", err)
+	}
+	for step, duration := range timings {
+		metadata.Timings[step] = duration.Round(time.Millisecond).Seconds()
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
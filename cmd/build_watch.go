@@ -0,0 +1,172 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// buildWatchDebounce batches the changes of an editor saving many files, or of a git checkout, into one rebuild
+const buildWatchDebounce = time.Second
+
+var buildWatch bool
+var buildWatchTagSuffix string
+
+// watchBuild builds the image of the project, then builds it again after every change of the project, until
+// interrupted. The builds run as separate appsody build commands, so a failed build does not stop the watch,
+// and they reuse the dependency caches the stack declares to only rebuild what changed.
+func watchBuild(projectName string) error {
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return err
+	}
+	if noCacheMounts {
+		Warning.log("--no-cache-mounts makes every rebuild download the dependencies of the project again")
+	}
+	image := projectName
+	if tag != "" {
+		image = tag
+	}
+	buildArgs := watchBuildArgs(os.Args[1:])
+	if dryrun {
+		plannedCommand("appsody", buildArgs)
+		if buildWatchTagSuffix != "" {
+			plannedCommand("docker", []string{"tag", image, devImageTag(image, buildWatchTagSuffix)})
+		}
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err = addWatchRecursive(watcher, projectDir); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	rebuild := func() {
+		started := time.Now()
+		buildCmd, err := selfCommand(projectDir, buildArgs)
+		if err == nil {
+			buildCmd.Stdout = os.Stdout
+			buildCmd.Stderr = os.Stderr
+			err = buildCmd.Run()
+		}
+		if err != nil {
+			Error.log("The build failed, fix the project to build it again: ", err)
+			return
+		}
+		if buildWatchTagSuffix != "" {
+			devImage := devImageTag(image, buildWatchTagSuffix)
+			if err = execAndWaitReturnErr("docker", []string{"tag", image, devImage}, Debug); err != nil {
+				Error.logf("Could not tag the image as %s: %v", devImage, err)
+				return
+			}
+			Info.log("Tagged the image as ", devImage)
+		}
+		Info.logf("Built %s in %s", image, time.Since(started).Round(100*time.Millisecond))
+	}
+	rebuild()
+	Info.logf("Watching %s for changes, press Ctrl-C to stop", projectDir)
+	timer := time.NewTimer(buildWatchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = addWatchRecursive(watcher, event.Name)
+				}
+			}
+			Debug.log("Project changed: ", event)
+			timer.Reset(buildWatchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Warning.log("Project watch error: ", err)
+		case <-timer.C:
+			Info.log("The project changed, building it again")
+			rebuild()
+		case <-interrupt:
+			return nil
+		case <-cliContext().Done():
+			return nil
+		}
+	}
+}
+
+// watchBuildArgs returns the arguments of the appsody build commands of the watch: the arguments of the
+// watch, without the watch flags. --project is left out as the builds run in the project directory, and
+// --config as selfCommand passes it.
+func watchBuildArgs(args []string) []string {
+	dropped := map[string]bool{"--watch-tag-suffix": true, "--project": true, "--config": true}
+	var buildArgs []string
+	for i := 0; i < len(args); i++ {
+		name := strings.SplitN(args[i], "=", 2)[0]
+		switch {
+		case name == "--watch":
+		case dropped[name]:
+			if !strings.Contains(args[i], "=") {
+				// skip the value too
+				i++
+			}
+		default:
+			buildArgs = append(buildArgs, args[i])
+		}
+	}
+	return buildArgs
+}
+
+// devImageTag returns the image name with the suffix added to its tag, myapp:1.0 and -dev give myapp:1.0-dev.
+// An image without tag is tagged latest first.
+func devImageTag(image string, suffix string) string {
+	if strings.LastIndex(image, ":") <= strings.LastIndex(image, "/") {
+		image += ":latest"
+	}
+	return image + suffix
+}
+
+// checkBuildWatchFlags rejects the build flags that make no sense for every build of a watch
+func checkBuildWatchFlags() error {
+	if !buildWatch {
+		if buildWatchTagSuffix != "" {
+			return errors.New("--watch-tag-suffix is only used with --watch")
+		}
+		return nil
+	}
+	switch {
+	case buildAll:
+		return errors.New("--watch cannot be used with --all, watch the projects one at a time with --project")
+	case signImage:
+		return errors.New("--watch cannot be used with --sign, it would push and sign every rebuild")
+	case strings.ContainsAny(buildWatchTagSuffix, ":/@"):
+		return errors.Errorf("The tag suffix %q can only have the characters of a tag, such as -dev", buildWatchTagSuffix)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var noCacheMounts bool
+var buildSecrets []string
+
+// buildKitSyntax enables the RUN --mount options in Dockerfiles
+const buildKitSyntax = "# syntax=docker/dockerfile:1"
+
+var runInstruction = regexp.MustCompile(`(?i)^(\s*RUN)(\s+)`)
+
+// addRunMounts adds the BuildKit mount options to every RUN instruction of the Dockerfile
+func addRunMounts(dockerfile string, mounts []string) string {
+	lines := strings.Split(dockerfile, "\n")
+	for i, line := range lines {
+		lines[i] = runInstruction.ReplaceAllString(line, "${1} "+strings.Join(mounts, " ")+"${2}")
+	}
+	if !strings.HasPrefix(dockerfile, "# syntax=") {
+		lines = append([]string{buildKitSyntax}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// secretID returns the id of a --secret id=...,src=... option
+func secretID(secret string) string {
+	for _, field := range strings.Split(secret, ",") {
+		if strings.HasPrefix(field, "id=") {
+			return strings.TrimPrefix(field, "id=")
+		}
+	}
+	return ""
+}
+
+// secretMounts returns the secret mounts for the secrets the stack consumes, declared in APPSODY_BUILD_SECRETS
+// as id or id=target path, that were passed with --secret. Secrets mounted this way are only visible while
+// the RUN instruction executes and never end up in a layer.
+func secretMounts() ([]string, error) {
+	provided := make(map[string]bool)
+	for _, secret := range buildSecrets {
+		provided[secretID(secret)] = true
+	}
+	var mounts []string
+	declared := make(map[string]bool)
+	stackSecrets, err := getEnvVarList("APPSODY_BUILD_SECRETS")
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range stackSecrets {
+		parts := strings.SplitN(secret, "=", 2)
+		declared[parts[0]] = true
+		if !provided[parts[0]] {
+			Debug.logf("The stack can use the build secret %s, pass it with --secret id=%s,src=<file>", parts[0], parts[0])
+			continue
+		}
+		mount := "--mount=type=secret,id=" + parts[0]
+		if len(parts) == 2 {
+			mount += ",target=" + parts[1]
+		}
+		mounts = append(mounts, mount)
+	}
+	for id := range provided {
+		if !declared[id] {
+			Warning.logf("The stack does not declare the build secret %s, it is only available to Dockerfiles that mount it", id)
+		}
+	}
+	return mounts, nil
+}
+
+// buildKitDockerfile writes a copy of the extracted Dockerfile that mounts the dependency caches the stack
+// declares in APPSODY_BUILD_CACHE and the build secrets it consumes, and returns its path. It returns the
+// original Dockerfile when there is nothing to mount.
+func buildKitDockerfile(dockerfile string) (string, bool, error) {
+	var mounts []string
+	cacheDirs, err := getEnvVarList("APPSODY_BUILD_CACHE")
+	if err != nil {
+		return "", false, err
+	}
+	if !noCacheMounts {
+		for _, dir := range cacheDirs {
+			mounts = append(mounts, "--mount=type=cache,target="+dir)
+		}
+	}
+	secrets, err := secretMounts()
+	if err != nil {
+		return "", false, err
+	}
+	mounts = append(mounts, secrets...)
+	if len(mounts) == 0 {
+		return dockerfile, len(buildSecrets) > 0, nil
+	}
+	if dryrun {
+		planned(planWrite, filepath.Join(filepath.Dir(dockerfile), "Dockerfile.appsody-buildkit"), "Dockerfile with "+strings.Join(mounts, " "))
+		return dockerfile, true, nil
+	}
+	source, err := ioutil.ReadFile(dockerfile)
+	if err != nil {
+		Warning.log("Could not read the Dockerfile to add BuildKit mounts, building without them: ", err)
+		return dockerfile, len(buildSecrets) > 0, nil
+	}
+	mountsDockerfile := filepath.Join(filepath.Dir(dockerfile), "Dockerfile.appsody-buildkit")
+	if err = ioutil.WriteFile(mountsDockerfile, []byte(addRunMounts(string(source), mounts)), 0644); err != nil {
+		Warning.log("Could not write the Dockerfile with BuildKit mounts, building without them: ", err)
+		return dockerfile, len(buildSecrets) > 0, nil
+	}
+	Debug.log("Building with ", strings.Join(mounts, " "))
+	return mountsDockerfile, true, nil
+}
+
+// buildKitArgs returns the docker build arguments passing the --secret options through
+func buildKitArgs() []string {
+	var args []string
+	for _, secret := range buildSecrets {
+		args = append(args, "--secret", secret)
+	}
+	return args
+}
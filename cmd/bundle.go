@@ -0,0 +1,427 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var bundleProjects []string
+var bundleName string
+
+const (
+	bundleManifestFile = "bundle.yaml"
+	bundleIndexFile    = "index.yaml"
+)
+
+var nonFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// bundleManifest describes the content of a bundle, with the sha256 of every file
+type bundleManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Created    time.Time         `yaml:"created"`
+	CLIVersion string            `yaml:"cliVersion"`
+	Stacks     []string          `yaml:"stacks"`
+	Images     map[string]string `yaml:"images"`
+	Files      map[string]string `yaml:"files"`
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Move stacks to machines without network access",
+	Long: `Export the indexes, templates and stack images that projects need into a single file, and import it on a
+disconnected machine. After the import, appsody init, run and build work without network access.`,
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export <file> [stack...]",
+	Short: "Export stacks with their templates and images into a bundle",
+	Long: `This exports the latest version of the named stacks, and of the stacks of the projects given with --project,
+with their templates and their stack images as image tars. Projects pinned to another version of the stack image get
+that image as well.
+
+With --sign-key the bundle is signed with cosign, and the signature written next to it in <file>.sig.
+
+Use --max-concurrent and --limit-rate to go easy on a shared artifact server or link: they bound the templates
+downloaded at the same time and their bandwidth. The stack images are pulled by docker, one at a time.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("Specify the bundle file to write")
+		}
+		stacks := args[1:]
+		var extraImages []string
+		for _, projectDir := range bundleProjects {
+			config, err := loadProjectConfig(projectDir)
+			if err != nil {
+				return errors.Errorf("Could not read the project %s: %v", projectDir, err)
+			}
+			stacks = append(stacks, imageBaseName(config.Platform))
+			extraImages = append(extraImages, config.Platform)
+		}
+		if len(stacks) == 0 {
+			return errors.New("Name the stacks to export, or the projects with --project")
+		}
+		if signKey != "" {
+			if err := checkCosign(); err != nil {
+				return err
+			}
+		}
+		if err := applyTransferLimits(); err != nil {
+			return err
+		}
+		return exportBundle(args[0], stacks, extraImages)
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import a bundle and add its stacks as a repository",
+	Long: `This checks the bundle, loads its stack images into docker, and adds its stacks as a repository named after the
+bundle, or --name. Use --verify-key to check the signature of the bundle before importing it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Specify the bundle file to import")
+		}
+		return importBundle(args[0])
+	},
+}
+
+// exportBundle downloads the templates and saves the images of the stacks into a staging directory, then archives it
+func exportBundle(file string, stacks []string, extraImages []string) error {
+	var index RepoIndex
+	if err := index.getIndex(); err != nil {
+		return errors.Errorf("Could not read index: %v", err)
+	}
+	if dryrun {
+		Info.logf("Dry Run - Skipping export of the stacks %s to %s", strings.Join(stacks, ", "), file)
+		return nil
+	}
+	staging, err := ioutil.TempDir("", "appsody-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	for _, dir := range []string{"templates", "images"} {
+		if err = os.Mkdir(filepath.Join(staging, dir), 0755); err != nil {
+			return err
+		}
+	}
+
+	manifest := bundleManifest{APIVersion: "v1", Created: time.Now().UTC(), CLIVersion: VERSION, Images: map[string]string{}, Files: map[string]string{}}
+	bundleIndex := RepoIndex{APIVersion: index.APIVersion, Generated: manifest.Created, Projects: map[string]ProjectVersions{}}
+	images := map[string]bool{}
+	for _, image := range extraImages {
+		images[image] = true
+	}
+	var downloads []string
+	for _, spec := range stacks {
+		key, err := index.resolveStack(spec)
+		if err != nil {
+			return err
+		}
+		// the bundle has a single repository, its index is keyed by the stack ids
+		_, id := splitStackKey(key)
+		if _, done := bundleIndex.Projects[id]; done {
+			continue
+		}
+		latest := *index.Projects[key][0]
+		latest.URLs = nil
+		latest.Templates = nil
+		for _, template := range index.Projects[key][0].stackTemplates() {
+			templateURL := template.URL
+			name := archiveName(templateURL)
+			relPath := "templates/" + name
+			downloads = append(downloads, templateURL)
+			latest.URLs = append(latest.URLs, relPath)
+			template.URL = relPath
+			latest.Templates = append(latest.Templates, template)
+		}
+		bundleIndex.Projects[id] = ProjectVersions{&latest}
+		manifest.Stacks = append(manifest.Stacks, id)
+	}
+	err = forEachConcurrently(len(downloads), func(i int) error {
+		Info.log("Downloading ", downloads[i])
+		if err := downloadFileToDisk(downloads[i], filepath.Join(staging, "templates", path.Base(downloads[i]))); err != nil {
+			return errors.Errorf("Could not download the template %s: %v", downloads[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, templateURL := range downloads {
+		if image := templateStackImage(filepath.Join(staging, "templates", archiveName(templateURL))); image != "" {
+			images[image] = true
+		}
+	}
+
+	for image := range images {
+		relPath := "images/" + nonFileNameChars.ReplaceAllString(image, "_") + ".tar"
+		if err = dockerPullImage(image); err != nil {
+			return err
+		}
+		Info.log("Saving the stack image ", image)
+		if err = execAndWaitReturnErr("docker", []string{"save", "-o", filepath.Join(staging, filepath.FromSlash(relPath)), image}, Debug); err != nil {
+			return errors.Errorf("Could not save the image %s: %v", image, err)
+		}
+		manifest.Images[image] = relPath
+	}
+
+	data, err := yaml.Marshal(&bundleIndex)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(staging, bundleIndexFile), data, 0644); err != nil {
+		return err
+	}
+	err = filepath.Walk(staging, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(staging, file)
+		manifest.Files[filepath.ToSlash(relPath)], err = fileSha256(file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if data, err = yaml.Marshal(&manifest); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(staging, bundleManifestFile), data, 0644); err != nil {
+		return err
+	}
+	if err = tarGzDirectory(staging, file); err != nil {
+		return errors.Errorf("Could not write the bundle: %v", err)
+	}
+	if signKey != "" {
+		Info.log("Signing the bundle")
+		if err = execAndWaitReturnErr("cosign", []string{"sign-blob", "--yes", "--key", signKey, "--output-signature", file + ".sig", file}, Debug); err != nil {
+			return errors.Errorf("Could not sign the bundle: %v", err)
+		}
+	}
+	Info.logf("Exported %d stacks and %d images to %s", len(manifest.Stacks), len(manifest.Images), file)
+	return nil
+}
+
+// templateStackImage returns the stack image of the .appsody-config.yaml file of a template archive
+func templateStackImage(archive string) string {
+	var image string
+	_ = walkArchive(archive, func(entry archiveEntry) error {
+		if entry.dir || path.Base(entry.name) != ConfigFile {
+			return nil
+		}
+		reader, err := entry.open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		var config ProjectConfig
+		data, err := ioutil.ReadAll(reader)
+		if err == nil && yaml.Unmarshal(data, &config) == nil {
+			image = config.Platform
+		}
+		return nil
+	})
+	return image
+}
+
+func fileSha256(file string) (string, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	digest := sha256.New()
+	if _, err = io.Copy(digest, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// tarGzDirectory archives the files of dir, with paths relative to it
+func tarGzDirectory(dir string, destFile string) error {
+	out, err := os.Create(destFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	var files []string
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, file)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the manifest first, so it can be read without going through the images
+	sort.SliceStable(files, func(i, j int) bool { return filepath.Base(files[i]) == bundleManifestFile })
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(dir, file)
+		header.Name = filepath.ToSlash(relPath)
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		reader, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err = tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// importBundle extracts the bundle into the Appsody home, checks it, loads its images and adds its index as a repository
+func importBundle(file string) error {
+	name := bundleName
+	if name == "" {
+		name = "bundle-" + strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".gz"), ".tar")
+		name = nonFileNameChars.ReplaceAllString(strings.TrimSuffix(name, ".tgz"), "-")
+	}
+	if verifyKey != "" {
+		if err := checkCosign(); err != nil {
+			return err
+		}
+		Info.log("Verifying the signature of the bundle")
+		if err := execAndWaitReturnErr("cosign", []string{"verify-blob", "--key", verifyKey, "--signature", file + ".sig", file}, Debug); err != nil {
+			return errors.Errorf("The signature of the bundle could not be verified: %v", err)
+		}
+	} else if found, _ := exists(file + ".sig"); found {
+		Warning.log("The bundle is signed but its signature is not verified, use --verify-key to verify it")
+	}
+	if dryrun {
+		Info.logf("Dry Run - Skipping import of the bundle %s as the %s repository", file, name)
+		return nil
+	}
+	dest := filepath.Join(getStateDir(), "bundles", name)
+	if err := os.RemoveAll(longPath(dest)); err != nil {
+		return err
+	}
+	err := walkArchive(file, func(entry archiveEntry) error {
+		relPath, err := safeArchivePath(entry.name)
+		if err != nil || entry.dir {
+			return err
+		}
+		return extractArchiveFile(filepath.Join(dest, relPath), entry, lineEndingsKeep)
+	})
+	if err != nil {
+		return errors.Errorf("Could not extract the bundle: %v", err)
+	}
+
+	var manifest bundleManifest
+	data, err := ioutil.ReadFile(filepath.Join(dest, bundleManifestFile))
+	if err == nil {
+		err = yaml.Unmarshal(data, &manifest)
+	}
+	if err != nil {
+		return errors.Errorf("The bundle has no valid %s: %v", bundleManifestFile, err)
+	}
+	for relPath, checksum := range manifest.Files {
+		actual, err := fileSha256(filepath.Join(dest, filepath.FromSlash(relPath)))
+		if err != nil || actual != checksum {
+			return errors.Errorf("The bundle is damaged, %s does not match its checksum", relPath)
+		}
+	}
+
+	for image, relPath := range manifest.Images {
+		Info.log("Loading the stack image ", image)
+		if err = execAndWaitReturnErr("docker", []string{"load", "-i", filepath.Join(dest, filepath.FromSlash(relPath))}, Debug); err != nil {
+			return errors.Errorf("Could not load the image %s: %v", image, err)
+		}
+	}
+
+	index := &RepoIndex{}
+	indexFile := filepath.Join(dest, bundleIndexFile)
+	if data, err = ioutil.ReadFile(indexFile); err == nil {
+		index, err = decodeRepoIndex(data)
+	}
+	if err != nil {
+		return errors.Errorf("The bundle has no valid %s: %v", bundleIndexFile, err)
+	}
+	for _, versions := range index.Projects {
+		for _, version := range versions {
+			for i, relPath := range version.URLs {
+				version.URLs[i] = fileURL(filepath.Join(dest, filepath.FromSlash(relPath)))
+			}
+			for i, template := range version.Templates {
+				version.Templates[i].URL = fileURL(filepath.Join(dest, filepath.FromSlash(template.URL)))
+			}
+		}
+	}
+	if data, err = yaml.Marshal(index); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(indexFile, data, 0644); err != nil {
+		return err
+	}
+
+	var repoFile RepositoryFile
+	if _, err = repoFile.getRepos(); err != nil {
+		return err
+	}
+	repoFile.Remove(name)
+	repoFile.Add(&RepositoryEntry{Name: name, URL: fileURL(indexFile)})
+	if err = repoFile.WriteFile(getRepoFileLocation()); err != nil {
+		return errors.Errorf("Failed to write file to repository location: %v", err)
+	}
+	Info.logf("Imported %d stacks and %d images as the %s repository", len(manifest.Stacks), len(manifest.Images), name)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleExportCmd.PersistentFlags().StringArrayVar(&bundleProjects, "project", nil, "Export the stack of the project in this directory. Can be repeated.")
+	bundleExportCmd.PersistentFlags().StringVar(&signKey, "sign-key", "", "Cosign private key file to sign the bundle with.")
+	addTransferLimitFlags(bundleExportCmd, 4)
+	bundleImportCmd.PersistentFlags().StringVar(&bundleName, "name", "", "Name of the repository of the bundle stacks. By default bundle-<file name>.")
+	bundleImportCmd.PersistentFlags().StringVar(&verifyKey, "verify-key", "", "Cosign public key file to verify the signature of the bundle with.")
+}
@@ -0,0 +1,248 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+)
+
+// The categories of the disk usage report
+const (
+	usageIndexes   = "indexes"
+	usageTemplates = "templates"
+	usageContexts  = "extracted contexts"
+	usageVolumes   = "dependency volumes"
+	usageImages    = "stack images"
+	usageOther     = "other"
+)
+
+var usageCategories = []string{usageIndexes, usageTemplates, usageContexts, usageVolumes, usageImages, usageOther}
+
+// dockerSize matches the sizes docker prints, 12.5MB or 0B
+var dockerSize = regexp.MustCompile(`^([0-9.]+)\s*([kKMGTP]?B)$`)
+
+var dockerSizeUnits = map[string]float64{"B": 1, "kB": 1e3, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12, "PB": 1e15}
+
+// cacheUsage is the disk space used by one item of a category, a stack or a project
+type cacheUsage struct {
+	Category string
+	Item     string
+	Bytes    int64
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the files and docker resources Appsody keeps",
+}
+
+var cacheDuCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show the disk space used by Appsody, by category",
+	Long: `This shows the disk space used by the repository indexes, the templates and extracted project contexts in the
+Appsody home directory, and by the dependency volumes and stack images in docker, with the space of each stack or
+project.
+
+The dependency volumes are named <project>-deps, and are removed with docker volume rm. Stack images are removed
+with docker rmi.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		usage := homeUsage()
+		usage = append(usage, dockerUsage()...)
+		totals := map[string]int64{}
+		for _, item := range usage {
+			totals[item.Category] += item.Bytes
+		}
+		table := uitable.New()
+		table.MaxColWidth = 60
+		table.AddRow("CATEGORY", "ITEM", "SIZE")
+		var total int64
+		for _, category := range usageCategories {
+			table.AddRow(category, "", formatSize(totals[category]))
+			for _, item := range usage {
+				if item.Category == category {
+					table.AddRow("", item.Item, formatSize(item.Bytes))
+				}
+			}
+			total += totals[category]
+		}
+		table.AddRow("total", "", formatSize(total))
+		Info.log(table.String())
+		return nil
+	},
+}
+
+// dirSize adds up the size of the files under path
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// homeUsage breaks down the space used in the Appsody home directory. The templates are those of the imported
+// bundles, counted for each stack of the bundle indexes.
+func homeUsage() []cacheUsage {
+	home := getStateDir()
+	usage := []cacheUsage{{usageIndexes, "repository", dirSize(getRepoDir())}}
+	counted := map[string]bool{getRepoDir(): true}
+
+	cacheDir := filepath.Join(home, "cache")
+	counted[cacheDir] = true
+	usage = append(usage, cacheUsage{usageTemplates, "downloaded", dirSize(cacheDir)})
+
+	extractDir := filepath.Join(home, "extract")
+	counted[extractDir] = true
+	entries, _ := ioutil.ReadDir(extractDir)
+	for _, entry := range entries {
+		usage = append(usage, cacheUsage{usageContexts, entry.Name(), dirSize(filepath.Join(extractDir, entry.Name()))})
+	}
+
+	// the scratch directories of the commands running now, or of ended ones the next command removes
+	counted[scratchRoot()] = true
+	entries, _ = ioutil.ReadDir(scratchRoot())
+	for _, entry := range entries {
+		usage = append(usage, cacheUsage{usageContexts, "scratch " + entry.Name(), dirSize(filepath.Join(scratchRoot(), entry.Name()))})
+	}
+
+	bundlesDir := filepath.Join(home, "bundles")
+	counted[bundlesDir] = true
+	bundles, _ := ioutil.ReadDir(bundlesDir)
+	for _, bundle := range bundles {
+		bundleDir := filepath.Join(bundlesDir, bundle.Name())
+		bundleSize := dirSize(bundleDir)
+		indexFile := filepath.Join(bundleDir, bundleIndexFile)
+		data, _ := ioutil.ReadFile(indexFile)
+		index, err := decodeRepoIndex(data)
+		if err != nil {
+			index = &RepoIndex{}
+		}
+		for id, versions := range index.Projects {
+			var size int64
+			for _, version := range versions {
+				for _, templateURL := range version.URLs {
+					if path, err := localFileURLPath(templateURL); err == nil {
+						if info, err := os.Stat(path); err == nil {
+							size += info.Size()
+						}
+					}
+				}
+			}
+			usage = append(usage, cacheUsage{usageTemplates, id + " (" + bundle.Name() + ")", size})
+			bundleSize -= size
+		}
+		if info, err := os.Stat(indexFile); err == nil {
+			usage = append(usage, cacheUsage{usageIndexes, bundle.Name(), info.Size()})
+			bundleSize -= info.Size()
+		}
+		// the image archives the bundle was imported from
+		usage = append(usage, cacheUsage{usageOther, bundle.Name(), bundleSize})
+	}
+
+	var other int64
+	entries, _ = ioutil.ReadDir(home)
+	for _, entry := range entries {
+		if path := filepath.Join(home, entry.Name()); !counted[path] {
+			other += dirSize(path)
+		}
+	}
+	return append(usage, cacheUsage{usageOther, "home", other})
+}
+
+// dockerUsage returns the space of the dependency volumes and of the stack images, which carry the
+// dev.appsody.stack.version label. Without docker it returns nothing.
+func dockerUsage() []cacheUsage {
+	var usage []cacheUsage
+	out, err := runtimeCommand("docker", "system", "df", "-v", "--format", "{{json .}}").Output()
+	if err != nil {
+		Warning.log("Could not get the disk usage of docker, the volumes and images are not shown: ", err)
+		return nil
+	}
+	var dockerDf struct {
+		Volumes []struct {
+			Name string
+			Size string
+		}
+	}
+	if err = json.Unmarshal(out, &dockerDf); err != nil {
+		Debug.log("Could not parse docker system df: ", err)
+	}
+	for _, volume := range dockerDf.Volumes {
+		if strings.HasSuffix(volume.Name, "-deps") {
+			usage = append(usage, cacheUsage{usageVolumes, volume.Name, parseDockerSize(volume.Size)})
+		}
+	}
+
+	out, err = runtimeCommand("docker", "image", "ls", "--filter", "label=dev.appsody.stack.version", "--format", "{{.ID}}\t{{.Repository}}:{{.Tag}}").Output()
+	if err != nil {
+		Debug.log("Could not list the stack images: ", err)
+		return usage
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sizeOut, err := runtimeCommand("docker", "image", "inspect", "--format", "{{.Size}}", fields[0]).Output()
+		if err != nil {
+			continue
+		}
+		size, _ := strconv.ParseInt(strings.TrimSpace(string(sizeOut)), 10, 64)
+		usage = append(usage, cacheUsage{usageImages, fields[1], size})
+	}
+	return usage
+}
+
+// parseDockerSize converts the sizes docker prints back to bytes
+func parseDockerSize(size string) int64 {
+	match := dockerSize.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0
+	}
+	value, _ := strconv.ParseFloat(match[1], 64)
+	return int64(value * dockerSizeUnits[match[2]])
+}
+
+// formatSize prints a size the way docker does, in decimal units
+func formatSize(bytes int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1000 && unit < len(units)-1 {
+		size /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	return fmt.Sprintf("%.1f%s", size, units[unit])
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheDuCmd)
+}
@@ -0,0 +1,147 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var cleanAllProjects bool
+
+// projectResource is a docker object of a project that clean removes
+type projectResource struct {
+	kind string
+	id   string
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove the containers, networks, volumes and dangling images of your project",
+	Long: `This removes the docker objects appsody created for the project in the current directory: its development and
+service containers, the network of its services, its dependency and sync volumes, and the dangling images left by
+its builds. The objects are found by their dev.appsody.project label, and the volumes also by their names.
+
+Use --all-projects to remove the ones of every project, and --dry-run to list what would be removed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectName := ""
+		if !cleanAllProjects {
+			var err error
+			if projectName, err = getProjectName(); err != nil {
+				return errors.Errorf("Run clean in a project, or use --all-projects: %v", err)
+			}
+		}
+		resources, err := projectResources(projectName)
+		if err != nil {
+			return err
+		}
+		if len(resources) == 0 {
+			Info.log("There is nothing to clean")
+			return nil
+		}
+		removeArgs := map[string][]string{
+			"container": {"rm", "-f"},
+			"network":   {"network", "rm"},
+			"volume":    {"volume", "rm"},
+			"image":     {"image", "rm"},
+		}
+		failed := 0
+		// the containers go first, the networks, volumes and images they use can not be removed before
+		for _, resource := range resources {
+			if !dryrun {
+				Info.logf("Removing %s %s", resource.kind, resource.id)
+			}
+			if err := execAndWaitReturnErr("docker", append(removeArgs[resource.kind], resource.id), Debug); err != nil {
+				Warning.logf("Could not remove %s %s: %v", resource.kind, resource.id, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of the %d objects could not be removed", failed, len(resources))
+		}
+		return nil
+	},
+}
+
+// projectResources lists the docker objects of the project, or of all the projects when the name is empty
+func projectResources(projectName string) ([]projectResource, error) {
+	label := "label=" + devProjectLabel
+	if projectName != "" {
+		label += "=" + projectName
+	}
+	var resources []projectResource
+	seen := map[string]bool{}
+	add := func(kind string, ids []string) {
+		for _, id := range ids {
+			if id != "" && !seen[kind+"/"+id] {
+				seen[kind+"/"+id] = true
+				resources = append(resources, projectResource{kind, id})
+			}
+		}
+	}
+	for _, list := range []struct {
+		kind string
+		args []string
+	}{
+		{"container", []string{"ps", "-a", "--filter", label, "--format", "{{.Names}}"}},
+		{"network", []string{"network", "ls", "--filter", label, "--format", "{{.Name}}"}},
+		{"volume", []string{"volume", "ls", "--filter", label, "--format", "{{.Name}}"}},
+		{"image", []string{"image", "ls", "--filter", label, "--filter", "dangling=true", "--format", "{{.ID}}"}},
+	} {
+		out, err := runtimeCommand("docker", list.args...).Output()
+		if err != nil {
+			return nil, errors.Errorf("Could not list the %ss of the docker engine: %v", list.kind, err)
+		}
+		add(list.kind, strings.Fields(string(out)))
+		if projectName == "" {
+			continue
+		}
+		// the objects created before they were labelled are found by their names
+		switch list.kind {
+		case "container":
+			if dockerContainerExists(projectName + "-dev") {
+				add("container", []string{projectName + "-dev"})
+			}
+		case "network":
+			if dockerNetworkExists(servicesNetworkName(projectName)) {
+				add("network", []string{servicesNetworkName(projectName)})
+			}
+		case "volume":
+			out, err := runtimeCommand("docker", "volume", "ls", "--format", "{{.Name}}").Output()
+			if err != nil {
+				return nil, errors.Errorf("Could not list the volumes of the docker engine: %v", err)
+			}
+			for _, volume := range strings.Fields(string(out)) {
+				if volume == projectName+"-deps" || strings.HasPrefix(volume, projectName+"-sync-") {
+					add("volume", []string{volume})
+				}
+			}
+		}
+	}
+	return resources, nil
+}
+
+func dockerContainerExists(name string) bool {
+	out, err := runtimeCommand("docker", "ps", "-a", "-q", "--filter", "name=^/"+name+"$").Output()
+	return err == nil && strings.TrimSpace(string(out)) != ""
+}
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+	cleanCmd.PersistentFlags().BoolVar(&cleanAllProjects, "all-projects", false, "Remove the objects of all the projects, not only the one in the current directory.")
+	cleanCmd.PersistentFlags().BoolVar(&dryrun, "dry-run", false, "List the objects that would be removed, without removing them.")
+}
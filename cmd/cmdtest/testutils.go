@@ -56,7 +56,8 @@ func RunAppsodyCmdExec(args []string, workingDir string) (string, error) {
 		return "", err
 	}
 
-	cmdArgs := []string{"go", "run", execDir + "/..", "-v"}
+	// the fixtures tag builds the CLI with the fixtures of UseFixtures
+	cmdArgs := []string{"go", "run", "-tags", "fixtures", execDir + "/..", "-v"}
 	cmdArgs = append(cmdArgs, args...)
 	fmt.Println(cmdArgs)
 
@@ -167,7 +168,8 @@ func ParseRepoList(repoListString string) []Repository {
 	repoStrs := strings.Split(repoListString, "\n")
 	var repos []Repository
 	for _, repoStr := range repoStrs {
-		fields := strings.Fields(repoStr)
+		// the default repository is marked with a *
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(repoStr), "*"))
 		if len(fields) == 2 {
 			if fields[0] != "NAME" && fields[0] != "Using" {
 				repos = append(repos, Repository{fields[0], fields[1]})
@@ -254,3 +256,61 @@ func RunDockerCmdExec(args []string) (string, error) {
 
 	return outBuffer.String(), err
 }
+
+// UseFixtures makes the appsody commands run by RunAppsodyCmdExec answer their
+// HTTP requests and docker and kubectl commands from the fixtures in dir, so
+// that they run without a network or a container runtime.
+// mode is "record" to save the fixtures by running against the real ones,
+// or "replay". The mode may be overridden with APPSODY_FIXTURES_MODE.
+// Returns a function which should be deferred by the caller to stop
+// using the fixtures.
+func UseFixtures(dir string, mode string) (func(), error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if override := os.Getenv("APPSODY_FIXTURES_MODE"); override != "" {
+		mode = override
+	}
+	if mode != "record" && mode != "replay" {
+		return nil, fmt.Errorf("The fixtures mode %s is not record or replay", mode)
+	}
+	oldDir, hadDir := os.LookupEnv("APPSODY_FIXTURES")
+	oldMode, hadMode := os.LookupEnv("APPSODY_FIXTURES_MODE")
+	os.Setenv("APPSODY_FIXTURES", absDir)
+	os.Setenv("APPSODY_FIXTURES_MODE", mode)
+	restore := func() {
+		if hadDir {
+			os.Setenv("APPSODY_FIXTURES", oldDir)
+		} else {
+			os.Unsetenv("APPSODY_FIXTURES")
+		}
+		if hadMode {
+			os.Setenv("APPSODY_FIXTURES_MODE", oldMode)
+		} else {
+			os.Unsetenv("APPSODY_FIXTURES_MODE")
+		}
+	}
+	return restore, nil
+}
+
+// TempHome creates an appsody home in a new temporary directory, with a CLI
+// configuration file that uses it, for the tests that must not change the
+// appsody home of the user.
+// Returns the configuration file and the home.
+// Returns a function which should be deferred by the caller to remove them.
+func TempHome() (string, string, func(), error) {
+	home, err := ioutil.TempDir("", "appsody-home")
+	if err != nil {
+		return "", "", nil, err
+	}
+	cleanup := func() {
+		os.RemoveAll(home)
+	}
+	configFile := filepath.Join(home, ".appsody.yaml")
+	if err = ioutil.WriteFile(configFile, []byte("home: "+filepath.ToSlash(home)+"\n"), 0644); err != nil {
+		cleanup()
+		return "", "", nil, err
+	}
+	return configFile, home, cleanup, nil
+}
@@ -0,0 +1,176 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// interruptGrace is how long a command has to stop after Ctrl-C, before the CLI exits anyway
+	interruptGrace = 10 * time.Second
+	// cleanupTimeout bounds the cleanup of the commands that stop their containers or pods on Ctrl-C
+	cleanupTimeout = time.Minute
+)
+
+// errInterrupted is the outcome of a command that was stopped on Ctrl-C
+var errInterrupted = errors.New("the command was interrupted")
+
+// commandTimeout is the global --timeout option, how long the command may run. 0 is no limit.
+var commandTimeout time.Duration
+
+var (
+	contextLock      sync.Mutex
+	commandCtx       = context.Background()
+	cancelCommandCtx = func() {}
+	// rootCtx is the context of the command, commandCtx is replaced by the one of the cleanup
+	rootCtx = context.Background()
+	// interruptsHandled is set by the commands that clean up on Ctrl-C by themselves, see handleInterrupts
+	interruptsHandled bool
+	cleaningUp        bool
+	// cleanupDone is closed by endCleanup once the interrupt handler of the command has cleaned up
+	cleanupDone = make(chan struct{})
+)
+
+// cliContext is the context of the command: it is cancelled on Ctrl-C, when the daemon stops a session, and
+// once --timeout has passed. The downloads, and the docker, podman and kubectl commands, stop with it.
+func cliContext() context.Context {
+	contextLock.Lock()
+	defer contextLock.Unlock()
+	return commandCtx
+}
+
+// newRequestWithContext is http.NewRequestWithContext, which the Go 1.12 toolchain of the builds does not have
+func newRequestWithContext(ctx context.Context, method string, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// initCommandContext sets up the context of the command once the flags are parsed
+func initCommandContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	if commandTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, commandTimeout)
+		cancelAll := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelAll()
+		}
+	}
+	contextLock.Lock()
+	commandCtx, cancelCommandCtx, rootCtx = ctx, cancel, ctx
+	cleanupDone = make(chan struct{})
+	contextLock.Unlock()
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		contextLock.Lock()
+		handled := interruptsHandled
+		contextLock.Unlock()
+		if handled {
+			return
+		}
+		Warning.log("Interrupted, stopping. Press Ctrl-C again to exit right away.")
+		cancel()
+		select {
+		case <-interrupts:
+		case <-time.After(interruptGrace):
+		}
+		os.Exit(130)
+	}()
+	if commandTimeout > 0 {
+		go func() {
+			<-ctx.Done()
+			if ctx.Err() == context.DeadlineExceeded {
+				Error.logf("The command did not finish within --timeout %s, stopping it", commandTimeout)
+			}
+		}()
+	}
+}
+
+// handleInterrupts is for the commands that stop their containers or pods on Ctrl-C. The returned channel
+// receives Ctrl-C, or the end of --timeout, after which the commands of the cleanup run with a context of
+// their own, as the one of the command is done.
+func handleInterrupts() <-chan os.Signal {
+	contextLock.Lock()
+	interruptsHandled = true
+	ctx := commandCtx
+	contextLock.Unlock()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan os.Signal, 1)
+	go func() {
+		var sig os.Signal = syscall.SIGTERM
+		select {
+		case sig = <-interrupts:
+		case <-ctx.Done():
+		}
+		beginCleanup()
+		stop <- sig
+	}()
+	return stop
+}
+
+// beginCleanup gives the cleanup of an interrupted command a context of its own
+func beginCleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	contextLock.Lock()
+	commandCtx, cancelCommandCtx = ctx, cancel
+	cleaningUp = true
+	contextLock.Unlock()
+}
+
+// endCleanup tells waitForCleanup that the interrupt handler of the command is done
+func endCleanup() {
+	contextLock.Lock()
+	defer contextLock.Unlock()
+	select {
+	case <-cleanupDone:
+	default:
+		close(cleanupDone)
+	}
+}
+
+// waitForCleanup holds the end of an interrupted command while its interrupt handler cleans up, until the
+// handler calls endCleanup. It returns whether the command was interrupted.
+func waitForCleanup() bool {
+	contextLock.Lock()
+	wait := interruptsHandled && (cleaningUp || rootCtx.Err() != nil)
+	done := cleanupDone
+	contextLock.Unlock()
+	if wait {
+		select {
+		case <-done:
+		case <-time.After(cleanupTimeout):
+			Warning.log("The command did not clean up within ", cleanupTimeout)
+		}
+	}
+	return wait
+}
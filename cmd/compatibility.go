@@ -0,0 +1,150 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The apiVersions of the repository indexes and of their stacks this CLI can read. An empty apiVersion
+// comes from the older indexes and is read as v1.
+var (
+	supportedIndexAPIVersions = []string{"", APIVersionV1, indexAPIVersionV2}
+	supportedStackAPIVersions = []string{"", APIVersionV1}
+)
+
+var cliVersionPattern = regexp.MustCompile(`^v?(\d+(\.\d+)*)`)
+
+// cliVersion returns the major.minor.patch version of the CLI, or an empty string for the development
+// builds, which are not checked against the versions stacks require
+func cliVersion() string {
+	match := cliVersionPattern.FindStringSubmatch(VERSION)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func supportedAPIVersion(supported []string, apiVersion string) bool {
+	for _, version := range supported {
+		if version == apiVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIndexAPIVersion fails for the indexes in a format of a newer CLI
+func checkIndexAPIVersion(url string, apiVersion string) error {
+	if supportedAPIVersion(supportedIndexAPIVersions, apiVersion) {
+		return nil
+	}
+	return errors.Errorf("The repository index %s has apiVersion %s, which this version %s of the Appsody CLI can not read. Upgrade the Appsody CLI to use this repository.", url, apiVersion, VERSION)
+}
+
+// checkCompatibility fails for the stacks that need another version of the CLI, from the apiVersion
+// of the stack or its requires-cli constraint
+func (p *ProjectVersion) checkCompatibility() error {
+	if !supportedAPIVersion(supportedStackAPIVersions, p.APIVersion) {
+		return errors.Errorf("The stack %s %s has apiVersion %s, which this version %s of the Appsody CLI does not support. Upgrade the Appsody CLI to use it.", p.Name, p.Version, p.APIVersion, VERSION)
+	}
+	return checkRequiresCLI("The stack "+p.Name+" "+p.Version, p.cliConstraint())
+}
+
+// cliConstraint returns the constraint of the stack on the CLI version, from requiresAppsodyVersion and requires-cli
+func (p *ProjectVersion) cliConstraint() string {
+	var constraints []string
+	for _, constraint := range []string{p.RequiresAppsodyVersion, p.RequiresCLI} {
+		if constraint = strings.TrimSpace(constraint); constraint != "" {
+			constraints = append(constraints, constraint)
+		}
+	}
+	return strings.Join(constraints, ",")
+}
+
+// deprecationNotice tells that the stack is deprecated, and why when the index says it
+func (p *ProjectVersion) deprecationNotice() string {
+	notice := "The stack " + p.Name + " " + p.Version + " is deprecated"
+	if reason := strings.TrimSpace(p.Deprecated); reason != "" && reason != "true" {
+		notice += ": " + reason
+	}
+	return notice
+}
+
+// checkRequiresCLI fails when the CLI version does not meet the constraint, a comma separated list of
+// versions with one of the >=, >, <=, < and = operators. A version without operator is a minimum version.
+func checkRequiresCLI(what string, constraint string) error {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" {
+		return nil
+	}
+	version := cliVersion()
+	if version == "" {
+		Debug.logf("%s requires the Appsody CLI %s, not checked for the development build %s", what, constraint, VERSION)
+		return nil
+	}
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		operator := ">="
+		for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(part, candidate) {
+				operator = candidate
+				break
+			}
+		}
+		required := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(part, operator)), "v")
+		if !cliVersionPattern.MatchString(required) {
+			return errors.Errorf("%s has an invalid requires-cli constraint %q", what, constraint)
+		}
+		var ok bool
+		switch operator {
+		case ">=":
+			ok = !versionLess(version, required)
+		case ">":
+			ok = versionLess(required, version)
+		case "<=":
+			ok = !versionLess(required, version)
+		case "<":
+			ok = versionLess(version, required)
+		default:
+			ok = !versionLess(version, required) && !versionLess(required, version)
+		}
+		if !ok {
+			advice := "Upgrade the Appsody CLI to use it."
+			if operator == "<" || operator == "<=" {
+				advice = "Use a newer version of the stack, or an older Appsody CLI."
+			}
+			return errors.Errorf("%s requires the Appsody CLI %s, this is version %s. %s", what, constraint, version, advice)
+		}
+	}
+	return nil
+}
+
+// checkStackImageRequiresCLI checks the CLI version against the APPSODY_REQUIRES_CLI constraint of the
+// stack image of the project
+func checkStackImageRequiresCLI() error {
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	constraint, err := getEnvVar("APPSODY_REQUIRES_CLI")
+	if err != nil {
+		return err
+	}
+	return checkRequiresCLI("The stack image "+config.Platform, constraint)
+}
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -16,16 +16,41 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
 	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 )
 
-// bash completions
-var bashCompletionCmd = &cobra.Command{
-	Use:   "completion",
-	Short: "Generates bash tab completions",
-	Long: `Outputs a bash completion script for appsody to stdout.  Bash completion is optionally available for your convenience. It helps you fill out appsody commands when you type the [TAB] key.
+// completedNames maps the commands whose first argument is a repository, a stack or a context to the names
+// completed for it, see completionNamesCmd
+var completedNames = map[string]string{
+	"appsody config use-context": "contexts",
+	"appsody init":               "stacks",
+	"appsody repo default":       "repos",
+	"appsody repo diff":          "repos",
+	"appsody repo mirror":        "repos",
+	"appsody repo refresh":       "repos",
+	"appsody repo remove":        "repos",
+	"appsody repo rename":        "repos",
+	"appsody repo set-url":       "repos",
+	"appsody repo watch":         "repos",
+	"appsody stack diff":         "stacks",
+	"appsody templates":          "stacks",
+}
+
+// shell completions
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish]",
+	Short: "Generates shell tab completions",
+	Long: `Outputs a completion script for appsody to stdout, for bash unless zsh or fish is given. Shell completion is optionally available for your convenience. It helps you fill out appsody commands when you type the [TAB] key.
+
+Repository names, stack ids and context names are completed from the appsody home, without reaching the repositories.
 
 	To install on macOS
 	1. brew install bash-completion
@@ -36,39 +61,349 @@ var bashCompletionCmd = &cobra.Command{
 	1. On a current Linux OS (in a non-minimal installation), bash completion should be available.
 	2. For Debian see the following link for more information:  https://debian-administration.org/article/316/An_introduction_to_bash_completion_part_1
 	3. Make sure to copy the appsody completion file generated above into the appropriate directory for your Linux distribution e.g.
-	appsody completion >  /etc/bash_completion.d/appsody`,
+	appsody completion >  /etc/bash_completion.d/appsody
 
-	Run: func(cmd *cobra.Command, args []string) {
-		buf := new(bytes.Buffer)
+	To install for zsh
+	appsody completion zsh > "${fpath[1]}/_appsody"
 
-		Debug.log("Running bash completion script")
-		_ = rootCmd.GenBashCompletion(buf)
-		output := buf.String()
-		// We need to use real spaces because .GenBashCompletion does and formatting requires it
-		spaceTab := "    "
-		afterAppsodyDevInit := strings.Split(output, "_appsody_init()")
-		header := "# Outputs a bash completion script for appsody to stdout. " +
-			"Bash completion is optionally available for your convenience. It helps you fill out appsody commands when you type the [TAB] key.\n" +
-			"# To install on Linux\n" +
-			"# 1. On a current Linux OS (in a non-minimal installation), bash completion should be available.\n" +
-			"# 2. Place the completion script generated above in your bash completions directory.\n" +
-			"# 3. appsody completion > /usr/local/etc/bash_completion.d/appsody\n\n" +
-			"# To install on macOS\n" +
-			"# 1. brew install bash-completion\n" +
-			"# 2. Make sure to update your ~/.bash_profile as instructed\n" +
-			"# 3. appsody completion > /usr/local/etc/bash_completion.d/appsdy\n"
-		extra := "flags=()\n" + spaceTab +
-			"kdl=\"$((appsody list) | awk -F ' ' '{print $1}')\"\n" +
-			spaceTab + "arr=($kdl)\n" + spaceTab + "len=${#arr[@]}\n" +
-			spaceTab + "for (( i=1; i<$len; i++ ))\n" + spaceTab + "do\n" +
-			spaceTab + spaceTab + "commands+=(\"${arr[$i]}\")\n" + spaceTab + "done\n"
-
-		fmt.Println(header + afterAppsodyDevInit[0] + "_appsody_init()\n" + strings.Replace(afterAppsodyDevInit[1], "flags=()", extra, 1))
+	To install for fish
+	appsody completion fish > ~/.config/fish/completions/appsody.fish`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := "bash"
+		if len(args) > 0 {
+			shell = args[0]
+		}
+		Debug.logf("Running %s completion script", shell)
+		buf := new(bytes.Buffer)
+		switch shell {
+		case "bash":
+			if err := genBashCompletion(buf); err != nil {
+				return err
+			}
+		case "zsh":
+			genZshCompletion(buf)
+		case "fish":
+			genFishCompletion(buf)
+		default:
+			return errors.Errorf("There are no completions for %s, the shells are bash, zsh and fish", shell)
+		}
+		fmt.Print(buf.String())
+		return nil
+	},
+}
 
+// completionNamesCmd prints the names the completion scripts complete. It only reads local files, as it runs
+// each time [TAB] is pressed.
+var completionNamesCmd = &cobra.Command{
+	Use:    "names <repos|stacks|contexts>",
+	Hidden: true,
+	Short:  "Prints the repository names, the stack ids or the context names to complete",
+	Args:   cobra.ExactArgs(1),
+	// the home is not set up, the names are read from what is there
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var names []string
+		switch args[0] {
+		case "repos":
+			names = completionRepoNames()
+		case "stacks":
+			names = completionStackIDs()
+		case "contexts":
+			names = contextNames()
+		default:
+			return errors.Errorf("There are no %s names, the names are repos, stacks or contexts", args[0])
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
 	},
 }
 
 func init() {
-	rootCmd.AddCommand(bashCompletionCmd)
+	rootCmd.AddCommand(completionCmd)
+	completionCmd.AddCommand(completionNamesCmd)
+}
+
+// completionRepoNames returns the names of the repositories of the repository file. The file is not recovered
+// when it can not be parsed, there are no names then.
+func completionRepoNames() []string {
+	data, err := ioutil.ReadFile(getRepoFileLocation())
+	if err != nil {
+		return nil
+	}
+	var repoFile RepositoryFile
+	if err = yaml.Unmarshal(data, &repoFile); err != nil {
+		return nil
+	}
+	var names []string
+	for _, repo := range repoFile.Repositories {
+		names = append(names, repo.Name)
+	}
+	return names
+}
+
+// completionStackIDs returns the ids of the stacks of the cached indexes, and the <repository>/<stack id> of
+// each of them. The repositories without a cached index are left out.
+func completionStackIDs() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, repoName := range completionRepoNames() {
+		index, err := readCachedIndex(repoName)
+		if err != nil || index == nil {
+			continue
+		}
+		for id := range index.Projects {
+			add(id)
+			add(repoName + "/" + id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// completedCommands returns the commands that are completed, the root first and then depth first
+func completedCommands(c *cobra.Command) []*cobra.Command {
+	commands := []*cobra.Command{c}
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() {
+			commands = append(commands, completedCommands(sub)...)
+		}
+	}
+	return commands
+}
+
+// visibleFlags returns the flags of the set that are not hidden
+func visibleFlags(flags *pflag.FlagSet) []*pflag.Flag {
+	var visible []*pflag.Flag
+	flags.VisitAll(func(f *pflag.Flag) {
+		if !f.Hidden {
+			visible = append(visible, f)
+		}
+	})
+	return visible
+}
+
+// firstLine returns the first line of a usage, the completion descriptions are one line
+func firstLine(usage string) string {
+	return strings.TrimSpace(strings.SplitN(usage, "\n", 2)[0])
+}
+
+// namesOf returns the commands of completedNames that complete the names, sorted
+func namesOf(kind string) []string {
+	var paths []string
+	for path, names := range completedNames {
+		if names == kind {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// genBashCompletion writes the bash completion script. The repository and stack names are completed by
+// __custom_func, which the script calls when it has no other completion for the first argument of a command.
+func genBashCompletion(w io.Writer) error {
+	var custom strings.Builder
+	custom.WriteString("__custom_func() {\n")
+	custom.WriteString("    if [[ ${#nouns[@]} -ne 0 ]]; then\n        return\n    fi\n")
+	custom.WriteString("    case ${last_command} in\n")
+	for _, kind := range []string{"repos", "stacks", "contexts"} {
+		var commands []string
+		for _, path := range namesOf(kind) {
+			commands = append(commands, strings.Replace(path, " ", "_", -1))
+		}
+		fmt.Fprintf(&custom, "        %s)\n", strings.Join(commands, "|"))
+		fmt.Fprintf(&custom, "            COMPREPLY=( $(compgen -W \"$(\"${words[0]}\" completion names %s 2>/dev/null)\" -- \"$cur\") )\n", kind)
+		custom.WriteString("            ;;\n")
+	}
+	custom.WriteString("    esac\n}\n")
+	rootCmd.BashCompletionFunction = custom.String()
+
+	header := "# Outputs a bash completion script for appsody to stdout. " +
+		"Bash completion is optionally available for your convenience. It helps you fill out appsody commands when you type the [TAB] key.\n" +
+		"# To install on Linux\n" +
+		"# 1. On a current Linux OS (in a non-minimal installation), bash completion should be available.\n" +
+		"# 2. Place the completion script generated above in your bash completions directory.\n" +
+		"# 3. appsody completion > /usr/local/etc/bash_completion.d/appsody\n\n" +
+		"# To install on macOS\n" +
+		"# 1. brew install bash-completion\n" +
+		"# 2. Make sure to update your ~/.bash_profile as instructed\n" +
+		"# 3. appsody completion > /usr/local/etc/bash_completion.d/appsody\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	return rootCmd.GenBashCompletion(w)
+}
+
+// zshQuote quotes a word for zsh
+func zshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// zshFlags returns the _describe candidates of the flags
+func zshFlags(flags []*pflag.Flag) string {
+	var candidates []string
+	for _, f := range flags {
+		usage := firstLine(f.Usage)
+		candidates = append(candidates, zshQuote("--"+f.Name+":"+usage))
+		if f.Shorthand != "" {
+			candidates = append(candidates, zshQuote("-"+f.Shorthand+":"+usage))
+		}
+	}
+	return strings.Join(candidates, " ")
+}
+
+// genZshCompletion writes the zsh completion script. The command is found from the words typed so far, then
+// its subcommands, its flags, the names of completedNames or files are completed.
+func genZshCompletion(w io.Writer) {
+	commands := completedCommands(rootCmd)
+	fmt.Fprintln(w, "#compdef appsody")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "__appsody_commands=(")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "    %s\n", zshQuote(c.CommandPath()))
+	}
+	fmt.Fprintln(w, ")")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_appsody() {")
+	fmt.Fprintln(w, "    local cmdpath=appsody word names")
+	fmt.Fprintln(w, "    local -a subcommands flags")
+	fmt.Fprintln(w, "    for word in ${words[2,CURRENT-1]}; do")
+	fmt.Fprintln(w, `        (( ${__appsody_commands[(Ie)$cmdpath $word]} )) && cmdpath="$cmdpath $word"`)
+	fmt.Fprintln(w, "    done")
+	fmt.Fprintf(w, "    flags=(%s)\n", zshFlags(visibleFlags(rootCmd.PersistentFlags())))
+	for _, c := range commands[1:] {
+		if persistent := visibleFlags(c.PersistentFlags()); len(persistent) > 0 {
+			path := c.CommandPath()
+			fmt.Fprintf(w, "    if [[ $cmdpath == %s || $cmdpath == %s* ]]; then\n", zshQuote(path), zshQuote(path+" "))
+			fmt.Fprintf(w, "        flags+=(%s)\n", zshFlags(persistent))
+			fmt.Fprintln(w, "    fi")
+		}
+	}
+	fmt.Fprintln(w, "    case $cmdpath in")
+	for _, c := range commands {
+		path := c.CommandPath()
+		fmt.Fprintf(w, "        %s)\n", zshQuote(path))
+		var subcommands []string
+		for _, sub := range c.Commands() {
+			if sub.IsAvailableCommand() {
+				subcommands = append(subcommands, zshQuote(sub.Name()+":"+sub.Short))
+			}
+		}
+		for _, arg := range c.ValidArgs {
+			subcommands = append(subcommands, zshQuote(arg))
+		}
+		if len(subcommands) > 0 {
+			fmt.Fprintf(w, "            subcommands=(%s)\n", strings.Join(subcommands, " "))
+		}
+		if local := visibleFlags(c.LocalNonPersistentFlags()); len(local) > 0 {
+			fmt.Fprintf(w, "            flags+=(%s)\n", zshFlags(local))
+		}
+		if names, ok := completedNames[path]; ok {
+			fmt.Fprintf(w, "            names=%s\n", names)
+		}
+		fmt.Fprintln(w, "            ;;")
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, `    if [[ $PREFIX == -* ]]; then
+        _describe -t flags flag flags
+    elif (( $#subcommands )); then
+        _describe -t commands command subcommands
+    elif [[ -n $names ]]; then
+        compadd -- ${(f)"$(${words[1]} completion names $names 2>/dev/null)"}
+    else
+        _files
+    fi
+}
+
+if [[ $funcstack[1] == _appsody ]]; then
+    _appsody "$@"
+else
+    compdef _appsody appsody
+fi`)
+}
+
+// fishQuote quotes a word for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// fishFlags writes the completions of the flags when the condition holds
+func fishFlags(w io.Writer, condition string, flags []*pflag.Flag) {
+	for _, f := range flags {
+		line := "complete -c appsody"
+		if condition != "" {
+			line += " -n " + fishQuote(condition)
+		}
+		line += " -l " + f.Name
+		if f.Shorthand != "" {
+			line += " -s " + f.Shorthand
+		}
+		if f.Value.Type() != "bool" {
+			line += " -r"
+		}
+		fmt.Fprintln(w, line+" -d "+fishQuote(firstLine(f.Usage)))
+	}
+}
+
+// genFishCompletion writes the fish completion script. __appsody_command finds the command from the words
+// typed so far, the completions of each command are conditioned on it.
+func genFishCompletion(w io.Writer) {
+	commands := completedCommands(rootCmd)
+	fmt.Fprint(w, "set -g __appsody_commands")
+	for _, c := range commands[1:] {
+		fmt.Fprint(w, " "+fishQuote(c.CommandPath()))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprint(w, `
+function __appsody_command
+    set -l cmdpath appsody
+    for word in (commandline -opc)[2..-1]
+        if contains -- "$cmdpath $word" $__appsody_commands
+            set cmdpath "$cmdpath $word"
+        end
+    end
+    echo $cmdpath
+end
+
+function __appsody_using
+    test (__appsody_command) = $argv[1]
+end
 
+function __appsody_within
+    set -l cmdpath (__appsody_command)
+    test $cmdpath = $argv[1]; or string match -q -- "$argv[1] *" $cmdpath
+end
+`)
+	fishFlags(w, "", visibleFlags(rootCmd.PersistentFlags()))
+	for _, c := range commands {
+		path := c.CommandPath()
+		using := "__appsody_using " + fishQuote(path)
+		for _, sub := range c.Commands() {
+			if sub.IsAvailableCommand() {
+				fmt.Fprintf(w, "complete -c appsody -n %s -f -a %s -d %s\n", fishQuote(using), fishQuote(sub.Name()), fishQuote(sub.Short))
+			}
+		}
+		if len(c.ValidArgs) > 0 {
+			fmt.Fprintf(w, "complete -c appsody -n %s -f -a %s\n", fishQuote(using), fishQuote(strings.Join(c.ValidArgs, " ")))
+		}
+		if c != rootCmd {
+			fishFlags(w, "__appsody_within "+fishQuote(path), visibleFlags(c.PersistentFlags()))
+		}
+		fishFlags(w, using, visibleFlags(c.LocalNonPersistentFlags()))
+		if names, ok := completedNames[path]; ok {
+			fmt.Fprintf(w, "complete -c appsody -n %s -f -a %s\n", fishQuote(using), fishQuote("(appsody completion names "+names+" 2>/dev/null)"))
+		}
+	}
 }
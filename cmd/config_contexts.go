@@ -0,0 +1,229 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// defaultContext is the context of the repository file and configuration of the appsody home itself
+const defaultContext = "default"
+
+// contextEnv selects the context of a command, as --context does
+const contextEnv = "APPSODY_CONTEXT"
+
+// contextName is what a context is named, so that it can be a directory
+var contextName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-_.]{0,49}$`)
+
+var contextFlag string
+
+// activeContext is the context of the command, "" for the default one
+var activeContext string
+
+// rootConfigFile is the configuration of the appsody home, which keeps the current context
+var rootConfigFile string
+
+// contextFromFlag tells whether the context was chosen with --context or APPSODY_CONTEXT
+var contextFromFlag bool
+
+// contextDir is the directory of the repository file and configuration of a context:
+//
+//   $APPSODY_HOME/profiles/<name>/.appsody.yaml
+//   $APPSODY_HOME/profiles/<name>/repository/repository.yaml
+func contextDir(name string) string {
+	return filepath.Join(getHome(), "profiles", name)
+}
+
+// repoStateDir is the directory of the cached indexes and git clones of the repositories of the active context,
+// as two contexts can have repositories of the same name
+func repoStateDir() string {
+	if activeContext != "" {
+		return filepath.Join(getStateDir(), "profiles", activeContext, "repository")
+	}
+	return filepath.Join(getStateDir(), "repository")
+}
+
+// initContext picks the context of --context, APPSODY_CONTEXT or currentContext in the configuration of the
+// home, and reads the configuration of the context instead of the one of the home
+func initContext() {
+	rootConfigFile = cliConfig.ConfigFileUsed()
+	if rootConfigFile == "" {
+		rootConfigFile = getDefaultConfigFile()
+	}
+	name := contextFlag
+	if name == "" {
+		name = os.Getenv(contextEnv)
+	}
+	contextFromFlag = name != ""
+	if name == "" {
+		name = cliConfig.GetString("currentContext")
+	}
+	if name == defaultContext {
+		name = ""
+	}
+	activeContext = name
+	if activeContext == "" || !contextName.MatchString(activeContext) {
+		return
+	}
+	Debug.logw("Using the configuration of the context", "context", activeContext)
+	cliConfig = newCLIConfig(getHome(), getDefaultConfigFile())
+	_ = cliConfig.ReadInConfig()
+}
+
+// checkContext fails the command when the context is not a valid name, or when --context names a context that
+// was never created. The current context is created again by ensureConfig when it was removed.
+func checkContext() error {
+	if activeContext == "" {
+		return nil
+	}
+	if !contextName.MatchString(activeContext) {
+		return errors.Errorf("The context name %q is not valid, it has letters, digits, '-', '_' and '.', up to 50 of them", activeContext)
+	}
+	if _, err := os.Stat(contextDir(activeContext)); err != nil && contextFromFlag {
+		return errors.Errorf("There is no %s context. Create it with appsody config use-context %s.%s", activeContext, activeContext, didYouMean(activeContext, contextNames()))
+	}
+	return nil
+}
+
+// contextNames returns the default context and the contexts of the home, sorted
+func contextNames() []string {
+	names := []string{defaultContext}
+	entries, _ := ioutil.ReadDir(filepath.Join(getHome(), "profiles"))
+	for _, entry := range entries {
+		if entry.IsDir() && contextName.MatchString(entry.Name()) && entry.Name() != defaultContext {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// currentContextName is the name of the active context, default when there is none
+func currentContextName() string {
+	if activeContext == "" {
+		return defaultContext
+	}
+	return activeContext
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the contexts of the Appsody CLI configuration",
+	Long: `A context is a repository file and a CLI configuration of its own, such as the set of repositories of a
+client project. They are kept in $APPSODY_HOME/profiles/<name>/, the default context is the repository file and
+the configuration of $APPSODY_HOME.
+
+The current context is the one of use-context. The --context flag or the APPSODY_CONTEXT environment variable
+choose the context of a single command.`,
+}
+
+var configUseContextCmd = &cobra.Command{
+	Use:   "use-context <name>",
+	Short: "Switch to a context, creating it when needed",
+	Long: `Switch to a context, creating it when needed.
+
+The commands that follow use the repository file and the configuration of the context. A new context starts with
+the default repository, add the repositories of the context with appsody repo add. Use the default context to
+switch back to the repository file and configuration of $APPSODY_HOME.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if name != defaultContext && !contextName.MatchString(name) {
+			return errors.Errorf("The context name %q is not valid, it has letters, digits, '-', '_' and '.', up to 50 of them", name)
+		}
+		if dryrun {
+			planned(planWrite, rootConfigFile, "currentContext: "+name)
+			return nil
+		}
+		config := newCLIConfig(getHome(), rootConfigFile)
+		_ = config.ReadInConfig()
+		config.Set("currentContext", name)
+		if err := writeConfigFile(config, rootConfigFile); err != nil {
+			return errors.Errorf("Could not write the current context in %s: %v", rootConfigFile, err)
+		}
+		// the context is set up as the next command would
+		if name == defaultContext {
+			name = ""
+		}
+		created := false
+		if name != "" {
+			_, err := os.Stat(contextDir(name))
+			created = err != nil
+		}
+		activeContext = name
+		cliConfig = newCLIConfig(getHome(), getDefaultConfigFile())
+		_ = cliConfig.ReadInConfig()
+		if err := ensureConfig(); err != nil {
+			return err
+		}
+		if created {
+			Info.logf("Created the %s context in %s", name, contextDir(name))
+		}
+		Info.logf("Switched to the %s context", currentContextName())
+		return nil
+	},
+}
+
+var configGetContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List the contexts, the current one marked with *",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		table := uitable.New()
+		table.MaxColWidth = 120
+		table.AddRow("", "NAME", "REPOSITORY FILE")
+		current := currentContextName()
+		saved := activeContext
+		defer func() { activeContext = saved }()
+		for _, name := range contextNames() {
+			marker := ""
+			if name == current {
+				marker = "*"
+			}
+			activeContext = name
+			if name == defaultContext {
+				activeContext = ""
+			}
+			table.AddRow(marker, name, getRepoFileLocation())
+		}
+		Info.log("\n", table)
+		return nil
+	},
+}
+
+var configCurrentContextCmd = &cobra.Command{
+	Use:   "current-context",
+	Short: "Print the name of the context in use",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(currentContextName())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configUseContextCmd)
+	configCmd.AddCommand(configGetContextsCmd)
+	configCmd.AddCommand(configCurrentContextCmd)
+	rootCmd.PersistentFlags().StringVar(&contextFlag, "context", "", "Use the repository file and configuration of this context for the command, instead of the current context. See appsody config.")
+}
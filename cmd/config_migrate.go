@@ -0,0 +1,183 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// projectConfigVersion is the configVersion of the .appsody-config.yaml files this CLI understands.
+// Files without configVersion are version 1.
+const projectConfigVersion = 2
+
+// configMigration upgrades the raw .appsody-config.yaml of the previous version to version
+type configMigration struct {
+	version     int
+	description string
+	migrate     func(config yaml.MapSlice) yaml.MapSlice
+}
+
+var configMigrations = []configMigration{
+	{2, "move the digest of the stack image reference to stackDigest", migrateStackDigest},
+}
+
+var migrateConfigCmd = &cobra.Command{
+	Use:   "migrate-config",
+	Short: "Upgrade the .appsody-config.yaml of the project to the latest schema",
+	Long: `This upgrades the .appsody-config.yaml file of the project in the current directory to the schema version this CLI
+writes, listing each change. The original file is kept next to it as .appsody-config.yaml.v<version>.bak, with its
+comments, which the upgraded file does not keep.
+
+Projects with an older schema keep working without it, use it before adding settings that need the latest schema.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := getProjectDir()
+		if err != nil {
+			return err
+		}
+		return migrateProjectConfig(filepath.Join(dir, ConfigFile))
+	},
+}
+
+// projectConfigVersionOf returns the schema version of a project config
+func projectConfigVersionOf(config ProjectConfig) int {
+	if config.ConfigVersion == 0 {
+		return 1
+	}
+	return config.ConfigVersion
+}
+
+// checkProjectConfigVersion fails for the configs of a newer CLI, which could have settings this one
+// would silently ignore
+func checkProjectConfigVersion(config ProjectConfig) error {
+	version := projectConfigVersionOf(config)
+	if version > projectConfigVersion {
+		return errors.Errorf("%s has configVersion %d, this CLI only understands up to version %d. Upgrade the Appsody CLI to work with this project.", ConfigFile, version, projectConfigVersion)
+	}
+	if version < projectConfigVersion {
+		Debug.logf("%s has configVersion %d, run `appsody migrate-config` to upgrade it to version %d", ConfigFile, version, projectConfigVersion)
+	}
+	return nil
+}
+
+func migrateProjectConfig(file string) error {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var config ProjectConfig
+	if err = yaml.Unmarshal(source, &config); err != nil {
+		return errors.Errorf("Could not read %s: %v", file, err)
+	}
+	if err = checkProjectConfigVersion(config); err != nil {
+		return err
+	}
+	version := projectConfigVersionOf(config)
+	if version == projectConfigVersion {
+		Info.logf("%s already is at configVersion %d", ConfigFile, version)
+		return nil
+	}
+	var raw yaml.MapSlice
+	if err = yaml.Unmarshal(source, &raw); err != nil {
+		return errors.Errorf("Could not read %s: %v", file, err)
+	}
+	for _, migration := range configMigrations {
+		if migration.version <= version {
+			continue
+		}
+		Info.logf("Upgrading to configVersion %d: %s", migration.version, migration.description)
+		raw = setConfigValue(migration.migrate(raw), "configVersion", migration.version)
+	}
+	migrated, err := yaml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", file, version)
+	if dryrun {
+		planned(planWrite, backup, "copy of the original "+ConfigFile)
+		planned(planWrite, file, fmt.Sprintf("configVersion %d", projectConfigVersion))
+		return nil
+	}
+	if err = ioutil.WriteFile(backup, source, 0644); err != nil {
+		return errors.Errorf("Could not back up %s: %v", file, err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(file, migrated, info.Mode().Perm()); err != nil {
+		return errors.Errorf("Could not write %s, the original is kept in %s: %v", file, backup, err)
+	}
+	Info.logf("Upgraded %s to configVersion %d, the original is kept in %s", ConfigFile, projectConfigVersion, backup)
+	return nil
+}
+
+// configValue returns the value of a top level key of a raw config
+func configValue(config yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range config {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// setConfigValue sets a top level key of a raw config. New keys are added after the stack, but
+// configVersion, which goes first.
+func setConfigValue(config yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i := range config {
+		if config[i].Key == key {
+			config[i].Value = value
+			return config
+		}
+	}
+	if key == "configVersion" {
+		return append(yaml.MapSlice{{Key: key, Value: value}}, config...)
+	}
+	for i := range config {
+		if config[i].Key == "stack" {
+			config = append(config[:i+1], append(yaml.MapSlice{{Key: key, Value: value}}, config[i+1:]...)...)
+			return config
+		}
+	}
+	return append(config, yaml.MapItem{Key: key, Value: value})
+}
+
+// migrateStackDigest moves the digest of stack: image@sha256:... to stackDigest, so the stack is a
+// tag that can be upgraded while the digest keeps pinning it
+func migrateStackDigest(config yaml.MapSlice) yaml.MapSlice {
+	value, _ := configValue(config, "stack")
+	stack, ok := value.(string)
+	at := strings.LastIndex(stack, "@")
+	if !ok || at < 0 {
+		return config
+	}
+	config = setConfigValue(config, "stack", stack[:at])
+	if existing, found := configValue(config, "stackDigest"); !found || existing == "" {
+		config = setConfigValue(config, "stackDigest", stack[at+1:])
+	}
+	return config
+}
+
+func init() {
+	rootCmd.AddCommand(migrateConfigCmd)
+}
@@ -0,0 +1,211 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// containerRuntimeEnv chooses the container runtime, docker or podman, over containerRuntime of the configuration
+const containerRuntimeEnv = "APPSODY_CONTAINER_RUNTIME"
+
+// The container runtimes the docker commands of the CLI run with
+const (
+	runtimeDocker = "docker"
+	runtimePodman = "podman"
+)
+
+// rootlessPortShift is added to the privileged host ports a rootless runtime can not bind, 80 is published as 8080
+const rootlessPortShift = 8000
+
+// containerRuntime is the container engine the docker commands of the CLI run with
+type containerRuntime struct {
+	// Command is docker or podman, the command the docker commands run
+	Command string
+	// Host is the DOCKER_HOST the docker command is given, for the docker CLI talking to a podman socket
+	Host string
+	// Podman tells whether the engine is podman, through its own command or its docker compatible socket
+	Podman bool
+	// Rootless is an engine of the user, whose containers can not bind the privileged ports and whose root is
+	// the user on the mounts
+	Rootless bool
+	// Remote is an engine of another machine or VM, such as a podman machine, that sees only the shared directories
+	Remote bool
+	// Source tells how the runtime was chosen
+	Source string
+}
+
+var detectedRuntime struct {
+	once    sync.Once
+	runtime *containerRuntime
+}
+
+// getContainerRuntime returns the container runtime, detected once: the one containerRuntime of the
+// configuration or APPSODY_CONTAINER_RUNTIME chooses, the engine of DOCKER_HOST or CONTAINER_HOST, the
+// docker engine when its socket is there, the podman command, and the rootless podman socket for the docker CLI
+func getContainerRuntime() *containerRuntime {
+	detectedRuntime.once.Do(func() {
+		detectedRuntime.runtime = detectContainerRuntime()
+		if host := detectedRuntime.runtime.Host; host != "" {
+			os.Setenv("DOCKER_HOST", host)
+		}
+		Debug.logf("Using the %s container runtime (%s)", detectedRuntime.runtime.describe(), detectedRuntime.runtime.Source)
+	})
+	return detectedRuntime.runtime
+}
+
+func detectContainerRuntime() *containerRuntime {
+	chosen := os.Getenv(containerRuntimeEnv)
+	source := containerRuntimeEnv
+	if chosen == "" {
+		chosen = cliConfig.GetString("containerRuntime")
+		source = "containerRuntime of the configuration"
+	}
+	switch strings.ToLower(chosen) {
+	case runtimeDocker:
+		return dockerRuntime(source)
+	case runtimePodman:
+		return podmanRuntime(source)
+	case "", "auto":
+	default:
+		Warning.logf("Unknown container runtime %q, use docker, podman or auto. Detecting it.", chosen)
+	}
+	// the recorded and replayed commands are the docker ones
+	if fixturesDir() != "" {
+		return &containerRuntime{Command: runtimeDocker, Source: "fixtures"}
+	}
+	if os.Getenv("DOCKER_HOST") != "" {
+		return dockerRuntime("DOCKER_HOST")
+	}
+	if os.Getenv("CONTAINER_HOST") != "" && commandInstalled(runtimePodman) {
+		return podmanRuntime("CONTAINER_HOST")
+	}
+	if commandInstalled(runtimeDocker) && (runtime.GOOS != "linux" || fileExists("/var/run/docker.sock")) {
+		return dockerRuntime("docker socket")
+	}
+	if commandInstalled(runtimePodman) {
+		return podmanRuntime("podman command")
+	}
+	if socket := rootlessPodmanSocket(); socket != "" && commandInstalled(runtimeDocker) {
+		return &containerRuntime{Command: runtimeDocker, Host: "unix://" + socket, Podman: true, Rootless: true, Source: "rootless podman socket " + socket}
+	}
+	return &containerRuntime{Command: runtimeDocker, Source: "default"}
+}
+
+// dockerRuntime is the docker command, with the engine of DOCKER_HOST when it is set
+func dockerRuntime(source string) *containerRuntime {
+	detected := &containerRuntime{Command: runtimeDocker, Source: source}
+	host := os.Getenv("DOCKER_HOST")
+	switch {
+	case strings.Contains(host, "podman"):
+		// the podman socket of a user is under its runtime directory, the one of the system under /run/podman
+		detected.Podman = true
+		detected.Rootless = !strings.Contains(host, "/run/podman/")
+		detected.Remote = strings.HasPrefix(host, "ssh://")
+	case strings.HasPrefix(host, "ssh://") || strings.HasPrefix(host, "tcp://"):
+		detected.Remote = true
+	}
+	return detected
+}
+
+// podmanRuntime is the podman command. It runs rootless unless it runs as root, and remote with CONTAINER_HOST
+// or outside of Linux, where it talks to a podman machine.
+func podmanRuntime(source string) *containerRuntime {
+	return &containerRuntime{
+		Command:  runtimePodman,
+		Podman:   true,
+		Rootless: runtime.GOOS != "linux" || os.Geteuid() != 0,
+		Remote:   os.Getenv("CONTAINER_HOST") != "" || runtime.GOOS != "linux",
+		Source:   source,
+	}
+}
+
+// rootlessPodmanSocket returns the API socket of the podman service of the user, or "" when it does not run
+func rootlessPodmanSocket() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", strconv.Itoa(os.Getuid()))
+	}
+	socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	if info, err := os.Stat(socket); err != nil || info.Mode()&os.ModeSocket == 0 {
+		return ""
+	}
+	return socket
+}
+
+func commandInstalled(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// describe names the runtime, such as rootless podman
+func (r *containerRuntime) describe() string {
+	name := "docker"
+	if r.Podman {
+		name = "podman"
+	}
+	if r.Rootless {
+		name = "rootless " + name
+	}
+	if r.Remote {
+		name = "remote " + name
+	}
+	return name
+}
+
+// runArgs are the options of the docker run of the development containers for the runtime. A local rootless
+// podman maps the user to itself in the container, so that the files the container writes on the project mounts
+// belong to the user rather than to one of its subordinate ids.
+func (r *containerRuntime) runArgs() []string {
+	if r.Command == runtimePodman && r.Rootless && !r.Remote {
+		return []string{"--userns=keep-id"}
+	}
+	return nil
+}
+
+// hostPort returns the host port a container port is published on when none is given. A rootless runtime can
+// not bind the privileged ports, they are shifted by 8000.
+func (r *containerRuntime) hostPort(port int) int {
+	if !r.Rootless || port >= unprivilegedPortStart() || port+rootlessPortShift > 65535 {
+		return port
+	}
+	return port + rootlessPortShift
+}
+
+// unprivilegedPortStart is the first port users can bind on Linux, 1024 unless the system lowered it
+func unprivilegedPortStart() int {
+	if runtime.GOOS != "linux" {
+		return 1024
+	}
+	data, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start")
+	if err != nil {
+		return 1024
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 1024
+	}
+	return start
+}
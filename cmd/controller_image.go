@@ -0,0 +1,129 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var controllerImage string
+
+const (
+	defaultControllerRepository = "appsody/init-controller"
+	// controllerImagePath is where the controller images keep the controller binary
+	controllerImagePath = "/appsody-controller"
+)
+
+var unsafeControllerChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// controllerImageRef returns the image to take the appsody-controller from, or an empty string to use the
+// controller installed with the CLI. The image is the --controller-image flag, APPSODY_CONTROLLER_IMAGE or
+// controllerImage of the CLI configuration, or is made of the controllerRegistry, controllerRepository,
+// controllerTag and controllerDigest settings, the ones not set being the default image of this CLI.
+func controllerImageRef() string {
+	image := controllerImage
+	if image == "" {
+		image = os.Getenv("APPSODY_CONTROLLER_IMAGE")
+	}
+	if image == "" {
+		image = cliConfig.GetString("controllerImage")
+	}
+	if image != "" {
+		return image
+	}
+	for _, key := range []string{"controllerRegistry", "controllerRepository", "controllerTag", "controllerDigest"} {
+		if cliConfig.GetString(key) != "" {
+			return defaultControllerImage()
+		}
+	}
+	return ""
+}
+
+// defaultControllerImage returns the controller image of this version of the CLI, with the overrides of
+// the CLI configuration. A digest pins the image, the tag is then only informative.
+func defaultControllerImage() string {
+	registry := cliConfig.GetString("controllerRegistry")
+	repository := cliConfig.GetString("controllerRepository")
+	if repository == "" {
+		repository = defaultControllerRepository
+	}
+	tag := cliConfig.GetString("controllerTag")
+	if tag == "" {
+		tag = cliVersion()
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	image := repository + ":" + tag
+	if registry != "" && registry != "docker.io" && registry != "index.docker.io" {
+		image = strings.TrimSuffix(registry, "/") + "/" + image
+	}
+	if digest := cliConfig.GetString("controllerDigest"); digest != "" {
+		image += "@" + digest
+	}
+	return image
+}
+
+// controllerFromImage copies the controller out of the image into the CLI home and returns its path.
+// The controllers of the images pinned by digest are only copied once.
+func controllerFromImage(image string) (string, error) {
+	dir := filepath.Join(getStateDir(), "controllers")
+	controller := filepath.Join(dir, unsafeControllerChars.ReplaceAllString(image, "_"))
+	pinned := strings.Contains(image, "@")
+	if pinned {
+		if _, err := os.Stat(controller); err == nil {
+			Debug.log("Using the controller already copied from ", image)
+			return controller, nil
+		}
+	}
+	Debug.log("Using the controller of the image ", image)
+	if dryrun {
+		if err := dockerPullImage(image); err != nil {
+			return "", err
+		}
+		planned(planWrite, controller, "controller binary from "+image)
+		return controller, nil
+	}
+	if !pinned || !checkDockerImageExistsLocally(image) {
+		if err := dockerPullCmd(image); err != nil {
+			return "", errors.Errorf("Could not pull the controller image %s: %v", image, err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	containerName := "appsody-controller-" + strconv.Itoa(os.Getpid())
+	if err := execAndWaitReturnErr("docker", []string{"create", "--name", containerName, image}, Debug); err != nil {
+		return "", errors.Errorf("Could not read the controller image %s: %v", image, err)
+	}
+	defer dockerRemove(containerName)
+	// copy under a temporary name so a running dev container never sees a partially copied controller
+	if err := execAndWaitReturnErr("docker", []string{"cp", containerName + ":" + controllerImagePath, controller + ".tmp"}, Debug); err != nil {
+		return "", errors.Errorf("The image %s has no controller at %s: %v", image, controllerImagePath, err)
+	}
+	if err := os.Chmod(controller+".tmp", 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(controller+".tmp", controller); err != nil {
+		return "", err
+	}
+	return controller, nil
+}
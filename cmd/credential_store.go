@@ -0,0 +1,164 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var plaintextStore bool
+
+// secretStore keeps secrets out of the configuration files. The configuration keeps the reference
+// the store returns instead, which resolveSecretRef turns back into the secret.
+type secretStore interface {
+	name() string
+	store(key string, secret string) (string, error)
+	erase(ref string) error
+}
+
+// helperStore keeps the secrets with a docker credential helper: osxkeychain for the macOS Keychain,
+// wincred for the Windows Credential Manager, secretservice for libsecret, or any other installed one
+type helperStore struct {
+	helper string
+}
+
+// plaintextSecretStore keeps the secrets in the configuration files, readable by anyone who can read them
+type plaintextSecretStore struct{}
+
+// secretStoreUser is the user name the secrets are stored with, the helpers need one
+const secretStoreUser = "appsody"
+
+func (s helperStore) name() string {
+	return s.helper
+}
+
+func (s helperStore) store(key string, secret string) (string, error) {
+	credential, _ := json.Marshal(map[string]string{"ServerURL": key, "Username": secretStoreUser, "Secret": secret})
+	if err := s.run("store", credential); err != nil {
+		return "", err
+	}
+	return "helper:" + s.helper + ":" + key, nil
+}
+
+func (s helperStore) erase(ref string) error {
+	parts := strings.SplitN(strings.TrimPrefix(ref, "helper:"), ":", 2)
+	if len(parts) != 2 || parts[0] != s.helper {
+		return nil
+	}
+	return s.run("erase", []byte(parts[1]))
+}
+
+func (s helperStore) run(action string, input []byte) error {
+	helperCmd := exec.Command("docker-credential-"+s.helper, action)
+	helperCmd.Stdin = bytes.NewReader(input)
+	if out, err := helperCmd.CombinedOutput(); err != nil {
+		return errors.Errorf("the %s credential helper could not %s the secret: %v %s", s.helper, action, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (plaintextSecretStore) name() string {
+	return "plaintext"
+}
+
+func (plaintextSecretStore) store(key string, secret string) (string, error) {
+	return secret, nil
+}
+
+func (plaintextSecretStore) erase(ref string) error {
+	return nil
+}
+
+// osCredentialHelpers are the credential helpers of the OS credential stores, the first installed one is used
+func osCredentialHelpers() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"osxkeychain"}
+	case "windows":
+		return []string{"wincred"}
+	}
+	return []string{"secretservice", "pass"}
+}
+
+// getSecretStore returns the store of the credentialStore setting of the CLI configuration, or of the OS.
+// Without a store installed it fails, unless --plaintext-store allows keeping the secrets in the files.
+func getSecretStore() (secretStore, error) {
+	if plaintextStore {
+		Warning.log("--plaintext-store is set, the secrets are written in the repository file as they are")
+		return plaintextSecretStore{}, nil
+	}
+	helpers := osCredentialHelpers()
+	if configured := cliConfig.GetString("credentialStore"); configured != "" {
+		helpers = []string{configured}
+	}
+	for _, helper := range helpers {
+		if _, err := exec.LookPath("docker-credential-" + helper); err == nil {
+			return helperStore{helper}, nil
+		}
+	}
+	return nil, errors.Errorf("No credential store to keep the secret in: docker-credential-%s is not installed. Install it, set credentialStore in the CLI configuration to another docker credential helper, or use --plaintext-store to write the secret in the repository file.", strings.Join(helpers, " or docker-credential-"))
+}
+
+// repoSecretKey names the secret of a repository header in the store
+func repoSecretKey(repoName string, header string) string {
+	return "appsody://repo/" + repoName + "/" + strings.ToLower(header)
+}
+
+// storeRepoHeaders moves the header values that are not references yet into the secret store, and returns
+// the headers to write in the repository file
+func storeRepoHeaders(repoName string, headers map[string]string) (map[string]string, error) {
+	stored := map[string]string{}
+	var store secretStore
+	for name, value := range headers {
+		if isSecretRef(value) {
+			stored[name] = value
+			continue
+		}
+		if store == nil {
+			var err error
+			if store, err = getSecretStore(); err != nil {
+				return nil, err
+			}
+		}
+		ref, err := store.store(repoSecretKey(repoName, name), value)
+		if err != nil {
+			eraseRepoHeaders(&RepositoryEntry{Name: repoName, Headers: stored})
+			return nil, err
+		}
+		Debug.logf("Stored the %s header of the %s repository with %s", name, repoName, store.name())
+		stored[name] = ref
+	}
+	return stored, nil
+}
+
+// eraseRepoHeaders removes the secrets the headers of a repository keep in the store
+func eraseRepoHeaders(repo *RepositoryEntry) {
+	for name, value := range repo.Headers {
+		parts := strings.SplitN(strings.TrimPrefix(value, "helper:"), ":", 2)
+		if !strings.HasPrefix(value, "helper:") || len(parts) != 2 || parts[1] != repoSecretKey(repo.Name, name) {
+			// references the user gave to their own secrets are theirs to remove
+			continue
+		}
+		if err := (helperStore{parts[0]}).erase(value); err != nil {
+			Warning.logf("Could not remove the %s header secret of the %s repository: %v", name, repo.Name, err)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mattn/go-runewidth"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// dashboardLogLines and dashboardEvents are how many log lines and file events the dashboard keeps
+const (
+	dashboardLogLines = 1000
+	dashboardEvents   = 100
+)
+
+// dashboardRefresh is how often the dashboard reads the status of the container and redraws
+const dashboardRefresh = 2 * time.Second
+
+// ansiSequence matches the color and cursor sequences of the logs, which would garble the screen
+var ansiSequence = regexp.MustCompile("\x1b\\[[0-9;?]*[A-Za-z]")
+
+// dashboard is the state of the screen of appsody dashboard, updated by the goroutines following the logs,
+// the files and the container
+type dashboard struct {
+	lock       sync.Mutex
+	project    string
+	stack      string
+	dir        string
+	container  string
+	status     string
+	ports      []string
+	logs       []string
+	events     []string
+	message    string
+	rebuilding bool
+	// redraw asks the main loop to draw the screen again
+	redraw chan struct{}
+}
+
+var dashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Show the development container, logs and file changes of your project in one screen",
+	Long: `This shows a terminal dashboard of the project in the current directory: the status of its development container, its
+ports, its changed files and the logs of the application. Run it next to appsody run, debug or test.
+
+Keys: r restarts the container, b builds the project, o opens the application, c clears the logs and q quits.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir, err := getProjectDir()
+		if err != nil {
+			return err
+		}
+		if nonInteractive {
+			return errors.New("appsody dashboard needs a terminal, use appsody ps and appsody logs --follow instead")
+		}
+		if _, err = exec.LookPath("stty"); err != nil {
+			return errors.New("appsody dashboard needs stty to read the keys, use appsody ps and appsody logs --follow instead")
+		}
+		projectName, _ := getProjectName()
+		config, err := readProjectConfig()
+		if err != nil {
+			return err
+		}
+		d := &dashboard{
+			project:   projectName,
+			stack:     config.Platform,
+			dir:       projectDir,
+			container: containerName,
+			status:    "unknown",
+			redraw:    make(chan struct{}, 1),
+		}
+		if dryrun {
+			plannedCommand("docker", []string{"logs", "--follow", "--tail", "100", containerName})
+			return nil
+		}
+		return d.run()
+	},
+}
+
+// run shows the dashboard until q is pressed or the command is interrupted
+func (d *dashboard) run() error {
+	restore, err := terminalCharMode()
+	if err != nil {
+		return err
+	}
+	// the alternate screen keeps the shell's scrollback as it was
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+	stop := handleInterrupts()
+	keys := make(chan byte)
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			key, err := reader.ReadByte()
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- key
+		}
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	go d.followLogs(done)
+	if err = d.watchFiles(done); err != nil {
+		d.setMessage("Not watching the files of the project: " + err.Error())
+	}
+	d.refreshStatus()
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-stop:
+			endCleanup()
+			return nil
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 'Q' {
+				return nil
+			}
+			d.action(key)
+		case <-ticker.C:
+			d.refreshStatus()
+		case <-d.redraw:
+		}
+	}
+}
+
+// terminalCharMode turns off the line buffering and the echo of the terminal, so that the keys are read as
+// they are pressed, and returns the function that restores the terminal
+func terminalCharMode() (func(), error) {
+	stty := func(args ...string) (string, error) {
+		sttyCmd := exec.Command("stty", args...)
+		sttyCmd.Stdin = os.Stdin
+		out, err := sttyCmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, errors.Errorf("Could not read the settings of the terminal: %v", err)
+	}
+	if _, err = stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, errors.Errorf("Could not set up the terminal: %v", err)
+	}
+	return func() {
+		if _, err := stty(saved); err != nil {
+			Warning.log("Could not restore the terminal, run stty sane: ", err)
+		}
+	}, nil
+}
+
+// terminalSize returns the rows and columns of the terminal, 24x80 when stty can not tell them
+func terminalSize() (int, int) {
+	sttyCmd := exec.Command("stty", "size")
+	sttyCmd.Stdin = os.Stdin
+	out, err := sttyCmd.Output()
+	if fields := strings.Fields(string(out)); err == nil && len(fields) == 2 {
+		rows, rowsErr := strconv.Atoi(fields[0])
+		columns, columnsErr := strconv.Atoi(fields[1])
+		if rowsErr == nil && columnsErr == nil && rows > 0 && columns > 0 {
+			return rows, columns
+		}
+	}
+	return 24, 80
+}
+
+// changed asks the main loop to redraw, unless it already has to
+func (d *dashboard) changed() {
+	select {
+	case d.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (d *dashboard) setMessage(message string) {
+	d.lock.Lock()
+	d.message = time.Now().Format("15:04:05") + " " + message
+	d.lock.Unlock()
+	d.changed()
+}
+
+func (d *dashboard) addLog(line string) {
+	line = strings.Replace(ansiSequence.ReplaceAllString(line, ""), "\t", "    ", -1)
+	d.lock.Lock()
+	d.logs = append(d.logs, strings.TrimRight(line, "\r"))
+	if len(d.logs) > dashboardLogLines {
+		d.logs = d.logs[len(d.logs)-dashboardLogLines:]
+	}
+	d.lock.Unlock()
+	d.changed()
+}
+
+// refreshStatus reads the state and the published ports of the development container
+func (d *dashboard) refreshStatus() {
+	status := "not running"
+	out, err := runtimeCommand("docker", "inspect", "--format", "{{.State.Status}} {{.State.StartedAt}} {{if .State.Health}}{{.State.Health.Status}}{{end}}", d.container).Output()
+	if fields := strings.Fields(string(out)); err == nil && len(fields) >= 2 {
+		status = fields[0]
+		if started, err := time.Parse(time.RFC3339Nano, fields[1]); err == nil && fields[0] == "running" {
+			status += ", up " + time.Since(started).Round(time.Second).String()
+		}
+		if len(fields) > 2 {
+			status += ", " + fields[2]
+		}
+	}
+	var ports []string
+	if out, err = runtimeCommand("docker", "port", d.container).Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				ports = append(ports, line)
+			}
+		}
+	}
+	d.lock.Lock()
+	d.status, d.ports = status, ports
+	d.lock.Unlock()
+}
+
+// followLogs streams the logs of the container, and follows them again when the container is started again
+func (d *dashboard) followLogs(done <-chan struct{}) {
+	since := ""
+	for {
+		logsArgs := []string{"logs", "--follow"}
+		if since == "" {
+			logsArgs = append(logsArgs, "--tail", "100")
+		} else {
+			logsArgs = append(logsArgs, "--since", since)
+		}
+		logsCmd := runtimeCommand("docker", append(logsArgs, d.container)...)
+		reader, writer := io.Pipe()
+		logsCmd.Stdout, logsCmd.Stderr = writer, writer
+		if err := logsCmd.Start(); err == nil {
+			exited := make(chan struct{})
+			go func() {
+				logsCmd.Wait()
+				close(exited)
+				writer.Close()
+			}()
+			// docker logs --follow runs until the container stops, it is stopped with the dashboard
+			go func() {
+				select {
+				case <-done:
+					logsCmd.Process.Kill()
+				case <-exited:
+				}
+			}()
+			scanner := bufio.NewScanner(reader)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				if !strings.HasPrefix(scanner.Text(), "Error: No such container") {
+					d.addLog(scanner.Text())
+				}
+			}
+		}
+		since = time.Now().UTC().Format(time.RFC3339)
+		select {
+		case <-done:
+			return
+		case <-time.After(dashboardRefresh):
+		}
+	}
+}
+
+// watchFiles shows the changes of the files of the project, which the controller of the container reacts to
+func (d *dashboard) watchFiles(done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err = addWatchRecursive(watcher, d.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				rel, err := filepath.Rel(d.dir, event.Name)
+				if err != nil {
+					rel = event.Name
+				}
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addWatchRecursive(watcher, event.Name)
+					}
+				}
+				d.lock.Lock()
+				d.events = append(d.events, fmt.Sprintf("%s %-7s %s", time.Now().Format("15:04:05"), strings.ToLower(event.Op.String()), rel))
+				if len(d.events) > dashboardEvents {
+					d.events = d.events[len(d.events)-dashboardEvents:]
+				}
+				d.lock.Unlock()
+				d.changed()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				d.setMessage("File watch error: " + err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// action runs the quick action of a key
+func (d *dashboard) action(key byte) {
+	switch key {
+	case 'r', 'R':
+		d.setMessage("Restarting " + d.container)
+		go func() {
+			if err := runtimeCommand("docker", "restart", d.container).Run(); err != nil {
+				d.setMessage("Could not restart " + d.container + ", is it running? " + err.Error())
+				return
+			}
+			d.refreshStatus()
+			d.setMessage("Restarted " + d.container)
+		}()
+	case 'b', 'B':
+		d.lock.Lock()
+		busy := d.rebuilding
+		d.rebuilding = true
+		d.lock.Unlock()
+		if busy {
+			d.setMessage("The build is still running")
+			return
+		}
+		d.setMessage("Building the project, see the logs")
+		go d.build()
+	case 'o', 'O':
+		baseURL := localBaseURL(d.container)
+		if baseURL == "" {
+			d.setMessage("The application does not publish its port, is the container running?")
+			return
+		}
+		if err := openBrowser(baseURL); err != nil {
+			d.setMessage("Could not open the browser, open " + baseURL + " yourself: " + err.Error())
+			return
+		}
+		d.setMessage("Opened " + baseURL)
+	case 'c', 'C':
+		d.lock.Lock()
+		d.logs = nil
+		d.lock.Unlock()
+		d.changed()
+	}
+}
+
+// build runs appsody build in the project, with its output in the logs
+func (d *dashboard) build() {
+	defer func() {
+		d.lock.Lock()
+		d.rebuilding = false
+		d.lock.Unlock()
+	}()
+	buildCmd, err := selfCommand(d.dir, []string{"build"})
+	if err != nil {
+		d.setMessage("Could not build: " + err.Error())
+		return
+	}
+	reader, writer := io.Pipe()
+	buildCmd.Stdout, buildCmd.Stderr = writer, writer
+	if err = buildCmd.Start(); err != nil {
+		d.setMessage("Could not build: " + err.Error())
+		return
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- buildCmd.Wait()
+		writer.Close()
+	}()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		d.addLog("[build] " + scanner.Text())
+	}
+	if err = <-result; err != nil {
+		d.setMessage("The build failed, see the logs: " + err.Error())
+		return
+	}
+	d.setMessage("The build succeeded")
+}
+
+// draw redraws the whole screen, fitting the sections to the terminal: the file events get a few lines, the
+// logs the rest
+func (d *dashboard) draw() {
+	rows, columns := terminalSize()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var lines []string
+	lines = append(lines, "\x1b[1mAppsody dashboard\x1b[0m  "+d.project+"  "+d.stack)
+	lines = append(lines, "Container  "+d.container+"  "+d.status)
+	ports := "none"
+	if len(d.ports) > 0 {
+		ports = strings.Join(d.ports, ", ")
+	}
+	lines = append(lines, "Ports      "+ports)
+	lines = append(lines, "", "\x1b[1mFile changes\x1b[0m")
+	events := d.events
+	if len(events) > 4 {
+		events = events[len(events)-4:]
+	}
+	if len(events) == 0 {
+		lines = append(lines, "  none yet")
+	}
+	for _, event := range events {
+		lines = append(lines, "  "+event)
+	}
+	lines = append(lines, "", "\x1b[1mLogs\x1b[0m")
+	footer := []string{d.message, "\x1b[7m r \x1b[0m restart  \x1b[7m b \x1b[0m build  \x1b[7m o \x1b[0m open  \x1b[7m c \x1b[0m clear logs  \x1b[7m q \x1b[0m quit"}
+	room := rows - len(lines) - len(footer)
+	logs := d.logs
+	if room < 0 {
+		room = 0
+	}
+	if len(logs) > room {
+		logs = logs[len(logs)-room:]
+	}
+	for _, line := range logs {
+		lines = append(lines, "  "+line)
+	}
+	for len(lines) < rows-len(footer) {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i >= rows {
+			break
+		}
+		if !strings.Contains(line, "\x1b") {
+			line = runewidth.Truncate(line, columns, "")
+		}
+		screen.WriteString(line + "\x1b[K")
+		if i < rows-1 {
+			screen.WriteString("\r\n")
+		}
+	}
+	fmt.Print(screen.String())
+}
+
+func init() {
+	rootCmd.AddCommand(dashboardCmd)
+	addNameFlags(dashboardCmd)
+}
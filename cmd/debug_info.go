@@ -0,0 +1,239 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var debugInfoOutput string
+var debugInfoLogLines int
+
+// secretSetting matches the configuration keys whose values are redacted
+var secretSetting = regexp.MustCompile(`(?i)(password|token|secret|credential|auth[^a-z]|auth$|apikey|api-key|private)`)
+
+// secretInLog matches the secrets that can end up in a log line: an authorization header, or a
+// password or token given as a flag or a setting
+var secretInLog = regexp.MustCompile(`(?i)(bearer\s+|basic\s+|(?:password|token|secret)["']?\s*[:= ]\s*["']?)[^\s"',]+`)
+
+const redacted = "***"
+
+// maxFailures is how many of the last failed commands of the audit log are collected
+const maxFailures = 20
+
+// debugInfoFile is one file of the support bundle
+type debugInfoFile struct {
+	name string
+	data []byte
+}
+
+var debugInfoCmd = &cobra.Command{
+	Use:   "debug-info",
+	Short: "Collect diagnostics to attach to a bug report",
+	Long: `This collects the CLI version, the OS, the CLI configuration and repository list, the last lines of the logs,
+the docker and kubectl versions and the recent failed commands into a .tar.gz file you can attach to a bug report.
+
+Passwords, tokens and repository header values are replaced by *** before they are written. The failed commands
+come from the audit log, when it is turned on.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := debugInfoOutput
+		if output == "" {
+			output = "appsody-debug-info-" + time.Now().Format(rotatedLogTime) + ".tar.gz"
+		}
+		files := collectDebugInfo()
+		if dryrun {
+			for _, file := range files {
+				planned(planWrite, output, file.name)
+			}
+			return nil
+		}
+		if err := writeDebugInfo(output, files); err != nil {
+			return errors.Errorf("Could not write %s: %v", output, err)
+		}
+		Info.log("Wrote the diagnostics to ", output, ". Check its content before you attach it to a bug report.")
+		return nil
+	},
+}
+
+func collectDebugInfo() []debugInfoFile {
+	var files []debugInfoFile
+	add := func(name string, data []byte) {
+		files = append(files, debugInfoFile{name, data})
+	}
+	hostname, _ := os.Hostname()
+	add("version.txt", []byte(fmt.Sprintf("appsody %s\nos %s/%s\ngo %s\nhost %s\ntime %s\n",
+		VERSION, runtime.GOOS, runtime.GOARCH, runtime.Version(), hostname, time.Now().UTC().Format(time.RFC3339))))
+
+	if data, err := yaml.Marshal(redactSettings(cliConfig.AllSettings())); err == nil {
+		add("config.yaml", data)
+	}
+	if data, err := ioutil.ReadFile(getRepoFileLocation()); err == nil {
+		var repoFile RepositoryFile
+		if err = yaml.Unmarshal(data, &repoFile); err == nil {
+			repoFile.redactSecrets()
+			data, _ = yaml.Marshal(&repoFile)
+		}
+		add("repositories.yaml", data)
+	}
+
+	add("docker-version.txt", commandOutput("docker", "version"))
+	add("kubectl-version.txt", commandOutput("kubectl", kubectlConnArgs("version")...))
+
+	for _, logFile := range debugInfoLogs() {
+		if data, err := ioutil.ReadFile(logFile); err == nil {
+			add(filepath.Join("logs", filepath.Base(logFile)), lastLines(redactLog(data), debugInfoLogLines))
+		}
+	}
+	if failures := recentFailures(); len(failures) > 0 {
+		add("failures.json", failures)
+	}
+	return files
+}
+
+// redactSettings replaces the values of the secret configuration keys, in nested settings too
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	clean := map[string]interface{}{}
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok {
+			clean[key] = redactSettings(nested)
+		} else if secretSetting.MatchString(key) {
+			clean[key] = redacted
+		} else {
+			clean[key] = value
+		}
+	}
+	return clean
+}
+
+// isSecretRef tells whether a header value refers to a secret instead of holding it
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, "env:") || strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "helper:")
+}
+
+func redactLog(data []byte) []byte {
+	return secretInLog.ReplaceAll(data, []byte("${1}"+redacted))
+}
+
+// commandOutput runs a command for its output, or returns why it could not be run
+func commandOutput(name string, args ...string) []byte {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		out = append(out, []byte(fmt.Sprintf("\n%s %s failed: %v\n", name, strings.Join(args, " "), err))...)
+	}
+	return out
+}
+
+// debugInfoLogs returns the log file of --log-file, the serve log and the latest --verbose log
+func debugInfoLogs() []string {
+	var logs []string
+	if appLog != nil {
+		logs = append(logs, appLog.path)
+	}
+	serveLog := filepath.Join(getStateDir(), "logs", "serve.log")
+	if found, _ := exists(serveLog); found && (appLog == nil || appLog.path != serveLog) {
+		logs = append(logs, serveLog)
+	}
+	verboseLogs, _ := filepath.Glob(filepath.Join(verboseLogDir(), "appsody*.log"))
+	sort.Slice(verboseLogs, func(i, j int) bool {
+		iInfo, iErr := os.Stat(verboseLogs[i])
+		jInfo, jErr := os.Stat(verboseLogs[j])
+		return iErr == nil && jErr == nil && iInfo.ModTime().After(jInfo.ModTime())
+	})
+	if len(verboseLogs) > 0 {
+		logs = append(logs, verboseLogs[0])
+	}
+	return logs
+}
+
+func lastLines(data []byte, count int) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if count > 0 && len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return bytes.Join(lines, nil)
+}
+
+// recentFailures returns the last failed commands of the audit log file, as a JSON array
+func recentFailures() []byte {
+	data, err := ioutil.ReadFile(filepath.Join(getStateDir(), auditLog))
+	if err != nil {
+		return nil
+	}
+	var failures []auditRecord
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var record auditRecord
+		if json.Unmarshal(line, &record) == nil && record.Event == "end" && record.Outcome == "failed" {
+			failures = append(failures, record)
+		}
+	}
+	if len(failures) > maxFailures {
+		failures = failures[len(failures)-maxFailures:]
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	out, _ := json.MarshalIndent(failures, "", "  ")
+	return redactLog(out)
+}
+
+func writeDebugInfo(output string, files []debugInfoFile) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	now := time.Now()
+	for _, file := range files {
+		header := &tar.Header{Name: filepath.ToSlash(file.name), Mode: 0644, Size: int64(len(file.data)), ModTime: now}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err = tarWriter.Write(file.data); err != nil {
+			return err
+		}
+	}
+	if err = tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(debugInfoCmd)
+	debugInfoCmd.PersistentFlags().StringVar(&debugInfoOutput, "file", "", "File to write the diagnostics to. By default appsody-debug-info-<time>.tar.gz in the current directory.")
+	debugInfoCmd.PersistentFlags().IntVar(&debugInfoLogLines, "log-lines", 200, "Number of lines to collect from the end of each log file.")
+}
@@ -15,31 +15,114 @@
 package cmd
 
 import (
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var namespace, tag string
 var push bool
 
+// deployImageRef is the --image option, an image built earlier to deploy instead of building one
+var deployImageRef string
+
+// deployDryRun is the --dry-run option: none, or client or server to only validate the manifest with kubectl
+var deployDryRun string
+
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Build and deploy your Appsody project on a local Kubernetes cluster",
 	Long: `This command extracts the code from your project, builds a local Docker image for deployment,
 generates a KNative serving deployment manifest (yaml) file, and deploys your image as a KNative
-service in your local cluster.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Extract code and build the image - and tags it if -t is specified
-		buildCmd.Run(cmd, args)
+service in your local cluster.
+
+Once the service is applied, deploy waits for it to roll out. A deploy that failed resumes from the phase that
+failed when it is run again for the same sources and options, use --restart to start over.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if signImage && !push {
+			return errors.New("--sign needs --push, only images in a registry can be signed")
+		}
+		if deployImageRef != "" && (tag != "" || push || signImage || provenanceFile != "") {
+			return errors.New("--image deploys an image built earlier, it can not be used with --tag, --push, --sign or --provenance")
+		}
+		if deployDryRun != "none" && deployDryRun != "client" && deployDryRun != "server" {
+			return errors.Errorf("Unknown --dry-run %q, use none, client or server", deployDryRun)
+		}
+		environment, err := getEnvironment(deployEnvironment)
+		if err != nil {
+			return err
+		}
+		// the clusters to deploy to, in order, and the resources of the container in each
+		targets := environment.deployTargets()
+		var targetResources []*Resources
+		for _, target := range targets {
+			resources, err := getDeployResources(environment, target)
+			if err != nil {
+				return err
+			}
+			targetResources = append(targetResources, resources)
+		}
+		if len(environment.Clusters) > 0 && kubeContext != "" {
+			return errors.Errorf("The %s environment deploys to its own clusters, --kube-context can not be used with it", deployEnvironment)
+		}
+		validateOnly := deployDryRun != "none"
+		if len(targets) > 1 && !push && deployImageRef == "" && !validateOnly {
+			return errors.Errorf("The %s environment deploys to %d clusters, they can only pull the image from a registry: use --push or --image", deployEnvironment, len(targets))
+		}
+		//Retrieve the project name and lowercase it
+		projectName, perr := getProjectName()
+		if perr != nil {
+			return perr
+		}
+		// the image the build tags
+		builtImage := projectName
+		if tag != "" {
+			builtImage = tag
+		}
+		// what an interrupted deploy of the same project and options got done
+		progress := &deployProgress{}
+		if !validateOnly {
+			projectDir, err := getProjectDir()
+			if err != nil {
+				return err
+			}
+			fingerprint, err := deployFingerprint(cmd, args, projectDir)
+			if err != nil {
+				Warning.log("Could not fingerprint the project, the deploy will not be resumed if it fails: ", err)
+			}
+			progress = resumeDeploy(projectName, fingerprint)
+		}
+		if validateOnly {
+			Info.logf("Validating the deployment manifest with a %s dry run, the project is not built", deployDryRun)
+		} else if deployImageRef == "" {
+			if progress.builtImage(builtImage) {
+				Info.logf("Not building the project again, the image %s of the interrupted deploy is still there", builtImage)
+			} else {
+				// Extract code and build the image - and tags it if -t is specified
+				if err = buildProject(cmd, args); err != nil {
+					return err
+				}
+				// a new image is pushed and deployed again
+				progress.Image, progress.ImageID = builtImage, localImageID(builtImage)
+				progress.Pushed = false
+				progress.Deployed = nil
+			}
+		} else {
+			Info.log("Deploying the image ", deployImageRef, " without building the project")
+		}
 		//Generate the KNative yaml
 		//Get the container port first
 		port, err := getEnvVarInt("PORT")
 		if err != nil {
 			//try and get the exposed ports and use the first one
 			Warning.log("Could not detect a container port (PORT env var).")
-			portsStr := getExposedPorts()
+			portsStr, err := getExposedPorts()
+			if err != nil {
+				return err
+			}
 			if len(portsStr) == 0 {
 				//No ports exposed
 				Warning.log("This container exposes no ports. The service will not be accessible.")
@@ -57,64 +140,249 @@ service in your local cluster.`,
 		//Get the KNative template file
 		knativeTempl := getKNativeTemplate()
 
-		//Retrieve the project name and lowercase it
-		projectName, perr := getProjectName()
-		if perr != nil {
-			Error.log(perr)
-			os.Exit(1)
-		}
 		//Get the project name and make it the KNative service name
 		serviceName := projectName
-		deployImage := projectName // if not tagged, this is the deploy image name
-		if tag != "" {
-			deployImage = tag //Otherwise, it's the tag
+		deployImage := builtImage // the project name if not tagged, otherwise the tag
+		// an image given with --image is pulled by the cluster from its registry
+		pullImage := push || deployImageRef != ""
+		if deployImageRef != "" {
+			deployImage = deployImageRef
 		}
 		// We're not pushing to a repository, so we need to use dev.local for Knative to be able to find it
-		if !push {
+		if validateOnly && !pullImage {
+			deployImage = "dev.local/" + projectName
+		} else if !pullImage {
 			localtag := "dev.local/" + projectName
 			// Tagging the image using the tag as the deployImage for KNative
 			err = DockerTag(deployImage, localtag)
 			if err != nil {
-				Error.log("Tagging the image failed - exiting. Error: ", err)
-				os.Exit(1)
+				return errors.Errorf("Tagging the image failed - exiting. Error: %v", err)
 			}
 			deployImage = localtag // And forcing deployimage to be localtag
 		}
-		//Generating the KNative yaml file
-		Debug.logf("Calling GenKnativeYaml with parms: %s %d %s %s \n", knativeTempl, port, serviceName, deployImage)
-		yamlFileName, err := GenKnativeYaml(knativeTempl, port, serviceName, deployImage, push)
+		config, err := readProjectConfig()
+		if err != nil {
+			return err
+		}
+		deployAvailability = config.Availability
+		if deployAvailability != nil {
+			if err = deployAvailability.validate(); err != nil {
+				return err
+			}
+		}
+		deployProbes, err = getProbes()
 		if err != nil {
-			Error.log("Could not generate the KNative YAML file: ", err)
-			os.Exit(1)
+			return err
+		}
+		if deployMetrics, err = getMetrics(); err != nil {
+			return err
+		}
+		if deployEnv, err = telemetryEnv(serviceName, deployEnvironment, environment); err != nil {
+			return err
+		}
+		if deployAppEnv, err = projectEnv(environment, true); err != nil {
+			return err
+		}
+		if serviceMonitor {
+			if deployMetrics == nil {
+				return errors.Errorf("--service-monitor needs a metrics endpoint, declared by the stack or in the metrics section of %v", ConfigFile)
+			}
+			deployMetrics.ServiceMonitor = true
+		}
+		// the manifests of each cluster, the Secret of the env and the Knative service first
+		defaultNamespace := namespace
+		var clusterManifests [][]string
+		for i, target := range targets {
+			target.use(defaultNamespace)
+			deployResources = targetResources[i]
+			manifests, err := genDeployManifests(knativeTempl, port, serviceName, deployImage, pullImage)
+			if err != nil {
+				return err
+			}
+			clusterManifests = append(clusterManifests, manifests)
+		}
+		if validateOnly {
+			for i, target := range targets {
+				target.use(defaultNamespace)
+				for _, file := range clusterManifests[i] {
+					if err = KubeApplyDryRun(file, deployDryRun); err != nil {
+						return err
+					}
+				}
+			}
+			Info.logf("The %s dry run accepted the manifest, nothing was created.", deployDryRun)
+			return nil
+		}
+		if err = runHooks(hookPreDeploy, "deploy", deployImage); err != nil {
+			return err
 		}
-		Info.log("Generated KNative serving deploy file: ", yamlFileName)
 		// Pushing the docker image if necessary
-		if push {
-			err = DockerPush(deployImage)
+		if push && progress.Pushed {
+			Info.logf("Not pushing %s again, the interrupted deploy pushed it", deployImage)
+		} else if push {
+			donePush := startPhase("push")
+			err = retryPhase(deployPhasePush, func() error { return DockerPush(deployImage) })
+			donePush()
 			if err != nil {
-				Error.log("Could not push the docker image - exiting. Error: ", err)
+				progress.save(deployPhasePush)
+				return errors.Errorf("Could not push the docker image - exiting. Error: %v", err)
+			}
+			progress.Pushed = true
+			if lastProvenance != nil {
+				if err = attachProvenance(deployImage, lastProvenance); err != nil {
+					Warning.log("Could not attach the build provenance to the image: ", err)
+				}
 			}
 		}
-		err = KubeApply(yamlFileName)
-		// Performing the kubectl apply
-		if err != nil {
-			Error.log("Failed to deploy to your Kubernetes cluster: ", err)
-		} else {
+		if verifyImage {
+			if !pullImage {
+				return errors.New("--verify needs --push or --image, only images in a registry are signed")
+			}
+			if err = cosignVerify(deployImage); err != nil {
+				return err
+			}
+		}
+		failed := 0
+		for i, target := range targets {
+			target.use(defaultNamespace)
+			if progress.deployed() {
+				if target.Context != "" {
+					Info.logf("Not deploying to the %s cluster again, the interrupted deploy rolled the service out there", target.Context)
+				} else {
+					Info.log("Not deploying again, the interrupted deploy rolled the service out")
+				}
+				continue
+			}
+			if target.Context != "" {
+				Info.logf("Deploying to the %s cluster (%d of %d)", target.Context, i+1, len(targets))
+			}
+			doneDeploy := startPhase("deploy")
+			phase := deployPhaseApply
+			err = retryPhase(phase, func() error { return applyDeployManifests(clusterManifests[i]) })
+			if err == nil {
+				phase = deployPhaseRollout
+				err = retryPhase(phase, func() error { return waitForRollout(serviceName) })
+			}
+			doneDeploy()
+			if err != nil {
+				Error.log("Failed to deploy to your Kubernetes cluster: ", err)
+				progress.Failed = phase
+				failed++
+				if environment.stopOnFailure() && i+1 < len(targets) {
+					Error.logf("Not deploying to the %d remaining clusters, set onFailure: continue in the %s environment to deploy to them anyway", len(targets)-i-1, deployEnvironment)
+					break
+				}
+				continue
+			}
 			Info.log("Deployment succeeded.")
 			url, err := KubeGetRouteURL(serviceName)
 			if err != nil {
 				Error.log("Failed to find deployed service in your Kubernetes cluster: ", err)
 			} else {
 				Info.log("Your deployed service is available at the following URL: ", url)
+				printEndpoints(strings.Trim(url, `"`))
 			}
+			progress.Deployed = append(progress.Deployed, deployTarget())
+			recordProjectActivity(func(state *projectState) {
+				state.LastDeploy = &projectActivity{Image: deployImage, Time: time.Now(), Namespace: namespace, URL: url}
+			})
+		}
+		if failed > 0 {
+			progress.save(progress.Failed)
+			return errors.Errorf("The deploy failed on %d of the %d clusters", failed, len(targets))
 		}
+		progress.finish()
+		return runHooks(hookPostDeploy, "deploy", deployImage)
 	},
 }
 
+// genDeployManifests writes the manifests of the project for the cluster deploy is using: the Knative
+// service, and the network policies, service monitor and pod disruption budget when the project has them
+func genDeployManifests(knativeTempl string, port int, serviceName string, deployImage string, pullImage bool) ([]string, error) {
+	//Generating the KNative yaml file
+	Debug.logf("Calling GenKnativeYaml with parms: %s %d %s %s \n", knativeTempl, port, serviceName, deployImage)
+	yamlFileName, err := GenKnativeYaml(knativeTempl, port, serviceName, deployImage, pullImage)
+	if err != nil {
+		return nil, errors.Errorf("Could not generate the KNative YAML file: %v", err)
+	}
+	Info.log("Generated KNative serving deploy file: ", yamlFileName)
+	manifests := []string{yamlFileName}
+	secretFile, err := writeEnvSecret(serviceName, deployAppEnv)
+	if err != nil {
+		return nil, errors.Errorf("Could not generate the Secret of the environment variables: %v", err)
+	}
+	if secretFile != "" {
+		// the service refers to the Secret, it is applied first
+		manifests = append([]string{secretFile}, manifests...)
+	}
+	if networkPolicy {
+		policyFile, err := writeNetworkPolicies(serviceName, port)
+		if err != nil {
+			return nil, errors.Errorf("Could not generate the network policies: %v", err)
+		}
+		Info.log("Generated the network policies file: ", policyFile)
+		manifests = append(manifests, policyFile)
+	}
+	monitorFile, err := writeServiceMonitor(serviceName, port, deployMetrics)
+	if err != nil {
+		return nil, errors.Errorf("Could not generate the service monitor: %v", err)
+	}
+	if monitorFile != "" {
+		Info.log("Generated the service monitor file: ", monitorFile)
+		manifests = append(manifests, monitorFile)
+	}
+	budgetFile, err := writePodDisruptionBudget(serviceName, deployAvailability)
+	if err != nil {
+		return nil, errors.Errorf("Could not generate the pod disruption budget: %v", err)
+	}
+	if budgetFile != "" {
+		Info.log("Generated the pod disruption budget file: ", budgetFile)
+		manifests = append(manifests, budgetFile)
+	}
+	return manifests, nil
+}
+
+// applyDeployManifests performs the kubectl apply of the manifests, stopping at the first one that fails
+func applyDeployManifests(manifests []string) error {
+	if err := KubeApply(manifests[0]); err != nil {
+		return err
+	}
+	for _, file := range manifests[1:] {
+		if err := KubeApply(file); err != nil {
+			return errors.Errorf("Could not apply %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(deployCmd)
 	deployCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Target namespace in your Kubernetes cluster")
+	deployCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use. By default kubectl's own configuration, or the service account when running in a pod.")
 	deployCmd.PersistentFlags().StringVarP(&tag, "tag", "t", "", "Docker image name and optionally a tag in the 'name:tag' format")
+	deployCmd.PersistentFlags().StringVar(&provenanceFile, "provenance", "", "Write a SLSA provenance statement of the build to this file, and attach it to the image when it is pushed.")
+	deployCmd.PersistentFlags().BoolVar(&signImage, "sign", false, "Sign the pushed image with cosign.")
+	deployCmd.PersistentFlags().BoolVar(&noNotify, "no-notify", false, "Do not send the notifications of the CLI and project configuration when the deploy ends.")
+	deployCmd.PersistentFlags().StringVar(&signKey, "sign-key", "", "Cosign private key file to sign with. By default the image is signed keyless.")
+	deployCmd.PersistentFlags().BoolVar(&verifyImage, "verify", false, "Verify the signature of the pushed image before deploying it.")
+	addVerifyFlags(deployCmd, "verify-key")
+	addJSONEventsFlag(deployCmd)
+	deployCmd.PersistentFlags().BoolVar(&noHooks, "no-hooks", false, "Do not run the post-build, pre-deploy and post-deploy hooks of the project.")
+	deployCmd.PersistentFlags().StringVar(&deployImageRef, "image", "", "Deploy this image, built and pushed earlier, instead of building the project.")
+	deployCmd.PersistentFlags().StringVar(&deployDryRun, "dry-run", "none", "Only validate the generated manifest: server submits it to the API server with dry-run semantics, client checks it with kubectl. Nothing is built or created.")
+	deployCmd.PersistentFlags().BoolVar(&networkPolicy, "network-policy", false, "Also deploy network policies that deny all traffic of the application except to its port, and from it to DNS and to the services of the project.")
+	deployCmd.PersistentFlags().StringVar(&kubeContext, "kube-context", "", "Kube-context of the kubeconfig to deploy to. By default its current context.")
+	deployCmd.PersistentFlags().StringVar(&deployEnvironment, "env", "", "Deploy with the settings of this environment of the project configuration.")
+	deployCmd.PersistentFlags().StringVar(&resourceFlags.CPURequest, "cpu-request", "", "CPU the container requests, such as 250m.")
+	deployCmd.PersistentFlags().StringVar(&resourceFlags.CPULimit, "cpu-limit", "", "CPU the container is limited to, such as 1.")
+	deployCmd.PersistentFlags().StringVar(&resourceFlags.MemoryRequest, "memory-request", "", "Memory the container requests, such as 256Mi.")
+	deployCmd.PersistentFlags().StringVar(&resourceFlags.MemoryLimit, "memory-limit", "", "Memory the container is limited to, such as 512Mi.")
+	deployCmd.PersistentFlags().BoolVar(&otelEnabled, "otel", false, "Export the telemetry of the application to the OpenTelemetry collector of the project or environment, with the agent of the stack.")
+	deployCmd.PersistentFlags().StringVar(&otelEndpoint, "otel-endpoint", "", "OTLP endpoint of the OpenTelemetry collector, instead of the one of the project configuration. Implies --otel.")
+	deployCmd.PersistentFlags().BoolVar(&serviceMonitor, "service-monitor", false, "Generate a ServiceMonitor of the Prometheus operator for the metrics endpoint, instead of the prometheus.io annotations.")
+	deployCmd.PersistentFlags().BoolVar(&deployRestart, "restart", false, "Build, push and deploy from the start, rather than resume the deploy of the project that failed.")
+	deployCmd.PersistentFlags().IntVar(&deployRetries, "retries", 2, "Number of times a failed push, apply or rollout is tried again.")
+	deployCmd.PersistentFlags().DurationVar(&deployRolloutTimeout, "rollout-timeout", 2*time.Minute, "How long to wait for the service to be ready once it is applied. 0 does not wait.")
 	deployCmd.PersistentFlags().BoolVar(&push, "push", false, "Push this image to an external Docker registry. Assumes that you have previously successfully done docker login")
 
 }
@@ -0,0 +1,207 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// The phases of appsody deploy, in order. The apply and rollout phases run for each cluster.
+const (
+	deployPhaseBuild   = "build"
+	deployPhasePush    = "push"
+	deployPhaseApply   = "apply"
+	deployPhaseRollout = "rollout"
+)
+
+// deployRestart is the --restart option of deploy, to start over rather than resume an interrupted deploy
+var deployRestart bool
+
+// deployRetries is the --retries option of deploy, how many times a failed push, apply or rollout is tried again
+var deployRetries int
+
+// deployRolloutTimeout is the --rollout-timeout option of deploy, how long to wait for the service to be ready
+var deployRolloutTimeout time.Duration
+
+// deployProgress is what an interrupted appsody deploy got done, kept in the state of the project so that running it
+// again resumes from the phase that failed. It is only resumed for the same sources and options.
+type deployProgress struct {
+	Fingerprint string    `json:"fingerprint"`
+	Started     time.Time `json:"started"`
+	// Image is the image that was built, with its ID, so that a resumed deploy does not push another one
+	Image   string `json:"image,omitempty"`
+	ImageID string `json:"imageID,omitempty"`
+	Pushed  bool   `json:"pushed,omitempty"`
+	// Deployed are the clusters, as <kube-context>/<namespace>, where the service was applied and rolled out
+	Deployed []string `json:"deployed,omitempty"`
+	// Failed is the phase that failed
+	Failed string `json:"failed,omitempty"`
+}
+
+// resumeFlags only change how a deploy is carried out, so they can differ between an interrupted deploy and its
+// resumption
+var resumeFlags = map[string]bool{"restart": true, "retries": true, "rollout-timeout": true}
+
+// deployOutput tells whether a file of the project root is one of the manifests deploy writes, which are left out
+// of the fingerprint
+func deployOutput(name string) bool {
+	switch name {
+	case networkPolicyFile, serviceMonitorFile, pdbFile:
+		return true
+	}
+	return strings.HasPrefix(name, "appsody-service-") && strings.HasSuffix(name, ".yaml")
+}
+
+// deployFingerprint identifies the sources of the project and the options of the deploy: its arguments and flags, and
+// the names, sizes and modification times of the files of the project, its configuration included
+func deployFingerprint(cmd *cobra.Command, args []string, projectDir string) (string, error) {
+	digest := sha256.New()
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if !resumeFlags[flag.Name] {
+			fmt.Fprintln(digest, flag.Name, flag.Value.String())
+		}
+	})
+	fmt.Fprintln(digest, args)
+	err := filepath.Walk(projectDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if file != projectDir && (strings.HasPrefix(info.Name(), ".") || skippedDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(projectDir, file)
+		if deployOutput(rel) {
+			return nil
+		}
+		fmt.Fprintln(digest, filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// resumeDeploy returns the progress of the interrupted deploy of the project when it can be resumed, or a new one
+func resumeDeploy(projectName string, fingerprint string) *deployProgress {
+	previous := readProjectState(projectName).DeployProgress
+	switch {
+	case previous == nil:
+	case deployRestart:
+		Info.log("Starting the deploy over, as --restart is set")
+	case previous.Fingerprint != fingerprint:
+		Info.log("The project or the options changed since the interrupted deploy, starting it over")
+	default:
+		Info.logf("Resuming the deploy of %s that failed in the %s phase", previous.Started.Format(time.RFC3339), previous.Failed)
+		return previous
+	}
+	return &deployProgress{Fingerprint: fingerprint, Started: time.Now()}
+}
+
+// builtImage tells whether the image of the interrupted deploy is still the one in docker, so that it is not
+// built again
+func (p *deployProgress) builtImage(image string) bool {
+	if p.ImageID == "" || p.Image != image {
+		return false
+	}
+	return localImageID(image) == p.ImageID
+}
+
+// deployTarget names the cluster and namespace kubectl is using, as <kube-context>/<namespace>
+func deployTarget() string {
+	return kubeContext + "/" + namespace
+}
+
+// deployed tells whether the service was applied and rolled out to the cluster kubectl is using
+func (p *deployProgress) deployed() bool {
+	for _, done := range p.Deployed {
+		if done == deployTarget() {
+			return true
+		}
+	}
+	return false
+}
+
+// save records the progress after a phase failed. Failing to do so does not fail the command.
+func (p *deployProgress) save(failed string) {
+	p.Failed = failed
+	recordProjectActivity(func(state *projectState) {
+		state.DeployProgress = p
+	})
+	if !dryrun {
+		Info.log("Run appsody deploy again to resume from the ", failed, " phase, or with --restart to start over")
+	}
+}
+
+// finish forgets the progress once the deploy succeeded
+func (p *deployProgress) finish() {
+	recordProjectActivity(func(state *projectState) {
+		state.DeployProgress = nil
+	})
+}
+
+// localImageID returns the ID of the image in docker, empty when there is no such image
+func localImageID(image string) string {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// retryPhase runs a phase of deploy, and tries it again up to --retries times when it fails, waiting a bit
+// longer each time
+func retryPhase(phase string, run func() error) error {
+	delay := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= deployRetries || dryrun {
+			return err
+		}
+		Warning.logf("The %s phase failed, trying again in %s (%d of %d): %v", phase, delay, attempt+1, deployRetries, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// waitForRollout waits for the latest revision of the Knative service to be ready
+func waitForRollout(serviceName string) error {
+	if deployRolloutTimeout == 0 {
+		return nil
+	}
+	kargs := kubectlArgs("wait", "ksvc/"+serviceName, "--for=condition=Ready", "--timeout="+deployRolloutTimeout.String())
+	if dryrun {
+		plannedStep(planRunCommand, "ksvc/"+serviceName, "kubectl", kargs)
+		return nil
+	}
+	Info.logf("Waiting up to %s for the %s service to roll out", deployRolloutTimeout, serviceName)
+	out, err := runtimeCommand("kubectl", kargs...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("The %s service did not become ready: %v %s", serviceName, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
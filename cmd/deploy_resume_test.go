@@ -0,0 +1,214 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"github.com/spf13/cobra"
+)
+
+var deployOutputTests = []struct {
+	name     string
+	expected bool
+}{
+	{"appsody-service-123456.yaml", true},
+	{"appsody-network-policy.yaml", true},
+	{"appsody-pdb.yaml", true},
+	{"appsody-service.go", false},
+	{"app.yaml", false},
+	{"src/appsody-pdb.yaml", false},
+}
+
+func TestDeployOutput(t *testing.T) {
+	for _, tt := range deployOutputTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if output := cmd.DeployOutput(tt.name); output != tt.expected {
+				t.Errorf("Expected %s to be a manifest of deploy: %v, got %v", tt.name, tt.expected, output)
+			}
+		})
+	}
+}
+
+var deployFingerprintTests = []struct {
+	testName        string
+	args            []string
+	change          func(projectDir string) error
+	expectedChanged bool
+}{
+	{"Same", nil, nil, false},
+	{"Option", []string{"--tag", "app:2.0"}, nil, true},
+	{"Retries", []string{"--retries", "5", "--restart"}, nil, false},
+	{"Source", nil, func(projectDir string) error {
+		return ioutil.WriteFile(filepath.Join(projectDir, "app.js"), []byte("console.log('changed')\n"), 0644)
+	}, true},
+	{"New file", nil, func(projectDir string) error {
+		return ioutil.WriteFile(filepath.Join(projectDir, "lib.js"), []byte("\n"), 0644)
+	}, true},
+	{"Manifest", nil, func(projectDir string) error {
+		return ioutil.WriteFile(filepath.Join(projectDir, "appsody-service-123456.yaml"), []byte("kind: Service\n"), 0644)
+	}, false},
+	{"Dependencies", nil, func(projectDir string) error {
+		dir := filepath.Join(projectDir, "node_modules", "express")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, "index.js"), []byte("module.exports = {}\n"), 0644)
+	}, false},
+}
+
+// deployCommand returns a command with the options of deploy the fingerprint depends on, or not
+func deployCommand(t *testing.T, args []string) *cobra.Command {
+	command := &cobra.Command{Use: "deploy"}
+	command.Flags().String("tag", "", "")
+	command.Flags().Int("retries", 0, "")
+	command.Flags().Bool("restart", false, "")
+	if err := command.Flags().Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return command
+}
+
+func TestDeployFingerprint(t *testing.T) {
+	for _, tt := range deployFingerprintTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			projectDir, err := ioutil.TempDir("", "appsody-fingerprint")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(projectDir)
+			if err = ioutil.WriteFile(filepath.Join(projectDir, "app.js"), []byte("console.log('app')\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fingerprint, err := cmd.DeployFingerprint(deployCommand(t, nil), nil, projectDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				if err = tt.change(projectDir); err != nil {
+					t.Fatal(err)
+				}
+			}
+			changed, err := cmd.DeployFingerprint(deployCommand(t, tt.args), nil, projectDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (changed != fingerprint) != tt.expectedChanged {
+				t.Errorf("Expected the fingerprint to change: %v, got %s and %s", tt.expectedChanged, fingerprint, changed)
+			}
+		})
+	}
+}
+
+var resumeDeployTests = []struct {
+	testName        string
+	previous        *cmd.DeployProgress
+	fingerprint     string
+	restart         bool
+	expectedResumed bool
+}{
+	{"No interrupted deploy", nil, "same", false, false},
+	{"Interrupted", &cmd.DeployProgress{Fingerprint: "same", Image: "app", Pushed: true, Failed: "apply"}, "same", false, true},
+	{"Changed", &cmd.DeployProgress{Fingerprint: "before", Failed: "apply"}, "same", false, false},
+	{"Restart", &cmd.DeployProgress{Fingerprint: "same", Failed: "apply"}, "same", true, false},
+}
+
+func TestResumeDeploy(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	for _, tt := range resumeDeployTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			stateFile := cmd.ProjectStateFile("resumed")
+			if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(map[string]interface{}{"deployProgress": tt.previous})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = ioutil.WriteFile(stateFile, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			progress := cmd.ResumeDeploy("resumed", tt.fingerprint, tt.restart)
+
+			if tt.expectedResumed {
+				if progress.Fingerprint != tt.previous.Fingerprint || progress.Image != tt.previous.Image || progress.Pushed != tt.previous.Pushed || progress.Failed != tt.previous.Failed {
+					t.Errorf("Expected the progress of the interrupted deploy %+v, got %+v", tt.previous, progress)
+				}
+				return
+			}
+			if progress.Fingerprint != tt.fingerprint || progress.Image != "" || progress.Pushed || progress.Failed != "" || progress.Started.IsZero() {
+				t.Errorf("Expected a new deploy, got %+v", progress)
+			}
+		})
+	}
+}
+
+func TestDeployedTo(t *testing.T) {
+	progress := &cmd.DeployProgress{Deployed: []string{"us-east/shop", "/"}}
+
+	for _, target := range []struct{ context, namespace string }{{"us-east", "shop"}, {"", ""}} {
+		if !progress.DeployedTo(target.context, target.namespace) {
+			t.Errorf("Expected the service to be deployed to %s/%s", target.context, target.namespace)
+		}
+	}
+	for _, target := range []struct{ context, namespace string }{{"eu-west", "shop"}, {"us-east", ""}} {
+		if progress.DeployedTo(target.context, target.namespace) {
+			t.Errorf("Expected the service not to be deployed to %s/%s", target.context, target.namespace)
+		}
+	}
+}
+
+var retryPhaseTests = []struct {
+	testName         string
+	retries          int
+	failures         int // the number of attempts that fail before one succeeds
+	expectedAttempts int
+	expectedError    bool
+}{
+	{"Succeeds", 2, 0, 1, false},
+	{"No retries", 0, 1, 1, true},
+	{"Retried", 1, 1, 2, false},
+	{"Retries exhausted", 1, 3, 2, true},
+}
+
+func TestRetryPhase(t *testing.T) {
+	for _, tt := range retryPhaseTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			attempts := 0
+			err := cmd.RetryPhase(tt.retries, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return errors.New("the cluster is not reachable")
+				}
+				return nil
+			})
+
+			if attempts != tt.expectedAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedAttempts, attempts)
+			}
+			if (err != nil) != tt.expectedError {
+				t.Errorf("Expected the phase to fail: %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// statusEvents is how many of the recent events deploy status shows
+const statusEvents = 10
+
+// k8sEvent holds the fields deploy status reads from the events of the namespace
+type k8sEvent struct {
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+}
+
+var deployStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the deployed project",
+	Long: `This shows the status of the Knative service appsody deploy created for the project: whether its latest revision
+is ready, how many of its pods are ready, its URL, the recent events of the service and its pods, and the image
+digest the pods run.
+
+The digest is compared with the image of the last appsody build of the project, to tell when the cluster runs
+another build than the local one. With --env the status of each cluster of the environment is shown.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectName, err := getProjectName()
+		if err != nil {
+			return err
+		}
+		environment, err := getEnvironment(deployEnvironment)
+		if err != nil {
+			return err
+		}
+		localImage := ""
+		if lastBuild := readProjectState(projectName).LastBuild; lastBuild != nil {
+			localImage = lastBuild.Image
+		}
+		defaultNamespace := namespace
+		for _, target := range environment.deployTargets() {
+			target.use(defaultNamespace)
+			if target.Context != "" {
+				Info.logf("Cluster %s:", target.Context)
+			}
+			if err = showDeployStatus(projectName, localImage); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// kubectlJSON runs kubectl get with the cluster and namespace options, and decodes its JSON output
+func kubectlJSON(result interface{}, args ...string) error {
+	var stderr bytes.Buffer
+	kubectlCmd := runtimeCommand("kubectl", kubectlArgs(append(args, "-o", "json")...)...)
+	kubectlCmd.Stderr = &stderr
+	out, err := kubectlCmd.Output()
+	if err != nil {
+		return errors.Errorf("kubectl %s failed: %v %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return json.Unmarshal(out, result)
+}
+
+func showDeployStatus(serviceName string, localImage string) error {
+	var service k8sResource
+	if err := kubectlJSON(&service, "get", "ksvc", serviceName); err != nil {
+		return errors.Errorf("Could not find the %s service, was the project deployed with appsody deploy? %v", serviceName, err)
+	}
+	var pods struct {
+		Items []k8sResource `json:"items"`
+	}
+	if err := kubectlJSON(&pods, "get", "pods", "-l", appNameLabel+"="+serviceName); err != nil {
+		return err
+	}
+	var events struct {
+		Items []k8sEvent `json:"items"`
+	}
+	if err := kubectlJSON(&events, "get", "events"); err != nil {
+		return err
+	}
+	now := time.Now()
+	table := uitable.New()
+	table.MaxColWidth = 100
+	table.Wrap = true
+	table.AddRow("Service:", service.Metadata.Name+" in namespace "+service.Metadata.Namespace)
+	table.AddRow("Rollout:", rolloutState(service))
+	ready := 0
+	deployedImage, drift := "", ""
+	for _, pod := range pods.Items {
+		if podReady(pod) {
+			ready++
+		}
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.Name == knativeUserContainer && deployedImage == "" {
+				deployedImage = imageWithDigest(container.Image, container.ImageID)
+				drift = imageDrift(localImage, container.ImageID)
+			}
+		}
+	}
+	table.AddRow("Pods:", strconv.Itoa(ready)+"/"+strconv.Itoa(len(pods.Items))+" ready")
+	if service.Status.URL != "" {
+		table.AddRow("URL:", service.Status.URL)
+	}
+	if deployedImage == "" {
+		deployedImage = "unknown, no pod is running"
+	}
+	table.AddRow("Image:", deployedImage)
+	if localImage != "" {
+		table.AddRow("Local build:", localImage)
+	}
+	Info.log(table.String())
+	if drift != "" {
+		Warning.log(drift)
+	}
+	recent := serviceEvents(events.Items, serviceName)
+	if len(recent) == 0 {
+		return nil
+	}
+	eventsTable := uitable.New()
+	eventsTable.MaxColWidth = 100
+	eventsTable.Wrap = true
+	eventsTable.AddRow("AGE", "TYPE", "REASON", "OBJECT", "MESSAGE")
+	for _, event := range recent {
+		eventsTable.AddRow(formatAge(now.Sub(event.LastTimestamp)), event.Type, event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind)+"/"+event.InvolvedObject.Name, event.Message)
+	}
+	Info.log("Recent events:")
+	Info.log(eventsTable.String())
+	return nil
+}
+
+// rolloutState tells whether the latest revision of a Knative service is ready
+func rolloutState(service k8sResource) string {
+	for _, condition := range service.Status.Conditions {
+		if condition.Type != "Ready" {
+			continue
+		}
+		switch condition.Status {
+		case "True":
+			return "ready, serving revision " + service.Status.LatestReadyRevisionName
+		case "False":
+			return "failed: " + condition.Reason + " " + condition.Message
+		}
+		state := "in progress"
+		if service.Status.LatestCreatedRevisionName != "" {
+			state += ", rolling out revision " + service.Status.LatestCreatedRevisionName
+		}
+		return state
+	}
+	return "unknown"
+}
+
+// serviceEvents returns the most recent events of a service and of the objects named after it, its
+// revisions and pods, the latest last
+func serviceEvents(events []k8sEvent, serviceName string) []k8sEvent {
+	var matching []k8sEvent
+	for _, event := range events {
+		name := event.InvolvedObject.Name
+		if name == serviceName || strings.HasPrefix(name, serviceName+"-") {
+			matching = append(matching, event)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].LastTimestamp.Before(matching[j].LastTimestamp)
+	})
+	if len(matching) > statusEvents {
+		matching = matching[len(matching)-statusEvents:]
+	}
+	return matching
+}
+
+// imageDrift compares the image the pods run, by the image ID the kubelet reports, with the local image of
+// the last build. It returns why they differ, or an empty string when they match or can not be compared.
+func imageDrift(localImage string, imageID string) string {
+	if localImage == "" || imageID == "" {
+		return ""
+	}
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", `{{.Id}}{{range .RepoDigests}} {{.}}{{end}}`, localImage).Output()
+	if err != nil {
+		Debug.log("Could not inspect the local image ", localImage, ": ", err)
+		return ""
+	}
+	deployed := imageID
+	if i := strings.LastIndex(deployed, "sha256:"); i >= 0 {
+		deployed = deployed[i:]
+	}
+	for _, local := range strings.Fields(string(out)) {
+		if local == deployed || strings.HasSuffix(local, "@"+deployed) {
+			return ""
+		}
+	}
+	return "The cluster runs another image than the last local build, " + localImage + ". Run appsody deploy to deploy it."
+}
+
+func init() {
+	deployCmd.AddCommand(deployStatusCmd)
+}
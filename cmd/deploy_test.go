@@ -0,0 +1,186 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+	"gopkg.in/yaml.v2"
+)
+
+// knativeService is the part of the Knative service of GenKnativeYaml the tests check
+type knativeService struct {
+	Spec struct {
+		RunLatest struct {
+			Configuration struct {
+				RevisionTemplate struct {
+					Metadata struct {
+						Annotations map[string]string `yaml:"annotations"`
+					} `yaml:"metadata"`
+					Spec struct {
+						TopologySpreadConstraints []cmd.TopologySpreadConstraint `yaml:"topologySpreadConstraints"`
+						Container                 struct {
+							Image           string          `yaml:"image"`
+							ImagePullPolicy string          `yaml:"imagePullPolicy"`
+							LivenessProbe   *containerProbe `yaml:"livenessProbe"`
+							ReadinessProbe  *containerProbe `yaml:"readinessProbe"`
+							StartupProbe    *containerProbe `yaml:"startupProbe"`
+							Resources       *struct {
+								Requests map[string]string `yaml:"requests"`
+								Limits   map[string]string `yaml:"limits"`
+							} `yaml:"resources"`
+						} `yaml:"container"`
+					} `yaml:"spec"`
+				} `yaml:"revisionTemplate"`
+			} `yaml:"configuration"`
+		} `yaml:"runLatest"`
+	} `yaml:"spec"`
+}
+
+// containerProbe is a probe of the container of the service
+type containerProbe struct {
+	HTTPGet struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port"`
+	} `yaml:"httpGet"`
+	InitialDelaySeconds int `yaml:"initialDelaySeconds"`
+	PeriodSeconds       int `yaml:"periodSeconds"`
+}
+
+// genKnativeService generates the Knative service of the template and reads it back
+func genKnativeService(t *testing.T, template string, deployImage string, pullImage bool) knativeService {
+	yamlFileName, err := cmd.GenKnativeYaml(template, 8080, "test-service", deployImage, pullImage)
+	if err != nil {
+		t.Fatal("Can't generate the YAML for KNative serving deploy. Error: ", err)
+	}
+	defer os.Remove(yamlFileName)
+	data, err := ioutil.ReadFile(yamlFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var service knativeService
+	if err = yaml.Unmarshal(data, &service); err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+var deployErrorTests = []struct {
+	testName      string
+	args          []string // input
+	expectedError string   // expected to be in the error message
+}{
+	{"Image with push", []string{"--image", "registry.example.com/app:1.0", "--push"}, "--image deploys an image built earlier"},
+	{"Image with tag", []string{"--image", "registry.example.com/app:1.0", "--tag", "app:2.0"}, "--image deploys an image built earlier"},
+	{"Image with provenance", []string{"--image", "registry.example.com/app:1.0", "--provenance", "provenance.json"}, "--image deploys an image built earlier"},
+	{"Unknown dry run", []string{"--dry-run", "cluster"}, "Unknown --dry-run \"cluster\", use none, client or server"},
+}
+
+func TestDeployErrors(t *testing.T) {
+	for _, tt := range deployErrorTests {
+		// call t.Run so that we can name and report on individual tests
+		t.Run(tt.testName, func(t *testing.T) {
+			args := append([]string{"deploy"}, tt.args...)
+			output, err := cmdtest.RunAppsodyCmdExec(args, ".")
+
+			if err == nil {
+				t.Error("Expected non-zero exit code")
+			}
+			if !strings.Contains(output, tt.expectedError) {
+				t.Errorf("Did not find expected error '%s' in output", tt.expectedError)
+			}
+		})
+	}
+}
+
+var deployImageTests = []struct {
+	testName           string
+	pullImage          bool
+	expectedPullPolicy string
+}{
+	// an image given with --image or pushed is pulled from its registry as the template says
+	{"Pulled image", true, "Always"},
+	{"Local image", false, "Never"},
+}
+
+func TestDeployImage(t *testing.T) {
+	for _, tt := range deployImageTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			service := genKnativeService(t, getKNativeTemplate1(), "registry.example.com/app:1.0", tt.pullImage)
+
+			container := service.Spec.RunLatest.Configuration.RevisionTemplate.Spec.Container
+			if container.Image != "registry.example.com/app:1.0" {
+				t.Errorf("Expected the image registry.example.com/app:1.0, got %s", container.Image)
+			}
+			if container.ImagePullPolicy != tt.expectedPullPolicy {
+				t.Errorf("Expected the pull policy %s, got %s", tt.expectedPullPolicy, container.ImagePullPolicy)
+			}
+		})
+	}
+}
+
+var kubeApplyDryRunTests = []struct {
+	testName      string
+	file          string
+	mode          string
+	expectedError string // empty when the dry run accepts the manifest
+}{
+	{"Client", "service.yaml", "client", ""},
+	{"Server", "service.yaml", "server", ""},
+	{"Rejected", "rejected.yaml", "server", "The server dry run rejected the manifest rejected.yaml"},
+}
+
+func TestKubeApplyDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// kubectl logs its arguments, and the API server rejects rejected.yaml
+	kubectlLog := filepath.Join(dir, "kubectl.log")
+	kubectl := "#!/bin/sh\necho \"$@\" > " + kubectlLog + "\ncase \"$*\" in *rejected.yaml*) echo 'admission webhook denied the request'; exit 1;; esac\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "kubectl"), []byte(kubectl), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	for _, tt := range kubeApplyDryRunTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := cmd.KubeApplyDryRun(tt.file, tt.mode)
+
+			if tt.expectedError == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+				t.Fatalf("Expected the error %q, got %v", tt.expectedError, err)
+			}
+			args, err := ioutil.ReadFile(kubectlLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := "apply --dry-run=" + tt.mode + " -f " + tt.file; !strings.Contains(string(args), expected) {
+				t.Errorf("Expected kubectl %s, got kubectl %s", expected, args)
+			}
+		})
+	}
+}
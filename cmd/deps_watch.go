@@ -0,0 +1,146 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var noDepsWatch bool
+
+// depsWatchDebounce is how long the changes to the manifests are collected, package managers and editors
+// often write them several times in a row
+const depsWatchDebounce = time.Second
+
+// defaultDependencyManifests are the files that list the dependencies of a project. A stack can watch
+// other files with APPSODY_DEPS_MANIFESTS.
+var defaultDependencyManifests = []string{"package.json", "package-lock.json", "pom.xml", "build.gradle", "go.mod", "go.sum", "requirements.txt"}
+
+// dependencyManifests returns the names of the manifests watched in the project directory
+func dependencyManifests() (map[string]bool, error) {
+	names := defaultDependencyManifests
+	stackManifests, err := getEnvVarList("APPSODY_DEPS_MANIFESTS")
+	if err != nil {
+		return nil, err
+	}
+	if len(stackManifests) > 0 {
+		names = stackManifests
+	}
+	manifests := map[string]bool{}
+	for _, name := range names {
+		manifests[name] = true
+	}
+	return manifests, nil
+}
+
+// manifestDigest returns the digest of a manifest, or an empty string when it does not exist
+func manifestDigest(file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return string(sum[:])
+}
+
+// watchDependencies runs the dependency install step of the stack, APPSODY_PREP, in the running container
+// when a dependency manifest of the project changes, so that new dependencies are installed without
+// stopping and starting the container. It returns the function that stops watching.
+func watchDependencies(container string, projectDir string) (func(), error) {
+	install, err := getEnvVar("APPSODY_PREP")
+	if err != nil {
+		return nil, err
+	}
+	if install == "" {
+		Debug.log("The stack has no dependency install step (APPSODY_PREP), the dependency manifests are not watched")
+		return func() {}, nil
+	}
+	manifests, err := dependencyManifests()
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	for name := range manifests {
+		digests[name] = manifestDigest(filepath.Join(projectDir, name))
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// the project directory is watched rather than the files, editors often replace the file when they save it
+	if err = watcher.Add(projectDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	execArgs := []string{"exec"}
+	workdir, err := getEnvVar("APPSODY_PROJECT_DIR")
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	if workdir != "" {
+		execArgs = append(execArgs, "-w", workdir)
+	}
+	execArgs = append(execArgs, container, "/bin/sh", "-c", install)
+	if dryrun {
+		plannedCommand("docker", execArgs)
+		return func() { watcher.Close() }, nil
+	}
+
+	go func() {
+		timer := time.NewTimer(depsWatchDebounce)
+		timer.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if manifests[filepath.Base(event.Name)] {
+					timer.Reset(depsWatchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				Warning.log("Dependency manifest watch error: ", err)
+			case <-timer.C:
+				var changed []string
+				for name := range manifests {
+					digest := manifestDigest(filepath.Join(projectDir, name))
+					if digest != digests[name] {
+						digests[name] = digest
+						changed = append(changed, name)
+					}
+				}
+				if len(changed) == 0 {
+					continue
+				}
+				Info.logf("%v changed, installing the dependencies in the container", changed)
+				if err := execAndWaitReturnErr("docker", execArgs, Container); err != nil {
+					Warning.log("Could not install the dependencies, stop and run the project again to install them: ", err)
+				} else {
+					Info.log("The dependencies are installed")
+				}
+			}
+		}
+	}()
+	return func() { watcher.Close() }, nil
+}
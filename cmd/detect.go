@@ -0,0 +1,204 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+)
+
+// languageDetector recognises a language or framework from marker files in a project
+// or from the base image of its Dockerfile
+type languageDetector struct {
+	Language   string
+	Files      []string // any of these files in the project root is a match
+	BaseImages []string // any FROM image starting with one of these is a match
+	Keywords   []string // matched against the stack ids, keywords and descriptions in the index
+	// Contains narrows Files to the files mentioning one of these, such as a framework dependency
+	Contains []string
+}
+
+var languageDetectors = []languageDetector{
+	{"Node.js", []string{"package.json"}, []string{"node", "mhart/alpine-node"}, []string{"node", "nodejs"}, nil},
+	{"Express", []string{"package.json"}, nil, []string{"express"}, []string{`"express"`}},
+	{"Java", []string{"pom.xml", "build.gradle"}, []string{"openjdk", "adoptopenjdk", "maven", "gradle", "ibmjava", "open-liberty"}, []string{"java"}, nil},
+	{"Spring Boot", []string{"pom.xml", "build.gradle"}, []string{"springio"}, []string{"spring"}, []string{"spring-boot"}},
+	{"MicroProfile", []string{"pom.xml", "build.gradle"}, nil, []string{"microprofile"}, []string{"microprofile"}},
+	{"Swift", []string{"Package.swift"}, []string{"swift", "ibmcom/swift"}, []string{"swift"}, nil},
+	{"Python", []string{"requirements.txt", "setup.py", "Pipfile"}, []string{"python"}, []string{"python"}, nil},
+	{"Flask", []string{"requirements.txt", "setup.py", "Pipfile"}, nil, []string{"flask"}, []string{"flask"}},
+	{"Go", []string{"go.mod", "Gopkg.toml"}, []string{"golang"}, []string{"go", "golang"}, nil},
+}
+
+// detectLanguages returns the detectors matching the marker files in the project directory
+func detectLanguages(dir string) []languageDetector {
+	var detected []languageDetector
+	for _, detector := range languageDetectors {
+		for _, file := range detector.Files {
+			if found, _ := exists(filepath.Join(dir, file)); found && fileMentions(filepath.Join(dir, file), detector.Contains) {
+				Debug.logf("Detected %s from %s", detector.Language, file)
+				detected = append(detected, detector)
+				break
+			}
+		}
+	}
+	return detected
+}
+
+// fileMentions checks whether the file contains one of the texts, case insensitively. Without texts any file matches.
+func fileMentions(file string, texts []string) bool {
+	if len(texts) == 0 {
+		return true
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	lower := strings.ToLower(string(content))
+	for _, text := range texts {
+		if strings.Contains(lower, strings.ToLower(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestStacksForDirectory helps appsody init without a stack in a directory that is not an Appsody
+// project yet: when it has code, the stacks matching its language and framework are suggested.
+func suggestStacksForDirectory(index *RepoIndex, dir string) error {
+	if found, _ := exists(filepath.Join(dir, ".appsody-config.yaml")); found {
+		return nil
+	}
+	detected := detectLanguages(dir)
+	if len(detected) == 0 {
+		return nil
+	}
+	var languageNames []string
+	for _, language := range detected {
+		languageNames = append(languageNames, language.Language)
+	}
+	Info.log("Detected ", strings.Join(languageNames, ", "), " in the current directory")
+	suggestions := suggestStacks(index, detected)
+	if len(suggestions) == 0 {
+		return errors.New("None of the stacks of your repositories match the code in the current directory. Run `appsody list` to see the available stacks and run `appsody init <stack>`.")
+	}
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.AddRow("ID", "VERSION", "DESCRIPTION")
+	for i, suggestion := range suggestions {
+		if i == 3 {
+			break
+		}
+		versions, err := index.ByName(suggestion.ID)
+		if err != nil {
+			return err
+		}
+		stack := versions[0]
+		table.AddRow(suggestion.ID, stack.Version, stack.Description)
+	}
+	Info.log("Suggested stacks, best match first:\n", table.String())
+	if found, _ := exists(filepath.Join(dir, "Dockerfile")); found {
+		return errors.Errorf("The current directory is not an Appsody project yet. Run `appsody init %s --from-dockerfile` to adopt the existing code and Dockerfile with the best matching stack.", suggestions[0].ID)
+	}
+	return errors.Errorf("The current directory is not an Appsody project yet. Run `appsody init %s` to create one with the best matching stack.", suggestions[0].ID)
+}
+
+// detectDockerfileLanguages returns the detectors matching the base images in the FROM lines of a Dockerfile
+func detectDockerfileLanguages(dockerfile string) ([]languageDetector, error) {
+	file, err := os.Open(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var detected []languageDetector
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		image := strings.ToLower(fields[1])
+		// ignore the registry, docker.io/library/node:10 is just node:10
+		image = strings.TrimPrefix(image, "docker.io/")
+		image = strings.TrimPrefix(image, "library/")
+		for _, detector := range languageDetectors {
+			for _, base := range detector.BaseImages {
+				if strings.HasPrefix(image, base) {
+					Debug.logf("Detected %s from base image %s", detector.Language, fields[1])
+					detected = append(detected, detector)
+					break
+				}
+			}
+		}
+	}
+	return detected, scanner.Err()
+}
+
+// stackSuggestion is a stack from the index scored against the detected languages
+type stackSuggestion struct {
+	ID    string
+	Score int
+}
+
+// suggestStacks ranks the stacks in the index by how many of the detected languages' keywords
+// appear in their id, keywords or description. Stacks that match nothing are not returned.
+func suggestStacks(index *RepoIndex, detected []languageDetector) []stackSuggestion {
+	var suggestions []stackSuggestion
+	if err := index.loadShards(""); err != nil {
+		Warning.log(err)
+	}
+	for key, versions := range index.Projects {
+		if len(versions) == 0 {
+			continue
+		}
+		stack := versions[0]
+		_, id := splitStackKey(key)
+		words := strings.FieldsFunc(strings.ToLower(id+" "+strings.Join(stack.Keywords, " ")+" "+stack.Description), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		})
+		score := 0
+		for _, detector := range detected {
+			for _, keyword := range detector.Keywords {
+				for _, word := range words {
+					if word == keyword {
+						score++
+					}
+				}
+			}
+		}
+		if score > 0 {
+			suggestions = append(suggestions, stackSuggestion{index.displayID(key), score})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score == suggestions[j].Score {
+			// prefer the most generic stack, nodejs over nodejs-express
+			if len(suggestions[i].ID) == len(suggestions[j].ID) {
+				return suggestions[i].ID < suggestions[j].ID
+			}
+			return len(suggestions[i].ID) < len(suggestions[j].ID)
+		}
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	return suggestions
+}
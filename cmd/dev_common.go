@@ -17,14 +17,11 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"os/user"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
-	"syscall"
-	"time"
 
 	"github.com/pkg/errors"
 
@@ -52,14 +49,9 @@ func buildCommonFlags() {
 		//	os.Exit(1)
 		//}
 		projectName, perr := getProjectName()
-
 		if perr != nil {
-			if pmsg, ok := perr.(*NotAnAppsodyProject); ok {
-				Debug.log("Cannot retrieve the project name - continuing: ", perr)
-			} else {
-				Error.logf("Error occurred retrieving project name... exiting: %s", pmsg)
-				os.Exit(1)
-			}
+			// the flags are set up before any command runs, the command reports the error
+			Debug.log("Cannot retrieve the project name - continuing: ", perr)
 		}
 		//defaultName := filepath.Base(curDir) + "-dev"
 		defaultName := projectName + "-dev"
@@ -70,6 +62,22 @@ func buildCommonFlags() {
 		commonFlags.StringVar(&depsVolumeName, "deps-volume", defaultDepsVolume, "Docker volume to use for dependencies. Mounts to APPSODY_DEPS dir.")
 		commonFlags.StringArrayVarP(&ports, "publish", "p", nil, "Publish the container's ports to the host. The stack's exposed ports will always be published, but you can publish addition ports or override the host ports with this option.")
 		commonFlags.BoolVarP(&publishAllPorts, "publish-all", "P", false, "Publish all exposed ports to random ports")
+		commonFlags.StringVar(&listenAddress, "listen-address", "", "Publish the ports of the stack on the host interface with this IPv4 or IPv6 address, such as 127.0.0.1 or ::1, instead of every interface.")
+		commonFlags.BoolVar(&syncMode, "sync", false, "Copy the project files into a docker volume and sync changes, instead of bind mounting them. Much faster on Docker Desktop for Mac.")
+		commonFlags.StringVar(&runProfile, "profile", "", "Run with one of the profiles defined by the stack, such as hot-reload or prod-like.")
+		commonFlags.BoolVar(&runOnK8s, "k8s", false, "Run the development container as a pod in your Kubernetes cluster, syncing changes and forwarding its ports.")
+		commonFlags.StringVar(&namespace, "namespace", "", "Kubernetes namespace of the development pod, with --k8s.")
+		commonFlags.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use with --k8s. By default kubectl's own configuration.")
+		commonFlags.BoolVar(&noDepsWatch, "no-deps-watch", false, "Do not install the dependencies in the container when a dependency manifest, such as package.json or pom.xml, changes.")
+		commonFlags.BoolVar(&otelEnabled, "otel", false, "Export the telemetry of the application to the OpenTelemetry collector of the project, with the agent of the stack.")
+		commonFlags.StringVar(&otelEndpoint, "otel-endpoint", "", "OTLP endpoint of the OpenTelemetry collector, instead of the one of the project configuration. Implies --otel.")
+		commonFlags.BoolVar(&noPull, "no-pull", false, "Use the local stack image, without checking the registry for a newer one.")
+		commonFlags.BoolVar(&forcePull, "force-pull", false, "Pull the stack image, even when the local one is up to date.")
+		commonFlags.StringVar(&controllerImage, "controller-image", "", "Take the appsody-controller from this image, such as a mirror of appsody/init-controller or a pre-release, instead of the one installed with the CLI. Pin it with image@sha256:<digest>.")
+		commonFlags.BoolVar(&forceLock, "force", false, "Run even when another appsody operation, such as a run or a build, is in progress in the project.")
+		commonFlags.BoolVar(&checkUpdates, "check-updates", false, "Tell when the repositories have a newer version of the stack of the project. Set checkUpdates: true in the CLI configuration to always check.")
+		commonFlags.BoolVar(&noHooks, "no-hooks", false, "Do not run the pre-run hooks of the project.")
+		commonFlags.StringVar(&workspaceProject, "project", "", "Run the named project of the "+WorkspaceFile+" workspace instead of the project in the current directory.")
 
 	}
 
@@ -91,13 +99,24 @@ func addDevCommonFlags(cmd *cobra.Command) {
 }
 
 func commonCmd(cmd *cobra.Command, args []string, mode string) error {
+	if workspaceProject != "" {
+		if err := enterWorkspaceProject(cmd, workspaceProject); err != nil {
+			return err
+		}
+	}
 	projectDir, perr := getProjectDir()
 	if perr != nil {
 		return perr
 
 	}
-	projectConfig := getProjectConfig()
-	err := CheckPrereqs()
+	if runOnK8s && syncMode {
+		return errors.New("--sync cannot be used with --k8s, the project files are always synced into the pod")
+	}
+	projectConfig, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	err = CheckPrereqs()
 	if err != nil {
 		Warning.logf("Failed to check prerequisites: %v\n", err)
 	}
@@ -106,14 +125,67 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 	Debug.log("Stack image: ", platformDefinition)
 	Debug.log("Project directory: ", projectDir)
 
+	if err = runHooks(hookPreRun, mode, ""); err != nil {
+		return err
+	}
+
 	var cmdName string
 	var cmdArgs []string
-	dockerPullImage(platformDefinition)
+	donePull := startPhase("pull")
+	if err = refreshStackImage(projectConfig); err != nil {
+		return err
+	}
+	if err = pullStackImage(projectConfig); err != nil {
+		return err
+	}
+	donePull()
+	if err = checkStackImageRequiresCLI(); err != nil {
+		return err
+	}
+	hintStackUpdate(platformDefinition)
+	if !runOnK8s {
+		checkDockerResources()
+		checkWSLProject(projectDir)
+	}
+	if projectName, err := getProjectName(); err == nil {
+		if err = setRunInstance(cmd, projectName); err != nil {
+			return err
+		}
+	}
+	if err = lockProject(mode); err != nil {
+		return err
+	}
 
-	volumeMaps := getVolumeArgs()
+	volumeMaps, err := getVolumeArgs()
+	if err != nil {
+		return err
+	}
+	stackVolumeArgs := volumeMaps
+	var syncedMounts []syncedMount
+	if syncMode {
+		projectName, err := getProjectName()
+		if err != nil {
+			return err
+		}
+		volumeMaps, syncedMounts = syncVolumeArgs(volumeMaps, projectDir, projectName)
+		if err = populateSyncVolumes(platformDefinition, projectName, syncedMounts); err != nil {
+			return err
+		}
+		// the container runs with --rm, its volumes are removed once it is gone
+		defer removeSyncVolumes(projectName)
+	}
 	// Mount the APPSODY_DEPS cache volume if it exists
-	depsEnvVar := getEnvVar("APPSODY_DEPS")
+	depsEnvVar, err := getEnvVar("APPSODY_DEPS")
+	if err != nil {
+		return err
+	}
 	if depsEnvVar != "" {
+		// create the volume with the label of the project, appsody clean finds it with it
+		if projectName, err := getProjectName(); err == nil && !dryrun && runtimeCommand("docker", "volume", "inspect", depsVolumeName).Run() != nil {
+			if err = runtimeCommand("docker", "volume", "create", "--label", devProjectLabel+"="+projectName, depsVolumeName).Run(); err != nil {
+				Debug.log("Could not create the dependency volume: ", err)
+			}
+		}
 		depsMount := depsVolumeName + ":" + depsEnvVar
 		Debug.log("Adding dependency cache to volume mounts: ", depsMount)
 		volumeMaps = append(volumeMaps, "-v", depsMount)
@@ -123,9 +195,13 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 	destController := os.Getenv("APPSODY_MOUNT_CONTROLLER")
 	if destController != "" {
 		Debug.log("Overriding appsody-controller mount with APPSODY_MOUNT_CONTROLLER env variable: ", destController)
+	} else if image := controllerImageRef(); image != "" {
+		if destController, err = controllerFromImage(image); err != nil {
+			return err
+		}
 	} else {
-		// Copy the controller from the installation directory to the home (.appsody)
-		destController = filepath.Join(getHome(), "appsody-controller")
+		// Copy the controller from the installation directory to the state directory, the home (.appsody) by default
+		destController = filepath.Join(getStateDir(), "appsody-controller")
 		// Debug.log("Attempting to load the controller from ", destController)
 		//if _, err := os.Stat(destController); os.IsNotExist(err) {
 		// Always copy it from the executable dir
@@ -139,8 +215,14 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 		}
 		//Construct the appsody-controller mount
 		sourceController := filepath.Join(binaryLocation, "appsody-controller")
-		if dryrun {
-			Info.logf("Dry Run - Skipping copy of controller binary from %s to %s", sourceController, destController)
+		if _, statErr := os.Stat(sourceController); statErr != nil && !dryrun {
+			// installs without the controller, such as go get, use the controller image of the CLI version
+			Debug.log("No controller installed with the CLI, using the controller image: ", statErr)
+			if destController, err = controllerFromImage(defaultControllerImage()); err != nil {
+				return err
+			}
+		} else if dryrun {
+			planned(planWrite, destController, "controller binary from "+sourceController)
 		} else {
 			Debug.log("Attempting to copy the source controller from: ", sourceController)
 			//Copy the controller from the binary location to $HOME/.appsody
@@ -160,26 +242,75 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 	Debug.log("Adding controller to volume mounts: ", controllerMount)
 	volumeMaps = append(volumeMaps, "-v", controllerMount)
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	if runOnK8s {
+		if len(projectConfig.Services) > 0 {
+			Warning.log("The services in ", ConfigFile, " are not started when running in a cluster, use the services of the cluster instead")
+		}
+		return runInCluster(mode, projectDir, platformDefinition, stackVolumeArgs, destController)
+	}
+
+	projectName, _ := getProjectName()
+	otelEnv, err := telemetryEnv(projectName, "", nil)
+	if err != nil {
+		return err
+	}
+	appEnv, err := projectEnv(nil, false)
+	if err != nil {
+		return err
+	}
+	// Start the services the project depends on, they share a network with the dev container
+	var serviceEnvArgs []string
+	if len(projectConfig.Services) > 0 {
+		projectName, err := getProjectName()
+		if err != nil {
+			return err
+		}
+		if dockerNetwork == "" {
+			dockerNetwork = servicesNetworkName(projectName)
+		}
+		defer stopServices(projectName, projectConfig.Services, dockerNetwork)
+		serviceEnvArgs, err = startServices(projectName, projectConfig.Services, dockerNetwork)
+		if err != nil {
+			return err
+		}
+	}
+
+	c := handleInterrupts()
 	go func() {
 		<-c
-		dockerStop(containerName)
+		// the container stops, the command returns and stops the services
+		if err := dockerStop(containerName); err != nil {
+			Warning.log("Could not stop the container: ", err)
+		}
 		//dockerRemove(containerName) is not needed due to --rm flag
-		os.Exit(1)
+		endCleanup()
 	}()
 	cmdName = "docker"
-	cmdArgs = []string{"run", "--rm"}
+	cmdArgs = append([]string{"run", "--rm"}, getContainerRuntime().runArgs()...)
+	profileArgs, err := applyRunProfile(mode)
+	if err != nil {
+		return err
+	}
 	validPorts, portError := checkPortInput(ports)
 	if !validPorts {
 		return errors.Errorf("Ports provided as input to the command are not valid: %v\n", portError)
 	}
-	cmdArgs = processPorts(cmdArgs)
+	cmdArgs, err = processPorts(cmdArgs)
+	if err != nil {
+		return err
+	}
 	cmdArgs = append(cmdArgs, "--name", containerName)
+	if projectName != "" {
+		cmdArgs = append(cmdArgs, "--label", devProjectLabel+"="+projectName)
+	}
 	if dockerNetwork != "" {
 		cmdArgs = append(cmdArgs, "--network", dockerNetwork)
 	}
-	if getEnvVarBool("APPSODY_USER_RUN_AS_LOCAL") && runtime.GOOS != "windows" {
+	runAsLocal, err := getEnvVarBool("APPSODY_USER_RUN_AS_LOCAL")
+	if err != nil {
+		return err
+	}
+	if runAsLocal && runtime.GOOS != "windows" {
 		current, _ := user.Current()
 		cmdArgs = append(cmdArgs, "-u", fmt.Sprintf("%s:%s", current.Uid, current.Gid))
 		cmdArgs = append(cmdArgs, "-e", fmt.Sprintf("APPSODY_USER=%s", current.Uid), "-e", fmt.Sprintf("APPSODY_GROUP=%s", current.Gid))
@@ -188,26 +319,74 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 	if len(volumeMaps) > 0 {
 		cmdArgs = append(cmdArgs, volumeMaps...)
 	}
+	cmdArgs = append(cmdArgs, serviceEnvArgs...)
+	cmdArgs = append(cmdArgs, envArgs(otelEnv)...)
+	cmdArgs = append(cmdArgs, secretEnvArgs(appEnv)...)
+	cmdArgs = append(cmdArgs, profileArgs...)
+	resultsArgs, resultsDir, err := testResultsArgs(mode)
+	if err != nil {
+		return err
+	}
+	cmdArgs = append(cmdArgs, resultsArgs...)
+	if git := getGitMetadata(projectDir); git != nil {
+		Debug.logf("Passing git metadata to the container: %+v", *git)
+		cmdArgs = append(cmdArgs, git.dockerArgs()...)
+	}
 
 	cmdArgs = append(cmdArgs, "-t", "--entrypoint", "/appsody/appsody-controller", platformDefinition, "--mode="+mode)
 	Debug.logf("Attempting to start image %s with container name %s", platformDefinition, containerName)
+	doneContainer := startPhase(mode)
+	containerPort, err := getEnvVar("PORT")
+	if err != nil {
+		return err
+	}
 	execCmd, err := execAndListen(cmdName, cmdArgs, Container)
+	if err == nil {
+		emitPortsReady(publishedPorts(cmdArgs))
+		if baseURL, mapping := publishedBaseURL(publishedPorts(cmdArgs), containerPort); baseURL != "" {
+			Info.log("The application endpoints:")
+			printEndpoints(baseURL)
+			if networkURLs := networkBaseURLs(mapping); len(networkURLs) > 0 {
+				Info.log("The application is also reachable from the network at ", strings.Join(networkURLs, ", "))
+			}
+		}
+	}
+	if err == nil && len(syncedMounts) > 0 {
+		stopSync, syncErr := watchAndSync(dockerSyncTarget(containerName), syncedMounts)
+		if syncErr != nil {
+			return errors.Errorf("Could not watch the project for changes to sync: %v", syncErr)
+		}
+		defer stopSync()
+	}
+	if err == nil && mode != "test" && !noDepsWatch {
+		stopDepsWatch, watchErr := watchDependencies(containerName, projectDir)
+		if watchErr != nil {
+			Warning.log("Could not watch the dependency manifests of the project: ", watchErr)
+		} else {
+			defer stopDepsWatch()
+		}
+	}
 	if dryrun {
-		Info.log("Dry Run - Skipping execCmd.Wait")
+		Debug.log("Dry Run - Skipping execCmd.Wait")
 	} else {
 		if err == nil {
 			err = execCmd.Wait()
 		}
 	}
+	doneContainer()
+	if mode == "test" && testResultsDir != "" && !dryrun {
+		// the results of the failed tests are the ones that matter most
+		if collectErr := collectTestResults(resultsDir, volumeMaps); collectErr != nil {
+			Warning.log("Could not collect the test results: ", collectErr)
+		}
+	}
 	if err != nil {
 		// 'signal: interrupt'
 		// TODO presumably you can query the error itself
 		error := fmt.Sprintf("%s", err)
 		//Linux and Windows return a different error on Ctrl-C
 		if error == "signal: interrupt" || error == "exit status 2" {
-			Info.log("Closing down development environment, sleeping 60 seconds: ", error)
-
-			time.Sleep(60 * time.Second)
+			Info.log("Closing down development environment: ", error)
 		} else {
 			return errors.Errorf("Error waiting in 'appsody %s' %s", mode, error)
 
@@ -218,15 +397,21 @@ func commonCmd(cmd *cobra.Command, args []string, mode string) error {
 
 }
 
-func processPorts(cmdArgs []string) []string {
+func processPorts(cmdArgs []string) ([]string, error) {
 
 	var exposedPortsMapping []string
 
-	dockerExposedPorts := getExposedPorts()
+	dockerExposedPorts, err := getExposedPorts()
+	if err != nil {
+		return nil, err
+	}
 	Debug.log("Exposed ports provided by the docker file", dockerExposedPorts)
 	// if the container port is not in the lised of exposed ports add it to the list
 
-	containerPort := getEnvVar("PORT")
+	containerPort, err := getEnvVar("PORT")
+	if err != nil {
+		return nil, err
+	}
 	containerPortIsExposed := false
 
 	Debug.log("Container port set to: ", containerPort)
@@ -243,6 +428,9 @@ func processPorts(cmdArgs []string) []string {
 	}
 
 	if publishAllPorts {
+		if listenAddress != "" {
+			Warning.log("--publish-all publishes the ports on every interface, --listen-address only applies to the other ports")
+		}
 		cmdArgs = append(cmdArgs, "-P")
 		// user specified to publish all EXPOSE ports to random ports with -P, so clear this list so we don't add them with -p
 		dockerExposedPorts = []string{}
@@ -262,43 +450,39 @@ func processPorts(cmdArgs []string) []string {
 	for i := 0; i < len(dockerExposedPorts); i++ {
 		overrideFound := false
 		for j := 0; j < len(ports); j++ {
-			portMapping := strings.Split(ports[j], ":")
-			if dockerExposedPorts[i] == portMapping[1] {
+			if mapping, err := parsePortMapping(ports[j]); err == nil && dockerExposedPorts[i] == mapping.Container {
 				overrideFound = true
 			}
 		}
 		if !overrideFound {
-			exposedPortsMapping = append(exposedPortsMapping, dockerExposedPorts[i]+":"+dockerExposedPorts[i])
+			hostPort := dockerExposedPorts[i]
+			if number, err := strconv.Atoi(hostPort); err == nil && instancePortOffset > 0 {
+				hostPort = strconv.Itoa(number + instancePortOffset)
+			}
+			if number, err := strconv.Atoi(hostPort); err == nil {
+				if shifted := getContainerRuntime().hostPort(number); shifted != number {
+					Info.logf("The %s runtime can not bind port %d, publishing it on port %d. Use -p to choose another one.", getContainerRuntime().describe(), number, shifted)
+					hostPort = strconv.Itoa(shifted)
+				}
+			}
+			exposedPortsMapping = append(exposedPortsMapping, bindMapping(hostPort, dockerExposedPorts[i]))
 		}
 	}
 
 	for k := 0; k < len(exposedPortsMapping); k++ {
 		cmdArgs = append(cmdArgs, "-p", exposedPortsMapping[k])
 	}
-	return cmdArgs
+	return cmdArgs, nil
 }
 func checkPortInput(publishedPorts []string) (bool, error) {
-	validPorts := true
-	var portError error
-	validPortNumber := regexp.MustCompile("^([0-9]{1,4}|[1-5][0-9]{4}|6[0-4][0-9]{3}|65[0-4][0-9]{2}|655[0-2][0-9]|6553[0-5])$")
 	for i := 0; i < len(publishedPorts); i++ {
-		if !strings.Contains(publishedPorts[i], ":") {
-			validPorts = false
-			portError = errors.New("The port input: " + publishedPorts[i] + " is not valid as the : separator is missing.")
-			break
-		} else {
-			// check the numbers
-			portValues := strings.Split(publishedPorts[i], ":")
-			fmt.Println(portValues)
-			if !validPortNumber.MatchString(portValues[0]) || !validPortNumber.MatchString(portValues[1]) {
-				portError = errors.New("The numeric port input: " + publishedPorts[i] + " is not valid.")
-				validPorts = false
-				break
-
-			}
-
+		if _, err := parsePortMapping(publishedPorts[i]); err != nil {
+			return false, err
 		}
 	}
-	return validPorts, portError
+	if err := checkListenAddress(); err != nil {
+		return false, err
+	}
+	return true, nil
 
 }
@@ -0,0 +1,205 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The states of the files of a project against its scaffolding manifest
+const (
+	driftUnchanged = "unchanged"
+	driftModified  = "modified"
+	driftDeleted   = "deleted"
+	driftAdded     = "added"
+)
+
+var diffAll bool
+var diffPatch bool
+
+// fileDrift is a file of a project, who owns it and how it changed since the template laid it down
+type fileDrift struct {
+	File   string `json:"file"`
+	Owner  string `json:"owner"`
+	Status string `json:"status"`
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how the project has drifted from the template of its stack",
+	Long: `appsody init records the files it lays down from the template of the stack, with their checksums, in
+.appsody-manifest.yaml. This compares the project with it: the files of the template are owned by the stack while
+they are unchanged, and the files that were changed, deleted or added are yours.
+
+The files that are modified or deleted are listed, and the files that were added, without the dependency and build
+directories such as node_modules or target. Use --all to list the unchanged files of the template as well, and
+--patch to download the template again and show the changes of the modified files. Use -o json for a description
+tools can read.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, err := jsonOutput()
+		if err != nil {
+			return err
+		}
+		dir, err := getProjectDir()
+		if err != nil {
+			return err
+		}
+		manifest, err := readScaffoldManifest(dir)
+		if os.IsNotExist(err) {
+			return errors.Errorf("The project has no %s, it was not created by appsody init of this version of the Appsody CLI, or with --no-template", scaffoldManifestFile)
+		} else if err != nil {
+			return errors.Errorf("Could not read %s: %v", scaffoldManifestFile, err)
+		}
+		drift, err := projectDrift(dir, manifest)
+		if err != nil {
+			return err
+		}
+		var shown []fileDrift
+		counts := map[string]int{}
+		for _, file := range drift {
+			counts[file.Status]++
+			if diffAll || file.Status != driftUnchanged {
+				shown = append(shown, file)
+			}
+		}
+		if asJSON {
+			if shown == nil {
+				shown = []fileDrift{}
+			}
+			data, err := json.MarshalIndent(shown, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		stack := manifest.Stack
+		if stack == "" {
+			stack = "its stack"
+		}
+		Info.logf("The project was created from the template %s of %s on %s", manifest.Template, stack, manifest.Created.Format("2006-01-02"))
+		if len(shown) > 0 {
+			table := uitable.New()
+			table.MaxColWidth = 80
+			table.AddRow("FILE", "OWNER", "STATUS")
+			for _, file := range shown {
+				table.AddRow(file.File, file.Owner, file.Status)
+			}
+			Info.log(table.String())
+		}
+		Info.logf("%d file(s) of the template are unchanged, %d modified and %d deleted, %d file(s) were added", counts[driftUnchanged], counts[driftModified], counts[driftDeleted], counts[driftAdded])
+		if diffPatch && counts[driftModified]+counts[driftDeleted] > 0 {
+			return printDriftPatch(dir, manifest, drift)
+		}
+		return nil
+	},
+}
+
+// projectDrift compares the files of the project in dir with its manifest, sorted by file
+func projectDrift(dir string, manifest *scaffoldManifest) ([]fileDrift, error) {
+	var drift []fileDrift
+	for name, checksum := range manifest.Files {
+		actual, err := fileSha256(filepath.Join(dir, filepath.FromSlash(name)))
+		switch {
+		case os.IsNotExist(err):
+			drift = append(drift, fileDrift{File: name, Owner: "you", Status: driftDeleted})
+		case err != nil:
+			return nil, err
+		case actual == checksum:
+			drift = append(drift, fileDrift{File: name, Owner: "stack", Status: driftUnchanged})
+		default:
+			drift = append(drift, fileDrift{File: name, Owner: "you", Status: driftModified})
+		}
+	}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if file != dir && (strings.HasPrefix(info.Name(), ".") || skippedDirs[info.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if _, ok := manifest.Files[name]; !ok && name != scaffoldManifestFile {
+			drift = append(drift, fileDrift{File: name, Owner: "you", Status: driftAdded})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].File < drift[j].File })
+	return drift, nil
+}
+
+// printDriftPatch renders the template of the manifest again and prints the changes of the modified and deleted
+// files of the project
+func printDriftPatch(dir string, manifest *scaffoldManifest, drift []fileDrift) error {
+	rendered, err := renderStackTemplate(manifest.Template, manifest.Values)
+	if err != nil {
+		return err
+	}
+	var out strings.Builder
+	for _, file := range drift {
+		if file.Status != driftModified && file.Status != driftDeleted {
+			continue
+		}
+		from, err := ioutil.ReadFile(filepath.Join(rendered, filepath.FromSlash(file.File)))
+		if os.IsNotExist(err) {
+			out.WriteString(fmt.Sprintf("%s is no longer in the template\n", file.File))
+			continue
+		} else if err != nil {
+			return err
+		}
+		if actual, _ := fileSha256(filepath.Join(rendered, filepath.FromSlash(file.File))); actual != manifest.Files[file.File] {
+			Warning.logf("The template no longer lays down %s as it did when the project was created, it is compared with the current template", file.File)
+		}
+		toLabel := "project/" + file.File
+		var to []byte
+		if file.Status == driftDeleted {
+			toLabel = "/dev/null"
+		} else if to, err = ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file.File))); err != nil {
+			return err
+		}
+		if !isText(from) || !isText(to) {
+			out.WriteString(fmt.Sprintf("Binary file %s differs\n", file.File))
+			continue
+		}
+		out.WriteString(unifiedDiff("template/"+file.File, toLabel, splitLines(from), splitLines(to)))
+	}
+	fmt.Print(out.String())
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.PersistentFlags().BoolVar(&diffAll, "all", false, "Also list the files of the template that are unchanged.")
+	diffCmd.PersistentFlags().BoolVar(&diffPatch, "patch", false, "Download the template again and show the changes of the modified and deleted files.")
+}
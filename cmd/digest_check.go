@@ -0,0 +1,89 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// skipDigestCheck is the --skip-digest-check option, to only warn when a download does not match the digest
+// its index publishes
+var skipDigestCheck bool
+
+// publishedDigests are the sha256 digests the indexes publish for their downloads, by URL: the digest of a
+// stack version is the one of its first URL, the default template, templates and samples can have their own,
+// and so can the index shards
+var publishedDigests = map[string]string{}
+
+// publishDigest records the digest an index publishes for a URL. Digests are sha256:<hex> or the hex alone.
+func publishDigest(href string, digest string) {
+	if href == "" || digest == "" {
+		return
+	}
+	if i := strings.Index(digest, ":"); i >= 0 {
+		if !strings.EqualFold(digest[:i], "sha256") {
+			Debug.logf("Not verifying %s, only sha256 digests are supported: %s", href, digest)
+			return
+		}
+		digest = digest[i+1:]
+	}
+	publishedDigests[href] = strings.ToLower(digest)
+}
+
+// publishDigests records the digests of the versions of a stack
+func publishDigests(project ProjectVersions) {
+	for _, version := range project {
+		if len(version.URLs) > 0 {
+			publishDigest(version.URLs[0], version.Digest)
+		}
+		for _, template := range version.Templates {
+			publishDigest(template.URL, template.Digest)
+		}
+		for _, sample := range version.Samples {
+			publishDigest(sample.URL, sample.Digest)
+		}
+	}
+}
+
+// matchesPublishedDigest tells whether the sha256 of a download is the one its index publishes, true when
+// the index publishes none
+func matchesPublishedDigest(href string, actual string) bool {
+	expected, ok := publishedDigests[href]
+	return !ok || strings.EqualFold(expected, actual)
+}
+
+// verifyPublishedDigest fails when the sha256 of a download is not the one its index publishes, or only
+// warns with --skip-digest-check
+func verifyPublishedDigest(href string, actual string) error {
+	if matchesPublishedDigest(href, actual) {
+		if _, ok := publishedDigests[href]; ok {
+			Debug.log("Verified the digest of ", href)
+		}
+		return nil
+	}
+	auditSecurityEvent("digest", "digest mismatch of the download of "+href)
+	message := "The digest of " + href + " is sha256:" + actual + ", the index publishes sha256:" + publishedDigests[href] + ". The download is corrupted or has been tampered with."
+	if skipDigestCheck {
+		Warning.log(message, " It is used anyway, as --skip-digest-check is set.")
+		return nil
+	}
+	return errors.New(message + " Use --skip-digest-check to use it anyway.")
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&skipDigestCheck, "skip-digest-check", false, "Only warn when a template or index download does not match the digest published in the repository index.")
+}
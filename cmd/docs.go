@@ -61,7 +61,7 @@ func generateDoc(commandDocFile string) error {
 		newbase := strings.ReplaceAll(base, "_", "-")
 		return "#" + newbase
 	}
-	commandArray := []*cobra.Command{rootCmd, buildCmd, bashCompletionCmd, debugCmd, deployCmd, extractCmd, initCmd, listCmd, repoCmd, addCmd, repoListCmd, removeCmd, runCmd, stopCmd, testCmd, versionCmd}
+	commandArray := []*cobra.Command{rootCmd, buildCmd, bundleCmd, bundleExportCmd, bundleImportCmd, cacheCmd, cacheDuCmd, cleanCmd, completionCmd, configCmd, configCurrentContextCmd, configGetContextsCmd, configUseContextCmd, dashboardCmd, debugCmd, debugInfoCmd, deployCmd, deployStatusCmd, diffCmd, doctorCmd, envCmd, extractCmd, generateCmd, generateAzurePipelinesCmd, generateDevcontainerCmd, generateGitlabCICmd, generateJenkinsfileCmd, imagesCmd, imagesPruneCmd, infoCmd, initCmd, listCmd, logsCmd, migrateConfigCmd, openCmd, operatorCmd, operatorInstallCmd, operatorStatusCmd, operatorUninstallCmd, projectsCmd, psCmd, repoCmd, addCmd, repoDefaultCmd, repoDiffCmd, repoDoctorCmd, repoIndexCmd, repoIndexMigrateCmd, repoListCmd, repoMigrateCmd, repoMirrorCmd, repoRefreshCmd, removeCmd, repoRenameCmd, repoSetURLCmd, repoWatchCmd, runCmd, searchCmd, serveCmd, stackCmd, stackCICmd, stackDiffCmd, stackDocsCmd, stackIndexCmd, stackIndexGenerateCmd, stackIndexSignCmd, stackInspectCmd, stackPackageCmd, stackPullCmd, stackValidateCmd, stackVerifyImageCmd, stopCmd, templatesCmd, testCmd, validateCmd, verifyImageCmd, versionCmd}
 	for _, cmd := range commandArray {
 
 		markdownGenErr := doc.GenMarkdownCustom(cmd, docFile, linkHandler)
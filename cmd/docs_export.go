@@ -0,0 +1,118 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// docsExportFormat is the --format option of docs export
+var docsExportFormat string
+
+// commandTree is the output of docs export, the version of the CLI and its commands
+type commandTree struct {
+	Version string     `yaml:"version"`
+	Command commandDoc `yaml:"command"`
+}
+
+// commandDoc describes a command, its flags and its subcommands
+type commandDoc struct {
+	Name       string       `yaml:"name"`
+	Path       string       `yaml:"path"`
+	Usage      string       `yaml:"usage"`
+	Aliases    []string     `yaml:"aliases,omitempty"`
+	Short      string       `yaml:"short,omitempty"`
+	Long       string       `yaml:"long,omitempty"`
+	Example    string       `yaml:"example,omitempty"`
+	Deprecated string       `yaml:"deprecated,omitempty"`
+	Flags      []flagDoc    `yaml:"flags,omitempty"`
+	Commands   []commandDoc `yaml:"commands,omitempty"`
+}
+
+// flagDoc describes a flag. Persistent flags are also flags of the subcommands of the command.
+type flagDoc struct {
+	Name       string `yaml:"name"`
+	Shorthand  string `yaml:"shorthand,omitempty"`
+	Type       string `yaml:"type"`
+	Default    string `yaml:"default,omitempty"`
+	NoOptValue string `yaml:"noOptValue,omitempty"`
+	Usage      string `yaml:"usage"`
+	Persistent bool   `yaml:"persistent,omitempty"`
+	Repeatable bool   `yaml:"repeatable,omitempty"`
+	Deprecated string `yaml:"deprecated,omitempty"`
+}
+
+// describeCommand returns the description of the command and of its visible subcommands
+func describeCommand(cmd *cobra.Command) commandDoc {
+	described := commandDoc{
+		Name:       cmd.Name(),
+		Path:       cmd.CommandPath(),
+		Usage:      cmd.UseLine(),
+		Aliases:    cmd.Aliases,
+		Short:      cmd.Short,
+		Long:       cmd.Long,
+		Example:    cmd.Example,
+		Deprecated: cmd.Deprecated,
+	}
+	cmd.LocalFlags().VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		described.Flags = append(described.Flags, flagDoc{
+			Name:       f.Name,
+			Shorthand:  f.Shorthand,
+			Type:       f.Value.Type(),
+			Default:    f.DefValue,
+			NoOptValue: f.NoOptDefVal,
+			Usage:      f.Usage,
+			Persistent: cmd.PersistentFlags().Lookup(f.Name) != nil,
+			Repeatable: strings.HasSuffix(f.Value.Type(), "Array") || strings.HasSuffix(f.Value.Type(), "Slice"),
+			Deprecated: f.Deprecated,
+		})
+	})
+	for _, sub := range cmd.Commands() {
+		if !sub.IsAvailableCommand() {
+			continue
+		}
+		described.Commands = append(described.Commands, describeCommand(sub))
+	}
+	return described
+}
+
+var docsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the commands of the CLI as structured data",
+	Long: `This prints the whole command tree of the CLI, with the usage, descriptions and flags of every command, as json
+or yaml. The website and the completions of other tools are generated from it, so that they match the binary.
+
+Hidden commands and flags are left out. The persistent flags of a command are also flags of its subcommands.`,
+	Example: `  appsody docs export --format json > appsody-commands.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if docsExportFormat != "json" && docsExportFormat != "yaml" {
+			return errors.Errorf("Unknown format %q, use json or yaml", docsExportFormat)
+		}
+		outputFormat = docsExportFormat
+		return printStructured(commandTree{Version: VERSION, Command: describeCommand(rootCmd)})
+	},
+}
+
+func init() {
+	docsCmd.AddCommand(docsExportCmd)
+	docsExportCmd.PersistentFlags().StringVar(&docsExportFormat, "format", "json", "Format of the export: json or yaml.")
+}
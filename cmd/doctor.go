@@ -0,0 +1,168 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The outcomes of the doctor checks
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+)
+
+// doctorCheck is the outcome of one check of the environment
+type doctorCheck struct {
+	Name    string
+	Status  string
+	Details string
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that your machine is ready to run Appsody stacks",
+	Long: `This checks that the docker engine runs and has the CPUs, memory and disk space the stack of the project in the
+current directory recommends, and that kubectl is installed for appsody deploy. It also shows the container runtime the
+CLI uses: docker, or a rootless or remote podman, through the podman command or its socket. Set containerRuntime
+in the configuration, or APPSODY_CONTAINER_RUNTIME, to docker or podman to choose it. In WSL, it checks that the
+distribution is WSL2 and that the project is not on a Windows drive. It fails when a check fails, warnings are shown
+with what to change.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checks := runDoctorChecks()
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.Wrap = true
+		table.AddRow("CHECK", "STATUS", "DETAILS")
+		failed := 0
+		for _, check := range checks {
+			table.AddRow(check.Name, check.Status, check.Details)
+			if check.Status == checkFailed {
+				failed++
+			}
+		}
+		Info.log(table.String())
+		if failed > 0 {
+			return errors.Errorf("%d of the checks failed", failed)
+		}
+		return nil
+	},
+}
+
+func runDoctorChecks() []doctorCheck {
+	checks := []doctorCheck{runtimeCheck()}
+	versionFormat := "{{.Server.Version}}"
+	if getContainerRuntime().Command == runtimePodman {
+		versionFormat = "{{.Client.Version}}"
+	}
+	out, err := runtimeCommand("docker", "version", "--format", versionFormat).Output()
+	if err != nil {
+		checks = append(checks, doctorCheck{"docker", checkFailed, "The docker engine is not installed or not running: " + err.Error()})
+		return append(checks, kubectlCheck())
+	}
+	engine, err := dockerResources()
+	if err != nil {
+		checks = append(checks, doctorCheck{"docker", checkWarning, "Could not query the docker engine: " + err.Error()})
+	} else {
+		runtimeName := "Docker engine"
+		if engine.dockerDesktop() {
+			runtimeName = "Docker Desktop"
+		} else if getContainerRuntime().Podman {
+			runtimeName = "Podman"
+		}
+		checks = append(checks, doctorCheck{"docker", checkOK, fmt.Sprintf("%s %s, %d CPUs, %s of memory",
+			runtimeName, strings.TrimSpace(string(out)), engine.CPUs, formatMemorySize(engine.Memory))})
+	}
+	if _, err := getProjectDir(); err == nil {
+		problems, err := dockerResourceProblems()
+		switch {
+		case err != nil:
+			checks = append(checks, doctorCheck{"resources", checkWarning, err.Error()})
+		case len(problems) > 0:
+			for _, problem := range problems {
+				checks = append(checks, doctorCheck{"resources", checkWarning, problem})
+			}
+		default:
+			checks = append(checks, doctorCheck{"resources", checkOK, "The docker engine has the resources the stack recommends"})
+		}
+	}
+	if check, ok := wslCheck(engine); ok {
+		checks = append(checks, check)
+	}
+	return append(checks, kubectlCheck())
+}
+
+// wslCheck tells how the CLI runs in WSL, and whether the project is on a Windows drive
+func wslCheck(engine *dockerEngine) (doctorCheck, bool) {
+	switch wslVersion() {
+	case 0:
+		return doctorCheck{}, false
+	case 1:
+		return doctorCheck{"wsl", checkWarning, "WSL1 does not run containers: convert the distribution to WSL2 with wsl --set-version, and turn on its integration in Docker Desktop"}, true
+	}
+	if projectDir, err := getProjectDir(); err == nil {
+		if problem := wslProjectProblem(projectDir); problem != "" {
+			return doctorCheck{"wsl", checkWarning, problem}, true
+		}
+	}
+	details := "WSL2, with the docker engine of the distribution"
+	if engine != nil && engine.dockerDesktop() {
+		details = "WSL2, with the integration of Docker Desktop"
+	}
+	return doctorCheck{"wsl", checkOK, details}, true
+}
+
+// runtimeCheck tells which container runtime the CLI uses, and how it adapts to it
+func runtimeCheck() doctorCheck {
+	detected := getContainerRuntime()
+	details := "The " + detected.describe() + " runtime, through the " + detected.Command + " command"
+	if detected.Host != "" {
+		details += " and " + detected.Host
+	}
+	details += ", from the " + detected.Source + "."
+	status := checkOK
+	if detected.Rootless {
+		details += fmt.Sprintf(" The container ports below %d are published on the host port %d higher, such as %d for 80.", unprivilegedPortStart(), rootlessPortShift, 80+rootlessPortShift)
+		if len(detected.runArgs()) > 0 {
+			details += " The files the containers write in the project belong to you."
+		} else if !detected.Remote {
+			status = checkWarning
+			details += " Install the podman command so that the files the containers write in the project belong to you rather than to a subordinate id."
+		}
+	}
+	if detected.Remote {
+		status = checkWarning
+		details += " The engine runs on another machine or VM, only the directories it shares can be mounted in the containers."
+	}
+	return doctorCheck{"runtime", status, details}
+}
+
+func kubectlCheck() doctorCheck {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return doctorCheck{"kubectl", checkWarning, "kubectl is not installed, appsody deploy needs it"}
+	}
+	return doctorCheck{"kubectl", checkOK, "kubectl is installed"}
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,193 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The template archives downloaded from the repositories are cached for a day, with the sha256 they had when
+// downloaded. A cached archive that no longer matches it, or the digest its index publishes, has been damaged or
+// tampered with: it is moved to the quarantine directory for inspection and downloaded again, once.
+const (
+	downloadCacheTTL = 24 * time.Hour
+	checksumSuffix   = ".sha256"
+)
+
+func downloadCacheDir() string {
+	return filepath.Join(getStateDir(), "cache", "downloads")
+}
+
+func quarantineDir() string {
+	return filepath.Join(getStateDir(), "quarantine")
+}
+
+// cachedDownloadFile is where the download of a URL is cached
+func cachedDownloadFile(href string) string {
+	sum := sha256.Sum256([]byte(href))
+	return filepath.Join(downloadCacheDir(), hex.EncodeToString(sum[:16])+"-"+path.Base(href))
+}
+
+// cacheable tells whether the URL is downloaded through the cache. Local files are not.
+func cacheable(href string) bool {
+	parsed, err := url.Parse(href)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https" || parsed.Scheme == "oci")
+}
+
+// cachedDownload writes the cached download of the URL to destFile, downloading it when it is not cached,
+// is older than a day, or does not match its checksum or the digest its index publishes. When the URL can not be reached, or in offline
+// mode, an older cached download is used unless it is older than --max-stale.
+func cachedDownload(href string, destFile string) error {
+	cached := cachedDownloadFile(href)
+	info, err := os.Stat(cached)
+	if err == nil && time.Since(info.ModTime()) < downloadCacheTTL {
+		if used, err := useCachedDownload(href, cached, destFile); used || err != nil {
+			return err
+		}
+	} else if err == nil && offlineMode() {
+		return useStaleDownload(href, cached, destFile, info.ModTime(), errors.New("offline mode is on"))
+	}
+	if err = refreshCachedDownload(href, cached); err != nil {
+		// an interrupted or timed out command stops rather than going on with the cache
+		if info == nil || cliContext().Err() != nil {
+			return err
+		}
+		return useStaleDownload(href, cached, destFile, info.ModTime(), err)
+	}
+	_, err = copyFileSha256(cached, destFile)
+	return err
+}
+
+// useCachedDownload copies the cached download of the URL to destFile, and tells whether it did. A cached
+// download that does not match its checksum, or the digest its index publishes, is quarantined, so that it is
+// downloaded again.
+func useCachedDownload(href string, cached string, destFile string) (bool, error) {
+	expected, err := ioutil.ReadFile(cached + checksumSuffix)
+	if err != nil {
+		return false, nil
+	}
+	actual, err := copyFileSha256(cached, destFile)
+	if err != nil {
+		return false, err
+	}
+	if actual != strings.TrimSpace(string(expected)) {
+		quarantineDownload(cached, href, "the checksum it was downloaded with", strings.TrimSpace(string(expected)), actual)
+		return false, nil
+	}
+	if !matchesPublishedDigest(href, actual) {
+		if skipDigestCheck {
+			return true, verifyPublishedDigest(href, actual)
+		}
+		quarantineDownload(cached, href, "the digest its index publishes", publishedDigests[href], actual)
+		return false, nil
+	}
+	Debug.logw("Using the cached download", "url", href)
+	return true, nil
+}
+
+// useStaleDownload copies the cached download of a URL that can not be downloaded to destFile, within --max-stale.
+// It returns downloadErr when the cached download can not be used.
+func useStaleDownload(href string, cached string, destFile string, asOf time.Time, downloadErr error) error {
+	if err := checkMaxStale("download of "+href, time.Since(asOf)); err != nil {
+		Warning.log(err)
+		return downloadErr
+	}
+	used, err := useCachedDownload(href, cached, destFile)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return downloadErr
+	}
+	Warning.logf("Could not download %s, using the copy %s: %v", href, offlineAnnotation(asOf), downloadErr)
+	return nil
+}
+
+// refreshCachedDownload downloads the URL into the cache and records its checksum
+func refreshCachedDownload(href string, cached string) error {
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return err
+	}
+	partial := cached + ".part"
+	out, err := os.Create(partial)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.New()
+	err = downloadFile(href, io.MultiWriter(out, checksum))
+	out.Close()
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err = ioutil.WriteFile(cached+checksumSuffix, []byte(hex.EncodeToString(checksum.Sum(nil))+"\n"), 0644); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, cached)
+}
+
+// copyFileSha256 copies a file and returns its sha256
+func copyFileSha256(source string, dest string) (string, error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	checksum := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(out, checksum), in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// quarantineDownload moves a cached download that does not match the sha256 it is expected to have to the
+// quarantine directory, with a note of where it came from, and reports it in the audit log
+func quarantineDownload(cached string, href string, source string, expected string, actual string) {
+	Warning.logf("SECURITY: the cached download of %s does not match %s: sha256:%s is expected, the cached file is sha256:%s. It is quarantined and downloaded again.", href, source, expected, actual)
+	auditSecurityEvent("quarantine", "the cached download of "+href+" does not match "+source)
+	target := filepath.Join(quarantineDir(), time.Now().UTC().Format("20060102T150405Z")+"-"+filepath.Base(cached))
+	note := "url: " + href + "\nexpected: sha256:" + expected + " (" + source + ")\nactual: sha256:" + actual + "\n"
+	err := os.MkdirAll(quarantineDir(), 0700)
+	if err == nil {
+		err = os.Rename(cached, target)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(target+".txt", []byte(note), 0600)
+	}
+	if err != nil {
+		Warning.logf("Could not quarantine %s, removing it: %v", cached, err)
+		os.Remove(cached)
+	} else {
+		Warning.log("The quarantined file is ", target)
+	}
+	os.Remove(cached + checksumSuffix)
+}
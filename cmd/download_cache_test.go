@@ -0,0 +1,105 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCachedDownloadQuarantine(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	const published = "the published template"
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		if strings.HasPrefix(r.URL.Path, "/changed/") {
+			w.Write([]byte("a changed template"))
+			return
+		}
+		w.Write([]byte(published))
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		name       string
+		path       string // the path of the template on the server
+		cached     string // the content of the cached download
+		checksum   string // the sha256 recorded with it
+		downloads  int    // the downloads expected
+		quarantine bool   // whether the cached download is expected in the quarantine
+		err        string // expected in the error, "" when the published template is written
+	}{
+		{"matches", "/matches/template.tar.gz", published, sha256Hex(published), 0, false, ""},
+		{"damaged", "/damaged/template.tar.gz", "damaged", sha256Hex(published), 1, true, ""},
+		{"not published", "/not-published/template.tar.gz", "tampered", sha256Hex("tampered"), 1, true, ""},
+		{"changed on the server", "/changed/template.tar.gz", "tampered", sha256Hex("tampered"), 1, true, "The download is corrupted or has been tampered with"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			href := server.URL + test.path
+			cmd.PublishDigest(href, "sha256:"+sha256Hex(published))
+			cached := cmd.CachedDownloadFile(href)
+			if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(cached, []byte(test.cached), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(cached+".sha256", []byte(test.checksum+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			quarantined, _ := filepath.Glob(filepath.Join(cmd.QuarantineDir(), "*"+filepath.Base(cached)))
+			downloads = 0
+			dest := filepath.Join(filepath.Dir(cached), "dest.tar.gz")
+			defer os.Remove(dest)
+
+			err := cmd.CachedDownload(href, dest)
+			if test.err == "" && err != nil {
+				t.Fatalf("Expected the template to be written, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("Expected an error with %q, got %v", test.err, err)
+			}
+			if downloads != test.downloads {
+				t.Errorf("Expected %d downloads, got %d", test.downloads, downloads)
+			}
+			if test.err == "" {
+				if written, _ := ioutil.ReadFile(dest); string(written) != published {
+					t.Errorf("Expected the published template to be written, got %q", written)
+				}
+			}
+			after, _ := filepath.Glob(filepath.Join(cmd.QuarantineDir(), "*"+filepath.Base(cached)))
+			if (len(after) > len(quarantined)) != test.quarantine {
+				t.Errorf("Expected the cached download to be quarantined: %v, got %v", test.quarantine, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The downloads of indexes and templates are retried on the network errors that can go away, and on the errors
+// of the servers, with exponential backoff. A download cut off in the middle resumes with a Range request
+// where the server supports it, otherwise it starts over and skips what was already written.
+const (
+	defaultDownloadRetries = 3
+	defaultDownloadTimeout = 2 * time.Minute
+	firstRetryDelay        = time.Second
+	maxRetryDelay          = 30 * time.Second
+)
+
+// downloadTimeoutFlag and downloadRetriesFlag are the --download-timeout and --download-retries options, which
+// win over the downloadTimeout and downloadRetries settings of the CLI configuration
+var downloadTimeoutFlag time.Duration
+var downloadRetriesFlag int
+
+// downloadTimeout is how long one attempt of a download may take, 0 is no limit
+func downloadTimeout() time.Duration {
+	if rootCmd.PersistentFlags().Changed("download-timeout") {
+		return downloadTimeoutFlag
+	}
+	if configured := cliConfig.GetString("downloadTimeout"); configured != "" {
+		timeout, err := time.ParseDuration(configured)
+		if err == nil && timeout >= 0 {
+			return timeout
+		}
+		Warning.logf("The downloadTimeout %q of the configuration is not a duration such as 2m, using %s", configured, defaultDownloadTimeout)
+	}
+	return defaultDownloadTimeout
+}
+
+// downloadRetries is how many times a failed download is tried again
+func downloadRetries() int {
+	if rootCmd.PersistentFlags().Changed("download-retries") {
+		return downloadRetriesFlag
+	}
+	if cliConfig.IsSet("downloadRetries") {
+		if retries := cliConfig.GetInt("downloadRetries"); retries >= 0 {
+			return retries
+		}
+	}
+	return defaultDownloadRetries
+}
+
+// resumableWriter writes a download across its attempts. It counts the bytes written, for the Range of the
+// next attempt, and drops the ones a download that started over sends again.
+type resumableWriter struct {
+	writer  io.Writer
+	written int64
+	skip    int64
+	// validator is the ETag or Last-Modified of the first answer, to resume the same version of the file
+	validator string
+	// noRange is set when the server answered a Range request with the wrong part
+	noRange bool
+}
+
+func (w *resumableWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if w.skip > 0 {
+		if int64(len(p)) <= w.skip {
+			w.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[w.skip:]
+		w.skip = 0
+	}
+	written, err := w.writer.Write(p)
+	w.written += int64(written)
+	if err != nil {
+		return n - len(p) + written, err
+	}
+	return n, nil
+}
+
+// downloadAttempt makes one attempt of a download into dest. It returns the request and answer for the
+// checksum verification, and whether a failure is worth trying again.
+func downloadAttempt(client *http.Client, href string, headers map[string]string, dest *resumableWriter) (*http.Request, *http.Response, bool, error) {
+	req, err := newRequestWithContext(cliContext(), "GET", href, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resuming := dest.written > 0 && !dest.noRange
+	if resuming {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", dest.written))
+		if dest.validator != "" {
+			req.Header.Set("If-Range", dest.validator)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return req, nil, transientError(err), err
+	}
+	// registries and artifact servers accept the credentials of docker login
+	if resp.StatusCode == http.StatusUnauthorized && addRegistryAuth(req) {
+		resp.Body.Close()
+		if resp, err = client.Do(req); err != nil {
+			return req, nil, transientError(err), err
+		}
+	}
+	defer resp.Body.Close()
+	validator := resp.Header.Get("ETag")
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resuming:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", dest.written)) {
+			dest.noRange = true
+			return req, resp, true, fmt.Errorf("the server answered the resumption of %s with the part %s", href, resp.Header.Get("Content-Range"))
+		}
+		Debug.logw("Resuming the download", "url", href, "offset", dest.written)
+	case resp.StatusCode == http.StatusOK:
+		if dest.written > 0 {
+			if dest.validator != "" && validator != "" && validator != dest.validator {
+				return req, resp, false, fmt.Errorf("%s changed on the server during the download", href)
+			}
+			Debug.logw("Downloading again from the start, skipping the bytes already written", "url", href, "skipped", dest.written)
+			dest.skip = dest.written
+		}
+	default:
+		buf, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			Debug.logw("Could not read the contents of the response body", "url", href, "error", err)
+		} else {
+			Debug.logw("Contents of the http response", "url", href, "status", resp.StatusCode, "body", string(buf))
+		}
+		return req, resp, retryableStatus(resp.StatusCode), fmt.Errorf("%s response trying to download %s", resp.Status, href)
+	}
+	if dest.validator == "" {
+		dest.validator = validator
+	}
+	if _, err = io.Copy(dest, limitDownload(resp.Body)); err != nil {
+		return req, resp, transientError(err), fmt.Errorf("Could not copy http response body to writer: %s", err)
+	}
+	return req, resp, false, nil
+}
+
+// retryableStatus tells whether an answer is an error of the server, which can go away
+func retryableStatus(code int) bool {
+	return code >= http.StatusInternalServerError
+}
+
+// transferError is a download that failed on the network or on the server, rather than one whose content
+// failed its verification. The commands that can go on with a cached copy, such as readIndex, only do on those.
+type transferError struct {
+	error
+}
+
+// isTransferError tells whether an error, or the error it wraps, is a failed transfer
+func isTransferError(err error) bool {
+	_, ok := errors.Cause(err).(transferError)
+	return ok
+}
+
+// transientError tells whether a request failed on the network, such as a refused or reset connection, a
+// timeout or a download cut off. The refusals of appsody itself, such as a file:// URL outside of the fileRoots
+// or a redirect to plain http, and the certificates that can not be verified fail at once.
+func transientError(err error) bool {
+	// the client gives the errors of the transport in a *url.Error, itself a net.Error
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return true
+	}
+	_, network := err.(net.Error)
+	return network
+}
+
+// retryDelay is the backoff before the next attempt: the Retry-After of the answer when it has one, otherwise
+// doubling from firstRetryDelay, and never more than maxRetryDelay
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	delay := firstRetryDelay << uint(attempt)
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// waitToRetry waits for the next attempt, unless the command is interrupted first
+func waitToRetry(href string, attempt int, retries int, resp *http.Response, cause error) bool {
+	delay := retryDelay(attempt, resp)
+	Warning.logw("Could not download, trying again", "url", href, "delay", delay, "attempt", attempt+1, "retries", retries, "error", cause)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-cliContext().Done():
+		return false
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&downloadTimeoutFlag, "download-timeout", defaultDownloadTimeout, "How long one attempt of a download of an index or template may take. 0 is no limit. Overrides downloadTimeout of the configuration.")
+	rootCmd.PersistentFlags().IntVar(&downloadRetriesFlag, "download-retries", defaultDownloadRetries, "How many times a failed download of an index or template is tried again. Overrides downloadRetries of the configuration.")
+}
@@ -0,0 +1,107 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+func TestTransientError(t *testing.T) {
+	var tests = []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"refused connection", &url.Error{Op: "Get", URL: "https://stacks.example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"unknown host", &url.Error{Op: "Get", URL: "https://stacks.example.com", Err: &net.DNSError{Err: "no such host", Name: "stacks.example.com"}}, true},
+		{"cut off", io.ErrUnexpectedEOF, true},
+		{"outside of the file roots", &url.Error{Op: "Get", URL: "file:///etc/passwd", Err: errors.New("file:///etc/passwd is outside of the directories appsody reads file:// URLs from")}, false},
+		{"redirect to http", &url.Error{Op: "Get", URL: "https://stacks.example.com", Err: errors.New("refusing the redirect to http://stacks.example.com")}, false},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://stacks.example.com", Err: x509.UnknownAuthorityError{}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if transient := cmd.TransientError(test.err); transient != test.transient {
+				t.Errorf("Expected %v to be transient: %v, got %v", test.err, test.transient, transient)
+			}
+		})
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	var tests = []struct {
+		code  int
+		retry bool
+	}{
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+		{http.StatusNotFound, false},
+		{http.StatusForbidden, false},
+		{http.StatusTooManyRequests, false},
+	}
+	for _, test := range tests {
+		if retry := cmd.RetryableStatus(test.code); retry != test.retry {
+			t.Errorf("Expected the %d answers to be retried: %v, got %v", test.code, test.retry, retry)
+		}
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "0")
+		switch r.URL.Path {
+		case "/missing.yaml":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		path     string
+		requests int32
+	}{
+		{"/missing.yaml", 1},
+		{"/unavailable.yaml", 4},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			if err := cmd.DownloadFile(server.URL+test.path, &bytes.Buffer{}); err == nil {
+				t.Fatal("Expected the download to fail")
+			}
+			if got := atomic.LoadInt32(&requests); got != test.requests {
+				t.Errorf("Expected %d requests, got %d", test.requests, got)
+			}
+		})
+	}
+}
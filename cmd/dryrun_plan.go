@@ -0,0 +1,179 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+)
+
+// The actions of a dry run plan
+const (
+	planWrite          = "write file"
+	planDelete         = "delete"
+	planMove           = "move"
+	planDownload       = "download"
+	planRunContainer   = "run container"
+	planBuildImage     = "build image"
+	planPushImage      = "push image"
+	planTagImage       = "tag image"
+	planPullImage      = "pull image"
+	planApplyManifest  = "apply manifest"
+	planRunCommand     = "run command"
+	planDeleteResource = "delete resource"
+	planNotify         = "send notification"
+)
+
+// planStep is something a command would have done, had it not run with --dryrun
+type planStep struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+var (
+	// dryRunPlan collects the steps of the command, in order
+	dryRunPlan []planStep
+	// dryRunOutput is the --dryrun-output option: table or json
+	dryRunOutput string
+)
+
+// planned adds a step to the dry run plan in place of doing it
+func planned(action string, target string, detail string) {
+	Debug.logf("Dry Run - Skipping %s %s %s", action, target, detail)
+	dryRunPlan = append(dryRunPlan, planStep{action, target, detail})
+}
+
+// plannedStep adds a step done by a command to the dry run plan, with the command line as the detail
+func plannedStep(action string, target string, command string, args []string) {
+	line := commandLine(command, args)
+	showCommand(line)
+	planned(action, target, line)
+}
+
+// plannedCommand adds a command to the dry run plan, as the step it stands for when it is one of the
+// docker, buildah or kubectl commands that start containers, build, push or apply
+func plannedCommand(command string, args []string) {
+	line := commandLine(command, args)
+	showCommand(line)
+	positional := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		planned(planRunCommand, line, "")
+		return
+	}
+	last := positional[len(positional)-1]
+	switch command + " " + positional[0] {
+	case "docker run", "podman run":
+		planned(planRunContainer, containerImageArg(args), line)
+	case "docker build", "buildah bud", "podman build":
+		planned(planBuildImage, taggedImageArg(args), line)
+	case "docker push", "buildah push", "podman push":
+		planned(planPushImage, last, line)
+	case "docker pull", "podman pull":
+		planned(planPullImage, last, line)
+	case "docker image", "docker tag":
+		planned(planTagImage, last, line)
+	case "kubectl apply", "kubectl create":
+		planned(planApplyManifest, flagValue(args, "-f"), line)
+	case "kubectl delete":
+		planned(planDeleteResource, strings.Join(positional[1:], " "), line)
+	default:
+		planned(planRunCommand, line, "")
+	}
+}
+
+// flagValue returns the value of a flag of a command line, given as -f value or -f=value
+func flagValue(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"=")
+		}
+	}
+	return ""
+}
+
+// taggedImageArg returns the -t image of a build command line
+func taggedImageArg(args []string) string {
+	if image := flagValue(args, "-t"); image != "" {
+		return image
+	}
+	return flagValue(args, "--tag")
+}
+
+// containerImageArg returns the image of a docker run command line: the first argument after the options.
+// The options that take a value are the ones of the run commands appsody makes.
+func containerImageArg(args []string) string {
+	takesValue := map[string]bool{"-p": true, "-v": true, "-e": true, "-u": true, "-w": true, "--name": true, "--network": true,
+		"--entrypoint": true, "--env": true, "--volume": true, "--publish": true, "--label": true, "-l": true, "--workdir": true,
+		"--user": true, "--mount": true, "--add-host": true, "--cpus": true, "--memory": true, "-m": true, "--env-file": true}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if takesValue[arg] {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+	return ""
+}
+
+func initDryRunOutput() error {
+	if dryRunOutput != "table" && dryRunOutput != "json" {
+		return errors.Errorf("Unknown dry run output %q, use table or json", dryRunOutput)
+	}
+	return nil
+}
+
+// printDryRunPlan prints the steps the command skipped, as a table or as JSON
+func printDryRunPlan() {
+	if !dryrun || len(dryRunPlan) == 0 {
+		return
+	}
+	if dryRunOutput == "json" {
+		data, err := json.MarshalIndent(dryRunPlan, "", "  ")
+		if err != nil {
+			Error.log("Could not write the dry run plan: ", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+	table := uitable.New()
+	table.MaxColWidth = 100
+	table.Wrap = true
+	table.AddRow("STEP", "ACTION", "TARGET", "DETAIL")
+	for i, step := range dryRunPlan {
+		table.AddRow(i+1, step.Action, step.Target, step.Detail)
+	}
+	Info.log("Dry Run - the command would have done:\n", table.String())
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dryRunOutput, "dryrun-output", "table", "Format of the plan --dryrun prints of what the command would have done: table or json.")
+}
@@ -0,0 +1,109 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+var editorConfig bool
+
+// materializeEditorConfig copies the editor settings a stack recommends (launch.json debug configurations,
+// .editorconfig, formatter configs...) into the project. Stacks provide them as a directory in the stack
+// image named by APPSODY_EDITOR_CONFIG, laid out the way they should appear in the project.
+// Files that already exist in the project are never overwritten.
+func materializeEditorConfig() error {
+	configDir, err := getEnvVar("APPSODY_EDITOR_CONFIG")
+	if err != nil {
+		return err
+	}
+	if configDir == "" {
+		Warning.log("The stack does not recommend any editor configuration (APPSODY_EDITOR_CONFIG is not set)")
+		return nil
+	}
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return err
+	}
+	projectName, err := getProjectName()
+	if err != nil {
+		return err
+	}
+	if dryrun {
+		planned(planWrite, projectDir, "editor configuration from "+configDir)
+		return nil
+	}
+	tempDir, err := ioutil.TempDir("", "appsody-editor-config")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	stackImage := config.Platform
+	name := projectName + "-editor-config"
+	err = execAndWaitReturnErr("docker", []string{"create", "--name", name, stackImage}, Debug)
+	if err != nil {
+		return errors.Errorf("Could not create a container from the stack image: %v", err)
+	}
+	err = execAndWaitReturnErr("docker", []string{"cp", name + ":" + configDir + "/.", tempDir}, Debug)
+	if rmErr := dockerRemove(name); rmErr != nil {
+		Warning.logf("Could not remove the %s container: %v", name, rmErr)
+	}
+	if err != nil {
+		return errors.Errorf("Could not copy %s from the stack image: %v", configDir, err)
+	}
+
+	return filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(tempDir, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(projectDir, relPath)
+		if destExists, _ := exists(dest); destExists {
+			Info.log("Keeping the existing ", relPath)
+			return nil
+		}
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		target, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_EXCL, info.Mode())
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		if _, err = io.Copy(target, source); err != nil {
+			return err
+		}
+		Info.log("Created ", relPath)
+		return nil
+	})
+}
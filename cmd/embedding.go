@@ -0,0 +1,112 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/viper"
+)
+
+// configMutex serializes the functions run with a Config, as the commands read the configuration of the CLI
+var configMutex sync.Mutex
+
+// Config is a CLI configuration for the tools that embed the CLI, such as IDE plugins and test harnesses. The
+// exported functions of the repositories run with the configuration of Run.
+type Config struct {
+	config  *viper.Viper
+	context string
+}
+
+// LoadConfig reads the CLI configuration of file, or of $HOME/.appsody/.appsody.yaml when file is empty, and of
+// its current context
+func LoadConfig(file string) *Config {
+	c := &Config{}
+	_ = c.Run(func() error {
+		cliConfig = newCLIConfig(filepath.Join(homeDir(), ".appsody"), file)
+		_ = cliConfig.ReadInConfig()
+		initContext()
+		c.config, c.context = cliConfig, activeContext
+		return nil
+	})
+	return c
+}
+
+// Run runs fn with the configuration, once the appsody home of the configuration is created. The configuration
+// of the CLI is restored when fn returns.
+func (c *Config) Run(fn func() error) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	savedConfig, savedContext, savedStateDir, savedReadOnly := cliConfig, activeContext, stateDirPath, homeReadOnly
+	defer func() {
+		cliConfig, activeContext, stateDirPath, homeReadOnly = savedConfig, savedContext, savedStateDir, savedReadOnly
+	}()
+	if c.config == nil {
+		return fn()
+	}
+	cliConfig, activeContext, stateDirPath, homeReadOnly = c.config, c.context, "", false
+	if err := ensureConfig(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Home returns the appsody home of the configuration
+func (c *Config) Home() string {
+	return c.config.GetString("home")
+}
+
+// Repositories returns the repositories of the repository file
+func Repositories() ([]*RepositoryEntry, error) {
+	var repoFile RepositoryFile
+	if _, err := repoFile.getRepos(); err != nil {
+		return nil, err
+	}
+	return repoFile.Repositories, nil
+}
+
+// AddRepository adds a repository once its index has been read, the same as appsody repo add
+func AddRepository(name string, url string, options RepoAddOptions) error {
+	return addRepository(name, url, options)
+}
+
+// RemoveRepository removes a repository, even the default one
+func RemoveRepository(name string) error {
+	return updateRepoFile(func(repoFile *RepositoryFile) error {
+		if !repoFile.Has(name) {
+			return errors.Errorf("There is no repository %s", name)
+		}
+		removeRepo(repoFile, name)
+		return nil
+	})
+}
+
+// SetDefaultRepository makes a repository the default one. An empty name leaves no default repository.
+func SetDefaultRepository(name string) error {
+	return setDefaultRepo(name)
+}
+
+// GetIndex returns the merged index of the repositories, or of the repository of the project in the current
+// directory
+func GetIndex() (*RepoIndex, error) {
+	var index RepoIndex
+	if err := index.getIndex(); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
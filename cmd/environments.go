@@ -0,0 +1,129 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environment holds the deploy settings of one environment of the project, such as dev or prod, chosen
+// with appsody deploy --env:
+//
+//   environments:
+//     prod:
+//       resources:
+//         cpuRequest: 500m
+//         memoryLimit: 1Gi
+//       env:
+//         DB_PASSWORD: ${secret:kube:db-credentials/password}
+//         API_KEY: ${secret:sops:secrets/prod.yaml#api.key}
+//       clusters:
+//       - context: prod-us-east
+//       - context: prod-eu-west
+//         namespace: shop
+//         resources:
+//           cpuLimit: "2"
+//
+// The settings of the environment replace the ones at the top of .appsody-config.yaml. With clusters, deploy
+// deploys to each kube-context in order, stopping at the first cluster that fails unless onFailure is continue.
+// The secrets of the env of an environment are only resolved when it is deployed, see projectEnv.
+type Environment struct {
+	Resources *Resources       `yaml:"resources,omitempty"`
+	Telemetry *Telemetry       `yaml:"telemetry,omitempty"`
+	Clusters  []*ClusterTarget `yaml:"clusters,omitempty"`
+	// Env overrides the variables of the env of the project
+	Env map[string]string `yaml:"env,omitempty"`
+	// OnFailure is stop, the default, or continue to deploy to the next clusters after one failed
+	OnFailure string `yaml:"onFailure,omitempty"`
+}
+
+// ClusterTarget is a cluster of an environment, with the settings that differ from the environment's
+type ClusterTarget struct {
+	Context   string     `yaml:"context"`
+	Namespace string     `yaml:"namespace,omitempty"`
+	Resources *Resources `yaml:"resources,omitempty"`
+}
+
+// The onFailure policies of an environment
+const (
+	onFailureStop     = "stop"
+	onFailureContinue = "continue"
+)
+
+// deployEnvironment is the --env option of deploy
+var deployEnvironment string
+
+// getEnvironment returns the named environment of the project, or an empty one when no name is given
+func getEnvironment(name string) (*Environment, error) {
+	if name == "" {
+		return &Environment{}, nil
+	}
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	environments := config.Environments
+	if environment, ok := environments[name]; ok && environment != nil {
+		return environment, environment.validate(name)
+	}
+	var names []string
+	for environmentName := range environments {
+		names = append(names, environmentName)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return nil, errors.Errorf("The project has no environments, declare %s in the environments section of %s", name, ConfigFile)
+	}
+	return nil, errors.Errorf("The project has no environment %q.%s Its environments are %s.", name, didYouMean(name, names), strings.Join(names, ", "))
+}
+
+func (e *Environment) validate(name string) error {
+	if e.OnFailure != "" && e.OnFailure != onFailureStop && e.OnFailure != onFailureContinue {
+		return errors.Errorf("The onFailure of the %s environment must be %s or %s, not %q", name, onFailureStop, onFailureContinue, e.OnFailure)
+	}
+	for i, cluster := range e.Clusters {
+		if cluster == nil || cluster.Context == "" {
+			return errors.Errorf("Cluster %d of the %s environment has no context", i+1, name)
+		}
+	}
+	return nil
+}
+
+// deployTargets returns the clusters to deploy to in order. Without clusters the project is deployed to the
+// cluster of the current kube-context.
+func (e *Environment) deployTargets() []*ClusterTarget {
+	if len(e.Clusters) == 0 {
+		return []*ClusterTarget{{}}
+	}
+	return e.Clusters
+}
+
+func (e *Environment) stopOnFailure() bool {
+	return e.OnFailure != onFailureContinue
+}
+
+// use points the kubectl commands at the cluster, in its namespace or else the given one
+func (c *ClusterTarget) use(defaultNamespace string) {
+	if c.Context != "" {
+		kubeContext = c.Context
+	}
+	namespace = defaultNamespace
+	if c.Namespace != "" {
+		namespace = c.Namespace
+	}
+}
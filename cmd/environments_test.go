@@ -0,0 +1,99 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var environmentTests = []struct {
+	testName         string
+	environments     map[string]*cmd.Environment
+	name             string
+	expectedContexts []string // the kube-contexts of the clusters, empty for the current one
+	expectedStop     bool
+	expectedError    string
+}{
+	{"No environment", nil, "", []string{""}, true, ""},
+	{"Current cluster", map[string]*cmd.Environment{"dev": {}}, "dev", []string{""}, true, ""},
+	{"Clusters", map[string]*cmd.Environment{"prod": {Clusters: []*cmd.ClusterTarget{{Context: "us-east"}, {Context: "eu-west"}}}}, "prod",
+		[]string{"us-east", "eu-west"}, true, ""},
+	{"Continue", map[string]*cmd.Environment{"prod": {OnFailure: "continue", Clusters: []*cmd.ClusterTarget{{Context: "us-east"}}}}, "prod",
+		[]string{"us-east"}, false, ""},
+	{"Unknown on failure", map[string]*cmd.Environment{"prod": {OnFailure: "retry"}}, "prod",
+		nil, false, `The onFailure of the prod environment must be stop or continue, not "retry"`},
+	{"No context", map[string]*cmd.Environment{"prod": {Clusters: []*cmd.ClusterTarget{{Context: "us-east"}, {Namespace: "shop"}}}}, "prod",
+		nil, false, "Cluster 2 of the prod environment has no context"},
+	{"No environments", nil, "prod", nil, false, "The project has no environments, declare prod in the environments section"},
+	{"Unknown", map[string]*cmd.Environment{"dev": {}, "prod": {}}, "prd", nil, false, `The project has no environment "prd".`},
+}
+
+func TestGetEnvironment(t *testing.T) {
+	for _, tt := range environmentTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			restore := cmd.UseProjectConfig(cmd.ProjectConfig{Environments: tt.environments})
+			defer restore()
+			environment, err := cmd.GetEnvironment(tt.name)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var contexts []string
+			for _, target := range environment.DeployTargets() {
+				contexts = append(contexts, target.Context)
+			}
+			if !reflect.DeepEqual(contexts, tt.expectedContexts) {
+				t.Errorf("Expected to deploy to %q, got %q", tt.expectedContexts, contexts)
+			}
+			if environment.StopOnFailure() != tt.expectedStop {
+				t.Errorf("Expected stopping at the first failure to be %v", tt.expectedStop)
+			}
+		})
+	}
+}
+
+var clusterTargetTests = []struct {
+	testName          string
+	target            cmd.ClusterTarget
+	expectedContext   string
+	expectedNamespace string
+}{
+	// the current kube-context is the one of --kube-context, empty in the tests
+	{"Current cluster", cmd.ClusterTarget{}, "", "default-ns"},
+	{"Context", cmd.ClusterTarget{Context: "us-east"}, "us-east", "default-ns"},
+	{"Namespace", cmd.ClusterTarget{Context: "eu-west", Namespace: "shop"}, "eu-west", "shop"},
+}
+
+func TestClusterTargetUse(t *testing.T) {
+	for _, tt := range clusterTargetTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			context, namespace := tt.target.Use("default-ns")
+
+			if context != tt.expectedContext || namespace != tt.expectedNamespace {
+				t.Errorf("Expected the %q context and %q namespace, got %q and %q", tt.expectedContext, tt.expectedNamespace, context, namespace)
+			}
+		})
+	}
+}
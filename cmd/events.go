@@ -0,0 +1,173 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+)
+
+// jsonEvents turns standard output into a stream of JSON events, one per line, for IDE plugins.
+// The log messages that normally go to standard output go to standard error instead.
+var jsonEvents bool
+
+var eventsLock sync.Mutex
+
+// Event types of the --json-events stream
+const (
+	eventPhaseStarted  = "phase-started"
+	eventPhaseFinished = "phase-finished"
+	eventBuildStep     = "build-step"
+	eventPortsReady    = "ports-ready"
+	eventError         = "error"
+	eventPhaseSummary  = "phase-summary"
+)
+
+// buildStepLine matches the step lines of the classic docker builder, "Step 2/7 : COPY . /project",
+// and of BuildKit, "#6 [stage 2/7] COPY . /project"
+var buildStepLine = regexp.MustCompile(`^(?:Step (\d+)/(\d+) : |#\d+ \[(?:\S+ )?(\d+)/(\d+)\] )(.*)$`)
+
+// emitEvent writes one event to the stream. Every event has its type and time, the fields add the details.
+func emitEvent(event string, fields map[string]interface{}) {
+	if !jsonEvents {
+		return
+	}
+	line := map[string]interface{}{}
+	for key, value := range fields {
+		line[key] = value
+	}
+	line["event"] = event
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(line)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[Error] Could not encode the event: ", err)
+		return
+	}
+	eventsLock.Lock()
+	defer eventsLock.Unlock()
+	fmt.Fprintln(os.Stdout, string(data))
+}
+
+// phaseTime is how long a phase took, for the summary at the end of the command
+type phaseTime struct {
+	Phase   string  `json:"phase"`
+	Seconds float64 `json:"seconds"`
+}
+
+var phaseTimes []phaseTime
+var commandStarted = time.Now()
+
+// startPhase emits the start of a phase and returns the function that emits its end with its duration
+func startPhase(phase string) func() {
+	started := time.Now()
+	emitEvent(eventPhaseStarted, map[string]interface{}{"phase": phase})
+	return func() {
+		seconds := time.Since(started).Seconds()
+		eventsLock.Lock()
+		phaseTimes = append(phaseTimes, phaseTime{phase, seconds})
+		eventsLock.Unlock()
+		emitEvent(eventPhaseFinished, map[string]interface{}{"phase": phase, "seconds": seconds})
+	}
+}
+
+// phaseDurations adds up the time of each phase, for phases run more than once
+func phaseDurations() map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for _, phase := range phaseTimes {
+		durations[phase.Phase] += time.Duration(phase.Seconds * float64(time.Second))
+	}
+	return durations
+}
+
+// printPhaseSummary shows where the time of the command went, phase by phase. The time outside of
+// the phases, such as reading the configuration, is shown as other.
+func printPhaseSummary() {
+	if len(phaseTimes) == 0 {
+		return
+	}
+	total := time.Since(commandStarted).Seconds()
+	var phases []phaseTime
+	var inPhases float64
+	for _, phase := range phaseTimes {
+		merged := false
+		for i := range phases {
+			if phases[i].Phase == phase.Phase {
+				phases[i].Seconds += phase.Seconds
+				merged = true
+			}
+		}
+		if !merged {
+			phases = append(phases, phase)
+		}
+		inPhases += phase.Seconds
+	}
+	if other := total - inPhases; other >= 0.1 {
+		phases = append(phases, phaseTime{"other", other})
+	}
+	emitEvent(eventPhaseSummary, map[string]interface{}{"phases": phases, "seconds": total})
+	table := uitable.New()
+	for _, phase := range phases {
+		table.AddRow("  "+phase.Phase, secondsString(phase.Seconds), fmt.Sprintf("%3.0f%%", 100*phase.Seconds/total))
+	}
+	table.AddRow("  total", secondsString(total), "")
+	Info.log("Time by phase:\n", table.String())
+}
+
+func secondsString(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+// emitBuildStep turns a step line of the docker build output into a build-step event
+func emitBuildStep(line string) {
+	match := buildStepLine.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	step, total := match[1], match[2]
+	if step == "" {
+		step, total = match[3], match[4]
+	}
+	stepNumber, _ := strconv.Atoi(step)
+	totalSteps, _ := strconv.Atoi(total)
+	emitEvent(eventBuildStep, map[string]interface{}{"step": stepNumber, "total": totalSteps, "instruction": match[5]})
+}
+
+// publishedPorts returns the host:container port mappings of the docker run arguments
+func publishedPorts(dockerArgs []string) []string {
+	var published []string
+	for i := 0; i < len(dockerArgs)-1; i++ {
+		if dockerArgs[i] == "-p" {
+			published = append(published, dockerArgs[i+1])
+		}
+	}
+	return published
+}
+
+// emitPortsReady lists the host:container port mappings the application can be reached on
+func emitPortsReady(published []string) {
+	emitEvent(eventPortsReady, map[string]interface{}{"ports": published})
+}
+
+func addJSONEventsFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&jsonEvents, "json-events", false, "Write newline-delimited JSON progress events to standard output, and the log messages to standard error.")
+}
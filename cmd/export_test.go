@@ -0,0 +1,260 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"time"
+)
+
+// The unexported parts of the package that the tests of cmd_test use
+type (
+	CIResult       = ciResult
+	DeployProgress = deployProgress
+	EnvVariable    = envVariable
+)
+
+var (
+	FixturesTransport = fixturesTransport
+	FixtureCommand    = fixtureCommand
+
+	VerifyIndexSignature = verifyIndexSignature
+	SignIndexData        = signIndexData
+
+	CheckSecureURL         = checkSecureURL
+	InsecureAllowed        = insecureAllowed
+	AllowInsecureTemplates = allowInsecureTemplates
+
+	InFileRoots = inFileRoots
+	FileRoots   = fileRoots
+
+	TransientError  = transientError
+	RetryableStatus = retryableStatus
+	DownloadFile    = downloadFile
+
+	OperatorRBAC        = operatorRBAC
+	WatchNamespaceValue = watchNamespaceValue
+
+	DiscoverStacks = discoverStacks
+	WriteCIReport  = writeCIReport
+
+	CachedDownload     = cachedDownload
+	CachedDownloadFile = cachedDownloadFile
+	QuarantineDir      = quarantineDir
+	CacheIndex         = cacheIndex
+	PublishDigest      = publishDigest
+
+	GenNetworkPolicies     = genNetworkPolicies
+	GenPodDisruptionBudget = genPodDisruptionBudget
+	ParseProbe             = parseProbe
+	GetEnvironment         = getEnvironment
+
+	DeployOutput      = deployOutput
+	DeployFingerprint = deployFingerprint
+	ProjectStateFile  = projectStateFile
+
+	ExpandSecretRefs   = expandSecretRefs
+	SplitKubeSecretRef = splitKubeSecretRef
+	ProjectEnv         = projectEnv
+	GenEnvSecret       = genEnvSecret
+
+	ApplyPresets    = applyPresets
+	SplitPresetArgs = splitPresetArgs
+)
+
+// FetchSignedIndex downloads the index of the repository and verifies its signature
+func (r *RepositoryEntry) FetchSignedIndex() (*RepoIndex, error) {
+	return r.fetchSignedIndex(nil)
+}
+
+// ReadIndex returns the index of the repository, downloaded or from its cache
+func (r *RepositoryEntry) ReadIndex() (*RepoIndex, error) {
+	return r.readIndex()
+}
+
+// LoadSignedShards downloads the index of the repository, verifies its signature and loads all its shards
+func (r *RepositoryEntry) LoadSignedShards() (*RepoIndex, error) {
+	index, err := r.fetchSignedIndex(nil)
+	if err != nil {
+		return nil, err
+	}
+	r.ownShards(index)
+	return index, index.loadShards("")
+}
+
+// SupportsArch checks whether the stack version is published for the platform
+func (p *ProjectVersion) SupportsArch(platform string) bool {
+	return p.supportsArch(platform)
+}
+
+// Validate checks the availability of the project
+func (a *Availability) Validate() error {
+	return a.validate()
+}
+
+// Override returns the stack probe with the settings of the project
+func (p *Probe) Override(project *Probe) *Probe {
+	return p.override(project)
+}
+
+// Validate checks the quantities of the resources
+func (r *Resources) Validate() error {
+	return r.validate()
+}
+
+// DeployTargets returns the clusters the environment deploys to
+func (e *Environment) DeployTargets() []*ClusterTarget {
+	return e.deployTargets()
+}
+
+// StopOnFailure tells whether a deploy to the environment stops at the first cluster that fails
+func (e *Environment) StopOnFailure() bool {
+	return e.stopOnFailure()
+}
+
+// Use returns the kube-context and namespace kubectl uses for the cluster
+func (c *ClusterTarget) Use(defaultNamespace string) (string, string) {
+	savedContext, savedNamespace := kubeContext, namespace
+	defer func() { kubeContext, namespace = savedContext, savedNamespace }()
+	c.use(defaultNamespace)
+	return kubeContext, namespace
+}
+
+// Wants tells whether the notification is sent for the operation, its outcome and how long it took
+func (n Notification) Wants(operation string, outcome string, duration time.Duration) bool {
+	return n.wants(notificationEvent{Operation: operation, Outcome: outcome}, duration)
+}
+
+// ListProjects returns the table of the stacks of appsody list
+func (index *RepoIndex) ListProjects() string {
+	return index.listProjects()
+}
+
+// UseConfig sets up the CLI configuration of the configuration file for the unexported functions, as the
+// commands do before they run
+func UseConfig(configFile string) error {
+	cfgFile = configFile
+	initConfig()
+	return ensureConfig()
+}
+
+// RunStackCI runs the steps of stack ci on the stacks of root, parallel at a time, packaging their templates in
+// packageDir
+func RunStackCI(root string, packageDir string, parallel int) ([]ciResult, error) {
+	stacks, err := discoverStacks(root)
+	if err != nil {
+		return nil, err
+	}
+	ciParallel = parallel
+	return runStackCI(stacks, packageDir), nil
+}
+
+// DownloadOperatorManifest downloads an operator release manifest from baseURL
+func DownloadOperatorManifest(baseURL string, file string, ns string, watchNamespace string) ([]byte, error) {
+	operatorManifestsURL = baseURL
+	defer func() { operatorManifestsURL = "" }()
+	return downloadOperatorManifest(file, ns, watchNamespace)
+}
+
+// NewServeHandler returns the handler of the API of appsody serve, with its token and webhook secret
+func NewServeHandler(token string, webhookSecret string) http.Handler {
+	server := &appsodyServer{token: token, sessions: map[string]*serveSession{}, events: newServerEvents(), webhookSecret: webhookSecret}
+	server.refresher = newIndexRefresher(server.events)
+	return server
+}
+
+// KubectlArgs returns the kubectl arguments with the options of the cluster, for the --kubeconfig, --kube-context
+// and --namespace options and the service account mounted in serviceAccount
+func KubectlArgs(serviceAccount string, config string, context string, ns string, args ...string) []string {
+	savedDir, savedConfig, savedContext, savedNamespace := serviceAccountDir, kubeconfig, kubeContext, namespace
+	defer func() {
+		serviceAccountDir, kubeconfig, kubeContext, namespace = savedDir, savedConfig, savedContext, savedNamespace
+	}()
+	serviceAccountDir, kubeconfig, kubeContext, namespace = serviceAccount, config, context, ns
+	return kubectlArgs(args...)
+}
+
+// UseDeployAvailability sets the availability of the project being deployed for GenKnativeYaml, and returns the
+// function restoring it
+func UseDeployAvailability(availability *Availability) func() {
+	saved := deployAvailability
+	deployAvailability = availability
+	return func() { deployAvailability = saved }
+}
+
+// UseDeployProbes sets the probes of the project being deployed for GenKnativeYaml, and returns the function
+// restoring them
+func UseDeployProbes(probes Probes) func() {
+	saved := deployProbes
+	deployProbes = probes
+	return func() { deployProbes = saved }
+}
+
+// UseProjectConfig sets the configuration of the current project, as read from its .appsody-config.yaml, and
+// returns the function restoring it
+func UseProjectConfig(config ProjectConfig) func() {
+	saved := projectConfig
+	projectConfig = &config
+	return func() { projectConfig = saved }
+}
+
+// GetDeployResources returns the resources of the project deployed to the cluster of the environment, with the
+// --cpu-request, --cpu-limit, --memory-request and --memory-limit options of flags
+func GetDeployResources(environment *Environment, target *ClusterTarget, flags Resources) (*Resources, error) {
+	saved := resourceFlags
+	defer func() { resourceFlags = saved }()
+	resourceFlags = flags
+	return getDeployResources(environment, target)
+}
+
+// UseDeployResources sets the resources of the project being deployed for GenKnativeYaml, and returns the
+// function restoring them
+func UseDeployResources(resources *Resources) func() {
+	saved := deployResources
+	deployResources = resources
+	return func() { deployResources = saved }
+}
+
+// ResumeDeploy returns the progress of the interrupted deploy of the project, with the --restart option of restart
+func ResumeDeploy(projectName string, fingerprint string, restart bool) *DeployProgress {
+	saved := deployRestart
+	defer func() { deployRestart = saved }()
+	deployRestart = restart
+	return resumeDeploy(projectName, fingerprint)
+}
+
+// DeployedTo tells whether the interrupted deploy rolled the service out in the namespace of the kube-context
+func (p *deployProgress) DeployedTo(context string, ns string) bool {
+	savedContext, savedNamespace := kubeContext, namespace
+	defer func() { kubeContext, namespace = savedContext, savedNamespace }()
+	kubeContext, namespace = context, ns
+	return p.deployed()
+}
+
+// RetryPhase runs a phase of deploy with the --retries option of retries
+func RetryPhase(retries int, run func() error) error {
+	saved := deployRetries
+	defer func() { deployRetries = saved }()
+	deployRetries = retries
+	return retryPhase("apply", run)
+}
+
+// SendNotifications sends the notifications of the command, such as appsody build, started at started and ended
+// with err
+func SendNotifications(command string, started time.Time, err error) {
+	defer func() { notifyOperation, notifyCommand, notifyStarted, notificationsSent = "", "", time.Time{}, false }()
+	notifyOperation, notifyCommand, notifyStarted, notificationsSent = notifyOperations[command], command, started, false
+	sendNotifications(err)
+}
@@ -20,154 +20,165 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var targetDir string
 var extractContainerName string
 
+// extractRoot is where projects are extracted when no target directory is given, <home>/extract by default
+var extractRoot string
+
 var extractCmd = &cobra.Command{
 	Use:   "extract",
 	Short: "Extract the stack and your Appsody project to a local directory",
 	Long: `This copies the full project, stack plus app, into a local directory
 in preparation to build the final docker image.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		projectName, perr := getProjectName()
-		if perr != nil {
-			Error.log(perr)
-			os.Exit(1)
-		}
-		projectConfig := getProjectConfig()
-		Info.log("Extracting project from development environment")
-
-		if targetDir != "" {
-			// the user specified a target dir, quit if it already exists
-			targetDir, _ = filepath.Abs(targetDir)
-			Debug.log("Checking if target-dir exists: ", targetDir)
-			targetExists, err := exists(targetDir)
-			if err != nil {
-				Error.log("Error checking target directory: ", err)
-				os.Exit(1)
-			}
-			if targetExists {
-				Error.log("Cannot extract to an existing target-dir: ", targetDir)
-				os.Exit(1)
-			}
-			targetDirParent := filepath.Dir(targetDir)
-			targetDirParentExists, err := exists(targetDirParent)
-			if err != nil {
-				Error.log("Error checking directory: ", err)
-				os.Exit(1)
-			}
-			if !targetDirParentExists {
-				Error.log(targetDirParent, " does not exist")
-				os.Exit(1)
-			}
-		}
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return extractProject()
+	},
+}
 
-		extractDir := filepath.Join(getHome(), "extract")
-		extractDirExists, err := exists(extractDir)
+// extractProject copies the project and its stack to the extract directory, or to --target-dir
+func extractProject() error {
+	projectName, perr := getProjectName()
+	if perr != nil {
+		return perr
+	}
+	projectConfig, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	Info.log("Extracting project from development environment")
+
+	if targetDir != "" {
+		// the user specified a target dir, quit if it already exists
+		targetDir, _ = filepath.Abs(targetDir)
+		Debug.log("Checking if target-dir exists: ", targetDir)
+		targetExists, err := exists(targetDir)
 		if err != nil {
-			Error.log("Error checking directory: ", err)
-			os.Exit(1)
+			return errors.Errorf("Error checking target directory: %v", err)
 		}
-		if !extractDirExists {
-			if dryrun {
-				Info.log("Dry Run - Skip creating extract dir: ", extractDir)
-			} else {
-				Debug.log("Creating extract dir: ", extractDir)
-				err = os.MkdirAll(extractDir, os.ModePerm)
-				if err != nil {
-					Error.log("Error creating directories ", extractDir, " ", err)
-					os.Exit(1)
-				}
-			}
+		if targetExists {
+			return errors.Errorf("Cannot extract to an existing target-dir: %s", targetDir)
 		}
-		extractDir = filepath.Join(extractDir, projectName)
-		extractDirExists, err = exists(extractDir)
+		targetDirParent := filepath.Dir(targetDir)
+		targetDirParentExists, err := exists(targetDirParent)
 		if err != nil {
-			Error.log("Error checking directory: ", err)
-			os.Exit(1)
+			return errors.Errorf("Error checking directory: %v", err)
 		}
-		if extractDirExists {
-			if dryrun {
-				Info.log("Dry Run - Skip deleting extract dir: ", extractDir)
-			} else {
-				Debug.log("Deleting extract dir: ", extractDir)
-				os.RemoveAll(extractDir)
-			}
+		if !targetDirParentExists {
+			return errors.Errorf("%s does not exist", targetDirParent)
 		}
+	}
 
-		stackImage := projectConfig.Platform
-
-		dockerPullImage(stackImage)
-
-		containerProjectDir := "/project"
-		Debug.log("Container project dir: ", containerProjectDir)
-		volumeMaps := getVolumeArgs()
-		cmdName := "docker"
-		var appDir string
-		cmdArgs := []string{"--name", extractContainerName}
-		if len(volumeMaps) > 0 {
-			cmdArgs = append(cmdArgs, volumeMaps...)
+	extractDir := extractRoot
+	if extractDir == "" {
+		extractDir = filepath.Join(getStateDir(), "extract")
+	}
+	extractDirExists, err := exists(extractDir)
+	if err != nil {
+		return errors.Errorf("Error checking directory: %v", err)
+	}
+	if !extractDirExists {
+		if dryrun {
+			planned(planWrite, extractDir, "extract directory")
+		} else {
+			Debug.log("Creating extract dir: ", extractDir)
+			err = os.MkdirAll(extractDir, os.ModePerm)
+			if err != nil {
+				return errors.Errorf("Error creating directories %s %v", extractDir, err)
+			}
 		}
+	}
+	extractDir = filepath.Join(extractDir, projectName)
+	extractDirExists, err = exists(extractDir)
+	if err != nil {
+		return errors.Errorf("Error checking directory: %v", err)
+	}
+	if extractDirExists {
+		if dryrun {
+			planned(planDelete, extractDir, "extract directory")
+		} else {
+			Debug.log("Deleting extract dir: ", extractDir)
+			os.RemoveAll(longPath(extractDir))
+		}
+	}
 
-		if runtime.GOOS != "windows" {
-			// On Linux and OS/X we run docker create
-			cmdArgs = append([]string{"create"}, cmdArgs...)
-			cmdArgs = append(cmdArgs, stackImage)
-			err = execAndWaitReturnErr(cmdName, cmdArgs, Debug)
+	stackImage := projectConfig.Platform
 
-			if err != nil {
-				Error.log("docker create command failed: ", err)
-				dockerRemove(extractContainerName)
-				os.Exit(1)
-			}
-			appDir = extractContainerName + ":" + containerProjectDir
+	if err := pullStackImage(projectConfig); err != nil {
+		return err
+	}
 
-		} else {
-			// On Windows, we need to run the container to copy of the /project dir in /tmp/project
-			// and navigate all the symlinks using cp -rL
-			// then extract /tmp/project and remove the container
+	containerProjectDir := "/project"
+	Debug.log("Container project dir: ", containerProjectDir)
+	volumeMaps, err := getVolumeArgs()
+	if err != nil {
+		return err
+	}
+	cmdName := "docker"
+	var appDir string
+	cmdArgs := []string{"--name", extractContainerName}
+	if len(volumeMaps) > 0 {
+		cmdArgs = append(cmdArgs, volumeMaps...)
+	}
 
-			bashCmd := "cp -rfL " + filepath.ToSlash(containerProjectDir) + " " + filepath.ToSlash(filepath.Join("/tmp", containerProjectDir))
+	if runtime.GOOS != "windows" {
+		// On Linux and OS/X we run docker create
+		cmdArgs = append([]string{"create"}, cmdArgs...)
+		cmdArgs = append(cmdArgs, stackImage)
+		err = execAndWaitReturnErr(cmdName, cmdArgs, Debug)
 
-			Debug.log("Attempting to run ", bashCmd, " on image: ", stackImage, " with args: ", cmdArgs)
-			_, err = DockerRunBashCmd(cmdArgs, stackImage, bashCmd)
-			if err != nil {
-				Debug.log("Error attempting to run copy command ", bashCmd, " on image ", stackImage)
-				dockerRemove(extractContainerName)
-				os.Exit(1)
-			}
-			//If everything went fine, we need to set the source project directory to /tmp/...
-			appDir = extractContainerName + ":" + filepath.Join("/tmp", containerProjectDir)
+		if err != nil {
+			dockerRemove(extractContainerName)
+			return errors.Errorf("docker create command failed: %v", err)
 		}
-		cmdArgs = []string{"cp", appDir, extractDir}
-		err = execAndWaitReturnErr(cmdName, cmdArgs, Debug)
+		appDir = extractContainerName + ":" + containerProjectDir
 
+	} else {
+		// On Windows, we need to run the container to copy of the /project dir in /tmp/project
+		// and navigate all the symlinks using cp -rL
+		// then extract /tmp/project and remove the container
+
+		bashCmd := "cp -rfL " + filepath.ToSlash(containerProjectDir) + " " + filepath.ToSlash(filepath.Join("/tmp", containerProjectDir))
+
+		Debug.log("Attempting to run ", bashCmd, " on image: ", stackImage, " with args: ", cmdArgs)
+		_, err = DockerRunBashCmd(cmdArgs, stackImage, bashCmd)
 		if err != nil {
-			Error.log("docker cp command failed: ", err)
 			dockerRemove(extractContainerName)
-			os.Exit(1)
+			return errors.Errorf("Error attempting to run copy command %s on image %s: %v", bashCmd, stackImage, err)
 		}
+		//If everything went fine, we need to set the source project directory to /tmp/...
+		appDir = extractContainerName + ":" + filepath.Join("/tmp", containerProjectDir)
+	}
+	cmdArgs = []string{"cp", appDir, extractDir}
+	err = execAndWaitReturnErr(cmdName, cmdArgs, Debug)
+
+	if err != nil {
 		dockerRemove(extractContainerName)
-		if targetDir == "" {
-			if !dryrun {
-				Info.log("Project extracted to ", extractDir)
-			}
+		return errors.Errorf("docker cp command failed: %v", err)
+	}
+	if err = dockerRemove(extractContainerName); err != nil {
+		Warning.logf("Could not remove the %s container: %v", extractContainerName, err)
+	}
+	if targetDir == "" {
+		if !dryrun {
+			Info.log("Project extracted to ", extractDir)
+		}
+	} else {
+		if dryrun {
+			planned(planMove, extractDir, "to "+targetDir)
 		} else {
-			if dryrun {
-				Info.log("Dry Run - Skip moving ", extractDir, " to ", targetDir)
-			} else {
-				err = MoveDir(extractDir, targetDir)
-				if err != nil {
-					Error.log("Extract failed when moving ", extractDir, " to ", targetDir, " ", err)
-					os.Exit(1)
-				}
-				Info.log("Project extracted to ", targetDir)
+			err = MoveDir(extractDir, targetDir)
+			if err != nil {
+				return errors.Errorf("Extract failed when moving %s to %s %v", extractDir, targetDir, err)
 			}
+			Info.log("Project extracted to ", targetDir)
 		}
-	},
+	}
+	return nil
 }
 
 func init() {
@@ -180,14 +191,9 @@ func init() {
 	//}
 	//defaultName := filepath.Base(curDir) + "-extract"
 	projectName, perr := getProjectName()
-
 	if perr != nil {
-		if pmsg, ok := perr.(*NotAnAppsodyProject); ok {
-			Debug.log("Cannot retrieve the project name - continuing: ", perr)
-		} else {
-			Error.log("Error occurred retrieving project name... exiting: ", pmsg)
-			os.Exit(1)
-		}
+		// the flags are set up before any command runs, the command reports the error
+		Debug.log("Cannot retrieve the project name - continuing: ", perr)
 	}
 	defaultName := projectName + "-extract"
 	extractCmd.PersistentFlags().StringVar(&extractContainerName, "name", defaultName, "Assign a name to your development container.")
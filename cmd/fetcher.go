@@ -0,0 +1,110 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// artifactFetcher downloads the objects of a cloud object store, for the indexes and template archives kept in
+// buckets rather than on HTTP servers. Each fetcher is a protocol of the shared transport, so the downloads of
+// its URLs are retried, resumed, verified and cached like the https ones:
+//
+//   s3://bucket/path/index.yaml            Amazon S3
+//   gs://bucket/path/index.yaml            Google Cloud Storage
+//   azblob://account/container/index.yaml  Azure Blob Storage
+//
+// The fetchers find their credentials in the standard chain of their cloud: the environment variables, the
+// files of the cloud CLIs, then the metadata service of the machine. Without credentials, the objects are
+// read anonymously, from public buckets. The Authorization header of a repository, from repo add --token,
+// wins over the chain.
+type artifactFetcher interface {
+	// fetch sends the request of an object URL to the HTTP API of the store through base
+	fetch(base http.RoundTripper, req *http.Request) (*http.Response, error)
+}
+
+var artifactFetchers = map[string]artifactFetcher{
+	"s3":     &s3Fetcher{},
+	"gs":     &gcsFetcher{},
+	"azblob": &azureFetcher{},
+}
+
+// metadataTimeout bounds the requests to the metadata services of the clouds, which do not answer off the cloud
+const metadataTimeout = time.Second
+
+// fetcherTransport is the protocol of the shared transport for the URLs of a fetcher
+type fetcherTransport struct {
+	base    http.RoundTripper
+	fetcher artifactFetcher
+}
+
+func (t fetcherTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, errors.Errorf("%s URLs can only be read, not with %s", req.URL.Scheme, req.Method)
+	}
+	if req.URL.Host == "" {
+		return nil, errors.Errorf("%s has no bucket", req.URL)
+	}
+	return t.fetcher.fetch(t.base, req)
+}
+
+// storeRequest is the request of the HTTP API of a store for the request of an object URL, with its context,
+// method and headers
+func storeRequest(req *http.Request, href string) (*http.Request, error) {
+	storeReq, err := newRequestWithContext(req.Context(), req.Method, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.Header {
+		storeReq.Header[name] = values
+	}
+	return storeReq, nil
+}
+
+// cachedCredential remembers the credential a fetcher found in its chain until it expires. Not finding one is
+// remembered too, so that the metadata services are only asked once.
+type cachedCredential struct {
+	lock    sync.Mutex
+	found   bool
+	value   interface{}
+	expires time.Time
+}
+
+// get returns the cached credential, or the one lookup finds. lookup returns a nil credential when there is none.
+func (c *cachedCredential) get(lookup func() (interface{}, time.Time, error)) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.found && (c.expires.IsZero() || time.Now().Add(time.Minute).Before(c.expires)) {
+		return c.value, nil
+	}
+	value, expires, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	c.found, c.value, c.expires = true, value, expires
+	return value, nil
+}
+
+// metadataClient is the client of the metadata services of the clouds, which are reached directly rather than
+// through the proxy, and are given up on quickly
+func metadataClient() *http.Client {
+	dialer := &net.Dialer{Timeout: metadataTimeout}
+	return &http.Client{Timeout: 2 * metadataTimeout, Transport: &http.Transport{DialContext: dialer.DialContext}}
+}
@@ -0,0 +1,208 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// azureStorageVersion is the version of the Blob Storage API, one that accepts OAuth tokens
+	azureStorageVersion  = "2020-10-02"
+	azureStorageResource = "https://storage.azure.com/"
+)
+
+// azureFetcher reads azblob://account/container/blob URLs with the credentials of Azure: the
+// AZURE_STORAGE_CONNECTION_STRING, AZURE_STORAGE_SAS_TOKEN or AZURE_STORAGE_KEY variables, the login of the az
+// CLI, then the managed identity of the machine. The BlobEndpoint of the connection string reads the blobs of
+// an emulator such as Azurite instead.
+type azureFetcher struct {
+	credentials cachedCredential
+}
+
+// azureCredentials are the credentials of a storage account, or the OAuth token of an identity
+type azureCredentials struct {
+	// account is the storage account of the key or of the SAS token, any account when it is empty
+	account  string
+	endpoint string
+	key      []byte
+	sas      string
+	token    string
+}
+
+func (f *azureFetcher) fetch(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	account := req.URL.Host
+	var credentials *azureCredentials
+	if req.Header.Get("Authorization") == "" {
+		found, err := f.credentials.get(lookupAzureCredentials)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			credentials = found.(*azureCredentials)
+			if credentials.account != "" && credentials.account != account {
+				Debug.logf("The Azure credentials are for the %s storage account, reading the %s one anonymously", credentials.account, account)
+				credentials = nil
+			}
+		}
+	}
+	endpoint := "https://" + account + ".blob.core.windows.net"
+	if credentials != nil && credentials.endpoint != "" {
+		endpoint = strings.TrimSuffix(credentials.endpoint, "/")
+	}
+	href := endpoint + (&url.URL{Path: req.URL.Path}).EscapedPath()
+	if credentials != nil && credentials.sas != "" {
+		href += "?" + strings.TrimPrefix(credentials.sas, "?")
+	}
+	storeReq, err := storeRequest(req, href)
+	if err != nil {
+		return nil, err
+	}
+	storeReq.Header.Set("x-ms-version", azureStorageVersion)
+	storeReq.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	switch {
+	case credentials == nil || credentials.sas != "":
+	case credentials.token != "":
+		storeReq.Header.Set("Authorization", "Bearer "+credentials.token)
+	case credentials.key != nil:
+		signAzureRequest(storeReq, account, credentials.key)
+	}
+	return base.RoundTrip(storeReq)
+}
+
+// signAzureRequest signs a request without a body with the Shared Key of the storage account
+func signAzureRequest(req *http.Request, account string, key []byte) {
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+	resource := "/" + account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+	fields := []string{req.Method}
+	for _, name := range []string{"Content-Encoding", "Content-Language", "Content-Length", "Content-MD5", "Content-Type", "Date", "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		fields = append(fields, req.Header.Get(name))
+	}
+	stringToSign := strings.Join(fields, "\n") + "\n" + strings.Join(msHeaders, "\n") + "\n" + resource
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+}
+
+// lookupAzureCredentials goes through the Azure credentials. It returns no credentials when none is found.
+func lookupAzureCredentials() (interface{}, time.Time, error) {
+	if connection := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connection != "" {
+		Debug.log("Using the Azure storage connection string of AZURE_STORAGE_CONNECTION_STRING")
+		return parseAzureConnectionString(connection)
+	}
+	if sas := os.Getenv("AZURE_STORAGE_SAS_TOKEN"); sas != "" {
+		Debug.log("Using the SAS token of AZURE_STORAGE_SAS_TOKEN")
+		return &azureCredentials{account: os.Getenv("AZURE_STORAGE_ACCOUNT"), sas: sas}, time.Time{}, nil
+	}
+	if encoded := os.Getenv("AZURE_STORAGE_KEY"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, time.Time{}, errors.Errorf("AZURE_STORAGE_KEY is not a base64 account key: %v", err)
+		}
+		if os.Getenv("AZURE_STORAGE_ACCOUNT") == "" {
+			return nil, time.Time{}, errors.New("AZURE_STORAGE_KEY needs AZURE_STORAGE_ACCOUNT, the storage account of the key")
+		}
+		Debug.log("Using the account key of AZURE_STORAGE_KEY")
+		return &azureCredentials{account: os.Getenv("AZURE_STORAGE_ACCOUNT"), key: key}, time.Time{}, nil
+	}
+	if _, err := exec.LookPath("az"); err == nil {
+		out, err := exec.CommandContext(cliContext(), "az", "account", "get-access-token", "--resource", azureStorageResource, "--query", "accessToken", "--output", "tsv").Output()
+		if token := strings.TrimSpace(string(out)); err == nil && token != "" {
+			Debug.log("Using the Azure login of the az CLI")
+			return &azureCredentials{token: token}, time.Now().Add(30 * time.Minute), nil
+		}
+		Debug.log("The az CLI is not logged in: ", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?api-version=2018-02-01&resource="+url.QueryEscape(azureStorageResource), nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	if text, err := metadataText(metadataClient(), req); err == nil {
+		var token struct {
+			AccessToken string      `json:"access_token"`
+			ExpiresIn   interface{} `json:"expires_in"`
+		}
+		if err = json.Unmarshal([]byte(text), &token); err == nil && token.AccessToken != "" {
+			Debug.log("Using the managed identity of the Azure machine")
+			seconds, _ := strconv.Atoi(fmt.Sprint(token.ExpiresIn))
+			return &azureCredentials{token: token.AccessToken}, time.Now().Add(time.Duration(seconds) * time.Second), nil
+		}
+	}
+	Debug.log("No Azure credentials found, reading the blob containers anonymously")
+	return nil, time.Time{}, nil
+}
+
+// parseAzureConnectionString reads the account, key, SAS token and blob endpoint of a connection string, such as
+// AccountName=name;AccountKey=key;BlobEndpoint=http://127.0.0.1:10000/name
+func parseAzureConnectionString(connection string) (interface{}, time.Time, error) {
+	fields := map[string]string{}
+	for _, field := range strings.Split(connection, ";") {
+		if parts := strings.SplitN(field, "=", 2); len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	credentials := &azureCredentials{account: fields["AccountName"], endpoint: fields["BlobEndpoint"], sas: fields["SharedAccessSignature"]}
+	if fields["AccountKey"] != "" {
+		key, err := base64.StdEncoding.DecodeString(fields["AccountKey"])
+		if err != nil {
+			return nil, time.Time{}, errors.Errorf("The AccountKey of AZURE_STORAGE_CONNECTION_STRING is not base64: %v", err)
+		}
+		credentials.key = key
+	}
+	if credentials.endpoint == "" && credentials.account != "" {
+		protocol := fields["DefaultEndpointsProtocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := fields["EndpointSuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		credentials.endpoint = protocol + "://" + credentials.account + ".blob." + suffix
+	}
+	return credentials, time.Time{}, nil
+}
@@ -0,0 +1,219 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// gcsReadScope is the OAuth scope of the tokens of the service accounts, which only read the buckets
+	gcsReadScope     = "https://www.googleapis.com/auth/devstorage.read_only"
+	googleTokenURL   = "https://oauth2.googleapis.com/token"
+	gceMetadataHost  = "metadata.google.internal"
+	gcsDefaultServer = "https://storage.googleapis.com"
+)
+
+// gcsFetcher reads gs://bucket/object URLs with the credentials of the application default chain of Google
+// Cloud: the GOOGLE_OAUTH_ACCESS_TOKEN variable, the service account key or user credentials of
+// GOOGLE_APPLICATION_CREDENTIALS or of gcloud auth application-default login, then the service account of the
+// GCE instance. STORAGE_EMULATOR_HOST reads the buckets of an emulator instead.
+type gcsFetcher struct {
+	token cachedCredential
+}
+
+func (f *gcsFetcher) fetch(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	storeReq, err := storeRequest(req, gcsObjectURL(req.URL.Host, strings.TrimPrefix(req.URL.Path, "/")))
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") == "" {
+		token, err := f.token.get(lookupGoogleToken)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			storeReq.Header.Set("Authorization", "Bearer "+token.(string))
+		}
+	}
+	return base.RoundTrip(storeReq)
+}
+
+// gcsObjectURL is the URL of the media of an object in the JSON API of Cloud Storage
+func gcsObjectURL(bucket string, object string) string {
+	server := gcsDefaultServer
+	if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		server = strings.TrimSuffix(emulator, "/")
+		if !strings.Contains(server, "://") {
+			server = "http://" + server
+		}
+	}
+	return server + "/download/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(object) + "?alt=media"
+}
+
+// googleCredentialsFile is the file of the application default credentials
+func googleCredentialsFile() string {
+	if file := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); file != "" {
+		return file
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+	}
+	return filepath.Join(homeDir(), ".config", "gcloud", "application_default_credentials.json")
+}
+
+// googleCredentials is a credentials file of Google Cloud, of a service account or of a user
+type googleCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// lookupGoogleToken goes through the application default chain for an access token. It returns no token when
+// no credentials are found.
+func lookupGoogleToken() (interface{}, time.Time, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		Debug.log("Using the Google Cloud access token of GOOGLE_OAUTH_ACCESS_TOKEN")
+		return token, time.Time{}, nil
+	}
+	file := googleCredentialsFile()
+	if data, err := ioutil.ReadFile(file); err == nil {
+		var credentials googleCredentials
+		if err = json.Unmarshal(data, &credentials); err != nil {
+			return nil, time.Time{}, errors.Errorf("Could not read the Google Cloud credentials of %s: %v", file, err)
+		}
+		Debug.logf("Using the %s Google Cloud credentials of %s", credentials.Type, file)
+		switch credentials.Type {
+		case "service_account":
+			return serviceAccountToken(credentials)
+		case "authorized_user":
+			return googleTokenRequest(googleTokenURL, url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {credentials.ClientID},
+				"client_secret": {credentials.ClientSecret},
+				"refresh_token": {credentials.RefreshToken},
+			})
+		}
+		return nil, time.Time{}, errors.Errorf("The Google Cloud credentials of %s are of the %q type, use a service account key or gcloud auth application-default login", file, credentials.Type)
+	}
+	host := firstEnv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gceMetadataHost
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	if text, err := metadataText(metadataClient(), req); err == nil {
+		Debug.log("Using the service account of the GCE instance")
+		return parseGoogleToken([]byte(text))
+	}
+	Debug.log("No Google Cloud credentials found, reading the Cloud Storage buckets anonymously")
+	return nil, time.Time{}, nil
+}
+
+// serviceAccountToken exchanges a JWT signed with the key of a service account for an access token
+func serviceAccountToken(credentials googleCredentials) (interface{}, time.Time, error) {
+	block, _ := pem.Decode([]byte(credentials.PrivateKey))
+	if block == nil {
+		return nil, time.Time{}, errors.Errorf("The key of the %s service account is not a PEM key", credentials.ClientEmail)
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		key, _ = parsed.(*rsa.PrivateKey)
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, time.Time{}, errors.Errorf("Could not read the key of the %s service account: %v", credentials.ClientEmail, err)
+	}
+	if key == nil {
+		return nil, time.Time{}, errors.Errorf("The key of the %s service account is not an RSA key", credentials.ClientEmail)
+	}
+	tokenURL := credentials.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   credentials.ClientEmail,
+		"scope": gcsReadScope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return googleTokenRequest(tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	})
+}
+
+// googleTokenRequest asks the OAuth server of Google for an access token
+func googleTokenRequest(tokenURL string, form url.Values) (interface{}, time.Time, error) {
+	client, err := newHTTPClient(downloadTimeout())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return nil, time.Time{}, errors.Errorf("Could not get a Google Cloud access token: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, errors.Errorf("Could not get a Google Cloud access token: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return parseGoogleToken(body)
+}
+
+func parseGoogleToken(body []byte) (interface{}, time.Time, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return nil, time.Time{}, errors.Errorf("Could not read the Google Cloud access token: %v", err)
+	}
+	return token.AccessToken, time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
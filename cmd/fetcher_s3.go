@@ -0,0 +1,349 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// awsDefaultRegion is the region of the buckets when none is configured. Buckets of other regions answer with
+// their region, and are asked again there.
+const awsDefaultRegion = "us-east-1"
+
+// awsEmptyPayload is the sha256 of the empty body of the GET requests
+const awsEmptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsCredentials are the keys of an AWS identity, with the session token of temporary ones
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Fetcher reads s3://bucket/key URLs with the credentials of the AWS chain: the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables, the AWS_PROFILE profile of ~/.aws/credentials, the
+// credentials of the ECS task, then the role of the EC2 instance. AWS_ENDPOINT_URL, or AWS_ENDPOINT_URL_S3,
+// reads the buckets of an S3 compatible store such as MinIO instead.
+type s3Fetcher struct {
+	credentials cachedCredential
+	lock        sync.Mutex
+	// regions are the regions of the buckets, learned from their answers
+	regions map[string]string
+}
+
+func (f *s3Fetcher) fetch(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	bucket := req.URL.Host
+	region := f.bucketRegion(bucket)
+	resp, err := f.send(base, req, region)
+	if err != nil {
+		return nil, err
+	}
+	// a bucket of another region answers with its region
+	if other := resp.Header.Get("x-amz-bucket-region"); other != "" && other != region && resp.StatusCode >= 300 {
+		resp.Body.Close()
+		Debug.logf("The %s bucket is in the %s region", bucket, other)
+		f.lock.Lock()
+		f.regions[bucket] = other
+		f.lock.Unlock()
+		return f.send(base, req, other)
+	}
+	return resp, nil
+}
+
+// send sends the request of the object to the S3 API of the region, signed unless it already is authorized
+func (f *s3Fetcher) send(base http.RoundTripper, req *http.Request, region string) (*http.Response, error) {
+	storeReq, err := storeRequest(req, s3ObjectURL(req.URL.Host, req.URL.Path, region))
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Authorization") == "" {
+		credentials, err := f.credentials.get(lookupAWSCredentials)
+		if err != nil {
+			return nil, err
+		}
+		if credentials != nil {
+			signAWSRequest(storeReq, credentials.(*awsCredentials), region, "s3", time.Now())
+		}
+	}
+	return base.RoundTrip(storeReq)
+}
+
+func (f *s3Fetcher) bucketRegion(bucket string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.regions == nil {
+		f.regions = map[string]string{}
+	}
+	if region, ok := f.regions[bucket]; ok {
+		return region
+	}
+	return awsRegion()
+}
+
+// s3ObjectURL is the URL of an object in the S3 API. The buckets whose names have dots, which do not match the
+// certificate of the virtual hosts, and the buckets of S3 compatible stores are in the path.
+func s3ObjectURL(bucket string, key string, region string) string {
+	path := awsURIEncode(key, false)
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/" + bucket + path
+	}
+	if strings.Contains(bucket, ".") {
+		return "https://s3." + region + ".amazonaws.com/" + bucket + path
+	}
+	return "https://" + bucket + ".s3." + region + ".amazonaws.com" + path
+}
+
+// awsURIEncode encodes the characters other than the unreserved ones the way AWS signatures expect, keeping
+// the slashes of paths
+func awsURIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+// signAWSRequest signs a request without a body with AWS Signature Version 4
+func signAWSRequest(req *http.Request, credentials *awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", awsEmptyPayload)
+	if credentials.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for _, name := range []string{"range", "x-amz-content-sha256", "x-amz-date", "x-amz-security-token"} {
+		if value := req.Header.Get(name); value != "" {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	var query []string
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(query)
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), strings.Join(query, "&"), canonicalHeaders.String(), signedHeaders, awsEmptyPayload}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + credentials.secretKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// firstEnv returns the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// awsProfile is the profile of the AWS configuration files
+func awsProfile() string {
+	if profile := firstEnv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// awsRegion is the region of AWS_REGION, AWS_DEFAULT_REGION or the profile of ~/.aws/config
+func awsRegion() string {
+	if region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	file := firstEnv("AWS_CONFIG_FILE")
+	if file == "" {
+		file = filepath.Join(homeDir(), ".aws", "config")
+	}
+	section := "profile " + awsProfile()
+	if awsProfile() == "default" {
+		section = "default"
+	}
+	if region := readINISection(file, section)["region"]; region != "" {
+		return region
+	}
+	return awsDefaultRegion
+}
+
+// lookupAWSCredentials goes through the AWS credential chain. It returns no credentials when none is found.
+func lookupAWSCredentials() (interface{}, time.Time, error) {
+	if accessKey := os.Getenv("AWS_ACCESS_KEY_ID"); accessKey != "" {
+		Debug.log("Using the AWS credentials of AWS_ACCESS_KEY_ID")
+		return &awsCredentials{accessKey: accessKey, secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), sessionToken: os.Getenv("AWS_SESSION_TOKEN")}, time.Time{}, nil
+	}
+	file := firstEnv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		file = filepath.Join(homeDir(), ".aws", "credentials")
+	}
+	if profile := readINISection(file, awsProfile()); profile["aws_access_key_id"] != "" {
+		Debug.logf("Using the AWS credentials of the %s profile of %s", awsProfile(), file)
+		return &awsCredentials{accessKey: profile["aws_access_key_id"], secretKey: profile["aws_secret_access_key"], sessionToken: profile["aws_session_token"]}, time.Time{}, nil
+	}
+	client := metadataClient()
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return awsMetadataCredentials(client, "http://169.254.170.2"+uri, nil)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return awsMetadataCredentials(client, uri, http.Header{"Authorization": {os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")}})
+	}
+	if !strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		if credentials, expires, err := ec2Credentials(client); err == nil {
+			return credentials, expires, nil
+		}
+	}
+	Debug.log("No AWS credentials found, reading the S3 buckets anonymously")
+	return nil, time.Time{}, nil
+}
+
+// ec2Credentials reads the credentials of the role of the EC2 instance from its metadata service
+func ec2Credentials(client *http.Client) (interface{}, time.Time, error) {
+	const metadata = "http://169.254.169.254/latest"
+	tokenReq, err := http.NewRequest(http.MethodPut, metadata+"/api/token", nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := metadataText(client, tokenReq)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	header := http.Header{"X-aws-ec2-metadata-token": {token}}
+	rolesReq, err := http.NewRequest(http.MethodGet, metadata+"/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	rolesReq.Header = header
+	roles, err := metadataText(client, rolesReq)
+	if err != nil || roles == "" {
+		return nil, time.Time{}, errors.Errorf("the EC2 instance has no role: %v", err)
+	}
+	return awsMetadataCredentials(client, metadata+"/meta-data/iam/security-credentials/"+strings.Fields(roles)[0], header)
+}
+
+// awsMetadataCredentials reads the temporary credentials a metadata service of AWS publishes
+func awsMetadataCredentials(client *http.Client, href string, header http.Header) (interface{}, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if header != nil {
+		req.Header = header
+	}
+	text, err := metadataText(client, req)
+	if err != nil {
+		return nil, time.Time{}, errors.Errorf("Could not read the AWS credentials of %s: %v", href, err)
+	}
+	var published struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err = json.Unmarshal([]byte(text), &published); err != nil {
+		return nil, time.Time{}, errors.Errorf("Could not read the AWS credentials of %s: %v", href, err)
+	}
+	Debug.log("Using the AWS credentials of ", href)
+	return &awsCredentials{accessKey: published.AccessKeyID, secretKey: published.SecretAccessKey, sessionToken: published.Token}, published.Expiration, nil
+}
+
+// metadataText sends a request to a metadata service and returns its answer
+func metadataText(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s answered %s", req.URL, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// readINISection reads the keys of a section of an ini file, such as the profiles of ~/.aws/credentials
+func readINISection(file string, section string) map[string]string {
+	keys := map[string]string{}
+	f, err := os.Open(file)
+	if err != nil {
+		return keys
+	}
+	defer f.Close()
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.TrimSpace(line[1 : len(line)-1])
+		case current == section:
+			if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+				keys[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,252 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// driveLetter matches a Windows drive, C: or the older C| of some file URLs
+var driveLetter = regexp.MustCompile(`^[a-zA-Z][:|]$`)
+
+// FileURLToPath returns the local path of a file:// URL, for Windows or for other systems.
+// On Windows, these forms are understood:
+//
+//   file:///C:/stacks/index.yaml          C:\stacks\index.yaml, on a local or mapped drive
+//   file://C:/stacks/index.yaml           C:\stacks\index.yaml
+//   file://server/share/index.yaml        \\server\share\index.yaml
+//   file:////server/share/index.yaml      \\server\share\index.yaml
+//   file:///stacks/index.yaml             \stacks\index.yaml, on the current drive
+//
+// Elsewhere the URL must be file:///path or file://localhost/path. Escaped characters are decoded.
+func FileURLToPath(fileURL string, windows bool) (string, error) {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "file" {
+		return "", errors.Errorf("%s is not a file:// URL", fileURL)
+	}
+	path := parsed.Path
+	if parsed.Opaque != "" {
+		// file:C:/stacks/index.yaml
+		if path, err = url.PathUnescape(parsed.Opaque); err != nil {
+			return "", err
+		}
+	}
+	host := parsed.Host
+	if strings.EqualFold(host, "localhost") {
+		host = ""
+	}
+	if !windows {
+		if host != "" {
+			return "", errors.Errorf("%s names the host %s, file:// URLs to network shares are only supported on Windows", fileURL, host)
+		}
+		return path, nil
+	}
+
+	switch {
+	case driveLetter.MatchString(host):
+		path = host[:1] + ":" + path
+	case host != "":
+		path = "//" + host + path
+	case strings.HasPrefix(path, "//"):
+		path = "//" + strings.TrimLeft(path, "/")
+	case len(path) >= 3 && path[0] == '/' && driveLetter.MatchString(path[1:3]):
+		path = path[1:2] + ":" + path[3:]
+	case len(path) >= 2 && driveLetter.MatchString(path[:2]):
+		path = path[:1] + ":" + path[2:]
+	}
+	if strings.HasSuffix(path, ":") {
+		path += "/"
+	}
+	return strings.Replace(path, "/", `\`, -1), nil
+}
+
+// localFileURLPath returns the path of a file:// URL on this machine. In WSL, the URLs of the Windows drives,
+// such as file:///C:/stacks/index.yaml, are the files of the drives mounted in Linux, /mnt/c/stacks/index.yaml.
+func localFileURLPath(fileURL string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return FileURLToPath(fileURL, true)
+	}
+	if wslVersion() > 0 {
+		if path, err := FileURLToPath(fileURL, true); err == nil && windowsDrivePath.MatchString(path) {
+			return wslLinuxPath(path), nil
+		}
+	}
+	return FileURLToPath(fileURL, false)
+}
+
+// fileURL returns the file:// URL of a local file, as downloadFile reads them
+func fileURL(file string) string {
+	slashed := filepath.ToSlash(file)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return "file://" + (&url.URL{Path: slashed}).EscapedPath()
+}
+
+// extraFileRoots are files file:// URLs may also be read from during this command, such as the index of the
+// repository repo add is adding
+var extraFileRoots []string
+
+// fileURLDir returns the directory a file:// repository URL serves: the URL itself when it is a directory,
+// else the directory of the index
+func fileURLDir(repoURL string) (string, bool) {
+	path, err := localFileURLPath(repoURL)
+	if err != nil {
+		return "", false
+	}
+	if strings.HasSuffix(repoURL, "/") {
+		return path, true
+	}
+	return filepath.Dir(path), true
+}
+
+// fileURLIndex returns the index file of a file:// repository URL, index.yaml when the URL is a directory
+func fileURLIndex(repoURL string) (string, bool) {
+	path, err := localFileURLPath(repoURL)
+	if err != nil {
+		return "", false
+	}
+	if strings.HasSuffix(repoURL, "/") {
+		return filepath.Join(path, "index.yaml"), true
+	}
+	return path, true
+}
+
+// indexFileRoots returns the files of a file:// repository URL that are read: the directory of the index, with
+// the templates next to it. When the index is at the root of a drive or in the home directory of the user, only
+// the index and its signature are read, so that it can not refer to the other files there, such as ssh keys.
+func indexFileRoots(repoURL string) []string {
+	index, ok := fileURLIndex(repoURL)
+	if !ok {
+		return nil
+	}
+	dir := realPath(filepath.Dir(index))
+	if userHome, err := os.UserHomeDir(); filepath.Dir(dir) == dir || (err == nil && dir == realPath(userHome)) {
+		return []string{index, index + indexSignatureSuffix}
+	}
+	return []string{dir}
+}
+
+// repoFileRoots caches the index directories of the file:// repositories, until the repository file changes
+var repoFileRoots struct {
+	sync.Mutex
+	source  string
+	modTime time.Time
+	roots   []string
+}
+
+// repoIndexFiles returns the index directories, or index files, of the file:// repositories the user added
+func repoIndexFiles() []string {
+	source := getRepoFileLocation()
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil
+	}
+	repoFileRoots.Lock()
+	defer repoFileRoots.Unlock()
+	if repoFileRoots.source == source && repoFileRoots.modTime.Equal(info.ModTime()) {
+		return repoFileRoots.roots
+	}
+	var repos RepositoryFile
+	if _, err = repos.getRepos(); err != nil {
+		Warning.log(err)
+	}
+	var roots []string
+	for _, repo := range repos.Repositories {
+		roots = append(roots, indexFileRoots(repo.URL)...)
+	}
+	repoFileRoots.source = source
+	repoFileRoots.modTime = info.ModTime()
+	repoFileRoots.roots = roots
+	return roots
+}
+
+// fileRoots returns the files and directories file:// URLs are read from: the Appsody home and state
+// directories, with the imported bundles and packaged stacks, the index directories of the file:// repositories,
+// see indexFileRoots, and the fileRoots of the CLI configuration. Indexes can not refer to other local files,
+// such as the ssh keys of the user, unless their directories are added to fileRoots.
+func fileRoots() []string {
+	roots := append([]string{getHome(), getStateDir()}, cliConfig.GetStringSlice("fileRoots")...)
+	roots = append(roots, extraFileRoots...)
+	return append(roots, repoIndexFiles()...)
+}
+
+// realPath resolves the links of a path, so that a link can not lead out of a root. A path that does not
+// exist is returned cleaned.
+func realPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// inFileRoots tells whether a local path is one of the files, or in one of the directories, file:// URLs are
+// read from
+func inFileRoots(path string, roots []string) bool {
+	path = realPath(path)
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		root = realPath(root)
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			continue
+		}
+		if runtime.GOOS == "windows" && !strings.EqualFold(filepath.VolumeName(root), filepath.VolumeName(path)) {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileTransport serves file:// URLs from the local disks and, on Windows, from network shares.
+// Directories are served as listings, as http.FileServer does. Only the fileRoots are served.
+type fileTransport struct{}
+
+func (fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, err := localFileURLPath(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	if !inFileRoots(path, fileRoots()) {
+		return nil, errors.Errorf("%s is outside of the directories appsody reads file:// URLs from. Add its directory to fileRoots in the CLI configuration %s to allow it.", req.URL, cliConfig.ConfigFileUsed())
+	}
+	// serve from the root of the drive or share, C:\ or \\server\share\ on Windows and / elsewhere
+	volume := filepath.VolumeName(path)
+	root := volume + string(filepath.Separator)
+	local := *req
+	local.URL = &url.URL{Scheme: "file", Path: "/" + strings.TrimLeft(filepath.ToSlash(strings.TrimPrefix(path, volume)), "/")}
+	if strings.HasSuffix(req.URL.Path, "/") && !strings.HasSuffix(local.URL.Path, "/") {
+		local.URL.Path += "/"
+	}
+	return http.NewFileTransport(http.Dir(root)).RoundTrip(&local)
+}
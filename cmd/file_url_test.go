@@ -0,0 +1,168 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var fileURLTests = []struct {
+	url     string
+	windows bool
+	path    string
+}{
+	{"file:///C:/stacks/index.yaml", true, `C:\stacks\index.yaml`},
+	{"file:///c|/stacks/index.yaml", true, `c:\stacks\index.yaml`},
+	{"file://C:/stacks/index.yaml", true, `C:\stacks\index.yaml`},
+	{"file:C:/stacks/index.yaml", true, `C:\stacks\index.yaml`},
+	{"file:///Z:/", true, `Z:\`},
+	{"file:///Z:", true, `Z:\`},
+	{"file://server/share/stacks/index.yaml", true, `\\server\share\stacks\index.yaml`},
+	{"file:////server/share/stacks/index.yaml", true, `\\server\share\stacks\index.yaml`},
+	{"file://///server/share/stacks/index.yaml", true, `\\server\share\stacks\index.yaml`},
+	{"file://localhost/C:/stacks/index.yaml", true, `C:\stacks\index.yaml`},
+	{"file:///C:/my%20stacks/index.yaml", true, `C:\my stacks\index.yaml`},
+	{"file:///stacks/index.yaml", true, `\stacks\index.yaml`},
+	{"file:///home/me/stacks/index.yaml", false, "/home/me/stacks/index.yaml"},
+	{"file://localhost/home/me/stacks/index.yaml", false, "/home/me/stacks/index.yaml"},
+	{"file:///home/me/my%20stacks/index.yaml", false, "/home/me/my stacks/index.yaml"},
+}
+
+func TestFileURLToPath(t *testing.T) {
+	for _, test := range fileURLTests {
+		t.Run(test.url, func(t *testing.T) {
+			path, err := cmd.FileURLToPath(test.url, test.windows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != test.path {
+				t.Errorf("Expected %s to be %s, got %s", test.url, test.path, path)
+			}
+		})
+	}
+}
+
+func TestFileURLToPathErrors(t *testing.T) {
+	for _, url := range []string{"file://server/share/index.yaml", "https://server/index.yaml"} {
+		if _, err := cmd.FileURLToPath(url, false); err == nil {
+			t.Errorf("Expected an error for %s", url)
+		}
+	}
+}
+
+func TestInFileRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-file-roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside, filepath.Join(dir, "root2")} {
+		if err = os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := filepath.Join(dir, "index.yaml")
+	for _, file := range []string{filepath.Join(root, "stack.tar.gz"), filepath.Join(outside, "id_rsa"), index} {
+		if err = ioutil.WriteFile(file, []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skip("Symbolic links are not supported: ", err)
+	}
+	if err = os.Symlink(filepath.Join(outside, "id_rsa"), filepath.Join(root, "key")); err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{root, index}
+
+	var tests = []struct {
+		name string
+		path string
+		in   bool
+	}{
+		{"root", root, true},
+		{"file in root", filepath.Join(root, "stack.tar.gz"), true},
+		{"missing file in root", filepath.Join(root, "missing.tar.gz"), true},
+		{"file root", index, true},
+		{"next to file root", filepath.Join(dir, "other.yaml"), false},
+		{"parent of root", dir, false},
+		{"dot dot", filepath.Join(root, "..", "outside", "id_rsa"), false},
+		{"prefix of root", filepath.Join(dir, "root2"), false},
+		{"outside", filepath.Join(outside, "id_rsa"), false},
+		{"directory link out of root", filepath.Join(root, "escape", "id_rsa"), false},
+		{"file link out of root", filepath.Join(root, "key"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if in := cmd.InFileRoots(test.path, roots); in != test.in {
+				t.Errorf("Expected %s in the file roots: %v, got %v", test.path, test.in, in)
+			}
+		})
+	}
+}
+
+func TestFileRoots(t *testing.T) {
+	_, home, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "appsody-file-roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := "apiVersion: v1\nrepositories:\n" +
+		"- name: root\n  url: file:///index.yaml\n" +
+		"- name: user\n  url: file://" + filepath.ToSlash(userHome) + "/index.yaml\n" +
+		"- name: local\n  url: file://" + filepath.ToSlash(dir) + "/stacks/index.yaml\n" +
+		"- name: listing\n  url: file://" + filepath.ToSlash(dir) + "/listing/\n"
+	writeRepoFile(t, home, repos)
+	roots := cmd.FileRoots()
+
+	var tests = []struct {
+		path string
+		in   bool
+	}{
+		{"/index.yaml", true},
+		{"/index.yaml.sig", true},
+		{"/", false},
+		{"/etc/passwd", false},
+		{filepath.Join(userHome, "index.yaml"), true},
+		{filepath.Join(userHome, ".ssh", "id_rsa"), false},
+		{filepath.Join(dir, "stacks", "index.yaml"), true},
+		{filepath.Join(dir, "stacks", "nodejs.tar.gz"), true},
+		{filepath.Join(dir, "stacks", "templates", "nodejs.tar.gz"), true},
+		{filepath.Join(dir, "other", "nodejs.tar.gz"), false},
+		{filepath.Join(dir, "listing", "index.yaml"), true},
+		{filepath.Join(dir, "listing", "nodejs.tar.gz"), true},
+		{filepath.Join(home, "stacks", "dev.local", "index.yaml"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if in := cmd.InFileRoots(test.path, roots); in != test.in {
+				t.Errorf("Expected %s in the file roots: %v, got %v", test.path, test.in, in)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build fixtures
+// +build fixtures
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The functional tests run the CLI, built with the fixtures tag, against fixtures instead of the network and
+// the container runtime: with APPSODY_FIXTURES set to a directory, APPSODY_FIXTURES_MODE=record saves the
+// answers of the HTTP requests and the output of the docker, podman and kubectl commands there, and
+// APPSODY_FIXTURES_MODE=replay, the default, answers them from it without a network or a runtime. A request or
+// command run several times gets its recorded answers in order. The release builds have none of it.
+const (
+	fixturesEnv     = "APPSODY_FIXTURES"
+	fixturesModeEnv = "APPSODY_FIXTURES_MODE"
+	// fixtureCommandEnv is set on the CLI re-run in place of a runtime command, to the fixture it records or replays
+	fixtureCommandEnv = "APPSODY_FIXTURE_COMMAND"
+)
+
+// httpFixture is a recorded answer to an HTTP request
+type httpFixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// commandFixture is the recorded output of a runtime command
+type commandFixture struct {
+	Command  string `json:"command"`
+	Stdout   []byte `json:"stdout,omitempty"`
+	Stderr   []byte `json:"stderr,omitempty"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// missingFixtureError is a request or command replayed without a recorded answer, which is not retried
+type missingFixtureError struct {
+	what string
+	file string
+}
+
+func (e *missingFixtureError) Error() string {
+	return fmt.Sprintf("There is no recorded answer to %s in %s, record the fixtures again with %s=record", e.what, e.file, fixturesModeEnv)
+}
+
+var fixtureCounts = struct {
+	sync.Mutex
+	seen map[string]int
+}{seen: map[string]int{}}
+
+// fixturesDir is the directory of the fixtures, empty when the CLI runs for real
+func fixturesDir() string {
+	return os.Getenv(fixturesEnv)
+}
+
+func recordingFixtures() bool {
+	return os.Getenv(fixturesModeEnv) == "record"
+}
+
+// fixtureFile returns the file of the next answer to a request or command. When replaying past the recorded
+// answers, the last one is given again.
+func fixtureFile(kind string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	base := filepath.Join(fixturesDir(), kind, hex.EncodeToString(sum[:8]))
+	fixtureCounts.Lock()
+	fixtureCounts.seen[base]++
+	n := fixtureCounts.seen[base]
+	fixtureCounts.Unlock()
+	file := fmt.Sprintf("%s-%d.json", base, n)
+	if !recordingFixtures() && n > 1 && !fileExists(file) {
+		return fmt.Sprintf("%s-%d.json", base, n-1)
+	}
+	return file
+}
+
+func writeFixture(file string, fixture interface{}) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+func readFixture(file string, what string, fixture interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &missingFixtureError{what, fixturesDir()}
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return errors.Errorf("The fixture %s is not valid: %v", file, err)
+	}
+	return nil
+}
+
+// fixtureTransport records the answers of the transport it wraps, or replays them without it
+type fixtureTransport struct {
+	base http.RoundTripper
+}
+
+// fixturesTransport wraps the transport with the fixtures of APPSODY_FIXTURES
+func fixturesTransport(base http.RoundTripper) http.RoundTripper {
+	if fixturesDir() == "" {
+		return base
+	}
+	return fixtureTransport{base}
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the local files, such as the indexes of file:// repositories, are read as they are
+	if req.URL.Scheme == "file" {
+		return t.base.RoundTrip(req)
+	}
+	what := req.Method + " " + req.URL.String()
+	key := what
+	// a resumed download is a different request than the first attempt
+	if byteRange := req.Header.Get("Range"); byteRange != "" {
+		key += " " + byteRange
+	}
+	file := fixtureFile("http", key)
+	if recordingFixtures() {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fixture := httpFixture{req.Method, req.URL.String(), resp.StatusCode, resp.Header, body}
+		if err := writeFixture(file, fixture); err != nil {
+			return nil, errors.Errorf("Could not record %s: %v", what, err)
+		}
+		return resp, nil
+	}
+	var fixture httpFixture
+	if err := readFixture(file, what, &fixture); err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fixture.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
+
+// fixtureCommand returns the command that records or replays a runtime command: the CLI runs itself with
+// APPSODY_FIXTURE_COMMAND, so that the pipes, stdin and exit code of the command behave the same
+func fixtureCommand(name string, args []string) *exec.Cmd {
+	if fixturesDir() == "" {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	line := commandLine(name, args)
+	cmd := exec.CommandContext(cliContext(), self, append([]string{name}, args...)...)
+	cmd.Env = append(os.Environ(), fixtureCommandEnv+"="+fixtureFile("runtime", line))
+	return cmd
+}
+
+// runFixtureCommand is the CLI run by fixtureCommand, it returns the exit code of the recorded command
+func runFixtureCommand(file string, args []string) int {
+	if len(args) == 0 {
+		return 2
+	}
+	line := commandLine(args[0], args[1:])
+	os.Unsetenv(fixtureCommandEnv)
+	if recordingFixtures() {
+		var stdout, stderr bytes.Buffer
+		runtimeCmd := exec.Command(args[0], args[1:]...)
+		runtimeCmd.Stdin = os.Stdin
+		runtimeCmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+		runtimeCmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+		err := runtimeCmd.Run()
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 127
+		}
+		if err := writeFixture(file, commandFixture{line, stdout.Bytes(), stderr.Bytes(), exitCode}); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not record %s: %v\n", line, err)
+		}
+		return exitCode
+	}
+	var fixture commandFixture
+	if err := readFixture(file, line, &fixture); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 127
+	}
+	os.Stdout.Write(fixture.Stdout)
+	os.Stderr.Write(fixture.Stderr)
+	return fixture.ExitCode
+}
+
+func init() {
+	// fixtureCommand starts the executable again, the CLI or the binary of the tests that import it, with
+	// APPSODY_FIXTURE_COMMAND set. That process only plays the command, so it ends here before any test or
+	// command runs. The variable is only ever set on the environment of that process.
+	if file := os.Getenv(fixtureCommandEnv); file != "" {
+		os.Exit(runFixtureCommand(file, os.Args[1:]))
+	}
+}
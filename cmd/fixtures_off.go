@@ -0,0 +1,38 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !fixtures
+// +build !fixtures
+
+package cmd
+
+import (
+	"net/http"
+	"os/exec"
+)
+
+// The CLI is only built with the fixtures of the functional tests with the fixtures tag, see fixtures.go. Without
+// it, the requests and commands always go to the network and the container runtime.
+
+func fixturesDir() string {
+	return ""
+}
+
+func fixturesTransport(base http.RoundTripper) http.RoundTripper {
+	return base
+}
+
+func fixtureCommand(name string, args []string) *exec.Cmd {
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build fixtures
+// +build fixtures
+
+package cmd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// failingTransport stands for the network when the fixtures are replayed
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errors.New("the network is not used when replaying")
+}
+
+func TestFixturesHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("apiVersion: v2\n"))
+	}))
+	url := server.URL + "/index.yaml"
+
+	restore, err := cmdtest.UseFixtures(dir, "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: cmd.FixturesTransport(http.DefaultTransport)}
+	if _, err = client.Get(url); err != nil {
+		t.Fatal(err)
+	}
+	restore()
+	server.Close()
+
+	restore, err = cmdtest.UseFixtures(dir, "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+	client = &http.Client{Transport: cmd.FixturesTransport(failingTransport{})}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "apiVersion: v2\n" || resp.Header.Get("Content-Type") != "application/x-yaml" {
+		t.Errorf("Expected the recorded answer, got %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+
+	if _, err = client.Get(server.URL + "/other.yaml"); err == nil || !strings.Contains(err.Error(), "no recorded answer") {
+		t.Errorf("Expected a missing fixture error for a request that was not recorded, got %v", err)
+	}
+}
+
+func TestFixturesCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	restore, err := cmdtest.UseFixtures(dir, "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := cmd.FixtureCommand("go", []string{"env", "GOOS"}).Output()
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.TrimSpace(string(recorded))) == 0 {
+		t.Fatal("Expected the output of the recorded command")
+	}
+
+	// the replay answers from the fixture, changed here to tell it from a real run
+	files, _ := filepath.Glob(filepath.Join(dir, "runtime", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recorded command, found %v", files)
+	}
+	fixture := map[string]interface{}{"command": "go env GOOS", "stdout": []byte("replayed\n"), "stderr": []byte("warning\n"), "exitCode": 3}
+	data, _ := json.Marshal(fixture)
+	if err = ioutil.WriteFile(files[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err = cmdtest.UseFixtures(dir, "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restore()
+	replay := cmd.FixtureCommand("go", []string{"env", "GOOS"})
+	var stderr strings.Builder
+	replay.Stderr = &stderr
+	out, err := replay.Output()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected the recorded exit code 3, got %v", err)
+	}
+	if string(out) != "replayed\n" || stderr.String() != "warning\n" {
+		t.Errorf("Expected the recorded output, got %q and %q", out, stderr.String())
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// manifestMediaTypes are the manifests a registry may return for an image, lists and indexes first
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// registryTimeout bounds the freshness check, so run does not wait on an unreachable registry
+const registryTimeout = 10 * time.Second
+
+var authParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// the --no-pull and --force-pull options of run, debug and test
+var noPull, forcePull bool
+
+// offlineMode tells whether the CLI must not reach the network, with offline: true in the CLI configuration
+// or APPSODY_OFFLINE=true
+func offlineMode() bool {
+	return cliConfig.GetBool("offline") || strings.EqualFold(os.Getenv("APPSODY_OFFLINE"), "true")
+}
+
+// imageReference splits an image into the registry host, the repository and the tag, as docker resolves them
+func imageReference(image string) (string, string, string) {
+	if at := strings.LastIndex(image, "@"); at >= 0 {
+		image = image[:at]
+	}
+	name, tag := splitImageTag(image)
+	host := "registry-1.docker.io"
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, name = parts[0], parts[1]
+	} else if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	return host, name, tag
+}
+
+// registryDigest returns the digest the registry has for the tag of the image, without pulling it
+func registryDigest(image string) (string, error) {
+	host, repository, tag := imageReference(image)
+	client, err := newHTTPClient(registryTimeout)
+	if err != nil {
+		return "", err
+	}
+	manifestURL := "https://" + host + "/v2/" + repository + "/manifests/" + tag
+	head := func(authorization string) (*http.Response, error) {
+		req, err := newRequestWithContext(cliContext(), http.MethodHead, manifestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		return client.Do(req)
+	}
+	resp, err := head("")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := registryAuthorization(client, host, repository, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		if resp, err = head(authorization); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("the registry answered %s for %s", resp.Status, image)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.Errorf("the registry did not return the digest of %s", image)
+	}
+	return digest, nil
+}
+
+// registryAuthorization answers the challenge of a registry: a bearer token from its token service, anonymous
+// or with the stored credentials, or the stored credentials themselves
+func registryAuthorization(client *http.Client, host string, repository string, challenge string) (string, error) {
+	credential := registryCredentials(host)
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		if credential == nil {
+			return "", errors.Errorf("%s needs credentials, run docker login %s", host, host)
+		}
+		req, _ := newRequestWithContext(cliContext(), http.MethodGet, "https://"+host, nil)
+		req.SetBasicAuth(credential.Username, credential.Secret)
+		return req.Header.Get("Authorization"), nil
+	}
+	params := map[string]string{}
+	for _, match := range authParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", errors.Errorf("%s asked for a token without saying where to get it", host)
+	}
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+repository+":pull")
+	req, err := newRequestWithContext(cliContext(), http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if credential != nil && credential.Username != "<token>" {
+		req.SetBasicAuth(credential.Username, credential.Secret)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("the token service of %s answered %s", host, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// refreshStackImage makes sure run uses the current stack image: it compares the digest of the local image
+// with the one of the registry, and pulls the image only when they differ. With APPSODY_PULL_POLICY=IfNotPresent
+// it warns instead. Projects pinning a digest, --no-pull and offline mode skip the check, --force-pull always pulls.
+func refreshStackImage(config ProjectConfig) error {
+	stackImage := config.Platform
+	if noPull && forcePull {
+		return errors.New("--no-pull and --force-pull cannot be used together")
+	}
+	if forcePull {
+		imagePulled[stackImage] = true
+		return dockerPullCmd(stackImage)
+	}
+	if pinnedStackDigest(config) != "" || dryrun {
+		return nil
+	}
+	localFound := checkDockerImageExistsLocally(stackImage)
+	if noPull || offlineMode() {
+		if !localFound {
+			return errors.Errorf("The stack image %s is not on this machine and pulling it is turned off by --no-pull or offline mode", stackImage)
+		}
+		imagePulled[stackImage] = true
+		return nil
+	}
+	if !localFound {
+		// pulled by pullStackImage
+		return nil
+	}
+	remote, err := registryDigest(stackImage)
+	if err != nil {
+		Warning.logf("Could not check whether the stack image %s is up to date, using the local one: %v", stackImage, err)
+		imagePulled[stackImage] = true
+		return nil
+	}
+	imagePulled[stackImage] = true
+	current, err := imageHasDigest(stackImage, remote)
+	if err != nil {
+		return err
+	}
+	if current {
+		Debug.logf("The stack image %s is up to date", stackImage)
+		return nil
+	}
+	if strings.EqualFold(os.Getenv("APPSODY_PULL_POLICY"), "IfNotPresent") {
+		Warning.logf("The registry has a newer %s stack image, run with --force-pull to use it", stackImage)
+		return nil
+	}
+	Info.logf("The registry has a newer %s stack image, pulling it", stackImage)
+	return dockerPullCmd(stackImage)
+}
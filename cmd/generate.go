@@ -0,0 +1,75 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var generateForce bool
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate configuration files for tools that work with your Appsody project",
+	Long:  ``,
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.PersistentFlags().BoolVar(&generateForce, "force", false, "Overwrite the generated file if it already exists.")
+}
+
+// writeGeneratedFile writes a generated file relative to the project directory, refusing to
+// replace an existing file unless --force was given
+func writeGeneratedFile(relPath string, contents []byte) error {
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(projectDir, relPath)
+	fileExists, err := exists(file)
+	if err != nil {
+		return err
+	}
+	if fileExists && !generateForce {
+		if nonInteractive {
+			return errors.Errorf("%s already exists. Use --force to overwrite it.", file)
+		}
+		overwrite, err := promptConfirm(file+" already exists. Overwrite it?", "--force")
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return errors.Errorf("%s was not overwritten", file)
+		}
+	}
+	if dryrun {
+		planned(planWrite, file, "generated file")
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(file, contents, 0644); err != nil {
+		return err
+	}
+	Info.log("Generated ", file)
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var azureRegistryConnection string
+var azureKubernetesConnection string
+
+const azurePipelinesTemplate = `# Generated by appsody generate azure-pipelines
+# Needs a Docker Registry service connection named '[[.RegistryConnection]]' and a Kubernetes service connection
+# named '[[.KubernetesConnection]]' with access to the [[.Namespace]] namespace.
+trigger:
+  - master
+
+pool:
+  vmImage: ubuntu-latest
+
+variables:
+  APPSODY_VERSION: '[[.AppsodyVersion]]'
+  IMAGE: '[[.Image]]'
+  TAG: '$(Build.SourceVersion)'
+
+stages:
+  - stage: Test
+    jobs:
+      - job: Test
+        steps:
+          - script: |
+              curl -fsSL "https://github.com/appsody/appsody/releases/download/$(APPSODY_VERSION)/appsody-$(APPSODY_VERSION)-linux-amd64.tar" | sudo tar -xf - -C /usr/local/bin appsody
+            displayName: Install Appsody
+          - script: appsody test --non-interactive
+            displayName: appsody test
+
+  - stage: Build
+    dependsOn: Test
+    jobs:
+      - job: Build
+        steps:
+          - script: |
+              curl -fsSL "https://github.com/appsody/appsody/releases/download/$(APPSODY_VERSION)/appsody-$(APPSODY_VERSION)-linux-amd64.tar" | sudo tar -xf - -C /usr/local/bin appsody
+            displayName: Install Appsody
+          - task: Docker@2
+            displayName: Log in to the registry
+            inputs:
+              command: login
+              containerRegistry: '[[.RegistryConnection]]'
+          - script: |
+              appsody build --non-interactive --tag "$(IMAGE):$(TAG)" --metadata-file $(Build.ArtifactStagingDirectory)/build-metadata.json
+              docker push "$(IMAGE):$(TAG)"
+            displayName: appsody build
+          - publish: $(Build.ArtifactStagingDirectory)/build-metadata.json
+            artifact: build-metadata
+
+  - stage: Deploy
+    dependsOn: Build
+    condition: and(succeeded(), eq(variables['Build.SourceBranch'], 'refs/heads/master'))
+    jobs:
+      - deployment: Deploy
+        environment: '[[.Namespace]]'
+        strategy:
+          runOnce:
+            deploy:
+              steps:
+                - checkout: self
+                - script: |
+                    curl -fsSL "https://github.com/appsody/appsody/releases/download/$(APPSODY_VERSION)/appsody-$(APPSODY_VERSION)-linux-amd64.tar" | sudo tar -xf - -C /usr/local/bin appsody
+                  displayName: Install Appsody
+                - task: Docker@2
+                  displayName: Log in to the registry
+                  inputs:
+                    command: login
+                    containerRegistry: '[[.RegistryConnection]]'
+                - task: Kubernetes@1
+                  displayName: Log in to the cluster
+                  inputs:
+                    connectionType: Kubernetes Service Connection
+                    kubernetesServiceEndpoint: '[[.KubernetesConnection]]'
+                    command: login
+                - script: appsody deploy --non-interactive --tag "$(IMAGE):$(TAG)" --push --namespace [[.Namespace]]
+                  displayName: appsody deploy
+`
+
+// azurePipeline adds the service connection names to the common pipeline settings
+type azurePipeline struct {
+	*ciPipeline
+	RegistryConnection   string
+	KubernetesConnection string
+}
+
+var generateAzurePipelinesCmd = &cobra.Command{
+	Use:   "azure-pipelines",
+	Short: "Generate an Azure Pipelines pipeline for your project",
+	Long: `This generates azure-pipelines.yml with stages running 'appsody test', pushing the image built by 'appsody build'
+through a container registry service connection, and running 'appsody deploy' from the master branch.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pipeline, err := newCIPipeline(cmd)
+		if err != nil {
+			return err
+		}
+		contents, err := renderTemplate(azurePipelinesTemplate, azurePipeline{pipeline, azureRegistryConnection, azureKubernetesConnection})
+		if err != nil {
+			return err
+		}
+		return writeGeneratedFile("azure-pipelines.yml", []byte(contents))
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(generateAzurePipelinesCmd)
+	addCIFlags(generateAzurePipelinesCmd, "myregistry.azurecr.io/[[.Project]]")
+	generateAzurePipelinesCmd.PersistentFlags().StringVar(&azureRegistryConnection, "registry-connection", "registry", "Name of the Docker Registry service connection.")
+	generateAzurePipelinesCmd.PersistentFlags().StringVar(&azureKubernetesConnection, "kubernetes-connection", "kubernetes", "Name of the Kubernetes service connection.")
+}
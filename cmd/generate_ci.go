@@ -0,0 +1,154 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var ciImage string
+var ciDeployNamespace string
+var ciAppsodyVersion string
+
+// ciPipeline holds what the generated CI pipelines need to know about the project
+type ciPipeline struct {
+	Project        string
+	Image          string
+	Namespace      string
+	AppsodyVersion string
+}
+
+func addCIFlags(cmd *cobra.Command, defaultImage string) {
+	cmd.PersistentFlags().StringVar(&ciImage, "image", defaultImage, "Image repository the pipeline pushes to, without a tag. The tag is the commit id.")
+	cmd.PersistentFlags().StringVar(&ciDeployNamespace, "deploy-namespace", "default", "Kubernetes namespace the pipeline deploys to.")
+	cmd.PersistentFlags().StringVar(&ciAppsodyVersion, "appsody-version", "", "Release of the Appsody CLI the pipeline installs. Defaults to the version of this CLI.")
+}
+
+// newCIPipeline describes the project for the CI pipeline templates. The image default may refer to the project name.
+func newCIPipeline(cmd *cobra.Command) (*ciPipeline, error) {
+	projectName, err := getProjectName()
+	if err != nil {
+		return nil, err
+	}
+	version := ciAppsodyVersion
+	if version == "" {
+		version = VERSION
+	}
+	if version == "" || version == "vlatest" {
+		return nil, errors.New("This is a development build of the CLI, use --appsody-version to choose the release the pipeline installs")
+	}
+	// every generator has its own --image default but they share the variable, which holds the last one registered
+	image := ciImage
+	if flag := cmd.Flag("image"); flag != nil && !flag.Changed {
+		image = flag.DefValue
+	}
+	pipeline := &ciPipeline{Project: projectName, Namespace: ciDeployNamespace, AppsodyVersion: version}
+	pipeline.Image, err = renderTemplate(image, pipeline)
+	return pipeline, err
+}
+
+// renderTemplate renders a pipeline template. It uses [[ ]] delimiters since the pipeline syntaxes use {{ }} and ${{ }}.
+func renderTemplate(source string, pipeline interface{}) (string, error) {
+	tmpl, err := template.New("pipeline").Delims("[[", "]]").Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, pipeline); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// generateCIFile renders the pipeline template and writes it to the project
+func generateCIFile(cmd *cobra.Command, relPath string, source string) error {
+	pipeline, err := newCIPipeline(cmd)
+	if err != nil {
+		return err
+	}
+	contents, err := renderTemplate(source, pipeline)
+	if err != nil {
+		return err
+	}
+	return writeGeneratedFile(relPath, []byte(contents))
+}
+
+const gitlabCITemplate = `# Generated by appsody generate gitlab-ci
+# The build job pushes to the GitLab container registry of the project. The deploy job needs a
+# KUBECONFIG variable of type File, or a GitLab agent for Kubernetes, with access to the [[.Namespace]] namespace.
+variables:
+  APPSODY_VERSION: "[[.AppsodyVersion]]"
+  IMAGE: "[[.Image]]"
+  DOCKER_TLS_CERTDIR: ""
+
+stages:
+  - test
+  - build
+  - deploy
+
+default:
+  image: docker:stable
+  services:
+    - docker:dind
+  before_script:
+    - apk add --no-cache curl tar
+    - curl -fsSL "https://github.com/appsody/appsody/releases/download/${APPSODY_VERSION}/appsody-${APPSODY_VERSION}-linux-amd64.tar" | tar -xf - -C /usr/local/bin appsody
+
+test:
+  stage: test
+  script:
+    - appsody test --non-interactive
+
+build:
+  stage: build
+  script:
+    - docker login -u "$CI_REGISTRY_USER" -p "$CI_REGISTRY_PASSWORD" "$CI_REGISTRY"
+    - appsody build --non-interactive --tag "$IMAGE:$CI_COMMIT_SHORT_SHA" --metadata-file build-metadata.json
+    - docker push "$IMAGE:$CI_COMMIT_SHORT_SHA"
+  artifacts:
+    paths:
+      - build-metadata.json
+
+deploy:
+  stage: deploy
+  environment:
+    name: [[.Namespace]]
+  rules:
+    - if: $CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH
+  script:
+    - curl -fsSL -o /usr/local/bin/kubectl "https://dl.k8s.io/release/$(curl -fsSL https://dl.k8s.io/release/stable.txt)/bin/linux/amd64/kubectl"
+    - chmod +x /usr/local/bin/kubectl
+    - docker login -u "$CI_REGISTRY_USER" -p "$CI_REGISTRY_PASSWORD" "$CI_REGISTRY"
+    - appsody deploy --non-interactive --tag "$IMAGE:$CI_COMMIT_SHORT_SHA" --push --namespace [[.Namespace]]
+`
+
+var generateGitlabCICmd = &cobra.Command{
+	Use:   "gitlab-ci",
+	Short: "Generate a GitLab CI pipeline for your project",
+	Long: `This generates .gitlab-ci.yml with a test stage running 'appsody test', a build stage pushing the image built by
+'appsody build' to the project's GitLab container registry, and a deploy stage running 'appsody deploy' from the default branch.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return generateCIFile(cmd, ".gitlab-ci.yml", gitlabCITemplate)
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(generateGitlabCICmd)
+	addCIFlags(generateGitlabCICmd, "$CI_REGISTRY_IMAGE")
+}
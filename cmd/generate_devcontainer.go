@@ -0,0 +1,147 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// devContainer is the subset of the VS Code devcontainer.json format appsody generates
+type devContainer struct {
+	Name            string   `json:"name"`
+	Image           string   `json:"image"`
+	WorkspaceFolder string   `json:"workspaceFolder,omitempty"`
+	WorkspaceMount  string   `json:"workspaceMount,omitempty"`
+	Mounts          []string `json:"mounts,omitempty"`
+	ForwardPorts    []int    `json:"forwardPorts,omitempty"`
+	Extensions      []string `json:"extensions,omitempty"`
+	OverrideCommand bool     `json:"overrideCommand"`
+}
+
+var generateDevcontainerCmd = &cobra.Command{
+	Use:   "devcontainer",
+	Short: "Generate a VS Code devcontainer.json for your project",
+	Long: `This generates .devcontainer/devcontainer.json, which lets VS Code Remote - Containers and GitHub Codespaces
+develop your project inside the stack image, with the same mounts and ports as 'appsody run'. VS Code extensions
+recommended by the stack (APPSODY_VSCODE_EXTENSIONS) are installed in the container.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectName, err := getProjectName()
+		if err != nil {
+			return err
+		}
+		projectConfig, err := readProjectConfig()
+		if err != nil {
+			return err
+		}
+		config := devContainer{Name: projectName, Image: projectConfig.Platform, OverrideCommand: true}
+
+		projectDir, err := getProjectDir()
+		if err != nil {
+			return err
+		}
+		stackMounts, err := getEnvVar("APPSODY_MOUNTS")
+		if err != nil {
+			return err
+		}
+		for _, spec := range strings.Split(stackMounts, ";") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			mount, err := parseStackMount(strings.TrimSpace(spec), projectName, projectDir)
+			if err != nil {
+				return err
+			}
+			readonly := ""
+			for _, option := range mount.Options {
+				if option == "ro" {
+					readonly = ",readonly"
+				}
+			}
+			switch mount.Kind {
+			case mountTmpfs:
+				config.Mounts = append(config.Mounts, fmt.Sprintf("target=%s,type=tmpfs", mount.Target))
+				continue
+			case mountVolume:
+				config.Mounts = append(config.Mounts, fmt.Sprintf("source=%s,target=%s,type=volume%s", mount.Source, mount.Target, readonly))
+				continue
+			}
+			local, target := mount.Source, mount.Target
+			if strings.Trim(local, "/.") == "" {
+				// the project itself is the workspace
+				config.WorkspaceFolder = target
+				config.WorkspaceMount = fmt.Sprintf("source=${localWorkspaceFolder},target=%s,type=bind", target)
+				continue
+			}
+			if strings.HasPrefix(local, "~") {
+				local = "${localEnv:HOME}" + strings.TrimPrefix(local, "~")
+			} else if !filepath.IsAbs(local) {
+				local = "${localWorkspaceFolder}/" + strings.TrimPrefix(filepath.ToSlash(local), "/")
+			}
+			config.Mounts = append(config.Mounts, fmt.Sprintf("source=%s,target=%s,type=bind%s", local, target, readonly))
+		}
+		deps, err := getEnvVar("APPSODY_DEPS")
+		if err != nil {
+			return err
+		}
+		if deps != "" {
+			config.Mounts = append(config.Mounts, fmt.Sprintf("source=%s-deps,target=%s,type=volume", projectName, deps))
+		}
+
+		ports, err := getExposedPorts()
+		if err != nil {
+			return err
+		}
+		port, err := getEnvVar("PORT")
+		if err != nil {
+			return err
+		}
+		if port != "" {
+			ports = append(ports, port)
+		}
+		seen := make(map[int]bool)
+		for _, p := range ports {
+			var port int
+			if _, err := fmt.Sscanf(p, "%d", &port); err == nil && !seen[port] {
+				seen[port] = true
+				config.ForwardPorts = append(config.ForwardPorts, port)
+			}
+		}
+
+		extensions, err := getEnvVar("APPSODY_VSCODE_EXTENSIONS")
+		if err != nil {
+			return err
+		}
+		for _, extension := range strings.Split(extensions, ";") {
+			if extension = strings.TrimSpace(extension); extension != "" {
+				config.Extensions = append(config.Extensions, extension)
+			}
+		}
+
+		contents, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeGeneratedFile(filepath.Join(".devcontainer", "devcontainer.json"), append(contents, '\n'))
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(generateDevcontainerCmd)
+}
@@ -0,0 +1,111 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var jenkinsRegistryCredentials string
+var jenkinsKubeconfigCredentials string
+
+// jenkinsfileTemplate is a declarative pipeline binding the registry and kubeconfig from Jenkins credentials
+const jenkinsfileTemplate = `// Generated by appsody generate jenkinsfile
+// Needs the Docker Pipeline plugin, a '[[.RegistryCredentials]]' username/password credential for the registry
+// and a '[[.KubeconfigCredentials]]' secret file credential with a kubeconfig for the [[.Namespace]] namespace.
+pipeline {
+  agent {
+    docker {
+      image 'docker:stable'
+      args '-v /var/run/docker.sock:/var/run/docker.sock -u root'
+    }
+  }
+  environment {
+    APPSODY_VERSION = '[[.AppsodyVersion]]'
+    IMAGE = '[[.Image]]'
+    TAG = "${env.GIT_COMMIT.take(8)}"
+  }
+  stages {
+    stage('Setup') {
+      steps {
+        sh 'apk add --no-cache curl tar'
+        sh 'curl -fsSL "https://github.com/appsody/appsody/releases/download/${APPSODY_VERSION}/appsody-${APPSODY_VERSION}-linux-amd64.tar" | tar -xf - -C /usr/local/bin appsody'
+        sh 'curl -fsSL -o /usr/local/bin/kubectl "https://dl.k8s.io/release/$(curl -fsSL https://dl.k8s.io/release/stable.txt)/bin/linux/amd64/kubectl" && chmod +x /usr/local/bin/kubectl'
+      }
+    }
+    stage('Test') {
+      steps {
+        sh 'appsody test --non-interactive'
+      }
+    }
+    stage('Build') {
+      steps {
+        withCredentials([usernamePassword(credentialsId: '[[.RegistryCredentials]]', usernameVariable: 'REGISTRY_USER', passwordVariable: 'REGISTRY_PASSWORD')]) {
+          sh 'echo "$REGISTRY_PASSWORD" | docker login -u "$REGISTRY_USER" --password-stdin "${IMAGE%%/*}"'
+          sh 'appsody build --non-interactive --tag "$IMAGE:$TAG" --metadata-file build-metadata.json'
+          sh 'docker push "$IMAGE:$TAG"'
+        }
+        archiveArtifacts artifacts: 'build-metadata.json'
+      }
+    }
+    stage('Deploy') {
+      when {
+        branch 'master'
+      }
+      steps {
+        withCredentials([
+          usernamePassword(credentialsId: '[[.RegistryCredentials]]', usernameVariable: 'REGISTRY_USER', passwordVariable: 'REGISTRY_PASSWORD'),
+          file(credentialsId: '[[.KubeconfigCredentials]]', variable: 'KUBECONFIG')
+        ]) {
+          sh 'echo "$REGISTRY_PASSWORD" | docker login -u "$REGISTRY_USER" --password-stdin "${IMAGE%%/*}"'
+          sh 'appsody deploy --non-interactive --tag "$IMAGE:$TAG" --push --namespace [[.Namespace]]'
+        }
+      }
+    }
+  }
+}
+`
+
+// jenkinsPipeline adds the credentials ids to the common pipeline settings
+type jenkinsPipeline struct {
+	*ciPipeline
+	RegistryCredentials   string
+	KubeconfigCredentials string
+}
+
+var generateJenkinsfileCmd = &cobra.Command{
+	Use:   "jenkinsfile",
+	Short: "Generate a Jenkins declarative pipeline for your project",
+	Long: `This generates a Jenkinsfile that runs 'appsody test', pushes the image built by 'appsody build' to a registry, and
+runs 'appsody deploy' from the master branch. The registry and kubeconfig are bound from Jenkins credentials.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pipeline, err := newCIPipeline(cmd)
+		if err != nil {
+			return err
+		}
+		contents, err := renderTemplate(jenkinsfileTemplate, jenkinsPipeline{pipeline, jenkinsRegistryCredentials, jenkinsKubeconfigCredentials})
+		if err != nil {
+			return err
+		}
+		return writeGeneratedFile("Jenkinsfile", []byte(contents))
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(generateJenkinsfileCmd)
+	addCIFlags(generateJenkinsfileCmd, "registry.example.com/[[.Project]]")
+	generateJenkinsfileCmd.PersistentFlags().StringVar(&jenkinsRegistryCredentials, "registry-credentials", "registry", "Id of the Jenkins username/password credential for the registry.")
+	generateJenkinsfileCmd.PersistentFlags().StringVar(&jenkinsKubeconfigCredentials, "kubeconfig-credentials", "kubeconfig", "Id of the Jenkins secret file credential holding the kubeconfig.")
+}
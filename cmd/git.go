@@ -0,0 +1,71 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gitMetadata describes the state of the git checkout the project lives in
+type gitMetadata struct {
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	Dirty  bool   `json:"dirty"`
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	gitCmd := exec.Command("git", args...)
+	gitCmd.Dir = dir
+	out, err := gitCmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// getGitMetadata returns the branch, commit and dirty state of the project, or nil when
+// the project is not in a git repository or git is not installed
+func getGitMetadata(dir string) *gitMetadata {
+	commit, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		Debug.log("No git metadata for the project: ", err)
+		return nil
+	}
+	// a detached HEAD reports HEAD as the branch
+	branch, _ := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	status, _ := gitOutput(dir, "status", "--porcelain")
+	return &gitMetadata{Branch: branch, Commit: commit, Dirty: status != ""}
+}
+
+// env returns the APPSODY_GIT_* variables passed to the development container
+func (g *gitMetadata) env() []string {
+	return []string{
+		"APPSODY_GIT_BRANCH=" + g.Branch,
+		"APPSODY_GIT_COMMIT=" + g.Commit,
+		"APPSODY_GIT_DIRTY=" + strconv.FormatBool(g.Dirty),
+	}
+}
+
+// dockerArgs returns the docker run arguments that set the git variables and labels on the container
+func (g *gitMetadata) dockerArgs() []string {
+	var args []string
+	for _, env := range g.env() {
+		args = append(args, "-e", env)
+	}
+	args = append(args,
+		"--label", "dev.appsody.git.branch="+g.Branch,
+		"--label", "dev.appsody.git.commit="+g.Commit,
+		"--label", "dev.appsody.git.dirty="+strconv.FormatBool(g.Dirty))
+	return args
+}
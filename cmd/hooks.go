@@ -0,0 +1,154 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var noHooks bool
+
+// The lifecycle events hooks can be attached to
+const (
+	hookPreRun     = "pre-run"
+	hookPostBuild  = "post-build"
+	hookPreDeploy  = "pre-deploy"
+	hookPostDeploy = "post-deploy"
+)
+
+var hookEvents = []string{hookPreRun, hookPostBuild, hookPreDeploy, hookPostDeploy}
+
+// ProjectHook is a command run at a point of the project lifecycle. Hooks are declared in the hooks
+// section of .appsody-config.yaml, either as a plain command or with options:
+//
+//   hooks:
+//     pre-run:
+//     - npm run lint
+//     post-deploy:
+//     - command: ./notify.sh
+//       continueOnError: true
+//
+// A failing hook fails the command, a pre hook before anything is done. With continueOnError the
+// failure is only a warning.
+type ProjectHook struct {
+	Command         string `yaml:"command"`
+	ContinueOnError bool   `yaml:"continueOnError,omitempty"`
+}
+
+// UnmarshalYAML accepts a plain command as well as the full hook
+func (h *ProjectHook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		h.Command = command
+		return nil
+	}
+	type plainHook ProjectHook
+	return unmarshal((*plainHook)(h))
+}
+
+// hookShell returns the shell and its option to run a hook command
+func hookShell() (string, string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", "/C"
+	}
+	return "sh", "-c"
+}
+
+// hookEnv describes the project to the hooks
+func hookEnv(event string, command string, image string, stack string) []string {
+	projectDir, _ := getProjectDir()
+	projectName, _ := getProjectName()
+	env := append(os.Environ(),
+		"APPSODY_HOOK="+event,
+		"APPSODY_COMMAND="+command,
+		"APPSODY_PROJECT_NAME="+projectName,
+		"APPSODY_PROJECT_PATH="+projectDir,
+		"APPSODY_STACK="+stack)
+	if image != "" {
+		env = append(env, "APPSODY_IMAGE="+image)
+	}
+	if git := getGitMetadata(projectDir); git != nil {
+		env = append(env, git.env()...)
+	}
+	return env
+}
+
+// runHooks runs the hooks of the event in the project directory, in the order they are declared.
+// command is the appsody command being run and image the image built or deployed, if any.
+func runHooks(event string, command string, image string) error {
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	hooks := config.Hooks[event]
+	if len(hooks) == 0 {
+		return nil
+	}
+	if noHooks {
+		Info.logf("Skipping the %s hooks, --no-hooks is set", event)
+		return nil
+	}
+	defer startPhase(event)()
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return err
+	}
+	env := hookEnv(event, command, image, config.Platform)
+	shell, shellOption := hookShell()
+	// standard output carries the events with --json-events
+	var output io.Writer = os.Stdout
+	if jsonEvents {
+		output = os.Stderr
+	}
+	for _, hook := range hooks {
+		if dryrun {
+			planned(planRunCommand, hook.Command, event+" hook")
+			continue
+		}
+		Info.logf("Running %s hook: %s", event, hook.Command)
+		hookCmd := exec.Command(shell, shellOption, hook.Command)
+		hookCmd.Dir = projectDir
+		hookCmd.Env = env
+		hookCmd.Stdout = output
+		hookCmd.Stderr = os.Stderr
+		if err = hookCmd.Run(); err != nil {
+			if hook.ContinueOnError {
+				Warning.logf("The %s hook %q failed, continuing: %v", event, hook.Command, err)
+				continue
+			}
+			return errors.Errorf("The %s hook %q failed: %v. Use --no-hooks to skip the hooks.", event, hook.Command, err)
+		}
+	}
+	return nil
+}
+
+// checkHooks warns about hooks attached to events that do not exist, which would never run
+func checkHooks(config ProjectConfig) {
+	for event := range config.Hooks {
+		known := false
+		for _, hookEvent := range hookEvents {
+			known = known || event == hookEvent
+		}
+		if !known {
+			Warning.logf("The %s hooks in %s never run, hooks can be attached to %s", event, ConfigFile, strings.Join(hookEvents, ", "))
+		}
+	}
+}
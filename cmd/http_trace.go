@@ -0,0 +1,91 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceHTTP logs every request the CLI makes and its response. kubectl is run with -v=7, which
+// logs its requests to the Kubernetes API the same way. Images are pulled and pushed by the docker
+// daemon, so its requests are not traced.
+var traceHTTP bool
+
+// secretHeader matches the headers whose values are not traced
+var secretHeader = regexp.MustCompile(`(?i)(authorization|cookie|token|secret|password|api-?key)`)
+
+// tracingTransport logs the requests and responses going through the transport it wraps.
+// A request to a URL already requested is logged as a retry.
+type tracingTransport struct {
+	base     http.RoundTripper
+	lock     sync.Mutex
+	attempts map[string]int
+}
+
+// traceTransport wraps the transport with the tracing of --trace-http
+func traceTransport(base http.RoundTripper) http.RoundTripper {
+	if !traceHTTP {
+		return base
+	}
+	return &tracingTransport{base: base, attempts: map[string]int{}}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+	t.lock.Lock()
+	t.attempts[key]++
+	attempt := t.attempts[key]
+	t.lock.Unlock()
+	if attempt > 1 {
+		HTTPTrace.logf("--> %s (retry %d)", key, attempt-1)
+	} else {
+		HTTPTrace.logf("--> %s", key)
+	}
+	traceHeaders("-->", req.Header)
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(started).Round(time.Millisecond)
+	if err != nil {
+		HTTPTrace.logf("<-- %s failed after %s: %v", key, elapsed, err)
+		return resp, err
+	}
+	HTTPTrace.logf("<-- %s %s (%s)", resp.Status, req.URL, elapsed)
+	traceHeaders("<--", resp.Header)
+	return resp, nil
+}
+
+func traceHeaders(direction string, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(headers[name], ", ")
+		if secretHeader.MatchString(name) {
+			value = redacted
+		}
+		HTTPTrace.logf("%s %s: %s", direction, name, value)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&traceHTTP, "trace-http", false, "Log the HTTP requests to repositories, registries and the Kubernetes API, with their headers and timings. Credentials are redacted.")
+}
@@ -0,0 +1,154 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+)
+
+// scanImage is the --scan option of build, to scan the built image for known vulnerabilities with trivy.
+// scanReportFile is where the vulnerabilities found are written, as SARIF.
+var scanImage bool
+var scanReportFile string
+
+// trivyReport is the part of the JSON report of trivy image that appsody reads
+type trivyReport struct {
+	Results []trivyResult `json:"Results"`
+}
+
+type trivyResult struct {
+	Target          string               `json:"Target"`
+	Vulnerabilities []trivyVulnerability `json:"Vulnerabilities"`
+}
+
+type trivyVulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+}
+
+// trivySeverities are the severities of trivy, the most severe first
+var trivySeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+func checkTrivy() error {
+	if _, err := exec.LookPath("trivy"); err != nil && !dryrun {
+		return errors.New("trivy is required to scan images, see https://github.com/aquasecurity/trivy")
+	}
+	return nil
+}
+
+// scanBuiltImage scans an image for the known vulnerabilities of its packages with trivy, shows how many it has
+// of each severity, and writes them to the SARIF report file of --scan-report. They are reported on the
+// .appsody-config.yaml of the project, which names the stack the image is built on.
+func scanBuiltImage(image string, projectDir string) error {
+	if err := checkTrivy(); err != nil {
+		return err
+	}
+	args := []string{"image", "--quiet", "--format", "json", image}
+	if dryrun {
+		plannedCommand("trivy", args)
+		if scanReportFile != "" {
+			planned(planWrite, scanReportFile, "vulnerability report")
+		}
+		return nil
+	}
+	Info.log("Scanning the image ", image, " for vulnerabilities")
+	showCommand(commandLine("trivy", args))
+	output, err := exec.CommandContext(cliContext(), "trivy", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return errors.Errorf("Could not scan the image %s: %v", image, err)
+	}
+	var report trivyReport
+	if err = json.Unmarshal(output, &report); err != nil {
+		return errors.Errorf("Could not read the report of trivy: %v", err)
+	}
+	counts := map[string]int{}
+	total := 0
+	for _, result := range report.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			counts[strings.ToUpper(vulnerability.Severity)]++
+			total++
+		}
+	}
+	if total == 0 {
+		Info.log("No known vulnerabilities were found in ", image)
+	} else {
+		table := uitable.New()
+		table.AddRow("SEVERITY", "VULNERABILITIES")
+		for _, severity := range trivySeverities {
+			if counts[severity] > 0 {
+				table.AddRow(severity, counts[severity])
+			}
+		}
+		Warning.logf("%d known vulnerabilities were found in %s:\n%s", total, image, table)
+	}
+	if scanReportFile == "" {
+		return nil
+	}
+	if err = writeSARIF(scanSARIF(image, report, filepath.Join(projectDir, ConfigFile)), scanReportFile); err != nil {
+		return errors.Errorf("Could not write the vulnerability report: %v", err)
+	}
+	Info.log("Vulnerability report written to ", scanReportFile)
+	return nil
+}
+
+// scanSARIF reports the vulnerabilities of an image as SARIF results on a file of the project, with a rule for
+// each vulnerability. The critical and high ones are errors, the medium ones warnings and the others notes.
+func scanSARIF(image string, report trivyReport, file string) sarifReport {
+	var rules []sarifRule
+	var results []sarifResult
+	described := map[string]bool{}
+	for _, result := range report.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			id := vulnerability.VulnerabilityID
+			if !described[id] {
+				described[id] = true
+				description := vulnerability.Title
+				if description == "" {
+					description = id
+				}
+				rules = append(rules, sarifRule{id, sarifMessage{description}})
+			}
+			level := sarifNote
+			switch strings.ToUpper(vulnerability.Severity) {
+			case "CRITICAL", "HIGH":
+				level = sarifError
+			case "MEDIUM":
+				level = sarifWarning
+			}
+			message := fmt.Sprintf("%s %s in %s of the image %s has the %s vulnerability %s", vulnerability.PkgName, vulnerability.InstalledVersion, result.Target, image, strings.ToLower(vulnerability.Severity), id)
+			if vulnerability.FixedVersion != "" {
+				message += ", fixed in " + vulnerability.FixedVersion
+			}
+			results = append(results, newSARIFResult(id, level, message, file))
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return newSARIFReport("build --scan", rules, results)
+}
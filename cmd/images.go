@@ -0,0 +1,259 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// stackVersionLabel is the label of the stack images with their version
+const stackVersionLabel = "dev.appsody.stack.version"
+
+var pruneKeep int
+
+// localImage is an application or stack image of the docker engine
+type localImage struct {
+	ID          string
+	Tags        []string
+	Digests     []string
+	Project     string
+	Created     time.Time
+	Size        int64
+	Repository  string
+	StackImage  bool
+	pruneReason string
+}
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage the application and stack images Appsody keeps on the docker engine",
+}
+
+var imagesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old application images and unused stack images",
+	Long: `This removes the images that accumulate on the docker engine:
+
+- the application images appsody build made, except the --keep most recent ones of each project
+- the stack images no project of your workspaces pins, except the most recent one of each stack
+
+The projects are searched in the directories given with --root, or the workspaces of the CLI configuration. Images
+used by a container are kept. Use --dry-run to list the images without removing them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneKeep < 0 {
+			return errors.New("--keep can not be negative")
+		}
+		images, err := listLocalImages()
+		if err != nil {
+			return err
+		}
+		projects, err := findWorkspaceProjects(workspaceRoots())
+		if err != nil {
+			return err
+		}
+		var pinned []ProjectConfig
+		for _, project := range projects {
+			if config, err := loadProjectConfig(project.Dir); err == nil {
+				pinned = append(pinned, config)
+			}
+		}
+		used, err := imagesInUse()
+		if err != nil {
+			return err
+		}
+		prunable := prunableImages(images, pinned, used, pruneKeep)
+		if len(prunable) == 0 {
+			Info.log("There are no images to prune")
+			return nil
+		}
+		table := uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("IMAGE", "SIZE", "CREATED", "REASON")
+		var reclaimed int64
+		for _, image := range prunable {
+			table.AddRow(image.name(), formatSize(image.Size), image.Created.Format("2006-01-02"), image.pruneReason)
+			reclaimed += image.Size
+		}
+		Info.log(table.String())
+		failed := 0
+		for _, image := range prunable {
+			if err := execAndWaitReturnErr("docker", []string{"image", "rm", "-f", image.ID}, Debug); err != nil {
+				Warning.logf("Could not remove %s: %v", image.name(), err)
+				failed++
+				reclaimed -= image.Size
+			}
+		}
+		if dryrun {
+			Info.logf("Pruning would reclaim %s", formatSize(reclaimed))
+			return nil
+		}
+		Info.logf("Reclaimed %s", formatSize(reclaimed))
+		if failed > 0 {
+			return errors.Errorf("%d of the images could not be removed", failed)
+		}
+		return nil
+	},
+}
+
+func (image localImage) name() string {
+	if len(image.Tags) > 0 {
+		return strings.Join(image.Tags, ", ")
+	}
+	return image.ID
+}
+
+// listLocalImages lists the images built by appsody build and the stack images
+func listLocalImages() ([]localImage, error) {
+	var ids []string
+	for _, label := range []string{devProjectLabel, stackVersionLabel} {
+		out, err := runtimeCommand("docker", "image", "ls", "-q", "--no-trunc", "--filter", "label="+label).Output()
+		if err != nil {
+			return nil, errors.Errorf("Could not list the images of the docker engine: %v", err)
+		}
+		ids = append(ids, strings.Fields(string(out))...)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	format := `{{.Id}}|{{index .Config.Labels "` + devProjectLabel + `"}}|{{index .Config.Labels "` + stackVersionLabel + `"}}|{{.Created}}|{{.Size}}|{{join .RepoTags ","}}|{{join .RepoDigests ","}}`
+	out, err := runtimeCommand("docker", append([]string{"image", "inspect", "--format", format}, ids...)...).Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not inspect the images: %v", err)
+	}
+	var images []localImage
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 7 || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		image := localImage{ID: fields[0], Project: fields[1], StackImage: fields[1] == "" && fields[2] != ""}
+		image.Created, _ = time.Parse(time.RFC3339Nano, fields[3])
+		image.Size, _ = strconv.ParseInt(fields[4], 10, 64)
+		if fields[5] != "" {
+			image.Tags = strings.Split(fields[5], ",")
+		}
+		if fields[6] != "" {
+			image.Digests = strings.Split(fields[6], ",")
+		}
+		image.Repository = imageRepository(image)
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// imageRepository returns the repository of an image without its tag or digest
+func imageRepository(image localImage) string {
+	for _, name := range append(append([]string{}, image.Tags...), image.Digests...) {
+		if i := strings.Index(name, "@"); i >= 0 {
+			return name[:i]
+		}
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			return name[:i]
+		}
+		return name
+	}
+	return ""
+}
+
+// imagesInUse returns the IDs of the images of the containers, running or not
+func imagesInUse() (map[string]bool, error) {
+	out, err := runtimeCommand("docker", "ps", "-a", "-q").Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not list the containers: %v", err)
+	}
+	used := map[string]bool{}
+	containers := strings.Fields(string(out))
+	if len(containers) == 0 {
+		return used, nil
+	}
+	out, err = runtimeCommand("docker", append([]string{"inspect", "--format", "{{.Image}}"}, containers...)...).Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not inspect the containers: %v", err)
+	}
+	for _, id := range strings.Fields(string(out)) {
+		used[id] = true
+	}
+	return used, nil
+}
+
+// prunableImages returns the images to remove: the application images older than the keep most recent of
+// their project, and the stack images no project pins that are not the most recent of their stack
+func prunableImages(images []localImage, projects []ProjectConfig, used map[string]bool, keep int) []localImage {
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Created.After(images[j].Created) })
+	kept := map[string]int{}
+	var prunable []localImage
+	for _, image := range images {
+		if used[image.ID] {
+			continue
+		}
+		if !image.StackImage {
+			kept[image.Project]++
+			if kept[image.Project] > keep {
+				image.pruneReason = fmt.Sprintf("not one of the %d most recent builds of %s", keep, image.Project)
+				prunable = append(prunable, image)
+			}
+			continue
+		}
+		if stackImagePinned(image, projects) {
+			continue
+		}
+		// the most recent image of each stack is kept for the next project created with it
+		kept["stack:"+image.Repository]++
+		if kept["stack:"+image.Repository] > 1 {
+			image.pruneReason = "no project uses this stack version"
+			prunable = append(prunable, image)
+		}
+	}
+	return prunable
+}
+
+// stackImagePinned tells whether a project uses the stack image, by its tag or the digest it pins
+func stackImagePinned(image localImage, projects []ProjectConfig) bool {
+	for _, project := range projects {
+		for _, tag := range image.Tags {
+			if tag == project.Platform || strings.TrimPrefix(tag, "docker.io/") == project.Platform {
+				return true
+			}
+		}
+		if project.StackDigest == "" {
+			continue
+		}
+		for _, digest := range image.Digests {
+			if strings.HasSuffix(digest, "@"+project.StackDigest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(imagesCmd)
+	imagesCmd.AddCommand(imagesPruneCmd)
+	imagesPruneCmd.PersistentFlags().IntVar(&pruneKeep, "keep", 2, "Number of the most recent application images of each project to keep.")
+	imagesPruneCmd.PersistentFlags().StringArrayVar(&projectRoots, "root", nil, "Directory to search for the projects pinning stack images, instead of the workspaces of the CLI configuration. Can be repeated.")
+	imagesPruneCmd.PersistentFlags().IntVar(&projectsMaxDepth, "max-depth", 4, "How many directories deep to search for projects.")
+	imagesPruneCmd.PersistentFlags().BoolVar(&dryrun, "dry-run", false, "List the images that would be removed, without removing them.")
+}
@@ -0,0 +1,241 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// defaultIndexCacheTTL is how long a cached repository index is used before it is downloaded again, unless
+// indexCacheTTL is set in the CLI configuration
+const defaultIndexCacheTTL = 10 * time.Minute
+
+// refreshIndexes is the --refresh option of list, to download the indexes even when their cache is fresh
+var refreshIndexes bool
+
+// maxStale is the --max-stale option, how old a cached index or template may be when it is used because its
+// repository can not be reached. 0 accepts any age.
+var maxStale time.Duration
+
+// offlineIndexes are the repositories whose cached index is used because they could not be reached, with when
+// it was cached
+var offlineIndexes = struct {
+	sync.Mutex
+	asOf map[string]time.Time
+}{asOf: map[string]time.Time{}}
+
+// checkMaxStale fails when the cache of what is older than --max-stale allows
+func checkMaxStale(what string, age time.Duration) error {
+	if maxStale > 0 && age > maxStale {
+		return errors.Errorf("The cached %s is %s old, more than the %s --max-stale allows", what, age.Round(time.Second), maxStale)
+	}
+	return nil
+}
+
+// offlineAnnotation is how list and info show that they use a cache from asOf
+func offlineAnnotation(asOf time.Time) string {
+	return "as of " + asOf.Local().Format("2006-01-02 15:04 MST") + " (offline)"
+}
+
+// offlineIndexAsOf returns when the index of the repository was cached, when its cache is used because the
+// repository could not be reached
+func offlineIndexAsOf(repoName string) (time.Time, bool) {
+	offlineIndexes.Lock()
+	defer offlineIndexes.Unlock()
+	asOf, ok := offlineIndexes.asOf[repoName]
+	return asOf, ok
+}
+
+// logOffline tells which repositories of the index are listed from a cache, and as of when
+func (index *RepoIndex) logOffline() {
+	var names []string
+	for name := range index.Offline {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		Warning.logf("The stacks of the %s repository are %s", name, offlineAnnotation(index.Offline[name]))
+	}
+}
+
+// readStaleIndex returns the cached index of a repository that can not be reached, within --max-stale
+func readStaleIndex(repoName string, age time.Duration) (*RepoIndex, error) {
+	if err := checkMaxStale("index of the "+repoName+" repository", age); err != nil {
+		return nil, err
+	}
+	index, err := readCachedIndex(repoName)
+	if err != nil || index == nil {
+		return nil, err
+	}
+	offlineIndexes.Lock()
+	offlineIndexes.asOf[repoName] = time.Now().Add(-age)
+	offlineIndexes.Unlock()
+	return index, nil
+}
+
+// indexCacheTTL returns how long a cached index is fresh. 0 disables the cache, the indexes are then always
+// downloaded and the cache is only used when a repository can not be reached.
+func indexCacheTTL() time.Duration {
+	configured := cliConfig.GetString("indexCacheTTL")
+	if configured == "" {
+		return defaultIndexCacheTTL
+	}
+	ttl, err := time.ParseDuration(configured)
+	if err != nil || ttl < 0 {
+		Warning.logf("The indexCacheTTL %q of the configuration is not a duration such as 10m, using %s", configured, defaultIndexCacheTTL)
+		return defaultIndexCacheTTL
+	}
+	return ttl
+}
+
+// cachedIndexAge returns how long ago the index of the repository was cached, and false when it was not
+func cachedIndexAge(repoName string) (time.Duration, bool) {
+	info, err := os.Stat(cachedIndexFile(repoName))
+	if err != nil {
+		return 0, false
+	}
+	return time.Since(info.ModTime()), true
+}
+
+// readIndex returns the index of the repository from its cache while it is fresh, and downloads and caches it
+// otherwise. The cache is stale once the repositories are changed, as the repository may have another URL. When
+// the repository can not be reached, or in offline mode, the cached index is used unless it is older than
+// --max-stale. An index that can be downloaded but fails its verification is an error.
+func (r *RepositoryEntry) readIndex() (*RepoIndex, error) {
+	age, cached := cachedIndexAge(r.Name)
+	fresh := false
+	if cached && !refreshIndexes {
+		fresh = age < indexCacheTTL()
+		if repoFile, err := os.Stat(getRepoFileLocation()); err == nil && time.Since(repoFile.ModTime()) < age {
+			fresh = false
+		}
+	}
+	if cached && fresh {
+		index, err := readCachedIndex(r.Name)
+		if err == nil && index != nil {
+			Debug.logw("Using the cached index", "repo", r.Name, "age", age.Round(time.Second))
+			r.ownShards(index)
+			return index, nil
+		}
+		Debug.logw("Could not read the cached index", "repo", r.Name, "error", err)
+	}
+	if cached && offlineMode() {
+		index, err := readStaleIndex(r.Name, age)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil {
+			Debug.logw("Using the cached index in offline mode", "repo", r.Name, "age", age.Round(time.Second))
+			r.ownShards(index)
+			return index, nil
+		}
+	}
+	index, err := r.downloadIndex()
+	if err != nil {
+		// an interrupted or timed out command stops rather than going on with the cache, and so does an index
+		// that fails its verification, such as its signature or digest
+		if !cached || cliContext().Err() != nil || !isTransferError(err) {
+			return nil, err
+		}
+		stale, cacheErr := readStaleIndex(r.Name, age)
+		if cacheErr != nil || stale == nil {
+			if cacheErr != nil {
+				Warning.log(cacheErr)
+			}
+			return nil, err
+		}
+		Warning.logf("Could not download the index of the %s repository, using the one cached %s ago: %v", r.Name, age.Round(time.Minute), err)
+		r.ownShards(stale)
+		return stale, nil
+	}
+	// the shards are loaded on demand, so a sharded index is only cached by repo diff --update. An index read
+	// without its signature is not cached, so that it is not used once the signature is verified again.
+	if !dryrun && len(index.Shards) == 0 && (r.PublicKey == "" || !skipIndexVerify) {
+		if err = cacheIndex(r.Name, index); err != nil {
+			Debug.logw("Could not cache the index", "repo", r.Name, "error", err)
+		}
+	}
+	return index, nil
+}
+
+var repoRefreshCmd = &cobra.Command{
+	Use:   "refresh [name]",
+	Short: "Download the index of the repositories again",
+	Long: `This downloads the index of a repository, or of every repository without a name, and caches it.
+
+appsody list, init and the other commands read the cached index of a repository while it is fresh, for 10 minutes
+unless indexCacheTTL is set to another duration, such as 1h, in the CLI configuration. 0 always downloads the
+indexes. When a repository can not be reached, its cached index is used, so the stacks can be listed and
+initialized offline. list and info then show the stacks "as of" when the index was cached. --max-stale, such as
+--max-stale 72h, refuses the cached indexes and templates older than that. Use appsody list --refresh to list the
+stacks of the latest indexes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("Specify at most one repository, such as appsody repo refresh incubator")
+		}
+		var repos RepositoryFile
+		if _, err := repos.getRepos(); err != nil {
+			return err
+		}
+		entries := repos.Repositories
+		if len(args) == 1 {
+			entries = nil
+			for _, entry := range repos.Repositories {
+				if entry.Name == args[0] {
+					entries = append(entries, entry)
+				}
+			}
+			if len(entries) == 0 {
+				return errors.Errorf("There is no %s repository.%s Run `appsody repo list` to see the repositories.", args[0], didYouMean(args[0], repos.repoNames()))
+			}
+		}
+		failed := 0
+		for _, entry := range entries {
+			index, err := entry.downloadIndex()
+			if err != nil {
+				Error.logf("Could not download the index of the %s repository: %v", entry.Name, err)
+				failed++
+				continue
+			}
+			if dryrun {
+				planned(planWrite, cachedIndexFile(entry.Name), "the index of the "+entry.Name+" repository")
+				continue
+			}
+			if len(index.Shards) > 0 {
+				Info.logf("The index of the %s repository is sharded, its shards are downloaded when they are read", entry.Name)
+				continue
+			}
+			if err = cacheIndex(entry.Name, index); err != nil {
+				return errors.Errorf("Could not cache the index of the %s repository: %v", entry.Name, err)
+			}
+			Info.logf("Refreshed the index of the %s repository, %d stacks", entry.Name, len(index.Projects))
+		}
+		if failed > 0 {
+			return errors.Errorf("Could not refresh %d of the %d repositories", failed, len(entries))
+		}
+		return nil
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoRefreshCmd)
+	rootCmd.PersistentFlags().DurationVar(&maxStale, "max-stale", 0, "When a repository can not be reached, only use its cached index and templates when they are younger than this, such as 72h. No limit by default.")
+}
@@ -0,0 +1,156 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IndexShard is a sub-index of a large repository, downloaded only when a stack it holds is needed. An index
+// lists its shards, by the first letters of their stack ids or by the stacks of a section of the catalog:
+//
+//   shards:
+//   - url: index-a-m.yaml
+//     prefixes: [a, b, c, d, e, f, g, h, i, j, k, l, m]
+//   - url: https://stacks.example.com/java/index.yaml
+//     stacks: [java-microprofile, java-spring-boot2]
+//
+// A shard with neither is downloaded whenever a stack is looked up. Relative URLs are relative to the index.
+type IndexShard struct {
+	URL      string   `yaml:"url"`
+	Prefixes []string `yaml:"prefixes,omitempty"`
+	Stacks   []string `yaml:"stacks,omitempty"`
+	// Digest is the sha256 of the shard, verified when it is downloaded. The shards of a signed index without
+	// one must be signed themselves.
+	Digest string `yaml:"digest,omitempty"`
+	// how the shard is downloaded, as the index listing it
+	headers  map[string]string
+	timeout  time.Duration
+	insecure bool
+	repo     string
+	loaded   bool
+	// publicKey is the public key of the signed index listing the shard, see fetchVerified
+	publicKey string
+}
+
+// holds tells whether the stack can be in the shard
+func (s *IndexShard) holds(id string) bool {
+	if len(s.Stacks) == 0 && len(s.Prefixes) == 0 {
+		return true
+	}
+	for _, stack := range s.Stacks {
+		if stack == id {
+			return true
+		}
+	}
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareShards resolves the URLs of the shards of a downloaded index, and gives them the headers and timeout
+// of the index
+func (index *RepoIndex) prepareShards(indexURL string, headers map[string]string, timeout time.Duration) error {
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return err
+	}
+	for _, shard := range index.Shards {
+		ref, err := url.Parse(shard.URL)
+		if err != nil {
+			return errors.Errorf("The shard URL %s of the index %s is not valid: %v", shard.URL, indexURL, err)
+		}
+		shard.URL = base.ResolveReference(ref).String()
+		publishDigest(shard.URL, shard.Digest)
+		shard.headers = headers
+		shard.timeout = timeout
+	}
+	return nil
+}
+
+// loadShards downloads the shards that can hold the stack, or every shard when id is empty, and merges their
+// stacks into the index
+func (index *RepoIndex) loadShards(id string) error {
+	repo, id := splitStackKey(id)
+	// shards can list more shards, which are appended as they are loaded
+	for i := 0; i < len(index.Shards); i++ {
+		shard := index.Shards[i]
+		if shard.loaded || (id != "" && !shard.holds(id)) || (repo != "" && shard.repo != repo) {
+			continue
+		}
+		shard.loaded = true
+		if err := checkSecureURL(shard.URL, shard.insecure); err != nil {
+			return err
+		}
+		var shardIndex *RepoIndex
+		var err error
+		if shard.publicKey != "" {
+			shardIndex, err = shard.fetchVerified()
+		} else {
+			shardIndex, err = downloadIndexWithTimeout(shard.URL, shard.headers, shard.timeout)
+		}
+		if err != nil {
+			return errors.Errorf("Could not read the index shard %s: %v", shard.URL, err)
+		}
+		for name, project := range shardIndex.Projects {
+			index.addProject(shard.repo, name, project, shard.insecure)
+		}
+		for _, nested := range shardIndex.Shards {
+			nested.insecure = shard.insecure
+			nested.repo = shard.repo
+			nested.publicKey = shard.publicKey
+		}
+		index.Shards = append(index.Shards, shardIndex.Shards...)
+	}
+	return nil
+}
+
+// fetchVerified downloads a shard of a signed index. The shard is only read when it has the sha256 digest the
+// signed index publishes for it or, without one, when its own signature, its URL with .sig appended, is signed
+// by the public key of the repository.
+func (s *IndexShard) fetchVerified() (*RepoIndex, error) {
+	var data bytes.Buffer
+	Debug.logw("Downloading the signed index shard", "url", s.URL)
+	if err := downloadFileWithTimeout(s.URL, &data, s.headers, s.timeout); err != nil {
+		return nil, errors.Errorf("Failed to get repository index: %s", err)
+	}
+	if expected := strings.TrimPrefix(strings.ToLower(s.Digest), "sha256:"); s.Digest != "" {
+		sum := sha256.Sum256(data.Bytes())
+		if actual := hex.EncodeToString(sum[:]); actual != expected {
+			auditSecurityEvent("digest", "digest mismatch of the signed index shard "+s.URL)
+			return nil, errors.Errorf("SECURITY: the digest of the shard is sha256:%s, the signed index publishes %s. The shard is not used.", actual, s.Digest)
+		}
+		return parseIndex(s.URL, data.Bytes(), s.headers, s.timeout)
+	}
+	var signature bytes.Buffer
+	if err := downloadFileWithTimeout(s.URL+indexSignatureSuffix, &signature, s.headers, s.timeout); err != nil {
+		return nil, errors.Errorf("the index of the %s repository is signed, but the shard has no digest in it and its signature could not be downloaded from %s: %v. The shard is not used, --insecure-skip-verify reads it without its signature.", s.repo, s.URL+indexSignatureSuffix, err)
+	}
+	if err := verifyIndexSignature(s.publicKey, data.Bytes(), signature.Bytes()); err != nil {
+		return nil, errors.Errorf("SECURITY: the shard is not signed by the public key of the %s repository: %v. The shard is not used, --insecure-skip-verify reads it without its signature.", s.repo, err)
+	}
+	Debug.logw("Verified the signature of the index shard", "url", s.URL)
+	return parseIndex(s.URL, data.Bytes(), s.headers, s.timeout)
+}
@@ -0,0 +1,232 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// indexSignatureSuffix makes the URL of the detached signature of an index from the URL of the index
+const indexSignatureSuffix = ".sig"
+
+// skipIndexVerify is the --insecure-skip-verify escape hatch, reading the indexes without their signature
+var skipIndexVerify bool
+
+var indexSignKey string
+var indexSignOutput string
+
+// ecdsaSignature is the ASN.1 encoding of the ECDSA signatures of cosign. ecdsa.SignASN1 and VerifyASN1 are not in
+// Go 1.12, the version of the builds, so the signatures are encoded here.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// parsePublicKey reads a PEM public key: the ECDSA key of cosign generate-key-pair, or an RSA key
+func parsePublicKey(publicKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, errors.New("the public key is not in the PEM format")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Errorf("the public key can not be read: %v", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	}
+	return nil, errors.Errorf("the public key is a %T, use an ECDSA or RSA key", key)
+}
+
+// verifyIndexSignature checks the base64 signature of an index, as cosign sign-blob and appsody stack index sign
+// write it, against the PEM public key of its repository
+func verifyIndexSignature(publicKey string, data []byte, signature []byte) error {
+	key, err := parsePublicKey([]byte(publicKey))
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return errors.Errorf("the signature is not base64: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	valid := false
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		var parsed ecdsaSignature
+		if rest, err := asn1.Unmarshal(sig, &parsed); err == nil && len(rest) == 0 && parsed.R != nil && parsed.S != nil {
+			valid = ecdsa.Verify(key, digest[:], parsed.R, parsed.S)
+		}
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !valid {
+		return errors.New("the signature does not match the index and the public key")
+	}
+	return nil
+}
+
+// fetchSignedIndex downloads the index of a repository with a public key, and its detached signature at the URL
+// of the index with .sig appended. The index is only decoded once its signature is verified: a missing or wrong
+// signature fails, unless --insecure-skip-verify is set.
+func (r *RepositoryEntry) fetchSignedIndex(headers map[string]string) (*RepoIndex, error) {
+	if skipIndexVerify {
+		Warning.logf("The signature of the index of the %s repository is not verified, --insecure-skip-verify is set", r.Name)
+		return downloadIndexWithTimeout(r.URL, headers, r.timeout())
+	}
+	indexURL := r.URL
+	if strings.HasSuffix(indexURL, "/") {
+		indexURL += "index.yaml"
+	}
+	var data, signature bytes.Buffer
+	Debug.logw("Downloading the signed repository index", "url", indexURL)
+	if err := downloadFileWithTimeout(indexURL, &data, headers, r.timeout()); err != nil {
+		return nil, errors.Wrap(err, "Failed to get repository index")
+	}
+	if err := downloadFileWithTimeout(indexURL+indexSignatureSuffix, &signature, headers, r.timeout()); err != nil {
+		return nil, errors.Errorf("The %s repository has a public key, but the signature of its index could not be downloaded from %s: %v. The index is not used, --insecure-skip-verify reads it without its signature.", r.Name, indexURL+indexSignatureSuffix, err)
+	}
+	if err := verifyIndexSignature(r.PublicKey, data.Bytes(), signature.Bytes()); err != nil {
+		return nil, errors.Errorf("SECURITY: the index of the %s repository is not signed by its public key: %v. The index is not used, --insecure-skip-verify reads it without its signature.", r.Name, err)
+	}
+	Debug.logw("Verified the signature of the repository index", "repo", r.Name)
+	return parseIndex(indexURL, data.Bytes(), headers, r.timeout())
+}
+
+// checkIndexSignature fails for a repository with a public key whose type of index can not be verified
+func (r *RepositoryEntry) checkIndexSignature() error {
+	if r.PublicKey == "" || skipIndexVerify {
+		return nil
+	}
+	return errors.Errorf("The %s repository has a public key, but only the indexes of http repositories can be verified. The index is not used, --insecure-skip-verify reads it without its signature.", r.Name)
+}
+
+// signIndexData signs an index with an unencrypted PEM private key, in the format verifyIndexSignature reads
+func signIndexData(privateKey []byte, data []byte) ([]byte, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("the private key is not in the PEM format")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Errorf("the private key can not be read: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	var sig []byte
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, key, digest[:]); err == nil {
+			sig, err = asn1.Marshal(ecdsaSignature{r, s})
+		}
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	default:
+		return nil, errors.Errorf("the private key is a %T, use an ECDSA or RSA key", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+var stackIndexSignCmd = &cobra.Command{
+	Use:   "sign <index file>",
+	Short: "Sign the index of a repository of stacks",
+	Long: `This writes the detached signature of an index, by default next to it with the .sig extension. Publish it with the
+index: the users of the repository add it with the public key, appsody repo add --public-key <file>, and the CLI
+then only reads the index when its signature matches.
+
+The --key is a cosign private key, signed with cosign sign-blob and its COSIGN_PASSWORD, or an unencrypted
+PEM ECDSA or RSA private key. Sign the index again each time it is generated.`,
+	Example: `  cosign generate-key-pair
+  appsody stack index generate . && appsody stack index sign dist/index.yaml --key cosign.key`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		indexFile := args[0]
+		if indexSignKey == "" {
+			return errors.New("Give the private key to sign the index with --key")
+		}
+		output := indexSignOutput
+		if output == "" {
+			output = indexFile + indexSignatureSuffix
+		}
+		privateKey, err := ioutil.ReadFile(indexSignKey)
+		if err != nil {
+			return errors.Errorf("Could not read the private key: %v", err)
+		}
+		data, err := ioutil.ReadFile(indexFile)
+		if err != nil {
+			return errors.Errorf("Could not read the index: %v", err)
+		}
+		if _, err = decodeRepoIndex(data); err != nil {
+			return errors.Errorf("%s is not an index of a repository: %v", indexFile, err)
+		}
+		// the private keys of cosign are encrypted with its own scheme
+		if block, _ := pem.Decode(privateKey); block != nil && strings.Contains(block.Type, "ENCRYPTED") {
+			if err = checkCosign(); err != nil {
+				return err
+			}
+			if err = execAndWaitReturnErr("cosign", []string{"sign-blob", "--yes", "--key", indexSignKey, "--output-signature", output, indexFile}, Debug); err != nil {
+				return errors.Errorf("Could not sign the index: %v", err)
+			}
+		} else if dryrun {
+			planned(planWrite, output, "signature of "+indexFile)
+			return nil
+		} else {
+			signature, err := signIndexData(privateKey, data)
+			if err != nil {
+				return errors.Errorf("Could not sign the index: %v", err)
+			}
+			if err = writeFileAtomic(output, signature, 0644); err != nil {
+				return err
+			}
+		}
+		if !dryrun {
+			Info.logf("Wrote the signature of %s in %s, publish it next to the index", indexFile, output)
+		}
+		return nil
+	},
+}
+
+func init() {
+	stackIndexCmd.AddCommand(stackIndexSignCmd)
+	stackIndexSignCmd.PersistentFlags().StringVar(&indexSignKey, "key", "", "Private key to sign the index with: a cosign key, or an unencrypted PEM key.")
+	stackIndexSignCmd.PersistentFlags().StringVar(&indexSignOutput, "file", "", "Signature file to write. Defaults to the index file with .sig appended.")
+	rootCmd.PersistentFlags().BoolVar(&skipIndexVerify, "insecure-skip-verify", false, "Read the indexes of the repositories that have a public key without verifying their signature.")
+}
@@ -0,0 +1,288 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+const signedIndex = "apiVersion: v2\nstacks: []\n"
+
+// testKeyPair returns a PEM private key, in the format of signIndexData, and its PEM public key
+func testKeyPair(t *testing.T, kind string) ([]byte, string) {
+	var private *pem.Block
+	var public interface{}
+	switch kind {
+	case "ecdsa":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, public = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, &key.PublicKey
+	case "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, public = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}, &key.PublicKey
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(private), string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestIndexSignature(t *testing.T) {
+	ecdsaPrivate, ecdsaPublic := testKeyPair(t, "ecdsa")
+	rsaPrivate, rsaPublic := testKeyPair(t, "rsa")
+	_, otherPublic := testKeyPair(t, "ecdsa")
+	sign := func(private []byte, data string) []byte {
+		signature, err := cmd.SignIndexData(private, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	ecdsaSignature := sign(ecdsaPrivate, signedIndex)
+	rsaSignature := sign(rsaPrivate, signedIndex)
+
+	var tests = []struct {
+		name      string
+		publicKey string
+		data      string
+		signature []byte
+		err       string // expected in the error, "" when the signature is valid
+	}{
+		{"ECDSA", ecdsaPublic, signedIndex, ecdsaSignature, ""},
+		{"RSA", rsaPublic, signedIndex, rsaSignature, ""},
+		{"Signature with a newline", ecdsaPublic, signedIndex, append(ecdsaSignature, '\n'), ""},
+		{"Tampered index", ecdsaPublic, signedIndex + "# changed\n", ecdsaSignature, "does not match"},
+		{"Tampered index RSA", rsaPublic, "apiVersion: v1\n", rsaSignature, "does not match"},
+		{"Other key", otherPublic, signedIndex, ecdsaSignature, "does not match"},
+		{"Signature of the other algorithm", ecdsaPublic, signedIndex, rsaSignature, "does not match"},
+		{"Empty signature", ecdsaPublic, signedIndex, nil, "does not match"},
+		{"Not base64", ecdsaPublic, signedIndex, []byte("not a signature!"), "not base64"},
+		{"Not a PEM key", "ssh-ed25519 AAAA", signedIndex, ecdsaSignature, "PEM"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := cmd.VerifyIndexSignature(test.publicKey, []byte(test.data), test.signature)
+			if test.err == "" && err != nil {
+				t.Errorf("Expected the signature to be valid, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestFetchSignedIndex(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	private, public := testKeyPair(t, "ecdsa")
+	signature, err := cmd.SignIndexData(private, []byte(signedIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/signed/index.yaml":       signedIndex,
+		"/signed/index.yaml.sig":   string(signature),
+		"/unsigned/index.yaml":     signedIndex,
+		"/tampered/index.yaml":     signedIndex + "# changed\n",
+		"/tampered/index.yaml.sig": string(signature),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		repo string
+		err  string // expected in the error, "" when the index is read
+	}{
+		{"signed", ""},
+		{"unsigned", "signature of its index could not be downloaded"},
+		{"tampered", "is not signed by its public key"},
+	}
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			repo := &cmd.RepositoryEntry{Name: test.repo, URL: server.URL + "/" + test.repo + "/index.yaml", PublicKey: public}
+			index, err := repo.FetchSignedIndex()
+			if test.err == "" && (err != nil || index == nil) {
+				t.Errorf("Expected the index to be read, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSignedIndexShards(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	private, public := testKeyPair(t, "ecdsa")
+	otherPrivate, _ := testKeyPair(t, "ecdsa")
+	sign := func(private []byte, data string) string {
+		signature, err := cmd.SignIndexData(private, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(signature)
+	}
+	shard := "apiVersion: v2\nstacks:\n- id: nodejs\n  name: Node.js\n  version: 0.3.0\n  templates: []\n"
+	sum := sha256.Sum256([]byte(shard))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	files := map[string]string{
+		"/shard.yaml":           shard,
+		"/shard.yaml.sig":       sign(private, shard),
+		"/other-shard.yaml":     shard,
+		"/other-shard.yaml.sig": sign(otherPrivate, shard),
+		"/unsigned-shard.yaml":  shard,
+		"/tampered-shard.yaml":  shard + "# changed\n",
+	}
+	indexes := map[string]string{
+		"digest":       "  digest: " + digest + "\n",
+		"signed":       "",
+		"wrong-digest": "  digest: sha256:" + strings.Repeat("0", 64) + "\n",
+		"unsigned":     "",
+		"other-key":    "",
+		"tampered":     "  digest: " + digest + "\n",
+	}
+	shardFiles := map[string]string{
+		"digest":       "/shard.yaml",
+		"signed":       "/shard.yaml",
+		"wrong-digest": "/shard.yaml",
+		"unsigned":     "/unsigned-shard.yaml",
+		"other-key":    "/other-shard.yaml",
+		"tampered":     "/tampered-shard.yaml",
+	}
+	for repo, shardDigest := range indexes {
+		index := "apiVersion: v2\nstacks: []\nshards:\n- url: .." + shardFiles[repo] + "\n" + shardDigest
+		files["/"+repo+"/index.yaml"] = index
+		files["/"+repo+"/index.yaml.sig"] = sign(private, index)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		repo string
+		err  string // expected in the error, "" when the shard is read
+	}{
+		{"digest", ""},
+		{"signed", ""},
+		{"wrong-digest", "digest"},
+		{"unsigned", "the shard has no digest"},
+		{"other-key", "the shard is not signed by the public key"},
+		{"tampered", "digest"},
+	}
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			repo := &cmd.RepositoryEntry{Name: test.repo, URL: server.URL + "/" + test.repo + "/index.yaml", PublicKey: public}
+			index, err := repo.LoadSignedShards()
+			if test.err == "" && (err != nil || len(index.Projects["nodejs"]) == 0) {
+				t.Errorf("Expected the stacks of the shard to be read, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestSignedIndexCache(t *testing.T) {
+	// the index is always downloaded, and the cache only used when the repository can not be reached
+	_, _, cleanup := useTestHome(t, "indexCacheTTL: 0s\n", "")
+	defer cleanup()
+	private, public := testKeyPair(t, "ecdsa")
+	signature, err := cmd.SignIndexData(private, []byte(signedIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/tampered/index.yaml":     signedIndex + "# changed\n",
+		"/tampered/index.yaml.sig": string(signature),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down/index.yaml" {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		repo string
+		err  string // expected in the error, "" when the cached index is used
+	}{
+		{"down", ""},
+		{"missing", ""},
+		{"tampered", "is not signed by its public key"},
+	}
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			cached := &cmd.RepoIndex{APIVersion: "v2"}
+			if err := cmd.CacheIndex(test.repo, cached); err != nil {
+				t.Fatal(err)
+			}
+			repo := &cmd.RepositoryEntry{Name: test.repo, URL: server.URL + "/" + test.repo + "/index.yaml", PublicKey: public}
+			index, err := repo.ReadIndex()
+			if test.err == "" && (err != nil || index == nil) {
+				t.Errorf("Expected the cached index to be used, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// indexAPIVersionV2 is the apiVersion of the indexes that list their stacks, see IndexStack
+const indexAPIVersionV2 = "v2"
+
+// IndexStack is a version of a stack in a v2 index. A v2 index lists its stacks instead of mapping their ids to
+// their versions, and each carries its templates, license, deprecation and the minimum CLI version it needs:
+//
+//	apiVersion: v2
+//	stacks:
+//	  - id: nodejs
+//	    name: Node.js
+//	    version: 0.3.1
+//	    license: Apache-2.0
+//	    min-appsody-version: 0.6.0
+//	    templates:
+//	      - name: simple
+//	        url: nodejs.v0.3.1.templates.simple.tar.gz
+//	        digest: sha256:...
+type IndexStack struct {
+	ID          string    `yaml:"id"`
+	APIVersion  string    `yaml:"apiVersion,omitempty"`
+	Created     time.Time `yaml:"created,omitempty"`
+	Name        string    `yaml:"name"`
+	Version     string    `yaml:"version"`
+	Description string    `yaml:"description,omitempty"`
+	Home        string    `yaml:"home,omitempty"`
+	Icon        string    `yaml:"icon,omitempty"`
+	Keywords    []string  `yaml:"keywords,omitempty"`
+	Maintainers []string  `yaml:"maintainers,omitempty"`
+	License     string    `yaml:"license,omitempty"`
+	// Deprecated tells why the stack is deprecated, and what replaces it, or is true
+	Deprecated string `yaml:"deprecated,omitempty"`
+	// MinAppsodyVersion is the oldest CLI that can use the stack. RequiresCLI can constrain it further.
+	MinAppsodyVersion string          `yaml:"min-appsody-version,omitempty"`
+	RequiresCLI       string          `yaml:"requires-cli,omitempty"`
+	Image             string          `yaml:"image,omitempty"`
+	Architectures     []string        `yaml:"architectures,omitempty"`
+	Templates         []StackTemplate `yaml:"templates"`
+	Samples           []StackSample   `yaml:"samples,omitempty"`
+}
+
+// decodeRepoIndex parses an index of any apiVersion. The stacks of a v2 index are moved to Projects, latest
+// version first, so the commands read every index the same way.
+func decodeRepoIndex(data []byte) (*RepoIndex, error) {
+	var index RepoIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	if len(index.Stacks) == 0 {
+		return &index, nil
+	}
+	if index.Projects == nil {
+		index.Projects = map[string]ProjectVersions{}
+	}
+	for _, stack := range index.Stacks {
+		if stack.ID == "" {
+			return nil, errors.Errorf("the %s %s stack of the index has no id", stack.Name, stack.Version)
+		}
+		index.Projects[stack.ID] = append(index.Projects[stack.ID], stack.projectVersion())
+	}
+	for _, versions := range index.Projects {
+		sort.SliceStable(versions, func(i, j int) bool { return versionLess(versions[j].Version, versions[i].Version) })
+	}
+	index.Stacks = nil
+	return &index, nil
+}
+
+// projectVersion is the stack version of a v1 index
+func (s *IndexStack) projectVersion() *ProjectVersion {
+	version := &ProjectVersion{
+		APIVersion:    s.APIVersion,
+		Created:       s.Created,
+		Name:          s.Name,
+		Home:          s.Home,
+		Version:       s.Version,
+		Description:   s.Description,
+		Keywords:      s.Keywords,
+		Maintainers:   s.Maintainers,
+		Icon:          s.Icon,
+		Architectures: s.Architectures,
+		Templates:     s.Templates,
+		Image:         s.Image,
+		Samples:       s.Samples,
+		RequiresCLI:   s.RequiresCLI,
+		License:       s.License,
+		Deprecated:    s.Deprecated,
+	}
+	if s.MinAppsodyVersion != "" {
+		minimum := ">=" + strings.TrimPrefix(s.MinAppsodyVersion, ">=")
+		if version.RequiresCLI == "" {
+			version.RequiresCLI = minimum
+		} else {
+			version.RequiresCLI = minimum + "," + version.RequiresCLI
+		}
+	}
+	for _, template := range s.Templates {
+		version.URLs = append(version.URLs, template.URL)
+	}
+	if len(s.Templates) > 0 {
+		version.Digest = s.Templates[0].Digest
+	}
+	return version
+}
+
+// indexStack is the stack version of a v2 index. A v1 version without templates has one per URL, named after
+// the archive.
+func indexStack(id string, version *ProjectVersion) *IndexStack {
+	stack := &IndexStack{
+		ID:            id,
+		APIVersion:    version.APIVersion,
+		Created:       version.Created,
+		Name:          version.Name,
+		Version:       version.Version,
+		Description:   version.Description,
+		Home:          version.Home,
+		Icon:          version.Icon,
+		Keywords:      version.Keywords,
+		Maintainers:   version.Maintainers,
+		License:       version.License,
+		Deprecated:    version.Deprecated,
+		RequiresCLI:   version.cliConstraint(),
+		Image:         version.Image,
+		Architectures: version.Architectures,
+		Templates:     version.Templates,
+		Samples:       version.Samples,
+	}
+	// a plain minimum version is the min-appsody-version of v2
+	if constraint := stack.RequiresCLI; strings.HasPrefix(constraint, ">=") && !strings.Contains(constraint, ",") {
+		stack.MinAppsodyVersion = strings.TrimSpace(strings.TrimPrefix(constraint, ">="))
+		stack.RequiresCLI = ""
+	}
+	if len(stack.Templates) == 0 {
+		for i, templateURL := range version.URLs {
+			template := StackTemplate{Name: templateName(templateURL), URL: templateURL}
+			if i == 0 {
+				template.Digest = version.Digest
+			}
+			stack.Templates = append(stack.Templates, template)
+		}
+	}
+	return stack
+}
+
+// migrateRepoIndex returns the v2 index of the stacks of an index, in the order of their ids
+func migrateRepoIndex(index *RepoIndex) *RepoIndex {
+	migrated := &RepoIndex{APIVersion: indexAPIVersionV2, Generated: index.Generated, Shards: index.Shards}
+	var ids []string
+	for id := range index.Projects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, version := range index.Projects[id] {
+			migrated.Stacks = append(migrated.Stacks, indexStack(id, version))
+		}
+	}
+	return migrated
+}
+
+var repoIndexMigrateOutput string
+
+var repoIndexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Work with the index files of repositories",
+	Long:  ``,
+}
+
+var repoIndexMigrateCmd = &cobra.Command{
+	Use:   "migrate <index file>",
+	Short: "Upgrade a v1 repository index file to v2",
+	Long: `This rewrites a v1 repository index, which maps the ids of the stacks to their versions, as a v2 index, which lists
+the stacks with their templates, license, deprecation and the minimum version of the Appsody CLI they need.
+
+The index file is replaced, unless --output names another file. The CLI reads both versions, so the repositories
+can move to v2 at their own pace, but a v2 index needs a CLI that reads v2.`,
+	Example: `  appsody repo index migrate index.yaml --output index-v2.yaml`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := args[0]
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		index, err := decodeRepoIndex(data)
+		if err != nil {
+			return errors.Errorf("%s is not a valid repository index: %v", file, err)
+		}
+		if index.APIVersion == indexAPIVersionV2 {
+			return errors.Errorf("%s is already a v2 index", file)
+		}
+		if err = checkIndexAPIVersion(file, index.APIVersion); err != nil {
+			return err
+		}
+		output := repoIndexMigrateOutput
+		if output == "" {
+			output = file
+		}
+		migrated := migrateRepoIndex(index)
+		if dryrun {
+			planned(planWrite, output, "v2 index of the "+file+" index")
+			return nil
+		}
+		if err = writeRepoIndex(migrated, output); err != nil {
+			return errors.Errorf("Could not write the v2 index: %v", err)
+		}
+		Info.logf("Wrote the %d stack version(s) of %s as a v2 index to %s", len(migrated.Stacks), file, output)
+		return nil
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoIndexCmd)
+	repoIndexCmd.AddCommand(repoIndexMigrateCmd)
+	repoIndexMigrateCmd.PersistentFlags().StringVar(&repoIndexMigrateOutput, "output", "", "File to write the v2 index to. By default the index file is replaced.")
+}
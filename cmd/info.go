@@ -0,0 +1,314 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var infoEnv bool
+
+// projectActivity is a build or deploy of the project, remembered for appsody info
+type projectActivity struct {
+	Image     string    `json:"image"`
+	Time      time.Time `json:"time"`
+	Seconds   float64   `json:"seconds,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	URL       string    `json:"url,omitempty"`
+}
+
+// projectState is what the CLI remembers about a project between commands
+type projectState struct {
+	LastBuild  *projectActivity `json:"lastBuild,omitempty"`
+	LastDeploy *projectActivity `json:"lastDeploy,omitempty"`
+	// DeployProgress is what the last deploy got done when it failed, see deployProgress
+	DeployProgress *deployProgress `json:"deployProgress,omitempty"`
+}
+
+// projectInfo is printed by appsody info. RepoAsOf is when the index of the repository was cached, when it
+// could not be reached.
+type projectInfo struct {
+	Name         string           `json:"name"`
+	Dir          string           `json:"dir"`
+	Stack        string           `json:"stack"`
+	StackVersion string           `json:"stackVersion,omitempty"`
+	StackDigest  string           `json:"stackDigest,omitempty"`
+	Repository   string           `json:"repository,omitempty"`
+	RepoAsOf     *time.Time       `json:"repositoryAsOf,omitempty"`
+	Ports        []string         `json:"ports"`
+	Mounts       []string         `json:"mounts"`
+	LastBuild    *projectActivity `json:"lastBuild,omitempty"`
+	LastDeploy   *projectActivity `json:"lastDeploy,omitempty"`
+}
+
+func projectStateFile(projectName string) string {
+	return filepath.Join(getStateDir(), "state", projectName+".json")
+}
+
+func readProjectState(projectName string) projectState {
+	var state projectState
+	data, err := ioutil.ReadFile(projectStateFile(projectName))
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		Debug.log("Could not read the project state: ", err)
+	}
+	return state
+}
+
+// recordProjectActivity remembers the last build or deploy of the project. Failing to do so does not fail the command.
+func recordProjectActivity(update func(*projectState)) {
+	if dryrun {
+		return
+	}
+	projectName, err := getProjectName()
+	if err != nil {
+		return
+	}
+	state := readProjectState(projectName)
+	update(&state)
+	file := projectStateFile(projectName)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		Debug.log("Could not record the project state: ", err)
+	}
+}
+
+// stackRepository returns the name of the first configured repository that has the stack of the image
+func stackRepository(stackImage string) string {
+	repo, _ := imageStackVersion(stackImage)
+	return repo
+}
+
+// imageStackVersion returns the first configured repository that has the stack of the image, with the version
+// of the stack of the image in its index, or the latest one when the index does not have it
+func imageStackVersion(stackImage string) (string, *ProjectVersion) {
+	stackID := imageBaseName(stackImage)
+	repos, err := stackRepos()
+	if err != nil {
+		Warning.log(err)
+		return "", nil
+	}
+	for _, repo := range repos.Repositories {
+		index, err := repo.readIndex()
+		if err != nil {
+			Debug.logf("Could not read the %s repository: %v", repo.Name, err)
+			continue
+		}
+		if err = index.loadShards(stackID); err != nil {
+			Debug.logf("Could not read the %s repository: %v", repo.Name, err)
+			continue
+		}
+		versions := index.Projects[stackID]
+		if len(versions) == 0 {
+			continue
+		}
+		// the tag of the image can be a major.minor version, such as 0.2
+		imageVersion := stackVersion(stackImage)
+		for _, version := range versions {
+			if version.Version == imageVersion || strings.HasPrefix(version.Version, imageVersion+".") {
+				return repo.Name, version
+			}
+		}
+		return repo.Name, versions[0]
+	}
+	return "", nil
+}
+
+func getProjectInfo() (*projectInfo, error) {
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return nil, err
+	}
+	projectName, _ := getProjectName()
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	stackImage := config.Platform
+	state := readProjectState(projectName)
+	info := &projectInfo{
+		Name:       projectName,
+		Dir:        projectDir,
+		Stack:      stackImage,
+		Repository: stackRepository(stackImage),
+		Ports:      []string{},
+		Mounts:     []string{},
+		LastBuild:  state.LastBuild,
+		LastDeploy: state.LastDeploy,
+	}
+	if asOf, ok := offlineIndexAsOf(info.Repository); ok && info.Repository != "" {
+		info.RepoAsOf = &asOf
+	}
+	// the label of the image when it is pulled, its tag otherwise
+	info.StackVersion = stackVersion(stackImage)
+	// the details of the stack image are only shown when it is already pulled, info never pulls it
+	if !checkDockerImageExistsLocally(stackImage) {
+		Warning.log("The stack image ", stackImage, " is not available locally, its digest, ports and mounts are not shown. Run appsody extract to pull it.")
+		return info, nil
+	}
+	imagePulled[stackImage] = true
+	if _, digest, err := imageDigest(stackImage); err == nil {
+		info.StackDigest = digest
+	}
+	ports, err := getExposedPorts()
+	if err != nil {
+		return nil, err
+	}
+	info.Ports = append(info.Ports, ports...)
+	volumeArgs, err := getVolumeArgs()
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(volumeArgs); i += 2 {
+		info.Mounts = append(info.Mounts, volumeArgs[i])
+	}
+	return info, nil
+}
+
+// stackEnvInfo is a variable the stack declares, with the value the env of the project gives it
+type stackEnvInfo struct {
+	StackEnvVar
+	Value string `json:"value,omitempty"`
+}
+
+// showStackEnv lists the environment variables the stack of the project declares
+func showStackEnv(asJSON bool) error {
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	repo, version := imageStackVersion(config.Platform)
+	if version == nil {
+		return errors.Errorf("The stack %s is not in the configured repositories, so its environment variables are not known", config.Platform)
+	}
+	variables := []stackEnvInfo{}
+	for _, variable := range version.Env {
+		variables = append(variables, stackEnvInfo{StackEnvVar: variable, Value: config.Env[variable.Name]})
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(variables, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(variables) == 0 {
+		Info.logf("The %s stack %s of the %s repository does not declare its environment variables", version.Name, version.Version, repo)
+		return nil
+	}
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.Wrap = true
+	table.AddRow("NAME", "TYPE", "DEFAULT", "PROJECT VALUE", "DESCRIPTION")
+	for _, variable := range variables {
+		table.AddRow(variable.Name, variable.typeName(), variable.Default, variable.Value, variable.Description)
+	}
+	Info.log(table.String())
+	return nil
+}
+
+func formatActivity(activity *projectActivity) string {
+	if activity == nil {
+		return "never"
+	}
+	text := fmt.Sprintf("%s at %s", activity.Image, activity.Time.Local().Format(time.RFC1123))
+	if activity.Seconds > 0 {
+		text += fmt.Sprintf(" in %.1fs", activity.Seconds)
+	}
+	if activity.Namespace != "" {
+		text += " to namespace " + activity.Namespace
+	}
+	if activity.URL != "" {
+		text += ", " + activity.URL
+	}
+	return text
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show what your Appsody project is using",
+	Long: `This shows the stack of the project with the version and digest of its image, the repository it comes from, the ports
+and mounts of the development container, and the last build and deploy of the project.
+
+Use --env for the environment variables the stack declares, with their type, default and description, and the
+value the env section of .appsody-config.yaml gives them. run, debug, test and deploy check the env of the project
+against them: the values must be of the declared type, and a variable named almost like a declared one, such as
+PORTT for PORT, is taken for a typo.
+
+Use -o json for a description tools can read.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, err := jsonOutput()
+		if err != nil {
+			return err
+		}
+		if infoEnv {
+			return showStackEnv(asJSON)
+		}
+		info, err := getProjectInfo()
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.AddRow("Project:", info.Name)
+		table.AddRow("Directory:", info.Dir)
+		table.AddRow("Stack image:", info.Stack)
+		table.AddRow("Stack version:", info.StackVersion)
+		table.AddRow("Stack digest:", info.StackDigest)
+		repository := info.Repository
+		if info.RepoAsOf != nil {
+			repository += " " + offlineAnnotation(*info.RepoAsOf)
+		}
+		table.AddRow("Repository:", repository)
+		table.AddRow("Ports:", strings.Join(info.Ports, ", "))
+		table.AddRow("Mounts:", strings.Join(info.Mounts, "\n"))
+		table.AddRow("Last build:", formatActivity(info.LastBuild))
+		table.AddRow("Last deploy:", formatActivity(info.LastDeploy))
+		Info.log(table.String())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+	infoCmd.PersistentFlags().BoolVar(&infoEnv, "env", false, "List the environment variables the stack declares.")
+}
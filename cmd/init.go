@@ -15,10 +15,7 @@
 package cmd
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -32,8 +29,14 @@ import (
 )
 
 var (
-	overwrite  bool
-	noTemplate bool
+	overwrite      bool
+	noTemplate     bool
+	fromDockerfile string
+	fromSample     string
+	// initStackVersion is the --stack-version option, the version of the stack to initialize the project from
+	initStackVersion string
+	// initForce is the --force option, to initialize a stack that requires another version of the CLI
+	initForce bool
 )
 var whiteListDotDirectories = []string{"github", "vscode", "settings", "metadata"}
 var whiteListDotFiles = []string{"git", "project", "DS_Store", "classpath", "factorypath", "gitattributes", "gitignore", "cw-settings", "cw-extension"}
@@ -41,14 +44,14 @@ var whiteListDotFiles = []string{"git", "project", "DS_Store", "classpath", "fac
 // initCmd represents the init command
 
 var initCmd = &cobra.Command{
-	Use:   "init [stack]",
+	Use:   "init [stack] [template]",
 	Short: "Initialize an Appsody project with a stack and template app",
 	Long: `This creates a new Appsody project in a local directory or sets up the local dev environment of an existing Appsody project.
 
 With the [stack] argument, this command will setup a new Appsody project. It will create an Appsody stack config file, unzip a template app, and
 run the stack init script to setup the local dev environment. It is typically run on an empty directory and may fail
 if files already exist. See the --overwrite and --no-template options for more details.
-Use 'appsody list' to see the available stack options.
+Use 'appsody list' to see the available stack options, and 'appsody templates <stack>' for the [template] argument.
 
 Without the [stack] argument, this command must be run on an existing Appsody project and will only run the stack init script to
 setup the local dev environment.`,
@@ -66,21 +69,106 @@ setup the local dev environment.`,
 		if err != nil {
 			return errors.Errorf("Could not read index: %v", err)
 		}
+		var projectType string
 		if len(args) >= 1 {
-
-			projectType := args[0]
-
-			if len(index.Projects[projectType]) < 1 {
-				return errors.Errorf("Could not find a stack with the id \"%s\". Run `appsody list` to see the available stacks or -h for help.", projectType)
-
+			projectType = args[0]
+		}
+		// adopting an existing project only lays down the appsody config, never the template files
+		templateless := noTemplate
+		if fromSample != "" && (len(args) >= 2 || noTemplate || fromDockerfile != "") {
+			return errors.New("--from-sample cannot be used with a template argument, --no-template or --from-dockerfile")
+		}
+		if fromSample != "" && projectType == "" {
+			return errors.New("Specify the stack of the sample, such as appsody init nodejs-express --from-sample <sample>")
+		}
+		if fromDockerfile != "" {
+			projectType, err = adoptExistingProject(&index, projectType)
+			if err != nil {
+				return err
+			}
+			templateless = true
+		}
+		if projectType == "" {
+			dir, err := os.Getwd()
+			if err != nil {
+				return errors.Errorf("Error getting current directory %v", err)
+			}
+			if err = suggestStacksForDirectory(&index, dir); err != nil {
+				return err
+			}
+		}
+		if projectType != "" {
+			spec := projectType
+			if initStackVersion != "" {
+				if strings.Contains(projectType, "@") {
+					return errors.New("Give the version of the stack either as <stack>@<version> or with --stack-version, not both")
+				}
+				spec = projectType + "@" + initStackVersion
+			}
+			id, _ := splitStackSpec(spec)
+			key, err := index.resolveStack(id)
+			if err != nil {
+				return err
+			}
+			stack, err := findStackVersion(&index, spec)
+			if err != nil {
+				return err
+			}
+			if latest := index.Projects[key][0]; stack != latest {
+				Info.logf("Using version %s of the %s stack, the latest version is %s", stack.Version, index.displayID(key), latest.Version)
+			}
+			// the stack id without its repository names the template archives
+			_, projectType = splitStackKey(key)
+			arch := localArch()
+			if !stack.supportsArch(arch) {
+				return errors.Errorf("The stack \"%s\" is not available for the %s platform. Supported platforms: %s", key, arch, strings.Join(stack.Architectures, ", "))
+			}
+			if err = stack.checkCompatibility(); err != nil {
+				// a stack in a format this CLI can not read is never initialized
+				if !supportedAPIVersion(supportedStackAPIVersions, stack.APIVersion) {
+					return err
+				}
+				if !initForce {
+					return errors.Errorf("%v Use --force to initialize the project anyway.", err)
+				}
+				Warning.logf("%v Initializing the project anyway, as --force is set.", err)
+			}
+			if stack.Deprecated != "" {
+				Warning.log(stack.deprecationNotice())
+			}
+			scaffoldStack, scaffoldStackID = stack, projectType
+			var projectName = stack.URLs[0]
+			if len(args) >= 2 {
+				template, err := stack.findTemplate(args[1])
+				if err != nil {
+					return err
+				}
+				projectName = template.URL
+			}
+			var sample *StackSample
+			if fromSample != "" {
+				if sample, err = stack.findSample(fromSample); err != nil {
+					return err
+				}
 			}
-			var projectName = index.Projects[projectType][0].URLs[0]
 
 			// 1. Check for empty directory
 			dir, err := os.Getwd()
 			if err != nil {
 				return errors.Errorf("Error getting current directory %v", err)
 			}
+			if renderOnly {
+				if preview || templateless || sample != nil {
+					return errors.New("--render-only cannot be used with --preview, --no-template or --from-sample")
+				}
+				return renderTemplateOnly(projectName, dir)
+			}
+			if preview {
+				if sample != nil {
+					return previewTemplate(sample.URL, dir, false)
+				}
+				return previewTemplate(projectName, dir, templateless)
+			}
 			appsodyConfigFile := filepath.Join(dir, ".appsody-config.yaml")
 
 			_, err = os.Stat(appsodyConfigFile)
@@ -89,7 +177,7 @@ setup the local dev environment.`,
 
 			}
 
-			if noTemplate || overwrite {
+			if templateless || overwrite {
 				proceedWithTemplate = true
 			} else {
 				proceedWithTemplate, err = isFileLaydownSafe(dir)
@@ -107,33 +195,19 @@ setup the local dev environment.`,
 			}
 
 			Info.log("Running appsody init...")
-			Info.logf("Downloading %s template project from %s", projectType, projectName)
-			filename := projectType + ".tar.gz"
-
-			err = downloadFileToDisk(projectName, filename)
-			if err != nil {
-				return errors.Errorf("Error downloading tar %v", err)
-
-			}
-			Info.log("Download complete. Extracting files from ", filename)
-			//if noTemplate
-			errUntar := untar(filename, noTemplate)
-
-			if dryrun {
-				Info.logf("Dry Run - Skipping remove of temporary file for project type: %s project name: %s", projectType, projectName)
+			if sample != nil {
+				err = initFromSample(projectType, sample, projectName)
 			} else {
-				err = os.Remove(filename)
-				if err != nil {
-					Warning.log("Unable to remove temporary file ", filename)
-				}
+				err = initTemplate(projectType, projectName, templateless)
 			}
-			if errUntar != nil {
-				Error.log("Error extracting project template: ", errUntar)
-				Info.log("It is recommended that you run `appsody init <stack>` in an empty directory.")
-				Info.log("If you wish to proceed and overwrite files in the current directory, try again with the --overwrite option.")
-				// this leave the tar file in the dir
-				return errors.Errorf("Error extracting project template: %v", errUntar)
-
+			if err != nil {
+				return err
+			}
+		}
+		if editorConfig {
+			err = materializeEditorConfig()
+			if err != nil {
+				Warning.log("Could not set up the editor configuration recommended by the stack: ", err)
 			}
 		}
 		err = install()
@@ -147,8 +221,107 @@ setup the local dev environment.`,
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+	initCmd.PersistentFlags().StringVar(&initStackVersion, "stack-version", "", "Initialize the project from this version of the stack instead of the latest one.")
 	initCmd.PersistentFlags().BoolVar(&overwrite, "overwrite", false, "Download and extract the template project, overwriting existing files.")
 	initCmd.PersistentFlags().BoolVar(&noTemplate, "no-template", false, "Only create the .appsody-config.yaml file. Do not unzip the template project.")
+	initCmd.PersistentFlags().StringVar(&fromDockerfile, "from-dockerfile", "", "Adopt an existing project built with the given Dockerfile. The closest matching stack is suggested and only the .appsody-config.yaml file is created.")
+	initCmd.PersistentFlags().Lookup("from-dockerfile").NoOptDefVal = "Dockerfile"
+	initCmd.PersistentFlags().StringVar(&lineEndings, "line-endings", lineEndingsAuto, "Line endings of the template text files: auto converts the shell scripts to LF, lf converts every text file to LF, native uses CRLF on Windows except for shell scripts, keep leaves them as they are.")
+	initCmd.PersistentFlags().BoolVar(&preview, "preview", false, "List the files the template would create, and the ones that already exist, without writing anything.")
+	initCmd.PersistentFlags().BoolVar(&initForce, "force", false, "Initialize the project even when the stack requires another version of the Appsody CLI.")
+	initCmd.PersistentFlags().StringArrayVar(&setValues, "set", nil, "Set a value declared by the template in "+templateValuesFile+", as key=value. Can be repeated.")
+	initCmd.PersistentFlags().BoolVar(&renderOnly, "render-only", false, "Render the template with its values in a temporary directory and print its differences with the current directory, without writing anything.")
+	initCmd.PersistentFlags().StringVar(&fromSample, "from-sample", "", "Create the project from the sample application of the stack with the given name instead of its template.")
+	initCmd.PersistentFlags().BoolVar(&noNotice, "no-notice", false, "Do not record the stack, template, source and license of the starter code in the NOTICE file of the project.")
+	initCmd.PersistentFlags().BoolVar(&editorConfig, "editor-config", false, "Add the editor settings recommended by the stack, such as debug launch configurations and formatter configs. Existing files are kept.")
+}
+
+// initTemplate downloads the template of the stack and extracts it in the current directory, only its
+// .appsody-config.yaml with templateless
+func initTemplate(projectType string, projectName string, templateless bool) error {
+	Info.logf("Downloading %s template project from %s", projectType, projectName)
+	filename := projectType + ".tar.gz"
+	if strings.HasSuffix(strings.ToLower(projectName), ".zip") {
+		filename = projectType + ".zip"
+	}
+
+	filename, err := downloadTemplateArchive(projectName, filename)
+	if err != nil {
+		return errors.Errorf("Error downloading tar %v", err)
+
+	}
+	Info.log("Download complete. Extracting files from ", filepath.Base(filename))
+	//if noTemplate
+	errUntar := extractTemplate(filename, templateless)
+	if errUntar == nil && !templateless {
+		recordScaffold(filename, projectName)
+	}
+
+	if dryrun {
+		planned(planDelete, filename, "downloaded template")
+	} else {
+		err = os.Remove(filename)
+		if err != nil {
+			Warning.log("Unable to remove temporary file ", filename)
+		}
+	}
+	if errUntar != nil {
+		Error.log("Error extracting project template: ", errUntar)
+		Info.log("It is recommended that you run `appsody init <stack>` in an empty directory.")
+		Info.log("If you wish to proceed and overwrite files in the current directory, try again with the --overwrite option.")
+		return errors.Errorf("Error extracting project template: %v", errUntar)
+
+	}
+	return nil
+}
+
+// adoptExistingProject inspects the Dockerfile and the files of an existing project and returns the stack
+// to wire around it. If the user already chose a stack, it is only checked against what was detected.
+func adoptExistingProject(index *RepoIndex, projectType string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", errors.Errorf("Error getting current directory %v", err)
+	}
+	detected := detectLanguages(dir)
+	fromImage, err := detectDockerfileLanguages(fromDockerfile)
+	if err != nil {
+		return "", errors.Errorf("Could not read the Dockerfile to adopt: %v", err)
+	}
+	seen := make(map[string]bool)
+	var languages []languageDetector
+	var languageNames []string
+	for _, language := range append(detected, fromImage...) {
+		if !seen[language.Language] {
+			seen[language.Language] = true
+			languages = append(languages, language)
+			languageNames = append(languageNames, language.Language)
+		}
+	}
+	if len(languages) > 0 {
+		Info.log("Detected ", strings.Join(languageNames, ", "), " in the existing project")
+	}
+
+	suggestions := suggestStacks(index, languages)
+	if projectType != "" {
+		for _, suggestion := range suggestions {
+			if suggestion.ID == projectType {
+				return projectType, nil
+			}
+		}
+		Warning.logf("The stack %s does not look like a match for the existing project. Make sure it uses the same language and framework.", projectType)
+		return projectType, nil
+	}
+	if len(suggestions) == 0 {
+		return "", errors.New("Could not find a stack matching the existing project. Run `appsody list` to see the available stacks and run `appsody init <stack> --from-dockerfile`.")
+	}
+	for i, suggestion := range suggestions {
+		if i == 3 {
+			break
+		}
+		Info.logf("Suggested stack: %s (score %d)", suggestion.ID, suggestion.Score)
+	}
+	Info.logf("Adopting the existing project with the %s stack. Run `appsody init <stack> --from-dockerfile` to choose a different one.", suggestions[0].ID)
+	return suggestions[0].ID, nil
 }
 
 //Runs the .appsody-init.sh/bat files if necessary
@@ -159,11 +332,15 @@ func install() error {
 		return errors.Errorf("%v", perr)
 
 	}
-	platformDefinition := getProjectConfig().Platform
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	platformDefinition := config.Platform
 
 	Debug.logf("Setting up the development environment for projectDir: %s and platform: %s", projectDir, platformDefinition)
 
-	err := extractAndInitialize()
+	err = extractAndInitialize()
 	if err != nil {
 		// For some reason without this sleep, the [InitScript] output log would get cut off and
 		// intermixed with the following Warning logs when verbose logging. Adding this sleep as a workaround.
@@ -171,93 +348,100 @@ func install() error {
 		Warning.log("The stack init script failed: ", err)
 		Warning.log("Your local IDE may not build properly, but the Appsody container should still work.")
 		Warning.log("To try again, resolve the issue then run `appsody init` with no arguments.")
-		os.Exit(0)
 	}
 	return nil
 }
 
+// downloadFileToDisk downloads a URL to a file. The file is removed when the download fails or does not match
+// the digest its index publishes.
 func downloadFileToDisk(url string, destFile string) error {
 	if dryrun {
-		Info.logf("Dry Run -Skipping download of url: %s to destination %s", url, destFile)
-
+		planned(planDownload, url, "to "+destFile)
+	} else if cacheable(url) {
+		if err := cachedDownload(url, destFile); err != nil {
+			os.Remove(destFile)
+			return err
+		}
 	} else {
 		outFile, err := os.Create(destFile)
 		if err != nil {
 			return err
 		}
-		defer outFile.Close()
-
 		err = downloadFile(url, outFile)
+		outFile.Close()
 		if err != nil {
+			os.Remove(destFile)
 			return err
 		}
 	}
 	return nil
 }
 
-func untar(file string, noTemplate bool) error {
+// downloadTemplateArchive downloads a template or sample archive to the scratch directory, rather than to the
+// project, and returns its path. Nothing is left in the project when the download fails.
+func downloadTemplateArchive(url string, name string) (string, error) {
+	scratch, err := scratchDir()
+	if err != nil {
+		return "", errors.Errorf("Could not create the scratch directory: %v", err)
+	}
+	archive := filepath.Join(scratch, name)
+	if err = downloadFileToDisk(url, archive); err != nil {
+		return "", err
+	}
+	return archive, nil
+}
 
+// extractTemplate extracts the .tar.gz or .zip template archive in the current directory. With noTemplate
+// only the .appsody-config.yaml file is extracted.
+func extractTemplate(file string, noTemplate bool) error {
+	if err := checkLineEndings(lineEndings); err != nil {
+		return err
+	}
 	if dryrun {
-		Info.log("Dry Run - Skipping untar of file:  ", file)
-	} else {
-		if !overwrite && !noTemplate {
-			err := preCheckTar(file)
-			if err != nil {
-				return err
-			}
+		detail := "template files from " + file
+		if noTemplate {
+			detail = ".appsody-config.yaml from " + file
 		}
-		fileReader, err := os.Open(file)
+		planned(planWrite, ".", detail)
+		return nil
+	}
+	if !overwrite && !noTemplate {
+		err := preCheckArchive(file)
 		if err != nil {
 			return err
 		}
-
-		defer fileReader.Close()
-		gzipReader, err := gzip.NewReader(fileReader)
+	}
+	renderer, err := newTemplateRenderer(file, setValues)
+	if err != nil {
+		return err
+	}
+	return walkArchive(file, func(entry archiveEntry) error {
+		filename, err := safeArchivePath(entry.name)
 		if err != nil {
 			return err
 		}
-		defer gzipReader.Close()
-		tarReader := tar.NewReader(gzipReader)
-		for {
-			header, err := tarReader.Next()
-
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return err
+		if renderer != nil && filepath.ToSlash(filename) == templateValuesFile {
+			return nil
+		}
+		Debug.log("Extracting ", filename)
+
+		if entry.dir {
+			if noTemplate {
+				return nil
 			}
-			if header == nil {
-				continue
+			if _, err := os.Stat(filename); err != nil {
+				return os.MkdirAll(filename, 0755)
 			}
-
-			filename := header.Name
-			Debug.log("Untar creating ", filename)
-
-			if header.Typeflag == tar.TypeDir && !noTemplate {
-				if _, err := os.Stat(filename); err != nil {
-					err := os.MkdirAll(filename, 0755)
-					if err != nil {
-						return err
-					}
-				}
-			} else if header.Typeflag == tar.TypeReg {
-				if !noTemplate || (noTemplate && strings.HasSuffix(filename, ".appsody-config.yaml")) {
-
-					f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-					if err != nil {
-						return err
-					}
-					_, err = io.Copy(f, tarReader)
-					if err != nil {
-						return err
-					}
-					f.Close()
-				}
+			return nil
+		}
+		if !noTemplate || strings.HasSuffix(filename, ".appsody-config.yaml") {
+			if entry, err = renderer.render(filepath.ToSlash(filename), entry); err != nil {
+				return err
 			}
-
+			return extractArchiveFile(filename, entry, lineEndings)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func isFileLaydownSafe(directory string) (bool, error) {
@@ -312,53 +496,32 @@ func inWhiteList(filename string) bool {
 	return isWhiteListed
 }
 
-func preCheckTar(file string) error {
+func preCheckArchive(file string) error {
 	preCheckOK := true
-	fileReader, err := os.Open(file)
-	if err != nil {
-		return err
-	}
-	defer fileReader.Close()
-
-	gzipReader, err := gzip.NewReader(fileReader)
-	if err != nil {
-		return err
-	}
-	defer gzipReader.Close()
-	tarReader := tar.NewReader(gzipReader)
-	// precheck the tar for whitelisted files
-	for {
-		header, err := tarReader.Next()
-
-		if err == io.EOF {
-
-			break
-		} else if err != nil {
-
-			return err
-		}
-		if header == nil {
-			continue
-		} else {
-
-			if inWhiteList(header.Name) {
-				fileInfo, err := os.Stat(header.Name)
-				if err == nil {
-					if !fileInfo.IsDir() {
-						preCheckOK = false
-						Warning.log("Conflict: " + header.Name + " exists in the file system and the template project.")
-
-					}
+	// precheck the archive for whitelisted files
+	err := walkArchive(file, func(entry archiveEntry) error {
+		if inWhiteList(entry.name) {
+			fileInfo, err := os.Stat(entry.name)
+			if err == nil {
+				if !fileInfo.IsDir() {
+					preCheckOK = false
+					Warning.log("Conflict: " + entry.name + " exists in the file system and the template project.")
 
 				}
+
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	if !preCheckOK {
 		err = errors.New("conflicts exist")
 	}
 	return err
 }
+
 func extractAndInitialize() error {
 
 	var err error
@@ -372,7 +535,11 @@ func extractAndInitialize() error {
 	//Determine if we need to run extract
 	//We run it only if there is an initialization script to run locally
 	//Checking if the script is present on the image
-	stackImage := getProjectConfig().Platform
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	stackImage := config.Platform
 	bashCmd := "find /project -type f -name " + scriptFileName
 	cmdOptions := []string{"--rm"}
 	Debug.log("Attempting to run ", bashCmd, " on image ", stackImage, " with options: ", cmdOptions)
@@ -401,10 +568,12 @@ func extractAndInitialize() error {
 		}
 		// set the --target-dir flag for extract
 		targetDir = workdir
-		extractCmd.Run(extractCmd, nil)
+		if err = extractProject(); err != nil {
+			return err
+		}
 
 	} else {
-		Info.log("Dry Run skipping extract.")
+		planned(planWrite, workdir, "extracted project")
 	}
 
 	scriptPath := filepath.Join(workdir, scriptFile)
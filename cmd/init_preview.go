@@ -0,0 +1,106 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+)
+
+// preview is the --preview option of init
+var preview bool
+
+// previewTemplate downloads the template of a stack and lists the files it would create in dir, and the
+// ones that already exist there, without writing anything in dir
+func previewTemplate(templateURL string, dir string, noTemplate bool) error {
+	scratch, err := scratchDir()
+	if err != nil {
+		return err
+	}
+	archive := filepath.Join(scratch, archiveName(templateURL))
+	out, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	err = downloadFile(templateURL, out)
+	out.Close()
+	if err != nil {
+		return fmt.Errorf("Error downloading the template %v", err)
+	}
+
+	entries := map[string]bool{}
+	err = walkArchive(archive, func(entry archiveEntry) error {
+		name, err := safeArchivePath(entry.name)
+		if err != nil || name == "." {
+			return err
+		}
+		if noTemplate && name != ConfigFile {
+			return nil
+		}
+		entries[filepath.ToSlash(name)] = entry.dir
+		// the archives do not always list the parent directories
+		for parent := path.Dir(filepath.ToSlash(name)); parent != "."; parent = path.Dir(parent) {
+			entries[parent] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := uitable.New()
+	table.MaxColWidth = 100
+	table.AddRow("PATH", "STATUS")
+	files, conflicts := 0, 0
+	for _, name := range names {
+		isDir := entries[name]
+		label := strings.Repeat("  ", strings.Count(name, "/")) + path.Base(name)
+		status := "new"
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			status = "exists"
+			if !isDir || !info.IsDir() {
+				status = "conflict"
+				conflicts++
+			}
+		}
+		if isDir {
+			label += "/"
+		} else {
+			files++
+		}
+		table.AddRow(label, status)
+	}
+	Info.logf("The template %s would create in %s:\n%s", templateURL, dir, table.String())
+	switch {
+	case conflicts > 0 && overwrite:
+		Info.logf("%d file(s), %d of them already exist and would be overwritten.", files, conflicts)
+	case conflicts > 0:
+		Info.logf("%d file(s), %d of them already exist. Use --overwrite to replace them, or --no-template to only create %s.", files, conflicts, ConfigFile)
+	default:
+		Info.logf("%d file(s), none of them exist yet.", files)
+	}
+	return nil
+}
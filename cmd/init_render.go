@@ -0,0 +1,251 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// templateValuesFile declares the values a template archive substitutes in its files
+const templateValuesFile = ".appsody-values.yaml"
+
+// setValues are the --set key=value options of init
+var setValues []string
+
+// renderOnly is the --render-only option of init
+var renderOnly bool
+
+// templateValue is a value of a template, referred to as [[ .Values.name ]] in its files
+type templateValue struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Default     string `yaml:"default,omitempty"`
+}
+
+// templateValues is the .appsody-values.yaml file of a template. Render lists the slash separated path
+// patterns of the files that are rendered, every text file when it is empty.
+type templateValues struct {
+	Values []templateValue `yaml:"values"`
+	Render []string        `yaml:"render,omitempty"`
+}
+
+// templateRenderer substitutes the values of a template in the files it extracts
+type templateRenderer struct {
+	values   map[string]string
+	patterns []string
+}
+
+// readTemplateValues returns the values declared by a template archive, nil when it declares none
+func readTemplateValues(file string) (*templateValues, error) {
+	var values *templateValues
+	err := walkArchive(file, func(entry archiveEntry) error {
+		name, err := safeArchivePath(entry.name)
+		if err != nil || entry.dir || filepath.ToSlash(name) != templateValuesFile {
+			return err
+		}
+		reader, err := entry.open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		values = &templateValues{}
+		if err = yaml.UnmarshalStrict(data, values); err != nil {
+			return errors.Errorf("The %s file of the template is not valid: %v", templateValuesFile, err)
+		}
+		return nil
+	})
+	return values, err
+}
+
+// newTemplateRenderer returns the renderer of a template archive with the --set overrides, nil when
+// the template declares no values
+func newTemplateRenderer(file string, overrides []string) (*templateRenderer, error) {
+	declared, err := readTemplateValues(file)
+	if err != nil {
+		return nil, err
+	}
+	if declared == nil {
+		if len(overrides) > 0 {
+			return nil, errors.Errorf("The template declares no values in %s, --set cannot be used with it", templateValuesFile)
+		}
+		return nil, nil
+	}
+	renderer := &templateRenderer{values: map[string]string{}, patterns: declared.Render}
+	var names []string
+	for _, value := range declared.Values {
+		renderer.values[value.Name] = value.Default
+		names = append(names, value.Name)
+	}
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("The value %q is not of the form key=value", override)
+		}
+		if _, ok := renderer.values[parts[0]]; !ok {
+			sort.Strings(names)
+			return nil, errors.Errorf("The template has no value %s. Its values are: %s", parts[0], strings.Join(names, ", "))
+		}
+		renderer.values[parts[0]] = parts[1]
+	}
+	return renderer, nil
+}
+
+// renders tells whether the file at the slash separated path is rendered
+func (renderer *templateRenderer) renders(name string) bool {
+	if len(renderer.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range renderer.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(name)); matched && !strings.Contains(pattern, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the entry with the values substituted in its content, when it is a text file that is rendered
+func (renderer *templateRenderer) render(name string, entry archiveEntry) (archiveEntry, error) {
+	if renderer == nil || entry.dir || !renderer.renders(name) {
+		return entry, nil
+	}
+	reader, err := entry.open()
+	if err != nil {
+		return entry, err
+	}
+	data, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return entry, err
+	}
+	if !isText(data) {
+		entry.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(data)), nil }
+		return entry, nil
+	}
+	tmpl, err := template.New(name).Delims("[[", "]]").Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return entry, errors.Errorf("Could not render %s: %v", name, err)
+	}
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, map[string]interface{}{"Values": renderer.values}); err != nil {
+		return entry, errors.Errorf("Could not render %s: %v", name, err)
+	}
+	entry.open = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(out.Bytes())), nil }
+	return entry, nil
+}
+
+// renderTemplateOnly downloads the template of a stack, renders it with the --set values in a scratch
+// directory and prints its differences with the files of dir, without writing anything in dir
+func renderTemplateOnly(templateURL string, dir string) error {
+	rendered, err := renderStackTemplate(templateURL, setValues)
+	if err != nil {
+		return err
+	}
+	files, err := treeFiles(rendered)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var diff strings.Builder
+	changed := 0
+	for _, name := range names {
+		to, err := ioutil.ReadFile(files[name])
+		if err != nil {
+			return err
+		}
+		fromLabel := "current/" + name
+		from, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			fromLabel = "/dev/null"
+		} else if err != nil {
+			return err
+		} else if bytes.Equal(from, to) {
+			continue
+		}
+		changed++
+		if !isText(from) || !isText(to) {
+			diff.WriteString(fmt.Sprintf("Binary file %s differs\n", name))
+			continue
+		}
+		diff.WriteString(unifiedDiff(fromLabel, "rendered/"+name, splitLines(from), splitLines(to)))
+	}
+	if changed == 0 {
+		Info.logf("The rendered template matches the %d file(s) in %s", len(names), dir)
+		return nil
+	}
+	fmt.Print(diff.String())
+	Info.logf("%d of the %d rendered file(s) differ from %s. Nothing was written.", changed, len(names), dir)
+	return nil
+}
+
+// renderStackTemplate downloads the template and renders it with the key=value values in a scratch directory,
+// which it returns
+func renderStackTemplate(templateURL string, values []string) (string, error) {
+	scratch, err := scratchDir()
+	if err != nil {
+		return "", err
+	}
+	archive := filepath.Join(scratch, archiveName(templateURL))
+	out, err := os.Create(archive)
+	if err != nil {
+		return "", err
+	}
+	err = downloadFile(templateURL, out)
+	out.Close()
+	if err != nil {
+		return "", errors.Errorf("Error downloading the template %v", err)
+	}
+	renderer, err := newTemplateRenderer(archive, values)
+	if err != nil {
+		return "", err
+	}
+	if renderer == nil {
+		Info.logf("The template declares no values in %s, its files are compared as they are", templateValuesFile)
+	}
+	rendered := filepath.Join(scratch, "rendered")
+	err = walkArchive(archive, func(entry archiveEntry) error {
+		name, err := safeArchivePath(entry.name)
+		if err != nil || entry.dir || filepath.ToSlash(name) == templateValuesFile {
+			return err
+		}
+		if entry, err = renderer.render(filepath.ToSlash(name), entry); err != nil {
+			return err
+		}
+		return extractArchiveFile(filepath.Join(rendered, name), entry, lineEndings)
+	})
+	return rendered, err
+}
@@ -0,0 +1,96 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// allowInsecure is the --allow-insecure option of repo add
+var allowInsecure bool
+
+// insecureTemplateURLs are the plain http template URLs of the indexes of the repositories marked allowInsecure
+var insecureTemplateURLs = map[string]bool{}
+var insecureTemplateLock sync.Mutex
+
+// allowInsecureTemplates allows the plain http template URLs of the versions of a stack
+func allowInsecureTemplates(project ProjectVersions) {
+	insecureTemplateLock.Lock()
+	defer insecureTemplateLock.Unlock()
+	for _, version := range project {
+		for _, templateURL := range version.URLs {
+			insecureTemplateURLs[templateURL] = true
+		}
+	}
+}
+
+// isLoopbackHost tells whether the host of a URL is this machine, which plain http can not be tampered with on
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkSecureURL refuses the plain http URLs of other machines: anyone on the network path could change the
+// index or the templates downloaded from them. allowed is set for the repositories marked allowInsecure.
+func checkSecureURL(href string, allowed bool) error {
+	target, err := url.Parse(href)
+	if err != nil {
+		return errors.Errorf("Invalid URL %s: %v", href, err)
+	}
+	if !strings.EqualFold(target.Scheme, "http") || isLoopbackHost(target.Hostname()) {
+		return nil
+	}
+	if allowed {
+		Debug.log("Downloading from a plain http URL the repository allows: ", href)
+		return nil
+	}
+	return errors.Errorf("The URL %s uses plain http, which is not secure. Use https, or add the repository with appsody repo add --allow-insecure if you trust the network it is on.", href)
+}
+
+// insecureAllowed tells whether a URL is on the server of a repository marked allowInsecure, or is a
+// template of one
+func insecureAllowed(href string) bool {
+	insecureTemplateLock.Lock()
+	insecure := insecureTemplateURLs[href]
+	insecureTemplateLock.Unlock()
+	if insecure {
+		return true
+	}
+	target, err := url.Parse(href)
+	if err != nil || target.Host == "" || !strings.EqualFold(target.Scheme, "http") {
+		return false
+	}
+	repos, err := stackRepos()
+	if err != nil {
+		return false
+	}
+	for _, repo := range repos.Repositories {
+		if !repo.AllowInsecure {
+			continue
+		}
+		if repoURL, err := url.Parse(repo.URL); err == nil && sameServer(repoURL, target) {
+			return true
+		}
+	}
+	return false
+}
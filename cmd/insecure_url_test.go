@@ -0,0 +1,93 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+func TestCheckSecureURL(t *testing.T) {
+	var tests = []struct {
+		url     string
+		allowed bool
+		err     string // expected in the error, "" when the URL is accepted
+	}{
+		{"https://example.com/index.yaml", false, ""},
+		{"file:///tmp/index.yaml", false, ""},
+		{"http://localhost:8080/index.yaml", false, ""},
+		{"http://127.0.0.1/index.yaml", false, ""},
+		{"http://[::1]:8080/index.yaml", false, ""},
+		{"HTTP://example.com/index.yaml", false, "uses plain http"},
+		{"http://example.com/index.yaml", false, "uses plain http"},
+		{"http://example.com/index.yaml", true, ""},
+		{"http://exa mple.com/index.yaml", false, "Invalid URL"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := cmd.CheckSecureURL(test.url, test.allowed)
+			if test.err == "" && err != nil {
+				t.Errorf("Expected the URL to be accepted, got %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected an error with %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+const insecureRepos = `apiVersion: v1
+generated: 2019-09-01T00:00:00Z
+repositories:
+- name: trusted
+  url: http://trusted.example.com:8080/stacks/index.yaml
+  allowInsecure: true
+- name: untrusted
+  url: http://untrusted.example.com/index.yaml
+`
+
+func TestInsecureAllowed(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", insecureRepos)
+	defer cleanup()
+	cmd.AllowInsecureTemplates(cmd.ProjectVersions{
+		{URLs: []string{"http://templates.example.com/nodejs.tar.gz"}},
+	})
+
+	var tests = []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://trusted.example.com:8080/stacks/index.yaml", true},
+		{"http://trusted.example.com:8080/templates/nodejs.tar.gz", true},
+		{"http://TRUSTED.example.com:8080/index.yaml", true},
+		{"http://trusted.example.com/index.yaml", false},
+		{"http://trusted.example.com:9090/index.yaml", false},
+		{"https://trusted.example.com:8080/index.yaml", false},
+		{"http://untrusted.example.com/index.yaml", false},
+		{"http://other.example.com/index.yaml", false},
+		{"http://templates.example.com/nodejs.tar.gz", true},
+		{"http://templates.example.com/java.tar.gz", false},
+		{"trusted.example.com:8080/index.yaml", false},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if allowed := cmd.InsecureAllowed(test.url); allowed != test.allowed {
+				t.Errorf("Expected %s to be allowed: %v, got %v", test.url, test.allowed, allowed)
+			}
+		})
+	}
+}
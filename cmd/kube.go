@@ -0,0 +1,125 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var kubeconfig string
+
+// kubeContext is the kube-context of the kubeconfig to use, its current context when empty
+var kubeContext string
+
+// serviceAccountDir is where Kubernetes mounts the service account of a pod
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// inCluster tells whether the CLI runs in a pod, such as a CI job, and has no kubeconfig to use instead
+// of the pod's service account
+func inCluster() bool {
+	if kubeconfig != "" || os.Getenv("KUBECONFIG") != "" || os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return false
+	}
+	if found, _ := exists(filepath.Join(UserHomeDir(), ".kube", "config")); found {
+		return false
+	}
+	found, _ := exists(filepath.Join(serviceAccountDir, "token"))
+	return found
+}
+
+// serviceAccountNamespace returns the namespace of the pod the CLI runs in
+func serviceAccountNamespace() string {
+	data, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// kubectlConnArgs adds the options telling kubectl which cluster to talk to: the --context and --kubeconfig file, or,
+// when running in a pod, a kubeconfig for the API server and the pod's service account
+func kubectlConnArgs(args ...string) []string {
+	if traceHTTP {
+		args = append(args, "-v=7")
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	if kubeconfig != "" {
+		return append(args, "--kubeconfig", kubeconfig)
+	}
+	if inCluster() {
+		inClusterConfig, err := writeInClusterKubeconfig()
+		if err != nil {
+			Warning.log("Could not write the kubeconfig for the service account: ", err)
+			return args
+		}
+		args = append(args, "--kubeconfig", inClusterConfig)
+	}
+	return args
+}
+
+// writeInClusterKubeconfig writes a kubeconfig pointing at the service account files, rather than passing the
+// token on the command line where it would show in the logs
+func writeInClusterKubeconfig() (string, error) {
+	server := "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	config := map[string]interface{}{
+		"apiVersion":      "v1",
+		"kind":            "Config",
+		"current-context": "in-cluster",
+		"clusters": []interface{}{map[string]interface{}{
+			"name":    "in-cluster",
+			"cluster": map[string]string{"server": server, "certificate-authority": filepath.Join(serviceAccountDir, "ca.crt")},
+		}},
+		"users": []interface{}{map[string]interface{}{
+			"name": "service-account",
+			"user": map[string]string{"tokenFile": filepath.Join(serviceAccountDir, "token")},
+		}},
+		"contexts": []interface{}{map[string]interface{}{
+			"name":    "in-cluster",
+			"context": map[string]string{"cluster": "in-cluster", "user": "service-account", "namespace": serviceAccountNamespace()},
+		}},
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(getStateDir(), "in-cluster.kubeconfig")
+	if err = ioutil.WriteFile(file, data, 0600); err != nil {
+		return "", err
+	}
+	Debug.log("Using the in-cluster service account to talk to ", server)
+	return file, nil
+}
+
+// kubectlArgs adds the cluster options and the --namespace option to the kubectl arguments.
+// In a pod, the namespace defaults to the pod's own.
+func kubectlArgs(args ...string) []string {
+	args = kubectlConnArgs(args...)
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	} else if inCluster() {
+		if ns := serviceAccountNamespace(); ns != "" {
+			args = append(args, "--namespace", ns)
+		}
+	}
+	return args
+}
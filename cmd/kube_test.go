@@ -0,0 +1,99 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+var kubectlArgsTests = []struct {
+	testName   string
+	env        map[string]string // KUBERNETES_SERVICE_HOST is set unless given
+	kubeconfig string
+	context    string
+	namespace  string
+	expected   string // the arguments after get pods, IN-CLUSTER for the kubeconfig of the service account
+}{
+	{"In cluster", nil, "", "", "", "--kubeconfig IN-CLUSTER --namespace ci"},
+	{"In cluster namespace", nil, "", "", "dev", "--kubeconfig IN-CLUSTER --namespace dev"},
+	{"Kubeconfig option", nil, "/tmp/kubeconfig", "", "", "--kubeconfig /tmp/kubeconfig"},
+	{"KUBECONFIG", map[string]string{"KUBECONFIG": "/tmp/kubeconfig"}, "", "", "", ""},
+	{"Not in a pod", map[string]string{"KUBERNETES_SERVICE_HOST": ""}, "", "", "", ""},
+	{"Kube-context", map[string]string{"KUBERNETES_SERVICE_HOST": ""}, "", "staging", "dev", "--context staging --namespace dev"},
+	{"Kube-context in cluster", nil, "", "staging", "", "--context staging --kubeconfig IN-CLUSTER --namespace ci"},
+}
+
+func TestKubectlArgs(t *testing.T) {
+	_, home, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	// the user has no kubeconfig of their own
+	for name, value := range map[string]string{"HOME": home, "USERPROFILE": home, "KUBERNETES_SERVICE_PORT": "443"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+	serviceAccount := filepath.Join(home, "serviceaccount")
+	if err := os.MkdirAll(serviceAccount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"token": "the-token", "namespace": "ci\n", "ca.crt": "the-ca"} {
+		if err := ioutil.WriteFile(filepath.Join(serviceAccount, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range kubectlArgsTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			env := map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1", "KUBECONFIG": ""}
+			for name, value := range tt.env {
+				env[name] = value
+			}
+			for name, value := range env {
+				defer os.Setenv(name, os.Getenv(name))
+				os.Setenv(name, value)
+			}
+			args := cmd.KubectlArgs(serviceAccount, tt.kubeconfig, tt.context, tt.namespace, "get", "pods")
+			var inClusterConfig string
+			for i, arg := range args {
+				if strings.HasSuffix(arg, "in-cluster.kubeconfig") {
+					inClusterConfig, args[i] = arg, "IN-CLUSTER"
+				}
+			}
+			if got := strings.TrimSpace(strings.TrimPrefix(strings.Join(args, " "), "get pods")); got != tt.expected {
+				t.Errorf("Expected the arguments %q, got %q", tt.expected, got)
+			}
+			if inClusterConfig == "" {
+				return
+			}
+			config, err := ioutil.ReadFile(inClusterConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []string{"server: https://10.0.0.1:443", "tokenFile: " + filepath.Join(serviceAccount, "token"), "namespace: ci"} {
+				if !strings.Contains(string(config), expected) {
+					t.Errorf("Expected %q in the kubeconfig of the service account, got\n%s", expected, config)
+				}
+			}
+			if strings.Contains(string(config), "the-token") {
+				t.Error("The kubeconfig of the service account has the token itself rather than its file")
+			}
+		})
+	}
+}
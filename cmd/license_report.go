@@ -0,0 +1,139 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var licenseReportFile string
+
+// licenseEntry is a component of the built image and its license.
+// Stack scanners print a JSON array of these.
+type licenseEntry struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	License string `json:"license"`
+	// Source is application for the project dependencies and stack for the stack image
+	Source string `json:"source"`
+}
+
+// scanApplicationLicenses runs the stack's APPSODY_LICENSE_SCAN command in the stack image, with the project
+// mounted as for appsody run, and returns the licenses of the application dependencies
+func scanApplicationLicenses(stackImage string, projectName string) ([]licenseEntry, error) {
+	scanCommand, err := getEnvVar("APPSODY_LICENSE_SCAN")
+	if err != nil {
+		return nil, err
+	}
+	if scanCommand == "" {
+		Warning.log("The stack does not provide a license scanner (APPSODY_LICENSE_SCAN), the report only covers the stack image")
+		return nil, nil
+	}
+	volumeArgs, err := getVolumeArgs()
+	if err != nil {
+		return nil, err
+	}
+	options := append([]string{"--rm"}, volumeArgs...)
+	depsDir, err := getEnvVar("APPSODY_DEPS")
+	if err != nil {
+		return nil, err
+	}
+	if depsDir != "" {
+		options = append(options, "-v", projectName+"-deps:"+depsDir)
+	}
+	workDir, err := getEnvVar("APPSODY_PROJECT_DIR")
+	if err != nil {
+		return nil, err
+	}
+	if workDir != "" {
+		options = append(options, "--workdir", workDir)
+	}
+	out, err := DockerRunBashCmd(options, stackImage, scanCommand)
+	if err != nil {
+		return nil, errors.Errorf("The stack license scanner failed: %v", err)
+	}
+	var entries []licenseEntry
+	if err = json.Unmarshal([]byte(out), &entries); err != nil {
+		return nil, errors.Errorf("The stack license scanner did not return a JSON list of licenses: %v", err)
+	}
+	for i := range entries {
+		entries[i].Source = "application"
+	}
+	return entries, nil
+}
+
+// stackImageLicenses returns the license declared by the stack image in the standard OCI label
+func stackImageLicenses(stackImage string) []licenseEntry {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", `{{index .Config.Labels "org.opencontainers.image.licenses"}}`, stackImage).Output()
+	license := strings.TrimSpace(string(out))
+	if err != nil || license == "" || license == "<no value>" {
+		license = "UNKNOWN"
+	}
+	return []licenseEntry{{Name: stackImage, License: license, Source: "stack"}}
+}
+
+// writeLicenseReport writes the report as CSV when the file ends in .csv, JSON otherwise
+func writeLicenseReport(entries []licenseEntry, file string) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Source != entries[j].Source {
+			return entries[i].Source > entries[j].Source
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"name", "version", "license", "source"})
+		for _, entry := range entries {
+			_ = w.Write([]string{entry.Name, entry.Version, entry.License, entry.Source})
+		}
+		w.Flush()
+		data, err = buf.Bytes(), w.Error()
+	} else {
+		data, err = json.MarshalIndent(entries, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// generateLicenseReport aggregates the application and stack image licenses into the report file
+func generateLicenseReport(stackImage string, projectName string, file string) error {
+	if dryrun {
+		planned(planWrite, file, "license report")
+		return nil
+	}
+	entries, err := scanApplicationLicenses(stackImage, projectName)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, stackImageLicenses(stackImage)...)
+	if err = writeLicenseReport(entries, file); err != nil {
+		return errors.Errorf("Could not write the license report: %v", err)
+	}
+	Info.logf("License report of %d components written to %s", len(entries), file)
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The line endings of the text files of templates. Shell scripts with CRLF line endings fail in the
+// Linux containers the project is mounted in, with errors such as "bad interpreter", so except with
+// keep they always get LF line endings.
+const (
+	// auto only converts the shell scripts, the default
+	lineEndingsAuto = "auto"
+	// lf converts every text file to LF
+	lineEndingsLF = "lf"
+	// native converts the text files to CRLF on Windows and to LF elsewhere
+	lineEndingsNative = "native"
+	// keep leaves the files as they are in the template
+	lineEndingsKeep = "keep"
+)
+
+var lineEndingModes = []string{lineEndingsAuto, lineEndingsLF, lineEndingsNative, lineEndingsKeep}
+
+// lineEndings is the --line-endings option of init
+var lineEndings string
+
+// textSniffLength is how much of a file is looked at for a NUL byte, as git does to tell binary files
+const textSniffLength = 8000
+
+// windowsScripts keep their line endings, cmd.exe and PowerShell read both
+var windowsScripts = map[string]bool{".bat": true, ".cmd": true, ".ps1": true}
+
+func checkLineEndings(mode string) error {
+	for _, known := range lineEndingModes {
+		if mode == known {
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown line endings %q, use one of %s", mode, strings.Join(lineEndingModes, ", "))
+}
+
+// isShellScript tells scripts by their #! line, .sh extension or name
+func isShellScript(path string, head []byte) bool {
+	return bytes.HasPrefix(head, []byte("#!")) || strings.HasSuffix(path, ".sh") || scriptNames[filepath.Base(path)]
+}
+
+// isText tells whether the beginning of a file is text
+func isText(head []byte) bool {
+	if len(head) > textSniffLength {
+		head = head[:textSniffLength]
+	}
+	return bytes.IndexByte(head, 0) < 0
+}
+
+// needsLineEndings tells whether a file is converted with the mode, from its path and its beginning
+func needsLineEndings(mode string, path string, head []byte) bool {
+	if mode == lineEndingsKeep || windowsScripts[strings.ToLower(filepath.Ext(path))] || !isText(head) {
+		return false
+	}
+	return mode != lineEndingsAuto || isShellScript(path, head)
+}
+
+// convertLineEndings returns the content of a text file with the line endings of the mode
+func convertLineEndings(mode string, path string, data []byte) []byte {
+	lf := bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	if mode == lineEndingsNative && runtime.GOOS == "windows" && !isShellScript(path, data) {
+		return bytes.Replace(lf, []byte("\n"), []byte("\r\n"), -1)
+	}
+	return lf
+}
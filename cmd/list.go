@@ -23,21 +23,57 @@ import (
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List the Appsody stacks available to init",
-	Long:  ``,
+	Long: `This lists the stacks of the configured repositories, with the latest version of each one.
+
+With --updates, it lists the projects of your workspace directories instead, see appsody projects, with the stack
+version each project uses and the latest version of the stack in the repositories, to find the projects that are out
+of date. A project whose stack is tagged with a major.minor version, such as 0.2, is up to date as long as the latest
+version is a 0.2.x version.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
 		var index RepoIndex
-		err := index.getIndex()
+		err = index.getIndex()
 		if err != nil {
 			return errors.Errorf("Could not read index: %v", err)
 
 		}
-		Info.log("\n", index.listProjects())
+		if listUpdates {
+			return listStackUpdates(&index, structured)
+		}
+		if structured {
+			if err = index.loadShards(""); err != nil {
+				return err
+			}
+			// the stacks of the shards are all in the index now
+			index.Shards = nil
+			return printStructured(&index)
+		}
+		if listSamples {
+			Info.log("\n", index.listSamples())
+		} else {
+			Info.log("\n", index.listProjects())
+		}
+		index.logOffline()
 		return nil
 	},
 }
 
+var listSamples bool
+
+// listAllVersions is the --all-versions option, to list every version of the stacks instead of the latest one
+var listAllVersions bool
+
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.PersistentFlags().BoolVar(&refreshIndexes, "refresh", false, "Download the index of every repository, even when its cached index is fresh.")
+	listCmd.PersistentFlags().BoolVar(&listAllVersions, "all-versions", false, "List every released version of the stacks, the latest first, instead of only the latest one.")
+	listCmd.PersistentFlags().BoolVar(&listUpdates, "updates", false, "List the projects of your workspace directories whose stack has a newer version in the repositories.")
+	listCmd.PersistentFlags().StringArrayVar(&projectRoots, "root", nil, "Directory to search for projects with --updates, instead of the workspaces of the CLI configuration. Can be repeated.")
+	listCmd.PersistentFlags().IntVar(&projectsMaxDepth, "max-depth", 4, "How many directories deep to search for projects with --updates.")
+	listCmd.PersistentFlags().BoolVar(&listSamples, "samples", false, "List the sample applications of the stacks, to create a project from with appsody init <stack> --from-sample <sample>.")
 
 }
@@ -0,0 +1,149 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+var logLevel string
+var logFormat string
+var logTimestamps bool
+
+// logLevels orders the levels of --log-level
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// logField is a key and value of a structured log message, written as key=value in text and as a property in JSON
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// logFields pairs the alternating keys and values of logw
+func logFields(keyvals []interface{}) []logField {
+	var fields []logField
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields = append(fields, logField{fmt.Sprint(keyvals[i]), keyvals[i+1]})
+	}
+	return fields
+}
+
+// logw logs a message with structured fields, such as Debug.logw("Downloading", "url", href). The fields are
+// kept apart from the message in the JSON format so that the log of a CI job can be filtered on them.
+func (l appsodylogger) logw(message string, keyvals ...interface{}) {
+	l.internalLog(message, logFields(keyvals))
+}
+
+// levelName is the --log-level level of the logger. The container, docker, init script and HTTP output are
+// the output of the command, at the info level.
+func (l appsodylogger) levelName() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Warning:
+		return "warn"
+	case Error:
+		return "error"
+	}
+	return "info"
+}
+
+// logEnabled tells whether the messages of the logger are written. --verbose logs at the debug level, and only
+// the debug, info, warning and error messages are filtered, the output of the containers always is written.
+func logEnabled(l appsodylogger) bool {
+	// before the flags are parsed, or with a level that is not known, the info level
+	threshold, known := logLevels[logLevel]
+	if !known {
+		threshold = logLevels["info"]
+	}
+	if verbose {
+		threshold = logLevels["debug"]
+	}
+	switch l {
+	case Debug, Info, Warning, Error:
+		return logLevels[l.levelName()] >= threshold
+	}
+	return true
+}
+
+// formatLogLine formats a log message in the --log-format format, with its time when stamped is set
+func formatLogLine(now time.Time, l appsodylogger, message string, fields []logField, stamped bool) string {
+	if logFormat == "json" {
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339Nano),
+			"level": l.levelName(),
+			"msg":   message,
+		}
+		if l.levelName() == "info" && l != Info {
+			entry["source"] = strings.ToLower(string(l))
+		}
+		for _, field := range fields {
+			value := field.value
+			if err, ok := value.(error); ok {
+				value = err.Error()
+			}
+			entry[field.key] = value
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			line, _ = json.Marshal(map[string]string{"time": now.Format(time.RFC3339Nano), "level": l.levelName(), "msg": message})
+		}
+		return string(line)
+	}
+	var line strings.Builder
+	if stamped {
+		line.WriteString(now.Format(time.RFC3339) + " [" + string(l) + "] ")
+	}
+	line.WriteString(message)
+	for _, field := range fields {
+		value := fmt.Sprint(field.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line.WriteString(" " + field.key + "=" + value)
+	}
+	return line.String()
+}
+
+// checkLogFlags fails the command when --log-level or --log-format is not known
+func checkLogFlags() error {
+	if _, ok := logLevels[logLevel]; !ok {
+		return errors.Errorf("The log level %q is not debug, info, warn or error", logLevel)
+	}
+	if logFormat != "text" && logFormat != "json" {
+		return errors.Errorf("The log format %q is not text or json", logFormat)
+	}
+	return nil
+}
+
+// normalizeLogFlags accepts the --logfile flags of earlier releases for the --log-file flags
+func normalizeLogFlags(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if strings.HasPrefix(name, "logfile") {
+		name = "log-file" + strings.TrimPrefix(name, "logfile")
+	}
+	return pflag.NormalizedName(name)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Level of the messages written: debug, info, warn or error. --verbose sets it to debug. warn and error also leave out the tables of commands such as list, use -o json for them. The output of the containers is always written.")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of the messages written, on the console and in --log-file: text, or json with one object per line.")
+	rootCmd.PersistentFlags().BoolVar(&logTimestamps, "log-timestamps", false, "Start the messages written on the console with their time and level, as in --log-file.")
+	rootCmd.SetGlobalNormalizationFunc(normalizeLogFlags)
+}
@@ -0,0 +1,177 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var logFile string
+var logFileMaxSize int
+var logFileMaxBackups int
+var logFileMaxAge time.Duration
+
+// rotatedLogTime is the suffix of rotated log files, appsody.log.20191107T153012
+const rotatedLogTime = "20060102T150405"
+
+// rotatingLog is a log file that is rotated when it grows past its maximum size or when the day changes,
+// so that long running commands such as run and serve do not fill the disk. Rotated files are removed
+// when there are more than the maximum number of backups, or when they are older than the maximum age.
+type rotatingLog struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	file       *os.File
+	size       int64
+	opened     time.Time
+	lock       sync.Mutex
+}
+
+var appLog *rotatingLog
+
+// openLogFile starts writing the log messages to the file, with the rotation of the --log-file flags
+func openLogFile(path string) error {
+	log := &rotatingLog{
+		path:       path,
+		maxSize:    int64(logFileMaxSize) * 1024 * 1024,
+		maxBackups: logFileMaxBackups,
+		maxAge:     logFileMaxAge,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Errorf("Could not create the directory of the log file %s: %v", path, err)
+	}
+	if err := log.open(); err != nil {
+		return err
+	}
+	log.prune()
+	appLog = log
+	return nil
+}
+
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Errorf("Could not open the log file %s: %v", l.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size, l.opened = file, info.Size(), info.ModTime()
+	if l.size == 0 {
+		l.opened = time.Now()
+	}
+	return nil
+}
+
+// writeLine writes a formatted log message logged at now, rotating the file first if needed
+func (l *rotatingLog) writeLine(now time.Time, message string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.file == nil {
+		return
+	}
+	line := message + "\n"
+	if l.size > 0 && (l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize || now.YearDay() != l.opened.YearDay() || now.Year() != l.opened.Year()) {
+		if err := l.rotate(now); err != nil {
+			fmt.Fprintln(os.Stderr, "[Warning] Could not rotate the log file: ", err)
+		}
+		if l.file == nil {
+			return
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[Warning] Could not write to the log file: ", err)
+	}
+}
+
+// rotate renames the current file with the time it is rotated at, and starts a new one
+func (l *rotatingLog) rotate(now time.Time) error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Rename(l.path, l.path+"."+now.Format(rotatedLogTime)); err != nil {
+		// keep writing to the same file rather than losing the messages
+		if openErr := l.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	l.prune()
+	return nil
+}
+
+// prune removes the rotated files past the retention
+func (l *rotatingLog) prune() {
+	rotated, _ := filepath.Glob(l.path + ".*")
+	var backups []string
+	for _, file := range rotated {
+		if _, err := time.Parse(rotatedLogTime, strings.TrimPrefix(file, l.path+".")); err == nil {
+			backups = append(backups, file)
+		}
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, file := range backups {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if (l.maxBackups > 0 && i >= l.maxBackups) || (l.maxAge > 0 && time.Since(info.ModTime()) > l.maxAge) {
+			// not logged, the log lock is held
+			os.Remove(file)
+		}
+	}
+}
+
+func (l *rotatingLog) close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// initLogFile opens the --log-file log file
+func initLogFile() {
+	if logFile == "" {
+		return
+	}
+	if err := openLogFile(expandHome(logFile)); err != nil {
+		Warning.log(err)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write the log messages to this file, with their time and level. It is rotated when it grows past --log-file-max-size and every day.")
+	rootCmd.PersistentFlags().IntVar(&logFileMaxSize, "log-file-max-size", 10, "Size in MB past which the log file is rotated. 0 rotates it only every day.")
+	rootCmd.PersistentFlags().IntVar(&logFileMaxBackups, "log-file-max-backups", 5, "Number of rotated log files to keep. 0 keeps them all.")
+	rootCmd.PersistentFlags().DurationVar(&logFileMaxAge, "log-file-max-age", 7*24*time.Hour, "Age past which the rotated log files are removed. 0 keeps them until there are too many.")
+}
@@ -0,0 +1,155 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// knativeUserContainer is the container of the application in the pods of a Knative service, next to the
+// queue-proxy Knative adds
+const knativeUserContainer = "user-container"
+
+var logsK8s, logsFollow, logsPrevious bool
+var logsTail int
+var logsContainer, logsEnvironment string
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the logs of your application",
+	Long: `This shows the logs of the development container of the project, started by appsody run, debug or test.
+
+With --k8s it shows the logs of the pods of the deployed application instead, each line prefixed with its pod.
+With --env the pods are found in the clusters and namespace of that environment of the project, and the lines
+of the clusters are interleaved, prefixed with their kube-context. Use --previous to see the logs of the
+containers that crashed and were restarted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !logsK8s {
+			if logsPrevious || logsEnvironment != "" {
+				return errors.New("--previous and --env show the logs of deployed applications, use them with --k8s")
+			}
+			logsArgs := []string{"logs"}
+			if logsFollow {
+				logsArgs = append(logsArgs, "--follow")
+			}
+			if logsTail >= 0 {
+				logsArgs = append(logsArgs, "--tail", strconv.Itoa(logsTail))
+			}
+			dockerCmd := runtimeCommand("docker", append(logsArgs, containerName)...)
+			dockerCmd.Stdout = os.Stdout
+			dockerCmd.Stderr = os.Stderr
+			if err := dockerCmd.Run(); err != nil {
+				return errors.Errorf("Could not show the logs of the %s container, is it running? %v", containerName, err)
+			}
+			return nil
+		}
+		projectName, err := getProjectName()
+		if err != nil {
+			return err
+		}
+		environment, err := getEnvironment(logsEnvironment)
+		if err != nil {
+			return err
+		}
+		return streamPodLogs(projectName, environment.deployTargets())
+	},
+}
+
+// streamPodLogs runs kubectl logs for the pods of the project in each cluster, and interleaves their lines
+func streamPodLogs(projectName string, targets []*ClusterTarget) error {
+	defaultNamespace := namespace
+	var commands [][]string
+	for _, target := range targets {
+		target.use(defaultNamespace)
+		logsArgs := []string{"logs", "-l", appNameLabel + "=" + projectName, "--prefix", "--max-log-requests", "20"}
+		if logsContainer != "" {
+			logsArgs = append(logsArgs, "--container", logsContainer)
+		}
+		if logsFollow {
+			logsArgs = append(logsArgs, "--follow")
+		}
+		if logsPrevious {
+			logsArgs = append(logsArgs, "--previous")
+		}
+		if logsTail >= 0 {
+			logsArgs = append(logsArgs, "--tail", strconv.Itoa(logsTail))
+		}
+		commands = append(commands, kubectlArgs(logsArgs...))
+	}
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	errs := make([]error, len(targets))
+	for i, target := range targets {
+		prefix := ""
+		if target.Context != "" && len(targets) > 1 {
+			prefix = "[" + target.Context + "] "
+		}
+		kubectlCmd := runtimeCommand("kubectl", commands[i]...)
+		kubectlCmd.Stderr = os.Stderr
+		out, err := kubectlCmd.StdoutPipe()
+		if err == nil {
+			err = kubectlCmd.Start()
+		}
+		if err != nil {
+			return errors.Errorf("Could not run kubectl logs: %v", err)
+		}
+		wait.Add(1)
+		go func(i int, out io.Reader) {
+			defer wait.Done()
+			scanner := bufio.NewScanner(out)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				lock.Lock()
+				fmt.Fprintln(os.Stdout, prefix+scanner.Text())
+				lock.Unlock()
+			}
+			if err := kubectlCmd.Wait(); err != nil {
+				errs[i] = err
+			}
+		}(i, out)
+	}
+	wait.Wait()
+	for i, err := range errs {
+		if err != nil {
+			cluster := "the cluster"
+			if targets[i].Context != "" {
+				cluster = "the " + targets[i].Context + " cluster"
+			}
+			return errors.Errorf("Could not get the logs of the %s pods of %s: %v", projectName, cluster, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	addNameFlags(logsCmd)
+	logsCmd.PersistentFlags().BoolVarP(&logsFollow, "follow", "f", false, "Keep streaming the new lines of the logs.")
+	logsCmd.PersistentFlags().IntVar(&logsTail, "tail", -1, "Number of lines to show from the end of the logs, all of them by default.")
+	logsCmd.PersistentFlags().BoolVar(&logsK8s, "k8s", false, "Show the logs of the pods of the application deployed to your Kubernetes cluster.")
+	logsCmd.PersistentFlags().StringVar(&logsEnvironment, "env", "", "Show the logs of the application deployed with this environment of the project, with --k8s.")
+	logsCmd.PersistentFlags().BoolVar(&logsPrevious, "previous", false, "Show the logs of the previous instance of the containers, the ones that crashed, with --k8s.")
+	logsCmd.PersistentFlags().StringVarP(&logsContainer, "container", "c", knativeUserContainer, "Container of the pods to show the logs of, with --k8s.")
+	logsCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Kubernetes namespace of the application, with --k8s.")
+	logsCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use with --k8s. By default kubectl's own configuration.")
+}
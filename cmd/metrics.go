@@ -0,0 +1,169 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Metrics is the Prometheus endpoint of the application. Stacks declare it in the APPSODY_METRICS variable
+// of the stack image, as ; separated settings such as path=/metrics;port=9464, and projects override it in
+// the metrics section of .appsody-config.yaml:
+//
+//   metrics:
+//     path: /actuator/prometheus
+//     serviceMonitor: true
+//
+// The port is the port of the application by default.
+type Metrics struct {
+	Path string `yaml:"path,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	// ServiceMonitor has deploy generate a ServiceMonitor of the Prometheus operator instead of the
+	// prometheus.io annotations
+	ServiceMonitor bool `yaml:"serviceMonitor,omitempty"`
+	// Disabled stops deploy from declaring the endpoint the stack declares
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// serviceMonitorFile is the manifest of the ServiceMonitor deploy writes in the project directory
+const serviceMonitorFile = "appsody-service-monitor.yaml"
+
+// serviceMonitor is the --service-monitor option of deploy
+var serviceMonitor bool
+
+// deployMetrics is the metrics endpoint of the project being deployed, nil when it has none
+var deployMetrics *Metrics
+
+// getMetrics returns the metrics endpoint the stack declares with the overrides of the project, or nil
+func getMetrics() (*Metrics, error) {
+	var metrics *Metrics
+	settings, err := getEnvVarList("APPSODY_METRICS")
+	if err != nil {
+		return nil, err
+	}
+	if len(settings) > 0 {
+		metrics = &Metrics{}
+		for _, setting := range settings {
+			parts := strings.SplitN(setting, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("APPSODY_METRICS has the setting %q, settings are name=value", setting)
+			}
+			switch name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]); name {
+			case "path":
+				metrics.Path = value
+			case "port":
+				port, err := strconv.Atoi(value)
+				if err != nil || port <= 0 {
+					return nil, errors.Errorf("APPSODY_METRICS has the port %s, it must be a port number", value)
+				}
+				metrics.Port = port
+			default:
+				return nil, errors.Errorf("APPSODY_METRICS has the unknown setting %s", name)
+			}
+		}
+	}
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	if project := config.Metrics; project != nil {
+		if project.Disabled {
+			return nil, nil
+		}
+		if metrics == nil {
+			metrics = &Metrics{}
+		}
+		if project.Path != "" {
+			metrics.Path = project.Path
+		}
+		if project.Port != 0 {
+			metrics.Port = project.Port
+		}
+		metrics.ServiceMonitor = project.ServiceMonitor
+	}
+	if metrics != nil && metrics.Path == "" {
+		metrics.Path = "/metrics"
+	}
+	return metrics, nil
+}
+
+// annotations returns the prometheus.io annotations of the pods, scraped by the usual Prometheus configurations
+func (m *Metrics) annotations(appPort int) map[string]string {
+	if m == nil || m.ServiceMonitor {
+		return nil
+	}
+	port := m.Port
+	if port == 0 {
+		port = appPort
+	}
+	return map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/path":   m.Path,
+		"prometheus.io/port":   strconv.Itoa(port),
+	}
+}
+
+// genServiceMonitor returns the manifest of a ServiceMonitor scraping the pods of a Knative service through
+// the private service Knative creates for them
+func genServiceMonitor(serviceName string, metrics *Metrics) ([]byte, error) {
+	monitor := map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "ServiceMonitor",
+		"metadata": map[string]interface{}{
+			"name":   serviceName,
+			"labels": managedLabels(serviceName),
+		},
+		"spec": map[string]interface{}{
+			"selector": podSelector{MatchLabels: map[string]string{
+				"serving.knative.dev/service":                 serviceName,
+				"networking.internal.knative.dev/serviceType": "Private",
+			}},
+			"endpoints": []map[string]string{{"port": "http", "path": metrics.Path}},
+		},
+	}
+	return yaml.Marshal(monitor)
+}
+
+// writeServiceMonitor writes the ServiceMonitor of the project in its directory, and returns the file, or
+// an empty string when the project has no metrics endpoint or does not want a ServiceMonitor
+func writeServiceMonitor(serviceName string, appPort int, metrics *Metrics) (string, error) {
+	if metrics == nil || !metrics.ServiceMonitor {
+		return "", nil
+	}
+	if metrics.Port != 0 && metrics.Port != appPort {
+		return "", errors.Errorf("The metrics endpoint is on port %d, a ServiceMonitor can only reach the port of the application, %d, through Knative. Remove serviceMonitor to use the prometheus.io annotations.", metrics.Port, appPort)
+	}
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := genServiceMonitor(serviceName, metrics)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(projectDir, serviceMonitorFile)
+	if dryrun {
+		planned(planWrite, file, "service monitor")
+		return file, nil
+	}
+	Debug.logf("Generated service monitor:\n%s", manifest)
+	return file, ioutil.WriteFile(file, manifest, 0644)
+}
@@ -0,0 +1,142 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+var networkPolicy bool
+
+// networkPolicyFile is the manifest deploy --network-policy writes in the project directory
+const networkPolicyFile = "appsody-network-policy.yaml"
+
+// dnsPort is allowed out of the application pods so that they can resolve the services they use
+const dnsPort = 53
+
+// knativeQueuePorts are the ports of the Knative queue-proxy sidecar: the requests reach the application
+// through 8012 and 8013, and the autoscaler reads the metrics on 9090
+var knativeQueuePorts = []int{8012, 8013, 9090}
+
+type networkPolicyDoc struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   networkPolicyMeta `yaml:"metadata"`
+	Spec       networkPolicySpec `yaml:"spec"`
+}
+
+type networkPolicyMeta struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type networkPolicySpec struct {
+	PodSelector podSelector         `yaml:"podSelector"`
+	PolicyTypes []string            `yaml:"policyTypes"`
+	Ingress     []networkPolicyRule `yaml:"ingress,omitempty"`
+	Egress      []networkPolicyRule `yaml:"egress,omitempty"`
+}
+
+type podSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels,omitempty"`
+}
+
+type networkPolicyRule struct {
+	Ports []networkPolicyPort `yaml:"ports,omitempty"`
+}
+
+type networkPolicyPort struct {
+	Protocol string `yaml:"protocol"`
+	Port     int    `yaml:"port"`
+}
+
+// genNetworkPolicies returns the manifest of two network policies for the pods of a Knative service: one
+// denying all their traffic, and one allowing the traffic they need, to the port of the application and
+// from them to DNS and to the ports of the services the project declares in .appsody-config.yaml
+func genNetworkPolicies(serviceName string, port int, services []ServiceDependency) ([]byte, error) {
+	selector := serviceSelector(serviceName)
+	labels := managedLabels(serviceName)
+	deny := networkPolicyDoc{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "NetworkPolicy",
+		Metadata:   networkPolicyMeta{Name: serviceName + "-default-deny", Labels: labels},
+		Spec:       networkPolicySpec{PodSelector: selector, PolicyTypes: []string{"Ingress", "Egress"}},
+	}
+	allow := deny
+	allow.Metadata = networkPolicyMeta{Name: serviceName + "-allow", Labels: labels}
+	ingress := []networkPolicyPort{}
+	for _, queuePort := range knativeQueuePorts {
+		ingress = append(ingress, networkPolicyPort{"TCP", queuePort})
+	}
+	if port != 0 {
+		ingress = append(ingress, networkPolicyPort{"TCP", port})
+	} else {
+		Warning.log("The application exposes no port, the network policy only allows the traffic of Knative into it")
+	}
+	allow.Spec.Ingress = []networkPolicyRule{{Ports: ingress}}
+	egress := []networkPolicyPort{{"UDP", dnsPort}, {"TCP", dnsPort}}
+	var servicePorts []int
+	for _, service := range services {
+		if servicePort := service.port(); servicePort != 0 {
+			servicePorts = append(servicePorts, servicePort)
+		} else {
+			Warning.logf("The port of the %s service is not known, set its port in %s to allow traffic to it", service.serviceName(), ConfigFile)
+		}
+	}
+	sort.Ints(servicePorts)
+	for i, servicePort := range servicePorts {
+		if i == 0 || servicePorts[i-1] != servicePort {
+			egress = append(egress, networkPolicyPort{"TCP", servicePort})
+		}
+	}
+	allow.Spec.Egress = []networkPolicyRule{{Ports: egress}}
+
+	var manifest []byte
+	for _, doc := range []networkPolicyDoc{deny, allow} {
+		data, err := yaml.Marshal(&doc)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(append(manifest, "---\n"...), data...)
+	}
+	return manifest, nil
+}
+
+// writeNetworkPolicies writes the network policies of the project in its directory and returns the file
+func writeNetworkPolicies(serviceName string, port int) (string, error) {
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return "", err
+	}
+	config, err := readProjectConfig()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := genNetworkPolicies(serviceName, port, config.Services)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(projectDir, networkPolicyFile)
+	if dryrun {
+		planned(planWrite, file, "network policies")
+		return file, nil
+	}
+	Debug.logf("Generated network policies:\n%s", manifest)
+	return file, ioutil.WriteFile(file, manifest, 0644)
+}
@@ -0,0 +1,107 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"gopkg.in/yaml.v2"
+)
+
+type networkPolicy struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		PolicyTypes []string            `yaml:"policyTypes"`
+		Ingress     []networkPolicyRule `yaml:"ingress"`
+		Egress      []networkPolicyRule `yaml:"egress"`
+	} `yaml:"spec"`
+}
+
+type networkPolicyRule struct {
+	Ports []struct {
+		Protocol string `yaml:"protocol"`
+		Port     int    `yaml:"port"`
+	} `yaml:"ports"`
+}
+
+// ports returns the ports of the rules, as protocol/port
+func (rule networkPolicyRule) ports() []string {
+	var ports []string
+	for _, port := range rule.Ports {
+		ports = append(ports, port.Protocol+"/"+strconv.Itoa(port.Port))
+	}
+	return ports
+}
+
+var networkPolicyTests = []struct {
+	testName        string
+	port            int
+	services        []cmd.ServiceDependency
+	expectedIngress []string
+	expectedEgress  []string
+}{
+	{"No services", 3000, nil,
+		[]string{"TCP/8012", "TCP/8013", "TCP/9090", "TCP/3000"},
+		[]string{"UDP/53", "TCP/53"}},
+	{"No port", 0, nil,
+		[]string{"TCP/8012", "TCP/8013", "TCP/9090"},
+		[]string{"UDP/53", "TCP/53"}},
+	{"Services", 3000, []cmd.ServiceDependency{{Image: "redis:5"}, {Name: "db", Image: "postgres", Port: 5433}, {Name: "cache", Image: "redis"}, {Image: "example/unknown"}},
+		[]string{"TCP/8012", "TCP/8013", "TCP/9090", "TCP/3000"},
+		[]string{"UDP/53", "TCP/53", "TCP/5433", "TCP/6379"}},
+}
+
+func TestGenNetworkPolicies(t *testing.T) {
+	for _, tt := range networkPolicyTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			manifest, err := cmd.GenNetworkPolicies("shop", tt.port, tt.services)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var policies []networkPolicy
+			decoder := yaml.NewDecoder(bytes.NewReader(manifest))
+			for {
+				var policy networkPolicy
+				if err = decoder.Decode(&policy); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				policies = append(policies, policy)
+			}
+
+			if len(policies) != 2 || policies[0].Metadata.Name != "shop-default-deny" || policies[1].Metadata.Name != "shop-allow" {
+				t.Fatalf("Expected the shop-default-deny and shop-allow policies, got %+v", policies)
+			}
+			deny, allow := policies[0], policies[1]
+			if len(deny.Spec.Ingress) != 0 || len(deny.Spec.Egress) != 0 || !reflect.DeepEqual(deny.Spec.PolicyTypes, []string{"Ingress", "Egress"}) {
+				t.Errorf("Expected the default policy to deny all the traffic, got %+v", deny.Spec)
+			}
+			if len(allow.Spec.Ingress) != 1 || !reflect.DeepEqual(allow.Spec.Ingress[0].ports(), tt.expectedIngress) {
+				t.Errorf("Expected the ingress ports %v, got %+v", tt.expectedIngress, allow.Spec.Ingress)
+			}
+			if len(allow.Spec.Egress) != 1 || !reflect.DeepEqual(allow.Spec.Egress[0].ports(), tt.expectedEgress) {
+				t.Errorf("Expected the egress ports %v, got %+v", tt.expectedEgress, allow.Spec.Egress)
+			}
+		})
+	}
+}
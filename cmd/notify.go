@@ -0,0 +1,336 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Notification is where to tell that a long operation, a build, a deploy rollout or a stack CI run, finished
+// or failed. The notifications of the CLI configuration are sent for every project, the ones of the
+// .appsody-config.yaml of a project are sent as well for its own operations:
+//
+//   notifications:
+//   - kind: desktop
+//     minDuration: 1m
+//   - kind: slack
+//     url: ${secret:env:SLACK_WEBHOOK_URL}
+//     outcomes: [failed]
+//   - kind: webhook
+//     url: https://ci.example.com/hooks/appsody
+//     headers:
+//       Authorization: Bearer ${secret:keychain:ci-token}
+//     operations: [deploy]
+//
+// --no-notify, or APPSODY_NO_NOTIFY, turns them off for a command.
+type Notification struct {
+	// Kind is desktop, webhook or slack
+	Kind string `yaml:"kind" mapstructure:"kind"`
+	// URL is where webhook and slack notifications are posted, the incoming webhook of the channel for slack.
+	// It can refer to secrets, see expandSecretRefs.
+	URL string `yaml:"url,omitempty" mapstructure:"url"`
+	// Headers are added to the webhook requests, their values can refer to secrets
+	Headers map[string]string `yaml:"headers,omitempty" mapstructure:"headers"`
+	// Outcomes are succeeded and failed, both when empty
+	Outcomes []string `yaml:"outcomes,omitempty" mapstructure:"outcomes"`
+	// Operations are build, deploy and stack-ci, all of them when empty
+	Operations []string `yaml:"operations,omitempty" mapstructure:"operations"`
+	// MinDuration leaves out the operations that ended sooner, such as 30s
+	MinDuration string `yaml:"minDuration,omitempty" mapstructure:"minDuration"`
+}
+
+// notificationEvent is what a notification tells, and the body of webhook notifications
+type notificationEvent struct {
+	Operation string  `json:"operation"`
+	Outcome   string  `json:"outcome"`
+	Project   string  `json:"project,omitempty"`
+	Command   string  `json:"command"`
+	Seconds   float64 `json:"seconds"`
+	Error     string  `json:"error,omitempty"`
+	Host      string  `json:"host"`
+	Time      string  `json:"time"`
+	Message   string  `json:"message"`
+}
+
+// notifier sends the notifications of one kind
+type notifier interface {
+	notify(settings Notification, event notificationEvent) error
+}
+
+// desktopNotifier shows the notification on the desktop, with notify-send on Linux, osascript on macOS and
+// a balloon tip of PowerShell on Windows
+type desktopNotifier struct{}
+
+// webhookNotifier posts the event as JSON to the URL
+type webhookNotifier struct{}
+
+// slackNotifier posts the message to the incoming webhook of a Slack channel
+type slackNotifier struct{}
+
+// notifiers are the kinds of notifications, by the name they are configured with
+var notifiers = map[string]notifier{
+	"desktop": desktopNotifier{},
+	"webhook": webhookNotifier{},
+	"slack":   slackNotifier{},
+}
+
+// notifyOperations are the commands that send notifications, by the operation they are configured with
+var notifyOperations = map[string]string{
+	"appsody build":    "build",
+	"appsody deploy":   "deploy",
+	"appsody stack ci": "stack-ci",
+}
+
+// noNotifyEnv turns the notifications off, for the appsody processes started by a command that sends its
+// own, such as the projects of build --all --parallel
+const noNotifyEnv = "APPSODY_NO_NOTIFY"
+
+const notifyTimeout = 10 * time.Second
+
+// the --no-notify option of build, deploy and stack ci
+var noNotify bool
+
+// notifyOperation is the operation of the running command, empty when it sends no notifications
+var notifyOperation string
+var notifyCommand string
+var notifyStarted time.Time
+var notificationsSent bool
+
+// initNotifications notes the start of the command when it is an operation that sends notifications
+func initNotifications(cmd *cobra.Command) {
+	operation, ok := notifyOperations[cmd.CommandPath()]
+	if !ok || noNotify || os.Getenv(noNotifyEnv) != "" {
+		return
+	}
+	notifyOperation = operation
+	notifyCommand = cmd.CommandPath()
+	notifyStarted = time.Now()
+}
+
+// notificationSettings are the notifications of the CLI configuration followed by the ones of the project
+func notificationSettings() []Notification {
+	var settings []Notification
+	if cliConfig != nil {
+		if err := cliConfig.UnmarshalKey("notifications", &settings); err != nil {
+			Warning.log("The notifications of the CLI configuration are ignored, they are not valid: ", err)
+			settings = nil
+		}
+	}
+	if _, err := getProjectDir(); err == nil {
+		if config, err := readProjectConfig(); err == nil {
+			settings = append(settings, config.Notifications...)
+		}
+	}
+	return settings
+}
+
+// sendNotifications sends the notifications of the operation of the command once, with its outcome.
+// A notification that cannot be sent is a warning, it never changes the outcome of the command.
+func sendNotifications(err error) {
+	if notifyOperation == "" || notificationsSent {
+		return
+	}
+	notificationsSent = true
+	settings := notificationSettings()
+	if len(settings) == 0 {
+		return
+	}
+	duration := time.Since(notifyStarted)
+	event := newNotificationEvent(duration, err)
+	for _, setting := range settings {
+		sender, ok := notifiers[setting.Kind]
+		if !ok {
+			Warning.logf("Unknown notification kind %q, use one of %s", setting.Kind, notifierNames())
+			continue
+		}
+		if !setting.wants(event, duration) {
+			continue
+		}
+		if dryrun {
+			planned(planNotify, setting.Kind, event.Message)
+			continue
+		}
+		Debug.logf("Sending the %s notification: %s", setting.Kind, event.Message)
+		if err := sender.notify(setting, event); err != nil {
+			Warning.logf("Could not send the %s notification: %v", setting.Kind, err)
+		}
+	}
+}
+
+func newNotificationEvent(duration time.Duration, err error) notificationEvent {
+	event := notificationEvent{
+		Operation: notifyOperation,
+		Outcome:   "succeeded",
+		Command:   notifyCommand,
+		Seconds:   duration.Round(time.Millisecond).Seconds(),
+		Time:      time.Now().UTC().Format(time.RFC3339),
+	}
+	event.Host, _ = os.Hostname()
+	if _, perr := getProjectDir(); perr == nil {
+		event.Project, _ = getProjectName()
+	}
+	subject := notifyCommand
+	if event.Project != "" {
+		subject += " of " + event.Project
+	}
+	elapsed := duration.Round(time.Second).String()
+	if err != nil {
+		event.Outcome = "failed"
+		event.Error = err.Error()
+		event.Message = fmt.Sprintf("%s failed after %s: %s", subject, elapsed, event.Error)
+	} else {
+		event.Message = fmt.Sprintf("%s succeeded in %s", subject, elapsed)
+	}
+	return event
+}
+
+// wants tells whether the notification is sent for the operation, its outcome and how long it took
+func (n Notification) wants(event notificationEvent, duration time.Duration) bool {
+	if len(n.Outcomes) > 0 && !containsFold(n.Outcomes, event.Outcome) {
+		return false
+	}
+	if len(n.Operations) > 0 && !containsFold(n.Operations, event.Operation) {
+		return false
+	}
+	if n.MinDuration != "" {
+		minDuration, err := time.ParseDuration(n.MinDuration)
+		if err != nil {
+			Warning.logf("The minDuration %q of the %s notification is ignored, it is not a duration such as 30s or 2m", n.MinDuration, n.Kind)
+		} else if duration < minDuration {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifierNames lists the kinds of notifications for the error messages
+func notifierNames() string {
+	var names []string
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (desktopNotifier) notify(settings Notification, event notificationEvent) error {
+	title := "Appsody " + event.Operation + " " + event.Outcome
+	var notifyCmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(event.Message), appleScriptString(title))
+		notifyCmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		// the balloon tip stays up for a while, PowerShell is left to show it once the command ends
+		script := "Add-Type -AssemblyName System.Windows.Forms; $n = New-Object System.Windows.Forms.NotifyIcon; " +
+			"$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; " +
+			"$n.ShowBalloonTip(10000, $env:APPSODY_NOTIFY_TITLE, $env:APPSODY_NOTIFY_MESSAGE, 'None'); Start-Sleep 10; $n.Dispose()"
+		notifyCmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+		notifyCmd.Env = append(os.Environ(), "APPSODY_NOTIFY_TITLE="+title, "APPSODY_NOTIFY_MESSAGE="+event.Message)
+		return notifyCmd.Start()
+	default:
+		urgency := "normal"
+		if event.Outcome == "failed" {
+			urgency = "critical"
+		}
+		notifyCmd = exec.Command("notify-send", "--app-name", "appsody", "--urgency", urgency, title, event.Message)
+	}
+	if out, err := notifyCmd.CombinedOutput(); err != nil {
+		return errors.Errorf("%s: %v %s", notifyCmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// appleScriptString quotes the text as an AppleScript string
+func appleScriptString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
+
+func (webhookNotifier) notify(settings Notification, event notificationEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postNotification(settings, body)
+}
+
+func (slackNotifier) notify(settings Notification, event notificationEvent) error {
+	icon := ":white_check_mark:"
+	if event.Outcome == "failed" {
+		icon = ":x:"
+	}
+	body, err := json.Marshal(map[string]string{"text": icon + " " + event.Message})
+	if err != nil {
+		return err
+	}
+	return postNotification(settings, body)
+}
+
+// postNotification posts the JSON body to the URL of the notification, with its headers
+func postNotification(settings Notification, body []byte) error {
+	if settings.URL == "" {
+		return errors.New("it has no url")
+	}
+	target, err := expandSecretRefs(settings.URL)
+	if err != nil {
+		return errors.Errorf("could not resolve its url: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range settings.Headers {
+		value, err = expandSecretRefs(value)
+		if err != nil {
+			return errors.Errorf("could not resolve its %s header: %v", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	client, err := newHTTPClient(notifyTimeout)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var notificationWantsTests = []struct {
+	testName     string
+	notification cmd.Notification
+	operation    string
+	outcome      string
+	duration     time.Duration
+	expected     bool
+}{
+	{"All", cmd.Notification{Kind: "desktop"}, "build", "succeeded", time.Second, true},
+	{"Outcome", cmd.Notification{Kind: "slack", Outcomes: []string{"failed"}}, "build", "failed", time.Second, true},
+	{"Other outcome", cmd.Notification{Kind: "slack", Outcomes: []string{"failed"}}, "build", "succeeded", time.Second, false},
+	{"Operation", cmd.Notification{Kind: "webhook", Operations: []string{"Deploy"}}, "deploy", "succeeded", time.Second, true},
+	{"Other operation", cmd.Notification{Kind: "webhook", Operations: []string{"deploy", "stack-ci"}}, "build", "succeeded", time.Second, false},
+	{"Long enough", cmd.Notification{Kind: "desktop", MinDuration: "1m"}, "build", "succeeded", 2 * time.Minute, true},
+	{"Too short", cmd.Notification{Kind: "desktop", MinDuration: "1m"}, "build", "succeeded", 30 * time.Second, false},
+	// a minDuration that is not a duration is ignored
+	{"Invalid duration", cmd.Notification{Kind: "desktop", MinDuration: "a minute"}, "build", "succeeded", time.Second, true},
+}
+
+func TestNotificationWants(t *testing.T) {
+	for _, tt := range notificationWantsTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			if wants := tt.notification.Wants(tt.operation, tt.outcome, tt.duration); wants != tt.expected {
+				t.Errorf("Expected the notification to be sent: %v, got %v", tt.expected, wants)
+			}
+		})
+	}
+}
+
+// notification is a notification the server received
+type notification struct {
+	path          string
+	authorization string
+	body          map[string]interface{}
+}
+
+var sendNotificationsTests = []struct {
+	testName      string
+	command       string
+	err           error
+	expectedPaths []string // the notifications sent, by the path of their URL
+}{
+	{"Build succeeded", "appsody build", nil, []string{"/hook"}},
+	{"Build failed", "appsody build", errors.New("the build failed"), []string{"/hook", "/slack"}},
+	{"Deploy failed", "appsody deploy", errors.New("the rollout timed out"), []string{"/slack"}},
+	{"Not an operation", "appsody run", nil, nil},
+}
+
+func TestSendNotifications(t *testing.T) {
+	var lock sync.Mutex
+	var received []notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		received = append(received, notification{r.URL.Path, r.Header.Get("Authorization"), body})
+		lock.Unlock()
+	}))
+	defer server.Close()
+	config := "notifications:\n" +
+		"- kind: webhook\n  url: " + server.URL + "/hook\n  headers:\n    Authorization: Bearer ${secret:env:NOTIFY_TOKEN}\n  operations: [build]\n" +
+		"- kind: slack\n  url: " + server.URL + "/slack\n  outcomes: [failed]\n" +
+		"- kind: webhook\n  url: " + server.URL + "/slow\n  minDuration: 1h\n"
+	_, _, cleanup := useTestHome(t, config, "")
+	defer cleanup()
+	os.Setenv("NOTIFY_TOKEN", "token")
+	defer os.Unsetenv("NOTIFY_TOKEN")
+
+	for _, tt := range sendNotificationsTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			lock.Lock()
+			received = nil
+			lock.Unlock()
+			cmd.SendNotifications(tt.command, time.Now().Add(-time.Minute), tt.err)
+
+			lock.Lock()
+			defer lock.Unlock()
+			var paths []string
+			for _, sent := range received {
+				paths = append(paths, sent.path)
+				switch sent.path {
+				case "/hook":
+					if sent.authorization != "Bearer token" {
+						t.Errorf("Expected the Authorization header of the webhook with its secret, got %q", sent.authorization)
+					}
+					outcome := "succeeded"
+					if tt.err != nil {
+						outcome = "failed"
+					}
+					if sent.body["operation"] != "build" || sent.body["outcome"] != outcome || sent.body["command"] != tt.command {
+						t.Errorf("Expected the %s %s event, got %v", tt.command, outcome, sent.body)
+					}
+				case "/slack":
+					if expected := ":x: " + tt.command + " failed after 1m0s: " + tt.err.Error(); sent.body["text"] != expected {
+						t.Errorf("Expected the Slack message %q, got %v", expected, sent.body["text"])
+					}
+				}
+			}
+			if !reflect.DeepEqual(paths, tt.expectedPaths) {
+				t.Errorf("Expected the notifications %v, got %v", tt.expectedPaths, paths)
+			}
+		})
+	}
+}
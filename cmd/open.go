@@ -0,0 +1,199 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// stackEndpoint is a named HTTP endpoint of the application, such as its health check or API docs
+type stackEndpoint struct {
+	Name string
+	Path string
+}
+
+// defaultEndpoint is the endpoint open opens without a name, and the only one of stacks declaring none
+const defaultEndpoint = "app"
+
+var openK8s bool
+
+var openCmd = &cobra.Command{
+	Use:   "open [endpoint]",
+	Short: "Open an endpoint of your application in the browser",
+	Long: `This opens an endpoint of the application in your browser: the root of the application by default, or one of the
+endpoints the stack declares, such as health, metrics or docs for its API documentation.
+
+The endpoint of the development container of appsody run is opened when it runs, otherwise the one of the service
+appsody deploy created. Use --k8s to open the deployed service even when the container runs.
+
+Stacks declare their endpoints in the APPSODY_ENDPOINTS variable of the stack image, such as
+app=/;health=/health;docs=/openapi/ui.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("Specify one endpoint, such as appsody open health")
+		}
+		name := defaultEndpoint
+		if len(args) == 1 {
+			name = args[0]
+		}
+		endpoints, err := stackEndpoints()
+		if err != nil {
+			return err
+		}
+		var endpoint *stackEndpoint
+		var names []string
+		for i := range endpoints {
+			if endpoints[i].Name == name {
+				endpoint = &endpoints[i]
+			}
+			names = append(names, endpoints[i].Name)
+		}
+		if endpoint == nil {
+			return errors.Errorf("The stack declares no %s endpoint.%s Its endpoints are %s.", name, didYouMean(name, names), strings.Join(names, ", "))
+		}
+		baseURL := ""
+		if !openK8s {
+			baseURL = localBaseURL(containerName)
+		}
+		if baseURL == "" {
+			if baseURL, err = deployedBaseURL(); err != nil {
+				return err
+			}
+		}
+		url := strings.TrimSuffix(baseURL, "/") + endpoint.Path
+		Info.log("Opening ", url)
+		if err = openBrowser(url); err != nil {
+			Warning.logf("Could not open the browser, open %s yourself: %v", url, err)
+		}
+		return nil
+	},
+}
+
+// stackEndpoints returns the endpoints the stack declares in APPSODY_ENDPOINTS, the root of the application
+// when it declares none
+func stackEndpoints() ([]stackEndpoint, error) {
+	value, err := getEnvVar("APPSODY_ENDPOINTS")
+	if err != nil {
+		return nil, err
+	}
+	return parseStackEndpoints(value)
+}
+
+// parseStackEndpoints reads the ; separated name=/path endpoints of APPSODY_ENDPOINTS
+func parseStackEndpoints(value string) ([]stackEndpoint, error) {
+	var endpoints []stackEndpoint
+	for _, item := range splitStackList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(strings.TrimSpace(parts[1]), "/") {
+			return nil, errors.Errorf("APPSODY_ENDPOINTS has %q, it lists name=/path endpoints", item)
+		}
+		endpoints = append(endpoints, stackEndpoint{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	if len(endpoints) == 0 {
+		endpoints = []stackEndpoint{{defaultEndpoint, "/"}}
+	}
+	return endpoints, nil
+}
+
+// printEndpoints shows the URLs of the endpoints of the application at the base URL
+func printEndpoints(baseURL string) {
+	endpoints, err := stackEndpoints()
+	if err != nil {
+		Warning.log(err)
+		return
+	}
+	for _, endpoint := range endpoints {
+		Info.logf("  %s: %s%s", endpoint.Name, strings.TrimSuffix(baseURL, "/"), endpoint.Path)
+	}
+}
+
+// publishedBaseURL returns the local URL of the application from the port mappings of docker run, and the
+// mapping of its port, or an empty string when its port is not published to a known host port
+func publishedBaseURL(published []string, containerPort string) (string, portMapping) {
+	for _, spec := range published {
+		mapping, err := parsePortMapping(spec)
+		if err == nil && mapping.Container == containerPort {
+			return "http://" + hostPort(reachableHost(mapping.IP), mapping.Host), mapping
+		}
+	}
+	return "", portMapping{}
+}
+
+// localBaseURL returns the local URL of the application in the running container, or an empty string
+// when the container does not run
+func localBaseURL(container string) string {
+	containerPort, err := getEnvVar("PORT")
+	if err != nil {
+		Debug.log("Could not read the port of the stack: ", err)
+		return ""
+	}
+	if containerPort == "" {
+		return ""
+	}
+	out, err := runtimeCommand("docker", "port", container, containerPort).Output()
+	if err != nil {
+		Debug.log("The container ", container, " does not publish its port: ", err)
+		return ""
+	}
+	// the first mapping, such as 0.0.0.0:3000, [::]:3000 or 127.0.0.1:3000
+	mapping := strings.TrimSpace(strings.Split(string(out), "\n")[0])
+	if i := strings.LastIndex(mapping, ":"); i >= 0 {
+		return "http://" + hostPort(reachableHost(strings.Trim(mapping[:i], "[]")), mapping[i+1:])
+	}
+	return ""
+}
+
+// deployedBaseURL returns the URL of the Knative service of the project
+func deployedBaseURL() (string, error) {
+	projectName, err := getProjectName()
+	if err != nil {
+		return "", err
+	}
+	var service k8sResource
+	if err = kubectlJSON(&service, "get", "ksvc", projectName); err != nil {
+		return "", errors.Errorf("The application is not running: the development container is stopped and the %s service is not found. %v", projectName, err)
+	}
+	if service.Status.URL == "" {
+		return "", errors.Errorf("The %s service has no URL yet, see appsody deploy status", projectName)
+	}
+	return service.Status.URL, nil
+}
+
+// openBrowser opens the URL with the browser of the desktop
+func openBrowser(url string) error {
+	var browserCmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		browserCmd = exec.Command("open", url)
+	case "windows":
+		browserCmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		browserCmd = exec.Command("xdg-open", url)
+	}
+	return browserCmd.Start()
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+	addNameFlags(openCmd)
+	openCmd.PersistentFlags().BoolVar(&openK8s, "k8s", false, "Open the endpoint of the deployed service, even when the development container runs.")
+	openCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Kubernetes namespace of the deployed service.")
+	openCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use. By default kubectl's own configuration.")
+}
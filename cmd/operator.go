@@ -0,0 +1,287 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var operatorVersion string
+var operatorManifestsURL string
+var operatorWatchNamespaces []string
+var operatorWatchAll bool
+var operatorDeleteCRD bool
+var operatorConfirmed bool
+
+const (
+	operatorDeployment   = "appsody-operator"
+	operatorCRDFile      = "appsody-app-crd.yaml"
+	operatorManifestFile = "appsody-app-operator.yaml"
+)
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Install and manage the Appsody operator in your Kubernetes cluster",
+	Long:  ``,
+}
+
+// currentNamespace returns the --namespace flag, or the namespace of the current kubectl context
+func currentNamespace() string {
+	if namespace != "" {
+		return namespace
+	}
+	if inCluster() {
+		if ns := serviceAccountNamespace(); ns != "" {
+			return ns
+		}
+	}
+	out, err := runtimeCommand("kubectl", kubectlConnArgs("config", "view", "--minify", "-o", "jsonpath={..namespace}")...).Output()
+	if ns := strings.TrimSpace(string(out)); err == nil && ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+// operatorDir keeps the manifests the operator was installed with, so uninstall removes exactly what was installed
+func operatorDir(ns string) string {
+	return filepath.Join(getStateDir(), "operator", ns)
+}
+
+// installedOperatorImage returns the image of the operator deployed in the namespace, or "" if there is none
+func installedOperatorImage(ns string) string {
+	out, err := runtimeCommand("kubectl", kubectlConnArgs("get", "deployment", operatorDeployment, "--namespace", ns, "--ignore-not-found",
+		"-o", "jsonpath={.spec.template.spec.containers[0].image}")...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// downloadOperatorManifest downloads one of the operator release manifests and fills in its namespace placeholders
+func downloadOperatorManifest(file string, ns string, watchNamespace string) ([]byte, error) {
+	baseURL := operatorManifestsURL
+	if baseURL == "" {
+		baseURL = "https://github.com/appsody/appsody-operator/releases/download/v" + operatorVersion
+	}
+	url := strings.TrimSuffix(baseURL, "/") + "/" + file
+	Debug.log("Downloading operator manifest ", url)
+	var buf bytes.Buffer
+	if err := downloadFile(url, &buf); err != nil {
+		return nil, errors.Errorf("Could not download %s: %v", url, err)
+	}
+	manifest := strings.Replace(buf.String(), "APPSODY_OPERATOR_NAMESPACE", ns, -1)
+	manifest = strings.Replace(manifest, "APPSODY_WATCH_NAMESPACE", watchNamespace, -1)
+	return []byte(manifest), nil
+}
+
+var operatorInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install or upgrade the Appsody operator",
+	Long: `This installs the Appsody operator and its custom resource definition in the namespace given by --namespace,
+or the namespace of the current kubectl context. Running it again with a newer --version upgrades the operator in place.
+
+The operator watches its own namespace, the namespaces given with --watch-namespace, or the whole cluster with
+--watch-all-namespaces. The roles it needs in those namespaces are created, and removed from namespaces it no longer watches.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ns := currentNamespace()
+		if operatorWatchAll && len(operatorWatchNamespaces) > 0 {
+			return errors.New("--watch-all-namespaces cannot be used with --watch-namespace")
+		}
+		watchNamespaces := operatorWatchNamespaces
+		if len(watchNamespaces) == 0 && !operatorWatchAll {
+			watchNamespaces = []string{ns}
+		}
+		watchNamespace := watchNamespaceValue(watchNamespaces)
+		if installed := installedOperatorImage(ns); installed != "" {
+			if strings.HasSuffix(installed, ":"+operatorVersion) {
+				Info.logf("The operator %s is already installed in %s, updating its configuration", operatorVersion, ns)
+			} else {
+				Info.logf("Upgrading the operator in %s from %s to %s", ns, installed, operatorVersion)
+			}
+		} else {
+			Info.logf("Installing the operator %s in %s", operatorVersion, ns)
+		}
+
+		dir := operatorDir(ns)
+		if !dryrun {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		for _, file := range []string{operatorCRDFile, operatorManifestFile} {
+			manifest, err := downloadOperatorManifest(file, ns, watchNamespace)
+			if err != nil {
+				return err
+			}
+			manifestFile := filepath.Join(dir, file)
+			if dryrun {
+				planned(planWrite, manifestFile, "operator manifest")
+			} else if err = ioutil.WriteFile(manifestFile, manifest, 0644); err != nil {
+				return err
+			}
+			if err = execAndWaitReturnErr("kubectl", kubectlConnArgs("apply", "-f", manifestFile, "--namespace", ns), Debug); err != nil {
+				return errors.Errorf("Could not apply %s: %v", file, err)
+			}
+		}
+		// replace the roles of the previous install, which may have watched other namespaces
+		if err := removeOperatorRBAC(ns); err != nil {
+			return errors.Errorf("Could not remove the previous operator roles: %v", err)
+		}
+		rbac, err := operatorRBAC(ns, watchNamespaces)
+		if err != nil {
+			return err
+		}
+		rbacFile := filepath.Join(dir, operatorRBACFile)
+		if dryrun {
+			planned(planWrite, rbacFile, "operator RBAC manifest")
+		} else if err = ioutil.WriteFile(rbacFile, rbac, 0644); err != nil {
+			return err
+		}
+		if err = execAndWaitReturnErr("kubectl", kubectlConnArgs("apply", "-f", rbacFile), Debug); err != nil {
+			return errors.Errorf("Could not grant the operator access to the watched namespaces: %v", err)
+		}
+		err = execAndWaitReturnErr("kubectl", kubectlConnArgs("rollout", "status", "deployment/"+operatorDeployment, "--namespace", ns, "--timeout=300s"), Debug)
+		if err != nil {
+			return errors.Errorf("The operator did not become ready: %v", err)
+		}
+		if operatorWatchAll {
+			Info.logf("The operator is running in %s and watching all namespaces", ns)
+		} else {
+			Info.logf("The operator is running in %s and watching %s", ns, strings.Join(watchNamespaces, ", "))
+		}
+		return nil
+	},
+}
+
+var operatorUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the Appsody operator",
+	Long: `This removes the Appsody operator from the namespace given by --namespace, or the namespace of the current kubectl context.
+The custom resource definition is kept, with the applications deployed through it, unless --delete-crd is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ns := currentNamespace()
+		dir := operatorDir(ns)
+		files := []string{operatorManifestFile}
+		if operatorDeleteCRD {
+			if !operatorConfirmed && !dryrun {
+				confirmed, err := promptConfirm("Deleting the custom resource definition deletes every Appsody application in the cluster. Continue?", "--yes")
+				if err != nil {
+					return err
+				}
+				if !confirmed {
+					return errors.New("The operator was not removed")
+				}
+			}
+			files = append(files, operatorCRDFile)
+		}
+		for _, file := range files {
+			manifestFile := filepath.Join(dir, file)
+			if found, _ := exists(manifestFile); !found && !dryrun {
+				// installed by hand or from another machine, use the release manifests
+				manifest, err := downloadOperatorManifest(file, ns, ns)
+				if err != nil {
+					return err
+				}
+				if err = os.MkdirAll(dir, 0755); err != nil {
+					return err
+				}
+				if err = ioutil.WriteFile(manifestFile, manifest, 0644); err != nil {
+					return err
+				}
+			}
+			if err := execAndWaitReturnErr("kubectl", kubectlConnArgs("delete", "-f", manifestFile, "--namespace", ns, "--ignore-not-found"), Debug); err != nil {
+				return errors.Errorf("Could not delete the resources of %s: %v", file, err)
+			}
+		}
+		if err := removeOperatorRBAC(ns); err != nil {
+			return errors.Errorf("Could not remove the operator roles: %v", err)
+		}
+		if !dryrun {
+			os.RemoveAll(dir)
+		}
+		Info.log("The operator was removed from ", ns)
+		return nil
+	},
+}
+
+var operatorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the version and state of the Appsody operator",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ns := currentNamespace()
+		out, err := runtimeCommand("kubectl", kubectlConnArgs("get", "deployment", operatorDeployment, "--namespace", ns, "--ignore-not-found", "-o",
+			`jsonpath={.spec.template.spec.containers[0].image}{"\t"}{.status.readyReplicas}/{.spec.replicas}{"\t"}{.spec.template.spec.containers[0].env[?(@.name=="WATCH_NAMESPACE")].value}`)...).Output()
+		if err != nil {
+			return errors.Errorf("Could not query the operator in %s: %v", ns, err)
+		}
+		if strings.TrimSpace(string(out)) == "" {
+			Info.log("The operator is not installed in ", ns)
+			return nil
+		}
+		fields := strings.Split(string(out), "\t")
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		Info.log("Namespace: ", ns)
+		Info.log("Image: ", fields[0])
+		Info.log("Ready: ", strings.TrimPrefix(fields[1], "/"))
+		// the operator only watches the namespaces it is allowed to, whatever WATCH_NAMESPACE says
+		watchNamespace := strings.TrimSpace(fields[2])
+		if watchNamespace == "" {
+			if operatorCanWatch(ns, "") {
+				Info.log("Watching: all namespaces")
+			} else {
+				Warning.log("Watching: all namespaces requested, but the operator is not allowed to watch the whole cluster")
+			}
+			return nil
+		}
+		var watched, denied []string
+		for _, watchedNamespace := range strings.Split(watchNamespace, ",") {
+			if operatorCanWatch(ns, watchedNamespace) {
+				watched = append(watched, watchedNamespace)
+			} else {
+				denied = append(denied, watchedNamespace)
+			}
+		}
+		Info.log("Watching: ", strings.Join(watched, ", "))
+		if len(denied) > 0 {
+			Warning.log("Not watching, missing permissions: ", strings.Join(denied, ", "), ". Run appsody operator install again to grant them.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(operatorCmd)
+	operatorCmd.AddCommand(operatorInstallCmd)
+	operatorCmd.AddCommand(operatorUninstallCmd)
+	operatorCmd.AddCommand(operatorStatusCmd)
+	operatorCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the operator. Defaults to the namespace of the current kubectl context.")
+	operatorCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use. By default kubectl's own configuration, or the service account when running in a pod.")
+	operatorCmd.PersistentFlags().StringVar(&operatorVersion, "version", "0.1.0", "Version of the operator to install.")
+	operatorCmd.PersistentFlags().StringVar(&operatorManifestsURL, "manifests-url", "", "Download the operator manifests from this URL instead of the operator GitHub release.")
+	operatorInstallCmd.PersistentFlags().StringSliceVar(&operatorWatchNamespaces, "watch-namespace", nil, "Namespaces the operator watches for Appsody applications, comma separated or repeated. Defaults to its own namespace.")
+	operatorInstallCmd.PersistentFlags().BoolVar(&operatorWatchAll, "watch-all-namespaces", false, "Watch Appsody applications in every namespace of the cluster.")
+	operatorUninstallCmd.PersistentFlags().BoolVarP(&operatorConfirmed, "yes", "y", false, "Do not ask for confirmation before deleting the custom resource definition.")
+	operatorUninstallCmd.PersistentFlags().BoolVar(&operatorDeleteCRD, "delete-crd", false, "Also delete the custom resource definition, which deletes every Appsody application in the cluster.")
+}
@@ -0,0 +1,120 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	operatorServiceAccount = "appsody-operator"
+	operatorRBACFile       = "appsody-operator-rbac.yaml"
+	// operatorNamespaceLabel marks the RBAC resources created for the operator of a namespace
+	operatorNamespaceLabel = "dev.appsody.operator-namespace"
+)
+
+// operatorRules are the permissions the operator needs in every namespace it watches
+var operatorRules = []map[string][]string{
+	{"apiGroups": {""}, "resources": {"pods", "services", "configmaps", "secrets", "serviceaccounts", "events", "persistentvolumeclaims"}, "verbs": {"*"}},
+	{"apiGroups": {"apps"}, "resources": {"deployments", "statefulsets", "replicasets"}, "verbs": {"*"}},
+	{"apiGroups": {"autoscaling"}, "resources": {"horizontalpodautoscalers"}, "verbs": {"*"}},
+	{"apiGroups": {"appsody.dev"}, "resources": {"appsodyapplications", "appsodyapplications/status", "appsodyapplications/finalizers"}, "verbs": {"*"}},
+	{"apiGroups": {"route.openshift.io"}, "resources": {"routes", "routes/custom-host"}, "verbs": {"*"}},
+	{"apiGroups": {"serving.knative.dev"}, "resources": {"services"}, "verbs": {"*"}},
+	{"apiGroups": {"monitoring.coreos.com"}, "resources": {"servicemonitors"}, "verbs": {"*"}},
+}
+
+// watchNamespaceValue is the WATCH_NAMESPACE of the operator: a comma separated list, or empty for the whole cluster
+func watchNamespaceValue(watchNamespaces []string) string {
+	return strings.Join(watchNamespaces, ",")
+}
+
+// operatorRBAC returns the roles and bindings that let the operator of ns manage applications in the watched
+// namespaces, or in every namespace when the list is empty
+func operatorRBAC(ns string, watchNamespaces []string) ([]byte, error) {
+	labels := map[string]string{operatorNamespaceLabel: ns}
+	subjects := []map[string]string{{"kind": "ServiceAccount", "name": operatorServiceAccount, "namespace": ns}}
+	name := "appsody-operator-" + ns
+	var resources []interface{}
+	if len(watchNamespaces) == 0 {
+		resources = append(resources,
+			map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRole",
+				"metadata":   map[string]interface{}{"name": name, "labels": labels},
+				"rules":      operatorRules,
+			},
+			map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRoleBinding",
+				"metadata":   map[string]interface{}{"name": name, "labels": labels},
+				"roleRef":    map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": name},
+				"subjects":   subjects,
+			})
+	}
+	for _, watched := range watchNamespaces {
+		resources = append(resources,
+			map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "Role",
+				"metadata":   map[string]interface{}{"name": name, "namespace": watched, "labels": labels},
+				"rules":      operatorRules,
+			},
+			map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "RoleBinding",
+				"metadata":   map[string]interface{}{"name": name, "namespace": watched, "labels": labels},
+				"roleRef":    map[string]string{"apiGroup": "rbac.authorization.k8s.io", "kind": "Role", "name": name},
+				"subjects":   subjects,
+			})
+	}
+	var buf bytes.Buffer
+	for _, resource := range resources {
+		data, err := yaml.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("---\n")
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// removeOperatorRBAC deletes the roles and bindings previously created for the operator of ns,
+// so namespaces that are no longer watched lose their access
+func removeOperatorRBAC(ns string) error {
+	selector := operatorNamespaceLabel + "=" + ns
+	err := execAndWaitReturnErr("kubectl", kubectlConnArgs("delete", "rolebinding,role", "--all-namespaces", "-l", selector, "--ignore-not-found"), Debug)
+	if err != nil {
+		return err
+	}
+	return execAndWaitReturnErr("kubectl", kubectlConnArgs("delete", "clusterrolebinding,clusterrole", "-l", selector, "--ignore-not-found"), Debug)
+}
+
+// operatorCanWatch checks that the operator of ns is allowed to manage applications in the watched namespace,
+// or in the whole cluster when watched is empty
+func operatorCanWatch(ns string, watched string) bool {
+	args := []string{"auth", "can-i", "watch", "appsodyapplications.appsody.dev", "--as", "system:serviceaccount:" + ns + ":" + operatorServiceAccount}
+	if watched == "" {
+		args = append(args, "--all-namespaces")
+	} else {
+		args = append(args, "--namespace", watched)
+	}
+	out, _ := runtimeCommand("kubectl", kubectlConnArgs(args...)...).Output()
+	return strings.TrimSpace(string(out)) == "yes"
+}
@@ -0,0 +1,160 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"gopkg.in/yaml.v2"
+)
+
+const operatorManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: appsody-operator
+  namespace: APPSODY_OPERATOR_NAMESPACE
+spec:
+  template:
+    spec:
+      containers:
+      - env:
+        - name: WATCH_NAMESPACE
+          value: APPSODY_WATCH_NAMESPACE
+`
+
+var operatorManifestTests = []struct {
+	testName       string
+	watchNamespace string
+	expected       []string // lines of the manifest
+}{
+	{"Own namespace", "dev", []string{"  namespace: dev", "          value: dev"}},
+	{"Several namespaces", "dev,test", []string{"  namespace: dev", "          value: dev,test"}},
+	{"All namespaces", "", []string{"  namespace: dev", "          value: \n"}},
+}
+
+func TestDownloadOperatorManifest(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v0.2.0/appsody-app-operator.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(operatorManifest))
+	}))
+	defer server.Close()
+
+	for _, tt := range operatorManifestTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			manifest, err := cmd.DownloadOperatorManifest(server.URL+"/v0.2.0/", "appsody-app-operator.yaml", "dev", tt.watchNamespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(manifest), "APPSODY_") {
+				t.Errorf("Expected every placeholder to be replaced, got\n%s", manifest)
+			}
+			for _, line := range tt.expected {
+				if !strings.Contains(string(manifest), line) {
+					t.Errorf("Expected %q in the manifest, got\n%s", line, manifest)
+				}
+			}
+		})
+	}
+	if _, err := cmd.DownloadOperatorManifest(server.URL+"/v0.2.0", "missing.yaml", "dev", ""); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("Expected the download of a missing manifest to fail with its URL, got %v", err)
+	}
+}
+
+var operatorRBACTests = []struct {
+	testName        string
+	watchNamespaces []string
+	watchNamespace  string
+	resources       []string // <kind> <namespace>/<name> of the roles and bindings
+}{
+	{"All namespaces", nil, "", []string{
+		"ClusterRole /appsody-operator-ops",
+		"ClusterRoleBinding /appsody-operator-ops",
+	}},
+	{"Own namespace", []string{"ops"}, "ops", []string{
+		"Role ops/appsody-operator-ops",
+		"RoleBinding ops/appsody-operator-ops",
+	}},
+	{"Several namespaces", []string{"dev", "test"}, "dev,test", []string{
+		"Role dev/appsody-operator-ops",
+		"RoleBinding dev/appsody-operator-ops",
+		"Role test/appsody-operator-ops",
+		"RoleBinding test/appsody-operator-ops",
+	}},
+}
+
+func TestOperatorRBAC(t *testing.T) {
+	for _, tt := range operatorRBACTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			if value := cmd.WatchNamespaceValue(tt.watchNamespaces); value != tt.watchNamespace {
+				t.Errorf("Expected the WATCH_NAMESPACE %q, got %q", tt.watchNamespace, value)
+			}
+			manifest, err := cmd.OperatorRBAC("ops", tt.watchNamespaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resources []string
+			decoder := yaml.NewDecoder(bytes.NewReader(manifest))
+			for {
+				var resource struct {
+					Kind     string
+					Metadata struct {
+						Name      string
+						Namespace string
+						Labels    map[string]string
+					}
+					RoleRef struct {
+						Kind string
+						Name string
+					} `yaml:"roleRef"`
+					Subjects []map[string]string
+					Rules    []map[string][]string
+				}
+				if err := decoder.Decode(&resource); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				resources = append(resources, resource.Kind+" "+resource.Metadata.Namespace+"/"+resource.Metadata.Name)
+				if resource.Metadata.Labels["dev.appsody.operator-namespace"] != "ops" {
+					t.Errorf("Expected the %s %s to be labelled with the operator namespace, got %v", resource.Kind, resource.Metadata.Name, resource.Metadata.Labels)
+				}
+				if strings.HasSuffix(resource.Kind, "Binding") {
+					if resource.RoleRef.Name != resource.Metadata.Name || resource.RoleRef.Kind != strings.TrimSuffix(resource.Kind, "Binding") {
+						t.Errorf("Expected the %s %s to bind the role of the same name, got %+v", resource.Kind, resource.Metadata.Name, resource.RoleRef)
+					}
+					if len(resource.Subjects) != 1 || resource.Subjects[0]["name"] != "appsody-operator" || resource.Subjects[0]["namespace"] != "ops" {
+						t.Errorf("Expected the %s %s to bind the service account of the operator, got %v", resource.Kind, resource.Metadata.Name, resource.Subjects)
+					}
+				} else if len(resource.Rules) == 0 {
+					t.Errorf("Expected the %s %s to have the rules of the operator", resource.Kind, resource.Metadata.Name)
+				}
+			}
+			if strings.Join(resources, "\n") != strings.Join(tt.resources, "\n") {
+				t.Errorf("Expected the resources\n%s\ngot\n%s", strings.Join(tt.resources, "\n"), strings.Join(resources, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// outputFormat is the global --output option: table, the default, or json or yaml for scripts and IDE
+// extensions
+var outputFormat string
+
+// structuredOutput tells whether the command prints json or yaml rather than its table
+func structuredOutput() (bool, error) {
+	switch outputFormat {
+	case "", "table":
+		return false, nil
+	case "json", "yaml":
+		return true, nil
+	}
+	return false, errors.Errorf("Unknown output format %q, use table, json or yaml", outputFormat)
+}
+
+// jsonOutput checks the global --output of the commands that print text or json, such as info, and tells
+// whether it is json. text, the format these commands used to default to, is the same as table.
+func jsonOutput() (bool, error) {
+	switch outputFormat {
+	case "", "table", "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, errors.Errorf("Unknown output format %q, use table or json", outputFormat)
+}
+
+// printStructured prints the value as json or yaml. Both use the yaml field names of the appsody files, the
+// value goes through yaml for json too.
+func printStructured(value interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if outputFormat == "yaml" {
+		fmt.Print(string(data))
+		return nil
+	}
+	var document interface{}
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(jsonValue(document), "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// versionInfo is the structured output of appsody version
+type versionInfo struct {
+	Version  string `yaml:"version"`
+	Commit   string `yaml:"commit,omitempty"`
+	Date     string `yaml:"date,omitempty"`
+	Checksum string `yaml:"checksum,omitempty"`
+	OS       string `yaml:"os"`
+	Arch     string `yaml:"arch"`
+	Go       string `yaml:"go"`
+}
+
+func currentVersionInfo() versionInfo {
+	commit, date := buildCommit()
+	info := versionInfo{Version: VERSION, Commit: commit, Date: date, OS: runtime.GOOS, Arch: runtime.GOARCH, Go: runtime.Version()}
+	if checksum, err := binaryChecksum(); err == nil {
+		info.Checksum = "sha256:" + checksum
+	} else {
+		Debug.log("Could not compute the checksum of the appsody binary: ", err)
+	}
+	return info
+}
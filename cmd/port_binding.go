@@ -0,0 +1,148 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// listenAddress is the --listen-address option of run, debug and test: the host interface the ports are
+// published on. By default docker publishes them on every IPv4 and IPv6 interface.
+var listenAddress string
+
+var validPortNumber = regexp.MustCompile("^([0-9]{1,4}|[1-5][0-9]{4}|6[0-4][0-9]{3}|65[0-4][0-9]{2}|655[0-2][0-9]|6553[0-5])$")
+
+// portMapping is a port published with docker run -p: [ip:]hostPort:containerPort[/protocol]. An IPv6 address
+// is written in brackets, such as [::1]:3000:3000.
+type portMapping struct {
+	IP        string
+	Host      string
+	Container string
+	Protocol  string
+}
+
+// parsePortMapping reads a port mapping of docker run -p, and of the output of docker port
+func parsePortMapping(spec string) (portMapping, error) {
+	var mapping portMapping
+	rest := spec
+	if slash := strings.LastIndex(rest, "/"); slash >= 0 {
+		rest, mapping.Protocol = rest[:slash], rest[slash+1:]
+	}
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]:")
+		if end < 0 {
+			return mapping, errors.Errorf("The port mapping %s has no closing bracket after its IPv6 address", spec)
+		}
+		mapping.IP, rest = rest[1:end], rest[end+2:]
+	}
+	parts := strings.Split(rest, ":")
+	switch {
+	case len(parts) == 2:
+		mapping.Host, mapping.Container = parts[0], parts[1]
+	case len(parts) == 3:
+		mapping.IP, mapping.Host, mapping.Container = parts[0], parts[1], parts[2]
+	case len(parts) > 3:
+		// an IPv6 address without brackets, the host and the container ports are the last parts
+		mapping.IP = strings.Join(parts[:len(parts)-2], ":")
+		mapping.Host, mapping.Container = parts[len(parts)-2], parts[len(parts)-1]
+	default:
+		return mapping, errors.Errorf("The port input: %s is not valid as the : separator is missing.", spec)
+	}
+	if mapping.IP != "" && net.ParseIP(mapping.IP) == nil {
+		return mapping, errors.Errorf("The port input: %s is not valid, %s is not an IP address.", spec, mapping.IP)
+	}
+	if !validPortNumber.MatchString(mapping.Host) || !validPortNumber.MatchString(mapping.Container) {
+		return mapping, errors.Errorf("The numeric port input: %s is not valid.", spec)
+	}
+	return mapping, nil
+}
+
+// String writes the mapping back as a docker run -p value
+func (m portMapping) String() string {
+	spec := m.Host + ":" + m.Container
+	if m.IP != "" {
+		spec = hostPort(m.IP, spec)
+	}
+	if m.Protocol != "" {
+		spec += "/" + m.Protocol
+	}
+	return spec
+}
+
+// hostPort joins a host and a port, with the IPv6 addresses in brackets
+func hostPort(host string, port string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]:" + port
+	}
+	return host + ":" + port
+}
+
+// bindMapping publishes the host port of a stack on the --listen-address interface
+func bindMapping(hostPort string, containerPort string) string {
+	return portMapping{IP: listenAddress, Host: hostPort, Container: containerPort}.String()
+}
+
+// checkListenAddress checks that --listen-address is an IP address
+func checkListenAddress() error {
+	if listenAddress != "" && net.ParseIP(strings.Trim(listenAddress, "[]")) == nil {
+		return errors.Errorf("The listen address %s is not an IP address, such as 127.0.0.1 or ::1", listenAddress)
+	}
+	listenAddress = strings.Trim(listenAddress, "[]")
+	return nil
+}
+
+// reachableHost is the host of the URLs of a port published on the IP: localhost when it is published on every
+// interface. Join it to the port with hostPort, which puts the IPv6 addresses in brackets.
+func reachableHost(ip string) string {
+	parsed := net.ParseIP(ip)
+	if ip == "" || parsed == nil || parsed.IsUnspecified() {
+		return "localhost"
+	}
+	if parsed.IsLoopback() && parsed.To4() != nil {
+		return "localhost"
+	}
+	return ip
+}
+
+// networkBaseURLs returns the URLs other machines reach a port published on every interface on, one per
+// address of the host. A port published on one interface is only reachable on it.
+func networkBaseURLs(mapping portMapping) []string {
+	ip := net.ParseIP(mapping.IP)
+	if mapping.IP != "" && (ip == nil || !ip.IsUnspecified()) {
+		return nil
+	}
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		Debug.log("Could not list the addresses of the host: ", err)
+		return nil
+	}
+	var urls []string
+	for _, address := range addresses {
+		network, ok := address.(*net.IPNet)
+		if !ok || !network.IP.IsGlobalUnicast() {
+			continue
+		}
+		// a port published on 0.0.0.0 only is not reachable on the IPv6 addresses
+		if ip != nil && ip.To4() != nil && network.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, "http://"+hostPort(network.IP.String(), mapping.Host))
+	}
+	return urls
+}
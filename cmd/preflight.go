@@ -0,0 +1,194 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseMemorySize parses sizes such as 4g, 512m or 2048M into bytes. A plain number is in bytes.
+func parseMemorySize(size string) (int64, error) {
+	size = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(size)), "b")
+	multiplier := int64(1)
+	if size != "" {
+		switch size[len(size)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			size = size[:len(size)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, errors.Errorf("%s is not a valid memory size", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+func formatMemorySize(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+}
+
+// dockerEngine is what the docker engine reports about the resources it has
+type dockerEngine struct {
+	CPUs            int    `json:"NCPU"`
+	Memory          int64  `json:"MemTotal"`
+	OperatingSystem string `json:"OperatingSystem"`
+}
+
+// dockerDesktop tells whether the engine runs in the Docker Desktop VM, whose resources are set in its settings
+func (engine dockerEngine) dockerDesktop() bool {
+	return strings.Contains(engine.OperatingSystem, "Docker Desktop")
+}
+
+// dockerResources returns the CPUs and memory available to the docker engine
+func dockerResources() (*dockerEngine, error) {
+	if getContainerRuntime().Command == runtimePodman {
+		return podmanResources()
+	}
+	out, err := runtimeCommand("docker", "info", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil, err
+	}
+	var engine dockerEngine
+	if err = json.Unmarshal(out, &engine); err != nil {
+		return nil, errors.Errorf("unexpected docker info output: %v", err)
+	}
+	return &engine, nil
+}
+
+// podmanResources returns the CPUs and memory available to podman, which reports them its own way
+func podmanResources() (*dockerEngine, error) {
+	out, err := runtimeCommand("docker", "info", "--format", "json").Output()
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Host struct {
+			CPUs     int    `json:"cpus"`
+			MemTotal int64  `json:"memTotal"`
+			OS       string `json:"os"`
+			Distro   struct {
+				Distribution string `json:"distribution"`
+				Version      string `json:"version"`
+			} `json:"distribution"`
+		} `json:"host"`
+	}
+	if err = json.Unmarshal(out, &info); err != nil {
+		return nil, errors.Errorf("unexpected podman info output: %v", err)
+	}
+	return &dockerEngine{CPUs: info.Host.CPUs, Memory: info.Host.MemTotal, OperatingSystem: strings.TrimSpace(info.Host.Distro.Distribution + " " + info.Host.Distro.Version)}, nil
+}
+
+// dockerFreeDisk returns the disk space left to the containers, in bytes, from df run in a container of the image
+func dockerFreeDisk(image string) (int64, error) {
+	out, err := runtimeCommand("docker", "run", "--rm", "--entrypoint", "df", image, "-Pk", "/").Output()
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, errors.Errorf("unexpected df output: %s", out)
+	}
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	return available << 10, err
+}
+
+// resourceSettingHint tells where the docker engine resources are configured
+func resourceSettingHint(engine *dockerEngine, resource string) string {
+	if engine.dockerDesktop() || runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return "Increase " + resource + " in Docker Desktop under Settings > Resources > Advanced."
+	}
+	return "The Docker engine uses the " + resource + " of this machine, run on a larger machine or VM."
+}
+
+// dockerResourceProblems compares the docker engine resources with the APPSODY_RECOMMENDED_CPUS,
+// APPSODY_RECOMMENDED_MEMORY and APPSODY_RECOMMENDED_DISK variables of the stack image. The disk is
+// only checked when the stack recommends a size, since it takes running a container.
+func dockerResourceProblems() ([]string, error) {
+	recommended := make(map[string]string)
+	for _, name := range []string{"APPSODY_RECOMMENDED_CPUS", "APPSODY_RECOMMENDED_MEMORY", "APPSODY_RECOMMENDED_DISK"} {
+		value, err := getEnvVar(name)
+		if err != nil {
+			return nil, err
+		}
+		recommended[name] = value
+	}
+	recommendedCPUs := recommended["APPSODY_RECOMMENDED_CPUS"]
+	recommendedMemory := recommended["APPSODY_RECOMMENDED_MEMORY"]
+	recommendedDisk := recommended["APPSODY_RECOMMENDED_DISK"]
+	if recommendedCPUs == "" && recommendedMemory == "" && recommendedDisk == "" {
+		return nil, nil
+	}
+	engine, err := dockerResources()
+	if err != nil {
+		return nil, errors.Errorf("could not query the docker engine resources: %v", err)
+	}
+	Debug.logf("The docker engine has %d CPUs and %s of memory", engine.CPUs, formatMemorySize(engine.Memory))
+	var problems []string
+	if recommendedCPUs != "" {
+		wanted, err := strconv.Atoi(recommendedCPUs)
+		if err != nil {
+			Debug.log("Ignoring invalid APPSODY_RECOMMENDED_CPUS: ", recommendedCPUs)
+		} else if engine.CPUs < wanted {
+			problems = append(problems, fmt.Sprintf("The stack recommends %d CPUs but the docker engine only has %d. %s", wanted, engine.CPUs, resourceSettingHint(engine, "CPUs")))
+		}
+	}
+	if recommendedMemory != "" {
+		wanted, err := parseMemorySize(recommendedMemory)
+		if err != nil {
+			Debug.log("Ignoring invalid APPSODY_RECOMMENDED_MEMORY: ", err)
+		} else if engine.Memory < wanted {
+			problems = append(problems, fmt.Sprintf("The stack recommends %s of memory but the docker engine only has %s. %s", formatMemorySize(wanted), formatMemorySize(engine.Memory), resourceSettingHint(engine, "Memory")))
+		}
+	}
+	if recommendedDisk != "" {
+		wanted, err := parseMemorySize(recommendedDisk)
+		if err != nil {
+			Debug.log("Ignoring invalid APPSODY_RECOMMENDED_DISK: ", err)
+		} else if config, err := readProjectConfig(); err != nil {
+			return nil, err
+		} else if free, err := dockerFreeDisk(config.Platform); err != nil {
+			Debug.log("Could not query the disk space of the docker engine: ", err)
+		} else if free < wanted {
+			problems = append(problems, fmt.Sprintf("The stack recommends %s of free disk space but the docker engine only has %s left. %s", formatMemorySize(wanted), formatMemorySize(free), resourceSettingHint(engine, "the Virtual disk limit")))
+		}
+	}
+	return problems, nil
+}
+
+// checkDockerResources warns when the docker engine has fewer resources than the stack recommends.
+// The stack still runs, usually slowly or until the JVM or the compiler runs out of memory or disk.
+func checkDockerResources() {
+	problems, err := dockerResourceProblems()
+	if err != nil {
+		Debug.log(err)
+	}
+	for _, problem := range problems {
+		Warning.log(problem)
+	}
+}
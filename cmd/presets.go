@@ -0,0 +1,199 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// presetsConfig is the presets section of the CLI configuration, the conventions of a team:
+//
+//	presets:
+//	  flags:
+//	    run: --network dev
+//	    deploy: --namespace dev
+//	  aliases:
+//	    r: run --profile hot-reload
+//
+// The flags of a command come before the ones of the command line, which win over them. The aliases expand in
+// place of their name, and cannot take the name of a command.
+type presetsConfig struct {
+	Flags   map[string]string `mapstructure:"flags"`
+	Aliases map[string]string `mapstructure:"aliases"`
+}
+
+// noPresetsEnv turns the presets off, for the appsody processes started with arguments the presets were
+// already applied to
+const noPresetsEnv = "APPSODY_NO_PRESETS"
+
+// presetArgs are the arguments of the command line once the presets are applied, nil when none applied
+var presetArgs []string
+
+// applyPresets expands the alias and adds the preset flags of the command the arguments run. The configuration
+// is read before cobra parses the arguments, so it is found with the --config argument.
+func applyPresets(args []string) []string {
+	presetArgs = nil
+	if os.Getenv(noPresetsEnv) != "" {
+		return args
+	}
+	presets := readPresets(configArg(args))
+	if len(presets.Flags) == 0 && len(presets.Aliases) == 0 {
+		return args
+	}
+	command, last, next := findPresetCommand(args)
+	if command == rootCmd && next >= 0 {
+		if alias, ok := presets.Aliases[args[next]]; ok {
+			expanded := append(append(append([]string{}, args[:next]...), splitPresetArgs(alias)...), args[next+1:]...)
+			args = expanded
+			command, last, _ = findPresetCommand(args)
+		}
+	}
+	if command != rootCmd {
+		if flags, ok := presets.Flags[strings.TrimPrefix(command.CommandPath(), rootCmd.Name()+" ")]; ok {
+			args = append(append(append([]string{}, args[:last+1]...), splitPresetArgs(flags)...), args[last+1:]...)
+		}
+	}
+	presetArgs = args
+	return args
+}
+
+// readPresets reads the presets of the configuration file, the same one initConfig reads
+func readPresets(configFile string) presetsConfig {
+	var presets presetsConfig
+	config := viper.New()
+	if configFile != "" {
+		config.SetConfigFile(configFile)
+	} else {
+		home := os.Getenv("APPSODY_HOME")
+		if home == "" {
+			home = filepath.Join(homeDir(), ".appsody")
+		}
+		config.AddConfigPath(home)
+		config.SetConfigName(".appsody")
+	}
+	if err := config.ReadInConfig(); err != nil {
+		return presets
+	}
+	if err := config.UnmarshalKey("presets", &presets); err != nil {
+		Warning.log("The presets of the configuration are ignored, they are not valid: ", err)
+		return presetsConfig{}
+	}
+	for alias := range presets.Aliases {
+		if command, _, err := rootCmd.Find([]string{alias}); err == nil && command != rootCmd {
+			Warning.logf("The %s alias of the configuration is ignored, it is the name of a command", alias)
+		}
+	}
+	return presets
+}
+
+// configArg is the value of the --config argument, or ""
+func configArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--config=") {
+			return strings.TrimPrefix(arg, "--config=")
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// findPresetCommand finds the command the arguments run, with the index of the argument naming it, -1 for the
+// root command, and the index of its first positional argument, -1 when it has none
+func findPresetCommand(args []string) (*cobra.Command, int, int) {
+	command := rootCmd
+	last := -1
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			// the value of a flag is the next argument, unless it is given with = or the flag is a bool
+			if flag := lookupArgFlag(command, arg); flag != nil && flag.NoOptDefVal == "" && !strings.Contains(arg, "=") {
+				i++
+			}
+			continue
+		}
+		var sub *cobra.Command
+		for _, c := range command.Commands() {
+			if c.Name() == arg || c.HasAlias(arg) {
+				sub = c
+			}
+		}
+		if sub == nil {
+			return command, last, i
+		}
+		command, last = sub, i
+	}
+	return command, last, -1
+}
+
+// lookupArgFlag finds the flag of an argument such as --namespace or -n among the flags of the command
+func lookupArgFlag(command *cobra.Command, arg string) *pflag.Flag {
+	name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+	for _, flags := range []*pflag.FlagSet{command.LocalFlags(), command.InheritedFlags()} {
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = flags.Lookup(name)
+		} else if len(name) == 1 {
+			flag = flags.ShorthandLookup(name)
+		}
+		if flag != nil {
+			return flag
+		}
+	}
+	return nil
+}
+
+// splitPresetArgs splits the arguments of a preset at the spaces outside of quotes, and removes the quotes
+func splitPresetArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			inArg = true
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
@@ -0,0 +1,105 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+const presetsConfig = `presets:
+  flags:
+    run: --network dev
+    deploy: --namespace "team a"
+    repo add: --index-timeout 10s
+  aliases:
+    r: run --profile hot-reload
+    ship: deploy --push
+    test: run --interactive
+`
+
+var applyPresetsTests = []struct {
+	testName     string
+	args         []string // the arguments before --config
+	expectedArgs []string
+}{
+	{"No presets", []string{"list"}, []string{"list"}},
+	{"Flags", []string{"run"}, []string{"run", "--network", "dev"}},
+	// the flags of the command line come after the preset ones, so that they win
+	{"Command line flags", []string{"run", "--network", "prod"}, []string{"run", "--network", "dev", "--network", "prod"}},
+	{"Quoted flags", []string{"deploy"}, []string{"deploy", "--namespace", "team a"}},
+	{"Global flags", []string{"-v", "deploy"}, []string{"-v", "deploy", "--namespace", "team a"}},
+	{"Subcommand", []string{"repo", "add", "team", "https://example.com/index.yaml"},
+		[]string{"repo", "add", "--index-timeout", "10s", "team", "https://example.com/index.yaml"}},
+	{"Alias", []string{"r"}, []string{"run", "--network", "dev", "--profile", "hot-reload"}},
+	{"Alias with flags", []string{"ship", "--tag", "app:1.0"}, []string{"deploy", "--namespace", "team a", "--push", "--tag", "app:1.0"}},
+	// an alias can not take the name of a command
+	{"Alias of a command", []string{"test"}, []string{"test"}},
+}
+
+func TestApplyPresets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, ".appsody.yaml")
+	if err = ioutil.WriteFile(configFile, []byte(presetsConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range applyPresetsTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			args := cmd.ApplyPresets(append(tt.args, "--config", configFile))
+
+			expected := append(tt.expectedArgs, "--config", configFile)
+			if !reflect.DeepEqual(args, expected) {
+				t.Errorf("Expected the arguments %q, got %q", expected, args)
+			}
+		})
+	}
+
+	os.Setenv("APPSODY_NO_PRESETS", "true")
+	defer os.Unsetenv("APPSODY_NO_PRESETS")
+	if args := cmd.ApplyPresets([]string{"r", "--config", configFile}); !reflect.DeepEqual(args, []string{"r", "--config", configFile}) {
+		t.Errorf("Expected no presets with APPSODY_NO_PRESETS, got %q", args)
+	}
+}
+
+var splitPresetArgsTests = []struct {
+	line         string
+	expectedArgs []string
+}{
+	{"", nil},
+	{"--network dev", []string{"--network", "dev"}},
+	{"  --network\tdev  ", []string{"--network", "dev"}},
+	{`--namespace "team a"`, []string{"--namespace", "team a"}},
+	{`--docker-options '-e NAME="a b"'`, []string{"--docker-options", `-e NAME="a b"`}},
+	{`--label ""`, []string{"--label", ""}},
+}
+
+func TestSplitPresetArgs(t *testing.T) {
+	for _, tt := range splitPresetArgsTests {
+		t.Run(tt.line, func(t *testing.T) {
+			if args := cmd.SplitPresetArgs(tt.line); !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("Expected %q, got %q", tt.expectedArgs, args)
+			}
+		})
+	}
+}
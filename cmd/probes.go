@@ -0,0 +1,191 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Probe is an HTTP probe of the deployed application. Stacks declare their probes in the
+// APPSODY_LIVENESS_PROBE, APPSODY_READINESS_PROBE and APPSODY_STARTUP_PROBE variables of the stack image,
+// as ; separated settings such as path=/health;port=8080;periodSeconds=10. Projects override the settings
+// in the probes section of .appsody-config.yaml:
+//
+//   probes:
+//     liveness:
+//       path: /live
+//       initialDelaySeconds: 30
+//     startup:
+//       disabled: true
+type Probe struct {
+	Path                string `yaml:"path,omitempty"`
+	Port                int    `yaml:"port,omitempty"`
+	InitialDelaySeconds int    `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int    `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds      int    `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold    int    `yaml:"failureThreshold,omitempty"`
+	// Disabled removes the probe the stack declares
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// Probes are the probes of a project
+type Probes struct {
+	Liveness  *Probe `yaml:"liveness,omitempty"`
+	Readiness *Probe `yaml:"readiness,omitempty"`
+	Startup   *Probe `yaml:"startup,omitempty"`
+}
+
+// containerProbe is a probe in the container spec of a manifest
+type containerProbe struct {
+	HTTPGet struct {
+		Path string `yaml:"path"`
+		Port int    `yaml:"port,omitempty"`
+	} `yaml:"httpGet"`
+	InitialDelaySeconds int `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds      int `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold    int `yaml:"failureThreshold,omitempty"`
+}
+
+// deployProbes are the probes of the project being deployed, GenKnativeYaml adds them to the container
+var deployProbes Probes
+
+// parseProbe reads the probe a stack declares in an image variable
+func parseProbe(envVar string, value string) (*Probe, error) {
+	settings := splitStackList(value)
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	probe := &Probe{}
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("%s has the setting %q, settings are name=value", envVar, setting)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if name == "path" {
+			probe.Path = value
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return nil, errors.Errorf("%s has the setting %s=%s, it must be a positive number", envVar, name, value)
+		}
+		switch name {
+		case "port":
+			probe.Port = number
+		case "initialDelaySeconds":
+			probe.InitialDelaySeconds = number
+		case "periodSeconds":
+			probe.PeriodSeconds = number
+		case "timeoutSeconds":
+			probe.TimeoutSeconds = number
+		case "failureThreshold":
+			probe.FailureThreshold = number
+		default:
+			return nil, errors.Errorf("%s has the unknown setting %s", envVar, name)
+		}
+	}
+	return probe, nil
+}
+
+// override returns the stack probe with the settings the project gives replaced, or nil when there is
+// no probe or the project disables it
+func (p *Probe) override(project *Probe) *Probe {
+	if project == nil {
+		return p
+	}
+	if project.Disabled {
+		return nil
+	}
+	probe := Probe{}
+	if p != nil {
+		probe = *p
+	}
+	if project.Path != "" {
+		probe.Path = project.Path
+	}
+	if project.Port != 0 {
+		probe.Port = project.Port
+	}
+	if project.InitialDelaySeconds != 0 {
+		probe.InitialDelaySeconds = project.InitialDelaySeconds
+	}
+	if project.PeriodSeconds != 0 {
+		probe.PeriodSeconds = project.PeriodSeconds
+	}
+	if project.TimeoutSeconds != 0 {
+		probe.TimeoutSeconds = project.TimeoutSeconds
+	}
+	if project.FailureThreshold != 0 {
+		probe.FailureThreshold = project.FailureThreshold
+	}
+	return &probe
+}
+
+// containerProbe returns the probe for the container spec, or nil when there is no probe
+func (p *Probe) containerProbe() *containerProbe {
+	if p == nil || p.Disabled {
+		return nil
+	}
+	probe := &containerProbe{
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+	probe.HTTPGet.Path = p.Path
+	if probe.HTTPGet.Path == "" {
+		probe.HTTPGet.Path = "/"
+	}
+	probe.HTTPGet.Port = p.Port
+	return probe
+}
+
+// getProbes returns the probes of the stack image with the overrides of the project
+func getProbes() (Probes, error) {
+	config, err := readProjectConfig()
+	if err != nil {
+		return Probes{}, err
+	}
+	project := config.Probes
+	if project == nil {
+		project = &Probes{}
+	}
+	var probes Probes
+	for _, probe := range []struct {
+		envVar  string
+		project *Probe
+		probe   **Probe
+	}{
+		{"APPSODY_LIVENESS_PROBE", project.Liveness, &probes.Liveness},
+		{"APPSODY_READINESS_PROBE", project.Readiness, &probes.Readiness},
+		{"APPSODY_STARTUP_PROBE", project.Startup, &probes.Startup},
+	} {
+		value, err := getEnvVar(probe.envVar)
+		if err != nil {
+			return probes, err
+		}
+		stack, err := parseProbe(probe.envVar, value)
+		if err != nil {
+			return probes, err
+		}
+		*probe.probe = stack.override(probe.project)
+	}
+	return probes, nil
+}
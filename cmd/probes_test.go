@@ -0,0 +1,108 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var parseProbeTests = []struct {
+	testName      string
+	value         string
+	expectedProbe *cmd.Probe
+	expectedError string
+}{
+	{"Empty", "", nil, ""},
+	{"Settings", "path=/health;port=8080;initialDelaySeconds=5;periodSeconds=10;timeoutSeconds=2;failureThreshold=3",
+		&cmd.Probe{Path: "/health", Port: 8080, InitialDelaySeconds: 5, PeriodSeconds: 10, TimeoutSeconds: 2, FailureThreshold: 3}, ""},
+	{"Spaces", " path = /ready ; port = 3000 ", &cmd.Probe{Path: "/ready", Port: 3000}, ""},
+	{"No value", "path", nil, `APPSODY_LIVENESS_PROBE has the setting "path", settings are name=value`},
+	{"Not a number", "port=http", nil, "APPSODY_LIVENESS_PROBE has the setting port=http, it must be a positive number"},
+	{"Negative", "periodSeconds=-1", nil, "it must be a positive number"},
+	{"Unknown", "successThreshold=1", nil, "APPSODY_LIVENESS_PROBE has the unknown setting successThreshold"},
+}
+
+func TestParseProbe(t *testing.T) {
+	for _, tt := range parseProbeTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			probe, err := cmd.ParseProbe("APPSODY_LIVENESS_PROBE", tt.value)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(probe, tt.expectedProbe) {
+				t.Errorf("Expected the probe %+v, got %+v", tt.expectedProbe, probe)
+			}
+		})
+	}
+}
+
+var overrideProbeTests = []struct {
+	testName      string
+	stack         *cmd.Probe
+	project       *cmd.Probe
+	expectedProbe *cmd.Probe
+}{
+	{"No override", &cmd.Probe{Path: "/health", Port: 8080}, nil, &cmd.Probe{Path: "/health", Port: 8080}},
+	{"Override", &cmd.Probe{Path: "/health", Port: 8080, PeriodSeconds: 10}, &cmd.Probe{Path: "/live", InitialDelaySeconds: 30},
+		&cmd.Probe{Path: "/live", Port: 8080, InitialDelaySeconds: 30, PeriodSeconds: 10}},
+	{"Disabled", &cmd.Probe{Path: "/health"}, &cmd.Probe{Disabled: true}, nil},
+	{"Project only", nil, &cmd.Probe{Path: "/live", Port: 3000}, &cmd.Probe{Path: "/live", Port: 3000}},
+	{"No probe", nil, nil, nil},
+}
+
+func TestOverrideProbe(t *testing.T) {
+	for _, tt := range overrideProbeTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			probe := tt.stack.Override(tt.project)
+
+			if !reflect.DeepEqual(probe, tt.expectedProbe) {
+				t.Errorf("Expected the probe %+v, got %+v", tt.expectedProbe, probe)
+			}
+		})
+	}
+}
+
+func TestProbesService(t *testing.T) {
+	restore := cmd.UseDeployProbes(cmd.Probes{
+		Liveness:  &cmd.Probe{Path: "/live", Port: 8080, InitialDelaySeconds: 30},
+		Readiness: &cmd.Probe{PeriodSeconds: 5},
+		Startup:   &cmd.Probe{Path: "/started", Disabled: true},
+	})
+	defer restore()
+	service := genKnativeService(t, getKNativeTemplate1(), "app", true)
+
+	container := service.Spec.RunLatest.Configuration.RevisionTemplate.Spec.Container
+	if probe := container.LivenessProbe; probe == nil || probe.HTTPGet.Path != "/live" || probe.HTTPGet.Port != 8080 || probe.InitialDelaySeconds != 30 {
+		t.Errorf("Expected the liveness probe of /live on 8080 after 30 seconds, got %+v", probe)
+	}
+	// the probe checks the root of the application when the stack gives no path
+	if probe := container.ReadinessProbe; probe == nil || probe.HTTPGet.Path != "/" || probe.PeriodSeconds != 5 {
+		t.Errorf("Expected the readiness probe of / every 5 seconds, got %+v", probe)
+	}
+	if probe := container.StartupProbe; probe != nil {
+		t.Errorf("Expected no startup probe, got %+v", probe)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var runProfile string
+
+// Stacks declare their run profiles with environment variables in the stack image:
+//
+//   APPSODY_PROFILES=hot-reload;prod-like
+//   APPSODY_PROFILE_PROD_LIKE_RUN=npm start          the command for the run, debug or test mode
+//   APPSODY_PROFILE_PROD_LIKE_ENV=NODE_ENV=production  ; separated variables for the container
+//   APPSODY_PROFILE_PROD_LIKE_PORTS=9229               ; separated ports to publish
+type runProfileDefinition struct {
+	Name    string
+	Command string
+	Env     []string
+	Ports   []string
+}
+
+// profileEnvPrefix turns a profile name into the prefix of its environment variables, prod-like is APPSODY_PROFILE_PROD_LIKE_
+func profileEnvPrefix(name string) string {
+	return "APPSODY_PROFILE_" + nonEnvChars.ReplaceAllString(strings.ToUpper(name), "_") + "_"
+}
+
+func splitStackList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getRunProfile reads the definition of the named profile from the stack image.
+// The command is the one for the given mode: run, debug or test.
+func getRunProfile(name string, mode string) (*runProfileDefinition, error) {
+	available, err := getEnvVarList("APPSODY_PROFILES")
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, profile := range available {
+		if profile == name {
+			found = true
+		}
+	}
+	if !found {
+		if len(available) == 0 {
+			return nil, errors.Errorf("The stack does not define any run profiles, so the %s profile cannot be used", name)
+		}
+		return nil, errors.Errorf("The stack does not define a run profile named %s. Available profiles: %s", name, strings.Join(available, ", "))
+	}
+	prefix := profileEnvPrefix(name)
+	profile := &runProfileDefinition{Name: name}
+	if profile.Command, err = getEnvVar(prefix + strings.ToUpper(mode)); err != nil {
+		return nil, err
+	}
+	if profile.Env, err = getEnvVarList(prefix + "ENV"); err != nil {
+		return nil, err
+	}
+	if profile.Ports, err = getEnvVarList(prefix + "PORTS"); err != nil {
+		return nil, err
+	}
+	Debug.logf("Run profile %s: %+v", name, profile)
+	return profile, nil
+}
+
+// dockerArgs returns the docker run arguments applying the profile. The profile command replaces the
+// stack's APPSODY_RUN, APPSODY_DEBUG or APPSODY_TEST command that the controller runs for the mode.
+func (p *runProfileDefinition) dockerArgs(mode string) []string {
+	var args []string
+	if p.Command != "" {
+		args = append(args, "-e", "APPSODY_"+strings.ToUpper(mode)+"="+p.Command)
+	}
+	for _, env := range p.Env {
+		args = append(args, "-e", env)
+	}
+	return args
+}
+
+// applyRunProfile reads the --profile run profile, if any, publishes its ports unless they already are,
+// and returns the docker run arguments applying it
+func applyRunProfile(mode string) ([]string, error) {
+	if runProfile == "" {
+		return nil, nil
+	}
+	profile, err := getRunProfile(runProfile, mode)
+	if err != nil {
+		return nil, err
+	}
+	Info.log("Using the stack run profile ", profile.Name)
+	for _, port := range profile.Ports {
+		published := false
+		for _, mapping := range ports {
+			if strings.HasSuffix(mapping, ":"+port) {
+				published = true
+			}
+		}
+		if !published {
+			ports = append(ports, port+":"+port)
+		}
+	}
+	return profile.dockerArgs(mode), nil
+}
@@ -0,0 +1,171 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quiet is the global --quiet option, which hides the progress lines
+var quiet bool
+
+const (
+	// progressDelay is how long an operation runs before its progress is shown, so that quick ones do not flicker
+	progressDelay = 250 * time.Millisecond
+	// progressInterval is how often the spinner of the progress lines turns
+	progressInterval = 100 * time.Millisecond
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// progressLock orders the log messages with the progress lines: they are printed above the lines, which
+// are drawn again below them
+var (
+	progressLock   sync.Mutex
+	activeProgress *progressLines
+)
+
+// progressLines shows a line per item of an operation on a terminal, such as a line per repository while
+// their indexes are read, with a spinner for the items that are not done yet
+type progressLines struct {
+	out    io.Writer
+	names  []string
+	status []string
+	done   []bool
+	width  int
+	frame  int
+	drawn  int
+	stop   chan struct{}
+	wait   sync.WaitGroup
+}
+
+// showProgress tells whether progress lines can be drawn: standard error must be a terminal, and neither
+// --quiet nor --json-events is set
+func showProgress() bool {
+	if quiet || jsonEvents {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts showing the progress of the items, once progressDelay has passed. Without a terminal it
+// returns progress lines that show nothing.
+func startProgress(names []string, status string) *progressLines {
+	p := &progressLines{out: os.Stderr, names: names, status: make([]string, len(names)), done: make([]bool, len(names))}
+	for i, name := range names {
+		p.status[i] = status
+		if len(name) > p.width {
+			p.width = len(name)
+		}
+	}
+	if !showProgress() || len(names) == 0 {
+		return p
+	}
+	p.stop = make(chan struct{})
+	p.wait.Add(1)
+	go func() {
+		defer p.wait.Done()
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(progressDelay):
+		}
+		progressLock.Lock()
+		activeProgress = p
+		p.draw()
+		progressLock.Unlock()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				progressLock.Lock()
+				p.frame++
+				p.erase()
+				p.draw()
+				progressLock.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// update sets the status of an item, done when it has finished
+func (p *progressLines) update(i int, status string, done bool) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	p.status[i] = status
+	p.done[i] = done
+}
+
+// finish stops the progress and erases its lines
+func (p *progressLines) finish() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	p.wait.Wait()
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	if activeProgress == p {
+		p.erase()
+		activeProgress = nil
+	}
+}
+
+// draw writes the lines below the cursor. progressLock must be held.
+func (p *progressLines) draw() {
+	var lines strings.Builder
+	for i, name := range p.names {
+		mark := spinnerFrames[p.frame%len(spinnerFrames)]
+		if p.done[i] {
+			mark = " "
+		}
+		fmt.Fprintf(&lines, "%s %-*s  %s\033[K\n", mark, p.width, name, p.status[i])
+	}
+	fmt.Fprint(p.out, lines.String())
+	p.drawn = len(p.names)
+}
+
+// erase moves the cursor back up and clears the lines. progressLock must be held.
+func (p *progressLines) erase() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.out, "\033[%dA\033[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+// printAboveProgress prints a log message above the progress lines being shown
+func printAboveProgress(print func()) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	if activeProgress != nil {
+		activeProgress.erase()
+		defer activeProgress.draw()
+	}
+	print()
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Do not show the progress of the commands, such as the lines of the repositories whose indexes are being downloaded.")
+}
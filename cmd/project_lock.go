@@ -0,0 +1,129 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// forceLock is the --force option of run, debug, test and build, to go on when another appsody operation holds
+// the lock of the project
+var forceLock bool
+
+// heldProjectLocks are the lock files this command holds, with their content, released when it ends
+var heldProjectLocks = map[string]string{}
+
+// projectLockFile is the lock file of the project in a directory. An instance of the project, see
+// runInstanceName, has a lock of its own.
+func projectLockFile(projectDir string, projectName string, instance string) string {
+	sum := sha256.Sum256([]byte(projectDir + "\n" + instance))
+	name := projectName
+	if instance != "" {
+		name += "-" + instance
+	}
+	return filepath.Join(getStateDir(), "locks", name+"-"+hex.EncodeToString(sum[:4])+".lock")
+}
+
+// lockProject takes the lock of the project for the operation, so that two commands, such as the run of an
+// IDE task and a build in a terminal, do not use the project's containers and files at the same time. The lock
+// of a command that ended without releasing it is taken over. --force takes the lock even when its command runs.
+func lockProject(operation string) error {
+	if dryrun {
+		return nil
+	}
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return err
+	}
+	projectName, err := getProjectName()
+	if err != nil {
+		return err
+	}
+	file := projectLockFile(projectDir, projectName, runInstanceName)
+	if _, held := heldProjectLocks[file]; held {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	lock := lockOwner(operation)
+	for attempt := 0; attempt < 2; attempt++ {
+		created, err := createLockFile(file, lock)
+		if err != nil {
+			return err
+		}
+		if created {
+			heldProjectLocks[file] = lock
+			return nil
+		}
+		owner, alive, removed, err := takeOverLock(file, forceLock)
+		if err != nil {
+			return err
+		}
+		if alive && !removed {
+			return errors.Errorf("Another appsody operation is in progress in the project: %s. Wait for it to end, or use --force if it is not running anymore.", owner)
+		}
+		if alive {
+			Warning.logf("Taking the lock of the project from %s", owner)
+		} else if owner != "" {
+			Debug.log("Taking over the lock of an ended command: ", owner)
+		}
+	}
+	return errors.New("Another appsody operation took the lock of the project at the same time, try again")
+}
+
+// projectLockOwner describes the command holding a lock file, and tells whether it still runs. As for the
+// scratch directories, the lock of a command of another machine sharing the home, or a lock that can not be
+// read, is only considered ended once it is old.
+func projectLockOwner(file string) (string, bool) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "an ended command", false
+	}
+	fields := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid := 0
+	if err == nil && len(fields) >= 4 {
+		pid, err = strconv.Atoi(fields[0])
+	}
+	if err != nil || len(fields) < 4 {
+		// a lock that can not be read yet, such as one an older CLI is writing, is only ended once it is old
+		info, statErr := os.Stat(file)
+		return "an unknown command", statErr == nil && time.Since(info.ModTime()) < scratchLockGrace
+	}
+	owner := fmt.Sprintf("appsody %s (process %d on %s, since %s)", fields[2], pid, fields[1], fields[3])
+	if host, _ := os.Hostname(); fields[1] != host {
+		started, err := time.Parse(time.RFC3339, fields[3])
+		return owner, err == nil && time.Since(started) < scratchMaxAge
+	}
+	return owner, processAlive(pid)
+}
+
+// releaseProjectLocks removes the lock files this command holds
+func releaseProjectLocks() {
+	for file, lock := range heldProjectLocks {
+		removeOwnLock(file, lock)
+		delete(heldProjectLocks, file)
+	}
+}
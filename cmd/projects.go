@@ -0,0 +1,200 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var projectRoots []string
+var projectsMaxDepth int
+
+// skippedDirs are never searched for projects, they hold dependencies or tool files
+var skippedDirs = map[string]bool{"node_modules": true, "vendor": true, "target": true, "build": true, "dist": true}
+
+// discoveredProject is an Appsody project found under a workspace root
+type discoveredProject struct {
+	Name      string
+	Dir       string
+	Stack     string
+	Version   string
+	Container string
+	Deployed  string
+}
+
+var projectsCmd = &cobra.Command{
+	Use:   "projects",
+	Short: "List the Appsody projects in your workspace directories",
+	Long: `This searches the workspace directories for Appsody projects and lists each one with its stack, the stack version it
+pins, whether its development container is running and whether it is deployed. The directories are given with --root,
+or with workspaces in the CLI configuration, otherwise the current directory is searched.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		roots := workspaceRoots()
+		projects, err := findWorkspaceProjects(roots)
+		if err != nil {
+			return err
+		}
+		if len(projects) == 0 {
+			Info.log("No Appsody projects found in ", strings.Join(roots, ", "))
+			return nil
+		}
+		addProjectStatus(projects)
+		table := uitable.New()
+		table.MaxColWidth = 60
+		table.AddRow("NAME", "STACK", "VERSION", "CONTAINER", "DEPLOYED", "PATH")
+		for _, project := range projects {
+			table.AddRow(project.Name, project.Stack, project.Version, project.Container, project.Deployed, project.Dir)
+		}
+		Info.log(table.String())
+		return nil
+	},
+}
+
+// workspaceRoots returns the directories to search for projects: the --root ones, or the workspaces of the
+// CLI configuration, or the current directory
+func workspaceRoots() []string {
+	roots := projectRoots
+	if len(roots) == 0 {
+		roots = cliConfig.GetStringSlice("workspaces")
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	return roots
+}
+
+// findWorkspaceProjects returns the projects of all the roots
+func findWorkspaceProjects(roots []string) ([]*discoveredProject, error) {
+	var projects []*discoveredProject
+	for _, root := range roots {
+		found, err := findProjects(expandHome(root), projectsMaxDepth)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, found...)
+	}
+	return projects, nil
+}
+
+// expandHome expands a leading ~ to the home directory, for the roots in the configuration
+func expandHome(dir string) string {
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		return filepath.Join(homeDir(), dir[1:])
+	}
+	return dir
+}
+
+// findProjects walks root down to maxDepth directories for .appsody-config.yaml files. Projects are
+// not searched for nested projects.
+func findProjects(root string, maxDepth int) ([]*discoveredProject, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(root); err != nil {
+		return nil, errors.Errorf("Could not read the workspace directory %s: %v", root, err)
+	}
+	var projects []*discoveredProject
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Debug.log("Skipping ", path, ": ", err)
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && (strings.HasPrefix(info.Name(), ".") || skippedDirs[info.Name()]) {
+			return filepath.SkipDir
+		}
+		if found, _ := exists(filepath.Join(path, ConfigFile)); found {
+			projects = append(projects, newDiscoveredProject(path))
+			return filepath.SkipDir
+		}
+		if rel, _ := filepath.Rel(root, path); rel != "." && len(strings.Split(rel, string(filepath.Separator))) >= maxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return projects, err
+}
+
+func newDiscoveredProject(dir string) *discoveredProject {
+	project := &discoveredProject{Name: strings.ToLower(filepath.Base(dir)), Dir: dir}
+	config, err := loadProjectConfig(dir)
+	if err != nil {
+		Warning.logf("Could not read the project config of %s: %v", dir, err)
+		project.Stack = "unknown"
+		return project
+	}
+	project.Stack = config.Platform
+	if i := strings.Index(config.Platform, "@"); i >= 0 {
+		project.Stack, project.Version = config.Platform[:i], config.Platform[i+1:]
+	} else if i := strings.LastIndex(config.Platform, ":"); i > strings.LastIndex(config.Platform, "/") {
+		project.Stack, project.Version = config.Platform[:i], config.Platform[i+1:]
+	} else {
+		project.Version = "latest"
+	}
+	return project
+}
+
+// addProjectStatus looks up the running development containers and the deployed services of the projects,
+// with one docker and one kubectl call for all of them
+func addProjectStatus(projects []*discoveredProject) {
+	containers := map[string]string{}
+	out, err := runtimeCommand("docker", "ps", "--format", "{{.Names}}\t{{.Status}}").Output()
+	dockerAvailable := err == nil
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if fields := strings.SplitN(line, "\t", 2); len(fields) == 2 {
+			containers[fields[0]] = fields[1]
+		}
+	}
+	services := map[string][]string{}
+	out, err = runtimeCommand("kubectl", kubectlConnArgs("get", "ksvc", "--all-namespaces", "-o", `jsonpath={range .items[*]}{.metadata.name}{" "}{.metadata.namespace}{"\n"}{end}`)...).Output()
+	kubeAvailable := err == nil
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			services[fields[0]] = append(services[fields[0]], fields[1])
+		}
+	}
+	for _, project := range projects {
+		project.Container, project.Deployed = "unknown", "unknown"
+		if dockerAvailable {
+			project.Container = "stopped"
+			if status, ok := containers[project.Name+"-dev"]; ok {
+				project.Container = status
+			}
+		}
+		if kubeAvailable {
+			project.Deployed = "no"
+			if namespaces, ok := services[project.Name]; ok {
+				sort.Strings(namespaces)
+				project.Deployed = strings.Join(namespaces, ", ")
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(projectsCmd)
+	projectsCmd.PersistentFlags().StringArrayVar(&projectRoots, "root", nil, "Directory to search for projects, instead of the workspaces of the CLI configuration. Can be repeated.")
+	projectsCmd.PersistentFlags().IntVar(&projectsMaxDepth, "max-depth", 4, "How many directories deep to search for projects.")
+}
@@ -0,0 +1,60 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var nonInteractive bool
+
+// stdinIsTerminal tells whether someone can answer prompts: it is false in CI jobs and when input is piped
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// </dev/null is a character device too
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, devNull)
+}
+
+// initInteractive turns on --non-interactive when nobody can answer prompts
+func initInteractive() {
+	if !nonInteractive && !stdinIsTerminal() {
+		Debug.log("Standard input is not a terminal, running non-interactive")
+		nonInteractive = true
+	}
+}
+
+// promptConfirm asks a yes or no question, no being the default. In non-interactive mode it fails instead
+// of waiting for an answer that never comes, and names the flag that answers the question.
+func promptConfirm(question string, answerFlag string) (bool, error) {
+	if nonInteractive {
+		return false, errors.Errorf("%s Running non-interactive, so use %s to answer yes.", question, answerFlag)
+	}
+	fmt.Print(question, " [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, errors.Errorf("Could not read the answer: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,173 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var provenanceFile string
+
+// lastProvenance is the provenance of the last image built, attached to it when deploy pushes it
+var lastProvenance *provenanceStatement
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v0.2"
+	appsodyBuildType    = "https://appsody.dev/build/v1"
+)
+
+// provenanceStatement is an in-toto statement carrying a SLSA provenance predicate
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	Subject       []provenanceSubject `json:"subject"`
+	PredicateType string              `json:"predicateType"`
+	Predicate     slsaProvenance      `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	Builder    slsaBuilder    `json:"builder"`
+	BuildType  string         `json:"buildType"`
+	Invocation slsaInvocation `json:"invocation"`
+	Metadata   slsaMetadata   `json:"metadata"`
+	Materials  []slsaMaterial `json:"materials,omitempty"`
+}
+
+type slsaBuilder struct {
+	ID string `json:"id"`
+}
+
+type slsaInvocation struct {
+	ConfigSource slsaMaterial      `json:"configSource,omitempty"`
+	Parameters   map[string]string `json:"parameters,omitempty"`
+}
+
+type slsaMetadata struct {
+	BuildStartedOn  string `json:"buildStartedOn"`
+	BuildFinishedOn string `json:"buildFinishedOn"`
+	// the build is only reproducible when the source tree has no local changes
+	Reproducible bool `json:"reproducible"`
+}
+
+type slsaMaterial struct {
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// splitDigest splits sha256:abc into its algorithm and value
+func splitDigest(digest string) map[string]string {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	return map[string]string{parts[0]: parts[1]}
+}
+
+// imageDigest returns the content digest of a local image: the registry digest if it was pushed or pulled,
+// the image id otherwise
+func imageDigest(image string) (string, string, error) {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{.Id}} {{range .RepoDigests}}{{.}} {{end}}", image).Output()
+	if err != nil {
+		return "", "", errors.Errorf("Could not inspect the image %s: %v", image, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", "", errors.Errorf("Could not find the digest of the image %s", image)
+	}
+	if len(fields) > 1 {
+		// repo@sha256:...
+		repoDigest := fields[1]
+		at := strings.LastIndex(repoDigest, "@")
+		return repoDigest[:at], repoDigest[at+1:], nil
+	}
+	return image, fields[0], nil
+}
+
+// generateProvenance describes how the image was built from the project source and the stack image
+func generateProvenance(buildImage string, stackImage string, projectDir string, started time.Time, parameters map[string]string) (*provenanceStatement, error) {
+	name, digest, err := imageDigest(buildImage)
+	if err != nil {
+		return nil, err
+	}
+	statement := &provenanceStatement{
+		Type:          inTotoStatementType,
+		Subject:       []provenanceSubject{{Name: name, Digest: splitDigest(digest)}},
+		PredicateType: slsaProvenanceType,
+		Predicate: slsaProvenance{
+			Builder:    slsaBuilder{ID: "https://github.com/appsody/appsody@" + VERSION},
+			BuildType:  appsodyBuildType,
+			Invocation: slsaInvocation{Parameters: parameters},
+			Metadata: slsaMetadata{
+				BuildStartedOn:  started.UTC().Format(time.RFC3339),
+				BuildFinishedOn: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	if git := getGitMetadata(projectDir); git != nil {
+		remote, _ := gitOutput(projectDir, "config", "--get", "remote.origin.url")
+		if remote == "" {
+			remote = projectDir
+		}
+		source := slsaMaterial{URI: "git+" + remote + "@" + git.Branch, Digest: map[string]string{"sha1": git.Commit}}
+		statement.Predicate.Invocation.ConfigSource = source
+		statement.Predicate.Materials = append(statement.Predicate.Materials, source)
+		statement.Predicate.Metadata.Reproducible = !git.Dirty
+	}
+	stackName, stackDigest, err := imageDigest(stackImage)
+	if err != nil {
+		return nil, err
+	}
+	statement.Predicate.Materials = append(statement.Predicate.Materials, slsaMaterial{URI: "pkg:docker/" + stackName, Digest: splitDigest(stackDigest)})
+	return statement, nil
+}
+
+func writeProvenance(statement *provenanceStatement, file string) error {
+	data, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// attachProvenance attaches the provenance predicate to a pushed image as an attestation, using cosign
+func attachProvenance(image string, statement *provenanceStatement) error {
+	if _, err := exec.LookPath("cosign"); err != nil && !dryrun {
+		return errors.New("cosign is required to attach the provenance to the image, see https://github.com/sigstore/cosign")
+	}
+	predicate, err := ioutil.TempFile("", "appsody-provenance")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(predicate.Name())
+	err = json.NewEncoder(predicate).Encode(statement.Predicate)
+	predicate.Close()
+	if err != nil {
+		return err
+	}
+	Info.log("Attaching the provenance to ", image)
+	return execAndWaitReturnErr("cosign", []string{"attest", "--predicate", predicate.Name(), "--type", "slsaprovenance", image}, Debug)
+}
@@ -0,0 +1,299 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// The labels of the resources deploy creates, and of the development containers of appsody run
+const (
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	appNameLabel      = "app.kubernetes.io/name"
+	devProjectLabel   = "dev.appsody.project"
+	appsodyManagedBy  = "appsody"
+	operatorManagedBy = "appsody-operator"
+)
+
+var psK8s bool
+var psNamespaces []string
+var psAllNamespaces bool
+
+// k8sResource holds the fields ps reads from the Knative services, deployments and pods of the cluster
+type k8sResource struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name              string            `json:"name"`
+		Namespace         string            `json:"namespace"`
+		Labels            map[string]string `json:"labels"`
+		CreationTimestamp time.Time         `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		Replicas          int `json:"replicas"`
+		ReadyReplicas     int `json:"readyReplicas"`
+		ContainerStatuses []struct {
+			Name    string `json:"name"`
+			Ready   bool   `json:"ready"`
+			Image   string `json:"image"`
+			ImageID string `json:"imageID"`
+		} `json:"containerStatuses"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		// URL and the revisions are the status of a Knative service
+		URL                       string `json:"url"`
+		LatestReadyRevisionName   string `json:"latestReadyRevisionName"`
+		LatestCreatedRevisionName string `json:"latestCreatedRevisionName"`
+	} `json:"status"`
+}
+
+// deployedApp is a row of ps --k8s
+type deployedApp struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Image     string
+	Ready     string
+	Age       string
+}
+
+var psCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "List the running Appsody applications",
+	Long: `This lists the development containers of appsody run, debug and test, and the containers of the services of
+the projects, running on the docker engine.
+
+With --k8s it lists the applications deployed to your Kubernetes cluster instead: the Knative services appsody
+deploy created and the deployments of the Appsody operator, with the digest of the image their pods run, how many
+of their pods are ready and their age. The current namespace is searched, or the ones given with --namespace, or
+all of them with --all-namespaces.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !psK8s {
+			if len(psNamespaces) > 0 || psAllNamespaces {
+				return errors.New("--namespace and --all-namespaces list deployed applications, use them with --k8s")
+			}
+			return listDevContainers()
+		}
+		apps, err := listDeployedApps()
+		if err != nil {
+			return err
+		}
+		if len(apps) == 0 {
+			Info.log("No Appsody applications are deployed in the namespaces searched")
+			return nil
+		}
+		table := uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("NAMESPACE", "KIND", "NAME", "IMAGE", "READY", "AGE")
+		for _, app := range apps {
+			table.AddRow(app.Namespace, app.Kind, app.Name, app.Image, app.Ready, app.Age)
+		}
+		Info.log(table.String())
+		return nil
+	},
+}
+
+// managedLabels are the labels of the resources deploy generates for a service
+func managedLabels(serviceName string) map[string]string {
+	return map[string]string{managedByLabel: appsodyManagedBy, appNameLabel: serviceName}
+}
+
+func listDevContainers() error {
+	out, err := runtimeCommand("docker", "ps", "--filter", "label="+devProjectLabel, "--format",
+		"{{.Names}}\t{{.Label \""+devProjectLabel+"\"}}\t{{.Image}}\t{{.Status}}\t{{.Ports}}").Output()
+	if err != nil {
+		return errors.Errorf("Could not list the containers of the docker engine: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		Info.log("No Appsody containers are running")
+		return nil
+	}
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.AddRow("CONTAINER", "PROJECT", "IMAGE", "STATUS", "PORTS")
+	for _, line := range lines {
+		fields := strings.SplitN(line, "\t", 5)
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+		table.AddRow(fields[0], fields[1], fields[2], fields[3], fields[4])
+	}
+	Info.log(table.String())
+	return nil
+}
+
+// listDeployedApps lists the Appsody Knative services and deployments of the namespaces, with one kubectl
+// call per namespace
+func listDeployedApps() ([]deployedApp, error) {
+	selector := fmt.Sprintf("%s in (%s,%s)", managedByLabel, appsodyManagedBy, operatorManagedBy)
+	var scopes [][]string
+	switch {
+	case psAllNamespaces:
+		scopes = [][]string{{"--all-namespaces"}}
+	case len(psNamespaces) > 0:
+		for _, ns := range psNamespaces {
+			scopes = append(scopes, []string{"--namespace", ns})
+		}
+	default:
+		scopes = [][]string{nil}
+	}
+	var resources []k8sResource
+	for _, scope := range scopes {
+		args := append([]string{"get", "ksvc,deployments,pods", "-l", selector, "-o", "json"}, scope...)
+		if scope == nil {
+			args = kubectlArgs(args...)
+		} else {
+			args = kubectlConnArgs(args...)
+		}
+		var stderr bytes.Buffer
+		kubectlCmd := runtimeCommand("kubectl", args...)
+		kubectlCmd.Stderr = &stderr
+		out, err := kubectlCmd.Output()
+		if err != nil {
+			return nil, errors.Errorf("Could not list the applications of the cluster: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+		var list struct {
+			Items []k8sResource `json:"items"`
+		}
+		if err = json.Unmarshal(out, &list); err != nil {
+			return nil, errors.Errorf("Could not read the resources kubectl listed: %v", err)
+		}
+		resources = append(resources, list.Items...)
+	}
+	return deployedApps(resources, time.Now()), nil
+}
+
+// deployedApps turns the services and deployments into rows, with the image and readiness of their pods
+func deployedApps(resources []k8sResource, now time.Time) []deployedApp {
+	pods := map[string][]k8sResource{}
+	for _, resource := range resources {
+		if resource.Kind == "Pod" {
+			key := resource.Metadata.Namespace + "/" + resource.Metadata.Labels[appNameLabel]
+			pods[key] = append(pods[key], resource)
+		}
+	}
+	var apps []deployedApp
+	for _, resource := range resources {
+		if resource.Kind == "Pod" {
+			continue
+		}
+		app := deployedApp{
+			Namespace: resource.Metadata.Namespace,
+			Kind:      resource.Kind,
+			Name:      resource.Metadata.Name,
+			Age:       formatAge(now.Sub(resource.Metadata.CreationTimestamp)),
+		}
+		appPods := pods[resource.Metadata.Namespace+"/"+resource.Metadata.Name]
+		ready := 0
+		for _, pod := range appPods {
+			for _, container := range pod.Status.ContainerStatuses {
+				if app.Image == "" && container.Name != "queue-proxy" {
+					app.Image = imageWithDigest(container.Image, container.ImageID)
+				}
+			}
+			if podReady(pod) {
+				ready++
+			}
+		}
+		if resource.Kind == "Deployment" {
+			app.Ready = fmt.Sprintf("%d/%d", resource.Status.ReadyReplicas, resource.Status.Replicas)
+		} else {
+			// Knative scales the pods of idle services to zero, the service is ready when it can take requests
+			app.Ready = fmt.Sprintf("%d/%d", ready, len(appPods))
+			if resourceReady(resource) {
+				app.Ready += " (ready)"
+			}
+		}
+		if app.Image == "" {
+			app.Image = "-"
+		}
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Namespace != apps[j].Namespace {
+			return apps[i].Namespace < apps[j].Namespace
+		}
+		return apps[i].Name < apps[j].Name
+	})
+	return apps
+}
+
+// podReady tells whether all the containers of a pod are ready
+func podReady(pod k8sResource) bool {
+	for _, container := range pod.Status.ContainerStatuses {
+		if !container.Ready {
+			return false
+		}
+	}
+	return len(pod.Status.ContainerStatuses) > 0
+}
+
+func resourceReady(resource k8sResource) bool {
+	for _, condition := range resource.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// imageWithDigest returns the image a pod runs with its digest, from the image ID the kubelet reports
+func imageWithDigest(image string, imageID string) string {
+	i := strings.LastIndex(imageID, "@")
+	if i < 0 {
+		return image
+	}
+	name := image
+	if j := strings.LastIndex(name, "@"); j >= 0 {
+		name = name[:j]
+	} else if j := strings.LastIndex(name, ":"); j > strings.LastIndex(name, "/") {
+		name = name[:j]
+	}
+	return name + imageID[i:]
+}
+
+// formatAge formats a duration the way kubectl shows ages: 45s, 12m, 5h or 3d
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+func init() {
+	rootCmd.AddCommand(psCmd)
+	psCmd.PersistentFlags().BoolVar(&psK8s, "k8s", false, "List the applications deployed to your Kubernetes cluster instead of the local containers.")
+	psCmd.PersistentFlags().StringArrayVarP(&psNamespaces, "namespace", "n", nil, "Namespace to list the deployed applications of. Can be repeated.")
+	psCmd.PersistentFlags().BoolVarP(&psAllNamespaces, "all-namespaces", "A", false, "List the deployed applications of all the namespaces.")
+	psCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig file to use with --k8s. By default kubectl's own configuration.")
+}
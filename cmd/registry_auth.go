@@ -0,0 +1,199 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// registryAuthFile is the part of the docker config.json, and of the podman auth.json, that holds credentials
+type registryAuthFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// registryCredential is a user name and password, or an identity token when the user name is <token>
+type registryCredential struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// registryAuthFiles lists the files docker and podman keep registry credentials in, docker first
+func registryAuthFiles() []string {
+	dockerConfig := os.Getenv("DOCKER_CONFIG")
+	if dockerConfig == "" {
+		dockerConfig = filepath.Join(UserHomeDir(), ".docker")
+	}
+	files := []string{filepath.Join(dockerConfig, "config.json")}
+	if authFile := os.Getenv("REGISTRY_AUTH_FILE"); authFile != "" {
+		files = append(files, authFile)
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		files = append(files, filepath.Join(runtimeDir, "containers", "auth.json"))
+	}
+	return append(files, filepath.Join(UserHomeDir(), ".config", "containers", "auth.json"))
+}
+
+// registryHost normalizes the keys of the auths section, which can be a host, a host and path, or a URL
+func registryHost(key string) string {
+	if u, err := url.Parse(key); err == nil && u.Host != "" {
+		key = u.Host
+	}
+	key = strings.SplitN(key, "/", 2)[0]
+	if key == "index.docker.io" || key == "registry-1.docker.io" {
+		return "docker.io"
+	}
+	return key
+}
+
+// credentialHelper runs docker-credential-<helper> get for the host, as docker does
+func credentialHelper(helper string, host string) (*registryCredential, error) {
+	helperCmd := exec.Command("docker-credential-"+helper, "get")
+	helperCmd.Stdin = strings.NewReader(host)
+	var stderr bytes.Buffer
+	helperCmd.Stderr = &stderr
+	out, err := helperCmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("the %s credential helper failed: %v %s", helper, err, strings.TrimSpace(stderr.String()+string(out)))
+	}
+	var credential registryCredential
+	if err = json.Unmarshal(out, &credential); err != nil {
+		return nil, errors.Errorf("the %s credential helper returned invalid credentials: %v", helper, err)
+	}
+	return &credential, nil
+}
+
+// registryCredentials returns the credentials docker login or podman login stored for the host,
+// or nil when there are none
+func registryCredentials(host string) *registryCredential {
+	host = registryHost(host)
+	for _, file := range registryAuthFiles() {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var authFile registryAuthFile
+		if err = json.Unmarshal(data, &authFile); err != nil {
+			Debug.logf("Could not parse the registry credentials in %s: %v", file, err)
+			continue
+		}
+		if helper := authFile.CredHelpers[host]; helper != "" {
+			credential, err := credentialHelper(helper, host)
+			if err == nil {
+				return credential
+			}
+			Debug.log(err)
+			continue
+		}
+		for key, auth := range authFile.Auths {
+			if registryHost(key) != host {
+				continue
+			}
+			if auth.IdentityToken != "" {
+				return &registryCredential{Username: "<token>", Secret: auth.IdentityToken}
+			}
+			if decoded, err := base64.StdEncoding.DecodeString(auth.Auth); err == nil {
+				if userPass := strings.SplitN(string(decoded), ":", 2); len(userPass) == 2 {
+					return &registryCredential{Username: userPass[0], Secret: userPass[1]}
+				}
+			}
+		}
+		if authFile.CredsStore != "" {
+			credential, err := credentialHelper(authFile.CredsStore, host)
+			if err == nil && credential.Secret != "" {
+				return credential
+			}
+		}
+	}
+	return nil
+}
+
+// addRegistryAuth authorizes the request with the registry credentials stored for its host. It is only used after
+// the server asked for credentials, and never over plain http, so the credentials are not sent where they are not needed.
+func addRegistryAuth(req *http.Request) bool {
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return false
+	}
+	credential := registryCredentials(req.URL.Host)
+	if credential == nil {
+		return false
+	}
+	Debug.log("Using the registry credentials stored for ", req.URL.Host)
+	if credential.Username == "<token>" {
+		req.Header.Set("Authorization", "Bearer "+credential.Secret)
+	} else {
+		req.SetBasicAuth(credential.Username, credential.Secret)
+	}
+	return true
+}
+
+// RegistryLogin are the credentials deploy --push logs in to the registry with. They are best given as
+// secret references, see expandSecretRefs:
+//
+//   registry:
+//     server: quay.io
+//     username: ${secret:env:QUAY_USER}
+//     password: ${secret:keychain:quay.io}
+//
+// Without a server, the registry of the pushed image is used.
+type RegistryLogin struct {
+	Server   string `yaml:"server,omitempty"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// login runs docker login for the image, the password is passed on stdin so it is not on the command line
+func (r *RegistryLogin) login(image string) error {
+	server := r.Server
+	if server == "" {
+		host, _, _ := imageReference(image)
+		server = registryHost(host)
+	}
+	username, err := expandSecretRefs(r.Username)
+	if err != nil {
+		return errors.Errorf("Could not resolve the registry user name of %s: %v", ConfigFile, err)
+	}
+	password, err := expandSecretRefs(r.Password)
+	if err != nil {
+		return errors.Errorf("Could not resolve the registry password of %s: %v", ConfigFile, err)
+	}
+	cmdArgs := []string{"login", "--username", username, "--password-stdin", server}
+	if dryrun {
+		plannedCommand("docker", cmdArgs)
+		return nil
+	}
+	loginCmd := runtimeCommand("docker", cmdArgs...)
+	loginCmd.Stdin = strings.NewReader(password)
+	if out, err := loginCmd.CombinedOutput(); err != nil {
+		return errors.Errorf("Could not log in to %s: %v %s", server, err, strings.TrimSpace(string(out)))
+	}
+	Info.log("Logged in to ", server)
+	return nil
+}
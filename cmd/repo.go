@@ -16,13 +16,19 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gosuri/uitable"
@@ -34,7 +40,24 @@ import (
 type RepoIndex struct {
 	APIVersion string                     `yaml:"apiVersion"`
 	Generated  time.Time                  `yaml:"generated"`
-	Projects   map[string]ProjectVersions `yaml:"projects"`
+	Projects   map[string]ProjectVersions `yaml:"projects,omitempty"`
+	// Stacks lists the stack versions of a v2 index, see IndexStack. They are moved to Projects once the
+	// index is decoded.
+	Stacks []*IndexStack `yaml:"stacks,omitempty"`
+	// Shards are the sub-indexes of the stacks that are not in Projects, see IndexShard
+	Shards []*IndexShard `yaml:"shards,omitempty"`
+	// Offline are the repositories getIndex read from their cached index as they could not be reached, with
+	// when it was cached
+	Offline map[string]time.Time `yaml:"offline,omitempty"`
+	// merged indexes, the ones of getIndex, key the stacks by <repository>/<stack id>, see resolveStack
+	merged bool
+	// defaultRepo is the repository whose stack wins when several repositories have the stack id
+	defaultRepo string
+	// strategies are the merge strategies of the repositories of a merged index, by repository
+	strategies map[string]string
+	// lock guards the population of the index, as the indexes of the repositories can be merged as they are
+	// read in parallel. The lookups are made once the index is populated.
+	lock sync.Mutex
 }
 
 type ProjectVersions []*ProjectVersion
@@ -49,8 +72,51 @@ type ProjectVersion struct {
 	Keywords    []string  `yaml:"keywords"`
 	Maintainers []string  `yaml:"maintainers"`
 	Icon        string    `yaml:"icon"`
-	Digest      string    `yaml:"digest"`
-	URLs        []string  `yaml:"urls"`
+	// Digest is the sha256 of the first URL, the default template, verified when it is downloaded
+	Digest string   `yaml:"digest"`
+	URLs   []string `yaml:"urls"`
+	// Architectures lists the platforms the stack image is published for,
+	// e.g. amd64 or linux/s390x. An empty list means any architecture.
+	Architectures []string `yaml:"architectures,omitempty"`
+	// Templates names and describes the template archives of URLs. Older indexes only have the URLs.
+	Templates []StackTemplate `yaml:"templates,omitempty"`
+	// Image is the stack image, with the digest it is published with, such as
+	// appsody/nodejs:0.2@sha256:... Older indexes leave it to the templates to name it.
+	Image string `yaml:"image,omitempty"`
+	// Samples are runnable example applications built on the stack, see appsody list --samples
+	Samples []StackSample `yaml:"samples,omitempty"`
+	// RequiresCLI is the version constraint on the Appsody CLI, such as >=0.6.0 or >=0.5.0,<1.0.0
+	RequiresCLI string `yaml:"requires-cli,omitempty"`
+	// RequiresAppsodyVersion is the oldest Appsody CLI the stack works with, such as 0.6.0. It can also be a
+	// constraint like RequiresCLI, both have to be met.
+	RequiresAppsodyVersion string `yaml:"requiresAppsodyVersion,omitempty"`
+	// License is the SPDX identifier of the license of the stack, such as Apache-2.0
+	License string `yaml:"license,omitempty"`
+	// Deprecated tells why the stack is deprecated, and what replaces it, or is true
+	Deprecated string `yaml:"deprecated,omitempty"`
+	// Env are the environment variables the stack honors, see appsody info --env
+	Env []StackEnvVar `yaml:"env,omitempty"`
+	// repo is the repository the version comes from, set for the indexes of repositories and merged indexes
+	repo string
+}
+
+// StackTemplate is a template of a stack in the index. Its URL is one of the URLs of the stack.
+type StackTemplate struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	URL         string `yaml:"url"`
+	// Digest is the sha256 of the archive, verified when it is downloaded
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// StackSample is a working example application of a stack, an archive laid down like a template by
+// appsody init <stack> --from-sample <name>
+type StackSample struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	URL         string `yaml:"url"`
+	// Digest is the sha256 of the archive, verified when it is downloaded
+	Digest string `yaml:"digest,omitempty"`
 }
 
 type RepositoryFile struct {
@@ -62,6 +128,72 @@ type RepositoryFile struct {
 type RepositoryEntry struct {
 	Name string `yaml:"name"`
 	URL  string `yaml:"url"`
+	// Type is http, for an index at an http, https or file URL, or oci for the artifacts of an OCI registry.
+	// By default oci for oci:// URLs, otherwise http.
+	Type string `yaml:"type,omitempty"`
+	// Branch and Tag are the branch or tag the stacks of a git repository are read from, by default its
+	// default branch
+	Branch string `yaml:"branch,omitempty"`
+	Tag    string `yaml:"tag,omitempty"`
+	// Headers are sent with the downloads from the server of the repository. The values can refer
+	// to secrets, see resolveSecretRef.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Auth are the credentials of the downloads from the server of the repository
+	Auth *RepositoryAuth `yaml:"auth,omitempty"`
+	// AllowInsecure allows a plain http URL, and plain http template URLs in the index
+	AllowInsecure bool `yaml:"allowInsecure,omitempty"`
+	// Timeout bounds each attempt of the download of the index, such as 10s. By default the download timeout of the CLI.
+	Timeout string `yaml:"timeout,omitempty"`
+	// OnFailure is skip, the default, to go on with the other repositories when the index can not be
+	// downloaded, or fail to fail the command
+	OnFailure string `yaml:"onFailure,omitempty"`
+	// Default makes the stacks of the repository win over the stacks of the other repositories with the
+	// same id, see appsody repo default
+	Default bool `yaml:"default,omitempty"`
+	// PublicKey is the PEM public key the index of the repository is signed with, see fetchSignedIndex
+	PublicKey string `yaml:"publicKey,omitempty"`
+	// Merge is how the stacks of the repository are merged with the stacks of the same id of the other
+	// repositories, see mergeStack: merge, the default, supplement, override or isolated
+	Merge string `yaml:"merge,omitempty"`
+}
+
+// The failure policies of a repository
+const (
+	repoOnFailureSkip = "skip"
+	repoOnFailureFail = "fail"
+)
+
+// The merge strategies of a repository. merge keeps the stacks of all the repositories with the same id,
+// supplement only adds the stacks no other repository has, override replaces the stacks of the other
+// repositories with the same id, and the stacks of an isolated repository are only found by <repository>/<id>.
+const (
+	repoMergeMerge      = "merge"
+	repoMergeSupplement = "supplement"
+	repoMergeOverride   = "override"
+	repoMergeIsolated   = "isolated"
+)
+
+// checkRepoMerge fails for a merge strategy that is not known
+func checkRepoMerge(strategy string) error {
+	switch strategy {
+	case "", repoMergeMerge, repoMergeSupplement, repoMergeOverride, repoMergeIsolated:
+		return nil
+	}
+	return errors.Errorf("Unknown merge strategy %q, use merge, supplement, override or isolated", strategy)
+}
+
+// mergeRank orders the strategies of the repositories whose stacks have the same id: the stacks of the
+// higher rank win. The stacks of isolated repositories do not compete.
+func mergeRank(strategy string) (int, bool) {
+	switch strategy {
+	case repoMergeIsolated:
+		return 0, false
+	case repoMergeSupplement:
+		return 0, true
+	case repoMergeOverride:
+		return 2, true
+	}
+	return 1, true
 }
 
 var (
@@ -79,8 +211,19 @@ func getHome() string {
 	return cliConfig.GetString("home")
 }
 
+// getRepoDir returns the directory of the repository file, the one of the active context if any. With a
+// read-only home that has no repository file, the repository file is kept in the state directory.
 func getRepoDir() string {
-	return filepath.Join(getHome(), "repository")
+	dir := filepath.Join(getHome(), "repository")
+	if activeContext != "" {
+		dir = filepath.Join(contextDir(activeContext), "repository")
+	}
+	if homeReadOnly {
+		if _, err := os.Stat(filepath.Join(dir, "repository.yaml")); err != nil {
+			return repoStateDir()
+		}
+	}
+	return dir
 }
 
 func getRepoFileLocation() string {
@@ -92,11 +235,20 @@ func init() {
 }
 
 // Locate or create config structure in $APPSODY_HOME
-func ensureConfig() {
+func ensureConfig() error {
+	if dryrun {
+		stateDirPath = getStateDir()
+	} else if stateDirPath = chooseStateDir(); stateDirPath == "" {
+		return errors.Errorf("Could not write in %s, set %s or stateDir in the configuration to a directory that can be written", getHome(), stateDirEnv)
+	}
 	directories := []string{
 		getHome(),
 		getRepoDir(),
 	}
+	if homeReadOnly {
+		Debug.logw("The appsody home is read-only, writing in the state directory instead", "home", getHome(), "stateDir", stateDirPath)
+		directories = directories[1:]
+	}
 
 	for _, p := range directories {
 		if fi, err := os.Stat(p); err != nil {
@@ -104,16 +256,14 @@ func ensureConfig() {
 			if dryrun {
 				Info.log("Dry Run - Skipping create of directory ", p)
 			} else {
-				Debug.log("Creating ", p)
+				Debug.logw("Creating the directory", "path", p)
 				if err := os.MkdirAll(p, 0755); err != nil {
-					Error.logf("Could not create %s: %s", p, err)
-					os.Exit(1)
+					return errors.Errorf("Could not create %s: %s", p, err)
 				}
 			}
 
 		} else if !fi.IsDir() {
-			Error.logf("%s must be a directory", p)
-			os.Exit(1)
+			return errors.Errorf("%s must be a directory", p)
 		}
 	}
 
@@ -125,31 +275,26 @@ func ensureConfig() {
 			Info.log("Dry Run - Skipping creation of appsodyhub repo: ", appsodyHubURL)
 		} else {
 
-			repo := NewRepoFile()
-			repo.Add(&RepositoryEntry{
-				Name: "appsodyhub",
-				URL:  appsodyHubURL,
-			})
-			Debug.log("Creating ", repoFileLocation)
-			if err := repo.WriteFile(repoFileLocation); err != nil {
-				Error.logf("Error writing %s file: %s ", repoFileLocation, err)
-				os.Exit(1)
+			if err := createRepoFile(repoFileLocation); err != nil {
+				return errors.Errorf("Error writing %s file: %s ", repoFileLocation, err)
 			}
 		}
 	} else if file.IsDir() {
-		Error.logf("%s must be a file, not a directory ", repoFileLocation)
-		os.Exit(1)
+		return errors.Errorf("%s must be a file, not a directory ", repoFileLocation)
 	}
 
+	// the configuration of a read-only home is only read
+	if homeReadOnly {
+		return nil
+	}
 	defaultConfigFile := getDefaultConfigFile()
 	if _, err := os.Stat(defaultConfigFile); err != nil {
 		if dryrun {
 			Info.log("Dry Run - Skip creation of default config file ", defaultConfigFile)
 		} else {
-			Debug.log("Creating ", defaultConfigFile)
-			if err := ioutil.WriteFile(defaultConfigFile, []byte{}, 0644); err != nil {
-				Error.logf("Error creating default config file %s", err)
-				os.Exit(1)
+			Debug.logw("Creating the configuration file", "path", defaultConfigFile)
+			if err := writeFileAtomic(defaultConfigFile, []byte{}, 0644); err != nil {
+				return errors.Errorf("Error creating default config file %s", err)
 			}
 		}
 	}
@@ -157,142 +302,708 @@ func ensureConfig() {
 	if dryrun {
 		Info.log("Dry Run - Skip writing config file ", defaultConfigFile)
 	} else {
-		Debug.log("Writing config file ", defaultConfigFile)
-		if err := cliConfig.WriteConfig(); err != nil {
-			Error.logf("Writing default config file %s", err)
-			os.Exit(1)
+		Debug.logw("Writing the configuration file", "path", defaultConfigFile)
+		if err := writeConfig(); err != nil {
+			return errors.Errorf("Writing default config file %s", err)
 		}
 	}
-
+	return nil
 }
 
 func downloadFile(href string, writer io.Writer) error {
-
-	// allow file:// scheme
-	t := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-	}
-	Debug.log("Proxy function for HTTP transport set to: ", &t.Proxy)
-	if runtime.GOOS == "windows" {
-		// For Windows, remove the root url. It seems to work fine with an empty string.
-		t.RegisterProtocol("file", http.NewFileTransport(http.Dir("")))
-	} else {
-		t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	if err := checkSecureURL(href, insecureAllowed(href)); err != nil {
+		return err
 	}
-
-	httpClient := &http.Client{Transport: t}
-
-	req, err := http.NewRequest("GET", href, nil)
+	headers, err := repoHeaders(href)
 	if err != nil {
 		return err
 	}
+	return downloadFileWithHeaders(href, writer, headers)
+}
+
+// downloadFileWithHeaders downloads href with the extra headers of its repository
+func downloadFileWithHeaders(href string, writer io.Writer, headers map[string]string) error {
+	return downloadFileWithTimeout(href, writer, headers, 0)
+}
 
-	resp, err := httpClient.Do(req)
+// downloadFileWithTimeout downloads href with the extra headers of its repository. Each attempt gives up after
+// the timeout, or the download timeout when it is 0, and failed attempts are retried, see downloadAttempt.
+func downloadFileWithTimeout(href string, writer io.Writer, headers map[string]string, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = downloadTimeout()
+	}
+	httpClient, err := newHTTPClient(timeout)
 	if err != nil {
 		return err
 	}
+	httpClient.CheckRedirect = dropHeadersOnRedirect(headers)
 
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		buf, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			Debug.log("Could not read contents of response body: ", err)
-		} else {
-			Debug.logf("Contents http response:\n%s", buf)
+	checksum := sha256.New()
+	dest := &resumableWriter{writer: io.MultiWriter(writer, checksum)}
+	retries := downloadRetries()
+	var req *http.Request
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		var err error
+		req, resp, retry, err = downloadAttempt(httpClient, href, headers, dest)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= retries || cliContext().Err() != nil || !waitToRetry(href, attempt, retries, resp, err) {
+			if retry || resp != nil {
+				return transferError{err}
+			}
+			return err
 		}
-		resp.Body.Close()
-		return fmt.Errorf("%s response trying to download %s", resp.Status, href)
 	}
+	if err := verifyDownloadChecksum(httpClient, req, resp, hex.EncodeToString(checksum.Sum(nil))); err != nil {
+		return err
+	}
+	return verifyPublishedDigest(href, hex.EncodeToString(checksum.Sum(nil)))
+}
 
-	_, err = io.Copy(writer, resp.Body)
+func downloadIndex(url string) (*RepoIndex, error) {
+	if err := checkSecureURL(url, insecureAllowed(url)); err != nil {
+		return nil, err
+	}
+	headers, err := repoHeaders(url)
 	if err != nil {
-		return fmt.Errorf("Could not copy http response body to writer: %s", err)
+		return nil, err
 	}
-	resp.Body.Close()
-	return nil
+	return downloadIndexWithHeaders(url, headers)
 }
 
-func downloadIndex(url string) (*RepoIndex, error) {
-	Debug.log("Downloading appsody repository index from ", url)
+func downloadIndexWithHeaders(url string, headers map[string]string) (*RepoIndex, error) {
+	return downloadIndexWithTimeout(url, headers, 0)
+}
+
+// downloadIndexWithTimeout downloads an index, giving up after the timeout unless it is 0
+func downloadIndexWithTimeout(url string, headers map[string]string, timeout time.Duration) (*RepoIndex, error) {
+	// a directory of an artifact server, with or without an index
+	if strings.HasSuffix(url, "/") {
+		index, err := downloadIndexWithTimeout(url+"index.yaml", headers, timeout)
+		if err == nil {
+			return index, nil
+		}
+		Debug.logw("No index.yaml in the repository directory, reading its listing", "url", url, "error", err)
+		return listingIndex(url, headers, timeout)
+	}
+	Debug.logw("Downloading the repository index", "url", url)
 	indexBuffer := bytes.NewBuffer(nil)
-	err := downloadFile(url, indexBuffer)
+	err := downloadFileWithTimeout(url, indexBuffer, headers, timeout)
 	if err != nil {
-		return nil, errors.Errorf("Failed to get repository index: %s", err)
+		return nil, errors.Wrap(err, "Failed to get repository index")
 	}
 
 	yamlFile, err := ioutil.ReadAll(indexBuffer)
 	if err != nil {
 		return nil, fmt.Errorf("Could not read buffer into byte array")
 	}
-	var index RepoIndex
-	err = yaml.Unmarshal(yamlFile, &index)
+	return parseIndex(url, yamlFile, headers, timeout)
+}
+
+// parseIndex decodes an index downloaded from the URL, and prepares its shards to be downloaded like it
+func parseIndex(url string, yamlFile []byte, headers map[string]string, timeout time.Duration) (*RepoIndex, error) {
+	index, err := decodeRepoIndex(yamlFile)
 	if err != nil {
 		Debug.logf("Contents of downloaded index from %s\n%s", url, yamlFile)
 		return nil, fmt.Errorf("Repository index formatting error: %s", err)
 	}
-	return &index, nil
+	if err = checkIndexAPIVersion(url, index.APIVersion); err != nil {
+		return nil, err
+	}
+	resolveTemplateURLs(index, url)
+	if err = index.prepareShards(url, headers, timeout); err != nil {
+		return nil, err
+	}
+	return index, nil
 }
 
+// resolveTemplateURLs makes the relative template and sample URLs of an index relative to the index
+func resolveTemplateURLs(index *RepoIndex, indexURL string) {
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return
+	}
+	resolve := func(href string) string {
+		ref, err := url.Parse(href)
+		if err != nil || ref.IsAbs() || href == "" {
+			return href
+		}
+		return base.ResolveReference(ref).String()
+	}
+	for _, project := range index.Projects {
+		for _, version := range project {
+			for i := range version.URLs {
+				version.URLs[i] = resolve(version.URLs[i])
+			}
+			for i := range version.Templates {
+				version.Templates[i].URL = resolve(version.Templates[i].URL)
+			}
+			for i := range version.Samples {
+				version.Samples[i].URL = resolve(version.Samples[i].URL)
+			}
+		}
+	}
+}
+
+// indexWorkers is how many indexes of repositories are read at a time
+const indexWorkers = 8
+
+// indexResult is the index of a repository read by readIndexes, or the reason it could not be read
+type indexResult struct {
+	index *RepoIndex
+	err   error
+}
+
+// getIndex merges the indexes of the repositories. A repository whose index can not be downloaded is
+// skipped with a warning, unless its onFailure policy is fail. It fails when no repository can be read.
 func (index *RepoIndex) getIndex() error {
-	var repos RepositoryFile
-	repos.getRepos()
+	repos, err := stackRepos()
+	if err != nil {
+		return err
+	}
 
-	for _, value := range repos.Repositories {
-		repoIndex, err := downloadIndex(value.URL)
+	var failures []string
+	results := readIndexes(repos.Repositories)
+	for i, value := range repos.Repositories {
+		repoIndex, err := results[i].index, results[i].err
 		if err != nil {
-			Error.log(err)
-			os.Exit(1)
+			if value.OnFailure == repoOnFailureFail {
+				return errors.Errorf("Could not read the %s repository: %v", value.Name, err)
+			}
+			Warning.logf("Skipping the %s repository: %v", value.Name, err)
+			failures = append(failures, value.Name+": "+err.Error())
+			continue
+		}
+		if asOf, ok := offlineIndexAsOf(value.Name); ok {
+			if index.Offline == nil {
+				index.Offline = map[string]time.Time{}
+			}
+			index.Offline[value.Name] = asOf
 		}
-		if index.Projects == nil {
-			index.APIVersion = repoIndex.APIVersion
-			index.Generated = repoIndex.Generated
-			index.Projects = make(map[string]ProjectVersions)
+		index.addRepoIndex(value, repoIndex)
+	}
+	if len(failures) > 0 && len(failures) == len(repos.Repositories) {
+		return errors.Errorf("None of the repositories could be read:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// readIndexes reads the indexes of the repositories, indexWorkers at a time, with a progress line per
+// repository on a terminal. The results are in the order of the repositories, which is the order they are
+// merged in.
+func readIndexes(repos []*RepositoryEntry) []indexResult {
+	results := make([]indexResult, len(repos))
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = repo.Name
+	}
+	progress := startProgress(names, "waiting")
+	slots := make(chan struct{}, indexWorkers)
+	var wait sync.WaitGroup
+	for i, repo := range repos {
+		wait.Add(1)
+		go func(i int, repo *RepositoryEntry) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			progress.update(i, "reading the index", false)
+			started := time.Now()
+			index, err := repo.readIndex()
+			results[i] = indexResult{index: index, err: err}
+			if err != nil {
+				progress.update(i, "failed", true)
+				return
+			}
+			read := fmt.Sprintf("%d stacks", len(index.Projects))
+			if len(index.Shards) > 0 {
+				read = fmt.Sprintf("%d shards", len(index.Shards))
+			}
+			progress.update(i, fmt.Sprintf("%s, %s", read, time.Since(started).Round(10*time.Millisecond)), true)
+		}(i, repo)
+	}
+	wait.Wait()
+	progress.finish()
+	return results
+}
+
+// indexHeaders checks the URL of the repository, and returns the headers its index is downloaded with
+func (r *RepositoryEntry) indexHeaders() (map[string]string, error) {
+	if err := checkSecureURL(r.URL, insecureAllowed(r.URL)); err != nil {
+		return nil, err
+	}
+	headers, err := repoHeaders(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	// the credentials of the repository itself win over the ones of other repositories of the server
+	if r.Auth != nil {
+		if headers == nil {
+			headers = map[string]string{}
 		}
-		for name, project := range repoIndex.Projects {
-			index.Projects[name] = project
+		if headers["Authorization"], err = r.Auth.authorization(r.Name); err != nil {
+			return nil, err
 		}
 	}
+	return headers, nil
+}
+
+// downloadIndex downloads the index of the repository within its timeout
+func (r *RepositoryEntry) downloadIndex() (*RepoIndex, error) {
+	headers, err := r.indexHeaders()
+	if err != nil {
+		return nil, err
+	}
+	backend, err := r.backend()
+	if err != nil {
+		return nil, err
+	}
+	index, err := backend.fetchIndex(r, headers)
+	if err != nil {
+		return nil, err
+	}
+	r.ownShards(index)
+	for _, project := range index.Projects {
+		for _, version := range project {
+			version.repo = r.Name
+		}
+	}
+	return index, nil
+}
+
+// ownShards gives the shards of an index of the repository its repository, and the public key they are
+// verified with unless --insecure-skip-verify is set
+func (r *RepositoryEntry) ownShards(index *RepoIndex) {
+	for _, shard := range index.Shards {
+		shard.insecure = r.AllowInsecure
+		shard.repo = r.Name
+		if !skipIndexVerify {
+			shard.publicKey = r.PublicKey
+		}
+	}
+}
+
+// addRepoIndex merges the index of a repository in the index. The indexes of several repositories can be
+// merged at the same time.
+func (index *RepoIndex) addRepoIndex(repo *RepositoryEntry, repoIndex *RepoIndex) {
+	index.lock.Lock()
+	if index.Projects == nil {
+		index.APIVersion = repoIndex.APIVersion
+		index.Generated = repoIndex.Generated
+		index.Projects = make(map[string]ProjectVersions)
+	}
+	index.merged = true
+	if repo.Default {
+		index.defaultRepo = repo.Name
+	}
+	if repo.Merge != "" {
+		if index.strategies == nil {
+			index.strategies = map[string]string{}
+		}
+		index.strategies[repo.Name] = repo.Merge
+	}
+	index.Shards = append(index.Shards, repoIndex.Shards...)
+	index.lock.Unlock()
+	for name, project := range repoIndex.Projects {
+		index.addProject(repo.Name, name, project, repo.AllowInsecure)
+	}
+}
 
+// addProject adds the versions of a stack of a repository to the index, recording the repository they come
+// from. The plain http template URLs of insecure repositories are allowed.
+func (index *RepoIndex) addProject(repo string, id string, project ProjectVersions, insecure bool) {
+	publishDigests(project)
+	for _, version := range project {
+		version.repo = repo
+	}
+	if insecure {
+		allowInsecureTemplates(project)
+	}
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	if index.Projects == nil {
+		index.Projects = make(map[string]ProjectVersions)
+	}
+	if index.merged {
+		if !index.mergeStack(repo, id) {
+			return
+		}
+		id = stackKey(repo, id)
+	}
+	index.Projects[id] = project
+}
+
+// mergeStack applies the merge strategies of the repositories to a stack about to be added to a merged index,
+// whatever the order the repositories and their shards are added in. The stacks of the same id of the
+// repositories of a lower rank are removed, and it returns false to leave the stack out when a repository of
+// a higher rank has the id. The index is locked.
+func (index *RepoIndex) mergeStack(repo string, id string) bool {
+	rank, competes := mergeRank(index.strategies[repo])
+	if !competes {
+		return true
+	}
+	for key := range index.Projects {
+		otherRepo, otherID := splitStackKey(key)
+		if otherID != id || otherRepo == repo {
+			continue
+		}
+		otherRank, otherCompetes := mergeRank(index.strategies[otherRepo])
+		switch {
+		case !otherCompetes || otherRank == rank:
+		case otherRank > rank:
+			Debug.logw("Leaving out the stack, another repository has it", "stack", stackKey(repo, id), "by", key)
+			return false
+		default:
+			Debug.logw("Leaving out the stack, another repository has it", "stack", key, "by", stackKey(repo, id))
+			delete(index.Projects, key)
+		}
+	}
+	return true
+}
+
+// isolated tells whether the stacks of the repository are only found by <repository>/<id>
+func (index *RepoIndex) isolated(repo string) bool {
+	return index.strategies[repo] == repoMergeIsolated
+}
+
+// ByName returns the versions of a stack, latest first, by its id or <repository>/<id>, see resolveStack
+func (index *RepoIndex) ByName(id string) (ProjectVersions, error) {
+	key, err := index.resolveStack(id)
+	if err != nil {
+		return nil, err
+	}
+	return index.Projects[key], nil
+}
+
+// ByNameVersion returns a version of a stack, see ByName, or its latest version when version is empty.
+// The version can be partial: 0.2 is the latest 0.2.x version.
+func (index *RepoIndex) ByNameVersion(id string, version string) (*ProjectVersion, error) {
+	versions, err := index.ByName(id)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return versions[0], nil
+	}
+	var known []string
+	for _, candidate := range versions {
+		if candidate.Version == version || strings.HasPrefix(candidate.Version, version+".") {
+			return candidate, nil
+		}
+		known = append(known, candidate.Version)
+	}
+	return nil, errors.Errorf("The %s stack has no version %s, the versions are %s", id, version, strings.Join(known, ", "))
+}
+
+// ByRepo returns the stacks of a repository by their ids, with the stacks of its shards
+func (index *RepoIndex) ByRepo(repo string) (map[string]ProjectVersions, error) {
+	if err := index.loadShards(stackKey(repo, "")); err != nil {
+		return nil, err
+	}
+	stacks := map[string]ProjectVersions{}
+	for key, versions := range index.Projects {
+		if len(versions) > 0 && versions[0].repo == repo {
+			_, id := splitStackKey(key)
+			stacks[id] = versions
+		}
+	}
+	return stacks, nil
+}
+
+// stackKey is the key of a stack in a merged index
+func stackKey(repo string, id string) string {
+	return repo + "/" + id
+}
+
+// splitStackKey returns the repository and the id of the stack of a key of a merged index. Other
+// indexes have no repository in their keys.
+func splitStackKey(key string) (string, string) {
+	if slash := strings.Index(key, "/"); slash >= 0 {
+		return key[:slash], key[slash+1:]
+	}
+	return "", key
+}
+
+// resolveStack returns the key of a stack in the index. In a merged index, a stack id without repository
+// is the stack of the only repository with the id, or of the default repository when several have it. The
+// stacks of isolated repositories are left out.
+func (index *RepoIndex) resolveStack(id string) (string, error) {
+	if err := index.loadShards(id); err != nil {
+		return "", err
+	}
+	if len(index.Projects[id]) > 0 {
+		return id, nil
+	}
+	var matches, isolated []string
+	if index.merged && !strings.Contains(id, "/") {
+		for key := range index.Projects {
+			if repo, stackID := splitStackKey(key); stackID == id && index.isolated(repo) {
+				isolated = append(isolated, key)
+			} else if stackID == id {
+				matches = append(matches, key)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if len(isolated) > 0 {
+			sort.Strings(isolated)
+			return "", errors.Errorf("The %s stack is only found with the name of its repository, use %s.", id, strings.Join(isolated, " or "))
+		}
+		return "", errors.Errorf("Could not find a stack with the id \"%s\".%s Run `appsody list` to see the available stacks.", id, didYouMean(id, index.stackNames()))
+	case 1:
+		return matches[0], nil
+	}
+	if index.defaultRepo != "" && len(index.Projects[stackKey(index.defaultRepo, id)]) > 0 {
+		return stackKey(index.defaultRepo, id), nil
+	}
+	sort.Strings(matches)
+	return "", errors.Errorf("Several repositories have a %s stack: use one of %s, or make one of the repositories the default with appsody repo default <name>.", id, strings.Join(matches, ", "))
+}
+
+// displayID returns the shortest name of a stack that resolves to it: its id, unless another repository
+// has the id too
+func (index *RepoIndex) displayID(key string) string {
+	repo, id := splitStackKey(key)
+	if index.merged && index.isolated(repo) {
+		return key
+	}
+	if !index.merged || repo == index.defaultRepo {
+		return id
+	}
+	for other := range index.Projects {
+		if otherRepo, otherID := splitStackKey(other); otherID == id && other != key && !index.isolated(otherRepo) {
+			return key
+		}
+	}
+	return id
+}
+
+// defaultRepo returns the default repository, or nil when there is none
+func (r *RepositoryFile) defaultRepo() *RepositoryEntry {
+	for _, repo := range r.Repositories {
+		if repo.Default {
+			return repo
+		}
+	}
 	return nil
 }
 
+// timeout returns the timeout of the repository, 0 for none
+func (r *RepositoryEntry) timeout() time.Duration {
+	if r.Timeout == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(r.Timeout)
+	if err != nil || timeout < 0 {
+		Warning.logf("The timeout %q of the %s repository is not a duration such as 10s, it is ignored", r.Timeout, r.Name)
+		return 0
+	}
+	return timeout
+}
+
 func (index *RepoIndex) listProjects() string {
 	table := uitable.New()
 	table.MaxColWidth = 60
-	table.AddRow("ID", "VERSION", "DESCRIPTION")
-	for id, value := range index.Projects {
-		table.AddRow(id, value[0].Version, value[0].Description)
+	table.AddRow("REPO", "ID", "VERSION", "DESCRIPTION")
+	arch := localArch()
+	hidden := 0
+	if err := index.loadShards(""); err != nil {
+		Warning.log(err)
+	}
+	var keys []string
+	for key := range index.Projects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		versions := index.Projects[key]
+		if len(versions) == 0 {
+			continue
+		}
+		if !listAllVersions {
+			versions = versions[:1]
+		}
+		repo, id := splitStackKey(key)
+		for _, version := range versions {
+			if !version.supportsArch(arch) {
+				Debug.logw("Hiding the stack, it is not available for this architecture", "stack", key, "version", version.Version, "arch", arch, "architectures", version.Architectures)
+				hidden++
+				continue
+			}
+			description := version.Description
+			if version.Deprecated != "" {
+				description = "[deprecated] " + description
+			}
+			table.AddRow(repo, id, version.Version, description)
+		}
+	}
+	if hidden > 0 {
+		return fmt.Sprintf("%s\n\n%d stack(s) not available for the %s platform were hidden.", table.String(), hidden, arch)
 	}
-
 	return table.String()
 }
 
-func (r *RepositoryFile) getRepos() *RepositoryFile {
+// enginePlatform is the os/arch of the container engine, queried once
+var enginePlatform struct {
+	once     sync.Once
+	platform string
+}
+
+// localArch returns the os/arch platform stack images need to support to run on the container engine. It is
+// not the one of the CLI for a remote engine, such as a podman machine or a DOCKER_HOST of another machine.
+// The platform of the CLI is used when the engine can not be queried.
+func localArch() string {
+	enginePlatform.once.Do(func() {
+		args := []string{"version", "--format", "{{.Server.Os}}/{{.Server.Arch}}"}
+		if getContainerRuntime().Command == runtimePodman {
+			args = []string{"info", "--format", "{{.Host.OS}}/{{.Host.Arch}}"}
+		}
+		out, err := runtimeCommand(runtimeDocker, args...).Output()
+		platform := parsePlatform(string(out))
+		if err != nil || platform.OS == "" || platform.Arch == "" {
+			Debug.logf("Could not query the platform of the container engine, using %s/%s: %v", runtime.GOOS, runtime.GOARCH, err)
+			enginePlatform.platform = runtime.GOOS + "/" + runtime.GOARCH
+			return
+		}
+		enginePlatform.platform = platform.String()
+	})
+	return enginePlatform.platform
+}
+
+// platformSpec is an image platform: os/arch, with the variant of the architecture for arm
+type platformSpec struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// parsePlatform reads a bare architecture (amd64), an os/arch pair (linux/amd64) or an os/arch/variant
+// platform (linux/arm64/v8)
+func parsePlatform(value string) platformSpec {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(value)), "/")
+	switch len(parts) {
+	case 1:
+		return platformSpec{Arch: parts[0]}
+	case 2:
+		return platformSpec{OS: parts[0], Arch: parts[1]}
+	default:
+		return platformSpec{OS: parts[0], Arch: parts[1], Variant: parts[2]}
+	}
+}
+
+func (p platformSpec) String() string {
+	platform := p.Arch
+	if p.OS != "" {
+		platform = p.OS + "/" + platform
+	}
+	if p.Variant != "" {
+		platform += "/" + p.Variant
+	}
+	return platform
+}
+
+// matches compares the platforms, the os and the variant only when both of them name one
+func (p platformSpec) matches(other platformSpec) bool {
+	same := func(a string, b string) bool {
+		return a == "" || b == "" || a == b
+	}
+	return p.Arch == other.Arch && same(p.OS, other.OS) && same(p.Variant, other.Variant)
+}
+
+// supportsArch checks whether the stack version is published for the given platform, see parsePlatform.
+// Entries in the index may either be a bare architecture (amd64), an os/arch pair (linux/amd64) or a platform
+// with a variant (linux/arm64/v8).
+func (p *ProjectVersion) supportsArch(platform string) bool {
+	if len(p.Architectures) == 0 {
+		return true
+	}
+	wanted := parsePlatform(platform)
+	for _, supported := range p.Architectures {
+		if parsePlatform(supported).matches(wanted) {
+			return true
+		}
+	}
+	return false
+}
+
+// getRepos reads the repository file of the appsody home in r
+func (r *RepositoryFile) getRepos() (*RepositoryFile, error) {
 	var repoFileLocation = getRepoFileLocation()
 	repoReader, err := ioutil.ReadFile(repoFileLocation)
 	if err != nil {
 		if os.IsNotExist(err) {
-			Error.logf("Repository file does not exist %s. Check to make sure appsody init has been run. ", repoFileLocation)
-			os.Exit(1)
-		} else {
-			Error.log("Failed reading repository file ", repoFileLocation)
-			os.Exit(1)
+			return nil, errors.Errorf("Repository file does not exist %s. Check to make sure appsody init has been run. ", repoFileLocation)
+		}
+		return nil, errors.Errorf("Failed reading repository file %s", repoFileLocation)
+	}
+	err = parseRepoFile(repoFileLocation, repoReader, r)
+	if err != nil {
+		recovered, err := recoverRepoFile(repoFileLocation)
+		if err != nil {
+			return nil, errors.Errorf("Failed to parse repository file %v", err)
 		}
+		*r = *recovered
 	}
-	err = yaml.Unmarshal(repoReader, r)
+	return r, nil
+}
+
+// stackRepos returns the repositories the stacks are resolved from. In a project, .appsody-config.yaml can
+// replace the repository file with its own repositoryFile, and restrict the stacks to one repository:
+//
+//   repositoryFile: ./repository.yaml
+//   repository: team-stacks
+func stackRepos() (*RepositoryFile, error) {
+	var repos RepositoryFile
+	if _, err := getProjectDir(); err != nil {
+		return repos.getRepos()
+	}
+	config, err := readProjectConfig()
 	if err != nil {
-		Error.log("Failed to parse repository file ", err)
-		os.Exit(1)
+		return nil, err
+	}
+	source := getRepoFileLocation()
+	if config.RepositoryFile != "" {
+		projectDir, _ := getProjectDir()
+		source = config.RepositoryFile
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(projectDir, source)
+		}
+		data, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, errors.Errorf("Could not read the repository file of the project: %v", err)
+		}
+		if err = parseRepoFile(source, data, &repos); err != nil {
+			return nil, errors.Errorf("Could not parse the repository file of the project %s: %v", source, err)
+		}
+		Debug.logw("Using the repository file of the project", "path", source)
+	} else if _, err := repos.getRepos(); err != nil {
+		return nil, err
+	}
+	if config.Repository == "" {
+		return &repos, nil
 	}
-	return r
+	for _, repo := range repos.Repositories {
+		if repo.Name == config.Repository {
+			Debug.logw("Using the repository of the project", "repo", repo.Name)
+			return &RepositoryFile{APIVersion: repos.APIVersion, Generated: repos.Generated, Repositories: []*RepositoryEntry{repo}}, nil
+		}
+	}
+	return nil, errors.Errorf("The project uses the %s repository, which is not in %s.%s Add it with appsody repo add.", config.Repository, source, didYouMean(config.Repository, repos.repoNames()))
 }
 
 func (r *RepositoryFile) listRepos() string {
 	table := uitable.New()
 	table.MaxColWidth = 120
-	table.AddRow("NAME", "URL")
+	table.AddRow("", "NAME", "URL")
 	for _, value := range r.Repositories {
-		table.AddRow(value.Name, value.URL)
+		isDefault := ""
+		if value.Default {
+			isDefault = "*"
+		}
+		table.AddRow(isDefault, value.Name, value.URL)
 	}
 
 	return table.String()
@@ -319,6 +1030,16 @@ func (r *RepositoryFile) Has(name string) bool {
 	return false
 }
 
+// getRepo returns the repository with the name, or nil
+func (r *RepositoryFile) getRepo(name string) *RepositoryEntry {
+	for _, rf := range r.Repositories {
+		if rf.Name == name {
+			return rf
+		}
+	}
+	return nil
+}
+
 func (r *RepositoryFile) HasURL(url string) bool {
 	for _, rf := range r.Repositories {
 		if rf.URL == url {
@@ -343,5 +1064,5 @@ func (r *RepositoryFile) WriteFile(path string) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, data, 0644)
+	return writeFileAtomic(path, data, 0644)
 }
@@ -15,71 +15,267 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/spf13/cobra"
 )
 
+var repoHeaderFlags []string
+var repoIndexTimeout time.Duration
+var repoOnFailure string
+var repoMerge string
+var repoPublicKey string
+var repoAddDefault bool
+var repoType string
+var repoGit bool
+var repoBranch, repoTag string
+
 // initCmd represents the init command
 var addCmd = &cobra.Command{
 	Use:   "add <name> <url>",
 	Short: "Add an Appsody repository",
-	Long:  ``,
+	Long: `Add a repository of stacks once its index has been read. The URL is the one of an index.yaml, or an oci:// registry
+namespace, an s3://, gs:// or azblob:// bucket, or a directory written by appsody repo mirror. Use --git for a git
+repository of stacks.
+
+The values of --header, --password and --token are kept in the credential store of the OS, unless they are
+references such as env:NAME or file:PATH.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 2 {
 
 			return errors.New("Error, you must specify repository name and URL")
 		}
-		var repoName = args[0]
-		var repoURL = args[1]
-
-		if len(repoName) > 50 {
-			return errors.Errorf("Invalid repository name. The <name> must be less than 50 characters")
-
+		headers := map[string]string{}
+		for _, header := range repoHeaderFlags {
+			nameValue := strings.SplitN(header, "=", 2)
+			if len(nameValue) != 2 || nameValue[0] == "" {
+				return errors.Errorf("The header %q is not in the name=value format", header)
+			}
+			headers[nameValue[0]] = nameValue[1]
 		}
-		match, _ := regexp.MatchString("^[a-zA-Z0-9\\-_]{1,50}$", repoName)
-		if !match {
-			return errors.Errorf("Invalid repository name. The <name> may only contain digits, numbers, dashes '-', and underscores '_'.")
-
+		if repoGit {
+			if repoType != "" && repoType != repoTypeGit {
+				return errors.Errorf("--git adds a git repository, it can not be used with --type %s", repoType)
+			}
+			repoType = repoTypeGit
 		}
+		return addRepository(args[0], args[1], RepoAddOptions{
+			Type:          repoType,
+			Branch:        repoBranch,
+			Tag:           repoTag,
+			Headers:       headers,
+			Username:      repoUsername,
+			Password:      repoPassword,
+			Token:         repoToken,
+			PublicKeyFile: repoPublicKey,
+			Timeout:       repoIndexTimeout,
+			OnFailure:     repoOnFailure,
+			Merge:         repoMerge,
+			Default:       repoAddDefault,
+			AllowInsecure: allowInsecure,
+		})
+	},
+}
 
-		var repoFile RepositoryFile
-		repoFile.getRepos()
-		if repoFile.Has(repoName) {
-			return errors.Errorf("A repository with the name '%s' already exists.", repoName)
+// RepoAddOptions are the options of a repository added by appsody repo add. The zero value adds a repository of
+// the type of its URL, that is skipped when its index can not be downloaded.
+type RepoAddOptions struct {
+	// Type is http, oci or git, by default oci for oci:// URLs, otherwise http
+	Type string
+	// Branch or Tag of a git repository to read the stacks from
+	Branch, Tag string
+	// Headers are sent with the downloads from the repository server, their values can be secret references
+	Headers map[string]string
+	// Username and Password, or Token, authorize the downloads from the repository server
+	Username, Password, Token string
+	// PublicKeyFile is the PEM public key the index of the repository is signed with
+	PublicKeyFile string
+	// Timeout bounds each attempt to download the index, by default the download timeout of the CLI
+	Timeout time.Duration
+	// OnFailure is skip or fail, what the commands do when the index can not be downloaded
+	OnFailure string
+	// Merge is how the stacks are merged with the stacks of the same id of the other repositories
+	Merge string
+	// Default makes the repository the default one
+	Default bool
+	// AllowInsecure allows a plain http URL for the repository and its templates
+	AllowInsecure bool
+}
 
-		}
-		if repoFile.HasURL(repoURL) {
-			return errors.Errorf("A repository with the URL '%s' already exists.", repoURL)
+// addRepository adds a repository once its index has been read, for appsody repo add and the tools that embed
+// the CLI
+func addRepository(repoName string, repoURL string, options RepoAddOptions) error {
+	if err := checkRepoName(repoName); err != nil {
+		return err
+	}
 
-		}
-		_, err := downloadIndex(repoURL)
-		if err != nil {
+	var repoFile RepositoryFile
+	if _, err := repoFile.getRepos(); err != nil {
+		return err
+	}
+	if repoFile.Has(repoName) {
+		return errors.Errorf("A repository with the name '%s' already exists.", repoName)
 
+	}
+	if options.OnFailure != "" && options.OnFailure != repoOnFailureSkip && options.OnFailure != repoOnFailureFail {
+		return errors.Errorf("Unknown failure policy %q, use skip or fail", options.OnFailure)
+	}
+	if err := checkRepoMerge(options.Merge); err != nil {
+		return err
+	}
+	if options.Timeout < 0 {
+		return errors.New("The index timeout can not be negative")
+	}
+	addType := resolveRepoType(options.Type, repoURL)
+	if (options.Branch != "" || options.Tag != "") && addType != repoTypeGit {
+		return errors.New("--branch and --tag are only for git repositories, add them with --git")
+	}
+	if options.Branch != "" && options.Tag != "" {
+		return errors.New("Give either the --branch or the --tag of the git repository, not both")
+	}
+	if addType == repoTypeHTTP {
+		repoURL = mirrorIndexURL(repoURL)
+	}
+	// the branches and tags of a git repository can be added as several repositories
+	for _, repo := range repoFile.Repositories {
+		if repo.URL == repoURL && (repo.Type != repoTypeGit || (repo.Branch == options.Branch && repo.Tag == options.Tag)) {
+			return errors.Errorf("A repository with the URL '%s' already exists.", repoURL)
+		}
+	}
+	backend, err := lookupRepoBackend(options.Type, repoURL)
+	if err != nil {
+		return err
+	}
+	if err = backend.checkURL(repoURL); err != nil {
+		return err
+	}
+	if err := checkSecureURL(repoURL, options.AllowInsecure); err != nil {
+		return err
+	}
+	extraFileRoots = append(extraFileRoots, indexFileRoots(repoURL)...)
+	resolved, err := resolveHeaders(repoName, options.Headers)
+	if err != nil {
+		return err
+	}
+	auth, err := newRepoAuth(options.Username, options.Password, options.Token)
+	if err != nil {
+		return err
+	}
+	if auth != nil {
+		if resolved["Authorization"], err = auth.authorization(repoName); err != nil {
 			return err
 		}
+	}
+	var newEntry = RepositoryEntry{
+		Name:          repoName,
+		URL:           repoURL,
+		Branch:        options.Branch,
+		Tag:           options.Tag,
+		AllowInsecure: options.AllowInsecure,
+	}
+	if options.PublicKeyFile != "" {
+		publicKey, err := ioutil.ReadFile(options.PublicKeyFile)
+		if err != nil {
+			return errors.Errorf("Could not read the public key: %v", err)
+		}
+		if _, err = parsePublicKey(publicKey); err != nil {
+			return errors.Errorf("%s: %v", options.PublicKeyFile, err)
+		}
+		// the index is verified before it is added
+		newEntry.PublicKey = string(publicKey)
+	}
+	if addType != repoTypeHTTP {
+		newEntry.Type = addType
+	}
+	if options.Timeout > 0 {
+		newEntry.Timeout = options.Timeout.String()
+	}
+	_, err = backend.fetchIndex(&newEntry, resolved)
+	if err != nil {
 
-		if dryrun {
-			Info.logf("Dry Run - Skipping appsody repo add repository Name: %s, URL: %s", repoName, repoURL)
-		} else {
-			var newEntry = RepositoryEntry{
-				Name: repoName,
-				URL:  repoURL,
-			}
+		return err
+	}
 
-			repoFile.Add(&newEntry)
-			err = repoFile.WriteFile(getRepoFileLocation())
-			if err != nil {
-				return errors.Errorf("Failed to write file to repository location: %v", err)
+	if dryrun {
+		Info.logf("Dry Run - Skipping appsody repo add repository Name: %s, URL: %s", repoName, repoURL)
+		return nil
+	}
+	if options.OnFailure != "" && options.OnFailure != repoOnFailureSkip {
+		newEntry.OnFailure = options.OnFailure
+	}
+	if options.Merge != repoMergeMerge {
+		newEntry.Merge = options.Merge
+	}
+
+	// another command may have changed the repositories while the index was downloaded. The secrets are only
+	// stored once the name is known to be free, as their keys are named after the repository.
+	stored := false
+	err = updateRepoFile(func(repoFile *RepositoryFile) error {
+		if repoFile.Has(repoName) {
+			return errors.Errorf("A repository with the name '%s' already exists.", repoName)
+		}
+		stored = true
+		var err error
+		if len(options.Headers) > 0 {
+			if newEntry.Headers, err = storeRepoHeaders(repoName, options.Headers); err != nil {
+				return err
+			}
+		}
+		if auth != nil {
+			if newEntry.Auth, err = storeRepoAuth(repoName, auth); err != nil {
+				return err
+			}
+		}
+		if options.Default {
+			for _, repo := range repoFile.Repositories {
+				repo.Default = false
 			}
+			newEntry.Default = true
 		}
+		repoFile.Add(&newEntry)
 		return nil
-	},
+	})
+	if err != nil && stored {
+		// the repository was not added, its secrets would be left in the store with nothing to remove them
+		eraseRepoHeaders(&newEntry)
+		eraseRepoAuth(&newEntry)
+	}
+	return err
+}
+
+// checkRepoName checks the name of a new repository
+func checkRepoName(repoName string) error {
+	if len(repoName) > 50 {
+		return errors.Errorf("Invalid repository name. The <name> must be less than 50 characters")
+	}
+	match, _ := regexp.MatchString("^[a-zA-Z0-9\\-_]{1,50}$", repoName)
+	if !match {
+		return errors.Errorf("Invalid repository name. The <name> may only contain digits, numbers, dashes '-', and underscores '_'.")
+	}
+	return nil
 }
 
 func init() {
 	repoCmd.AddCommand(addCmd)
+	addCmd.PersistentFlags().StringArrayVar(&repoHeaderFlags, "header", nil, "Header sent with the downloads from the repository server, as name=value. Can be repeated.")
+	addCmd.PersistentFlags().BoolVar(&allowInsecure, "allow-insecure", false, "Allow a plain http URL for the repository and its templates.")
+	addCmd.PersistentFlags().DurationVar(&repoIndexTimeout, "index-timeout", 0, "Time each attempt to download the index may take, such as 10s. By default the download timeout of the CLI.")
+	addCmd.PersistentFlags().StringVar(&repoOnFailure, "on-failure", repoOnFailureSkip, "What the commands do when the index can not be downloaded: skip the repository, or fail.")
+	addCmd.PersistentFlags().StringVar(&repoMerge, "merge", repoMergeMerge, "How the stacks of the repository are merged with the stacks of the same id of the other repositories: merge keeps them all, supplement only adds the stacks the other repositories do not have, override replaces theirs, and isolated stacks are only found as <repository>/<id>.")
+	addCmd.PersistentFlags().StringVar(&repoPublicKey, "public-key", "", "PEM public key the index of the repository is signed with, such as the cosign.pub of cosign generate-key-pair. The index is then only read when its signature, the index URL with .sig appended, matches.")
+	addCmd.PersistentFlags().StringVar(&repoType, "type", "", "Type of the repository: http, for an index.yaml at an http, https or file URL, oci, for the artifacts of an OCI registry at oci://registry/namespace, or git, for the stacks of a git repository. By default oci for oci:// URLs, otherwise http.")
+	addCmd.PersistentFlags().BoolVar(&repoGit, "git", false, "Add a git repository of stacks, the same as --type git.")
+	addCmd.PersistentFlags().StringVar(&repoBranch, "branch", "", "Branch of the git repository to read the stacks from. By default the default branch of the repository.")
+	addCmd.PersistentFlags().StringVar(&repoTag, "tag", "", "Tag of the git repository to read the stacks from.")
+	addCmd.PersistentFlags().BoolVar(&repoAddDefault, "default", false, "Make the repository the default one, whose stacks win over the stacks of the other repositories with the same id.")
+	addCmd.PersistentFlags().StringVar(&repoUsername, "username", "", "User name for the basic authentication of the downloads from the repository server.")
+	addCmd.PersistentFlags().StringVar(&repoPassword, "password", "", "Password for the basic authentication, or a reference such as env:NAME.")
+	addCmd.PersistentFlags().StringVar(&repoToken, "token", "", "Bearer token of the downloads from the repository server, or a reference such as env:NAME.")
+	addCmd.PersistentFlags().BoolVar(&plaintextStore, "plaintext-store", false, "Write the header values and the credentials in the repository file instead of the credential store of the OS.")
 
 }
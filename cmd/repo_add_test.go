@@ -14,10 +14,19 @@
 package cmd_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/appsody/appsody/cmd"
 	"github.com/appsody/appsody/cmd/cmdtest"
+	"github.com/appsody/appsody/repomanager"
 )
 
 func TestRepoAdd(t *testing.T) {
@@ -86,3 +95,131 @@ func TestRepoAddErrors(t *testing.T) {
 
 	}
 }
+
+// TestRepoAddConcurrent adds repositories from several appsody processes at the same time, as parallel CI jobs
+// sharing a home do: none of them may be lost.
+func TestRepoAddConcurrent(t *testing.T) {
+	configFile, home, cleanup, err := cmdtest.TempHome()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	index, err := ioutil.ReadFile("testdata/index.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(home, "appsody")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	if output, err := exec.Command("go", "build", "-o", binary, "..").CombinedOutput(); err != nil {
+		t.Fatalf("Could not build appsody: %v\n%s", err, output)
+	}
+
+	const adds = 24
+	var wg sync.WaitGroup
+	errs := make([]error, adds)
+	for i := 0; i < adds; i++ {
+		indexFile := filepath.Join(home, fmt.Sprintf("index-%d.yaml", i))
+		if err = ioutil.WriteFile(indexFile, index, 0644); err != nil {
+			t.Fatal(err)
+		}
+		repoURL := "file://" + filepath.ToSlash(indexFile)
+		if runtime.GOOS == "windows" {
+			repoURL = "file:///" + filepath.ToSlash(indexFile)
+		}
+		wg.Add(1)
+		go func(i int, repoURL string) {
+			defer wg.Done()
+			addCmd := exec.Command(binary, "repo", "add", fmt.Sprintf("concurrent%d", i), repoURL, "--config", configFile)
+			if output, err := addCmd.CombinedOutput(); err != nil {
+				errs[i] = fmt.Errorf("%v: %s", err, output)
+			}
+		}(i, repoURL)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("repo add concurrent%d failed: %v", i, err)
+		}
+	}
+
+	manager, err := repomanager.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := manager.Repositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := map[string]bool{}
+	for _, repo := range repos {
+		added[repo.Name] = true
+	}
+	for i := 0; i < adds; i++ {
+		if name := fmt.Sprintf("concurrent%d", i); !added[name] {
+			t.Errorf("Expected the %s repository in the repository file, it was lost", name)
+		}
+	}
+}
+
+// TestRepoAddSecrets adds repositories whose secrets are kept by a credential helper: the secrets of a repository
+// that could not be added are removed from the store.
+func TestRepoAddSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake credential helper is a shell script")
+	}
+	configFile, home, cleanup := useTestHome(t, "credentialStore: fake\n", "")
+	defer cleanup()
+	// the helper logs what it is asked, and can not store the secret "fail"
+	helperLog := filepath.Join(home, "helper.log")
+	helper := "#!/bin/sh\ninput=$(cat)\necho \"$1 $input\" >> " + helperLog + "\ncase \"$input\" in *'\"Secret\":\"fail\"'*) exit 1;; esac\n"
+	if err := ioutil.WriteFile(filepath.Join(home, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", home+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+	manager, err := repomanager.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var secretTests = []struct {
+		testName string
+		options  cmd.RepoAddOptions
+		added    bool
+		erased   []string // the keys of the secrets erased from the store
+	}{
+		{"Stored", cmd.RepoAddOptions{Headers: map[string]string{"X-Api-Key": "key"}, Username: "user", Password: "password"}, true, nil},
+		{"Password fails", cmd.RepoAddOptions{Headers: map[string]string{"X-Api-Key": "key"}, Username: "user", Password: "fail"}, false, []string{"appsody://repo/failed/x-api-key"}},
+		{"Header fails", cmd.RepoAddOptions{Headers: map[string]string{"X-Api-Key": "fail"}}, false, nil},
+	}
+	for i, tt := range secretTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			os.Remove(helperLog)
+			name := "stored"
+			if !tt.added {
+				name = "failed"
+			}
+			indexFile := filepath.Join(home, fmt.Sprintf("index-%d.yaml", i))
+			if err := ioutil.WriteFile(indexFile, []byte("apiVersion: v2\nstacks: []\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := manager.Add(name, "file://"+filepath.ToSlash(indexFile), tt.options)
+			if tt.added != (err == nil) {
+				t.Fatalf("Expected the repository to be added: %v, got the error %v", tt.added, err)
+			}
+			log, _ := ioutil.ReadFile(helperLog)
+			var erased []string
+			for _, line := range strings.Split(string(log), "\n") {
+				if strings.HasPrefix(line, "erase ") {
+					erased = append(erased, strings.TrimPrefix(line, "erase "))
+				}
+			}
+			if strings.Join(erased, ",") != strings.Join(tt.erased, ",") {
+				t.Errorf("Expected the secrets %v to be erased, got %v", tt.erased, erased)
+			}
+		})
+	}
+}
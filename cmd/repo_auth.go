@@ -0,0 +1,97 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+var repoUsername, repoPassword, repoToken string
+
+// RepositoryAuth are the credentials the downloads from a repository server are authorized with: a user name
+// and password for basic authentication, or a bearer token. The values are secret references, see
+// resolveSecretRef, such as env:GHE_TOKEN or file:credentials/artifactory, a path relative to the appsody home.
+type RepositoryAuth struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+}
+
+// authorization returns the value of the Authorization header of the credentials
+func (a *RepositoryAuth) authorization(repoName string) (string, error) {
+	resolve := func(what string, ref string) (string, error) {
+		value, err := resolveSecretRef(ref)
+		if err != nil {
+			return "", errors.Errorf("Could not resolve the %s of the %s repository: %v", what, repoName, err)
+		}
+		return value, nil
+	}
+	if a.Token != "" {
+		token, err := resolve("token", a.Token)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	username, err := resolve("user name", a.Username)
+	if err != nil {
+		return "", err
+	}
+	password, err := resolve("password", a.Password)
+	if err != nil {
+		return "", err
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+}
+
+// newRepoAuth returns the credentials of the --username, --password and --token options of repo add, or nil
+func newRepoAuth(username string, password string, token string) (*RepositoryAuth, error) {
+	switch {
+	case token != "" && (username != "" || password != ""):
+		return nil, errors.New("Use either --token or --username and --password")
+	case password != "" && username == "":
+		return nil, errors.New("--password needs --username")
+	case token == "" && username == "":
+		return nil, nil
+	}
+	return &RepositoryAuth{Username: username, Password: password, Token: token}, nil
+}
+
+// storeRepoAuth moves the password and token that are not references yet into the secret store, and returns
+// the credentials to write in the repository file. The user name is not a secret.
+func storeRepoAuth(repoName string, auth *RepositoryAuth) (*RepositoryAuth, error) {
+	secrets := map[string]string{}
+	if auth.Password != "" {
+		secrets["password"] = auth.Password
+	}
+	if auth.Token != "" {
+		secrets["token"] = auth.Token
+	}
+	stored, err := storeRepoHeaders(repoName, secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &RepositoryAuth{Username: auth.Username, Password: stored["password"], Token: stored["token"]}, nil
+}
+
+// eraseRepoAuth removes the secrets the credentials of a repository keep in the store
+func eraseRepoAuth(repo *RepositoryEntry) {
+	if repo.Auth == nil {
+		return
+	}
+	eraseRepoHeaders(&RepositoryEntry{Name: repo.Name, Headers: map[string]string{"password": repo.Auth.Password, "token": repo.Auth.Token}})
+}
@@ -0,0 +1,93 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The types of repositories: an index.yaml at an http, https or file URL, OCI artifacts in a registry, or the
+// stacks of a git repository
+const (
+	repoTypeHTTP = "http"
+	repoTypeOCI  = "oci"
+	repoTypeGit  = "git"
+)
+
+// repoBackend downloads the index of a type of repository. The templates are then downloaded from the URLs of
+// the index, by the transports of downloadFileWithTimeout.
+type repoBackend interface {
+	// checkURL tells whether the URL can be the one of a repository of the type
+	checkURL(repoURL string) error
+	// fetchIndex downloads the index of the repository, with the headers of its server
+	fetchIndex(repo *RepositoryEntry, headers map[string]string) (*RepoIndex, error)
+}
+
+var repoBackends = map[string]repoBackend{
+	repoTypeHTTP: httpRepoBackend{},
+	repoTypeOCI:  ociRepoBackend{},
+	repoTypeGit:  gitRepoBackend{},
+}
+
+// resolveRepoType returns the type of a repository: without a type, oci:// URLs are OCI repositories and the
+// others are http ones
+func resolveRepoType(repoType string, repoURL string) string {
+	if repoType != "" {
+		return repoType
+	}
+	if strings.HasPrefix(strings.ToLower(repoURL), "oci://") {
+		return repoTypeOCI
+	}
+	return repoTypeHTTP
+}
+
+// lookupRepoBackend returns the backend of a type of repository
+func lookupRepoBackend(repoType string, repoURL string) (repoBackend, error) {
+	repoType = resolveRepoType(repoType, repoURL)
+	backend, ok := repoBackends[repoType]
+	if !ok {
+		return nil, errors.Errorf("Unknown repository type %q, use %s, %s or %s", repoType, repoTypeHTTP, repoTypeOCI, repoTypeGit)
+	}
+	return backend, nil
+}
+
+// backend returns the backend of the type of the repository
+func (r *RepositoryEntry) backend() (repoBackend, error) {
+	return lookupRepoBackend(r.Type, r.URL)
+}
+
+// httpRepoBackend reads the index.yaml at the URL of the repository, or the listing of its directory
+type httpRepoBackend struct{}
+
+func (httpRepoBackend) checkURL(repoURL string) error {
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return errors.Errorf("Invalid URL %s: %v", repoURL, err)
+	}
+	if parsed.Scheme == repoTypeOCI {
+		return errors.Errorf("%s is the URL of an OCI registry, add the repository with --type oci", repoURL)
+	}
+	return nil
+}
+
+func (httpRepoBackend) fetchIndex(repo *RepositoryEntry, headers map[string]string) (*RepoIndex, error) {
+	if repo.PublicKey != "" {
+		return repo.fetchSignedIndex(headers)
+	}
+	return downloadIndexWithTimeout(repo.URL, headers, repo.timeout())
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var unsetDefaultRepo bool
+
+var repoDefaultCmd = &cobra.Command{
+	Use:   "default [name]",
+	Short: "Set the default Appsody repository",
+	Long: `This makes a repository the default one: when several repositories have a stack with the same id, appsody init,
+list and the other commands use the stack of the default repository. Without a name, this shows the default
+repository. Use --unset to have no default repository again, the last repository with the stack then wins.
+
+appsody repo list marks the default repository with a *.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var repoFile RepositoryFile
+		if _, err := repoFile.getRepos(); err != nil {
+			return err
+		}
+		if len(args) == 0 && !unsetDefaultRepo {
+			if repo := repoFile.defaultRepo(); repo != nil {
+				Info.log(repo.Name)
+				return nil
+			}
+			Info.log("There is no default repository, set one with appsody repo default <name>")
+			return nil
+		}
+		if len(args) > 0 && unsetDefaultRepo {
+			return errors.New("Either give the name of the default repository, or --unset")
+		}
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+			if !repoFile.Has(name) {
+				return errors.Errorf("There is no repository %s.%s Run `appsody repo list` to see the repositories.", name, didYouMean(name, repoFile.repoNames()))
+			}
+		}
+		if dryrun {
+			planned(planWrite, getRepoFileLocation(), "default repository "+name)
+			return nil
+		}
+		if err := setDefaultRepo(name); err != nil {
+			return err
+		}
+		if name == "" {
+			Info.log("There is no default repository anymore")
+		} else {
+			Info.logf("%s is the default repository", name)
+		}
+		return nil
+	},
+}
+
+// setDefaultRepo makes the repository the default one, or leaves no default repository when name is empty
+func setDefaultRepo(name string) error {
+	return updateRepoFile(func(repoFile *RepositoryFile) error {
+		if name != "" && !repoFile.Has(name) {
+			return errors.Errorf("The %s repository was removed by another command", name)
+		}
+		for _, repo := range repoFile.Repositories {
+			repo.Default = repo.Name == name
+		}
+		return nil
+	})
+}
+
+func init() {
+	repoCmd.AddCommand(repoDefaultCmd)
+	repoDefaultCmd.PersistentFlags().BoolVar(&unsetDefaultRepo, "unset", false, "Have no default repository.")
+}
@@ -0,0 +1,226 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// The changes between two indexes of a repository
+const (
+	changeAdded          = "added"
+	changeRemoved        = "removed"
+	changeLatest         = "latest"
+	changeVersionAdded   = "version added"
+	changeVersionRemoved = "version removed"
+	changeRepublished    = "republished"
+)
+
+var repoDiffUpdate bool
+
+// indexChange is a change of a stack between the cached and the fetched index of a repository
+type indexChange struct {
+	Stack  string `json:"stack"`
+	Change string `json:"change"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+var repoDiffCmd = &cobra.Command{
+	Use:   "diff <repository>",
+	Short: "Show the changes of the index of a repository since it was last read",
+	Long: `This fetches the index of a repository and compares it with the one cached when the stacks were last read from
+it, such as by appsody list or init. It shows the stacks added and removed, the versions added and removed, the
+changes of the latest version of the stacks, and the versions published again with another digest.
+
+The cache is left as it is, so the changes can be reviewed before the users see them. Use --update to cache the
+fetched index once they are reviewed. The stacks of every shard of a sharded index are compared, and such an index
+is only cached by --update. Use -o json for a description tools can read.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Specify the repository, such as appsody repo diff incubator")
+		}
+		asJSON, err := jsonOutput()
+		if err != nil {
+			return err
+		}
+		var repos RepositoryFile
+		if _, err := repos.getRepos(); err != nil {
+			return err
+		}
+		var repo *RepositoryEntry
+		for _, entry := range repos.Repositories {
+			if entry.Name == args[0] {
+				repo = entry
+			}
+		}
+		if repo == nil {
+			return errors.Errorf("There is no %s repository.%s Run `appsody repo list` to see the repositories.", args[0], didYouMean(args[0], repos.repoNames()))
+		}
+		cached, err := readCachedIndex(repo.Name)
+		if err != nil {
+			return err
+		}
+		if cached == nil {
+			Warning.logf("The index of the %s repository was never cached, every stack is reported as added", repo.Name)
+			cached = &RepoIndex{}
+		}
+		fetched, err := repo.downloadIndex()
+		if err == nil {
+			err = fetched.loadShards("")
+		}
+		if err != nil {
+			return err
+		}
+		// the stacks of the shards are all in the fetched index now
+		fetched.Shards = nil
+		changes := diffIndexes(cached, fetched)
+		if asJSON {
+			if changes == nil {
+				changes = []indexChange{}
+			}
+			data, err := json.MarshalIndent(changes, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else if len(changes) == 0 {
+			Info.logf("The index of the %s repository has not changed", repo.Name)
+		} else {
+			table := uitable.New()
+			table.MaxColWidth = 60
+			table.AddRow("STACK", "CHANGE", "FROM", "TO")
+			for _, change := range changes {
+				table.AddRow(change.Stack, change.Change, change.From, change.To)
+			}
+			Info.log(table.String())
+		}
+		if repoDiffUpdate {
+			if dryrun {
+				planned(planWrite, cachedIndexFile(repo.Name), "the fetched index")
+				return nil
+			}
+			return cacheIndex(repo.Name, fetched)
+		}
+		return nil
+	},
+}
+
+// cachedIndexFile is where the last index read from a repository is kept
+func cachedIndexFile(repoName string) string {
+	return filepath.Join(repoStateDir(), "cache", repoName+".yaml")
+}
+
+// readCachedIndex returns the cached index of a repository, or nil when there is none
+func readCachedIndex(repoName string) (*RepoIndex, error) {
+	data, err := ioutil.ReadFile(cachedIndexFile(repoName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index, err := decodeRepoIndex(data)
+	if err != nil {
+		return nil, errors.Errorf("Could not parse the cached index of the %s repository: %v", repoName, err)
+	}
+	return index, nil
+}
+
+// cacheIndex keeps the index read from a repository, for appsody repo diff
+func cacheIndex(repoName string, index *RepoIndex) error {
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	file := cachedIndexFile(repoName)
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// diffIndexes returns the changes from one index of a repository to another, sorted by stack. The versions
+// of a stack are listed latest first in the indexes.
+func diffIndexes(from *RepoIndex, to *RepoIndex) []indexChange {
+	ids := map[string]bool{}
+	for id := range from.Projects {
+		ids[id] = true
+	}
+	for id := range to.Projects {
+		ids[id] = true
+	}
+	var sorted []string
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	var changes []indexChange
+	for _, id := range sorted {
+		before, after := from.Projects[id], to.Projects[id]
+		switch {
+		case len(before) == 0 && len(after) == 0:
+		case len(before) == 0:
+			changes = append(changes, indexChange{Stack: id, Change: changeAdded, To: after[0].Version})
+		case len(after) == 0:
+			changes = append(changes, indexChange{Stack: id, Change: changeRemoved, From: before[0].Version})
+		default:
+			changes = append(changes, diffStackVersions(id, before, after)...)
+		}
+	}
+	return changes
+}
+
+func diffStackVersions(id string, before ProjectVersions, after ProjectVersions) []indexChange {
+	var changes []indexChange
+	if before[0].Version != after[0].Version {
+		changes = append(changes, indexChange{Stack: id, Change: changeLatest, From: before[0].Version, To: after[0].Version})
+	}
+	previous := map[string]*ProjectVersion{}
+	for _, version := range before {
+		previous[version.Version] = version
+	}
+	current := map[string]bool{}
+	for _, version := range after {
+		current[version.Version] = true
+		old, ok := previous[version.Version]
+		switch {
+		case !ok:
+			changes = append(changes, indexChange{Stack: id, Change: changeVersionAdded, To: version.Version})
+		case old.Digest != version.Digest:
+			changes = append(changes, indexChange{Stack: id, Change: changeRepublished, From: version.Version + " " + old.Digest, To: version.Version + " " + version.Digest})
+		}
+	}
+	for _, version := range before {
+		if !current[version.Version] {
+			changes = append(changes, indexChange{Stack: id, Change: changeVersionRemoved, From: version.Version})
+		}
+	}
+	return changes
+}
+
+func init() {
+	repoCmd.AddCommand(repoDiffCmd)
+	repoDiffCmd.PersistentFlags().BoolVar(&repoDiffUpdate, "update", false, "Cache the fetched index once the changes are shown.")
+}
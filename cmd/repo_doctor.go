@@ -0,0 +1,295 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// repoDoctorParallel is how many template archives repo doctor downloads at the same time
+const repoDoctorParallel = 8
+
+var repoDoctorTemplates bool
+
+// repoCheck is the outcome of one check of the repositories, of a repository or of the configuration when
+// Repository is empty
+type repoCheck struct {
+	Repository string `yaml:"repository,omitempty"`
+	Check      string `yaml:"check"`
+	Status     string `yaml:"status"`
+	Details    string `yaml:"details,omitempty"`
+}
+
+var repoDoctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configured repositories",
+	Long: `This checks the configuration of the repositories: the directories of $APPSODY_HOME and the repository file, then the
+entries of each repository. The index of each repository is downloaded and parsed, and the template archives it
+lists are downloaded and verified against their digests, unless --templates=false. Stacks found in several
+repositories are reported, with the one appsody init uses.
+
+It fails when a check fails. Use -o json for the results of the checks in CI.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
+		checks := runRepoChecks()
+		failed := 0
+		for _, check := range checks {
+			if check.Status == checkFailed {
+				failed++
+			}
+		}
+		if structured {
+			if err = printStructured(checks); err != nil {
+				return err
+			}
+		} else {
+			table := uitable.New()
+			table.MaxColWidth = 100
+			table.Wrap = true
+			table.AddRow("REPOSITORY", "CHECK", "STATUS", "DETAILS")
+			for _, check := range checks {
+				table.AddRow(check.Repository, check.Check, check.Status, check.Details)
+			}
+			Info.log("\n", table)
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of the checks failed", failed)
+		}
+		return nil
+	},
+}
+
+func runRepoChecks() []repoCheck {
+	checks := []repoCheck{homeCheck()}
+	repoFile, check := repoFileCheck()
+	checks = append(checks, check)
+	if repoFile == nil {
+		return checks
+	}
+	// merging the indexes publishes the digests of their templates, and allows the plain http ones of the
+	// insecure repositories
+	merged := &RepoIndex{}
+	indexes := map[string]*RepoIndex{}
+	for _, repo := range repoFile.Repositories {
+		problems := repoConfigProblems(repo, repoFile)
+		if len(problems) > 0 {
+			checks = append(checks, repoCheck{repo.Name, "config", checkFailed, strings.Join(problems, "; ")})
+			continue
+		}
+		checks = append(checks, repoCheck{repo.Name, "config", checkOK, repo.URL})
+		index, err := repo.downloadIndex()
+		if err != nil {
+			checks = append(checks, repoCheck{repo.Name, "index", checkFailed, err.Error()})
+			continue
+		}
+		checks = append(checks, repoCheck{repo.Name, "index", checkOK, fmt.Sprintf("%d stack(s)", len(index.Projects))})
+		merged.addRepoIndex(repo, index)
+		indexes[repo.Name] = index
+		if repoDoctorTemplates {
+			checks = append(checks, templatesCheck(repo.Name, index))
+		}
+	}
+	return append(checks, duplicateStackChecks(repoFile, indexes)...)
+}
+
+// homeCheck checks the directories of $APPSODY_HOME
+func homeCheck() repoCheck {
+	for _, dir := range []string{getHome(), getRepoDir()} {
+		info, err := os.Stat(dir)
+		switch {
+		case err != nil:
+			return repoCheck{"", "home", checkFailed, err.Error()}
+		case !info.IsDir():
+			return repoCheck{"", "home", checkFailed, dir + " is not a directory"}
+		}
+	}
+	if homeReadOnly {
+		return repoCheck{"", "home", checkWarning, fmt.Sprintf("%s is read-only, the CLI writes in %s instead", getHome(), getStateDir())}
+	}
+	return repoCheck{"", "home", checkOK, getHome()}
+}
+
+// repoFileCheck reads the repository file strictly, so that misspelled fields are reported
+func repoFileCheck() (*RepositoryFile, repoCheck) {
+	file := getRepoFileLocation()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, repoCheck{"", "repository file", checkFailed, err.Error()}
+	}
+	var repoFile RepositoryFile
+	if err = yaml.UnmarshalStrict(data, &repoFile); err != nil {
+		return nil, repoCheck{"", "repository file", checkFailed, fmt.Sprintf("%s is not valid: %v", file, err)}
+	}
+	if len(repoFile.Repositories) == 0 {
+		return &repoFile, repoCheck{"", "repository file", checkWarning, file + " has no repositories, add one with appsody repo add"}
+	}
+	return &repoFile, repoCheck{"", "repository file", checkOK, fmt.Sprintf("%s has %d repositories", file, len(repoFile.Repositories))}
+}
+
+// repoConfigProblems checks the entry of a repository in the repository file
+func repoConfigProblems(repo *RepositoryEntry, repoFile *RepositoryFile) []string {
+	var problems []string
+	if err := checkRepoName(repo.Name); err != nil {
+		problems = append(problems, err.Error())
+	}
+	names, defaults := 0, 0
+	for _, other := range repoFile.Repositories {
+		if other.Name == repo.Name {
+			names++
+		}
+		if other.Default {
+			defaults++
+		}
+	}
+	if names > 1 {
+		problems = append(problems, fmt.Sprintf("%d repositories are named %s", names, repo.Name))
+	}
+	if repo.Default && defaults > 1 {
+		problems = append(problems, fmt.Sprintf("%d repositories are the default, set one with appsody repo default", defaults))
+	}
+	if repo.URL == "" {
+		problems = append(problems, "the repository has no URL")
+	} else if backend, err := repo.backend(); err != nil {
+		problems = append(problems, err.Error())
+	} else if err = backend.checkURL(repo.URL); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if repo.OnFailure != "" && repo.OnFailure != repoOnFailureSkip && repo.OnFailure != repoOnFailureFail {
+		problems = append(problems, fmt.Sprintf("unknown failure policy %q, use skip or fail", repo.OnFailure))
+	}
+	if err := checkRepoMerge(repo.Merge); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if repo.Timeout != "" {
+		if _, err := time.ParseDuration(repo.Timeout); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid timeout %q: %v", repo.Timeout, err))
+		}
+	}
+	if repo.Branch != "" && repo.Tag != "" {
+		problems = append(problems, "the repository has both a branch and a tag")
+	}
+	return problems
+}
+
+// templatesCheck downloads the template archives of the index of a repository, verifying their digests
+func templatesCheck(repo string, index *RepoIndex) repoCheck {
+	urls := map[string]bool{}
+	for _, project := range index.Projects {
+		for _, version := range project {
+			for _, templateURL := range version.URLs {
+				urls[templateURL] = true
+			}
+			for _, template := range version.Templates {
+				urls[template.URL] = true
+			}
+		}
+	}
+	work := make(chan string)
+	var lock sync.Mutex
+	var dead []string
+	var wg sync.WaitGroup
+	for w := 0; w < repoDoctorParallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for templateURL := range work {
+				if err := downloadFile(templateURL, ioutil.Discard); err != nil {
+					Debug.logf("Could not download the template %s: %v", templateURL, err)
+					lock.Lock()
+					dead = append(dead, templateURL)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for templateURL := range urls {
+		work <- templateURL
+	}
+	close(work)
+	wg.Wait()
+	if len(dead) > 0 {
+		sort.Strings(dead)
+		return repoCheck{repo, "templates", checkFailed, fmt.Sprintf("%d of the %d template archives can not be downloaded: %s", len(dead), len(urls), strings.Join(dead, ", "))}
+	}
+	return repoCheck{repo, "templates", checkOK, fmt.Sprintf("%d template archives downloaded", len(urls))}
+}
+
+// duplicateStackChecks reports the stacks of several repositories their merge strategies keep, with the one appsody
+// init uses
+func duplicateStackChecks(repoFile *RepositoryFile, indexes map[string]*RepoIndex) []repoCheck {
+	repos := map[string][]string{}
+	ranks := map[string]int{}
+	for _, repo := range repoFile.Repositories {
+		rank, competes := mergeRank(repo.Merge)
+		index, ok := indexes[repo.Name]
+		if !ok || !competes {
+			continue
+		}
+		for id := range index.Projects {
+			// the stacks of the repositories of a lower merge rank are left out
+			switch known, seen := ranks[id]; {
+			case !seen || rank > known:
+				ranks[id] = rank
+				repos[id] = []string{repo.Name}
+			case rank == known:
+				repos[id] = append(repos[id], repo.Name)
+			}
+		}
+	}
+	var ids []string
+	for id, names := range repos {
+		if len(names) > 1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	var checks []repoCheck
+	defaultRepo := repoFile.defaultRepo()
+	for _, id := range ids {
+		details := fmt.Sprintf("the %s stack is in the %s repositories", id, strings.Join(repos[id], ", "))
+		used := ""
+		for _, name := range repos[id] {
+			if defaultRepo != nil && name == defaultRepo.Name {
+				used = name
+			}
+		}
+		if used != "" {
+			details += fmt.Sprintf(", appsody init %s uses the one of the default repository %s", id, used)
+		} else {
+			details += fmt.Sprintf(", name it with its repository such as %s/%s, or make one of them the default with appsody repo default", repos[id][0], id)
+		}
+		checks = append(checks, repoCheck{"", "duplicate stack", checkWarning, details})
+	}
+	return checks
+}
+
+func init() {
+	repoCmd.AddCommand(repoDoctorCmd)
+	repoDoctorCmd.PersistentFlags().BoolVar(&repoDoctorTemplates, "templates", true, "Download the template archives of the indexes.")
+}
@@ -0,0 +1,315 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// fileLockWait is how long a command waits for another one to be done changing a configuration file
+const fileLockWait = 30 * time.Second
+
+// lockBreakTimeout is how old the lock of the removal of a lock, <lock>.break, is when the command that held it
+// ended in the few instructions it holds it
+const lockBreakTimeout = 10 * time.Second
+
+// lockOwner is the content of a lock file: the process, the machine, the operation and the time it started
+func lockOwner(operation string) string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%d\n%s\n%s\n%s\n", os.Getpid(), host, operation, time.Now().UTC().Format(time.RFC3339))
+}
+
+// createLockFile creates a lock file with its owner, and tells whether it did: false when the lock exists. The
+// owner is written to a temporary file that is then linked to the lock, so that the lock never exists without
+// its owner. On file systems without hard links, the lock is created then written.
+func createLockFile(file string, owner string) (bool, error) {
+	temp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.WriteString(owner)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	err = os.Link(temp.Name(), file)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsExist(err) {
+		return false, nil
+	}
+	Debug.log("Could not link the lock file, creating it instead: ", err)
+	created, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = created.WriteString(owner)
+	if closeErr := created.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file)
+		return false, err
+	}
+	return true, nil
+}
+
+// removeOwnLock removes a lock file, unless another command took it over
+func removeOwnLock(file string, owner string) {
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != owner {
+		Debug.log("The lock ", file, " is not held by this command anymore")
+		return
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		Debug.log("Could not remove the lock ", file, ": ", err)
+	}
+}
+
+// takeOverLock removes a lock file when the command holding it ended, or with force. It describes the holder,
+// tells whether it still runs and whether the lock is gone. The removal holds the lock <lock>.break: the
+// holder is checked again under it, so that two commands taking over the same ended lock can not remove the one
+// the first of them creates next.
+func takeOverLock(file string, force bool) (string, bool, bool, error) {
+	breakLock := file + ".break"
+	breakOwner := lockOwner("take over of " + filepath.Base(file))
+	for {
+		created, err := createLockFile(breakLock, breakOwner)
+		if err != nil {
+			return "", false, false, err
+		}
+		if created {
+			break
+		}
+		if info, err := os.Stat(breakLock); err == nil && time.Since(info.ModTime()) > lockBreakTimeout {
+			Debug.log("Removing the lock of the take over of an ended command: ", breakLock)
+			os.Remove(breakLock)
+			continue
+		}
+		if err = cliContext().Err(); err != nil {
+			return "", false, false, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer removeOwnLock(breakLock, breakOwner)
+	checked, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", false, true, nil
+	}
+	holder, alive := projectLockOwner(file)
+	if alive && !force {
+		return holder, true, false, nil
+	}
+	// the holder may have released the lock since it was read, and another command taken it: only the lock
+	// that was checked is removed
+	if current, err := ioutil.ReadFile(file); err != nil || !bytes.Equal(current, checked) {
+		return holder, false, true, nil
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return holder, alive, false, err
+	}
+	return holder, alive, true, nil
+}
+
+// lockFile takes the advisory lock of a configuration file, <file>.lock, around a read-modify-write of it, so
+// that two appsody commands running at the same time, as in CI, do not lose each other's changes. As for the
+// project locks, the lock of a command that ended without releasing it is taken over. It returns the function
+// that releases the lock.
+func lockFile(file string) (func(), error) {
+	lock := file + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0755); err != nil {
+		return nil, err
+	}
+	owner := lockOwner("change of " + filepath.Base(file))
+	deadline := time.Now().Add(fileLockWait)
+	for {
+		created, err := createLockFile(lock, owner)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			return func() { removeOwnLock(lock, owner) }, nil
+		}
+		holder, alive, removed, err := takeOverLock(lock, false)
+		if err != nil {
+			return nil, err
+		}
+		if removed {
+			if !alive && holder != "" {
+				Debug.log("Took over the lock of an ended command: ", holder)
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("%s is being changed by %s. Try again once it is done, or remove %s if it is not running anymore.", file, holder, lock)
+		}
+		if err = cliContext().Err(); err != nil {
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes a file through a temporary file renamed over it, so that a command that crashes or is
+// killed while writing leaves either the old or the new file, never a truncated one
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	temp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// updateRepoFile reads the repository file, changes it with update and writes it back, holding its lock
+func updateRepoFile(update func(repoFile *RepositoryFile) error) error {
+	file := getRepoFileLocation()
+	release, err := lockFile(file)
+	if err != nil {
+		return err
+	}
+	defer release()
+	repoFile, err := readRepoFile(file)
+	if err != nil {
+		return err
+	}
+	if err = update(repoFile); err != nil {
+		return err
+	}
+	return repoFile.WriteFile(file)
+}
+
+// readRepoFile reads the repository file. One that can not be parsed, such as one truncated by an older CLI
+// that crashed while writing it, is backed up and recreated with the default repository.
+func readRepoFile(file string) (*RepositoryFile, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var repoFile RepositoryFile
+	parseErr := parseRepoFile(file, data, &repoFile)
+	if parseErr == nil {
+		return &repoFile, nil
+	}
+	recreated := defaultRepoFile()
+	if dryrun {
+		Warning.logf("The repository file %s could not be parsed: %v", file, parseErr)
+		planned(planWrite, file, "recreated repository file, with a backup of the one that can not be parsed")
+		return recreated, nil
+	}
+	backup := file + ".corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+	if err = ioutil.WriteFile(backup, data, 0600); err != nil {
+		return nil, errors.Errorf("The repository file %s can not be parsed, and could not be backed up: %v", file, err)
+	}
+	if err = recreated.WriteFile(file); err != nil {
+		return nil, errors.Errorf("The repository file %s can not be parsed, and could not be recreated: %v", file, err)
+	}
+	Warning.logf("The repository file %s could not be parsed: %v", file, parseErr)
+	Warning.logf("It was backed up as %s and recreated with the appsodyhub repository. Add your repositories again from the backup.", backup)
+	return recreated, nil
+}
+
+// recoverRepoFile reads a repository file that could not be parsed again, holding its lock, and recreates it
+// when it still can not be parsed
+func recoverRepoFile(file string) (*RepositoryFile, error) {
+	release, err := lockFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return readRepoFile(file)
+}
+
+// defaultRepoFile is the repository file of a new appsody home, with the appsodyhub repository
+func defaultRepoFile() *RepositoryFile {
+	repoFile := NewRepoFile()
+	repoFile.Add(&RepositoryEntry{
+		Name: "appsodyhub",
+		URL:  appsodyHubURL,
+	})
+	return repoFile
+}
+
+// createRepoFile creates the repository file of a new appsody home, unless another command just did
+func createRepoFile(file string) error {
+	release, err := lockFile(file)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err = os.Stat(file); err == nil {
+		return nil
+	}
+	Debug.log("Creating ", file)
+	return defaultRepoFile().WriteFile(file)
+}
+
+// writeConfig writes the CLI configuration through a temporary file renamed over it, holding its lock
+func writeConfig() error {
+	file := cliConfig.ConfigFileUsed()
+	if file == "" {
+		file = getDefaultConfigFile()
+	}
+	return writeConfigFile(cliConfig, file)
+}
+
+// writeConfigFile writes a configuration to its file through a temporary file renamed over it, holding its lock
+func writeConfigFile(config *viper.Viper, file string) error {
+	release, err := lockFile(file)
+	if err != nil {
+		return err
+	}
+	defer release()
+	// the extension of the file tells its format
+	temp := filepath.Join(filepath.Dir(file), fmt.Sprintf(".%s.tmp%d%s", filepath.Base(file), os.Getpid(), filepath.Ext(file)))
+	if err = config.WriteConfigAs(temp); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err = os.Rename(temp, file); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
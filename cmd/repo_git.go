@@ -0,0 +1,175 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scpLikeGitURL matches the git URLs of ssh in the form of scp, such as git@github.com:myorg/stacks.git
+var scpLikeGitURL = regexp.MustCompile(`^[^/@:]+@[^/:]+:`)
+
+// gitRepoBackend reads the stacks of a git repository: it is cloned in the repository/git directory of the
+// state directory and fetched again whenever its index is downloaded. The index is the index.yaml at the root of
+// the repository, whose relative template URLs are relative to it, or else the index of its stacks, packaged
+// next to the clone as repo watch does.
+type gitRepoBackend struct{}
+
+func (gitRepoBackend) checkURL(repoURL string) error {
+	if strings.TrimSpace(repoURL) == "" || strings.HasPrefix(repoURL, "-") {
+		return errors.Errorf("%q is not the URL of a git repository", repoURL)
+	}
+	return nil
+}
+
+func (gitRepoBackend) fetchIndex(repo *RepositoryEntry, headers map[string]string) (*RepoIndex, error) {
+	if err := repo.checkIndexSignature(); err != nil {
+		return nil, err
+	}
+	dir, packages := gitRepoDir(repo.Name), gitPackagesDir(repo.Name)
+	if dryrun {
+		// the clone of a dry run is thrown away with the scratch directory
+		scratch, err := scratchDir()
+		if err != nil {
+			return nil, err
+		}
+		dir, packages = filepath.Join(scratch, "git", repo.Name), filepath.Join(scratch, "git-packages", repo.Name)
+	}
+	if err := syncGitRepo(repo, dir); err != nil {
+		return nil, errors.Wrapf(transferError{err}, "Could not fetch the git repository %s", repo.URL)
+	}
+	indexFile := filepath.Join(dir, "index.yaml")
+	if _, err := os.Stat(indexFile); err != nil {
+		// the packages of the stacks that were removed or renamed go too
+		if err = os.RemoveAll(packages); err != nil {
+			return nil, err
+		}
+		indexFile = filepath.Join(packages, "index.yaml")
+		indexed, found, err := packageStackSources(dir, packages, indexFile, stackPackaging{"appsody", fileURL})
+		if err != nil {
+			return nil, err
+		}
+		if found == 0 {
+			return nil, errors.Errorf("The git repository %s has no index.yaml at its root and no stacks", repo.URL)
+		}
+		Debug.logf("No index.yaml in the git repository %s, indexed %d of its %d stack(s)", repo.URL, indexed, found)
+	}
+	return downloadIndexWithTimeout(fileURL(indexFile), nil, repo.timeout())
+}
+
+// gitRepoDir is the clone of a git repository
+func gitRepoDir(name string) string {
+	return filepath.Join(repoStateDir(), "git", name)
+}
+
+// gitPackagesDir holds the packages and the index of the stacks of a git repository without an index.yaml.
+// Repository names do not start with a dot.
+func gitPackagesDir(name string) string {
+	return filepath.Join(repoStateDir(), "git", ".packages", name)
+}
+
+// gitCloneURL returns the URL git clones: a URL without scheme, such as github.com/myorg/stacks, is an https one
+func gitCloneURL(repoURL string) string {
+	if strings.Contains(repoURL, "://") || scpLikeGitURL.MatchString(repoURL) || filepath.IsAbs(repoURL) || strings.HasPrefix(repoURL, ".") {
+		return repoURL
+	}
+	return "https://" + repoURL
+}
+
+// gitRef returns the ref of the repository to read: its branch, its tag, or the default branch
+func (r *RepositoryEntry) gitRef() string {
+	switch {
+	case r.Branch != "":
+		return "refs/heads/" + r.Branch
+	case r.Tag != "":
+		return "refs/tags/" + r.Tag
+	}
+	return "HEAD"
+}
+
+// syncGitRepo clones the repository in dir, or fetches it again, and checks out the latest commit of its ref.
+// Only that commit is fetched. A clone that fails is removed.
+func syncGitRepo(repo *RepositoryEntry, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err = cloneGitRepo(repo, dir); err != nil {
+			os.RemoveAll(dir)
+		}
+		return err
+	}
+	return fetchGitRepo(repo, dir)
+}
+
+func cloneGitRepo(repo *RepositoryEntry, dir string) error {
+	if err := runGit(dir, "init", "-q"); err != nil {
+		return err
+	}
+	return fetchGitRepo(repo, dir)
+}
+
+func fetchGitRepo(repo *RepositoryEntry, dir string) error {
+	// the URL of the repository may have been changed by repo set-url
+	if err := runGit(dir, "config", "remote.origin.url", gitCloneURL(repo.URL)); err != nil {
+		return err
+	}
+	Debug.logf("Fetching %s of the git repository %s", repo.gitRef(), repo.URL)
+	if err := runGit(dir, "fetch", "-q", "--depth", "1", "--force", "origin", repo.gitRef()); err != nil {
+		return err
+	}
+	if err := runGit(dir, "reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return runGit(dir, "clean", "-q", "-fdx")
+}
+
+// runGit runs git in dir, stopped with the command, and returns its output as the error when it fails
+func runGit(dir string, args ...string) error {
+	gitCmd := exec.CommandContext(cliContext(), "git", args...)
+	gitCmd.Dir = dir
+	out, err := gitCmd.CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(out)); message != "" {
+			return errors.Errorf("git %s: %s", args[0], message)
+		}
+		return errors.Errorf("git %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// moveGitClone moves the clone and packages of a renamed git repository
+func moveGitClone(oldName string, newName string) {
+	for _, dir := range [][2]string{{gitRepoDir(oldName), gitRepoDir(newName)}, {gitPackagesDir(oldName), gitPackagesDir(newName)}} {
+		if err := os.Rename(dir[0], dir[1]); err != nil && !os.IsNotExist(err) {
+			Debug.logf("Could not move %s to %s: %v", dir[0], dir[1], err)
+		}
+	}
+}
+
+// removeGitClone removes the clone and packages of a removed git repository
+func removeGitClone(name string) {
+	for _, dir := range []string{gitRepoDir(name), gitPackagesDir(name)} {
+		if err := os.RemoveAll(dir); err != nil {
+			Debug.logf("Could not remove %s: %v", dir, err)
+		}
+	}
+}
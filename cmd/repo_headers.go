@@ -0,0 +1,112 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resolveSecretRef returns the value of a header. Secrets are better kept out of the repository file:
+//
+//   env:NAME                the NAME environment variable
+//   file:PATH               the content of a file, relative to the appsody home unless absolute
+//   helper:HELPER:SERVER    the secret docker-credential-HELPER stores for SERVER
+//   keychain:KEY            the secret the OS credential store keeps for KEY
+//
+// ${secret:<provider>:<ref>} references are expanded, any other value is used as it is.
+func resolveSecretRef(value string) (string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if provider, ok := secretProviders[parts[0]]; ok && len(parts) == 2 {
+		return provider.resolve(parts[1])
+	}
+	return expandSecretRefs(value)
+}
+
+// resolveHeaders resolves the secrets the header values refer to
+func resolveHeaders(repoName string, headers map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(headers))
+	for name, value := range headers {
+		secret, err := resolveSecretRef(value)
+		if err != nil {
+			return nil, errors.Errorf("Could not resolve the %s header of the %s repository: %v", name, repoName, err)
+		}
+		resolved[name] = secret
+	}
+	return resolved, nil
+}
+
+// redactSecrets hides the header values and credentials kept as they are in the repository file, the
+// references to secrets are kept
+func (r *RepositoryFile) redactSecrets() {
+	redact := func(value string) string {
+		if value == "" || isSecretRef(value) {
+			return value
+		}
+		return redacted
+	}
+	for _, repo := range r.Repositories {
+		for name, value := range repo.Headers {
+			repo.Headers[name] = redact(value)
+		}
+		if repo.Auth != nil {
+			repo.Auth.Password = redact(repo.Auth.Password)
+			repo.Auth.Token = redact(repo.Auth.Token)
+		}
+	}
+}
+
+// sameServer tells whether both URLs are on the same scheme, host and port
+func sameServer(a *url.URL, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Host, b.Host)
+}
+
+// repoHeaders returns the headers of the repositories served from the server of href. They are not sent to
+// other servers, such as the one hosting the templates of a stack, which do not need the secrets.
+func repoHeaders(href string) (map[string]string, error) {
+	target, err := url.Parse(href)
+	if err != nil || target.Host == "" {
+		return nil, nil
+	}
+	repos, err := stackRepos()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	for _, repo := range repos.Repositories {
+		if len(repo.Headers) == 0 && repo.Auth == nil {
+			continue
+		}
+		repoURL, err := url.Parse(repo.URL)
+		if err != nil || !sameServer(repoURL, target) {
+			continue
+		}
+		resolved, err := resolveHeaders(repo.Name, repo.Headers)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range resolved {
+			headers[name] = value
+		}
+		if repo.Auth != nil {
+			if headers["Authorization"], err = repo.Auth.authorization(repo.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return headers, nil
+}
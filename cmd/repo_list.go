@@ -23,11 +23,21 @@ var repoListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List configured Appsody repositories",
 	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		var repos RepositoryFile
-		repos.getRepos()
+		if _, err := repos.getRepos(); err != nil {
+			return err
+		}
+		if structured, err := structuredOutput(); structured || err != nil {
+			if err != nil {
+				return err
+			}
+			repos.redactSecrets()
+			return printStructured(&repos)
+		}
 		var repoList = repos.listRepos()
 		Info.log("\n", repoList)
+		return nil
 	},
 }
 
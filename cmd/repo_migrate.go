@@ -0,0 +1,251 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// repoFileMigration upgrades a legacy layout of the raw repository file. It returns the file unchanged, and
+// false, when the file does not have the layout.
+type repoFileMigration struct {
+	description string
+	migrate     func(repoFile yaml.MapSlice) (yaml.MapSlice, bool)
+}
+
+// repoFileMigrations are the layouts of the repository files of older CLIs, in the order they are upgraded
+var repoFileMigrations = []repoFileMigration{
+	{"list the repositories, instead of mapping their names to their URLs", migrateRepoMap},
+	{"rename the uri, insecure and isDefault fields of the repositories to url, allowInsecure and default", migrateRepoFieldNames},
+	{"mark the defaultRepository as the default repository", migrateDefaultRepository},
+	{"add the apiVersion", migrateRepoAPIVersion},
+}
+
+// legacyRepoFields are the fields of the repositories of older CLIs, by their current name
+var legacyRepoFields = map[string]string{"uri": "url", "insecure": "allowInsecure", "isDefault": "default"}
+
+// legacyRepoFileWarned are the legacy repository files a command already warned about
+var legacyRepoFileWarned = map[string]bool{}
+
+var repoMigrateCmd = &cobra.Command{
+	Use:   "migrate [repository file]",
+	Short: "Upgrade a repository file of an older Appsody CLI to the current layout",
+	Long: `This rewrites the repository file of the appsody home, or the given one, such as the repositoryFile of a project, in
+the layout of this CLI, listing each change. The original file is kept next to it as <file>.legacy-<time>.
+
+Older CLIs wrote repository files without apiVersion, with the repositories mapped from their names to their URLs,
+and with the uri, insecure and isDefault fields now named url, allowInsecure and default. The commands read such files
+as they are, upgrading them in memory, and tell you to run this to save the upgrade.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := getRepoFileLocation()
+		if len(args) > 0 {
+			file = args[0]
+		}
+		return migrateRepoFile(file)
+	},
+}
+
+// upgradeRepoFile applies the migrations of the legacy layouts to the data of a repository file. It returns the
+// data unchanged, with no changes, when it has the current layout, and an error when it is not YAML at all.
+func upgradeRepoFile(data []byte) ([]byte, []string, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	if len(raw) == 0 {
+		return data, nil, nil
+	}
+	var changes []string
+	for _, migration := range repoFileMigrations {
+		var changed bool
+		if raw, changed = migration.migrate(raw); changed {
+			changes = append(changes, migration.description)
+		}
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+	upgraded, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return upgraded, changes, nil
+}
+
+// parseRepoFile decodes the data of a repository file into repoFile, upgrading a legacy layout in memory first.
+// The commands warn once about each legacy file, appsody repo migrate saves the upgrade.
+func parseRepoFile(file string, data []byte, repoFile *RepositoryFile) error {
+	upgraded, changes, err := upgradeRepoFile(data)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 && !legacyRepoFileWarned[file] {
+		legacyRepoFileWarned[file] = true
+		Warning.logf("The repository file %s has the layout of an older Appsody CLI, it was upgraded in memory. Run appsody repo migrate to save the upgrade.", file)
+		for _, change := range changes {
+			Debug.logw("Legacy repository file", "path", file, "change", change)
+		}
+	}
+	return yaml.Unmarshal(upgraded, repoFile)
+}
+
+// migrateRepoFile saves the upgrade of a legacy repository file, keeping the original next to it
+func migrateRepoFile(file string) error {
+	release, err := lockFile(file)
+	if err != nil {
+		return err
+	}
+	defer release()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.Errorf("Could not read the repository file %s: %v", file, err)
+	}
+	upgraded, changes, err := upgradeRepoFile(data)
+	if err != nil {
+		return errors.Errorf("The repository file %s can not be parsed: %v", file, err)
+	}
+	var repoFile RepositoryFile
+	if err = yaml.Unmarshal(upgraded, &repoFile); err != nil {
+		return errors.Errorf("The repository file %s has a layout this CLI does not know: %v", file, err)
+	}
+	if len(changes) == 0 {
+		Info.logf("The repository file %s already has the current layout", file)
+		return nil
+	}
+	for _, change := range changes {
+		Info.log("Upgrading the repository file: ", change)
+	}
+	backup := file + ".legacy-" + time.Now().UTC().Format("20060102T150405Z")
+	if dryrun {
+		planned(planWrite, backup, "copy of the original repository file")
+		planned(planWrite, file, fmt.Sprintf("upgraded repository file with %d repositories", len(repoFile.Repositories)))
+		return nil
+	}
+	if err = ioutil.WriteFile(backup, data, 0600); err != nil {
+		return errors.Errorf("Could not back up %s: %v", file, err)
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(file); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err = writeFileAtomic(file, upgraded, perm); err != nil {
+		return errors.Errorf("Could not write %s, the original is kept in %s: %v", file, backup, err)
+	}
+	Info.logf("Upgraded the repository file %s, the original is kept in %s", filepath.Base(file), backup)
+	return nil
+}
+
+// migrateRepoMap turns repositories: {name: url} into a list of repositories, sorted by name
+func migrateRepoMap(repoFile yaml.MapSlice) (yaml.MapSlice, bool) {
+	value, _ := configValue(repoFile, "repositories")
+	repos, ok := value.(yaml.MapSlice)
+	if !ok {
+		return repoFile, false
+	}
+	var list []interface{}
+	for _, item := range repos {
+		repo := yaml.MapSlice{{Key: "name", Value: fmt.Sprint(item.Key)}}
+		switch settings := item.Value.(type) {
+		case string:
+			repo = append(repo, yaml.MapItem{Key: "url", Value: settings})
+		case yaml.MapSlice:
+			repo = append(repo, settings...)
+		}
+		list = append(list, repo)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return fmt.Sprint(list[i].(yaml.MapSlice)[0].Value) < fmt.Sprint(list[j].(yaml.MapSlice)[0].Value)
+	})
+	return setConfigValue(repoFile, "repositories", list), true
+}
+
+// migrateRepoFieldNames renames the legacy fields of the repositories, keeping the current field when a
+// repository has both
+func migrateRepoFieldNames(repoFile yaml.MapSlice) (yaml.MapSlice, bool) {
+	value, _ := configValue(repoFile, "repositories")
+	repos, _ := value.([]interface{})
+	changed := false
+	for i, item := range repos {
+		repo, ok := item.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		var renamed yaml.MapSlice
+		for _, field := range repo {
+			current, legacy := legacyRepoFields[fmt.Sprint(field.Key)]
+			if !legacy {
+				renamed = append(renamed, field)
+				continue
+			}
+			changed = true
+			if _, found := configValue(repo, current); !found {
+				renamed = append(renamed, yaml.MapItem{Key: current, Value: field.Value})
+			}
+		}
+		repos[i] = renamed
+	}
+	return repoFile, changed
+}
+
+// migrateDefaultRepository moves the top level defaultRepository: <name> to default: true on the repository
+func migrateDefaultRepository(repoFile yaml.MapSlice) (yaml.MapSlice, bool) {
+	value, found := configValue(repoFile, "defaultRepository")
+	if !found {
+		return repoFile, false
+	}
+	kept := withoutKey(repoFile, "defaultRepository")
+	reposValue, _ := configValue(kept, "repositories")
+	repos, _ := reposValue.([]interface{})
+	for i, item := range repos {
+		if repo, ok := item.(yaml.MapSlice); ok {
+			if name, _ := configValue(repo, "name"); name == value {
+				repos[i] = setConfigValue(repo, "default", true)
+			}
+		}
+	}
+	return kept, true
+}
+
+// migrateRepoAPIVersion adds the apiVersion the repository files of the first CLIs did not have
+func migrateRepoAPIVersion(repoFile yaml.MapSlice) (yaml.MapSlice, bool) {
+	if version, found := configValue(repoFile, "apiVersion"); found && version != "" && version != nil {
+		return repoFile, false
+	}
+	return append(yaml.MapSlice{{Key: "apiVersion", Value: APIVersionV1}}, withoutKey(repoFile, "apiVersion")...), true
+}
+
+// withoutKey returns the raw config without the top level key
+func withoutKey(config yaml.MapSlice, key string) yaml.MapSlice {
+	var kept yaml.MapSlice
+	for _, item := range config {
+		if item.Key != key {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func init() {
+	repoCmd.AddCommand(repoMigrateCmd)
+}
@@ -0,0 +1,188 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const mirrorIndexFile = "index.yaml"
+
+var repoMirrorCmd = &cobra.Command{
+	Use:   "mirror <name> <dir>",
+	Short: "Copy a repository with its templates into a directory, for machines without network access",
+	Long: `This downloads the index of a repository, with the stacks of all its shards, and every template and sample
+archive of every version of its stacks into the directory. The index is written as index.yaml in the directory, its
+URLs rewritten to the archives next to it, so that the directory can be copied to a disconnected network and added
+there with appsody repo add <name> <dir>, which then works without network access.
+
+Running it again on the same directory only downloads the archives that changed. Use --max-concurrent and
+--limit-rate to go easy on the repository server. The stack images are not copied, use appsody bundle export for
+them.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Specify the repository and the directory, such as appsody repo mirror incubator ./incubator-mirror")
+		}
+		var repos RepositoryFile
+		if _, err := repos.getRepos(); err != nil {
+			return err
+		}
+		var repo *RepositoryEntry
+		for _, entry := range repos.Repositories {
+			if entry.Name == args[0] {
+				repo = entry
+			}
+		}
+		if repo == nil {
+			return errors.Errorf("There is no %s repository.%s Run `appsody repo list` to see the repositories.", args[0], didYouMean(args[0], repos.repoNames()))
+		}
+		if err := applyTransferLimits(); err != nil {
+			return err
+		}
+		return mirrorRepo(repo, args[1])
+	},
+}
+
+// mirroredArchive is an archive of the index downloaded by repo mirror
+type mirroredArchive struct {
+	url    string
+	digest string
+	// relPath is where it is written, relative to the directory of the mirror
+	relPath string
+}
+
+// mirrorRepo downloads the index of the repository and its archives into dir, and writes the index with the
+// URLs of the archives relative to it
+func mirrorRepo(repo *RepositoryEntry, dir string) error {
+	fetched, err := repo.downloadIndex()
+	if err != nil {
+		return err
+	}
+	index := &RepoIndex{APIVersion: fetched.APIVersion, Generated: fetched.Generated, Shards: fetched.Shards}
+	for id, project := range fetched.Projects {
+		index.addProject(repo.Name, id, project, repo.AllowInsecure)
+	}
+	if err = index.loadShards(""); err != nil {
+		return err
+	}
+	// the stacks of the shards are all in the index now
+	index.Shards = nil
+
+	var archives []*mirroredArchive
+	byURL := map[string]*mirroredArchive{}
+	mirror := func(kind string, id string, version string, href string, digest string) string {
+		archive, ok := byURL[href]
+		if !ok {
+			relPath := path.Join(kind, nonFileNameChars.ReplaceAllString(id, "_"), nonFileNameChars.ReplaceAllString(version, "_"), archiveName(href))
+			archive = &mirroredArchive{url: href, relPath: relPath}
+			byURL[href] = archive
+			archives = append(archives, archive)
+		}
+		if archive.digest == "" {
+			archive.digest = digest
+		}
+		return archive.relPath
+	}
+	for id, project := range index.Projects {
+		for _, version := range project {
+			for i, href := range version.URLs {
+				digest := ""
+				if i == 0 {
+					digest = version.Digest
+				}
+				version.URLs[i] = mirror("templates", id, version.Version, href, digest)
+			}
+			for i, template := range version.Templates {
+				version.Templates[i].URL = mirror("templates", id, version.Version, template.URL, template.Digest)
+			}
+			for i, sample := range version.Samples {
+				version.Samples[i].URL = mirror("samples", id, version.Version, sample.URL, sample.Digest)
+			}
+		}
+	}
+
+	indexFile := filepath.Join(dir, mirrorIndexFile)
+	if dryrun {
+		for _, archive := range archives {
+			planned(planDownload, archive.url, "to "+filepath.Join(dir, filepath.FromSlash(archive.relPath)))
+		}
+		planned(planWrite, indexFile, "the index of the "+repo.Name+" repository")
+		return nil
+	}
+	var downloaded int32
+	err = forEachConcurrently(len(archives), func(i int) error {
+		archive := archives[i]
+		dest := filepath.Join(dir, filepath.FromSlash(archive.relPath))
+		if archive.digest != "" {
+			if actual, err := fileSha256(dest); err == nil && strings.EqualFold(strings.TrimPrefix(archive.digest, "sha256:"), actual) {
+				Debug.log("Already mirrored ", archive.url)
+				return nil
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		Info.log("Downloading ", archive.url)
+		// downloaded next to the archive, so that an interrupted mirror does not leave a partial archive
+		partial := dest + ".partial"
+		if err := downloadFileToDisk(archive.url, partial); err != nil {
+			os.Remove(partial)
+			return errors.Errorf("Could not download %s: %v", archive.url, err)
+		}
+		atomic.AddInt32(&downloaded, 1)
+		return os.Rename(partial, dest)
+	})
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(indexFile, data, 0644); err != nil {
+		return err
+	}
+	Info.logf("Mirrored %d stacks of the %s repository to %s, %d of the %d archives downloaded. Add it with appsody repo add %s %s", len(index.Projects), repo.Name, dir, downloaded, len(archives), repo.Name, dir)
+	return nil
+}
+
+// mirrorIndexURL returns the file:// URL of the index of a directory written by repo mirror, so that repo add can
+// be given the directory. Other URLs are returned as they are.
+func mirrorIndexURL(repoURL string) string {
+	if strings.Contains(repoURL, "://") {
+		return repoURL
+	}
+	if info, err := os.Stat(repoURL); err != nil || !info.IsDir() {
+		return repoURL
+	}
+	dir, err := filepath.Abs(repoURL)
+	if err != nil {
+		return repoURL
+	}
+	return fileURL(filepath.Join(dir, mirrorIndexFile))
+}
+
+func init() {
+	repoCmd.AddCommand(repoMirrorCmd)
+	addTransferLimitFlags(repoMirrorCmd, 4)
+}
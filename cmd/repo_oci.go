@@ -0,0 +1,219 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An OCI repository is a namespace of a registry, oci://registry/namespace. Its index is the artifact
+// namespace/index:latest, unless the URL names an artifact with a tag or digest. The templates of the index can be
+// artifacts too, with oci://registry/repository:tag or oci://registry/repository@digest URLs. The content of an
+// artifact is its appsody layer, or its first layer. As for archives, a template artifact is named
+// <stack>.templates.<template>, such as oci://registry/stacks/nodejs.templates.simple:0.2.0.
+const (
+	ociIndexArtifact = "index"
+	ociDefaultTag    = "latest"
+	// ociLayerPrefix starts the media types of the appsody layers, such as application/vnd.appsody.index.v1+yaml
+	ociLayerPrefix = "application/vnd.appsody."
+)
+
+// ociManifestMediaTypes are the manifests of artifacts
+var ociManifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociManifest is the part of an artifact manifest the CLI reads
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Layers    []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// ociReference is an artifact of a registry
+type ociReference struct {
+	host       string
+	repository string
+	// reference is the tag or digest of the artifact
+	reference string
+	// pinned is set when the tag or digest is given
+	pinned bool
+}
+
+// parseOCIReference splits oci://registry/repository[:tag|@digest]
+func parseOCIReference(href string) (ociReference, error) {
+	var ref ociReference
+	if !strings.HasPrefix(strings.ToLower(href), "oci://") {
+		return ref, errors.Errorf("%s is not an oci:// URL", href)
+	}
+	rest := href[len("oci://"):]
+	slash := strings.Index(rest, "/")
+	if slash <= 0 || slash == len(rest)-1 {
+		return ref, errors.Errorf("The OCI URL %s must be oci://registry/namespace", href)
+	}
+	ref.host, ref.repository = rest[:slash], strings.TrimSuffix(rest[slash+1:], "/")
+	ref.reference = ociDefaultTag
+	if at := strings.Index(ref.repository, "@"); at >= 0 {
+		ref.repository, ref.reference, ref.pinned = ref.repository[:at], ref.repository[at+1:], true
+	} else if colon := strings.LastIndex(ref.repository, ":"); colon > strings.LastIndex(ref.repository, "/") {
+		ref.repository, ref.reference, ref.pinned = ref.repository[:colon], ref.repository[colon+1:], true
+	}
+	if ref.repository == "" || ref.reference == "" {
+		return ref, errors.Errorf("The OCI URL %s must be oci://registry/namespace", href)
+	}
+	return ref, nil
+}
+
+// registryURL returns the URL of the registry API for the repository of the artifact. Registries on this
+// machine are reached with plain http, as docker does.
+func (ref ociReference) registryURL() string {
+	scheme := "https"
+	if host, _, err := splitHostPort(ref.host); err == nil && isLoopbackHost(host) {
+		scheme = "http"
+	}
+	return scheme + "://" + ref.host + "/v2/" + ref.repository
+}
+
+// splitHostPort splits a host with an optional port
+func splitHostPort(hostPort string) (string, string, error) {
+	parsed, err := url.Parse("//" + hostPort)
+	if err != nil {
+		return "", "", err
+	}
+	return parsed.Hostname(), parsed.Port(), nil
+}
+
+// ociIndexReference returns the artifact of the index of an OCI repository
+func ociIndexReference(repoURL string) (string, error) {
+	ref, err := parseOCIReference(repoURL)
+	if err != nil {
+		return "", err
+	}
+	if ref.pinned {
+		return repoURL, nil
+	}
+	return "oci://" + ref.host + "/" + ref.repository + "/" + ociIndexArtifact + ":" + ociDefaultTag, nil
+}
+
+// archiveName returns the file name of a template archive: the last element of its URL, or for an OCI artifact the
+// name of its repository with .tar.gz, as tags and digests do not make file names on every system
+func archiveName(archiveURL string) string {
+	ref, err := parseOCIReference(archiveURL)
+	if err != nil {
+		return path.Base(archiveURL)
+	}
+	return path.Base(ref.repository) + ".tar.gz"
+}
+
+// ociRepoBackend reads the index of an OCI repository from its index artifact
+type ociRepoBackend struct{}
+
+func (ociRepoBackend) checkURL(repoURL string) error {
+	_, err := parseOCIReference(repoURL)
+	return err
+}
+
+func (ociRepoBackend) fetchIndex(repo *RepositoryEntry, headers map[string]string) (*RepoIndex, error) {
+	if err := repo.checkIndexSignature(); err != nil {
+		return nil, err
+	}
+	indexURL, err := ociIndexReference(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+	return downloadIndexWithTimeout(indexURL, headers, repo.timeout())
+}
+
+// ociTransport downloads oci:// URLs: it reads the manifest of the artifact, then answers with its layer. The
+// layer is requested with the Range of the request, so that downloads resume, and the answer carries the
+// checksum of the layer for verifyDownloadChecksum.
+type ociTransport struct {
+	base http.RoundTripper
+}
+
+func (t ociTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ref, err := parseOCIReference(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	// the client follows the redirects of the registries to their storage, without the Authorization header
+	client := &http.Client{Transport: t.base}
+	authorization := req.Header.Get("Authorization")
+	get := func(href string, header http.Header) (*http.Response, error) {
+		registryReq, err := newRequestWithContext(req.Context(), http.MethodGet, href, nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			registryReq.Header[name] = values
+		}
+		if authorization != "" {
+			registryReq.Header.Set("Authorization", authorization)
+		}
+		resp, err := client.Do(registryReq)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		resp.Body.Close()
+		if authorization, err = registryAuthorization(client, ref.host, ref.repository, resp.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, err
+		}
+		registryReq.Header.Set("Authorization", authorization)
+		return client.Do(registryReq)
+	}
+
+	resp, err := get(ref.registryURL()+"/manifests/"+ref.reference, http.Header{"Accept": {strings.Join(ociManifestMediaTypes, ", ")}})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	var manifest ociManifest
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Errorf("The manifest of %s is not valid: %v", req.URL, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, errors.Errorf("%s has no layers, it is not an appsody artifact", req.URL)
+	}
+	layer := manifest.Layers[0]
+	for _, candidate := range manifest.Layers {
+		if strings.HasPrefix(candidate.MediaType, ociLayerPrefix) {
+			layer = candidate
+			break
+		}
+	}
+	Debug.logf("Downloading the %s layer %s of %s", layer.MediaType, layer.Digest, req.URL)
+
+	header := http.Header{}
+	if byteRange := req.Header.Get("Range"); byteRange != "" {
+		header.Set("Range", byteRange)
+	}
+	if resp, err = get(ref.registryURL()+"/blobs/"+layer.Digest, header); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(layer.Digest, "sha256:") {
+		resp.Header.Set(checksumHeader, strings.TrimPrefix(layer.Digest, "sha256:"))
+	}
+	return resp, nil
+}
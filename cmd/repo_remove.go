@@ -15,8 +15,6 @@
 package cmd
 
 import (
-	"log"
-
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -32,26 +30,39 @@ var removeCmd = &cobra.Command{
 		}
 		var repoName = args[0]
 
-		var repoFile RepositoryFile
-		repoFile.getRepos()
 		if dryrun {
 			Info.log("Dry Run - Skipping appsody repo remove ", repoName)
-		} else {
+			return nil
+		}
+		return updateRepoFile(func(repoFile *RepositoryFile) error {
+			if repo := repoFile.getRepo(repoName); repo != nil && repo.Default && !forceRepoChange {
+				return errors.Errorf("%s is the default repository, use --force to remove it anyway", repoName)
+			}
 			if repoFile.Has(repoName) {
-				repoFile.Remove(repoName)
+				removeRepo(repoFile, repoName)
 			} else {
-				Error.log("Repository is not in configured list of repositories")
+				Error.log("Repository is not in configured list of repositories.", didYouMean(repoName, repoFile.repoNames()))
 			}
-			err := repoFile.WriteFile(getRepoFileLocation())
-			if err != nil {
-				log.Fatalf("Failed to write file repository location: %v", err)
+			return nil
+		})
+	},
+}
+
+// removeRepo removes a repository from the repository file, with its secrets and its git clone
+func removeRepo(repoFile *RepositoryFile, repoName string) {
+	for _, repo := range repoFile.Repositories {
+		if repo.Name == repoName {
+			eraseRepoHeaders(repo)
+			eraseRepoAuth(repo)
+			if repo.Type == repoTypeGit {
+				removeGitClone(repo.Name)
 			}
 		}
-		return nil
-	},
+	}
+	repoFile.Remove(repoName)
 }
 
 func init() {
 	repoCmd.AddCommand(removeCmd)
-
+	removeCmd.PersistentFlags().BoolVar(&forceRepoChange, "force", false, "Remove the repository even when it is the default one.")
 }
@@ -0,0 +1,88 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// forceRepoChange is the --force option of repo rename and repo remove, to change the default repository
+var forceRepoChange bool
+
+var repoRenameCmd = &cobra.Command{
+	Use:   "rename <old> <new>",
+	Short: "Rename an Appsody repository",
+	Long: `This gives a repository another name, keeping its URL, headers and credentials. The stacks of the repository
+are then known as <new>/<stack>; the projects whose repository setting is <old> have to be updated.
+
+The default repository is only renamed with --force, scripts and projects are likely to refer to it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Give the name of the repository and its new name")
+		}
+		oldName, newName := args[0], args[1]
+		var repoFile RepositoryFile
+		if _, err := repoFile.getRepos(); err != nil {
+			return err
+		}
+		repo := repoFile.getRepo(oldName)
+		if repo == nil {
+			return errors.Errorf("There is no repository %s.%s Run `appsody repo list` to see the repositories.", oldName, didYouMean(oldName, repoFile.repoNames()))
+		}
+		if err := checkRepoName(newName); err != nil {
+			return err
+		}
+		if repoFile.Has(newName) {
+			return errors.Errorf("A repository with the name '%s' already exists.", newName)
+		}
+		if repo.Default && !forceRepoChange {
+			return errors.Errorf("%s is the default repository, use --force to rename it anyway", oldName)
+		}
+		if dryrun {
+			planned(planWrite, getRepoFileLocation(), "rename of the "+oldName+" repository to "+newName)
+			return nil
+		}
+		err := updateRepoFile(func(repoFile *RepositoryFile) error {
+			renamed := repoFile.getRepo(oldName)
+			if renamed == nil {
+				return errors.Errorf("The %s repository was removed by another command", oldName)
+			}
+			if repoFile.Has(newName) {
+				return errors.Errorf("A repository with the name '%s' already exists.", newName)
+			}
+			renamed.Name = newName
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(cachedIndexFile(oldName), cachedIndexFile(newName)); err != nil && !os.IsNotExist(err) {
+			Debug.logf("Could not move the cached index of the %s repository: %v", oldName, err)
+		}
+		if repo.Type == repoTypeGit {
+			moveGitClone(oldName, newName)
+		}
+		Info.logf("The %s repository is now %s", oldName, newName)
+		return nil
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoRenameCmd)
+	repoRenameCmd.PersistentFlags().BoolVar(&forceRepoChange, "force", false, "Rename the repository even when it is the default one.")
+}
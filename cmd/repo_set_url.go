@@ -0,0 +1,107 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var repoSetURLCmd = &cobra.Command{
+	Use:   "set-url <name> <url>",
+	Short: "Change the URL of an Appsody repository",
+	Long: `This points a repository at another URL, keeping its name, headers and credentials. The index at the new URL
+is downloaded and parsed first, the repository is left as it is when it can not be.
+
+The URL must use https, unless it is a file:// URL or is on localhost. Use --allow-insecure for a plain http URL.`,
+	Example: `  appsody repo set-url incubator https://github.com/appsody/stacks/releases/latest/download/incubator-index.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Give the name of the repository and its new URL")
+		}
+		repoName, repoURL := args[0], args[1]
+		var repoFile RepositoryFile
+		if _, err := repoFile.getRepos(); err != nil {
+			return err
+		}
+		repo := repoFile.getRepo(repoName)
+		if repo == nil {
+			return errors.Errorf("There is no repository %s.%s Run `appsody repo list` to see the repositories.", repoName, didYouMean(repoName, repoFile.repoNames()))
+		}
+		if repo.URL == repoURL {
+			Info.logf("The %s repository is already at %s", repoName, repoURL)
+			return nil
+		}
+		for _, other := range repoFile.Repositories {
+			if other.Name != repoName && other.URL == repoURL {
+				return errors.Errorf("The %s repository already has the URL %s", other.Name, repoURL)
+			}
+		}
+		if err := checkSecureURL(repoURL, allowInsecure || repo.AllowInsecure); err != nil {
+			return err
+		}
+		extraFileRoots = append(extraFileRoots, indexFileRoots(repoURL)...)
+		candidate := *repo
+		candidate.URL = repoURL
+		candidate.AllowInsecure = allowInsecure || repo.AllowInsecure
+		headers, err := resolveHeaders(repoName, repo.Headers)
+		if err != nil {
+			return err
+		}
+		if repo.Auth != nil {
+			if headers["Authorization"], err = repo.Auth.authorization(repoName); err != nil {
+				return err
+			}
+		}
+		backend, err := candidate.backend()
+		if err != nil {
+			return err
+		}
+		if err = backend.checkURL(repoURL); err != nil {
+			return err
+		}
+		if _, err = backend.fetchIndex(&candidate, headers); err != nil {
+			return errors.Errorf("The %s repository is left at %s, the index at %s could not be read: %v", repoName, repo.URL, repoURL, err)
+		}
+		if dryrun {
+			planned(planWrite, getRepoFileLocation(), "URL of the "+repoName+" repository")
+			return nil
+		}
+		err = updateRepoFile(func(repoFile *RepositoryFile) error {
+			changed := repoFile.getRepo(repoName)
+			if changed == nil {
+				return errors.Errorf("The %s repository was removed by another command", repoName)
+			}
+			*changed = candidate
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// the cached index is the one of the old URL
+		if err = os.Remove(cachedIndexFile(repoName)); err != nil && !os.IsNotExist(err) {
+			Warning.logf("Could not remove the cached index of the %s repository: %v", repoName, err)
+		}
+		Info.logf("The %s repository is now at %s", repoName, repoURL)
+		return nil
+	},
+}
+
+func init() {
+	repoCmd.AddCommand(repoSetURLCmd)
+	repoSetURLCmd.PersistentFlags().BoolVar(&allowInsecure, "allow-insecure", false, "Allow a plain http URL for the repository and its templates.")
+}
@@ -0,0 +1,69 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var supportsArchTests = []struct {
+	architectures []string
+	platform      string
+	supported     bool
+}{
+	{nil, "linux/s390x", true},
+	{[]string{"amd64"}, "linux/amd64", true},
+	{[]string{"linux/amd64"}, "linux/amd64", true},
+	{[]string{"linux/amd64"}, "amd64", true},
+	{[]string{"linux/amd64"}, "linux/arm64", false},
+	{[]string{"linux/amd64"}, "windows/amd64", false},
+	{[]string{"linux/amd64", "linux/arm64/v8"}, "linux/arm64", true},
+	{[]string{"linux/arm64/v8"}, "linux/arm64/v8", true},
+	{[]string{"linux/arm/v7"}, "linux/arm/v6", false},
+	{[]string{"linux/arm/v7"}, "linux/arm", true},
+	// the variant is not the architecture
+	{[]string{"linux/arm64/v8"}, "linux/v8", false},
+	{[]string{"Linux/AMD64"}, "linux/amd64", true},
+}
+
+func TestSupportsArch(t *testing.T) {
+	for _, test := range supportsArchTests {
+		t.Run(strings.Join(test.architectures, ",")+" "+test.platform, func(t *testing.T) {
+			version := &cmd.ProjectVersion{Architectures: test.architectures}
+			if supported := version.SupportsArch(test.platform); supported != test.supported {
+				t.Errorf("supportsArch(%q) of %v is %t, expected %t", test.platform, test.architectures, supported, test.supported)
+			}
+		})
+	}
+}
+
+func TestListProjects(t *testing.T) {
+	_, _, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	index := &cmd.RepoIndex{Projects: map[string]cmd.ProjectVersions{
+		"incubator/empty": nil,
+		"incubator/java":  {&cmd.ProjectVersion{Version: "0.2.1", Description: "Java stack"}},
+	}}
+	table := index.ListProjects()
+	if !strings.Contains(table, "java") || !strings.Contains(table, "0.2.1") {
+		t.Errorf("Expected the java stack in the table, got %s", table)
+	}
+	if strings.Contains(table, "empty") {
+		t.Errorf("Expected the stack without versions to be skipped, got %s", table)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var repoValidateReportFile string
+var repoValidateReportFormat string
+
+// repoValidation is the outcome of the validation of the index of a repository
+type repoValidation struct {
+	Repository string   `json:"repository"`
+	URL        string   `json:"url"`
+	Problems   []string `json:"problems,omitempty"`
+}
+
+var repoValidateCmd = &cobra.Command{
+	Use:   "validate [repository...]",
+	Short: "Check the indexes of the repositories against the schema of the index",
+	Long: `This downloads the index of the named repositories, or of every configured repository, and checks it against the
+JSON Schema of the index, as appsody validate checks an index.yaml file: the unknown fields, such as typos, and the
+values of the wrong type are reported with their path in the index. The indexes of the OCI and git repositories, and
+the listings of the directories without an index.yaml, are checked as appsody reads them.
+
+The problems can be written to a JSON or SARIF report with --report-file, so that code scanning tools such as
+GitHub code scanning show them. The command fails if any index has one.`,
+	Example: `  appsody repo validate
+  appsody repo validate incubator --report-file index.sarif --report-format sarif`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if repoValidateReportFormat != "json" && repoValidateReportFormat != "sarif" {
+			return errors.Errorf("Unsupported report format %s. Use json or sarif.", repoValidateReportFormat)
+		}
+		var repoFile RepositoryFile
+		if _, err := repoFile.getRepos(); err != nil {
+			return err
+		}
+		repos := repoFile.Repositories
+		if len(args) > 0 {
+			repos = nil
+			for _, name := range args {
+				repo := repoFile.getRepo(name)
+				if repo == nil {
+					return errors.Errorf("There is no %s repository.%s", name, didYouMean(name, repoFile.repoNames()))
+				}
+				repos = append(repos, repo)
+			}
+		}
+		if len(repos) == 0 {
+			return errors.New("There are no repositories to validate, add one with appsody repo add")
+		}
+
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.Wrap = true
+		table.AddRow("REPOSITORY", "URL", "RESULT")
+		var validations []repoValidation
+		invalid := 0
+		for _, repo := range repos {
+			validation := repoValidation{Repository: repo.Name, URL: repo.URL}
+			problems, err := repoIndexProblems(repo)
+			if err != nil {
+				problems = []string{err.Error()}
+			}
+			validation.Problems = problems
+			validations = append(validations, validation)
+			result := "valid"
+			if len(problems) > 0 {
+				result = strings.Join(problems, "; ")
+				invalid++
+			}
+			table.AddRow(repo.Name, repo.URL, result)
+		}
+		Info.log("\n", table)
+
+		if repoValidateReportFile != "" {
+			if dryrun {
+				planned(planWrite, repoValidateReportFile, "index validation report")
+			} else {
+				if err := writeRepoValidateReport(validations); err != nil {
+					return errors.Errorf("Could not write the index validation report: %v", err)
+				}
+				Info.log("Index validation report written to ", repoValidateReportFile)
+			}
+		}
+		if invalid > 0 {
+			return errors.Errorf("%d of %d repository index(es) are not valid", invalid, len(repos))
+		}
+		return nil
+	},
+}
+
+// repoIndexProblems checks the index of a repository against the schema of the index. The index.yaml of an
+// http or file repository is checked as it is published, so that its unknown fields are found. The other indexes
+// are checked as they are read.
+func repoIndexProblems(repo *RepositoryEntry) ([]string, error) {
+	if resolveRepoType(repo.Type, repo.URL) == repoTypeHTTP {
+		headers, err := repo.indexHeaders()
+		if err != nil {
+			return nil, err
+		}
+		indexURL := repo.URL
+		if strings.HasSuffix(indexURL, "/") {
+			indexURL += "index.yaml"
+		}
+		var published bytes.Buffer
+		err = downloadFileWithTimeout(indexURL, &published, headers, repo.timeout())
+		if err == nil {
+			return validateData(published.Bytes(), schemaIndex)
+		}
+		if !strings.HasSuffix(repo.URL, "/") {
+			return nil, errors.Errorf("Could not download the index: %v", err)
+		}
+		Debug.logw("No index.yaml in the repository directory, checking its listing", "url", repo.URL, "error", err)
+	}
+	index, err := repo.downloadIndex()
+	if err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	return validateData(data, schemaIndex)
+}
+
+// repoValidateSARIFRules is the rule of the SARIF report of repo validate
+var repoValidateSARIFRules = []sarifRule{
+	{"index", sarifMessage{"The repository index matches the schema of the index"}},
+}
+
+// writeRepoValidateReport writes the problems of the indexes to the report file, as JSON or SARIF
+func writeRepoValidateReport(validations []repoValidation) error {
+	if repoValidateReportFormat == "sarif" {
+		var results []sarifResult
+		for _, validation := range validations {
+			// the index of a file repository is reported on the file, which code scanning finds in the checkout
+			location := validation.URL
+			if index, ok := fileURLIndex(location); ok {
+				location = index
+			}
+			for _, problem := range validation.Problems {
+				results = append(results, newSARIFResult("index", sarifError, validation.Repository+": "+problem, location))
+			}
+		}
+		return writeSARIF(newSARIFReport("repo validate", repoValidateSARIFRules, results), repoValidateReportFile)
+	}
+	data, err := json.MarshalIndent(validations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(repoValidateReportFile, data, 0644)
+}
+
+func init() {
+	repoCmd.AddCommand(repoValidateCmd)
+	repoValidateCmd.Flags().StringVar(&repoValidateReportFile, "report-file", "", "Write the problems found to this file.")
+	repoValidateCmd.Flags().StringVar(&repoValidateReportFormat, "report-format", "sarif", "Format of the report file: json or sarif.")
+}
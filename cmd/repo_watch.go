@@ -0,0 +1,290 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// indexDebounce batches the changes of an editor saving many files, or of a git checkout, into one re-index
+const indexDebounce = time.Second
+
+var watchImageNamespace string
+var watchOnce bool
+var watchRepoDir string
+
+var repoWatchCmd = &cobra.Command{
+	Use:   "watch <repository> <stack-source-dir>",
+	Short: "Keep the index of a local repository up to date with the stack sources",
+	Long: `This packages the stacks found under the stack source directory, any directory with a stack.yaml, into the
+directory of a local repository, a repository with a file:// URL, and writes its index. It then watches the stack
+sources and packages and indexes them again on every change, so that appsody init and list never read a stale
+index of the stacks being worked on. Stop it with Ctrl-C.
+
+To start a new local repository, name the directory to keep its packages and index in with --repo-dir. The
+repository is added once its index is written.
+
+Stacks that are not valid are left out of the index, with a warning. Use --once to index the stacks and exit.`,
+	Example: `  appsody repo watch dev ~/src/stacks --repo-dir ~/stacks-repo
+  appsody repo watch dev ~/src/stacks`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Specify the repository and the stack source directory, such as appsody repo watch dev ./stacks")
+		}
+		var repos RepositoryFile
+		if _, err := repos.getRepos(); err != nil {
+			return err
+		}
+		var repo *RepositoryEntry
+		for _, entry := range repos.Repositories {
+			if entry.Name == args[0] {
+				repo = entry
+			}
+		}
+		var repoDir, indexFile string
+		var err error
+		switch {
+		case repo != nil && watchRepoDir != "":
+			return errors.Errorf("The %s repository already exists, --repo-dir is only for new repositories", repo.Name)
+		case repo != nil:
+			var ok bool
+			if repoDir, ok = fileURLDir(repo.URL); !ok {
+				return errors.Errorf("The %s repository is at %s, only repositories with a file:// URL can be watched", repo.Name, repo.URL)
+			}
+			indexFile = filepath.Join(repoDir, "index.yaml")
+			if !strings.HasSuffix(repo.URL, "/") {
+				indexFile, _ = localFileURLPath(repo.URL)
+			}
+		case watchRepoDir != "":
+			if repoDir, err = filepath.Abs(watchRepoDir); err != nil {
+				return err
+			}
+			indexFile = filepath.Join(repoDir, "index.yaml")
+		default:
+			return errors.Errorf("There is no %s repository.%s Use --repo-dir to start a new local repository.", args[0], didYouMean(args[0], repos.repoNames()))
+		}
+		sourceDir, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		if err = indexStackSources(sourceDir, repoDir, indexFile); err != nil {
+			return err
+		}
+		if repo == nil && !dryrun {
+			repos.Add(&RepositoryEntry{Name: args[0], URL: fileURL(indexFile)})
+			if err = repos.WriteFile(getRepoFileLocation()); err != nil {
+				return errors.Errorf("Failed to write file to repository location: %v", err)
+			}
+			Info.logf("Added the %s repository", args[0])
+		}
+		if watchOnce {
+			return nil
+		}
+		return watchStackSources(sourceDir, repoDir, indexFile)
+	},
+}
+
+// indexStackSources packages the valid stacks of the source directory into the repository directory and
+// writes the index of the packages
+func indexStackSources(sourceDir string, repoDir string, indexFile string) error {
+	if dryrun {
+		if _, err := discoverStacks(sourceDir); err != nil {
+			return errors.Errorf("Could not search %s for stacks: %v", sourceDir, err)
+		}
+		planned(planWrite, indexFile, "the index of the "+sourceDir+" stacks")
+		return nil
+	}
+	indexed, found, err := packageStackSources(sourceDir, repoDir, indexFile, stackPackaging{watchImageNamespace, fileURL})
+	if err != nil {
+		return err
+	}
+	Info.logf("Indexed %d of the %d stack(s) of %s in %s", indexed, found, sourceDir, indexFile)
+	return nil
+}
+
+// stackPackaging is how stacks are packaged for an index: the namespace of their images, and the URL the index
+// gives the archive of a template
+type stackPackaging struct {
+	imageNamespace string
+	archiveURL     func(archive string) string
+}
+
+// packageStackSources packages the valid stacks of the source directory and writes their index, even with
+// --dryrun. It returns how many stacks were indexed of the ones found.
+func packageStackSources(sourceDir string, repoDir string, indexFile string, packaging stackPackaging) (int, int, error) {
+	stacks, err := discoverStacks(sourceDir)
+	if err != nil {
+		return 0, 0, errors.Errorf("Could not search %s for stacks: %v", sourceDir, err)
+	}
+	index, err := indexStacks(stacks, repoDir, packaging)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = writeRepoIndex(index, indexFile); err != nil {
+		return 0, 0, err
+	}
+	return len(index.Projects), len(stacks), nil
+}
+
+// indexStacks packages the stacks into repoDir and returns their index. Invalid stacks are left out of it.
+func indexStacks(stacks []stackSource, repoDir string, packaging stackPackaging) (*RepoIndex, error) {
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return nil, err
+	}
+	index := RepoIndex{APIVersion: "v1", Generated: time.Now(), Projects: map[string]ProjectVersions{}}
+	for _, stack := range stacks {
+		version, err := packageStackSource(stack, repoDir, packaging)
+		if err != nil {
+			Warning.logf("The %s stack is left out of the index: %v", stack.ID, err)
+			continue
+		}
+		index.Projects[stack.ID] = ProjectVersions{version}
+	}
+	return &index, nil
+}
+
+// writeRepoIndex writes an index file in place of the previous one
+func writeRepoIndex(index *RepoIndex, indexFile string) error {
+	data, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	// appsody commands reading the index while it is written see the previous one
+	temp := indexFile + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, indexFile)
+}
+
+// packageStackSource packages the templates of a stack, the default one first, and returns its index entry with
+// the digests of the archives
+func packageStackSource(stack stackSource, repoDir string, packaging stackPackaging) (*ProjectVersion, error) {
+	if problems := validateStack(stack); len(problems) > 0 {
+		var messages []string
+		for _, problem := range problems {
+			messages = append(messages, problem.Error())
+		}
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+	stackYaml, err := readStackYaml(stack.Dir)
+	if err != nil {
+		return nil, err
+	}
+	version := &ProjectVersion{
+		APIVersion:  "v1",
+		Created:     time.Now(),
+		Name:        stackYaml.Name,
+		Version:     stackYaml.Version,
+		Description: stackYaml.Description,
+		License:     stackYaml.License,
+		Deprecated:  stackYaml.Deprecated,
+	}
+	version.RequiresAppsodyVersion = stackYaml.RequiresAppsodyVersion
+	version.Env = stackYaml.Env
+	for _, maintainer := range stackYaml.Maintainers {
+		version.Maintainers = append(version.Maintainers, maintainer.Name+" <"+maintainer.Email+">")
+	}
+	stackImage := stackImageName(packaging.imageNamespace, stack.ID, stackYaml.Version)
+	version.Image = stackImage
+	templates := stack.Templates
+	for i, template := range templates {
+		if template == stackYaml.DefaultTemplate {
+			templates = append([]string{template}, append(append([]string{}, templates[:i]...), templates[i+1:]...)...)
+		}
+	}
+	for _, template := range templates {
+		archive := filepath.Join(repoDir, stack.ID+".v"+stackYaml.Version+".templates."+template+".tar.gz")
+		digest, err := packageTemplate(stack, template, stackImage, archive)
+		if err != nil {
+			return nil, errors.Errorf("Could not package the %s template: %v", template, err)
+		}
+		templateURL := packaging.archiveURL(archive)
+		if len(version.URLs) == 0 {
+			version.Digest = "sha256:" + digest
+		}
+		version.URLs = append(version.URLs, templateURL)
+		version.Templates = append(version.Templates, StackTemplate{Name: template, URL: templateURL, Digest: "sha256:" + digest})
+	}
+	return version, nil
+}
+
+// watchStackSources indexes the stacks again after every change of the source directory, until interrupted
+func watchStackSources(sourceDir string, repoDir string, indexFile string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err = addWatchRecursive(watcher, sourceDir); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	Info.logf("Watching %s for changes, press Ctrl-C to stop", sourceDir)
+	timer := time.NewTimer(indexDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// the packages and the index can be written under the source directory
+			if inFileRoots(event.Name, []string{repoDir}) {
+				continue
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					_ = addWatchRecursive(watcher, event.Name)
+				}
+			}
+			Debug.log("Stack source changed: ", event)
+			timer.Reset(indexDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			Warning.log("Stack source watch error: ", err)
+		case <-timer.C:
+			if err := indexStackSources(sourceDir, repoDir, indexFile); err != nil {
+				Error.log("Could not index the stacks: ", err)
+			}
+		case <-interrupt:
+			return nil
+		case <-cliContext().Done():
+			return nil
+		}
+	}
+}
+
+func init() {
+	repoCmd.AddCommand(repoWatchCmd)
+	repoWatchCmd.PersistentFlags().StringVar(&watchImageNamespace, "image-namespace", "appsody", "Namespace of the stack images referenced by the packaged templates.")
+	repoWatchCmd.PersistentFlags().StringVar(&watchRepoDir, "repo-dir", "", "Directory to keep the packages and index of a new local repository in.")
+	repoWatchCmd.PersistentFlags().BoolVar(&watchOnce, "once", false, "Index the stacks once, without watching them.")
+}
@@ -0,0 +1,118 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Resources are the CPU and memory the deployed container requests and is limited to, as Kubernetes
+// quantities such as 250m or 512Mi
+type Resources struct {
+	CPURequest    string `yaml:"cpuRequest,omitempty"`
+	CPULimit      string `yaml:"cpuLimit,omitempty"`
+	MemoryRequest string `yaml:"memoryRequest,omitempty"`
+	MemoryLimit   string `yaml:"memoryLimit,omitempty"`
+}
+
+// containerResources are the resources in the container spec of a manifest
+type containerResources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+var quantityFormat = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$`)
+
+// resourceFlags are the --cpu-request, --cpu-limit, --memory-request and --memory-limit options of deploy
+var resourceFlags Resources
+
+// deployResources are the resources of the project being deployed, GenKnativeYaml adds them to the container
+var deployResources *Resources
+
+// merge returns the resources with the settings of the other resources replacing theirs
+func (r *Resources) merge(other *Resources) *Resources {
+	merged := Resources{}
+	if r != nil {
+		merged = *r
+	}
+	if other == nil {
+		return &merged
+	}
+	if other.CPURequest != "" {
+		merged.CPURequest = other.CPURequest
+	}
+	if other.CPULimit != "" {
+		merged.CPULimit = other.CPULimit
+	}
+	if other.MemoryRequest != "" {
+		merged.MemoryRequest = other.MemoryRequest
+	}
+	if other.MemoryLimit != "" {
+		merged.MemoryLimit = other.MemoryLimit
+	}
+	return &merged
+}
+
+func (r *Resources) validate() error {
+	for _, quantity := range []struct{ name, value string }{
+		{"cpuRequest", r.CPURequest},
+		{"cpuLimit", r.CPULimit},
+		{"memoryRequest", r.MemoryRequest},
+		{"memoryLimit", r.MemoryLimit},
+	} {
+		if quantity.value != "" && !quantityFormat.MatchString(quantity.value) {
+			return errors.Errorf("The %s %q is not a Kubernetes quantity, such as 500m for CPUs or 512Mi for memory", quantity.name, quantity.value)
+		}
+	}
+	return nil
+}
+
+// containerResources returns the resources for the container spec, or nil when none is set
+func (r *Resources) containerResources() *containerResources {
+	if r == nil {
+		return nil
+	}
+	resources := &containerResources{}
+	add := func(quantities *map[string]string, name string, value string) {
+		if value == "" {
+			return
+		}
+		if *quantities == nil {
+			*quantities = map[string]string{}
+		}
+		(*quantities)[name] = value
+	}
+	add(&resources.Requests, "cpu", r.CPURequest)
+	add(&resources.Requests, "memory", r.MemoryRequest)
+	add(&resources.Limits, "cpu", r.CPULimit)
+	add(&resources.Limits, "memory", r.MemoryLimit)
+	if resources.Requests == nil && resources.Limits == nil {
+		return nil
+	}
+	return resources
+}
+
+// getDeployResources returns the resources of the project, replaced by the ones of the environment, of the
+// cluster and then by the options
+func getDeployResources(environment *Environment, target *ClusterTarget) (*Resources, error) {
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	resources := config.Resources.merge(environment.Resources).merge(target.Resources).merge(&resourceFlags)
+	return resources, resources.validate()
+}
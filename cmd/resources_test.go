@@ -0,0 +1,128 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+)
+
+var resourcesValidateTests = []struct {
+	testName      string
+	resources     cmd.Resources
+	expectedError string // empty when the quantities are valid
+}{
+	{"Valid", cmd.Resources{CPURequest: "250m", CPULimit: "1.5", MemoryRequest: "256Mi", MemoryLimit: "1G"}, ""},
+	{"Empty", cmd.Resources{}, ""},
+	{"CPU unit", cmd.Resources{CPULimit: "2cores"}, `The cpuLimit "2cores" is not a Kubernetes quantity`},
+	{"Memory unit", cmd.Resources{MemoryRequest: "512MB"}, `The memoryRequest "512MB" is not a Kubernetes quantity`},
+	{"Negative", cmd.Resources{MemoryLimit: "-1Gi"}, `The memoryLimit "-1Gi" is not a Kubernetes quantity`},
+}
+
+func TestResourcesValidate(t *testing.T) {
+	for _, tt := range resourcesValidateTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := tt.resources.Validate()
+
+			if tt.expectedError == "" && err != nil {
+				t.Error(err)
+			}
+			if tt.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectedError)) {
+				t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+var deployResourcesTests = []struct {
+	testName          string
+	project           *cmd.Resources
+	environment       *cmd.Resources
+	cluster           *cmd.Resources
+	flags             cmd.Resources
+	expectedResources cmd.Resources
+	expectedError     string
+}{
+	{"None", nil, nil, nil, cmd.Resources{}, cmd.Resources{}, ""},
+	{"Project", &cmd.Resources{CPURequest: "250m", MemoryLimit: "512Mi"}, nil, nil, cmd.Resources{},
+		cmd.Resources{CPURequest: "250m", MemoryLimit: "512Mi"}, ""},
+	// each level only replaces the settings it gives
+	{"Environment", &cmd.Resources{CPURequest: "250m", MemoryLimit: "512Mi"}, &cmd.Resources{MemoryLimit: "1Gi"}, nil, cmd.Resources{},
+		cmd.Resources{CPURequest: "250m", MemoryLimit: "1Gi"}, ""},
+	{"Cluster", &cmd.Resources{CPURequest: "250m"}, &cmd.Resources{CPURequest: "500m", CPULimit: "1"}, &cmd.Resources{CPULimit: "2"}, cmd.Resources{},
+		cmd.Resources{CPURequest: "500m", CPULimit: "2"}, ""},
+	{"Options", &cmd.Resources{CPURequest: "250m"}, &cmd.Resources{CPURequest: "500m"}, &cmd.Resources{CPURequest: "750m"}, cmd.Resources{CPURequest: "1", MemoryRequest: "128Mi"},
+		cmd.Resources{CPURequest: "1", MemoryRequest: "128Mi"}, ""},
+	{"Invalid", nil, &cmd.Resources{MemoryLimit: "1GB"}, nil, cmd.Resources{}, cmd.Resources{}, `The memoryLimit "1GB" is not a Kubernetes quantity`},
+}
+
+func TestDeployResources(t *testing.T) {
+	for _, tt := range deployResourcesTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			restore := cmd.UseProjectConfig(cmd.ProjectConfig{Resources: tt.project})
+			defer restore()
+			resources, err := cmd.GetDeployResources(&cmd.Environment{Resources: tt.environment}, &cmd.ClusterTarget{Resources: tt.cluster}, tt.flags)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *resources != tt.expectedResources {
+				t.Errorf("Expected the resources %+v, got %+v", tt.expectedResources, *resources)
+			}
+		})
+	}
+}
+
+var resourcesServiceTests = []struct {
+	testName         string
+	resources        *cmd.Resources
+	expectedRequests map[string]string
+	expectedLimits   map[string]string
+}{
+	{"No resources", nil, nil, nil},
+	{"Empty", &cmd.Resources{}, nil, nil},
+	{"Requests", &cmd.Resources{CPURequest: "250m", MemoryRequest: "256Mi"}, map[string]string{"cpu": "250m", "memory": "256Mi"}, nil},
+	{"Limits", &cmd.Resources{CPURequest: "250m", CPULimit: "1", MemoryLimit: "1Gi"}, map[string]string{"cpu": "250m"}, map[string]string{"cpu": "1", "memory": "1Gi"}},
+}
+
+func TestResourcesService(t *testing.T) {
+	for _, tt := range resourcesServiceTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			restore := cmd.UseDeployResources(tt.resources)
+			defer restore()
+			service := genKnativeService(t, getKNativeTemplate1(), "app", true)
+
+			resources := service.Spec.RunLatest.Configuration.RevisionTemplate.Spec.Container.Resources
+			if tt.expectedRequests == nil && tt.expectedLimits == nil {
+				if resources != nil {
+					t.Errorf("Expected no resources, got %+v", resources)
+				}
+				return
+			}
+			if resources == nil || !reflect.DeepEqual(resources.Requests, tt.expectedRequests) || !reflect.DeepEqual(resources.Limits, tt.expectedLimits) {
+				t.Errorf("Expected the requests %v and limits %v, got %+v", tt.expectedRequests, tt.expectedLimits, resources)
+			}
+		})
+	}
+}
@@ -36,7 +36,10 @@ import (
 
 var (
 	// VERSION is set during build
-	VERSION         string
+	VERSION string
+	// COMMIT and DATE are the commit and the time of the build, set during build too
+	COMMIT          string
+	DATE            string
 	cfgFile         string
 	cliConfig       *viper.Viper
 	APIVersionV1    = "v1"
@@ -45,11 +48,12 @@ var (
 	klogInitialized = false
 )
 
+// homeDir returns the home directory of the user, or the current directory when it can not be found
 func homeDir() string {
 	home, err := homedir.Dir()
 	if err != nil {
-		Error.log(err)
-		os.Exit(1)
+		Warning.log("Could not find the home directory, using the current directory: ", err)
+		return "."
 	}
 	return home
 }
@@ -70,15 +74,20 @@ func init() {
 	// TODO - instead of the isHelpCommand() check, we should delay the config init/ensure until we really need the config
 	if !isHelpCommand() {
 		cobra.OnInitialize(initLogging)
+		cobra.OnInitialize(initLogFile)
 		cobra.OnInitialize(initConfig)
-		cobra.OnInitialize(ensureConfig)
+		cobra.OnInitialize(initCommandContext)
+		rootCmd.PersistentPreRunE = initHome
 	}
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.appsody/.appsody.yaml)")
 	// Added for logging
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Turns on debug output and logging to a file in $HOME/.appsody/logs")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Turns on debug output and logging to a file in $HOME/.appsody/logs. Same as --log-level debug, with the stack traces of the errors.")
 
 	rootCmd.PersistentFlags().BoolVar(&dryrun, "dryrun", false, "Turns on dry run mode")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "timeout", 0, "Stop the command, its downloads and its docker, podman and kubectl commands once it has run this long, such as 10m. No limit by default.")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "table", "Output format of the commands that list or describe, such as list, info and search: table, json or yaml. diff, info and repo diff print table or json.")
+	rootCmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", false, "Fail instead of prompting for input. Turned on automatically when the input is not a terminal.")
 
 }
 
@@ -98,38 +107,88 @@ func isHelpCommand() bool {
 }
 
 func initConfig() {
-	Debug.log("Running with command line args: appsody ", strings.Join(os.Args[1:], " "))
-	cliConfig = viper.New()
+	Debug.logw("Running with command line args", "args", "appsody "+strings.Join(os.Args[1:], " "))
+	if presetArgs != nil {
+		Debug.logw("With the presets of the configuration", "args", commandLine("appsody", presetArgs))
+	}
+	cliConfig = newCLIConfig(filepath.Join(homeDir(), ".appsody"), cfgFile)
+
+	// If a config file is found, read it in.
+	// Ignore errors, if the config isn't found, we will create a default later
+	_ = cliConfig.ReadInConfig()
 
-	cliConfig.SetDefault("home", filepath.Join(homeDir(), ".appsody"))
-	cliConfig.SetDefault("images", "index.docker.io")
-	cliConfig.SetDefault("tektonserver", "")
-	if cfgFile != "" {
+	// the configuration of the appsody home may switch to the one of a context
+	initContext()
+}
+
+// newCLIConfig returns the CLI configuration of the file, or of .appsody.yaml in the home when the file is ""
+func newCLIConfig(home string, file string) *viper.Viper {
+	config := viper.New()
+
+	config.SetDefault("home", home)
+	config.SetDefault("images", "index.docker.io")
+	config.SetDefault("tektonserver", "")
+	if file != "" {
 		// Use config file from the flag.
-		cliConfig.SetConfigFile(cfgFile)
+		config.SetConfigFile(file)
 	} else {
 		// Search config in home directory with name ".hello-cobra" (without extension).
-		cliConfig.AddConfigPath(cliConfig.GetString("home"))
-		cliConfig.SetConfigName(".appsody")
+		config.AddConfigPath(config.GetString("home"))
+		config.SetConfigName(".appsody")
 	}
 
-	cliConfig.SetEnvPrefix("appsody")
-	cliConfig.AutomaticEnv() // read in environment variables that match
+	config.SetEnvPrefix("appsody")
+	config.AutomaticEnv() // read in environment variables that match
+	return config
+}
 
-	// If a config file is found, read it in.
-	// Ignore errors, if the config isn't found, we will create a default later
-	_ = cliConfig.ReadInConfig()
+// initHome creates the appsody home, and sets up what needs it, before the command runs
+func initHome(cmd *cobra.Command, args []string) error {
+	if err := checkContext(); err != nil {
+		return err
+	}
+	if err := ensureConfig(); err != nil {
+		return err
+	}
+	if err := checkLogFlags(); err != nil {
+		return err
+	}
+	initInteractive()
+	initAudit()
+	initNotifications(cmd)
+	cleanScratchDirs()
+	return initDryRunOutput()
 }
 
 func getDefaultConfigFile() string {
+	if activeContext != "" {
+		return filepath.Join(contextDir(activeContext), ".appsody.yaml")
+	}
 	return filepath.Join(cliConfig.GetString("home"), ".appsody.yaml")
 }
 
 func Execute(version string) {
 	VERSION = version
 
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.SetArgs(applyPresets(os.Args[1:]))
+	err := rootCmd.Execute()
+	if waitForCleanup() && err == nil {
+		// the interrupt handler of the command stopped it
+		err = errInterrupted
+	}
+	releaseProjectLocks()
+	removeScratchDir()
+	sendNotifications(err)
+	printDryRunPlan()
+	printPhaseSummary()
+	finishAudit(err)
+	if err != nil && err != errInterrupted {
 		Error.log(err)
+	}
+	if appLog != nil {
+		appLog.close()
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -148,44 +207,67 @@ var (
 	Container  appsodylogger = "Container"
 	InitScript appsodylogger = "InitScript"
 	DockerLog  appsodylogger = "Docker"
+	HTTPTrace  appsodylogger = "HTTP"
 )
 
 func (l appsodylogger) log(args ...interface{}) {
 	msgString := fmt.Sprint(args...)
-	l.internalLog(msgString, args...)
+	l.internalLog(msgString, nil, args...)
 }
 
 func (l appsodylogger) logf(fmtString string, args ...interface{}) {
 	msgString := fmt.Sprintf(fmtString, args...)
-	l.internalLog(msgString, args...)
+	l.internalLog(msgString, nil, args...)
 }
 
-func (l appsodylogger) internalLog(msgString string, args ...interface{}) {
-	if l == Debug && !verbose {
+func (l appsodylogger) internalLog(msgString string, fields []logField, args ...interface{}) {
+	if !logEnabled(l) {
 		return
 	}
+	now := time.Now()
+	if appLog != nil {
+		appLog.writeLine(now, formatLogLine(now, l, msgString, fields, true))
+	}
 
-	if verbose || l != Info {
-		msgString = "[" + string(l) + "] " + msgString
+	switch l {
+	case Error:
+		emitEvent(eventError, map[string]interface{}{"message": msgString})
+	case DockerLog:
+		emitBuildStep(msgString)
 	}
 
 	// if verbose and any of the args are of type error, print the stack traces
+	var stacks string
 	if verbose {
 		for _, arg := range args {
 			st, ok := arg.(stackTracer)
 			if ok {
-				msgString = fmt.Sprintf("%s\n\n%s%+v", msgString, st, st.StackTrace())
+				stacks = fmt.Sprintf("%s\n\n%s%+v", stacks, st, st.StackTrace())
 			}
 		}
 	}
-
-	// Print to console
-	if l == Info {
-		fmt.Fprintln(os.Stdout, msgString)
+	if logFormat == "json" {
+		if stacks != "" {
+			fields = append(fields, logField{"stack", strings.TrimSpace(stacks)})
+		}
+		msgString = formatLogLine(now, l, msgString, fields, true)
 	} else {
-		fmt.Fprintln(os.Stderr, msgString)
+		msgString = formatLogLine(now, l, msgString, fields, logTimestamps)
+		if !logTimestamps && (verbose || l != Info) {
+			msgString = "[" + string(l) + "] " + msgString
+		}
+		msgString += stacks
 	}
 
+	// Print to console, standard output carries the events with --json-events
+	printAboveProgress(func() {
+		if l == Info && !jsonEvents {
+			fmt.Fprintln(os.Stdout, msgString)
+		} else {
+			fmt.Fprintln(os.Stderr, msgString)
+		}
+	})
+
 	// Print to log file
 	if verbose && klogInitialized {
 		klog.InfoDepth(2, msgString)
@@ -197,19 +279,17 @@ func initLogging() {
 
 	if verbose {
 
-		logDir := filepath.Join(homeDir(), ".appsody", "logs")
+		logDir := verboseLogDir()
 
-		_, errPath := os.Stat(logDir)
-		if errPath != nil {
-			Debug.log("Creating log dir ", logDir)
-			if err := os.MkdirAll(logDir, 0755); err != nil {
-				Error.logf("Could not create %s: %s", logDir, err)
-			}
+		// a read-only home does not stop the command, it is only not logged to a file
+		if !writableDir(logDir) {
+			Warning.logf("Could not write in %s, the log is not written to a file. Set %s to a directory that can be written.", logDir, stateDirEnv)
+			return
 		}
 
 		currentTimeValues := strings.Split(time.Now().Local().String(), " ")
 		fileName := strings.ReplaceAll("appsody"+currentTimeValues[0]+"T"+currentTimeValues[1]+".log", ":", "-")
-		pathString := filepath.Join(homeDir(), ".appsody", "logs", fileName)
+		pathString := filepath.Join(logDir, fileName)
 		klogFlags := flag.NewFlagSet("klog", flag.ExitOnError)
 		klog.InitFlags(klogFlags)
 		_ = klogFlags.Set("v", "4")
@@ -18,24 +18,30 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func dockerStop(imageName string) {
+func dockerStop(imageName string) error {
 	cmdName := "docker"
 	cmdArgs := []string{"stop", imageName}
-	execAndWait(cmdName, cmdArgs, Debug)
+	return execAndWaitReturnErr(cmdName, cmdArgs, Debug)
 }
 
-func dockerRemove(imageName string) {
+func dockerRemove(imageName string) error {
 	cmdName := "docker"
 	//Added "-f" to force removal if container is still running or image has containers
 	cmdArgs := []string{"rm", imageName, "-f"}
-	execAndWait(cmdName, cmdArgs, Debug)
+	return execAndWaitReturnErr(cmdName, cmdArgs, Debug)
 }
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the local Appsody environment for your project",
-	Long:  `This starts a docker based continuous build environment for your project.`,
+	Long: `This starts a docker based continuous build environment for your project.
+
+The development container is named <project>-dev. Use --name to run an additional instance of the project next
+to it, such as to compare two branches side by side: the instance has its own dependency volume, and the ports of
+the stack are published on the first free host ports above them. Stop it with appsody stop --name <name>.`,
+	Example: `  appsody run
+  appsody run --name feature-x`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		Info.log("Running development environment...")
@@ -47,4 +53,5 @@ var runCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 	addDevCommonFlags(runCmd)
+	addJSONEventsFlag(runCmd)
 }
@@ -0,0 +1,103 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// maxInstancePortOffset bounds the search of free host ports for a named instance
+const maxInstancePortOffset = 100
+
+// runInstanceName is the instance of the project being run, "" for the default <project>-dev container
+var runInstanceName string
+
+// instancePortOffset is added to the host ports the stack's exposed ports are published on, so that several
+// instances of a project run side by side. The ports given with --publish are not offset.
+var instancePortOffset int
+
+// setRunInstance makes the run an additional instance of the project when --name names another container than
+// the default <project>-dev one: the instance has its own dependency and sync volumes, unless --deps-volume is
+// given, and publishes the exposed ports of the stack on the first free host ports after them.
+func setRunInstance(cmd *cobra.Command, projectName string) error {
+	runInstanceName = ""
+	instancePortOffset = 0
+	flag := cmd.Flags().Lookup("name")
+	if flag == nil || !flag.Changed || containerName == projectName+"-dev" {
+		return nil
+	}
+	runInstanceName = containerName
+	if flag := cmd.Flags().Lookup("deps-volume"); flag == nil || !flag.Changed {
+		depsVolumeName = projectName + "-" + runInstanceName + "-deps"
+	}
+	if publishAllPorts || runOnK8s {
+		Info.logf("Running the %s instance of %s", runInstanceName, projectName)
+		return nil
+	}
+	containerPorts, err := getExposedPorts()
+	if err != nil {
+		return err
+	}
+	offset, err := freePortOffset(containerPorts)
+	if err != nil {
+		return err
+	}
+	instancePortOffset = offset
+	Info.logf("Running the %s instance of %s, the ports of the stack are published %d ports higher", runInstanceName, projectName, offset)
+	return nil
+}
+
+// freePortOffset returns the smallest offset that moves every port to a free host port
+func freePortOffset(containerPorts []string) (int, error) {
+	for offset := 1; offset <= maxInstancePortOffset; offset++ {
+		free := true
+		for _, port := range containerPorts {
+			number, err := strconv.Atoi(port)
+			if err != nil {
+				continue
+			}
+			if !hostPortFree(number + offset) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return offset, nil
+		}
+	}
+	return 0, errors.Errorf("Could not find free host ports for the ports %v of the stack, publish them with --publish <host port>:<port>", containerPorts)
+}
+
+// hostPortFree tells whether nothing listens on the TCP port of the host
+func hostPortFree(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// syncVolumePrefix is the start of the names of the sync volumes of the project, appsody clean finds them with it
+func syncVolumePrefix(projectName string) string {
+	if runInstanceName != "" {
+		return projectName + "-sync-" + runInstanceName + "-"
+	}
+	return projectName + "-sync-"
+}
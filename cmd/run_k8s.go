@@ -0,0 +1,281 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var runOnK8s bool
+
+// podReadyTimeout is how long to wait for the development pod to be scheduled and its image pulled
+const podReadyTimeout = "300s"
+
+var nonKubeNameChars = regexp.MustCompile("[^a-z0-9-]")
+
+// kubeSyncTarget syncs into the named pod
+type kubeSyncTarget string
+
+func (p kubeSyncTarget) copyFile(local string, target string) error {
+	return execAndWaitReturnErr("kubectl", kubectlArgs("cp", local, string(p)+":"+target), Debug)
+}
+
+func (p kubeSyncTarget) remove(target string) error {
+	return execAndWaitReturnErr("kubectl", kubectlArgs("exec", string(p), "--", "rm", "-rf", target), Debug)
+}
+
+// devPodManifest returns the pod running the stack image. The controller is copied into the pod once
+// the project files are, so the pod waits for it before running it.
+func devPodManifest(podName string, projectName string, stackImage string, mode string, env []string, git *gitMetadata) ([]byte, error) {
+	var envVars []map[string]string
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			envVars = append(envVars, map[string]string{"name": parts[0], "value": parts[1]})
+		}
+	}
+	container := map[string]interface{}{
+		"name":    "dev",
+		"image":   stackImage,
+		"command": []string{"/bin/sh", "-c", "until [ -x /appsody/appsody-controller ]; do sleep 1; done; exec /appsody/appsody-controller --mode=" + mode},
+	}
+	if len(envVars) > 0 {
+		container["env"] = envVars
+	}
+	labels := map[string]string{"dev.appsody.project": projectName}
+	annotations := map[string]string{}
+	if git != nil {
+		// label values are limited to 63 characters and cannot contain a slash, so the full values go in annotations
+		annotations["dev.appsody.git.branch"] = git.Branch
+		annotations["dev.appsody.git.commit"] = git.Commit
+		annotations["dev.appsody.git.dirty"] = strconv.FormatBool(git.Dirty)
+	}
+	pod := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":        podName,
+			"labels":      labels,
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"restartPolicy": "Never",
+			"containers":    []interface{}{container},
+		},
+	}
+	return yaml.Marshal(pod)
+}
+
+// forwardedPorts returns the local:remote port pairs to forward, the same ones docker run would publish
+func forwardedPorts() ([]string, error) {
+	var pairs []string
+	portArgs, err := processPorts(nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, arg := range portArgs {
+		if arg == "-P" {
+			Warning.log("--publish-all is not supported with --k8s, only the exposed ports are forwarded")
+		} else if arg == "-p" && i+1 < len(portArgs) {
+			// kubectl port-forward listens on --listen-address rather than on an address of each pair
+			if mapping, err := parsePortMapping(portArgs[i+1]); err == nil {
+				pairs = append(pairs, mapping.Host+":"+mapping.Container)
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// runInCluster runs the development container as a pod in the current Kubernetes context. The project
+// files are copied into the pod and kept in sync, and the application and debug ports are forwarded
+// to localhost, so the loop feels like appsody run while the workload runs next to the cluster services.
+func runInCluster(mode string, projectDir string, stackImage string, volumeArgs []string, controller string) error {
+	projectName, err := getProjectName()
+	if err != nil {
+		return err
+	}
+	podName := strings.Trim(nonKubeNameChars.ReplaceAllString(strings.ToLower(containerName), "-"), "-")
+	profileArgs, err := applyRunProfile(mode)
+	if err != nil {
+		return err
+	}
+	validPorts, portError := checkPortInput(ports)
+	if !validPorts {
+		return errors.Errorf("Ports provided as input to the command are not valid: %v\n", portError)
+	}
+	var env []string
+	for i := 0; i+1 < len(profileArgs); i += 2 {
+		env = append(env, profileArgs[i+1])
+	}
+	git := getGitMetadata(projectDir)
+	if git != nil {
+		env = append(env, git.env()...)
+	}
+	otelEnv, err := telemetryEnv(projectName, "", nil)
+	if err != nil {
+		return err
+	}
+	env = append(env, otelEnv...)
+	appEnv, err := projectEnv(nil, false)
+	if err != nil {
+		return err
+	}
+	// the dev pod is short-lived and deleted with the run, its secrets are not kept in a Secret
+	for _, variable := range appEnv {
+		env = append(env, variable.Name+"="+variable.Value)
+	}
+	// only the mounts inside the project are copied, the ones from the local home such as ~/.m2 stay local
+	_, mounts := syncVolumeArgs(volumeArgs, projectDir, projectName)
+
+	manifest, err := devPodManifest(podName, projectName, stackImage, mode, env, git)
+	if err != nil {
+		return err
+	}
+	scratch, err := scratchDir()
+	if err != nil {
+		return err
+	}
+	manifestFile := filepath.Join(scratch, podName+"-pod.yaml")
+	if dryrun {
+		planned(planWrite, manifestFile, "pod manifest")
+	} else {
+		if err = ioutil.WriteFile(manifestFile, manifest, 0644); err != nil {
+			return errors.Errorf("Could not write the pod manifest: %v", err)
+		}
+		defer os.Remove(manifestFile)
+	}
+
+	var portForward *os.Process
+	var stopSync func()
+	deletePod := func() {
+		if stopSync != nil {
+			stopSync()
+		}
+		if portForward != nil {
+			_ = portForward.Kill()
+		}
+		Info.log("Deleting the development pod ", podName)
+		if err := execAndWaitReturnErr("kubectl", kubectlArgs("delete", "pod", podName, "--ignore-not-found", "--wait=false"), Debug); err != nil {
+			Warning.logf("Could not delete the development pod %s: %v", podName, err)
+		}
+	}
+	// the pod is deleted once, by the interrupt handler or when the command returns
+	var cleanupOnce sync.Once
+	cleanup := func() { cleanupOnce.Do(deletePod) }
+	c := handleInterrupts()
+	go func() {
+		<-c
+		cleanup()
+		endCleanup()
+	}()
+	defer cleanup()
+
+	Info.log("Starting the development pod ", podName)
+	if err = execAndWaitReturnErr("kubectl", kubectlArgs("apply", "-f", manifestFile), Debug); err != nil {
+		return errors.Errorf("Could not create the development pod: %v", err)
+	}
+	err = execAndWaitReturnErr("kubectl", kubectlArgs("wait", "--for=condition=Ready", "pod/"+podName, "--timeout="+podReadyTimeout), Debug)
+	if err != nil {
+		return errors.Errorf("The development pod did not become ready: %v", err)
+	}
+
+	for _, mount := range mounts {
+		Info.logf("Copying %s into the pod", mount.Local)
+		if err = copyDirToPod(podName, mount.Local, mount.Container); err != nil {
+			return errors.Errorf("Could not copy %s into the pod: %v", mount.Local, err)
+		}
+	}
+	// copy under a temporary name so the pod never runs a partially copied controller
+	if err = execAndWaitReturnErr("kubectl", kubectlArgs("exec", podName, "--", "mkdir", "-p", "/appsody"), Debug); err != nil {
+		return errors.Errorf("Could not create the controller directory in the pod: %v", err)
+	}
+	if err = execAndWaitReturnErr("kubectl", kubectlArgs("cp", controller, podName+":/appsody/appsody-controller.tmp"), Debug); err != nil {
+		return errors.Errorf("Could not copy the controller into the pod: %v", err)
+	}
+	err = execAndWaitReturnErr("kubectl", kubectlArgs("exec", podName, "--", "sh", "-c", "chmod +x /appsody/appsody-controller.tmp && mv /appsody/appsody-controller.tmp /appsody/appsody-controller"), Debug)
+	if err != nil {
+		return errors.Errorf("Could not install the controller in the pod: %v", err)
+	}
+
+	pairs, err := forwardedPorts()
+	if err != nil {
+		return err
+	}
+	if len(pairs) > 0 {
+		Info.log("Forwarding ports ", strings.Join(pairs, ", "), " to the pod")
+		forwardArgs := []string{"port-forward", "pod/" + podName}
+		if listenAddress != "" {
+			forwardArgs = append(forwardArgs, "--address", listenAddress)
+		}
+		forwardCmd, err := execAndListen("kubectl", kubectlArgs(append(forwardArgs, pairs...)...), Debug)
+		if err != nil {
+			return errors.Errorf("Could not forward the ports of the pod: %v", err)
+		}
+		if forwardCmd != nil {
+			portForward = forwardCmd.Process
+		}
+		emitPortsReady(pairs)
+	}
+	if len(mounts) > 0 {
+		stopSync, err = watchAndSync(kubeSyncTarget(podName), mounts)
+		if err != nil {
+			return errors.Errorf("Could not watch the project for changes to sync: %v", err)
+		}
+	}
+
+	logsCmd, err := execAndListen("kubectl", kubectlArgs("logs", "-f", "pod/"+podName), Container)
+	if err != nil {
+		return errors.Errorf("Could not follow the logs of the pod: %v", err)
+	}
+	if dryrun {
+		Debug.log("Dry Run - Skipping execCmd.Wait")
+		return nil
+	}
+	if err = logsCmd.Wait(); err != nil {
+		return errors.Errorf("Error waiting in 'appsody %s --k8s' %v", mode, err)
+	}
+	return nil
+}
+
+// copyDirToPod copies the content of a local directory into a directory of the pod, leaving out .git
+func copyDirToPod(podName string, local string, target string) error {
+	if err := execAndWaitReturnErr("kubectl", kubectlArgs("exec", podName, "--", "mkdir", "-p", target), Debug); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(local)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		err = execAndWaitReturnErr("kubectl", kubectlArgs("cp", filepath.Join(local, entry.Name()), podName+":"+path.Join(target, entry.Name())), Debug)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
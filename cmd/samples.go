@@ -0,0 +1,99 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+)
+
+// listSamples returns the table of the sample applications of the latest version of each stack
+func (index *RepoIndex) listSamples() string {
+	if err := index.loadShards(""); err != nil {
+		Warning.log(err)
+	}
+	var keys []string
+	for key, versions := range index.Projects {
+		if len(versions) > 0 && len(versions[0].Samples) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "None of the stacks of the repositories have sample applications."
+	}
+	sort.Strings(keys)
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.AddRow("STACK", "SAMPLE", "DESCRIPTION")
+	for _, key := range keys {
+		for _, sample := range index.Projects[key][0].Samples {
+			table.AddRow(index.displayID(key), sample.Name, sample.Description)
+		}
+	}
+	return table.String()
+}
+
+// findSample returns the sample application of a stack with the name
+func (p *ProjectVersion) findSample(name string) (*StackSample, error) {
+	var names []string
+	for i := range p.Samples {
+		if p.Samples[i].Name == name {
+			return &p.Samples[i], nil
+		}
+		names = append(names, p.Samples[i].Name)
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("The %s stack has no sample applications.", p.Name)
+	}
+	return nil, errors.Errorf("The %s stack has no sample %q.%s Run `appsody list --samples` to see the samples.", p.Name, name, didYouMean(name, names))
+}
+
+// initFromSample extracts the sample application in the current directory. Samples that do not come
+// with their .appsody-config.yaml get the one of the default template of the stack.
+func initFromSample(projectType string, sample *StackSample, templateURL string) error {
+	Info.logf("Downloading the %s sample of the %s stack from %s", sample.Name, projectType, sample.URL)
+	filename := projectType + "-" + sample.Name + ".tar.gz"
+	if strings.HasSuffix(strings.ToLower(sample.URL), ".zip") {
+		filename = projectType + "-" + sample.Name + ".zip"
+	}
+	filename, err := downloadTemplateArchive(sample.URL, filename)
+	if err != nil {
+		return errors.Errorf("Error downloading the sample %v", err)
+	}
+	Info.log("Download complete. Extracting files from ", filepath.Base(filename))
+	errUntar := extractTemplate(filename, false)
+	if errUntar == nil {
+		recordScaffold(filename, sample.URL)
+	}
+	if dryrun {
+		planned(planDelete, filename, "downloaded sample")
+	} else if err := os.Remove(filename); err != nil {
+		Warning.log("Unable to remove temporary file ", filename)
+	}
+	if errUntar != nil {
+		Info.log("It is recommended that you run `appsody init <stack>` in an empty directory.")
+		Info.log("If you wish to proceed and overwrite files in the current directory, try again with the --overwrite option.")
+		return errors.Errorf("Error extracting the sample: %v", errUntar)
+	}
+	if _, err := os.Stat(".appsody-config.yaml"); err == nil {
+		return nil
+	}
+	return initTemplate(projectType, templateURL, true)
+}
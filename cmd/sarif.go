@@ -0,0 +1,135 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The SARIF 2.1.0 reports of stack ci, stack lint, repo validate and build --scan, which code scanning tools
+// such as GitHub code scanning show on the files they concern
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// The levels of the results
+const (
+	sarifError   = "error"
+	sarifWarning = "warning"
+	sarifNote    = "note"
+)
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// newSARIFReport returns the report of a run of an appsody command
+func newSARIFReport(command string, rules []sarifRule, results []sarifResult) sarifReport {
+	if rules == nil {
+		rules = []sarifRule{}
+	}
+	if results == nil {
+		results = []sarifResult{}
+	}
+	run := sarifRun{
+		Tool:    sarifTool{sarifDriver{Name: "appsody " + command, Version: VERSION, InformationURI: "https://appsody.dev", Rules: rules}},
+		Results: results,
+	}
+	return sarifReport{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}
+}
+
+// newSARIFResult returns a result of a rule on a file, or on a URL such as the one of a repository index
+func newSARIFResult(rule string, level string, message string, location string) sarifResult {
+	return sarifResult{
+		RuleID:    rule,
+		Level:     level,
+		Message:   sarifMessage{message},
+		Locations: []sarifLocation{{sarifPhysicalLocation{sarifArtifactLocation{sarifURI(location)}}}},
+	}
+}
+
+// sarifURI returns the URI of a location: the path of a file in the current directory relative to it, with
+// forward slashes, as code scanning tools find the files of the repository they scan
+func sarifURI(location string) string {
+	if strings.Contains(location, "://") || !filepath.IsAbs(location) {
+		return filepath.ToSlash(location)
+	}
+	if dir, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(realPath(dir), realPath(location)); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return fileURL(location)
+}
+
+// writeSARIF writes a SARIF report to a file
+func writeSARIF(report sarifReport, file string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
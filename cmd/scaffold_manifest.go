@@ -0,0 +1,106 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// scaffoldManifestFile records the files init laid down from the template of the stack, see appsody diff
+const scaffoldManifestFile = ".appsody-manifest.yaml"
+
+// scaffoldManifest is the scaffoldManifestFile of a project: the template its files come from, and the sha256
+// of each file as it was written. The files of the manifest are the ones the stack owns until they are changed.
+type scaffoldManifest struct {
+	APIVersion string    `yaml:"apiVersion"`
+	Created    time.Time `yaml:"created"`
+	CLIVersion string    `yaml:"cliVersion"`
+	// Stack is the stack image of the project when it was created
+	Stack    string `yaml:"stack,omitempty"`
+	Template string `yaml:"template"`
+	// Provenance is where the template comes from, also recorded in the NOTICE of the project
+	Provenance *templateProvenance `yaml:"provenance,omitempty"`
+	// Values are the key=value values the template was rendered with, given with --set
+	Values []string          `yaml:"values,omitempty"`
+	Files  map[string]string `yaml:"files"`
+}
+
+// newScaffoldManifest records the files of the archive as they were extracted in the current directory
+func newScaffoldManifest(archive string, templateURL string) (*scaffoldManifest, error) {
+	manifest := &scaffoldManifest{APIVersion: "v1", Created: time.Now().UTC(), CLIVersion: VERSION, Template: templateURL, Values: setValues, Files: map[string]string{}}
+	err := walkArchive(archive, func(entry archiveEntry) error {
+		name, err := safeArchivePath(entry.name)
+		if err != nil || entry.dir || filepath.ToSlash(name) == templateValuesFile {
+			return err
+		}
+		manifest.Files[filepath.ToSlash(name)], err = fileSha256(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// write writes the manifest in the current directory, with the stack of the project
+func (m *scaffoldManifest) write() error {
+	if config, err := loadProjectConfig("."); err == nil {
+		m.Stack = config.Platform
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(scaffoldManifestFile, data, 0644)
+}
+
+// recordScaffold writes the manifest of the files extracted from the archive. The project is usable without
+// it, so it only warns when it can not be written.
+func recordScaffold(archive string, templateURL string) {
+	provenance := newTemplateProvenance(archive, templateURL)
+	created := time.Now()
+	// the NOTICE is written first, a NOTICE of the template is recorded in the manifest with the attribution
+	writeTemplateNotice(provenance, created)
+	if dryrun {
+		planned(planWrite, scaffoldManifestFile, "the files laid down by the template")
+		return
+	}
+	manifest, err := newScaffoldManifest(archive, templateURL)
+	if manifest != nil {
+		manifest.Created, manifest.Provenance = created.UTC(), provenance
+	}
+	if err == nil {
+		err = manifest.write()
+	}
+	if err != nil {
+		Warning.log("Could not record the files of the template, appsody diff will not work in this project: ", err)
+	}
+}
+
+// readScaffoldManifest reads the manifest of the project in dir
+func readScaffoldManifest(dir string) (*scaffoldManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, scaffoldManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest scaffoldManifest
+	if err = yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
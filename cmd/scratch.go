@@ -0,0 +1,118 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each command keeps its temporary files, such as the extracted project of a build, in its own scratch
+// directory under <home>/tmp. The lock file of the directory names the process that owns it, so that
+// commands running in parallel on one machine never share files, and the scratch directories of
+// commands that crashed or were killed are removed when the next command starts.
+const (
+	scratchLockFile = ".lock"
+	// scratch directories of other machines sharing the home directory are only removed when this old
+	scratchMaxAge = 7 * 24 * time.Hour
+	// a scratch directory without its lock file yet is being created
+	scratchLockGrace = time.Minute
+)
+
+var scratchDirPath string
+
+func scratchRoot() string {
+	return filepath.Join(getStateDir(), "tmp")
+}
+
+// scratchDir returns the scratch directory of this command, creating it on first use
+func scratchDir() (string, error) {
+	if scratchDirPath != "" {
+		return scratchDirPath, nil
+	}
+	if err := os.MkdirAll(scratchRoot(), 0755); err != nil {
+		return "", err
+	}
+	dir, err := ioutil.TempDir(scratchRoot(), strconv.Itoa(os.Getpid())+"-")
+	if err != nil {
+		return "", err
+	}
+	host, _ := os.Hostname()
+	lock := fmt.Sprintf("%d\n%s\n", os.Getpid(), host)
+	if err = ioutil.WriteFile(filepath.Join(dir, scratchLockFile), []byte(lock), 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	Debug.log("Created the scratch directory ", dir)
+	scratchDirPath = dir
+	return dir, nil
+}
+
+// removeScratchDir removes the scratch directory of this command when it ends
+func removeScratchDir() {
+	if scratchDirPath == "" {
+		return
+	}
+	Debug.log("Removing the scratch directory ", scratchDirPath)
+	if err := os.RemoveAll(longPath(scratchDirPath)); err != nil {
+		Warning.log("Could not remove the scratch directory ", scratchDirPath, ": ", err)
+	}
+	scratchDirPath = ""
+}
+
+// scratchOwnerGone tells whether the process that locked a scratch directory has ended
+func scratchOwnerGone(dir string) bool {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, scratchLockFile))
+	if err != nil {
+		return time.Since(info.ModTime()) > scratchLockGrace
+	}
+	fields := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || len(fields) < 2 {
+		return true
+	}
+	if host, _ := os.Hostname(); fields[1] != host {
+		return time.Since(info.ModTime()) > scratchMaxAge
+	}
+	return !processAlive(pid)
+}
+
+// cleanScratchDirs is the startup janitor: it removes the scratch directories left by commands that ended
+// without removing theirs
+func cleanScratchDirs() {
+	entries, err := ioutil.ReadDir(scratchRoot())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(scratchRoot(), entry.Name())
+		if !entry.IsDir() || !scratchOwnerGone(dir) {
+			continue
+		}
+		Debug.log("Removing the scratch directory of an ended command ", dir)
+		if err := os.RemoveAll(longPath(dir)); err != nil {
+			Debug.log("Could not remove ", dir, ": ", err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var searchRepo string
+var searchKeywords []string
+
+// stackSearchResult is a stack matching a search, with the fields of the stack that match
+type stackSearchResult struct {
+	Repo        string   `json:"repo" yaml:"repo"`
+	ID          string   `json:"id" yaml:"id"`
+	Version     string   `json:"version" yaml:"version"`
+	Description string   `json:"description" yaml:"description"`
+	Keywords    []string `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Maintainers []string `json:"maintainers,omitempty" yaml:"maintainers,omitempty"`
+	Matched     []string `json:"matched,omitempty" yaml:"matched,omitempty"`
+	score       int
+}
+
+// The weights of the fields of a stack in the score of a search, the id is the strongest signal
+var searchFieldWeights = []struct {
+	field  string
+	weight int
+}{
+	{"id", 8},
+	{"keywords", 4},
+	{"name", 2},
+	{"description", 2},
+	{"maintainers", 1},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search [term]",
+	Short: "Search the stacks of the repositories",
+	Long: `This searches the stacks of every repository for the term: it matches the id, the name, the description, the
+keywords and the maintainers of the latest version of the stacks, ignoring case. The best matches, those whose id
+matches, are listed first.
+
+Use --repo to only search one repository, and --keyword to only list the stacks with a keyword, which can be
+repeated. Without a term, the stacks with the keywords are listed. Use -o json or -o yaml for a description tools
+can read.`,
+	Example: `  appsody search express
+  appsody search --keyword java --repo incubator
+  appsody search spring -o json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("Specify one search term, quote it if it has spaces")
+		}
+		if len(args) == 0 && len(searchKeywords) == 0 {
+			return errors.New("Specify the term to search, or --keyword")
+		}
+		if _, err := structuredOutput(); err != nil {
+			return err
+		}
+		if searchRepo != "" {
+			var repos RepositoryFile
+			if _, err := repos.getRepos(); err != nil {
+				return err
+			}
+			if !repos.Has(searchRepo) {
+				return errors.Errorf("There is no %s repository.%s Run `appsody repo list` to see the repositories.", searchRepo, didYouMean(searchRepo, repos.repoNames()))
+			}
+		}
+		var index RepoIndex
+		if err := index.getIndex(); err != nil {
+			return errors.Errorf("Could not read index: %v", err)
+		}
+		term := ""
+		if len(args) == 1 {
+			term = args[0]
+		}
+		results := index.searchStacks(term, searchKeywords, searchRepo)
+		switch outputFormat {
+		case "json":
+			if results == nil {
+				results = []stackSearchResult{}
+			}
+			data, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(results)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(data))
+		default:
+			if len(results) == 0 {
+				Info.log("No stack matches the search. Run `appsody list` to see the available stacks.")
+				return nil
+			}
+			table := uitable.New()
+			table.MaxColWidth = 60
+			table.AddRow("REPO", "ID", "VERSION", "DESCRIPTION")
+			for _, result := range results {
+				table.AddRow(result.Repo, result.ID, result.Version, result.Description)
+			}
+			Info.log("\n", table.String())
+		}
+		return nil
+	},
+}
+
+// searchStacks returns the stacks of the index matching the term, which have the keywords and are in the
+// repository, unless they are empty, best matches first
+func (index *RepoIndex) searchStacks(term string, keywords []string, repo string) []stackSearchResult {
+	if err := index.loadShards(""); err != nil {
+		Warning.log(err)
+	}
+	term = strings.ToLower(strings.TrimSpace(term))
+	var results []stackSearchResult
+	for key, versions := range index.Projects {
+		if len(versions) == 0 {
+			continue
+		}
+		stackRepo, id := splitStackKey(key)
+		if repo != "" && stackRepo != repo {
+			continue
+		}
+		stack := versions[0]
+		if !hasKeywords(stack.Keywords, keywords) {
+			continue
+		}
+		result := stackSearchResult{Repo: stackRepo, ID: id, Version: stack.Version, Description: stack.Description, Keywords: stack.Keywords, Maintainers: stack.Maintainers}
+		if term != "" {
+			fields := map[string][]string{
+				"id":          {id},
+				"keywords":    stack.Keywords,
+				"name":        {stack.Name},
+				"description": {stack.Description},
+				"maintainers": stack.Maintainers,
+			}
+			for _, field := range searchFieldWeights {
+				for _, value := range fields[field.field] {
+					if strings.Contains(strings.ToLower(value), term) {
+						result.Matched = append(result.Matched, field.field)
+						result.score += field.weight
+						break
+					}
+				}
+			}
+			if result.score == 0 {
+				continue
+			}
+			if id == term {
+				result.score += 8
+			}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		if results[i].ID != results[j].ID {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Repo < results[j].Repo
+	})
+	return results
+}
+
+// hasKeywords tells whether the stack keywords have every wanted keyword, ignoring case
+func hasKeywords(stackKeywords []string, wanted []string) bool {
+	for _, keyword := range wanted {
+		found := false
+		for _, stackKeyword := range stackKeywords {
+			if strings.EqualFold(stackKeyword, keyword) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.PersistentFlags().StringVar(&searchRepo, "repo", "", "Only search the stacks of this repository.")
+	searchCmd.PersistentFlags().StringArrayVar(&searchKeywords, "keyword", nil, "Only list the stacks with this keyword. Can be repeated.")
+}
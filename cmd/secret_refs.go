@@ -0,0 +1,375 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// secretProvider resolves the references of one kind, the part after "<provider>:" in a reference
+type secretProvider interface {
+	resolve(ref string) (string, error)
+}
+
+// envSecrets reads the secret from an environment variable of the CLI
+type envSecrets struct{}
+
+// fileSecrets reads the secret from a file, relative to the appsody home unless absolute
+type fileSecrets struct{}
+
+// helperSecrets asks a docker credential helper, the reference is HELPER:SERVER
+type helperSecrets struct{}
+
+// keychainSecrets asks the OS credential store, or the credentialStore of the CLI configuration,
+// for the secret it keeps under the reference
+type keychainSecrets struct{}
+
+// kubeSecrets reads the key of a Secret of the cluster, the reference is [NAMESPACE/]SECRET/KEY
+type kubeSecrets struct{}
+
+// sopsSecrets decrypts a file encrypted with SOPS, relative to the project directory unless absolute. The
+// reference is FILE, or FILE#PATH for a value of a YAML or JSON file, such as secrets/prod.yaml#db.password.
+type sopsSecrets struct{}
+
+// secretProviders are the providers of the references, by the name they are used with
+var secretProviders = map[string]secretProvider{
+	"env":      envSecrets{},
+	"file":     fileSecrets{},
+	"helper":   helperSecrets{},
+	"keychain": keychainSecrets{},
+	"kube":     kubeSecrets{},
+	"sops":     sopsSecrets{},
+}
+
+// secretRefPattern matches the ${secret:<provider>:<ref>} references in configuration values
+var secretRefPattern = regexp.MustCompile(`\$\{secret:([a-z]+):([^}]+)\}`)
+
+func (envSecrets) resolve(name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.Errorf("the environment variable %s is not set", name)
+	}
+	return secret, nil
+}
+
+func (fileSecrets) resolve(file string) (string, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(getHome(), file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (helperSecrets) resolve(ref string) (string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 {
+		return "", errors.Errorf("%q is not HELPER:SERVER", ref)
+	}
+	credential, err := credentialHelper(parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+	return credential.Secret, nil
+}
+
+func (keychainSecrets) resolve(key string) (string, error) {
+	helpers := osCredentialHelpers()
+	if configured := cliConfig.GetString("credentialStore"); configured != "" {
+		helpers = []string{configured}
+	}
+	for _, helper := range helpers {
+		if _, err := exec.LookPath("docker-credential-" + helper); err == nil {
+			credential, err := credentialHelper(helper, key)
+			if err != nil {
+				return "", err
+			}
+			return credential.Secret, nil
+		}
+	}
+	return "", errors.Errorf("no credential store holds %s: docker-credential-%s is not installed", key, strings.Join(helpers, " or docker-credential-"))
+}
+
+// splitKubeSecretRef returns the namespace, the Secret and the key of a kube reference. The namespace is empty
+// for the Secrets of the namespace of the kubectl commands.
+func splitKubeSecretRef(ref string) (string, string, string, error) {
+	parts := strings.Split(ref, "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", "", "", errors.Errorf("%q is not [NAMESPACE/]SECRET/KEY", ref)
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return "", parts[0], parts[1], nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", errors.Errorf("%q is not [NAMESPACE/]SECRET/KEY", ref)
+}
+
+func (kubeSecrets) resolve(ref string) (string, error) {
+	secretNamespace, name, key, err := splitKubeSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"get", "secret", name, "-o", "go-template={{index .data " + strconv.Quote(key) + "}}"}
+	if secretNamespace == "" {
+		secretNamespace = namespace
+	}
+	if secretNamespace != "" {
+		args = append(args, "--namespace", secretNamespace)
+	}
+	out, err := runtimeCommand("kubectl", kubectlConnArgs(args...)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", errors.Errorf("kubectl could not read the Secret %s: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	encoded := strings.TrimSpace(string(out))
+	if encoded == "" || encoded == "<no value>" {
+		return "", errors.Errorf("the Secret %s has no key %s", name, key)
+	}
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Errorf("the key %s of the Secret %s is not base64: %v", key, name, err)
+	}
+	return string(secret), nil
+}
+
+func (sopsSecrets) resolve(ref string) (string, error) {
+	file, path := ref, ""
+	if i := strings.Index(ref, "#"); i >= 0 {
+		file, path = ref[:i], ref[i+1:]
+	}
+	if !filepath.IsAbs(file) {
+		projectDir, err := getProjectDir()
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Join(projectDir, file)
+	}
+	if _, err := exec.LookPath("sops"); err != nil {
+		return "", errors.New("sops is not installed, see https://github.com/mozilla/sops")
+	}
+	args := []string{"--decrypt"}
+	if path != "" {
+		// sops extracts the value of a tree path, such as ["db"]["password"]
+		extract := ""
+		for _, key := range strings.Split(path, ".") {
+			extract += "[" + strconv.Quote(key) + "]"
+		}
+		args = append(args, "--extract", extract)
+	}
+	out, err := runtimeCommand("sops", append(args, file)...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", errors.Errorf("sops could not decrypt %s: %s", file, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// secretProviderNames lists the providers for the error messages
+func secretProviderNames() string {
+	var names []string
+	for name := range secretProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// hasSecretRefs tells whether the value refers to secrets
+func hasSecretRefs(value string) bool {
+	return secretRefPattern.MatchString(value)
+}
+
+// expandSecretRefs replaces the ${secret:<provider>:<ref>} references in the value with the secrets
+// they refer to, for example ${secret:env:DB_PASSWORD}, ${secret:file:secrets/db},
+// ${secret:keychain:appsody://db}, ${secret:kube:db-credentials/password} or
+// ${secret:sops:secrets/prod.yaml#db.password}. The rest of the value is kept as it is.
+func expandSecretRefs(value string) (string, error) {
+	var failure error
+	expanded := secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := secretRefPattern.FindStringSubmatch(ref)
+		provider, ok := secretProviders[match[1]]
+		if !ok {
+			if failure == nil {
+				failure = errors.Errorf("%s: there is no %s secret provider, use one of %s", ref, match[1], secretProviderNames())
+			}
+			return ""
+		}
+		secret, err := provider.resolve(match[2])
+		if err != nil && failure == nil {
+			failure = errors.Errorf("%s: %v", ref, err)
+		}
+		return secret
+	})
+	if failure != nil {
+		return "", failure
+	}
+	return expanded, nil
+}
+
+// envVariable is a variable of the env sections of the project configuration, with its secrets resolved
+type envVariable struct {
+	Name  string
+	Value string
+	// Secret is set when the value came from secret references, it is kept out of command lines and manifests
+	Secret bool
+	// SecretName and SecretKey are the Secret of the cluster and its key the variable is set from, for the
+	// ${secret:kube:SECRET/KEY} references of deploy. Value is empty then, the cluster resolves it.
+	SecretName string
+	SecretKey  string
+}
+
+// projectEnv resolves the env of the project configuration, with the env of the environment, if any,
+// overriding it, and checks it against the variables the stack declares. For deploy, the variables that are
+// only a ${secret:kube:SECRET/KEY} reference are not resolved: the service refers to the Secret of the
+// namespace it is deployed to, so each environment uses its own.
+func projectEnv(environment *Environment, deploying bool) ([]envVariable, error) {
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for name, value := range config.Env {
+		env[name] = value
+	}
+	if environment != nil {
+		for name, value := range environment.Env {
+			env[name] = value
+		}
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var variables []envVariable
+	for _, name := range names {
+		if deploying {
+			if match := secretRefPattern.FindStringSubmatch(env[name]); match != nil && match[0] == env[name] && match[1] == "kube" {
+				secretNamespace, secretName, key, err := splitKubeSecretRef(match[2])
+				if err != nil {
+					return nil, errors.Errorf("Could not resolve the %s variable of %s: %s: %v", name, ConfigFile, match[0], err)
+				}
+				// the Secrets of other namespaces can not be referred to, they are copied
+				if secretNamespace == "" {
+					variables = append(variables, envVariable{Name: name, Secret: true, SecretName: secretName, SecretKey: key})
+					continue
+				}
+			}
+		}
+		value, err := expandSecretRefs(env[name])
+		if err != nil {
+			return nil, errors.Errorf("Could not resolve the %s variable of %s: %v", name, ConfigFile, err)
+		}
+		variables = append(variables, envVariable{Name: name, Value: value, Secret: hasSecretRefs(env[name])})
+	}
+	if err := checkStackEnv(config.Platform, variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+// secretEnvArgs returns the docker run -e arguments of the variables. The secret values are not put on the
+// command line: they are set in the environment of the CLI, which docker run -e NAME passes on.
+func secretEnvArgs(variables []envVariable) []string {
+	var args []string
+	for _, variable := range variables {
+		if variable.Secret {
+			os.Setenv(variable.Name, variable.Value)
+			args = append(args, "-e", variable.Name)
+		} else {
+			args = append(args, "-e", variable.Name+"="+variable.Value)
+		}
+	}
+	return args
+}
+
+// deployAppEnv are the variables of the env sections being deployed, GenKnativeYaml sets them on the container
+var deployAppEnv []envVariable
+
+// envSecretName names the Secret that holds the secret variables of the service
+func envSecretName(serviceName string) string {
+	return serviceName + "-env"
+}
+
+// genEnvSecret returns the Secret with the secret variables
+func genEnvSecret(serviceName string, variables []envVariable) ([]byte, error) {
+	data := map[string]string{}
+	for _, variable := range variables {
+		if variable.Secret && variable.SecretName == "" {
+			data[variable.Name] = variable.Value
+		}
+	}
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":   envSecretName(serviceName),
+			"labels": managedLabels(serviceName),
+		},
+		"type":       "Opaque",
+		"stringData": data,
+	}
+	return yaml.Marshal(secret)
+}
+
+// writeEnvSecret writes the Secret of the secret variables in the scratch directory, readable only by the
+// user, and returns the file, or an empty string when no variable is secret
+func writeEnvSecret(serviceName string, variables []envVariable) (string, error) {
+	secrets := 0
+	for _, variable := range variables {
+		if variable.Secret && variable.SecretName == "" {
+			secrets++
+		}
+	}
+	if secrets == 0 {
+		return "", nil
+	}
+	scratch, err := scratchDir()
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(scratch, envSecretName(serviceName)+"-secret.yaml")
+	if dryrun {
+		planned(planWrite, file, "Secret of the environment variables")
+		return file, nil
+	}
+	manifest, err := genEnvSecret(serviceName, variables)
+	if err != nil {
+		return "", err
+	}
+	Debug.logf("Generated the %s Secret with %d variables", envSecretName(serviceName), secrets)
+	return file, ioutil.WriteFile(file, manifest, 0600)
+}
@@ -0,0 +1,210 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	cmd "github.com/appsody/appsody/cmd"
+	"gopkg.in/yaml.v2"
+)
+
+// useSecretProviders sets up a home with the secret file secrets/db, the DB_PASSWORD variable and a kubectl
+// stand-in with the password key of the db-credentials Secret. It returns the home and the function restoring
+// the environment.
+func useSecretProviders(t *testing.T) (string, func()) {
+	t.Helper()
+	_, home, cleanup := useTestHome(t, "", "apiVersion: v1\nrepositories: []\n")
+	if err := os.MkdirAll(filepath.Join(home, "secrets"), 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, "secrets", "db"), []byte("from-file\n"), 0600); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	// from-kube in base64, as kubectl prints the data of a Secret
+	kubectl := "#!/bin/sh\ncase \"$*\" in *'secret db-credentials'*'\"password\"'*) echo ZnJvbS1rdWJl;; *) echo 'secrets not found' >&2; exit 1;; esac\n"
+	if err := ioutil.WriteFile(filepath.Join(home, "kubectl"), []byte(kubectl), 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", home+string(os.PathListSeparator)+path)
+	os.Setenv("DB_PASSWORD", "from-env")
+	return home, func() {
+		os.Unsetenv("DB_PASSWORD")
+		os.Setenv("PATH", path)
+		cleanup()
+	}
+}
+
+var expandSecretRefsTests = []struct {
+	testName      string
+	value         string
+	expectedValue string
+	expectedError string
+}{
+	{"No reference", "postgres://db:5432", "postgres://db:5432", ""},
+	{"Env", "${secret:env:DB_PASSWORD}", "from-env", ""},
+	{"File", "${secret:file:secrets/db}", "from-file", ""},
+	{"Kube", "${secret:kube:db-credentials/password}", "from-kube", ""},
+	{"In a value", "postgres://app:${secret:env:DB_PASSWORD}@db:5432/${secret:file:secrets/db}", "postgres://app:from-env@db:5432/from-file", ""},
+	{"Unset variable", "${secret:env:NOT_SET}", "", "${secret:env:NOT_SET}: the environment variable NOT_SET is not set"},
+	{"Missing file", "${secret:file:secrets/none}", "", "${secret:file:secrets/none}: open"},
+	{"Missing key", "${secret:kube:db-credentials/user}", "", "kubectl could not read the Secret db-credentials: secrets not found"},
+	{"Unknown provider", "${secret:vault:db/password}", "", "there is no vault secret provider, use one of env, file, helper, keychain, kube, sops"},
+}
+
+func TestExpandSecretRefs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The kubectl stand-in is a shell script")
+	}
+	_, restore := useSecretProviders(t)
+	defer restore()
+	for _, tt := range expandSecretRefsTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			value, err := cmd.ExpandSecretRefs(tt.value)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected the error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != tt.expectedValue {
+				t.Errorf("Expected %q, got %q", tt.expectedValue, value)
+			}
+		})
+	}
+}
+
+var kubeSecretRefTests = []struct {
+	ref               string
+	expectedNamespace string
+	expectedSecret    string
+	expectedKey       string
+	expectedError     bool
+}{
+	{"db-credentials/password", "", "db-credentials", "password", false},
+	{"shared/db-credentials/password", "shared", "db-credentials", "password", false},
+	{"db-credentials", "", "", "", true},
+	{"db-credentials/", "", "", "", true},
+	{"a/b/c/d", "", "", "", true},
+}
+
+func TestSplitKubeSecretRef(t *testing.T) {
+	for _, tt := range kubeSecretRefTests {
+		t.Run(tt.ref, func(t *testing.T) {
+			secretNamespace, secret, key, err := cmd.SplitKubeSecretRef(tt.ref)
+
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("Expected an error: %v, got %v", tt.expectedError, err)
+			}
+			if secretNamespace != tt.expectedNamespace || secret != tt.expectedSecret || key != tt.expectedKey {
+				t.Errorf("Expected %q %q %q, got %q %q %q", tt.expectedNamespace, tt.expectedSecret, tt.expectedKey, secretNamespace, secret, key)
+			}
+		})
+	}
+}
+
+var projectEnvTests = []struct {
+	testName          string
+	environment       *cmd.Environment
+	deploying         bool
+	expectedVariables []cmd.EnvVariable
+}{
+	{"Run", nil, false, []cmd.EnvVariable{
+		{Name: "DB_PASSWORD", Value: "from-kube", Secret: true},
+		{Name: "DB_URL", Value: "postgres://db:5432"},
+		{Name: "SHARED", Value: "from-kube", Secret: true},
+	}},
+	// the service refers to the Secrets of its own namespace
+	{"Deploy", nil, true, []cmd.EnvVariable{
+		{Name: "DB_PASSWORD", Secret: true, SecretName: "db-credentials", SecretKey: "password"},
+		{Name: "DB_URL", Value: "postgres://db:5432"},
+		{Name: "SHARED", Value: "from-kube", Secret: true},
+	}},
+	{"Environment", &cmd.Environment{Env: map[string]string{"DB_PASSWORD": "${secret:env:DB_PASSWORD}", "LOG_LEVEL": "debug"}}, true, []cmd.EnvVariable{
+		{Name: "DB_PASSWORD", Value: "from-env", Secret: true},
+		{Name: "DB_URL", Value: "postgres://db:5432"},
+		{Name: "LOG_LEVEL", Value: "debug"},
+		{Name: "SHARED", Value: "from-kube", Secret: true},
+	}},
+}
+
+func TestProjectEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The kubectl stand-in is a shell script")
+	}
+	_, restore := useSecretProviders(t)
+	defer restore()
+	restoreConfig := cmd.UseProjectConfig(cmd.ProjectConfig{Env: map[string]string{
+		"DB_URL":      "postgres://db:5432",
+		"DB_PASSWORD": "${secret:kube:db-credentials/password}",
+		"SHARED":      "${secret:kube:shared/db-credentials/password}",
+	}})
+	defer restoreConfig()
+	for _, tt := range projectEnvTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			variables, err := cmd.ProjectEnv(tt.environment, tt.deploying)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(variables, tt.expectedVariables) {
+				t.Errorf("Expected the variables %+v, got %+v", tt.expectedVariables, variables)
+			}
+		})
+	}
+}
+
+func TestGenEnvSecret(t *testing.T) {
+	manifest, err := cmd.GenEnvSecret("shop", []cmd.EnvVariable{
+		{Name: "DB_URL", Value: "postgres://db:5432"},
+		{Name: "API_KEY", Value: "from-env", Secret: true},
+		{Name: "DB_PASSWORD", Secret: true, SecretName: "db-credentials", SecretKey: "password"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+		StringData map[string]string `yaml:"stringData"`
+	}
+	if err = yaml.Unmarshal(manifest, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if secret.Kind != "Secret" || secret.Metadata.Name != "shop-env" {
+		t.Errorf("Expected the shop-env Secret, got the %s %s", secret.Metadata.Name, secret.Kind)
+	}
+	// only the secrets the cluster does not already hold are in the Secret
+	if !reflect.DeepEqual(secret.StringData, map[string]string{"API_KEY": "from-env"}) {
+		t.Errorf("Expected only the API_KEY variable in the Secret, got %v", secret.StringData)
+	}
+}
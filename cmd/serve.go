@@ -0,0 +1,486 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var servePort int
+
+const serveTokenFile = "serve-token"
+
+// sessionCommands are the commands the API can start as sessions
+var sessionCommands = map[string]bool{"run": true, "debug": true, "test": true, "build": true, "deploy": true}
+
+// serveSession is a run, build or other long running command started through the API.
+// It runs the CLI itself with --json-events and keeps its events for the clients.
+type serveSession struct {
+	ID       string     `json:"id"`
+	Command  string     `json:"command"`
+	Args     []string   `json:"args"`
+	Dir      string     `json:"dir"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Running  bool       `json:"running"`
+	ExitCode int        `json:"exitCode"`
+	process  *os.Process
+	events   [][]byte
+	logs     bytes.Buffer
+	lock     sync.Mutex
+	updated  *sync.Cond
+}
+
+type sessionRequest struct {
+	Command string   `json:"command"`
+	Dir     string   `json:"dir"`
+	Args    []string `json:"args"`
+}
+
+type initRequest struct {
+	Dir        string `json:"dir"`
+	Stack      string `json:"stack"`
+	NoTemplate bool   `json:"noTemplate"`
+	Overwrite  bool   `json:"overwrite"`
+}
+
+type stackSummary struct {
+	ID            string   `json:"id"`
+	Version       string   `json:"version"`
+	Description   string   `json:"description"`
+	Architectures []string `json:"architectures,omitempty"`
+}
+
+type appsodyServer struct {
+	token    string
+	lock     sync.Mutex
+	sessions map[string]*serveSession
+	lastID   int
+	// webhookSecret signs the webhooks of the repository servers, which do not have the token
+	webhookSecret string
+	events        *serverEvents
+	refresher     *indexRefresher
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local REST API for IDE integrations",
+	Long: `This starts a long running server on localhost that IDE extensions can call instead of running the CLI for every action.
+Every request needs the header "Authorization: Bearer <token>", with the token written to serve-token in the Appsody home.
+
+  GET    /v1/stacks                  List the stacks of the configured repositories
+  POST   /v1/init                    Initialize a project: {"dir": "...", "stack": "nodejs", "noTemplate": false, "overwrite": false}
+  GET    /v1/sessions                List the run, debug, test, build and deploy sessions
+  POST   /v1/sessions                Start a session: {"command": "run", "dir": "...", "args": ["-p", "3001:3000"]}
+  GET    /v1/sessions/<id>           Show a session
+  GET    /v1/sessions/<id>/events    Stream the JSON events of a session, one per line, until it finishes
+  GET    /v1/sessions/<id>/logs      Show the log output of a session
+  DELETE /v1/sessions/<id>           Stop a session
+  GET    /v1/events                  Stream the events of the server, such as stack-updated, one JSON object per line
+  POST   /v1/webhooks/<repository>   Refresh the index of a repository now`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := newServeToken()
+		if err != nil {
+			return err
+		}
+		if servePoll < 0 {
+			return errors.New("The --poll interval can not be negative")
+		}
+		server := &appsodyServer{token: token, sessions: map[string]*serveSession{}, events: newServerEvents()}
+		server.refresher = newIndexRefresher(server.events)
+		if serveWebhookSecret != "" {
+			if server.webhookSecret, err = resolveSecretRef(serveWebhookSecret); err != nil {
+				return errors.Errorf("Could not resolve the webhook secret: %v", err)
+			}
+		}
+		address := net.JoinHostPort("127.0.0.1", strconv.Itoa(servePort))
+		if dryrun {
+			Info.log("Dry Run - Skipping serving the API on ", address)
+			return nil
+		}
+		// the server runs for days, so it always keeps a rotated log
+		if appLog == nil {
+			serveLog := filepath.Join(getStateDir(), "logs", "serve.log")
+			if err = openLogFile(serveLog); err != nil {
+				return err
+			}
+			Info.log("Logging to ", serveLog)
+		}
+		tokenFile := filepath.Join(getStateDir(), serveTokenFile)
+		if err = ioutil.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+			return errors.Errorf("Could not write the API token: %v", err)
+		}
+		defer os.Remove(tokenFile)
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return errors.Errorf("Could not listen on %s: %v", address, err)
+		}
+		Info.logf("Serving the Appsody API on http://%s, the token is in %s", listener.Addr(), tokenFile)
+		defer server.stopAll()
+		if servePoll > 0 {
+			go server.refresher.poll(servePoll)
+		}
+		// Ctrl-C and --timeout stop the sessions too, as the IDE stop button does
+		httpServer := &http.Server{Handler: server}
+		go func() {
+			<-cliContext().Done()
+			httpServer.Close()
+		}()
+		if err = httpServer.Serve(listener); err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	},
+}
+
+func newServeToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", errors.Errorf("Could not generate the API token: %v", err)
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (s *appsodyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the token keeps web pages open in a browser from driving the API
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 && !webhookRequest(r, s.webhookSecret) {
+		writeAPIError(w, http.StatusUnauthorized, errors.New("missing or wrong API token"))
+		return
+	}
+	Debug.log("API request ", r.Method, " ", r.URL.Path)
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "v1/stacks" && r.Method == http.MethodGet:
+		s.listStacks(w)
+	case path == "v1/init" && r.Method == http.MethodPost:
+		s.initProject(w, r)
+	case path == "v1/sessions" && r.Method == http.MethodGet:
+		writeAPIJSON(w, http.StatusOK, s.sessionList())
+	case path == "v1/sessions" && r.Method == http.MethodPost:
+		s.startSession(w, r)
+	case path == "v1/events" && r.Method == http.MethodGet:
+		s.events.stream(w, r)
+	case len(parts) == 3 && parts[0] == "v1" && parts[1] == "webhooks" && r.Method == http.MethodPost:
+		s.webhook(w, parts[2])
+	case len(parts) >= 3 && parts[0] == "v1" && parts[1] == "sessions":
+		session := s.session(parts[2])
+		if session == nil {
+			writeAPIError(w, http.StatusNotFound, errors.Errorf("no session %s", parts[2]))
+			return
+		}
+		s.sessionRequest(w, r, session, parts[3:])
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("no %s %s endpoint", r.Method, r.URL.Path))
+	}
+}
+
+func (s *appsodyServer) sessionRequest(w http.ResponseWriter, r *http.Request, session *serveSession, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		session.lock.Lock()
+		defer session.lock.Unlock()
+		writeAPIJSON(w, http.StatusOK, session)
+	case len(rest) == 0 && r.Method == http.MethodDelete:
+		session.stop()
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && rest[0] == "events" && r.Method == http.MethodGet:
+		session.streamEvents(w)
+	case len(rest) == 1 && rest[0] == "logs" && r.Method == http.MethodGet:
+		session.lock.Lock()
+		defer session.lock.Unlock()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(session.logs.Bytes())
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("no %s %s endpoint", r.Method, r.URL.Path))
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// listStacks reads the index of every repository, from the cache while it is fresh. Unlike getIndex it
+// reports a repository that cannot be read to the client instead of skipping it.
+func (s *appsodyServer) listStacks(w http.ResponseWriter) {
+	var repos RepositoryFile
+	if _, err := repos.getRepos(); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	stacks := []stackSummary{}
+	for _, repo := range repos.Repositories {
+		index, err := repo.readIndex()
+		if err == nil {
+			err = index.loadShards("")
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, errors.Errorf("could not read the index of the %s repository: %v", repo.Name, err))
+			return
+		}
+		for id, versions := range index.Projects {
+			if len(versions) == 0 {
+				continue
+			}
+			stacks = append(stacks, stackSummary{ID: id, Version: versions[0].Version, Description: versions[0].Description, Architectures: versions[0].Architectures})
+		}
+	}
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].ID < stacks[j].ID })
+	writeAPIJSON(w, http.StatusOK, stacks)
+}
+
+// initProject runs appsody init in the requested directory and waits for it
+func (s *appsodyServer) initProject(w http.ResponseWriter, r *http.Request) {
+	var request initRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.Errorf("could not decode the request: %v", err))
+		return
+	}
+	if !filepath.IsAbs(request.Dir) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("dir must be an absolute path"))
+		return
+	}
+	if err := os.MkdirAll(request.Dir, 0755); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	args := []string{"init"}
+	if request.Stack != "" {
+		args = append(args, request.Stack)
+	}
+	if request.NoTemplate {
+		args = append(args, "--no-template")
+	}
+	if request.Overwrite {
+		args = append(args, "--overwrite")
+	}
+	initCmd, err := selfCommand(request.Dir, args)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	out, err := initCmd.CombinedOutput()
+	result := map[string]interface{}{"dir": request.Dir, "output": string(out), "succeeded": err == nil}
+	if err != nil {
+		writeAPIJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+// selfCommand prepares a command running this CLI in dir, non-interactive and with the same configuration
+func selfCommand(dir string, args []string) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.Errorf("could not find the appsody executable: %v", err)
+	}
+	args = append(args, "--non-interactive")
+	if cfgFile != "" {
+		args = append(args, "--config", cfgFile)
+	}
+	selfCmd := exec.Command(executable, args...)
+	selfCmd.Dir = dir
+	return selfCmd, nil
+}
+
+func (s *appsodyServer) startSession(w http.ResponseWriter, r *http.Request) {
+	var request sessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, errors.Errorf("could not decode the request: %v", err))
+		return
+	}
+	if !sessionCommands[request.Command] {
+		writeAPIError(w, http.StatusBadRequest, errors.Errorf("command must be one of run, debug, test, build or deploy, not %q", request.Command))
+		return
+	}
+	if !filepath.IsAbs(request.Dir) {
+		writeAPIError(w, http.StatusBadRequest, errors.New("dir must be an absolute path"))
+		return
+	}
+	args := append([]string{request.Command}, request.Args...)
+	if request.Command == "run" || request.Command == "build" || request.Command == "deploy" {
+		args = append(args, "--json-events")
+	}
+	sessionCmd, err := selfCommand(request.Dir, args)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.lock.Lock()
+	s.lastID++
+	session := &serveSession{ID: strconv.Itoa(s.lastID), Command: request.Command, Args: request.Args, Dir: request.Dir}
+	s.sessions[session.ID] = session
+	s.lock.Unlock()
+	if err = session.start(sessionCmd); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	Info.logf("Started session %s: appsody %s in %s", session.ID, strings.Join(args, " "), request.Dir)
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	writeAPIJSON(w, http.StatusCreated, session)
+}
+
+func (s *appsodyServer) session(id string) *serveSession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sessions[id]
+}
+
+func (s *appsodyServer) sessionList() []*serveSession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list := []*serveSession{}
+	for _, session := range s.sessions {
+		list = append(list, session)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+func (s *appsodyServer) stopAll() {
+	for _, session := range s.sessionList() {
+		session.stop()
+	}
+}
+
+// start runs the session command, collecting its events from standard output and its logs from standard error
+func (session *serveSession) start(sessionCmd *exec.Cmd) error {
+	session.updated = sync.NewCond(&session.lock)
+	stdout, err := sessionCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	sessionCmd.Stderr = &sessionLogWriter{session}
+	session.Started = time.Now()
+	if err = sessionCmd.Start(); err != nil {
+		return errors.Errorf("could not start the session: %v", err)
+	}
+	session.process = sessionCmd.Process
+	session.Running = true
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			session.lock.Lock()
+			if json.Valid(line) {
+				session.events = append(session.events, line)
+			} else {
+				// test and debug do not have events, their output is kept with the logs
+				session.logs.Write(append(line, '\n'))
+			}
+			session.updated.Broadcast()
+			session.lock.Unlock()
+		}
+		waitErr := sessionCmd.Wait()
+		session.lock.Lock()
+		session.Running = false
+		finished := time.Now()
+		session.Finished = &finished
+		if exitErr, ok := waitErr.(*exec.ExitError); ok {
+			session.ExitCode = exitErr.ExitCode()
+		} else if waitErr != nil {
+			session.ExitCode = -1
+		}
+		session.updated.Broadcast()
+		session.lock.Unlock()
+		Info.logf("Session %s finished with exit code %d", session.ID, session.ExitCode)
+	}()
+	return nil
+}
+
+// stop interrupts the session, so run and debug stop their container as they do on Ctrl-C
+func (session *serveSession) stop() {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if session.Running && session.process != nil {
+		Info.log("Stopping session ", session.ID)
+		if err := session.process.Signal(os.Interrupt); err != nil {
+			_ = session.process.Kill()
+		}
+	}
+}
+
+// streamEvents writes the events of the session, then the new ones as they come, until the session finishes
+func (session *serveSession) streamEvents(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	sent := 0
+	for {
+		session.lock.Lock()
+		for sent == len(session.events) && session.Running {
+			session.updated.Wait()
+		}
+		pending := session.events[sent:]
+		running := session.Running
+		session.lock.Unlock()
+		for _, event := range pending {
+			if _, err := w.Write(append(event, '\n')); err != nil {
+				return
+			}
+		}
+		sent += len(pending)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !running {
+			return
+		}
+	}
+}
+
+type sessionLogWriter struct {
+	session *serveSession
+}
+
+func (l *sessionLogWriter) Write(data []byte) (int, error) {
+	l.session.lock.Lock()
+	defer l.session.lock.Unlock()
+	return l.session.logs.Write(data)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.PersistentFlags().IntVar(&servePort, "port", 4567, "Port to serve the API on. It only listens on localhost.")
+	serveCmd.PersistentFlags().DurationVar(&servePoll, "poll", 0, "Interval to download the indexes of the repositories again at, such as 5m, publishing the changes of their stacks. By default they are not polled.")
+	serveCmd.PersistentFlags().StringVar(&serveWebhookSecret, "webhook-secret", "", "Secret of the webhooks of the repository servers calling /v1/webhooks/<repository>, or a reference such as env:NAME.")
+}
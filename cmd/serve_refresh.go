@@ -0,0 +1,260 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// servePoll and serveWebhookSecret are the --poll and --webhook-secret options of serve
+var servePoll time.Duration
+var serveWebhookSecret string
+
+// eventStackUpdated is the event of /v1/events for a change of the stacks of a repository, with the change as
+// repo diff shows it
+const eventStackUpdated = "stack-updated"
+
+// maxServerEvents bounds the events the server keeps for the clients that are behind
+const maxServerEvents = 1000
+
+// maxWebhookBody bounds the payload of a webhook, which is only read to check its signature
+const maxWebhookBody = 1 << 20
+
+// serverEvents are the events of the server, streamed to the clients of /v1/events as they happen
+type serverEvents struct {
+	lock    sync.Mutex
+	updated *sync.Cond
+	events  [][]byte
+	// dropped is how many of the oldest events were dropped, so that the clients count the events the same
+	dropped int
+}
+
+func newServerEvents() *serverEvents {
+	events := &serverEvents{}
+	events.updated = sync.NewCond(&events.lock)
+	return events
+}
+
+// publish adds an event, in the format of the --json-events events
+func (e *serverEvents) publish(event string, fields map[string]interface{}) {
+	line := map[string]interface{}{}
+	for key, value := range fields {
+		line[key] = value
+	}
+	line["event"] = event
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(line)
+	if err != nil {
+		Warning.log("Could not encode the event: ", err)
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.events = append(e.events, data)
+	if len(e.events) > maxServerEvents {
+		e.dropped += len(e.events) - maxServerEvents
+		e.events = e.events[len(e.events)-maxServerEvents:]
+	}
+	e.updated.Broadcast()
+}
+
+// stream writes the events published after the client connected, until it disconnects
+func (e *serverEvents) stream(w http.ResponseWriter, r *http.Request) {
+	// the client may act once it gets the headers, the events published from then on are its own
+	e.lock.Lock()
+	next := e.dropped + len(e.events)
+	e.lock.Unlock()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	go func() {
+		<-r.Context().Done()
+		e.lock.Lock()
+		e.updated.Broadcast()
+		e.lock.Unlock()
+	}()
+	for {
+		e.lock.Lock()
+		for next == e.dropped+len(e.events) && r.Context().Err() == nil {
+			e.updated.Wait()
+		}
+		if next < e.dropped {
+			// the client was too slow for the dropped events
+			next = e.dropped
+		}
+		pending := e.events[next-e.dropped:]
+		e.lock.Unlock()
+		if r.Context().Err() != nil {
+			return
+		}
+		for _, event := range pending {
+			if _, err := w.Write(append(event, '\n')); err != nil {
+				return
+			}
+		}
+		next += len(pending)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// indexRefresher downloads the indexes of the repositories again, every --poll interval or on the webhooks of
+// their servers, keeps them in the index cache so that the commands and the API read fresh indexes, and
+// publishes the changes of their stacks
+type indexRefresher struct {
+	lock   sync.Mutex
+	known  map[string]*RepoIndex
+	events *serverEvents
+}
+
+func newIndexRefresher(events *serverEvents) *indexRefresher {
+	return &indexRefresher{known: map[string]*RepoIndex{}, events: events}
+}
+
+// refresh downloads the index of a repository with its shards, caches it, and publishes how its stacks changed
+// since it was last read. The first time, the changes are the ones since the index was cached.
+func (f *indexRefresher) refresh(repo *RepositoryEntry) error {
+	index, err := repo.downloadIndex()
+	if err == nil {
+		err = index.loadShards("")
+	}
+	if err != nil {
+		return errors.Errorf("Could not refresh the index of the %s repository: %v", repo.Name, err)
+	}
+	// the stacks of the shards are all in the index now
+	index.Shards = nil
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	previous, ok := f.known[repo.Name]
+	if !ok {
+		if previous, err = readCachedIndex(repo.Name); err != nil {
+			Debug.log(err)
+		}
+	}
+	f.known[repo.Name] = index
+	if err = cacheIndex(repo.Name, index); err != nil {
+		Warning.logf("Could not cache the index of the %s repository: %v", repo.Name, err)
+	}
+	if previous == nil {
+		return nil
+	}
+	for _, change := range diffIndexes(previous, index) {
+		fields := map[string]interface{}{"repository": repo.Name, "stack": change.Stack, "change": change.Change}
+		detail := change.Change
+		if change.From != "" {
+			fields["from"] = change.From
+			detail += " from " + change.From
+		}
+		if change.To != "" {
+			fields["to"] = change.To
+			detail += " to " + change.To
+		}
+		Info.logf("The %s stack of the %s repository changed: %s", change.Stack, repo.Name, detail)
+		f.events.publish(eventStackUpdated, fields)
+	}
+	return nil
+}
+
+// refreshAll refreshes the index of every repository, warning about the ones that can not be read
+func (f *indexRefresher) refreshAll() {
+	var repos RepositoryFile
+	if _, err := repos.getRepos(); err != nil {
+		Warning.log(err)
+		return
+	}
+	for _, repo := range repos.Repositories {
+		if cliContext().Err() != nil {
+			return
+		}
+		if err := f.refresh(repo); err != nil {
+			Warning.log(err)
+		}
+	}
+}
+
+// poll refreshes the indexes every interval until the server stops
+func (f *indexRefresher) poll(interval time.Duration) {
+	Info.logf("Refreshing the indexes of the repositories every %s", interval)
+	f.refreshAll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cliContext().Done():
+			return
+		case <-ticker.C:
+			f.refreshAll()
+		}
+	}
+}
+
+// webhookRequest tells whether the request is a webhook of a repository server, signed with the webhook
+// secret: X-Hub-Signature-256 for GitHub and Gitea, X-Gitlab-Token for GitLab
+func webhookRequest(r *http.Request, secret string) bool {
+	if secret == "" || r.Method != http.MethodPost || !strings.HasPrefix(strings.Trim(r.URL.Path, "/"), "v1/webhooks/") {
+		return false
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if signature == "" {
+		return false
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxWebhookBody))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) == 1
+}
+
+// webhook refreshes the index of a repository in the background, answering the server of the repository at once
+func (s *appsodyServer) webhook(w http.ResponseWriter, repoName string) {
+	var repos RepositoryFile
+	if _, err := repos.getRepos(); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	repo := repos.getRepo(repoName)
+	if repo == nil {
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("no %s repository", repoName))
+		return
+	}
+	Info.logf("Refreshing the index of the %s repository on a webhook", repoName)
+	go func() {
+		if err := s.refresher.refresh(repo); err != nil {
+			Warning.log(err)
+		}
+	}()
+	writeAPIJSON(w, http.StatusAccepted, map[string]string{"repository": repoName})
+}
@@ -0,0 +1,167 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+const (
+	serveToken         = "the-token"
+	serveWebhookSecret = "the-secret"
+	serveWebhookBody   = `{"ref": "refs/heads/master"}`
+)
+
+// serveWebhookSignature is the X-Hub-Signature-256 GitHub sends with the webhook body
+func serveWebhookSignature(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(serveWebhookBody))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var serveTests = []struct {
+	testName string
+	method   string
+	path     string
+	headers  map[string]string // Authorization: Bearer the-token unless set
+	body     string
+	status   int
+	response string // expected in the response
+}{
+	{"No token", "GET", "/v1/stacks", map[string]string{"Authorization": ""}, "", http.StatusUnauthorized, "missing or wrong API token"},
+	{"Wrong token", "GET", "/v1/stacks", map[string]string{"Authorization": "Bearer other"}, "", http.StatusUnauthorized, "missing or wrong API token"},
+	{"Stacks", "GET", "/v1/stacks", nil, "", http.StatusOK, `{"id":"java-microprofile","version":"0.2.0"`},
+	{"No sessions", "GET", "/v1/sessions", nil, "", http.StatusOK, "[]"},
+	{"Unknown session", "GET", "/v1/sessions/7", nil, "", http.StatusNotFound, "no session 7"},
+	{"Unknown endpoint", "GET", "/v1/projects", nil, "", http.StatusNotFound, "no GET /v1/projects endpoint"},
+	{"Wrong method", "PUT", "/v1/stacks", nil, "", http.StatusNotFound, "no PUT /v1/stacks endpoint"},
+	{"Unknown command", "POST", "/v1/sessions", nil, `{"command": "stop", "dir": "/tmp"}`, http.StatusBadRequest, `not \"stop\"`},
+	{"Relative session dir", "POST", "/v1/sessions", nil, `{"command": "run", "dir": "project"}`, http.StatusBadRequest, "dir must be an absolute path"},
+	{"Bad session request", "POST", "/v1/sessions", nil, `{"command": `, http.StatusBadRequest, "could not decode the request"},
+	{"Relative init dir", "POST", "/v1/init", nil, `{"dir": "project", "stack": "nodejs"}`, http.StatusBadRequest, "dir must be an absolute path"},
+	{"GitLab webhook", "POST", "/v1/webhooks/local", map[string]string{"Authorization": "", "X-Gitlab-Token": serveWebhookSecret}, serveWebhookBody, http.StatusAccepted, `"repository":"local"`},
+	{"GitHub webhook", "POST", "/v1/webhooks/local", map[string]string{"Authorization": "", "X-Hub-Signature-256": serveWebhookSignature(serveWebhookSecret)}, serveWebhookBody, http.StatusAccepted, `"repository":"local"`},
+	{"Wrong webhook secret", "POST", "/v1/webhooks/local", map[string]string{"Authorization": "", "X-Hub-Signature-256": serveWebhookSignature("other")}, serveWebhookBody, http.StatusUnauthorized, "missing or wrong API token"},
+	// the webhook secret only opens the webhooks
+	{"Webhook secret elsewhere", "GET", "/v1/stacks", map[string]string{"Authorization": "", "X-Gitlab-Token": serveWebhookSecret}, "", http.StatusUnauthorized, "missing or wrong API token"},
+	{"Unknown repository webhook", "POST", "/v1/webhooks/other", nil, serveWebhookBody, http.StatusNotFound, "no other repository"},
+}
+
+func TestServe(t *testing.T) {
+	index, err := filepath.Abs("testdata/index.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, cleanup := useTestHome(t, "", "apiVersion: v1\nrepositories:\n- name: local\n  url: file://"+filepath.ToSlash(index)+"\n")
+	defer cleanup()
+	handler := cmd.NewServeHandler(serveToken, serveWebhookSecret)
+
+	for _, tt := range serveTests {
+		t.Run(tt.testName, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.Header.Set("Authorization", "Bearer "+serveToken)
+			for name, value := range tt.headers {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.status {
+				t.Errorf("Expected the status %d, got %d: %s", tt.status, recorder.Code, recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), tt.response) {
+				t.Errorf("Expected %s in the response, got %s", tt.response, recorder.Body.String())
+			}
+		})
+	}
+}
+
+const serveStackIndex = `apiVersion: v1
+projects:
+  nodejs:
+  - description: Node.js Runtime
+    name: nodejs
+    version: VERSION
+    urls:
+    - https://stacks.example.com/nodejs.tar.gz
+`
+
+// TestServeStackUpdates refreshes a repository on a webhook, and streams the change of its stack to the clients
+// of /v1/events
+func TestServeStackUpdates(t *testing.T) {
+	_, home, cleanup := useTestHome(t, "", "")
+	defer cleanup()
+	indexFile := filepath.Join(home, "index.yaml")
+	writeIndex := func(version string) {
+		if err := ioutil.WriteFile(indexFile, []byte(strings.Replace(serveStackIndex, "VERSION", version, 1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIndex("0.2.0")
+	repo := &cmd.RepositoryEntry{Name: "local", URL: "file://" + filepath.ToSlash(indexFile)}
+	writeRepoFile(t, home, "apiVersion: v1\nrepositories:\n- name: local\n  url: "+repo.URL+"\n")
+	// the index the commands read is cached, the webhook publishes how the stacks changed since
+	if _, err := repo.ReadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	writeIndex("0.3.0")
+	server := httptest.NewServer(cmd.NewServeHandler(serveToken, serveWebhookSecret))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/v1/events", nil)
+	request.Header.Set("Authorization", "Bearer "+serveToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	webhook, _ := http.NewRequest("POST", server.URL+"/v1/webhooks/local", strings.NewReader(serveWebhookBody))
+	webhook.Header.Set("X-Gitlab-Token", serveWebhookSecret)
+	response, err := http.DefaultClient.Do(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the webhook to be accepted, got %s", response.Status)
+	}
+
+	line, err := bufio.NewReader(events.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Expected a stack-updated event: %v", err)
+	}
+	var event map[string]interface{}
+	if err = json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["event"] != "stack-updated" || event["repository"] != "local" || event["stack"] != "nodejs" || event["from"] != "0.2.0" || event["to"] != "0.3.0" {
+		t.Errorf("Expected the nodejs stack to be updated from 0.2.0 to 0.3.0, got %s", line)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceDependency is a container the project needs while it runs, such as a database or a message broker.
+// They are declared in the services section of .appsody-config.yaml:
+//
+//   services:
+//   - name: db
+//     image: postgres:14
+//     env:
+//       POSTGRES_PASSWORD: appsody
+type ServiceDependency struct {
+	Name  string            `yaml:"name"`
+	Image string            `yaml:"image"`
+	Port  int               `yaml:"port,omitempty"`
+	Env   map[string]string `yaml:"env,omitempty"`
+}
+
+type wellKnownService struct {
+	port   int
+	scheme string
+}
+
+// wellKnownServices provides the default port and URL scheme of common images, keyed by image name
+var wellKnownServices = map[string]wellKnownService{
+	"postgres": {5432, "postgresql"},
+	"mysql":    {3306, "mysql"},
+	"mariadb":  {3306, "mysql"},
+	"mongo":    {27017, "mongodb"},
+	"redis":    {6379, "redis"},
+	"rabbitmq": {5672, "amqp"},
+	"kafka":    {9092, ""},
+	"cp-kafka": {9092, ""},
+}
+
+var nonEnvChars = regexp.MustCompile("[^A-Z0-9_]")
+
+// imageBaseName returns the name of an image without its registry, namespace or tag: bitnami/kafka:2 is kafka
+func imageBaseName(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func (s ServiceDependency) serviceName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return imageBaseName(s.Image)
+}
+
+func (s ServiceDependency) containerName(projectName string) string {
+	return projectName + "-" + s.serviceName()
+}
+
+func (s ServiceDependency) port() int {
+	if s.Port != 0 {
+		return s.Port
+	}
+	return wellKnownServices[imageBaseName(s.Image)].port
+}
+
+// connectionEnv returns the environment variables that tell the application how to reach the service:
+// <NAME>_HOST, <NAME>_PORT and, for well known images, <NAME>_URL
+func (s ServiceDependency) connectionEnv() []string {
+	prefix := nonEnvChars.ReplaceAllString(strings.ToUpper(s.serviceName()), "_")
+	host := s.serviceName()
+	env := []string{prefix + "_HOST=" + host}
+	if port := s.port(); port != 0 {
+		env = append(env, fmt.Sprintf("%s_PORT=%d", prefix, port))
+		if scheme := wellKnownServices[imageBaseName(s.Image)].scheme; scheme != "" {
+			env = append(env, fmt.Sprintf("%s_URL=%s://%s:%d", prefix, scheme, host, port))
+		}
+	}
+	return env
+}
+
+func servicesNetworkName(projectName string) string {
+	return projectName + "-network"
+}
+
+func dockerContainerRunning(name string) bool {
+	out, err := runtimeCommand("docker", "ps", "-q", "--filter", "name=^/"+name+"$").Output()
+	return err == nil && strings.TrimSpace(string(out)) != ""
+}
+
+func dockerNetworkExists(name string) bool {
+	return runtimeCommand("docker", "network", "inspect", name).Run() == nil
+}
+
+// startServices starts the service dependencies of the project on the given network, creating it if needed,
+// and returns the docker run arguments that pass their connection details to the application container
+func startServices(projectName string, services []ServiceDependency, network string) ([]string, error) {
+	if dryrun || !dockerNetworkExists(network) {
+		Info.log("Creating network ", network, " for the project services")
+		if err := execAndWaitReturnErr("docker", []string{"network", "create", "--label", devProjectLabel + "=" + projectName, network}, Debug); err != nil {
+			return nil, errors.Errorf("Could not create the %s network: %v", network, err)
+		}
+	}
+	var envArgs []string
+	for _, service := range services {
+		if service.Image == "" {
+			return nil, errors.Errorf("The service %s in %s does not specify an image", service.Name, ConfigFile)
+		}
+		name := service.containerName(projectName)
+		if !dryrun && dockerContainerRunning(name) {
+			Info.logf("Service %s is already running", service.serviceName())
+		} else {
+			Info.logf("Starting service %s (%s)", service.serviceName(), service.Image)
+			if err := dockerPullImage(service.Image); err != nil {
+				return nil, err
+			}
+			args := []string{"run", "-d", "--rm", "--name", name, "--network", network, "--network-alias", service.serviceName(), "--label", devProjectLabel + "=" + projectName}
+			keys := make([]string, 0, len(service.Env))
+			for key := range service.Env {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			var env []envVariable
+			for _, key := range keys {
+				value, err := expandSecretRefs(service.Env[key])
+				if err != nil {
+					return nil, errors.Errorf("Could not resolve the %s variable of the service %s: %v", key, service.serviceName(), err)
+				}
+				env = append(env, envVariable{Name: key, Value: value, Secret: hasSecretRefs(service.Env[key])})
+			}
+			args = append(args, secretEnvArgs(env)...)
+			args = append(args, service.Image)
+			if err := execAndWaitReturnErr("docker", args, Debug); err != nil {
+				return nil, errors.Errorf("Could not start the service %s: %v", service.serviceName(), err)
+			}
+		}
+		for _, env := range service.connectionEnv() {
+			envArgs = append(envArgs, "-e", env)
+		}
+	}
+	return envArgs, nil
+}
+
+// projectNetworks returns the networks startServices created for the project, the ones with its label
+func projectNetworks(projectName string) []string {
+	out, err := runtimeCommand("docker", "network", "ls", "--filter", "label="+devProjectLabel+"="+projectName, "--format", "{{.Name}}").Output()
+	if err != nil {
+		Debug.log("Could not list the networks of the project: ", err)
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// createdNetwork tells whether startServices created the network for the project, rather than the user
+func createdNetwork(network string, projectName string) bool {
+	out, err := runtimeCommand("docker", "network", "inspect", "--format", "{{index .Labels \""+devProjectLabel+"\"}}", network).Output()
+	return err == nil && strings.TrimSpace(string(out)) == projectName
+}
+
+// stopServices stops the service dependencies of the project and removes the network startServices created
+// for them: the given one, or the ones of the project when no network is given. The networks of the user,
+// passed with --network, are kept.
+func stopServices(projectName string, services []ServiceDependency, network string) {
+	for _, service := range services {
+		name := service.containerName(projectName)
+		if dryrun || dockerContainerRunning(name) {
+			Info.logf("Stopping service %s", service.serviceName())
+			if err := dockerStop(name); err != nil {
+				Warning.logf("Could not stop the service %s: %v", service.serviceName(), err)
+			}
+		}
+	}
+	var networks []string
+	if network == "" {
+		networks = projectNetworks(projectName)
+	} else if createdNetwork(network, projectName) || dryrun && !dockerNetworkExists(network) {
+		// with --dryrun, the network startServices would have created is removed
+		networks = []string{network}
+	} else {
+		Debug.logf("Keeping the %s network, it was not created for the services", network)
+	}
+	for _, network := range networks {
+		if err := execAndWaitReturnErr("docker", []string{"network", "rm", network}, Debug); err != nil {
+			Warning.logf("Could not remove the %s network: %v", network, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var envShell string
+var envUnset bool
+
+// The shells appsody env writes for
+const (
+	envShellPosix      = "posix"
+	envShellFish       = "fish"
+	envShellPowershell = "powershell"
+)
+
+// portLine is a line of docker port, such as 3000/tcp -> 0.0.0.0:3000
+var portLine = regexp.MustCompile(`^(\d+)/(tcp|udp) -> (.+):(\d+)$`)
+
+// shellVariable is a variable appsody env exports
+type shellVariable struct {
+	Name  string
+	Value string
+}
+
+// projectEnvVariables resolves what appsody knows of the project: its container, the ports docker published,
+// the URL of the application and of its deployed service, its image and the namespace it is deployed to. The
+// variables of what is not known, such as the ports of a container that does not run, are left out.
+func projectEnvVariables() ([]shellVariable, error) {
+	projectDir, err := getProjectDir()
+	if err != nil {
+		return nil, err
+	}
+	projectName, err := getProjectName()
+	if err != nil {
+		return nil, err
+	}
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	state := readProjectState(projectName)
+	variables := []shellVariable{
+		{"APPSODY_PROJECT_NAME", projectName},
+		{"APPSODY_PROJECT_DIR", projectDir},
+		{"APPSODY_STACK", config.Platform},
+		{"APPSODY_CONTAINER_NAME", containerName},
+	}
+
+	out, err := runtimeCommand("docker", "port", containerName).Output()
+	if err != nil {
+		Debug.log("The container ", containerName, " does not run: ", err)
+	} else {
+		appPort := containerEnv(containerName)["PORT"]
+		var ports []shellVariable
+		url := ""
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			match := portLine.FindStringSubmatch(strings.TrimSpace(line))
+			// the IPv6 mapping of a port that is also published on IPv4 is the same host port
+			if match == nil || strings.HasPrefix(match[3], "[") {
+				continue
+			}
+			name := "APPSODY_PORT_" + match[1]
+			if match[2] == "udp" {
+				name += "_UDP"
+			}
+			ports = append(ports, shellVariable{name, match[4]})
+			if match[1] == appPort && match[2] == "tcp" && url == "" {
+				url = "http://" + hostPort(reachableHost(match[3]), match[4])
+			}
+		}
+		sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+		variables = append(variables, ports...)
+		if url != "" {
+			variables = append(variables, shellVariable{"APPSODY_URL", url})
+		}
+	}
+
+	image := ""
+	if state.LastBuild != nil {
+		image = state.LastBuild.Image
+	}
+	if state.LastDeploy != nil {
+		image = state.LastDeploy.Image
+		if url := strings.Trim(strings.TrimSpace(state.LastDeploy.URL), `"`); url != "" {
+			variables = append(variables, shellVariable{"APPSODY_SERVICE_URL", url})
+		}
+	}
+	if image != "" {
+		registry, _, _ := imageReference(image)
+		variables = append(variables, shellVariable{"APPSODY_IMAGE", image}, shellVariable{"APPSODY_REGISTRY", registry})
+	}
+	ns := namespace
+	if ns == "" && state.LastDeploy != nil {
+		ns = state.LastDeploy.Namespace
+	}
+	if ns == "" {
+		ns = currentNamespace()
+	}
+	variables = append(variables, shellVariable{"APPSODY_NAMESPACE", ns})
+	return variables, nil
+}
+
+// containerEnv returns the environment of a container, which has the PORT of the application. The stack image is
+// not inspected, as it may have to be pulled first.
+func containerEnv(container string) map[string]string {
+	env := map[string]string{}
+	out, err := runtimeCommand("docker", "inspect", "--format", "{{json .Config.Env}}", container).Output()
+	if err != nil {
+		Debug.log("Could not inspect the container ", container, ": ", err)
+		return env
+	}
+	var variables []string
+	if err = json.Unmarshal(out, &variables); err != nil {
+		Debug.log("Could not read the environment of the container ", container, ": ", err)
+		return env
+	}
+	for _, variable := range variables {
+		if parts := strings.SplitN(variable, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
+
+// defaultEnvShell is the shell of $SHELL, or PowerShell on Windows
+func defaultEnvShell() string {
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "fish":
+		return envShellFish
+	case "":
+		if os.PathSeparator == '\\' {
+			return envShellPowershell
+		}
+	}
+	return envShellPosix
+}
+
+// envLine is the line setting, or unsetting, a variable in the shell
+func envLine(shell string, variable shellVariable, unset bool) string {
+	switch shell {
+	case envShellFish:
+		if unset {
+			return "set -e " + variable.Name + ";"
+		}
+		return fmt.Sprintf("set -gx %s '%s';", variable.Name, strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(variable.Value))
+	case envShellPowershell:
+		if unset {
+			return "Remove-Item Env:\\" + variable.Name
+		}
+		return fmt.Sprintf("$Env:%s = '%s'", variable.Name, strings.Replace(variable.Value, "'", "''", -1))
+	}
+	if unset {
+		return "unset " + variable.Name
+	}
+	return "export " + variable.Name + "=" + shellQuote(variable.Value)
+}
+
+// envUsage is the comment at the end of the output, telling how to load it
+func envUsage(shell string) string {
+	args := ""
+	if envUnset {
+		args = " --unset"
+	}
+	switch shell {
+	case envShellFish:
+		return "# Run this command to configure your shell:\n# eval (appsody env" + args + " --shell fish)"
+	case envShellPowershell:
+		return "# Run this command to configure your shell:\n# & appsody env" + args + " --shell powershell | Invoke-Expression"
+	}
+	return "# Run this command to configure your shell:\n# eval \"$(appsody env" + args + ")\""
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Print the settings of your Appsody project as shell variables",
+	Long: `This prints the settings appsody resolved for the project, such as APPSODY_PROJECT_NAME, APPSODY_STACK, APPSODY_URL
+and APPSODY_IMAGE, as commands that set them in your shell. Load them with eval "$(appsody env)".`,
+	Example: `  eval "$(appsody env)"
+  curl "$APPSODY_URL/health"
+
+  # in a Makefile
+  include .appsody.env
+  .appsody.env:
+  	appsody env > $@`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := envShell
+		if shell == "" {
+			shell = defaultEnvShell()
+		}
+		if shell == "bash" || shell == "zsh" || shell == "sh" {
+			shell = envShellPosix
+		}
+		if shell != envShellPosix && shell != envShellFish && shell != envShellPowershell {
+			return errors.Errorf("Unknown shell %q, use bash, zsh, sh, fish or powershell", envShell)
+		}
+		variables, err := projectEnvVariables()
+		if err != nil {
+			return err
+		}
+		for _, variable := range variables {
+			fmt.Println(envLine(shell, variable, envUnset))
+		}
+		fmt.Println(envUsage(shell))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	addNameFlags(envCmd)
+	envCmd.PersistentFlags().StringVar(&envShell, "shell", "", "Shell to print the commands for: bash, zsh, sh, fish or powershell. By default the one of $SHELL.")
+	envCmd.PersistentFlags().BoolVarP(&envUnset, "unset", "u", false, "Print the commands removing the variables instead.")
+	envCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Kubernetes namespace of the project. By default the one of the last deploy, or of the current kubectl context.")
+}
@@ -0,0 +1,69 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// showCommands is the --show-commands option
+var showCommands bool
+
+// shellSafe matches the arguments that need no quoting in a POSIX shell
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes an argument for a POSIX shell
+func shellQuote(arg string) string {
+	if shellSafe.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// commandLine returns a command as it can be pasted in a shell
+func commandLine(name string, args []string) string {
+	quoted := []string{shellQuote(name)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// showCommand prints a command line with --show-commands, whether it is run or skipped by --dryrun
+func showCommand(line string) {
+	if showCommands {
+		Info.log("+ ", line)
+	}
+}
+
+// runtimeCommand returns the docker, podman or kubectl command to run, printing it first with
+// --show-commands so that it can be checked or run by hand where the CLI can not run. The docker commands run
+// with the container runtime of getContainerRuntime.
+func runtimeCommand(name string, args ...string) *exec.Cmd {
+	if name == runtimeDocker {
+		name = getContainerRuntime().Command
+	}
+	showCommand(commandLine(name, args))
+	if fixture := fixtureCommand(name, args); fixture != nil {
+		return fixture
+	}
+	return exec.CommandContext(cliContext(), name, args...)
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&showCommands, "show-commands", false, "Print the docker, podman and kubectl commands with their arguments as they are run, or as they would be with --dryrun.")
+}
@@ -0,0 +1,101 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var signImage bool
+var verifyImage bool
+
+// signKey and verifyKey are the cosign private and public key files. Without them, images are signed
+// and verified keyless.
+var signKey string
+var verifyKey string
+var certificateIdentity string
+var certificateIssuer string
+
+func checkCosign() error {
+	if _, err := exec.LookPath("cosign"); err != nil && !dryrun {
+		return errors.New("cosign is required to sign and verify images, see https://github.com/sigstore/cosign")
+	}
+	return nil
+}
+
+// cosignSign signs an image that was pushed to a registry
+func cosignSign(image string) error {
+	if err := checkCosign(); err != nil {
+		return err
+	}
+	args := []string{"sign", "--yes"}
+	if signKey != "" {
+		args = append(args, "--key", signKey)
+	}
+	Info.log("Signing the image ", image)
+	return execAndWaitReturnErr("cosign", append(args, image), Debug)
+}
+
+// cosignVerify checks the signature of an image, with the key file or, keyless, with the identity
+// of the signer and the issuer of its certificate
+func cosignVerify(image string) error {
+	if err := checkCosign(); err != nil {
+		return err
+	}
+	args := []string{"verify"}
+	if verifyKey != "" {
+		args = append(args, "--key", verifyKey)
+	} else {
+		if certificateIdentity == "" || certificateIssuer == "" {
+			return errors.New("Keyless verification needs --certificate-identity and --certificate-oidc-issuer, or use --key")
+		}
+		args = append(args, "--certificate-identity", certificateIdentity, "--certificate-oidc-issuer", certificateIssuer)
+	}
+	Info.log("Verifying the signature of the image ", image)
+	if err := execAndWaitReturnErr("cosign", append(args, image), Debug); err != nil {
+		return errors.Errorf("The signature of %s could not be verified: %v", image, err)
+	}
+	if !dryrun {
+		Info.log("The signature of ", image, " is valid")
+	}
+	return nil
+}
+
+var verifyImageCmd = &cobra.Command{
+	Use:   "verify-image <image>",
+	Short: "Verify the signature of an image before it is deployed",
+	Long: `This checks the cosign signature of an image in a registry, such as one built with 'appsody build --sign'.
+Use --key to verify with a public key, or --certificate-identity and --certificate-oidc-issuer for an image signed keyless.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Specify the image to verify")
+		}
+		return cosignVerify(args[0])
+	},
+}
+
+func addVerifyFlags(cmd *cobra.Command, keyFlag string) {
+	cmd.PersistentFlags().StringVar(&verifyKey, keyFlag, "", "Cosign public key file to verify the signature with.")
+	cmd.PersistentFlags().StringVar(&certificateIdentity, "certificate-identity", "", "Identity, such as an email address, expected in the certificate of a keyless signature.")
+	cmd.PersistentFlags().StringVar(&certificateIssuer, "certificate-oidc-issuer", "", "OIDC issuer expected in the certificate of a keyless signature.")
+}
+
+func init() {
+	rootCmd.AddCommand(verifyImageCmd)
+	addVerifyFlags(verifyImageCmd, "key")
+}
@@ -0,0 +1,292 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// StackYaml is the stack.yaml file found at the root of every stack source directory
+type StackYaml struct {
+	Name            string            `yaml:"name"`
+	Version         string            `yaml:"version"`
+	Description     string            `yaml:"description"`
+	License         string            `yaml:"license"`
+	Language        string            `yaml:"language"`
+	Maintainers     []StackMaintainer `yaml:"maintainers"`
+	DefaultTemplate string            `yaml:"default-template"`
+	// LineEndings converts the line endings of the template text files when they are packaged: auto, the
+	// default, converts the shell scripts to LF, lf converts every text file and keep leaves them as they are
+	LineEndings string `yaml:"line-endings,omitempty"`
+	// Deprecated tells why the stack is deprecated and what replaces it, or is true. It is published in the index.
+	Deprecated string `yaml:"deprecated,omitempty"`
+	// RequiresAppsodyVersion is the oldest Appsody CLI the stack works with, such as 0.6.0, published in the index
+	RequiresAppsodyVersion string `yaml:"requires-appsody-version,omitempty"`
+	// Env declares the environment variables the stack honors, see StackEnvVar. It is published in the index.
+	Env []StackEnvVar `yaml:"env,omitempty"`
+}
+
+type StackMaintainer struct {
+	Name     string `yaml:"name"`
+	Email    string `yaml:"email"`
+	GithubID string `yaml:"github-id"`
+}
+
+// stackSource is a stack directory discovered in a stack repository checkout
+type stackSource struct {
+	ID        string
+	Dir       string
+	Templates []string
+}
+
+var stackCmd = &cobra.Command{
+	Use:   "stack",
+	Short: "Tools to help create and test Appsody stacks",
+	Long:  ``,
+}
+
+func init() {
+	rootCmd.AddCommand(stackCmd)
+}
+
+// discoverStacks walks a stack repository checkout and returns every directory containing a stack.yaml,
+// along with the names of the templates found under its templates directory.
+func discoverStacks(root string) ([]stackSource, error) {
+	var stacks []stackSource
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.HasPrefix(info.Name(), ".") && path != root {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != "stack.yaml" {
+			return nil
+		}
+		stackDir := filepath.Dir(path)
+		stack := stackSource{ID: filepath.Base(stackDir), Dir: stackDir}
+		templateDirs, err := ioutil.ReadDir(filepath.Join(stackDir, "templates"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, t := range templateDirs {
+			if t.IsDir() {
+				stack.Templates = append(stack.Templates, t.Name())
+			}
+		}
+		Debug.logf("Discovered stack %s in %s with templates %v", stack.ID, stackDir, stack.Templates)
+		stacks = append(stacks, stack)
+		// templates are never stacks themselves
+		return filepath.SkipDir
+	})
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].ID < stacks[j].ID })
+	return stacks, err
+}
+
+func readStackYaml(stackDir string) (*StackYaml, error) {
+	source, err := ioutil.ReadFile(filepath.Join(stackDir, "stack.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var stackYaml StackYaml
+	err = yaml.UnmarshalStrict(source, &stackYaml)
+	if err != nil {
+		return nil, errors.Errorf("stack.yaml formatting error: %v", err)
+	}
+	return &stackYaml, nil
+}
+
+// validateStack checks the stack source for the files and metadata every stack is required to have.
+// All problems are returned, not just the first one.
+func validateStack(stack stackSource) []error {
+	var problems []error
+	stackYaml, err := readStackYaml(stack.Dir)
+	if err != nil {
+		return append(problems, err)
+	}
+	if stackYaml.Name == "" {
+		problems = append(problems, errors.New("stack.yaml is missing the name field"))
+	}
+	if stackYaml.Version == "" {
+		problems = append(problems, errors.New("stack.yaml is missing the version field"))
+	}
+	if stackYaml.Description == "" {
+		problems = append(problems, errors.New("stack.yaml is missing the description field"))
+	}
+	if len(stackYaml.Maintainers) == 0 {
+		problems = append(problems, errors.New("stack.yaml must list at least one maintainer"))
+	}
+	if dockerfileExists, _ := exists(filepath.Join(stack.Dir, "image", "Dockerfile-stack")); !dockerfileExists {
+		problems = append(problems, errors.New("image/Dockerfile-stack is missing"))
+	}
+	if stackYaml.LineEndings == lineEndingsNative {
+		problems = append(problems, errors.New("line-endings cannot be native, the line endings of a package are the same on every OS"))
+	} else if stackYaml.LineEndings != "" {
+		if err = checkLineEndings(stackYaml.LineEndings); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if stackYaml.RequiresAppsodyVersion != "" && !cliVersionPattern.MatchString(stackYaml.RequiresAppsodyVersion) {
+		problems = append(problems, errors.Errorf("requires-appsody-version %q is not a version such as 0.6.0", stackYaml.RequiresAppsodyVersion))
+	}
+	problems = append(problems, checkEnvDeclarations(stackYaml.Env)...)
+	for _, template := range stack.Templates {
+		if files, err := ioutil.ReadDir(filepath.Join(stack.Dir, "templates", template)); err == nil && len(files) == 0 {
+			problems = append(problems, errors.Errorf("the %s template has no files", template))
+		}
+	}
+	if len(stack.Templates) == 0 {
+		problems = append(problems, errors.New("the stack does not have any templates"))
+	} else if stackYaml.DefaultTemplate != "" {
+		found := false
+		for _, t := range stack.Templates {
+			if t == stackYaml.DefaultTemplate {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, errors.Errorf("default-template %s is not one of the stack templates %v", stackYaml.DefaultTemplate, stack.Templates))
+		}
+	}
+	return problems
+}
+
+// packageTemplate creates a template archive that `appsody init` can extract, including a generated
+// .appsody-config.yaml pointing at the stack image. It returns the sha256 digest of the archive.
+func packageTemplate(stack stackSource, template string, stackImage string, destFile string) (string, error) {
+	templateDir := filepath.Join(stack.Dir, "templates", template)
+	endings := lineEndingsAuto
+	if stackYaml, err := readStackYaml(stack.Dir); err == nil && stackYaml.LineEndings != "" {
+		endings = stackYaml.LineEndings
+	}
+	out, err := os.Create(destFile)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	digest := sha256.New()
+	gzipWriter := gzip.NewWriter(io.MultiWriter(out, digest))
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = filepath.Walk(templateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(templateDir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = "./" + filepath.ToSlash(relPath)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if !info.Mode().IsRegular() {
+			return tarWriter.WriteHeader(header)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader := bufio.NewReaderSize(file, textSniffLength)
+		head, _ := reader.Peek(textSniffLength)
+		// files have no executable bit on Windows, the scripts are made executable in the package
+		if isShellScript(path, head) {
+			header.Mode |= 0755
+		}
+		var content io.Reader = reader
+		if needsLineEndings(endings, path, head) {
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			data = convertLineEndings(endings, path, data)
+			header.Size = int64(len(data))
+			content = bytes.NewReader(data)
+		}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, content)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	config := []byte("stack: " + stackImage + "\n")
+	err = tarWriter.WriteHeader(&tar.Header{Name: "./" + ConfigFile, Mode: 0644, Size: int64(len(config)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return "", err
+	}
+	if _, err = tarWriter.Write(config); err != nil {
+		return "", err
+	}
+	if err = tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
+
+// stackImageName returns the image a stack is published as, <namespace>/<id>:<major>.<minor>
+func stackImageName(namespace string, stackID string, version string) string {
+	tag := version
+	parts := strings.Split(version, ".")
+	if len(parts) >= 2 {
+		tag = parts[0] + "." + parts[1]
+	}
+	return namespace + "/" + stackID + ":" + tag
+}
+
+// requiredStackEnvVars must be set by every Dockerfile-stack for the appsody controller to work
+var requiredStackEnvVars = []string{"APPSODY_MOUNTS", "APPSODY_RUN", "APPSODY_PROJECT_DIR"}
+
+// lintStack looks for the environment variables the controller relies on in the stack Dockerfile
+func lintStack(stack stackSource) []error {
+	var problems []error
+	dockerfile, err := ioutil.ReadFile(filepath.Join(stack.Dir, "image", "Dockerfile-stack"))
+	if err != nil {
+		return append(problems, err)
+	}
+	for _, envVar := range requiredStackEnvVars {
+		if !strings.Contains(string(dockerfile), envVar) {
+			problems = append(problems, errors.Errorf("Dockerfile-stack does not define %s", envVar))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,309 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var ciParallel int
+var ciReportFile string
+var ciReportFormat string
+var ciPackageDir string
+var ciImageNamespace string
+
+// ciResult is the outcome of a single step (lint, validate or package) against a stack or template
+type ciResult struct {
+	Stack    string        `json:"stack"`
+	Template string        `json:"template,omitempty"`
+	Step     string        `json:"step"`
+	Duration time.Duration `json:"duration"`
+	Errors   []string      `json:"errors,omitempty"`
+	// file is the file of the stack the step checks, for the SARIF report
+	file string
+}
+
+func (r ciResult) passed() bool {
+	return len(r.Errors) == 0
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr,omitempty"`
+	Failures int              `xml:"failures,attr,omitempty"`
+	Errors   int              `xml:"errors,attr,omitempty"`
+	Skipped  int              `xml:"skipped,attr,omitempty"`
+	Time     string           `xml:"time,attr,omitempty"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr,omitempty"`
+	Skipped   int             `xml:"skipped,attr,omitempty"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitFailure `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	Contents string `xml:",chardata"`
+}
+
+var stackCICmd = &cobra.Command{
+	Use:   "ci [dir]",
+	Short: "Lint, validate and package every stack in a stack repository",
+	Long: `This discovers every stack (any directory containing a stack.yaml) and its templates under [dir], or the current directory,
+and runs the lint, validate and package steps against each of them. The results are written to a JUnit XML, JSON or SARIF
+report so pull requests against a stack repository can be gated on them, and the problems shown by code scanning tools
+such as GitHub code scanning. The command fails if any step fails. The notifications of the CLI configuration tell
+when the run ends, --no-notify leaves them out.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+		if ciParallel < 1 {
+			return errors.New("--parallel must be at least 1")
+		}
+		if err := checkCIReportFormat(); err != nil {
+			return err
+		}
+		stacks, err := discoverStacks(root)
+		if err != nil {
+			return errors.Errorf("Could not search %s for stacks: %v", root, err)
+		}
+		if len(stacks) == 0 {
+			return errors.Errorf("No stacks were found in %s", root)
+		}
+		Info.logf("Found %d stack(s) in %s", len(stacks), root)
+
+		packageDir := ciPackageDir
+		if packageDir == "" {
+			packageDir, err = ioutil.TempDir("", "appsody-stack-ci")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(packageDir)
+		} else if !dryrun {
+			if err = os.MkdirAll(packageDir, 0755); err != nil {
+				return err
+			}
+		}
+
+		results := runStackCI(stacks, packageDir)
+
+		table := uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("STACK", "TEMPLATE", "STEP", "RESULT")
+		failures := 0
+		for _, result := range results {
+			status := "passed"
+			if !result.passed() {
+				status = strings.Join(result.Errors, "; ")
+				failures++
+			}
+			table.AddRow(result.Stack, result.Template, result.Step, status)
+		}
+		Info.log("\n", table)
+
+		if ciReportFile != "" {
+			if dryrun {
+				Info.log("Dry Run - Skipping writing of the CI report ", ciReportFile)
+			} else {
+				err = writeCIReport("stack ci", results, ciReportFormat, ciReportFile)
+				if err != nil {
+					return errors.Errorf("Could not write the CI report: %v", err)
+				}
+				Info.log("CI report written to ", ciReportFile)
+			}
+		}
+		if failures > 0 {
+			return errors.Errorf("%d of %d stack CI steps failed", failures, len(results))
+		}
+		Info.log("All stack CI steps passed")
+		return nil
+	},
+}
+
+// runStackCI runs the CI steps for every stack using a pool of ciParallel workers.
+// Results are returned in the same order as the stacks, regardless of when they finish.
+func runStackCI(stacks []stackSource, packageDir string) []ciResult {
+	stackResults := make([][]ciResult, len(stacks))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < ciParallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				stackResults[i] = runStackCISteps(stacks[i], packageDir)
+			}
+		}()
+	}
+	for i := range stacks {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var results []ciResult
+	for _, r := range stackResults {
+		results = append(results, r...)
+	}
+	return results
+}
+
+func runStackCISteps(stack stackSource, packageDir string) []ciResult {
+	var results []ciResult
+	timed := func(template string, step string, run func() []error) bool {
+		Info.logf("Running %s for stack %s %s", step, stack.ID, template)
+		start := time.Now()
+		result := ciResult{Stack: stack.ID, Template: template, Step: step, file: ciStepFile(stack, template, step)}
+		for _, err := range run() {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		result.Duration = time.Since(start)
+		results = append(results, result)
+		return result.passed()
+	}
+
+	timed("", "lint", func() []error { return lintStack(stack) })
+	if !timed("", "validate", func() []error { return validateStack(stack) }) {
+		// packaging needs a valid stack.yaml
+		return results
+	}
+	stackYaml, _ := readStackYaml(stack.Dir)
+	stackImage := stackImageName(ciImageNamespace, stack.ID, stackYaml.Version)
+	for _, template := range stack.Templates {
+		template := template
+		timed(template, "package", func() []error {
+			if dryrun {
+				Info.logf("Dry Run - Skipping packaging of template %s for stack %s", template, stack.ID)
+				return nil
+			}
+			archive := filepath.Join(packageDir, stack.ID+".v"+stackYaml.Version+".templates."+template+".tar.gz")
+			digest, err := packageTemplate(stack, template, stackImage, archive)
+			if err != nil {
+				return []error{err}
+			}
+			Debug.logf("Packaged %s with digest sha256:%s", archive, digest)
+			return nil
+		})
+	}
+	return results
+}
+
+// checkCIReportFormat checks the --report-format of stack ci and stack lint
+func checkCIReportFormat() error {
+	if ciReportFormat != "junit" && ciReportFormat != "json" && ciReportFormat != "sarif" {
+		return errors.Errorf("Unsupported report format %s. Use junit, json or sarif.", ciReportFormat)
+	}
+	return nil
+}
+
+// writeCIReport writes the results of the steps of a command, stack ci or stack lint, to a report file
+func writeCIReport(command string, results []ciResult, format string, file string) error {
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(results, "", "  ")
+	case "sarif":
+		return writeSARIF(toSARIF(command, results), file)
+	default:
+		data, err = xml.MarshalIndent(toJUnit(results), "", "  ")
+		data = append([]byte(xml.Header), data...)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// toJUnit reports each stack as a test suite and each step as a test case
+func toJUnit(results []ciResult) junitTestSuites {
+	var report junitTestSuites
+	suites := make(map[string]int)
+	for _, result := range results {
+		i, ok := suites[result.Stack]
+		if !ok {
+			report.Suites = append(report.Suites, junitTestSuite{Name: result.Stack})
+			i = len(report.Suites) - 1
+			suites[result.Stack] = i
+		}
+		suite := &report.Suites[i]
+		name := result.Step
+		if result.Template != "" {
+			name += " " + result.Template
+		}
+		testCase := junitTestCase{ClassName: result.Stack, Name: name, Time: formatSeconds(result.Duration)}
+		if !result.passed() {
+			testCase.Failure = &junitFailure{Message: result.Errors[0], Contents: strings.Join(result.Errors, "\n")}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	for i := range report.Suites {
+		var total time.Duration
+		for _, result := range results {
+			if result.Stack == report.Suites[i].Name {
+				total += result.Duration
+			}
+		}
+		report.Suites[i].Time = formatSeconds(total)
+	}
+	return report
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func init() {
+	stackCmd.AddCommand(stackCICmd)
+	stackCICmd.PersistentFlags().IntVar(&ciParallel, "parallel", 1, "Number of stacks to process at the same time.")
+	stackCICmd.PersistentFlags().StringVar(&ciReportFile, "report-file", "", "Write a consolidated report of all the steps to this file.")
+	stackCICmd.PersistentFlags().StringVar(&ciReportFormat, "report-format", "junit", "Format of the report file: junit, json or sarif.")
+	stackCICmd.PersistentFlags().StringVar(&ciPackageDir, "package-dir", "", "Keep the packaged templates in this directory. By default they are discarded.")
+	stackCICmd.PersistentFlags().StringVar(&ciImageNamespace, "image-namespace", "appsody", "Namespace of the stack images referenced by the packaged templates.")
+	stackCICmd.PersistentFlags().BoolVar(&noNotify, "no-notify", false, "Do not send the notifications of the CLI and project configuration when the CI run ends.")
+}
@@ -0,0 +1,58 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+)
+
+// ciSARIFRules describes the CI steps, which are the rules of the SARIF report
+var ciSARIFRules = []sarifRule{
+	{"lint", sarifMessage{"The Dockerfile-stack sets the environment the Appsody controller needs"}},
+	{"validate", sarifMessage{"The stack has the files and stack.yaml metadata every stack needs"}},
+	{"package", sarifMessage{"The template can be packaged"}},
+}
+
+// ciStepFile returns the file a CI step checks: the Dockerfile-stack for lint, the stack.yaml for validate and the
+// template directory for package
+func ciStepFile(stack stackSource, template string, step string) string {
+	switch step {
+	case "lint":
+		return filepath.Join(stack.Dir, "image", "Dockerfile-stack")
+	case "package":
+		return filepath.Join(stack.Dir, "templates", template)
+	}
+	return filepath.Join(stack.Dir, "stack.yaml")
+}
+
+// toSARIF reports every error of the failed steps as a result on the file of the step, with the rules of the
+// steps the command ran
+func toSARIF(command string, results []ciResult) sarifReport {
+	steps := map[string]bool{}
+	var sarifResults []sarifResult
+	for _, result := range results {
+		steps[result.Step] = true
+		for _, message := range result.Errors {
+			sarifResults = append(sarifResults, newSARIFResult(result.Step, sarifError, result.Stack+": "+message, result.file))
+		}
+	}
+	var rules []sarifRule
+	for _, rule := range ciSARIFRules {
+		if steps[rule.ID] {
+			rules = append(rules, rule)
+		}
+	}
+	return newSARIFReport(command, rules, sarifResults)
+}
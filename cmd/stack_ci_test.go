@@ -0,0 +1,234 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+)
+
+const ciStackYaml = `name: Node.js
+version: 0.3.1
+description: Node.js stack
+maintainers:
+- name: Someone
+  email: someone@example.com
+  github-id: someone
+`
+
+const ciDockerfile = "FROM node:12\nENV APPSODY_MOUNTS=/:/project/user-app\nENV APPSODY_RUN=\"npm start\"\nENV APPSODY_PROJECT_DIR=/project\n"
+
+// writeCIStack writes a stack with a simple template in root, with the files of the stack changed by files
+func writeCIStack(t *testing.T, root string, id string, files map[string]string) {
+	stack := map[string]string{
+		"stack.yaml":                    ciStackYaml,
+		"image/Dockerfile-stack":        ciDockerfile,
+		"templates/simple/app.js":       "console.log('hello')\n",
+		"templates/simple/package.json": "{}\n",
+	}
+	for name, content := range files {
+		stack[name] = content
+	}
+	for name, content := range stack {
+		if content == "" {
+			continue
+		}
+		file := filepath.Join(root, id, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var stackCITests = []struct {
+	testName string
+	files    map[string]string // the files changed from a valid stack, removed when empty
+	results  []string          // <step> [template]: <errors>
+}{
+	{"Valid", nil, []string{"lint: ", "validate: ", "package simple: "}},
+	{"Lint", map[string]string{"image/Dockerfile-stack": "FROM node:12\nENV APPSODY_MOUNTS=/:/project\n"},
+		[]string{"lint: Dockerfile-stack does not define APPSODY_RUN; Dockerfile-stack does not define APPSODY_PROJECT_DIR", "validate: ", "package simple: "}},
+	// packaging needs a valid stack.yaml
+	{"Validate", map[string]string{"stack.yaml": "name: Node.js\nversion: 0.3.1\n"},
+		[]string{"lint: ", "validate: stack.yaml is missing the description field; stack.yaml must list at least one maintainer"}},
+	{"No templates", map[string]string{"templates/simple/app.js": "", "templates/simple/package.json": ""},
+		[]string{"lint: ", "validate: the stack does not have any templates"}},
+}
+
+func TestStackCI(t *testing.T) {
+	for _, tt := range stackCITests {
+		t.Run(tt.testName, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "appsody-stack-ci")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			writeCIStack(t, root, "nodejs", tt.files)
+			results, err := cmd.RunStackCI(root, root, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, result := range results {
+				step := result.Step
+				if result.Template != "" {
+					step += " " + result.Template
+				}
+				got = append(got, step+": "+strings.Join(result.Errors, "; "))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.results, "\n") {
+				t.Errorf("Expected the results\n%s\ngot\n%s", strings.Join(tt.results, "\n"), strings.Join(got, "\n"))
+			}
+			if len(results) == 3 {
+				if _, err = os.Stat(filepath.Join(root, "nodejs.v0.3.1.templates.simple.tar.gz")); err != nil {
+					t.Errorf("Expected the template to be packaged: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestStackCIParallel checks that the results keep the order of the stacks, whichever finishes first
+func TestStackCIParallel(t *testing.T) {
+	root, err := ioutil.TempDir("", "appsody-stack-ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ids := []string{"java", "nodejs", "python", "swift"}
+	for _, id := range ids {
+		writeCIStack(t, root, id, nil)
+	}
+	results, err := cmd.RunStackCI(root, root, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3*len(ids) {
+		t.Fatalf("Expected 3 steps for each of the %d stacks, got %d results", len(ids), len(results))
+	}
+	for i, result := range results {
+		if result.Stack != ids[i/3] {
+			t.Errorf("Expected the result %d to be of the %s stack, got %s", i, ids[i/3], result.Stack)
+		}
+	}
+}
+
+var ciReportResults = []cmd.CIResult{
+	{Stack: "nodejs", Step: "lint"},
+	{Stack: "nodejs", Step: "validate", Errors: []string{"stack.yaml is missing the version field", "stack.yaml must list at least one maintainer"}},
+	{Stack: "java", Step: "package", Template: "spring"},
+}
+
+var ciReportTests = []struct {
+	format string
+	check  func(t *testing.T, data []byte)
+}{
+	{"junit", func(t *testing.T, data []byte) {
+		var report struct {
+			Suites []struct {
+				Name      string `xml:"name,attr"`
+				Tests     int    `xml:"tests,attr"`
+				Failures  int    `xml:"failures,attr"`
+				TestCases []struct {
+					Name    string `xml:"name,attr"`
+					Failure *struct {
+						Message string `xml:"message,attr"`
+					} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		if err := xml.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Suites) != 2 || report.Suites[0].Name != "nodejs" || report.Suites[0].Tests != 2 || report.Suites[0].Failures != 1 {
+			t.Fatalf("Expected the nodejs suite with 2 tests and 1 failure, and the java suite, got %+v", report.Suites)
+		}
+		failure := report.Suites[0].TestCases[1].Failure
+		if failure == nil || failure.Message != "stack.yaml is missing the version field" {
+			t.Errorf("Expected the first error as the failure of validate, got %+v", failure)
+		}
+		if name := report.Suites[1].TestCases[0].Name; name != "package spring" {
+			t.Errorf("Expected the test case of the template to be package spring, got %s", name)
+		}
+	}},
+	{"json", func(t *testing.T, data []byte) {
+		var results []cmd.CIResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 3 || len(results[1].Errors) != 2 || results[2].Template != "spring" {
+			t.Errorf("Expected the results as they are, got %+v", results)
+		}
+	}},
+	{"sarif", func(t *testing.T, data []byte) {
+		var report struct {
+			Runs []struct {
+				Tool struct {
+					Driver struct {
+						Rules []struct {
+							ID string `json:"id"`
+						} `json:"rules"`
+					} `json:"driver"`
+				} `json:"tool"`
+				Results []struct {
+					RuleID  string `json:"ruleId"`
+					Message struct {
+						Text string `json:"text"`
+					} `json:"message"`
+				} `json:"results"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Runs) != 1 || len(report.Runs[0].Tool.Driver.Rules) != 3 || len(report.Runs[0].Results) != 2 {
+			t.Fatalf("Expected a run with the 3 steps as rules and the 2 errors as results, got %+v", report)
+		}
+		if result := report.Runs[0].Results[1]; result.RuleID != "validate" || result.Message.Text != "nodejs: stack.yaml must list at least one maintainer" {
+			t.Errorf("Expected the second error of validate on nodejs, got %+v", result)
+		}
+	}},
+}
+
+func TestWriteCIReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appsody-ci-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tt := range ciReportTests {
+		t.Run(tt.format, func(t *testing.T) {
+			file := filepath.Join(dir, "report."+tt.format)
+			if err := cmd.WriteCIReport("stack ci", ciReportResults, tt.format, file); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, data)
+		})
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// diffContext is the number of unchanged lines shown around the changes
+const diffContext = 3
+
+// maxDiffLines bounds the files compared line by line, larger ones are only reported as changed
+const maxDiffLines = 5000
+
+var stackDiffStat bool
+
+// stackMetadata is what is compared of stack.yaml. For a published stack it comes from the index entry,
+// which is generated from the stack.yaml of the stack.
+type stackMetadata struct {
+	Name            string   `yaml:"name"`
+	Version         string   `yaml:"version"`
+	Description     string   `yaml:"description"`
+	License         string   `yaml:"license,omitempty"`
+	Language        string   `yaml:"language,omitempty"`
+	Maintainers     []string `yaml:"maintainers"`
+	DefaultTemplate string   `yaml:"default-template,omitempty"`
+	Templates       []string `yaml:"templates"`
+	Image           string   `yaml:"image,omitempty"`
+}
+
+// diffOp is a line of a line diff: ' ' when it is in both files, '-' when it was removed and '+' when added.
+// from and to are the number of lines of each file before it.
+type diffOp struct {
+	op   byte
+	line string
+	from int
+	to   int
+}
+
+var stackDiffCmd = &cobra.Command{
+	Use:   "diff <stack>[@version] <stack>[@version]|<dir>",
+	Short: "Show the differences between two versions of a stack",
+	Long: `This compares the stack.yaml metadata, the image and the templates of two stacks, to see what changes for the
+projects of a stack when they move to another version of it.
+
+Each stack is a stack of the repositories, such as nodejs for the latest version or nodejs@0.2.1, or the directory
+of a local stack with its stack.yaml. The Dockerfile-stack is compared for local stacks. It is not published with
+the stacks, so for published ones the environment of the stack image is compared instead.`,
+	Example: `  appsody stack diff nodejs@0.2.1 nodejs
+  appsody stack diff nodejs ./incubator/nodejs`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("Specify the two stacks to compare, such as appsody stack diff nodejs@0.2.1 nodejs")
+		}
+		scratch, err := scratchDir()
+		if err != nil {
+			return err
+		}
+		var index *RepoIndex
+		var dirs []string
+		for i, spec := range args {
+			dir := filepath.Join(scratch, "diff", string("ab"[i]))
+			if err = stackSnapshot(spec, dir, &index); err != nil {
+				return err
+			}
+			dirs = append(dirs, dir)
+		}
+		output, changed, err := diffTrees(dirs[0], dirs[1], args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			Info.logf("%s and %s are the same", args[0], args[1])
+			return nil
+		}
+		fmt.Print(output)
+		Info.logf("%d file(s) differ between %s and %s", changed, args[0], args[1])
+		return nil
+	},
+}
+
+// stackSnapshot lays down what is compared of a stack in dir: stack.yaml with the metadata, image/Dockerfile-stack
+// for a local stack, image/env for a published one, and the files of each template under templates
+func stackSnapshot(spec string, dir string, index **RepoIndex) error {
+	if found, _ := exists(filepath.Join(spec, "stack.yaml")); found {
+		return localStackSnapshot(spec, dir)
+	}
+	if *index == nil {
+		*index = &RepoIndex{}
+		if err := (*index).getIndex(); err != nil {
+			return errors.Errorf("Could not read index: %v", err)
+		}
+	}
+	return publishedStackSnapshot(*index, spec, dir)
+}
+
+func localStackSnapshot(stackDir string, dir string) error {
+	stackYaml, err := readStackYaml(stackDir)
+	if err != nil {
+		return err
+	}
+	metadata := stackMetadata{Name: stackYaml.Name, Version: stackYaml.Version, Description: stackYaml.Description,
+		License: stackYaml.License, Language: stackYaml.Language, DefaultTemplate: stackYaml.DefaultTemplate}
+	for _, maintainer := range stackYaml.Maintainers {
+		metadata.Maintainers = append(metadata.Maintainers, fmt.Sprintf("%s <%s>", maintainer.Name, maintainer.Email))
+	}
+	templates, err := ioutil.ReadDir(filepath.Join(stackDir, "templates"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, template := range templates {
+		if !template.IsDir() {
+			continue
+		}
+		metadata.Templates = append(metadata.Templates, template.Name())
+		if err = copyTree(filepath.Join(stackDir, "templates", template.Name()), filepath.Join(dir, "templates", template.Name())); err != nil {
+			return err
+		}
+	}
+	if err = writeStackMetadata(metadata, dir); err != nil {
+		return err
+	}
+	dockerfile, err := ioutil.ReadFile(filepath.Join(stackDir, "image", "Dockerfile-stack"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "image", "Dockerfile-stack"), dockerfile, 0644)
+}
+
+// findStackVersion returns the version of a stack of the index a <stack>[@version] names. The version can be
+// given without its patch, or its minor, to name the latest one.
+func findStackVersion(index *RepoIndex, spec string) (*ProjectVersion, error) {
+	return index.ByNameVersion(splitStackSpec(spec))
+}
+
+// splitStackSpec splits a <stack>[@version] into the stack and the version, empty for the latest one
+func splitStackSpec(spec string) (string, string) {
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		return spec[:at], spec[at+1:]
+	}
+	return spec, ""
+}
+
+// templateName returns the name of a template from its archive, as in incubator.nodejs.templates.simple.tar.gz
+func templateName(archiveURL string) string {
+	name := archiveName(archiveURL)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if i := strings.LastIndex(name, ".templates."); i >= 0 {
+		return name[i+len(".templates."):]
+	}
+	return name
+}
+
+func publishedStackSnapshot(index *RepoIndex, spec string, dir string) error {
+	stack, err := findStackVersion(index, spec)
+	if err != nil {
+		return err
+	}
+	metadata := stackMetadata{Name: stack.Name, Version: stack.Version, Description: stack.Description, Maintainers: stack.Maintainers, Image: stack.Image}
+	downloads := filepath.Join(dir, "..", filepath.Base(dir)+"-downloads")
+	if err = os.MkdirAll(downloads, 0755); err != nil {
+		return err
+	}
+	for _, templateURL := range stack.URLs {
+		template := templateName(templateURL)
+		metadata.Templates = append(metadata.Templates, template)
+		archive := filepath.Join(downloads, archiveName(templateURL))
+		Info.logf("Downloading the %s template of %s", template, spec)
+		if err = downloadFileToDisk(templateURL, archive); err != nil {
+			return err
+		}
+		if dryrun {
+			continue
+		}
+		if metadata.Image == "" {
+			metadata.Image = templateStackImage(archive)
+		}
+		templateDir := filepath.Join(dir, "templates", template)
+		err = walkArchive(archive, func(entry archiveEntry) error {
+			name, err := safeArchivePath(entry.name)
+			if err != nil || entry.dir || name == ConfigFile {
+				// the generated .appsody-config.yaml only names the image, which is compared with the metadata
+				return err
+			}
+			return extractArchiveFile(filepath.Join(templateDir, name), entry, lineEndingsKeep)
+		})
+		if err != nil {
+			return errors.Errorf("Could not extract the %s template of %s: %v", template, spec, err)
+		}
+	}
+	if err = writeStackMetadata(metadata, dir); err != nil {
+		return err
+	}
+	if metadata.Image == "" || dryrun {
+		return nil
+	}
+	env, err := stackImageEnv(metadata.Image)
+	if err != nil {
+		Warning.logf("Could not compare the environment of the %s image: %v", metadata.Image, err)
+		return nil
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "image", "env"), []byte(strings.Join(env, "\n")+"\n"), 0644)
+}
+
+// stackImageEnv returns the sorted environment variables of a stack image, which the Dockerfile-stack sets
+func stackImageEnv(image string) ([]string, error) {
+	if err := dockerPullImage(image); err != nil {
+		return nil, err
+	}
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{json .Config.Env}}", image).Output()
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	if err = json.Unmarshal(out, &env); err != nil {
+		return nil, err
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+func writeStackMetadata(metadata stackMetadata, dir string) error {
+	sort.Strings(metadata.Templates)
+	data, err := yaml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "image"), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "stack.yaml"), data, 0644)
+}
+
+// treeFiles returns the files under dir, by their slash separated path relative to it
+func treeFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = file
+		return nil
+	})
+	return files, err
+}
+
+// diffTrees compares the files of two directories, and returns their diffs and how many files differ.
+// With --stat only the names of the files are listed.
+func diffTrees(fromDir string, toDir string, fromName string, toName string) (string, int, error) {
+	fromFiles, err := treeFiles(fromDir)
+	if err != nil {
+		return "", 0, err
+	}
+	toFiles, err := treeFiles(toDir)
+	if err != nil {
+		return "", 0, err
+	}
+	var names []string
+	for name := range fromFiles {
+		names = append(names, name)
+	}
+	for name := range toFiles {
+		if _, ok := fromFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var out strings.Builder
+	changed := 0
+	for _, name := range names {
+		var from, to []byte
+		if fromFiles[name] != "" {
+			if from, err = ioutil.ReadFile(fromFiles[name]); err != nil {
+				return "", 0, err
+			}
+		}
+		if toFiles[name] != "" {
+			if to, err = ioutil.ReadFile(toFiles[name]); err != nil {
+				return "", 0, err
+			}
+		}
+		if fromFiles[name] != "" && toFiles[name] != "" && string(from) == string(to) {
+			continue
+		}
+		changed++
+		status := "changed"
+		switch {
+		case fromFiles[name] == "":
+			status = "only in " + toName
+		case toFiles[name] == "":
+			status = "only in " + fromName
+		}
+		if stackDiffStat {
+			out.WriteString(fmt.Sprintf("%-60s %s\n", name, status))
+			continue
+		}
+		if name == "image/Dockerfile-stack" || name == "image/env" {
+			if fromFiles[name] == "" || toFiles[name] == "" {
+				out.WriteString(fmt.Sprintf("%s is %s, it can only be compared between two local or two published stacks\n", name, status))
+				continue
+			}
+		}
+		if !isText(from) || !isText(to) {
+			out.WriteString(fmt.Sprintf("Binary file %s %s\n", name, status))
+			continue
+		}
+		fromLabel, toLabel := fromName+"/"+name, toName+"/"+name
+		if fromFiles[name] == "" {
+			fromLabel = "/dev/null"
+		} else if toFiles[name] == "" {
+			toLabel = "/dev/null"
+		}
+		out.WriteString(unifiedDiff(fromLabel, toLabel, splitLines(from), splitLines(to)))
+	}
+	return out.String(), changed, nil
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.Replace(string(data), "\r\n", "\n", -1), "\n"), "\n")
+}
+
+// diffLines returns the line diff of two files, from their longest common subsequence
+func diffLines(from []string, to []string) []diffOp {
+	// common[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			ops = append(ops, diffOp{' ', from[i], i, j})
+			i++
+			j++
+		case i < len(from) && (j == len(to) || common[i+1][j] >= common[i][j+1]):
+			ops = append(ops, diffOp{'-', from[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', to[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff returns the diff of two files in the unified format of diff -u
+func unifiedDiff(fromName string, toName string, from []string, to []string) string {
+	var out strings.Builder
+	out.WriteString("--- " + fromName + "\n+++ " + toName + "\n")
+	if len(from) > maxDiffLines || len(to) > maxDiffLines {
+		out.WriteString(fmt.Sprintf("@@ the files have more than %d lines, they are not compared line by line @@\n", maxDiffLines))
+		return out.String()
+	}
+	ops := diffLines(from, to)
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// a hunk goes on while the changes are close enough for their context lines to meet
+		last := i
+		for j := i; j < len(ops) && j-last <= 2*diffContext; j++ {
+			if ops[j].op != ' ' {
+				last = j
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.op != '+' {
+				fromCount++
+			}
+			if op.op != '-' {
+				toCount++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(ops[start].from, fromCount), hunkRange(ops[start].to, toCount)))
+		for _, op := range ops[start:end] {
+			out.WriteString(string(op.op) + op.line + "\n")
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange returns the start,count of a hunk header, where an empty range starts at the line before it
+func hunkRange(before int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+func init() {
+	stackCmd.AddCommand(stackDiffCmd)
+	stackDiffCmd.PersistentFlags().BoolVar(&stackDiffStat, "stat", false, "Only list the files that differ")
+}
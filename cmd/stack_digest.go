@@ -0,0 +1,92 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pinnedStackDigest returns the digest the project pins its stack image to, with stackDigest in .appsody-config.yaml
+// or in the image reference itself, or an empty string
+func pinnedStackDigest(config ProjectConfig) string {
+	if config.StackDigest != "" {
+		return config.StackDigest
+	}
+	if at := strings.LastIndex(config.Platform, "@"); at >= 0 {
+		return config.Platform[at+1:]
+	}
+	return ""
+}
+
+// imageHasDigest tells whether the local image was pulled with the registry digest
+func imageHasDigest(image string, digest string) (bool, error) {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{range .RepoDigests}}{{.}} {{end}}", image).Output()
+	if err != nil {
+		return false, errors.Errorf("Could not inspect the image %s: %v", image, err)
+	}
+	for _, repoDigest := range strings.Fields(string(out)) {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pullStackImage pulls the stack image of the project and, when the project pins its digest, checks that the
+// local image still is the pinned one. If the tag was moved to another image upstream, the pinned image is pulled
+// by digest and tagged again, so the project keeps running and building with the image it pins.
+func pullStackImage(config ProjectConfig) error {
+	stackImage := config.Platform
+	if err := dockerPullImage(stackImage); err != nil {
+		return err
+	}
+	digest := pinnedStackDigest(config)
+	if digest == "" {
+		return nil
+	}
+	if dryrun {
+		Info.log("Dry Run - Skipping verification of the stack image digest ", digest)
+		return nil
+	}
+	matches, err := imageHasDigest(stackImage, digest)
+	if err != nil {
+		return err
+	}
+	if matches {
+		Debug.log("The stack image matches the pinned digest ", digest)
+		return nil
+	}
+	Warning.logf("The local stack image %s is not the pinned %s, pulling the pinned image", stackImage, digest)
+	name := stackImage
+	if at := strings.LastIndex(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	name, _ = splitImageTag(name)
+	pinnedImage := name + "@" + digest
+	if err = dockerPullCmd(pinnedImage); err != nil {
+		return errors.Errorf("Could not pull the pinned stack image %s: %v", pinnedImage, err)
+	}
+	if pinnedImage != stackImage {
+		if err = DockerTag(pinnedImage, stackImage); err != nil {
+			return errors.Errorf("Could not tag the pinned stack image as %s: %v", stackImage, err)
+		}
+	}
+	if matches, err = imageHasDigest(stackImage, digest); err != nil || !matches {
+		return errors.Errorf("The stack image %s still does not match the pinned digest %s", stackImage, digest)
+	}
+	return nil
+}
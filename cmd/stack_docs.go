@@ -0,0 +1,325 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackDocsOutput string
+var stackDocsCheck bool
+
+// stackDocs is what the documentation of a stack is rendered from
+type stackDocs struct {
+	ID              string
+	Stack           *StackYaml
+	Image           string
+	Templates       []string
+	DefaultTemplate string
+	Ports           []string
+	Env             []stackDocsEnv
+	AppsodyEnv      []stackDocsEnv
+	Profiles        []runProfileDefinition
+	Endpoints       []stackEndpoint
+}
+
+type stackDocsEnv struct {
+	Name  string
+	Value string
+}
+
+const stackDocsTemplate = `<!-- Generated by appsody stack docs from the stack.yaml and Dockerfile-stack of the stack. Do not edit. -->
+# [[.Stack.Name]]
+
+[[.Stack.Description]]
+
+| | |
+|---|---|
+| Version | [[.Stack.Version]] |
+| Stack image | ` + "`[[.Image]]`" + ` |
+[[- if .Stack.Language]]
+| Language | [[.Stack.Language]] |
+[[- end]]
+[[- if .Stack.License]]
+| License | [[.Stack.License]] |
+[[- end]]
+
+## Templates
+
+Create a project with ` + "`appsody init [[.ID]] <template>`" + `, or without a template name for the default one.
+
+[[range .Templates]]- [[.]][[if eq . $.DefaultTemplate]] (default)[[end]]
+[[end]]
+[[- if .Ports]]
+## Ports
+
+[[range .Ports]]- [[.]]
+[[end]]
+[[- end]]
+[[- if .Endpoints]]
+## Endpoints
+
+Open them with ` + "`appsody open <endpoint>`" + `.
+
+| Endpoint | Path |
+|---|---|
+[[range .Endpoints]]| [[.Name]] | [[.Path]] |
+[[end]]
+[[- end]]
+[[- if .Profiles]]
+## Run profiles
+
+Use them with ` + "`appsody run --profile <profile>`" + `.
+
+| Profile | Run command | Environment | Ports |
+|---|---|---|---|
+[[range .Profiles]]| [[.Name]] | [[.Command]] | [[join .Env ", "]] | [[join .Ports ", "]] |
+[[end]]
+[[- end]]
+[[- if .Env]]
+## Environment variables
+
+| Variable | Default |
+|---|---|
+[[range .Env]]| [[.Name]] | [[.Value]] |
+[[end]]
+[[- end]]
+## Appsody configuration
+
+| Variable | Value |
+|---|---|
+[[range .AppsodyEnv]]| [[.Name]] | [[.Value]] |
+[[end]]
+[[- if .Stack.Maintainers]]
+## Maintainers
+
+[[range .Stack.Maintainers]]- [[.Name]][[if .Email]] <[[.Email]]>[[end]][[if .GithubID]] (@[[.GithubID]])[[end]]
+[[end]]
+[[- end]]`
+
+var stackDocsCmd = &cobra.Command{
+	Use:   "docs [dir]",
+	Short: "Generate the documentation of a stack from its metadata",
+	Long: `This renders a README for the stack in [dir], or the current directory, from what the CLI reads of the stack: the
+metadata of its stack.yaml, its templates, and the ports, run profiles, endpoints and environment variables its
+Dockerfile-stack declares.
+
+The README is written to stdout, or to the file of --file. Use --check in the CI of a stack repository to fail when that
+file is not up to date with the metadata.`,
+	Example: `  appsody stack docs incubator/nodejs --file incubator/nodejs/README.md
+  appsody stack docs incubator/nodejs --file incubator/nodejs/README.md --check`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stackDir := "."
+		if len(args) > 0 {
+			stackDir = args[0]
+		}
+		if stackDocsCheck && stackDocsOutput == "" {
+			return errors.New("--check compares the documentation with the file of --file, specify it")
+		}
+		docs, err := readStackDocs(stackDir)
+		if err != nil {
+			return err
+		}
+		contents, err := renderStackDocs(docs)
+		if err != nil {
+			return err
+		}
+		switch {
+		case stackDocsOutput == "":
+			fmt.Print(contents)
+		case stackDocsCheck:
+			current, err := ioutil.ReadFile(stackDocsOutput)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if string(current) != contents {
+				return errors.Errorf("%s is not up to date with the stack metadata, run appsody stack docs %s --file %s", stackDocsOutput, stackDir, stackDocsOutput)
+			}
+			Info.logf("%s is up to date", stackDocsOutput)
+		case dryrun:
+			planned(planWrite, stackDocsOutput, "stack documentation")
+		default:
+			if err = ioutil.WriteFile(stackDocsOutput, []byte(contents), 0644); err != nil {
+				return err
+			}
+			Info.log("Wrote the documentation of the stack to ", stackDocsOutput)
+		}
+		return nil
+	},
+}
+
+// readStackDocs reads the metadata of a stack source directory
+func readStackDocs(stackDir string) (*stackDocs, error) {
+	stackYaml, err := readStackYaml(stackDir)
+	if err != nil {
+		return nil, errors.Errorf("Could not read the stack.yaml of %s: %v", stackDir, err)
+	}
+	absDir, err := filepath.Abs(stackDir)
+	if err != nil {
+		return nil, err
+	}
+	id := filepath.Base(absDir)
+	docs := &stackDocs{ID: id, Stack: stackYaml, Image: stackImageName("appsody", id, stackYaml.Version), DefaultTemplate: stackYaml.DefaultTemplate}
+	if entries, err := ioutil.ReadDir(filepath.Join(stackDir, "templates")); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				docs.Templates = append(docs.Templates, entry.Name())
+			}
+		}
+	}
+	if docs.DefaultTemplate == "" && len(docs.Templates) > 0 {
+		docs.DefaultTemplate = docs.Templates[0]
+	}
+	env, ports, err := readDockerfileStack(filepath.Join(stackDir, "image", "Dockerfile-stack"))
+	if err != nil {
+		return nil, err
+	}
+	docs.Ports = ports
+	var names []string
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, "APPSODY_PROFILE_") {
+			continue
+		}
+		if strings.HasPrefix(name, "APPSODY_") {
+			docs.AppsodyEnv = append(docs.AppsodyEnv, stackDocsEnv{name, env[name]})
+		} else {
+			docs.Env = append(docs.Env, stackDocsEnv{name, env[name]})
+		}
+	}
+	for _, name := range splitStackList(env["APPSODY_PROFILES"]) {
+		prefix := profileEnvPrefix(name)
+		docs.Profiles = append(docs.Profiles, runProfileDefinition{
+			Name:    name,
+			Command: env[prefix+"RUN"],
+			Env:     splitStackList(env[prefix+"ENV"]),
+			Ports:   splitStackList(env[prefix+"PORTS"]),
+		})
+	}
+	if env["APPSODY_ENDPOINTS"] != "" {
+		if docs.Endpoints, err = parseStackEndpoints(env["APPSODY_ENDPOINTS"]); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// readDockerfileStack returns the environment variables the ENV instructions of a Dockerfile-stack set, and the
+// ports of its EXPOSE instructions
+func readDockerfileStack(file string) (map[string]string, []string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, errors.Errorf("Could not read the Dockerfile-stack: %v", err)
+	}
+	env := map[string]string{}
+	var ports []string
+	var instruction string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasSuffix(line, "\\") {
+			instruction += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		instruction += line
+		fields := strings.Fields(instruction)
+		instruction = ""
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "EXPOSE":
+			ports = append(ports, fields[1:]...)
+		case "ENV":
+			if !strings.Contains(fields[1], "=") {
+				// ENV NAME value
+				env[fields[1]] = strings.Join(fields[2:], " ")
+				continue
+			}
+			for _, field := range splitEnvAssignments(strings.Join(fields[1:], " ")) {
+				nameValue := strings.SplitN(field, "=", 2)
+				env[nameValue[0]] = strings.Trim(nameValue[1], `"'`)
+			}
+		}
+	}
+	return env, ports, scanner.Err()
+}
+
+// splitEnvAssignments splits NAME=value NAME2="a value" at the spaces outside of quotes
+func splitEnvAssignments(line string) []string {
+	var assignments []string
+	var current strings.Builder
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == ' ':
+			if current.Len() > 0 {
+				assignments = append(assignments, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		assignments = append(assignments, current.String())
+	}
+	var valid []string
+	for _, assignment := range assignments {
+		if strings.Contains(assignment, "=") {
+			valid = append(valid, assignment)
+		}
+	}
+	return valid
+}
+
+func renderStackDocs(docs *stackDocs) (string, error) {
+	tmpl, err := template.New("docs").Delims("[[", "]]").Funcs(template.FuncMap{"join": strings.Join}).Parse(stackDocsTemplate)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, docs); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func init() {
+	stackCmd.AddCommand(stackDocsCmd)
+	stackDocsCmd.PersistentFlags().StringVar(&stackDocsOutput, "file", "", "File to write the documentation to. By default it is written to stdout.")
+	stackDocsCmd.PersistentFlags().BoolVar(&stackDocsCheck, "check", false, "Fail when the file of --file is not up to date, instead of writing it.")
+}
@@ -0,0 +1,158 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StackEnvVar is an environment variable the stack honors. Stacks declare them in stack.yaml, and they are
+// published in the index:
+//
+//   env:
+//   - name: PORT
+//     type: int
+//     default: "3000"
+//     description: Port the application listens on
+type StackEnvVar struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is string, the default, int, bool or url
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"`
+	Default     string `yaml:"default,omitempty" json:"default,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// The types of the declared environment variables
+const (
+	envTypeString = "string"
+	envTypeInt    = "int"
+	envTypeBool   = "bool"
+	envTypeURL    = "url"
+)
+
+var envNamePattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// maxEnvTypo is how many characters a variable of the project can differ from a declared one before it is
+// taken for another variable rather than a typo
+const maxEnvTypo = 2
+
+func (v StackEnvVar) typeName() string {
+	if v.Type == "" {
+		return envTypeString
+	}
+	return v.Type
+}
+
+// checkValue checks that the value is of the type of the variable
+func (v StackEnvVar) checkValue(value string) error {
+	switch v.typeName() {
+	case envTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return errors.Errorf("%s must be an integer", v.Name)
+		}
+	case envTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.Errorf("%s must be true or false", v.Name)
+		}
+	case envTypeURL:
+		if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return errors.Errorf("%s must be a URL, such as http://host:8080/path", v.Name)
+		}
+	}
+	return nil
+}
+
+// checkEnvDeclarations checks the env section of stack.yaml: the names must be valid and declared once, and
+// the defaults must be of the type of their variable
+func checkEnvDeclarations(env []StackEnvVar) []error {
+	var problems []error
+	declared := map[string]bool{}
+	for _, variable := range env {
+		if !envNamePattern.MatchString(variable.Name) {
+			problems = append(problems, errors.Errorf("env %q is not a valid environment variable name", variable.Name))
+			continue
+		}
+		if declared[variable.Name] {
+			problems = append(problems, errors.Errorf("env %s is declared more than once", variable.Name))
+		}
+		declared[variable.Name] = true
+		switch variable.typeName() {
+		case envTypeString, envTypeInt, envTypeBool, envTypeURL:
+		default:
+			problems = append(problems, errors.Errorf("env %s has the unknown type %s, use string, int, bool or url", variable.Name, variable.Type))
+			continue
+		}
+		if variable.Default != "" {
+			if err := variable.checkValue(variable.Default); err != nil {
+				problems = append(problems, errors.Errorf("the default of env %v", err))
+			}
+		}
+	}
+	return problems
+}
+
+// checkStackEnv checks the variables given to the application against the ones the stack declares: the values
+// must be of the declared type, and a variable whose name is a few characters away from a declared one, such
+// as PORTT, is taken for a typo. Other variables are the application's own. Nothing is checked when the stack
+// does not declare its variables.
+func checkStackEnv(stackImage string, variables []envVariable) error {
+	if len(variables) == 0 {
+		return nil
+	}
+	_, version := imageStackVersion(stackImage)
+	if version == nil || len(version.Env) == 0 {
+		Debug.log("The stack does not declare its environment variables, the env of the project is not checked")
+		return nil
+	}
+	declared := map[string]StackEnvVar{}
+	var names []string
+	for _, variable := range version.Env {
+		declared[variable.Name] = variable
+		names = append(names, variable.Name)
+	}
+	var problems []string
+	for _, variable := range variables {
+		if declaration, ok := declared[variable.Name]; ok {
+			// the values of the Secrets of the cluster are only known to the cluster
+			if variable.SecretName != "" {
+				continue
+			}
+			if err := declaration.checkValue(variable.Value); err != nil {
+				problems = append(problems, err.Error())
+			}
+			continue
+		}
+		var close []string
+		for _, name := range names {
+			if distance := editDistance(strings.ToUpper(variable.Name), strings.ToUpper(name)); distance <= maxEnvTypo && distance < len(name)/2 {
+				close = append(close, name)
+			}
+		}
+		if len(close) > 0 {
+			sort.Strings(close)
+			problems = append(problems, errors.Errorf("the stack does not use %s. Did you mean %s?", variable.Name, strings.Join(close, ", ")).Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.Errorf("The env of %s does not match the variables the stack declares, see appsody info --env:\n  %s", ConfigFile, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackIndexPackageDir string
+var stackIndexOutput string
+var stackIndexBaseURL string
+var stackIndexImageNamespace string
+
+var stackIndexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the index of a repository of stacks",
+	Long:  ``,
+}
+
+var stackIndexGenerateCmd = &cobra.Command{
+	Use:   "generate <dir>",
+	Short: "Package the stacks of a directory and write the index of a repository of them",
+	Long: `This packages the templates of every valid stack (any directory containing a stack.yaml) under <dir> into the
+--package-dir directory, by default <dir>/dist, and writes the index of a repository of them, by default index.yaml
+in the --package-dir directory. Stacks that are not valid are left out of the index with a warning.
+
+The template URLs of the index are relative to the index, so the directory can be added as a repository right away
+with appsody repo add, or published as it is to a web server. Use --base-url to give the archives absolute URLs
+instead, when they are published apart from the index.`,
+	Example: `  appsody stack index generate . && appsody repo add my-stacks file://$PWD/dist/index.yaml
+  appsody stack index generate stacks --package-dir public --base-url https://example.com/stacks/`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := args[0]
+		stacks, err := findLocalStacks(root)
+		if err != nil {
+			return err
+		}
+		packageDir := stackIndexPackageDir
+		if packageDir == "" {
+			packageDir = filepath.Join(root, "dist")
+		}
+		indexFile := stackIndexOutput
+		if indexFile == "" {
+			indexFile = filepath.Join(packageDir, "index.yaml")
+		}
+		if dryrun {
+			for _, stack := range stacks {
+				if err = planStackPackage(stack, packageDir); err != nil {
+					Warning.logf("The %s stack is left out of the index: %v", stack.ID, err)
+				}
+			}
+			planned(planWrite, indexFile, "index of the stacks of "+root)
+			return nil
+		}
+		indexDir, err := filepath.Abs(filepath.Dir(indexFile))
+		if err != nil {
+			return err
+		}
+		index, err := indexStacks(stacks, packageDir, stackPackaging{stackIndexImageNamespace, func(archive string) string {
+			return indexArchiveURL(indexDir, archive, stackIndexBaseURL)
+		}})
+		if err != nil {
+			return err
+		}
+		if len(index.Projects) == 0 {
+			return errors.Errorf("None of the %d stack(s) of %s are valid, see appsody stack validate %s", len(stacks), root, root)
+		}
+		if err = writeRepoIndex(index, indexFile); err != nil {
+			return errors.Errorf("Could not write the index: %v", err)
+		}
+		Info.logf("Indexed %d of the %d stack(s) of %s in %s", len(index.Projects), len(stacks), root, indexFile)
+		if absIndexFile, err := filepath.Abs(indexFile); err == nil {
+			Info.log("Add it as a repository with: appsody repo add <name> ", fileURL(absIndexFile))
+		}
+		return nil
+	},
+}
+
+// indexArchiveURL is the URL of a template archive in an index: relative to the directory of the index, unless
+// there is a base URL for the archives
+func indexArchiveURL(indexDir string, archive string, baseURL string) string {
+	if baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/") + "/" + filepath.Base(archive)
+	}
+	absArchive, err := filepath.Abs(archive)
+	if err != nil {
+		absArchive = archive
+	}
+	relative, err := filepath.Rel(indexDir, absArchive)
+	if err != nil {
+		return fileURL(absArchive)
+	}
+	return filepath.ToSlash(relative)
+}
+
+func init() {
+	stackCmd.AddCommand(stackIndexCmd)
+	stackIndexCmd.AddCommand(stackIndexGenerateCmd)
+	stackIndexGenerateCmd.PersistentFlags().StringVar(&stackIndexPackageDir, "package-dir", "", "Directory to write the template archives to. Defaults to the dist directory of <dir>.")
+	stackIndexGenerateCmd.PersistentFlags().StringVar(&stackIndexOutput, "file", "", "Index file to write. Defaults to index.yaml in the --package-dir directory.")
+	stackIndexGenerateCmd.PersistentFlags().StringVar(&stackIndexBaseURL, "base-url", "", "URL the template archives are published at, for absolute URLs in the index.")
+	stackIndexGenerateCmd.PersistentFlags().StringVar(&stackIndexImageNamespace, "image-namespace", "appsody", "Namespace of the stack images referenced by the packaged templates.")
+}
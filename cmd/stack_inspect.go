@@ -0,0 +1,359 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var inspectNoPull bool
+var inspectPackages bool
+
+// stackInspection is what appsody stack inspect reports of a stack image
+type stackInspection struct {
+	Stack       string            `yaml:"stack,omitempty"`
+	Version     string            `yaml:"version,omitempty"`
+	Image       string            `yaml:"image"`
+	ID          string            `yaml:"id"`
+	Digests     []string          `yaml:"digests,omitempty"`
+	Created     string            `yaml:"created,omitempty"`
+	Platform    string            `yaml:"platform"`
+	Size        int64             `yaml:"size"`
+	Layers      []imageLayer      `yaml:"layers"`
+	Runtimes    map[string]string `yaml:"runtimes"`
+	Ports       []string          `yaml:"ports"`
+	Appsody     map[string]string `yaml:"appsody"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Packages    []imagePackage    `yaml:"packages,omitempty"`
+	PackageTool string            `yaml:"packageManager,omitempty"`
+	OtherEnv    map[string]string `yaml:"env,omitempty"`
+}
+
+// imageLayer is a layer of docker history, newest first, with the instruction of the Dockerfile that made it
+type imageLayer struct {
+	ID        string `yaml:"id,omitempty"`
+	Size      int64  `yaml:"size"`
+	CreatedBy string `yaml:"createdBy"`
+}
+
+// imagePackage is a package of the operating system of the image, with its version
+type imagePackage struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+// runtimeVersionVars are the variables the official language images set to the version of their runtime, as
+// NODE_VERSION in the node images. The other *_VERSION variables are reported too.
+var runtimeVersionVars = map[string]string{
+	"NODE_VERSION":       "node",
+	"YARN_VERSION":       "yarn",
+	"JAVA_VERSION":       "java",
+	"MAVEN_VERSION":      "maven",
+	"GRADLE_VERSION":     "gradle",
+	"PYTHON_VERSION":     "python",
+	"PYTHON_PIP_VERSION": "pip",
+	"GOLANG_VERSION":     "go",
+	"RUBY_VERSION":       "ruby",
+	"DOTNET_VERSION":     "dotnet",
+	"SWIFT_VERSION":      "swift",
+	"PHP_VERSION":        "php",
+}
+
+// packageListing lists the packages of the operating system of an image with the first package manager found
+const packageListing = `if command -v dpkg-query >/dev/null 2>&1; then echo dpkg; dpkg-query -W -f '${Package}\t${Version}\n';
+elif command -v apk >/dev/null 2>&1; then echo apk; apk info -v 2>/dev/null | sed 's/-\([0-9][^-]*-r[0-9]*\)$/\t\1/';
+elif command -v rpm >/dev/null 2>&1; then echo rpm; rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\n';
+else echo none; fi`
+
+// inspectStackImage reads the description and the history of an image, and the packages of its operating
+// system with packages
+func inspectStackImage(image string, packages bool) (*stackInspection, error) {
+	out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{json .}}", image).Output()
+	if err != nil {
+		return nil, errors.Errorf("Could not inspect the image %s: %v", image, err)
+	}
+	var described struct {
+		ID           string `json:"Id"`
+		RepoDigests  []string
+		Created      string
+		Architecture string
+		Os           string
+		Variant      string
+		Size         int64
+		Config       struct {
+			Env          []string
+			ExposedPorts map[string]interface{}
+			Labels       map[string]string
+		}
+	}
+	if err = json.Unmarshal(out, &described); err != nil {
+		return nil, errors.Errorf("Could not read the description of the image %s: %v", image, err)
+	}
+	inspection := &stackInspection{
+		Image:    image,
+		ID:       described.ID,
+		Digests:  described.RepoDigests,
+		Created:  described.Created,
+		Platform: described.Os + "/" + described.Architecture,
+		Size:     described.Size,
+		Layers:   []imageLayer{},
+		Runtimes: map[string]string{},
+		Ports:    []string{},
+		Appsody:  map[string]string{},
+		Labels:   described.Config.Labels,
+		OtherEnv: map[string]string{},
+	}
+	if described.Variant != "" {
+		inspection.Platform += "/" + described.Variant
+	}
+	if created, err := time.Parse(time.RFC3339Nano, described.Created); err == nil {
+		inspection.Created = created.UTC().Format(time.RFC3339)
+	}
+	for port := range described.Config.ExposedPorts {
+		inspection.Ports = append(inspection.Ports, port)
+	}
+	sort.Strings(inspection.Ports)
+	for _, variable := range described.Config.Env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		switch {
+		case strings.HasPrefix(name, "APPSODY_"):
+			inspection.Appsody[name] = value
+		case runtimeVersionVars[name] != "":
+			inspection.Runtimes[runtimeVersionVars[name]] = value
+		case strings.HasSuffix(name, "_VERSION"):
+			inspection.Runtimes[strings.ToLower(strings.TrimSuffix(name, "_VERSION"))] = value
+		case name != "PATH" && name != "HOME" && name != "HOSTNAME":
+			inspection.OtherEnv[name] = value
+		}
+	}
+	if version := described.Config.Labels["org.opencontainers.image.version"]; version != "" {
+		inspection.Runtimes["image"] = version
+	}
+
+	out, err = runtimeCommand("docker", "history", "--no-trunc", "--human=false", "--format", "{{.ID}}\t{{.Size}}\t{{.CreatedBy}}", image).Output()
+	if err != nil {
+		Warning.logf("Could not read the layers of the image %s: %v", image, err)
+	} else {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			fields := strings.SplitN(line, "\t", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			layer := imageLayer{CreatedBy: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(fields[2]), "/bin/sh -c #(nop)"))}
+			if fields[0] != "<missing>" {
+				layer.ID = fields[0]
+			}
+			if layer.Size, err = strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64); err != nil {
+				layer.Size = parseDockerSize(fields[1])
+			}
+			inspection.Layers = append(inspection.Layers, layer)
+		}
+	}
+
+	if packages {
+		inspection.PackageTool, inspection.Packages, err = imagePackages(image)
+		if err != nil {
+			Warning.logf("Could not list the packages of the image %s: %v", image, err)
+		}
+	}
+	return inspection, nil
+}
+
+// imagePackages lists the packages of the operating system of the image in a container of it, with dpkg, apk
+// or rpm. The entrypoint of the stack is not run.
+func imagePackages(image string) (string, []imagePackage, error) {
+	out, err := runtimeCommand("docker", "run", "--rm", "--network", "none", "--entrypoint", "/bin/sh", image, "-c", packageListing).Output()
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	tool := strings.TrimSpace(lines[0])
+	if tool == "none" {
+		return "", nil, errors.New("the image has no dpkg, apk or rpm")
+	}
+	var packages []imagePackage
+	for _, line := range lines[1:] {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) == 2 && fields[0] != "" {
+			packages = append(packages, imagePackage{fields[0], fields[1]})
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return tool, packages, nil
+}
+
+// sortedPairs returns the names and values of a map as table rows, sorted by name
+func sortedPairs(values map[string]string) [][2]string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs [][2]string
+	for _, name := range names {
+		pairs = append(pairs, [2]string{name, values[name]})
+	}
+	return pairs
+}
+
+// printStackInspection prints the sections of an inspection as tables
+func printStackInspection(inspection *stackInspection) {
+	var out strings.Builder
+	summary := uitable.New()
+	summary.MaxColWidth = 100
+	if inspection.Stack != "" {
+		summary.AddRow("Stack:", inspection.Stack+" "+inspection.Version)
+	}
+	summary.AddRow("Image:", inspection.Image)
+	summary.AddRow("ID:", inspection.ID)
+	summary.AddRow("Digests:", strings.Join(inspection.Digests, "\n"))
+	summary.AddRow("Created:", inspection.Created)
+	summary.AddRow("Platform:", inspection.Platform)
+	summary.AddRow("Size:", formatSize(inspection.Size))
+	summary.AddRow("Ports:", strings.Join(inspection.Ports, ", "))
+	fmt.Fprintln(&out, summary)
+
+	section := func(title string, header []interface{}, rows [][]interface{}) {
+		fmt.Fprintf(&out, "\n%s\n", title)
+		if len(rows) == 0 {
+			fmt.Fprintln(&out, "  none")
+			return
+		}
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.AddRow(header...)
+		for _, row := range rows {
+			table.AddRow(row...)
+		}
+		fmt.Fprintln(&out, table)
+	}
+	var rows [][]interface{}
+	for _, pair := range sortedPairs(inspection.Runtimes) {
+		rows = append(rows, []interface{}{pair[0], pair[1]})
+	}
+	section("Runtimes:", []interface{}{"RUNTIME", "VERSION"}, rows)
+	rows = nil
+	for _, pair := range sortedPairs(inspection.Appsody) {
+		rows = append(rows, []interface{}{pair[0], pair[1]})
+	}
+	section("Appsody configuration:", []interface{}{"VARIABLE", "VALUE"}, rows)
+	rows = nil
+	for _, layer := range inspection.Layers {
+		rows = append(rows, []interface{}{formatSize(layer.Size), layer.CreatedBy})
+	}
+	section(fmt.Sprintf("Layers (%d, newest first):", len(inspection.Layers)), []interface{}{"SIZE", "CREATED BY"}, rows)
+	if inspectPackages {
+		rows = nil
+		for _, pkg := range inspection.Packages {
+			rows = append(rows, []interface{}{pkg.Name, pkg.Version})
+		}
+		section(fmt.Sprintf("Packages (%d, %s):", len(inspection.Packages), inspection.PackageTool), []interface{}{"PACKAGE", "VERSION"}, rows)
+	}
+	Info.log(strings.TrimRight(out.String(), "\n"))
+}
+
+var stackInspectCmd = &cobra.Command{
+	Use:   "inspect [<stack>[@version]|<image>]",
+	Short: "Show the layers, runtimes and Appsody configuration of a stack image",
+	Long: `This inspects the image of a stack and reports what a project of the stack runs on: the size and the instruction of
+each layer, the versions of the runtimes the image declares, such as NODE_VERSION or JAVA_VERSION, and the APPSODY_*
+variables that configure appsody run, test, build and deploy. Use --packages to also list the packages of its
+operating system, from dpkg, apk or rpm in a container of the image, as a software bill of materials.
+
+The stack is a stack of the repositories, such as nodejs or nodejs@0.2, or an image with its tag, such as
+appsody/nodejs:0.3. In a project, the stack of the project is inspected by default. The image is pulled first unless
+--no-pull is set. Use -o json or -o yaml to compare stacks or to feed a review.`,
+	Example: `  appsody stack inspect nodejs-express
+  appsody stack inspect appsody/java-microprofile:0.2 --packages -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		structured, err := structuredOutput()
+		if err != nil {
+			return err
+		}
+		var stack *ProjectVersion
+		image := ""
+		switch {
+		case len(args) == 0:
+			if _, err = getProjectDir(); err != nil {
+				return errors.New("Specify the stack or the image to inspect, such as appsody stack inspect nodejs")
+			}
+			config, err := readProjectConfig()
+			if err != nil {
+				return err
+			}
+			image = config.Platform
+		case strings.Contains(args[0], ":"):
+			image = args[0]
+		default:
+			var index RepoIndex
+			if err = index.getIndex(); err != nil {
+				return errors.Errorf("Could not read index: %v", err)
+			}
+			if stack, err = findStackVersion(&index, args[0]); err != nil {
+				return err
+			}
+			if image = stack.Image; image == "" {
+				if image, err = templatesStackImage(stack); err != nil {
+					return err
+				}
+			}
+		}
+		if dryrun {
+			if image == "" {
+				image = "the image of " + args[0]
+			}
+			if !inspectNoPull {
+				planned(planPullImage, image, "to inspect it")
+			}
+			return nil
+		}
+		if !inspectNoPull {
+			if err = dockerPullCmd(image); err != nil {
+				return errors.Errorf("Could not pull the image %s: %v", image, err)
+			}
+		}
+		inspection, err := inspectStackImage(image, inspectPackages)
+		if err != nil {
+			return err
+		}
+		if stack != nil {
+			inspection.Stack, inspection.Version = stack.Name, stack.Version
+		}
+		if structured {
+			return printStructured(inspection)
+		}
+		printStackInspection(inspection)
+		return nil
+	},
+}
+
+func init() {
+	stackCmd.AddCommand(stackInspectCmd)
+	stackInspectCmd.PersistentFlags().BoolVar(&inspectNoPull, "no-pull", false, "Inspect the local image, without pulling it.")
+	stackInspectCmd.PersistentFlags().BoolVar(&inspectPackages, "packages", false, "List the packages of the operating system of the image, running a container of it without network.")
+}
@@ -0,0 +1,91 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackLintCmd = &cobra.Command{
+	Use:   "lint [dir]",
+	Short: "Check the Dockerfile-stack of the stacks of a directory",
+	Long: `This checks that the image/Dockerfile-stack of every stack (any directory containing a stack.yaml) under [dir], or the
+current directory, sets the environment variables the appsody controller needs. It is the lint step of appsody stack
+ci. The problems can be written to a JUnit XML, JSON or SARIF report with --report-file, so that code scanning tools
+such as GitHub code scanning show them on the Dockerfile-stack. The command fails if any stack has one.`,
+	Example: `  appsody stack lint incubator
+  appsody stack lint . --report-file lint.sarif --report-format sarif`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+		if err := checkCIReportFormat(); err != nil {
+			return err
+		}
+		stacks, err := findLocalStacks(root)
+		if err != nil {
+			return err
+		}
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.Wrap = true
+		table.AddRow("STACK", "DIRECTORY", "RESULT")
+		var results []ciResult
+		failures := 0
+		for _, stack := range stacks {
+			start := time.Now()
+			result := ciResult{Stack: stack.ID, Step: "lint", file: ciStepFile(stack, "", "lint")}
+			for _, problem := range lintStack(stack) {
+				result.Errors = append(result.Errors, problem.Error())
+			}
+			result.Duration = time.Since(start)
+			results = append(results, result)
+			status := "passed"
+			if !result.passed() {
+				status = strings.Join(result.Errors, "; ")
+				failures++
+			}
+			table.AddRow(stack.ID, stack.Dir, status)
+		}
+		Info.log("\n", table)
+
+		if ciReportFile != "" {
+			if dryrun {
+				planned(planWrite, ciReportFile, "lint report")
+			} else {
+				if err = writeCIReport("stack lint", results, ciReportFormat, ciReportFile); err != nil {
+					return errors.Errorf("Could not write the lint report: %v", err)
+				}
+				Info.log("Lint report written to ", ciReportFile)
+			}
+		}
+		if failures > 0 {
+			return errors.Errorf("%d of %d stack(s) failed the lint checks", failures, len(stacks))
+		}
+		return nil
+	},
+}
+
+func init() {
+	stackCmd.AddCommand(stackLintCmd)
+	stackLintCmd.Flags().StringVar(&ciReportFile, "report-file", "", "Write the problems found to this file.")
+	stackLintCmd.Flags().StringVar(&ciReportFormat, "report-format", "junit", "Format of the report file: junit, json or sarif.")
+}
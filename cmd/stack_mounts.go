@@ -0,0 +1,161 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The kinds of the mounts a stack declares in APPSODY_MOUNTS
+const (
+	mountBind   = "bind"
+	mountVolume = "volume"
+	mountTmpfs  = "tmpfs"
+)
+
+// stackMount is one of the mounts of APPSODY_MOUNTS, separated by ;
+//
+//	<local>:<container>[:<options>]          a project path, or a path of the home with ~
+//	volume:<name>:<container>[:ro]           a docker named volume
+//	tmpfs:<container>[:<size=64m,...>]       a tmpfs, not kept between runs
+//
+// The bind options are ro, rw, and the z, Z, cached, delegated and consistent docker options, comma
+// separated. $VAR and ${VAR} in the paths and names are replaced with the environment variables,
+// APPSODY_PROJECT_NAME and APPSODY_PROJECT_DIR being set for the project.
+type stackMount struct {
+	Kind    string
+	Source  string
+	Target  string
+	Options []string
+	// Spec is the mount as the stack declares it
+	Spec string
+}
+
+var (
+	bindMountOptions  = map[string]bool{"ro": true, "rw": true, "z": true, "Z": true, "cached": true, "delegated": true, "consistent": true}
+	tmpfsMountOption  = regexp.MustCompile(`^(size=\d+[kmgKMG]?|mode=[0-7]{3,4}|ro|rw|noexec|exec|nosuid|nodev)$`)
+	volumeNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// parseStackMount parses a mount of APPSODY_MOUNTS. The errors name the mount.
+func parseStackMount(spec string, projectName string, projectDir string) (stackMount, error) {
+	mount := stackMount{Spec: spec}
+	var missing []string
+	expanded := os.Expand(spec, func(name string) string {
+		switch name {
+		case "APPSODY_PROJECT_NAME":
+			return projectName
+		case "APPSODY_PROJECT_DIR":
+			return filepath.ToSlash(projectDir)
+		}
+		value, found := os.LookupEnv(name)
+		if !found {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return mount, errors.Errorf("The stack mount %q uses %s, which is not set", spec, strings.Join(missing, ", "))
+	}
+	fail := func(format string, args ...interface{}) (stackMount, error) {
+		return mount, errors.Errorf("The stack mount %q is not valid: "+format, append([]interface{}{spec}, args...)...)
+	}
+	switch {
+	case strings.HasPrefix(expanded, "volume:"):
+		parts := strings.Split(strings.TrimPrefix(expanded, "volume:"), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fail("named volumes are volume:<name>:<container path>[:ro]")
+		}
+		if !volumeNamePattern.MatchString(parts[0]) {
+			return fail("%q is not a docker volume name", parts[0])
+		}
+		mount.Kind, mount.Source, mount.Target = mountVolume, parts[0], parts[1]
+		if len(parts) == 3 {
+			if parts[2] != "ro" && parts[2] != "rw" {
+				return fail("named volumes only take the ro or rw option, not %q", parts[2])
+			}
+			mount.Options = []string{parts[2]}
+		}
+	case strings.HasPrefix(expanded, "tmpfs:"):
+		parts := strings.SplitN(strings.TrimPrefix(expanded, "tmpfs:"), ":", 2)
+		mount.Kind, mount.Target = mountTmpfs, parts[0]
+		if len(parts) == 2 {
+			for _, option := range strings.Split(parts[1], ",") {
+				if !tmpfsMountOption.MatchString(option) {
+					return fail("unknown tmpfs option %q", option)
+				}
+				mount.Options = append(mount.Options, option)
+			}
+		}
+	default:
+		local, rest := splitLocalMountPath(expanded)
+		parts := strings.Split(rest, ":")
+		if local == "" || len(parts) < 1 || len(parts) > 2 || parts[0] == "" {
+			return fail("bind mounts are <local path>:<container path>[:<options>]")
+		}
+		mount.Kind, mount.Source, mount.Target = mountBind, local, parts[0]
+		if len(parts) == 2 {
+			for _, option := range strings.Split(parts[1], ",") {
+				if !bindMountOptions[option] {
+					return fail("unknown option %q, the bind options are ro, rw, z, Z, cached, delegated and consistent", option)
+				}
+				mount.Options = append(mount.Options, option)
+			}
+		}
+	}
+	if !path.IsAbs(mount.Target) {
+		return fail("the container path %q is not absolute", mount.Target)
+	}
+	return mount, nil
+}
+
+// splitLocalMountPath splits the local path of a bind mount from the rest, keeping the drive of
+// Windows paths, such as C:\dir, in the local path
+func splitLocalMountPath(spec string) (string, string) {
+	offset := 0
+	if runtime.GOOS == "windows" && len(spec) > 2 && unicode.IsLetter(rune(spec[0])) && spec[1] == ':' && (spec[2] == '\\' || spec[2] == '/') {
+		offset = 2
+	}
+	colon := strings.Index(spec[offset:], ":")
+	if colon < 0 {
+		return "", spec
+	}
+	return spec[:offset+colon], spec[offset+colon+1:]
+}
+
+// dockerArgs returns the docker run arguments of the mount, its local path already resolved
+func (m stackMount) dockerArgs() []string {
+	switch m.Kind {
+	case mountTmpfs:
+		if len(m.Options) > 0 {
+			return []string{"--tmpfs", m.Target + ":" + strings.Join(m.Options, ",")}
+		}
+		return []string{"--tmpfs", m.Target}
+	default:
+		volume := m.Source + ":" + m.Target
+		if len(m.Options) > 0 {
+			volume += ":" + strings.Join(m.Options, ",")
+		}
+		return []string{"-v", volume}
+	}
+}
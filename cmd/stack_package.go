@@ -0,0 +1,103 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackPackageDir string
+var stackPackageImageNamespace string
+
+var stackPackageCmd = &cobra.Command{
+	Use:   "package [dir]",
+	Short: "Package the templates of the stacks of a directory",
+	Long: `This validates every stack (any directory containing a stack.yaml) under [dir], or the current directory, and packages
+each of its templates into a <stack>.v<version>.templates.<template>.tar.gz archive of the --package-dir directory, the
+archives appsody init extracts. The sha256 digest of each archive is shown, for the index of a repository. The
+command fails if any stack is not valid.
+
+Use appsody stack index generate to package the stacks and write the index of a repository in one step.`,
+	Example: `  appsody stack package incubator/nodejs --package-dir dist`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+		stacks, err := findLocalStacks(root)
+		if err != nil {
+			return err
+		}
+		packaging := stackPackaging{stackPackageImageNamespace, func(archive string) string { return archive }}
+		table := uitable.New()
+		table.AddRow("STACK", "TEMPLATE", "ARCHIVE", "DIGEST")
+		var failed []string
+		for _, stack := range stacks {
+			if dryrun {
+				if err = planStackPackage(stack, stackPackageDir); err != nil {
+					Error.logf("Could not package the %s stack: %v", stack.ID, err)
+					failed = append(failed, stack.ID)
+				}
+				continue
+			}
+			if err = os.MkdirAll(stackPackageDir, 0755); err != nil {
+				return err
+			}
+			version, err := packageStackSource(stack, stackPackageDir, packaging)
+			if err != nil {
+				Error.logf("Could not package the %s stack: %v", stack.ID, err)
+				failed = append(failed, stack.ID)
+				continue
+			}
+			for _, template := range version.Templates {
+				table.AddRow(stack.ID, template.Name, template.URL, template.Digest)
+			}
+		}
+		if !dryrun {
+			Info.log("\n", table)
+		}
+		if len(failed) > 0 {
+			return errors.Errorf("%d of %d stack(s) could not be packaged: %v", len(failed), len(stacks), failed)
+		}
+		return nil
+	},
+}
+
+// planStackPackage validates a stack and adds the archives of its templates to the dry run plan
+func planStackPackage(stack stackSource, packageDir string) error {
+	if problems := validateStack(stack); len(problems) > 0 {
+		return problems[0]
+	}
+	stackYaml, err := readStackYaml(stack.Dir)
+	if err != nil {
+		return err
+	}
+	for _, template := range stack.Templates {
+		archive := filepath.Join(packageDir, stack.ID+".v"+stackYaml.Version+".templates."+template+".tar.gz")
+		planned(planWrite, archive, "template "+template+" of the "+stack.ID+" stack")
+	}
+	return nil
+}
+
+func init() {
+	stackCmd.AddCommand(stackPackageCmd)
+	stackPackageCmd.PersistentFlags().StringVar(&stackPackageDir, "package-dir", ".", "Directory to write the template archives to.")
+	stackPackageCmd.PersistentFlags().StringVar(&stackPackageImageNamespace, "image-namespace", "appsody", "Namespace of the stack images referenced by the packaged templates.")
+}
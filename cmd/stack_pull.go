@@ -0,0 +1,225 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackPullAll bool
+var stackPullRepo string
+
+var stackPullCmd = &cobra.Command{
+	Use:   "pull [<stack>[@version]...]",
+	Short: "Pull the images of stacks ahead of time",
+	Long: `This pulls the stack image of each stack, which appsody run, debug and test use, and the images of the
+stages of its build Dockerfile, which appsody build and deploy use, so they are on the machine before they are
+needed: to set up a workshop, bake the image of a CI runner, or prepare to work offline.
+
+Name the stacks as appsody init does, or use --all to pull every stack of the repositories, or of the repository
+--repo names.`,
+	Example: `  appsody stack pull nodejs-express java-microprofile@0.2
+  appsody stack pull --all --repo incubator`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if stackPullAll == (len(args) > 0) {
+			return errors.New("Name the stacks to pull, or use --all to pull every stack")
+		}
+		if stackPullRepo != "" && !stackPullAll {
+			return errors.New("--repo only applies to --all")
+		}
+		stacks, err := stacksToPull(args)
+		if err != nil {
+			return err
+		}
+		pulled := map[string]bool{}
+		failed := 0
+		pull := func(image string, stack *ProjectVersion) error {
+			if pulled[image] {
+				return nil
+			}
+			pulled[image] = true
+			Info.logf("Pulling %s for the %s stack", image, stack.Name)
+			err := dockerPullCmd(image)
+			if err != nil {
+				failed++
+			}
+			return err
+		}
+		for _, stack := range stacks {
+			stackImage := stack.Image
+			var err error
+			if stackImage == "" {
+				stackImage, err = templatesStackImage(stack)
+			}
+			if err != nil {
+				Error.logf("Could not find the image of the %s stack: %v", stack.Name, err)
+				failed++
+				continue
+			}
+			if stackImage == "" || pull(stackImage, stack) != nil || dryrun {
+				continue
+			}
+			stages, err := buildStageImages(stackImage)
+			if err != nil {
+				Warning.logf("Could not read the build Dockerfile of %s, only its stack image is pulled: %v", stackImage, err)
+				continue
+			}
+			for _, image := range stages {
+				_ = pull(image, stack)
+			}
+		}
+		if failed > 0 {
+			return errors.Errorf("%d of the stack images could not be pulled", failed)
+		}
+		if !dryrun {
+			Info.logf("Pulled %d image(s) for %d stack(s)", len(pulled), len(stacks))
+		}
+		return nil
+	},
+}
+
+// stacksToPull returns the stack versions named on the command line, or the latest version of every stack
+// of the repositories for --all
+func stacksToPull(specs []string) ([]*ProjectVersion, error) {
+	index := &RepoIndex{}
+	if stackPullRepo == "" {
+		if err := index.getIndex(); err != nil {
+			return nil, errors.Errorf("Could not read index: %v", err)
+		}
+	} else {
+		repos, err := stackRepos()
+		if err != nil {
+			return nil, err
+		}
+		var repo *RepositoryEntry
+		for _, entry := range repos.Repositories {
+			if entry.Name == stackPullRepo {
+				repo = entry
+			}
+		}
+		if repo == nil {
+			return nil, errors.Errorf("There is no %s repository.%s Run `appsody repo list` to see the repositories.", stackPullRepo, didYouMean(stackPullRepo, repos.repoNames()))
+		}
+		repoIndex, err := repo.downloadIndex()
+		if err != nil {
+			return nil, err
+		}
+		index = repoIndex
+	}
+	var stacks []*ProjectVersion
+	for _, spec := range specs {
+		stack, err := findStackVersion(index, spec)
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, stack)
+	}
+	if stackPullAll {
+		if err := index.loadShards(""); err != nil {
+			return nil, err
+		}
+		arch := localArch()
+		for id, versions := range index.Projects {
+			if len(versions) == 0 || !versions[0].supportsArch(arch) {
+				Debug.logf("Skipping stack %s, it is not available for %s", id, arch)
+				continue
+			}
+			stacks = append(stacks, versions[0])
+		}
+	}
+	return stacks, nil
+}
+
+// templatesStackImage returns the stack image of a stack, which the .appsody-config.yaml of its templates names
+func templatesStackImage(stack *ProjectVersion) (string, error) {
+	if len(stack.URLs) == 0 {
+		return "", errors.New("the stack has no templates")
+	}
+	scratch, err := scratchDir()
+	if err != nil {
+		return "", err
+	}
+	archive := filepath.Join(scratch, "pull-"+archiveName(stack.URLs[0]))
+	if err = downloadFileToDisk(stack.URLs[0], archive); err != nil || dryrun {
+		return "", err
+	}
+	defer os.Remove(archive)
+	stackImage := templateStackImage(archive)
+	if stackImage == "" {
+		return "", errors.Errorf("the %s template does not name the stack image", templateName(stack.URLs[0]))
+	}
+	return stackImage, nil
+}
+
+// buildStageImages returns the images the stages of the /project/Dockerfile of a stack image start from
+func buildStageImages(stackImage string) ([]string, error) {
+	scratch, err := scratchDir()
+	if err != nil {
+		return nil, err
+	}
+	containerName := "appsody-pull-" + strconv.Itoa(os.Getpid())
+	if err = execAndWaitReturnErr("docker", []string{"create", "--name", containerName, stackImage}, Debug); err != nil {
+		return nil, err
+	}
+	defer dockerRemove(containerName)
+	dockerfile := filepath.Join(scratch, "Dockerfile-"+containerName)
+	if err = execAndWaitReturnErr("docker", []string{"cp", containerName + ":/project/Dockerfile", dockerfile}, Debug); err != nil {
+		return nil, err
+	}
+	defer os.Remove(dockerfile)
+	file, err := os.Open(dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stages := map[string]bool{}
+	var images []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 1 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		image := fields[0]
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+		switch {
+		case stages[strings.ToLower(image)] || image == "scratch":
+		case strings.Contains(image, "$"):
+			Warning.logf("The build Dockerfile of %s starts a stage from %s, which a build argument sets, it is not pulled", stackImage, image)
+		default:
+			images = append(images, image)
+		}
+	}
+	return images, scanner.Err()
+}
+
+func init() {
+	stackCmd.AddCommand(stackPullCmd)
+	stackPullCmd.PersistentFlags().BoolVar(&stackPullAll, "all", false, "Pull the images of every stack")
+	stackPullCmd.PersistentFlags().StringVar(&stackPullRepo, "repo", "", "With --all, pull the images of the stacks of this repository only")
+}
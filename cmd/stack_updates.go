@@ -0,0 +1,134 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+)
+
+var listUpdates bool
+
+// checkUpdates is the --check-updates option of run, test, debug and build, also turned on by checkUpdates: true in the
+// CLI configuration
+var checkUpdates bool
+
+const (
+	updateCurrent   = "up to date"
+	updateAvailable = "update available"
+	updateUnknown   = "not in the repositories"
+)
+
+// stackUpdate is the stack of a project compared with the latest version of the stack in the repositories
+type stackUpdate struct {
+	Project    string `yaml:"project"`
+	Dir        string `yaml:"dir"`
+	Stack      string `yaml:"stack"`
+	Current    string `yaml:"current"`
+	Latest     string `yaml:"latest,omitempty"`
+	Repository string `yaml:"repository,omitempty"`
+	Status     string `yaml:"status"`
+}
+
+// checkStackUpdate compares the stack image of a project with the versions of its stack in the index. The tag of
+// the image can be a major.minor version, such as 0.2, which is up to date as long as the latest version is a 0.2.x
+// version. The latest tag is always up to date.
+func checkStackUpdate(index *RepoIndex, stackImage string) *stackUpdate {
+	image := stackImage
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	_, current := splitImageTag(image)
+	update := &stackUpdate{Stack: imageBaseName(image), Current: current, Status: updateUnknown}
+	versions, err := index.ByName(update.Stack)
+	if err != nil || len(versions) == 0 {
+		Debug.logf("The stack of %s is not in the repositories: %v", stackImage, err)
+		return update
+	}
+	latest := versions[0]
+	update.Latest, update.Repository = latest.Version, latest.repo
+	update.Status = updateCurrent
+	if current != "latest" && latest.Version != current && !strings.HasPrefix(latest.Version, current+".") && versionLess(current, latest.Version) {
+		update.Status = updateAvailable
+	}
+	return update
+}
+
+// listStackUpdates lists the projects of the workspaces, see appsody projects, with their stack compared with the
+// latest version of the stack in the repositories
+func listStackUpdates(index *RepoIndex, structured bool) error {
+	roots := workspaceRoots()
+	projects, err := findWorkspaceProjects(roots)
+	if err != nil {
+		return err
+	}
+	updates := []*stackUpdate{}
+	for _, project := range projects {
+		config, err := loadProjectConfig(project.Dir)
+		if err != nil {
+			Warning.logf("Could not read the project config of %s: %v", project.Dir, err)
+			continue
+		}
+		update := checkStackUpdate(index, config.Platform)
+		update.Project, update.Dir = project.Name, project.Dir
+		updates = append(updates, update)
+	}
+	if structured {
+		return printStructured(updates)
+	}
+	if len(updates) == 0 {
+		Info.log("No Appsody projects found in ", strings.Join(roots, ", "))
+		return nil
+	}
+	table := uitable.New()
+	table.MaxColWidth = 60
+	table.AddRow("PROJECT", "STACK", "CURRENT", "LATEST", "REPOSITORY", "STATUS", "PATH")
+	outdated := 0
+	for _, update := range updates {
+		table.AddRow(update.Project, update.Stack, update.Current, update.Latest, update.Repository, update.Status, update.Dir)
+		if update.Status == updateAvailable {
+			outdated++
+		}
+	}
+	Info.log("\n", table)
+	if outdated > 0 {
+		Info.logf("%d of %d projects can move to a newer stack version: change the stack of .appsody-config.yaml to the latest version and run appsody run to check the project with it", outdated, len(updates))
+	}
+	index.logOffline()
+	return nil
+}
+
+// checkUpdatesEnabled tells whether run, test, debug and build hint at a newer version of the stack of the project
+func checkUpdatesEnabled() bool {
+	return checkUpdates || cliConfig.GetBool("checkUpdates") || strings.EqualFold(os.Getenv("APPSODY_CHECK_UPDATES"), "true")
+}
+
+// hintStackUpdate prints a one-line hint when the repositories have a newer version of the stack of the project.
+// It never fails the command, the repositories are only read when the check is turned on.
+func hintStackUpdate(stackImage string) {
+	if !checkUpdatesEnabled() {
+		return
+	}
+	var index RepoIndex
+	if err := index.getIndex(); err != nil {
+		Debug.log("Could not check for a newer stack version: ", errors.Cause(err))
+		return
+	}
+	if update := checkStackUpdate(&index, stackImage); update.Status == updateAvailable {
+		Info.logf("The %s stack %s is available in the %s repository, this project uses %s. Run appsody list --updates for the details.", update.Stack, update.Latest, update.Repository, update.Current)
+	}
+}
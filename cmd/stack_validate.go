@@ -0,0 +1,82 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var stackValidateCmd = &cobra.Command{
+	Use:   "validate [dir]",
+	Short: "Check the stacks of a directory before they are packaged",
+	Long: `This checks every stack (any directory containing a stack.yaml) under [dir], or the current directory: the metadata
+of its stack.yaml, the environment variables its image/Dockerfile-stack must set for the appsody controller, and its
+templates. Every problem is shown, not just the first one, and the command fails if any stack has one.`,
+	Example: `  appsody stack validate incubator/nodejs
+  appsody stack validate .`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+		stacks, err := findLocalStacks(root)
+		if err != nil {
+			return err
+		}
+		table := uitable.New()
+		table.MaxColWidth = 100
+		table.Wrap = true
+		table.AddRow("STACK", "DIRECTORY", "RESULT")
+		invalid := 0
+		for _, stack := range stacks {
+			problems := append(lintStack(stack), validateStack(stack)...)
+			result := "valid"
+			if len(problems) > 0 {
+				var messages []string
+				for _, problem := range problems {
+					messages = append(messages, problem.Error())
+				}
+				result = strings.Join(messages, "; ")
+				invalid++
+			}
+			table.AddRow(stack.ID, stack.Dir, result)
+		}
+		Info.log("\n", table)
+		if invalid > 0 {
+			return errors.Errorf("%d of %d stack(s) are not valid", invalid, len(stacks))
+		}
+		return nil
+	},
+}
+
+// findLocalStacks discovers the stacks of a directory, which must have at least one
+func findLocalStacks(root string) ([]stackSource, error) {
+	stacks, err := discoverStacks(root)
+	if err != nil {
+		return nil, errors.Errorf("Could not search %s for stacks: %v", root, err)
+	}
+	if len(stacks) == 0 {
+		return nil, errors.Errorf("No stacks were found in %s", root)
+	}
+	return stacks, nil
+}
+
+func init() {
+	stackCmd.AddCommand(stackValidateCmd)
+}
@@ -0,0 +1,176 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var verifyNoPull bool
+
+// imageCheck is the outcome of comparing an attribute of a stack image with its index entry
+type imageCheck struct {
+	Name     string
+	Expected string
+	Actual   string
+	Status   string
+}
+
+// inspectedImage is what docker image inspect tells of a stack image
+type inspectedImage struct {
+	RepoDigests  []string
+	Os           string
+	Architecture string
+	Variant      string
+	Config       struct {
+		Env    []string
+		Labels map[string]string
+	}
+}
+
+var stackVerifyImageCmd = &cobra.Command{
+	Use:   "verify-image <stack>[@version]",
+	Short: "Check the published image of a stack against the repository index",
+	Long: `This pulls the stack image of a stack, or uses the local one with --no-pull, and compares it with the entry of the
+stack in the repository index: the digest the index pins, the dev.appsody.stack.version label with the version of the
+stack, the architecture with the architectures of the stack, and the environment variables every stack image sets.
+It fails when any of them does not match.
+
+The image is the one the index names in its image field, or else the one the templates of the stack name.`,
+	Example: `  appsody stack verify-image nodejs-express
+  appsody stack verify-image java-microprofile@0.2 --no-pull`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Specify the stack, such as appsody stack verify-image nodejs-express")
+		}
+		var index RepoIndex
+		if err := index.getIndex(); err != nil {
+			return errors.Errorf("Could not read index: %v", err)
+		}
+		stack, err := findStackVersion(&index, args[0])
+		if err != nil {
+			return err
+		}
+		stackImage := stack.Image
+		if stackImage == "" {
+			if stackImage, err = templatesStackImage(stack); err != nil {
+				return err
+			}
+		}
+		if dryrun {
+			if stackImage != "" && !verifyNoPull {
+				planned(planPullImage, stackImage, "to verify it")
+			}
+			return nil
+		}
+		if !verifyNoPull {
+			if err = dockerPullCmd(stackImage); err != nil {
+				return errors.Errorf("Could not pull the stack image %s: %v", stackImage, err)
+			}
+		}
+		out, err := runtimeCommand("docker", "image", "inspect", "--format", "{{json .}}", stackImage).Output()
+		if err != nil {
+			return errors.Errorf("Could not inspect the stack image %s: %v", stackImage, err)
+		}
+		var image inspectedImage
+		if err = json.Unmarshal(out, &image); err != nil {
+			return errors.Errorf("Could not read the description of the stack image %s: %v", stackImage, err)
+		}
+		checks := verifyStackImage(stack, stackImage, image)
+		table := uitable.New()
+		table.MaxColWidth = 80
+		table.AddRow("CHECK", "INDEX", "IMAGE", "STATUS")
+		failed := 0
+		for _, check := range checks {
+			table.AddRow(check.Name, check.Expected, check.Actual, check.Status)
+			if check.Status == checkFailed {
+				failed++
+			}
+		}
+		Info.logf("Stack %s %s, image %s\n%s", stack.Name, stack.Version, stackImage, table)
+		if failed > 0 {
+			return errors.Errorf("The stack image does not match the index entry of %s in %d check(s)", args[0], failed)
+		}
+		return nil
+	},
+}
+
+// indexImageDigest returns the digest the index pins the stack image to, in its image reference or in the
+// digest of the entry when it is an image digest
+func indexImageDigest(stack *ProjectVersion) string {
+	if at := strings.LastIndex(stack.Image, "@"); at >= 0 {
+		return stack.Image[at+1:]
+	}
+	if strings.HasPrefix(stack.Digest, "sha256:") {
+		return stack.Digest
+	}
+	return ""
+}
+
+// verifyStackImage compares the inspected stack image with the index entry of the stack
+func verifyStackImage(stack *ProjectVersion, stackImage string, image inspectedImage) []imageCheck {
+	var checks []imageCheck
+	check := func(name string, expected string, actual string, ok bool) {
+		status := checkOK
+		switch {
+		case expected == "":
+			status = checkWarning
+			expected = "not in the index"
+		case !ok:
+			status = checkFailed
+		}
+		checks = append(checks, imageCheck{name, expected, actual, status})
+	}
+
+	digest := indexImageDigest(stack)
+	matched := false
+	for _, repoDigest := range image.RepoDigests {
+		matched = matched || digest != "" && strings.HasSuffix(repoDigest, "@"+digest)
+	}
+	check("digest", digest, strings.Join(image.RepoDigests, "\n"), matched)
+
+	version := image.Config.Labels[stackVersionLabel]
+	check("version", stack.Version, version, version == stack.Version)
+
+	platform := platformSpec{OS: image.Os, Arch: image.Architecture, Variant: image.Variant}.String()
+	check("architecture", strings.Join(stack.Architectures, ", "), platform, stack.supportsArch(platform))
+
+	var missing []string
+	for _, envVar := range requiredStackEnvVars {
+		found := false
+		for _, env := range image.Config.Env {
+			found = found || strings.HasPrefix(env, envVar+"=")
+		}
+		if !found {
+			missing = append(missing, envVar)
+		}
+	}
+	actual := "all set"
+	if len(missing) > 0 {
+		actual = "missing " + strings.Join(missing, ", ")
+	}
+	check("environment", strings.Join(requiredStackEnvVars, ", "), actual, len(missing) == 0)
+	return checks
+}
+
+func init() {
+	stackCmd.AddCommand(stackVerifyImageCmd)
+	stackVerifyImageCmd.PersistentFlags().BoolVar(&verifyNoPull, "no-pull", false, "Verify the local stack image, without pulling it.")
+}
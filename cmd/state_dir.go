@@ -0,0 +1,111 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// stateDirEnv overrides the directory the CLI writes in, as does stateDir in the CLI configuration
+const stateDirEnv = "APPSODY_STATE_DIR"
+
+// homeReadOnly is set when the appsody home can not be written, as in locked-down CI images. The configuration
+// and the repository file of the home are then only read, everything else is written in the state directory.
+var homeReadOnly bool
+
+// stateDirPath is the state directory ensureConfig picked
+var stateDirPath string
+
+// getStateDir returns the directory of the caches, logs, locks, scratch and project state of the CLI: the one
+// of APPSODY_STATE_DIR or of stateDir in the configuration, otherwise the appsody home, or a directory in the
+// user cache directory when the home is read-only
+func getStateDir() string {
+	if stateDirPath != "" {
+		return stateDirPath
+	}
+	if dir := configuredStateDir(); dir != "" {
+		return dir
+	}
+	return getHome()
+}
+
+// configuredStateDir returns the state directory the user chose, or an empty string
+func configuredStateDir() string {
+	if dir := os.Getenv(stateDirEnv); dir != "" {
+		return dir
+	}
+	if cliConfig != nil {
+		return cliConfig.GetString("stateDir")
+	}
+	return ""
+}
+
+// writableDir creates the directory when needed, and tells whether files can be created in it
+func writableDir(dir string) bool {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		Debug.logf("Could not create %s: %v", dir, err)
+		return false
+	}
+	probe, err := ioutil.TempFile(dir, ".write-check-")
+	if err != nil {
+		Debug.logf("Could not write in %s: %v", dir, err)
+		return false
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return true
+}
+
+// fallbackStateDirs are the directories written in when the home is read-only and no state directory is set
+func fallbackStateDirs() []string {
+	var dirs []string
+	if cache, err := os.UserCacheDir(); err == nil {
+		dirs = append(dirs, filepath.Join(cache, "appsody"))
+	}
+	return append(dirs, filepath.Join(os.TempDir(), "appsody-"+strconv.Itoa(os.Getuid())))
+}
+
+// chooseStateDir checks whether the home can be written, and picks the state directory. It returns an empty
+// string when no directory can be written.
+func chooseStateDir() string {
+	homeReadOnly = !writableDir(getHome())
+	if dir := configuredStateDir(); dir != "" {
+		if !writableDir(dir) {
+			return ""
+		}
+		return dir
+	}
+	if !homeReadOnly {
+		return getHome()
+	}
+	for _, dir := range fallbackStateDirs() {
+		if writableDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// verboseLogDir is the directory of the logs of --verbose. It is needed before the configuration is read, so
+// only APPSODY_STATE_DIR moves it from the home.
+func verboseLogDir() string {
+	if dir := os.Getenv(stateDirEnv); dir != "" {
+		return filepath.Join(dir, "logs")
+	}
+	return filepath.Join(homeDir(), ".appsody", "logs")
+}
@@ -15,8 +15,7 @@
 package cmd
 
 import (
-	"os"
-
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -30,12 +29,24 @@ Stops the docker container specified by the --name flag.
 If --name is not specified, the container name is determined from the current working directory (see default below).
 To see a list of all your running docker containers, run the command "docker ps". The name is in the last column.`,
 
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 
 		Info.log("Stopping development environment")
-		dockerStop(containerName)
+		stopErr := dockerStop(containerName)
+		// Stop the services the project depends on when stop is run in the project
+		if config, err := readProjectConfig(); err == nil {
+			projectName, _ := getProjectName()
+			if services := config.Services; len(services) > 0 {
+				stopServices(projectName, services, "")
+			}
+			// the sync volumes of appsody run --sync, when it did not remove them itself
+			removeSyncVolumes(projectName)
+		}
 		//dockerRemove(imageName) is not needed due to --rm flag
-		os.Exit(1)
+		if stopErr != nil {
+			return errors.Errorf("Error running docker command: %v", stopErr)
+		}
+		return nil
 	},
 }
 
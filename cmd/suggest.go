@@ -0,0 +1,127 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is how many of the closest names are suggested when a name is not found
+const maxSuggestions = 3
+
+// editDistance is the Levenshtein distance between two names: the number of characters to insert,
+// delete or replace to turn one into the other
+func editDistance(a string, b string) int {
+	source := []rune(a)
+	target := []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// suggestNames returns the candidates closest to a name that was not found, the closest first. A candidate
+// is close when it contains the name, or when at most a third of its characters differ.
+func suggestNames(name string, candidates []string) []string {
+	type scored struct {
+		name     string
+		distance int
+	}
+	lower := strings.ToLower(name)
+	var matches []scored
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if seen[candidate] || candidate == name {
+			continue
+		}
+		seen[candidate] = true
+		distance := editDistance(lower, strings.ToLower(candidate))
+		if len(lower) > 1 && strings.Contains(strings.ToLower(candidate), lower) {
+			distance = minInt(distance, 1)
+		}
+		threshold := (len(candidate) + 2) / 3
+		if distance <= threshold {
+			matches = append(matches, scored{candidate, distance})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance == matches[j].distance {
+			return matches[i].name < matches[j].name
+		}
+		return matches[i].distance < matches[j].distance
+	})
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// didYouMean returns the sentence suggesting the closest candidates to append to a not found error, or
+// an empty string when none is close
+func didYouMean(name string, candidates []string) string {
+	suggestions := suggestNames(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return " Did you mean " + strings.Join(suggestions, ", ") + "?"
+}
+
+// stackNames returns the names of the stacks of the merged index, see displayID. The id alone of a stack of
+// several repositories is a name too, as it is most often the one mistyped.
+func (index *RepoIndex) stackNames() []string {
+	if err := index.loadShards(""); err != nil {
+		Debug.log("Could not list every stack: ", err)
+	}
+	var names []string
+	for key := range index.Projects {
+		name := index.displayID(key)
+		names = append(names, name)
+		if repo, id := splitStackKey(key); name == key && repo != "" && !index.isolated(repo) {
+			names = append(names, id)
+		}
+	}
+	return names
+}
+
+// repoNames returns the names of the configured repositories
+func (r *RepositoryFile) repoNames() []string {
+	var names []string
+	for _, repo := range r.Repositories {
+		names = append(names, repo.Name)
+	}
+	return names
+}
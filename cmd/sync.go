@@ -0,0 +1,235 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+var syncMode bool
+
+// syncDebounce is how long file changes are collected before they are copied into the container
+const syncDebounce = 300 * time.Millisecond
+
+// syncedMount is a project mount that is copied into a docker volume instead of being bind-mounted
+type syncedMount struct {
+	Local     string
+	Container string
+	Volume    string
+}
+
+// syncVolumeArgs replaces the bind mounts of directories inside the project with docker volumes.
+// Mounts outside the project, such as ~/.m2, are kept as bind mounts.
+func syncVolumeArgs(volumeArgs []string, projectDir string, projectName string) ([]string, []syncedMount) {
+	var args []string
+	var mounts []syncedMount
+	for i := 0; i+1 < len(volumeArgs); i += 2 {
+		mount := volumeArgs[i+1]
+		// the container path never contains a colon, the local path may on Windows
+		sep := strings.LastIndex(mount, ":")
+		local, container := mount[:sep], mount[sep+1:]
+		if volumeArgs[i] != "-v" || !insideDir(projectDir, filepath.FromSlash(local)) {
+			args = append(args, volumeArgs[i], mount)
+			continue
+		}
+		synced := syncedMount{
+			Local:     filepath.FromSlash(local),
+			Container: container,
+			Volume:    syncVolumePrefix(projectName) + strconv.Itoa(len(mounts)),
+		}
+		Debug.logf("Syncing %s into volume %s instead of bind mounting it", synced.Local, synced.Volume)
+		mounts = append(mounts, synced)
+		args = append(args, "-v", synced.Volume+":"+synced.Container)
+	}
+	return args, mounts
+}
+
+// insideDir tells whether the file is the directory or is in it
+func insideDir(dir string, file string) bool {
+	relPath, err := filepath.Rel(dir, file)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) && !filepath.IsAbs(relPath)
+}
+
+// removeSyncVolumes removes the sync volumes of the project, the next run populates new ones
+func removeSyncVolumes(projectName string) {
+	prefix := syncVolumePrefix(projectName)
+	out, err := runtimeCommand("docker", "volume", "ls", "-q", "--filter", "name="+prefix).Output()
+	if err != nil {
+		Debug.log("Could not list the sync volumes: ", err)
+		return
+	}
+	for _, volume := range strings.Fields(string(out)) {
+		// the name filter matches anywhere in the name, and the prefix of the project is the start of
+		// the one of its instances
+		if _, err := strconv.Atoi(strings.TrimPrefix(volume, prefix)); err != nil || !strings.HasPrefix(volume, prefix) {
+			continue
+		}
+		if err := execAndWaitReturnErr("docker", []string{"volume", "rm", volume}, Debug); err != nil && dockerVolumeExists(volume) {
+			Warning.logf("Could not remove the %s sync volume: %v", volume, err)
+		}
+	}
+}
+
+func dockerVolumeExists(name string) bool {
+	return runtimeCommand("docker", "volume", "inspect", name).Run() == nil
+}
+
+// populateSyncVolumes copies the current content of the project into new sync volumes, through a
+// container that is created (but never started) with the volumes mounted
+func populateSyncVolumes(stackImage string, projectName string, mounts []syncedMount) error {
+	helper := strings.TrimSuffix(syncVolumePrefix(projectName), "-")
+	// the helper container and the volumes of a run that did not end cleanly are left behind
+	if dockerContainerExists(helper) {
+		if err := dockerRemove(helper); err != nil {
+			return errors.Errorf("Could not remove the %s container left by a previous run: %v", helper, err)
+		}
+	}
+	removeSyncVolumes(projectName)
+	args := []string{"create", "--name", helper}
+	for _, mount := range mounts {
+		args = append(args, "-v", mount.Volume+":"+mount.Container)
+	}
+	args = append(args, stackImage)
+	if err := execAndWaitReturnErr("docker", args, Debug); err != nil {
+		return errors.Errorf("Could not create the container to populate the sync volumes: %v", err)
+	}
+	defer dockerRemove(helper)
+	for _, mount := range mounts {
+		Info.logf("Copying %s into the %s volume", mount.Local, mount.Volume)
+		err := execAndWaitReturnErr("docker", []string{"cp", mount.Local + string(os.PathSeparator) + ".", helper + ":" + mount.Container}, Debug)
+		if err != nil {
+			return errors.Errorf("Could not copy %s into the sync volume: %v", mount.Local, err)
+		}
+	}
+	return nil
+}
+
+// syncTarget is where file changes are synced to, a docker container or a Kubernetes pod
+type syncTarget interface {
+	copyFile(local string, target string) error
+	remove(target string) error
+}
+
+// dockerSyncTarget syncs into the named docker container
+type dockerSyncTarget string
+
+func (c dockerSyncTarget) copyFile(local string, target string) error {
+	// docker cp copies a directory into the target when it exists, its content is copied instead
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		local += string(os.PathSeparator) + "."
+	}
+	return execAndWaitReturnErr("docker", []string{"cp", local, string(c) + ":" + target}, Debug)
+}
+
+func (c dockerSyncTarget) remove(target string) error {
+	return execAndWaitReturnErr("docker", []string{"exec", string(c), "rm", "-rf", target}, Debug)
+}
+
+// watchAndSync watches the synced project directories and copies every change into the target.
+// Changes are batched so that saving many files at once, or a git checkout, results in a single copy per file.
+func watchAndSync(container syncTarget, mounts []syncedMount) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, mount := range mounts {
+		if err = addWatchRecursive(watcher, mount.Local); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	if dryrun {
+		planned(planRunCommand, "sync", fmt.Sprint("file changes into ", container))
+		return func() { watcher.Close() }, nil
+	}
+
+	go func() {
+		pending := make(map[string]bool)
+		timer := time.NewTimer(syncDebounce)
+		timer.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						_ = addWatchRecursive(watcher, event.Name)
+					}
+				}
+				pending[event.Name] = true
+				timer.Reset(syncDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				Warning.log("File sync watch error: ", err)
+			case <-timer.C:
+				for file := range pending {
+					syncFile(container, mounts, file)
+				}
+				pending = make(map[string]bool)
+			}
+		}
+	}()
+	return func() { watcher.Close() }, nil
+}
+
+func addWatchRecursive(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		return watcher.Add(file)
+	})
+}
+
+// syncFile copies a changed file into the container, or removes it from the container if it was deleted
+func syncFile(container syncTarget, mounts []syncedMount, file string) {
+	for _, mount := range mounts {
+		if !insideDir(mount.Local, file) {
+			continue
+		}
+		relPath, err := filepath.Rel(mount.Local, file)
+		if err != nil {
+			continue
+		}
+		target := path.Join(mount.Container, filepath.ToSlash(relPath))
+		if fileExists, _ := exists(file); fileExists {
+			Debug.log("Syncing ", file, " to ", target)
+			err = container.copyFile(file, target)
+		} else {
+			Debug.log("Removing ", target, " from the container")
+			err = container.remove(target)
+		}
+		if err != nil {
+			Warning.logf("Could not sync %s into the container: %v", file, err)
+		}
+		return
+	}
+}
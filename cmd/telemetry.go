@@ -0,0 +1,120 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Telemetry is the OpenTelemetry collector the application exports its traces, metrics and logs to with
+// --otel, configured in .appsody-config.yaml and replaced per environment:
+//
+//   telemetry:
+//     endpoint: http://host.docker.internal:4318
+//     protocol: http/protobuf
+//   environments:
+//     prod:
+//       telemetry:
+//         endpoint: http://otel-collector.observability:4317
+//         protocol: grpc
+//
+// Stacks enable their auto-instrumentation agent, such as the OpenTelemetry Java agent or the Node.js
+// auto-instrumentations, with the variables they list in the APPSODY_OTEL_AGENT variable of the stack image,
+// such as JAVA_TOOL_OPTIONS=-javaagent:/opt/otel/opentelemetry-javaagent.jar.
+type Telemetry struct {
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Protocol is grpc, http/protobuf or http/json, the default of the SDK when empty
+	Protocol string `yaml:"protocol,omitempty"`
+	// NoAgent leaves the agent of the stack off, for applications that set up the SDK themselves
+	NoAgent bool `yaml:"noAgent,omitempty"`
+}
+
+// the --otel and --otel-endpoint options of run, debug, test and deploy
+var otelEnabled bool
+var otelEndpoint string
+
+// deployEnv are the variables of the project being deployed, GenKnativeYaml sets them on the container
+var deployEnv []string
+
+var otelProtocols = map[string]bool{"grpc": true, "http/protobuf": true, "http/json": true}
+
+// telemetryEnv returns the variables pointing the application at the collector, with the ones enabling the
+// agent of the stack, or nothing without --otel. The environment replaces the telemetry of the project.
+func telemetryEnv(serviceName string, environmentName string, environment *Environment) ([]string, error) {
+	if !otelEnabled && otelEndpoint == "" {
+		return nil, nil
+	}
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	telemetry := Telemetry{}
+	if project := config.Telemetry; project != nil {
+		telemetry = *project
+	}
+	if environment != nil && environment.Telemetry != nil {
+		if environment.Telemetry.Endpoint != "" {
+			telemetry.Endpoint = environment.Telemetry.Endpoint
+		}
+		if environment.Telemetry.Protocol != "" {
+			telemetry.Protocol = environment.Telemetry.Protocol
+		}
+		telemetry.NoAgent = telemetry.NoAgent || environment.Telemetry.NoAgent
+	}
+	if otelEndpoint != "" {
+		telemetry.Endpoint = otelEndpoint
+	}
+	if telemetry.Endpoint == "" {
+		return nil, errors.Errorf("--otel needs the endpoint of an OpenTelemetry collector: set telemetry.endpoint in %s or use --otel-endpoint", ConfigFile)
+	}
+	if telemetry.Protocol != "" && !otelProtocols[telemetry.Protocol] {
+		return nil, errors.Errorf("The telemetry protocol %q is not one of grpc, http/protobuf or http/json", telemetry.Protocol)
+	}
+	env := []string{"OTEL_EXPORTER_OTLP_ENDPOINT=" + telemetry.Endpoint, "OTEL_SERVICE_NAME=" + serviceName}
+	if telemetry.Protocol != "" {
+		env = append(env, "OTEL_EXPORTER_OTLP_PROTOCOL="+telemetry.Protocol)
+	}
+	if environmentName != "" {
+		env = append(env, "OTEL_RESOURCE_ATTRIBUTES=deployment.environment="+environmentName)
+	}
+	if telemetry.NoAgent {
+		return env, nil
+	}
+	agent, err := getEnvVarList("APPSODY_OTEL_AGENT")
+	if err != nil {
+		return nil, err
+	}
+	if len(agent) == 0 {
+		Info.log("The stack has no OpenTelemetry agent, the application exports its telemetry only if it uses the OpenTelemetry SDK")
+	}
+	for _, variable := range agent {
+		if !strings.Contains(variable, "=") {
+			return nil, errors.Errorf("APPSODY_OTEL_AGENT has %q, it lists NAME=VALUE variables", variable)
+		}
+		env = append(env, variable)
+	}
+	return env, nil
+}
+
+// envArgs returns the docker run options setting the variables
+func envArgs(env []string) []string {
+	var args []string
+	for _, variable := range env {
+		args = append(args, "-e", variable)
+	}
+	return args
+}
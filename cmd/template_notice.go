@@ -0,0 +1,136 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// noticeFile is the attribution file init writes in the project, next to the files of the template
+const noticeFile = "NOTICE"
+
+// noticeMarker starts the attribution of the template in the noticeFile, after the notices of the template itself
+const noticeMarker = "Appsody template attribution"
+
+var noNotice bool
+
+// scaffoldStack is the stack version init lays down the template of, recorded in the scaffold manifest and the
+// NOTICE of the project, with its id
+var scaffoldStack *ProjectVersion
+var scaffoldStackID string
+
+// templateProvenance is where the starter code of a project comes from
+type templateProvenance struct {
+	Repository string `yaml:"repository,omitempty"`
+	StackID    string `yaml:"stackId,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+	Template   string `yaml:"template,omitempty"`
+	Sample     string `yaml:"sample,omitempty"`
+	Source     string `yaml:"source"`
+	Digest     string `yaml:"digest,omitempty"`
+	License    string `yaml:"license,omitempty"`
+	Home       string `yaml:"home,omitempty"`
+}
+
+// newTemplateProvenance describes the archive downloaded from templateURL, with the stack init uses
+func newTemplateProvenance(archive string, templateURL string) *templateProvenance {
+	provenance := &templateProvenance{Source: templateURL}
+	if digest, err := fileSha256(archive); err == nil {
+		provenance.Digest = "sha256:" + digest
+	}
+	if stack := scaffoldStack; stack != nil {
+		provenance.Repository, provenance.StackID, provenance.Version = stack.repo, scaffoldStackID, stack.Version
+		provenance.License, provenance.Home = stack.License, stack.Home
+		for _, template := range stack.Templates {
+			if template.URL == templateURL {
+				provenance.Template = template.Name
+			}
+		}
+		for _, sample := range stack.Samples {
+			if sample.URL == templateURL {
+				provenance.Sample = sample.Name
+			}
+		}
+		if provenance.Template == "" && provenance.Sample == "" && len(stack.URLs) > 0 && stack.URLs[0] == templateURL {
+			provenance.Template = "default"
+		}
+	}
+	return provenance
+}
+
+// notice returns the attribution of the starter code, for the NOTICE of the project
+func (p *templateProvenance) notice(created time.Time) string {
+	var notice strings.Builder
+	fmt.Fprintf(&notice, "%s\n%s\n\n", noticeMarker, strings.Repeat("=", len(noticeMarker)))
+	notice.WriteString("Parts of this project were generated by the Appsody CLI (https://appsody.dev) from the starter code of a stack.\n\n")
+	row := func(name string, value string) {
+		if value != "" {
+			fmt.Fprintf(&notice, "%-11s %s\n", name+":", value)
+		}
+	}
+	stack := p.StackID
+	if stack != "" && p.Version != "" {
+		stack += " " + p.Version
+	}
+	if stack != "" && p.Repository != "" {
+		stack += ", from the " + p.Repository + " repository"
+	}
+	row("Stack", stack)
+	row("Template", p.Template)
+	row("Sample", p.Sample)
+	row("Source", p.Source)
+	row("Digest", p.Digest)
+	license := p.License
+	if license == "" {
+		license = "not declared by the stack, see its home"
+	}
+	row("License", license)
+	row("Home", p.Home)
+	row("Created", created.UTC().Format(time.RFC3339)+" with Appsody CLI "+VERSION)
+	notice.WriteString("\nThe starter code is provided under the license of the stack. Keep this notice with the project.\n")
+	return notice.String()
+}
+
+// writeTemplateNotice adds the attribution of the starter code to the NOTICE of the project, after the notices
+// the template brings. It only warns when it can not, the project is usable without it.
+func writeTemplateNotice(provenance *templateProvenance, created time.Time) {
+	if noNotice {
+		return
+	}
+	if dryrun {
+		planned(planWrite, noticeFile, "the stack, template, source and license of the starter code")
+		return
+	}
+	notice := provenance.notice(created)
+	existing, err := ioutil.ReadFile(noticeFile)
+	switch {
+	case err == nil && strings.Contains(string(existing), noticeMarker):
+		Debug.log("The NOTICE of the project already has the attribution of the template")
+		return
+	case err == nil:
+		notice = strings.TrimRight(string(existing), "\n") + "\n\n" + notice
+	case !os.IsNotExist(err):
+		Warning.log("Could not read the NOTICE of the project, the attribution of the template is not recorded: ", err)
+		return
+	}
+	if err = ioutil.WriteFile(noticeFile, []byte(notice), 0644); err != nil {
+		Warning.log("Could not write the attribution of the template to the NOTICE of the project: ", err)
+		return
+	}
+	Debug.logw("Recorded the attribution of the template", "file", noticeFile, "source", provenance.Source)
+}
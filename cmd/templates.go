@@ -0,0 +1,95 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates <stack>[@version]",
+	Short: "List the templates of a stack",
+	Long: `This lists the templates of a stack, with their descriptions and the URLs they are downloaded from. The
+default template, the one appsody init uses without a template argument, is marked with a *.
+
+Create a project with another template with appsody init <stack> <template>.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Specify the stack, such as appsody templates nodejs-express")
+		}
+		var index RepoIndex
+		if err := index.getIndex(); err != nil {
+			return errors.Errorf("Could not read index: %v", err)
+		}
+		stack, err := findStackVersion(&index, args[0])
+		if err != nil {
+			return err
+		}
+		if structured, err := structuredOutput(); structured || err != nil {
+			if err != nil {
+				return err
+			}
+			return printStructured(stack.stackTemplates())
+		}
+		table := uitable.New()
+		table.MaxColWidth = 120
+		table.AddRow("", "NAME", "DESCRIPTION", "URL")
+		for i, template := range stack.stackTemplates() {
+			isDefault := ""
+			if i == 0 {
+				isDefault = "*"
+			}
+			table.AddRow(isDefault, template.Name, template.Description, template.URL)
+		}
+		Info.log(table.String())
+		return nil
+	},
+}
+
+// stackTemplates returns the templates of a stack, the default one first. For indexes without templates
+// their names come from the archive names.
+func (p *ProjectVersion) stackTemplates() []StackTemplate {
+	described := map[string]StackTemplate{}
+	for _, template := range p.Templates {
+		described[template.URL] = template
+	}
+	var templates []StackTemplate
+	for _, templateURL := range p.URLs {
+		template, ok := described[templateURL]
+		if !ok {
+			template = StackTemplate{Name: templateName(templateURL), URL: templateURL}
+		}
+		templates = append(templates, template)
+	}
+	return templates
+}
+
+// findTemplate returns the template of a stack with the name
+func (p *ProjectVersion) findTemplate(name string) (*StackTemplate, error) {
+	var names []string
+	for _, template := range p.stackTemplates() {
+		if template.Name == name {
+			return &template, nil
+		}
+		names = append(names, template.Name)
+	}
+	return nil, errors.Errorf("The %s stack has no template %q.%s Run `appsody templates %s` to see its templates.", p.Name, name, didYouMean(name, names), p.Name)
+}
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+}
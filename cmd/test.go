@@ -13,14 +13,36 @@
 // limitations under the License.
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// testAll is the --all option of test, to test every project of the workspace
+var testAll bool
 
 // testCmd represents the test command
 var testCmd = &cobra.Command{
 	Use:   "test",
 	Short: "Test your project in the local Appsody environment",
-	Long:  `This starts a docker container for your project and runs your test in it.`,
+	Long: `This starts a docker container for your project and runs your test in it.
+
+With --test-results, the results of the tests are collected in a directory as JUnit XML, junit.xml, with a summary
+in summary.json. Stacks declare where their tests leave the results with APPSODY_TEST_RESULTS, container paths
+separated by ;, and their format with APPSODY_TEST_RESULTS_FORMAT: junit, the default, tap or go-json. Their
+test scripts can also write the results in the directory of APPSODY_TEST_RESULTS_DIR.
+
+In a workspace with an ` + "`" + `appsody-workspace.yaml` + "`" + ` file, --all tests every project in dependency order, each in its own
+appsody process, and --parallel N tests N projects at a time. Their output is interleaved, each line prefixed
+with its project, and a summary of the tests ends it. Projects tested at the same time must not publish the same
+ports.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if testAll {
+			return runWorkspaceCommand(cmd)
+		}
+		if cmd.Flags().Changed("parallel") {
+			return errors.New("--parallel is for --all, to test several projects of the workspace at a time")
+		}
 
 		Info.log("Running test environment")
 		return commonCmd(cmd, args, "test")
@@ -30,5 +52,8 @@ var testCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(testCmd)
 	addDevCommonFlags(testCmd)
+	testCmd.PersistentFlags().BoolVar(&testAll, "all", false, "Test every project of the "+WorkspaceFile+" workspace, in dependency order.")
+	testCmd.PersistentFlags().IntVar(&workspaceParallel, "parallel", 1, "With --all, test this many projects at a time, each once the projects it depends on are tested.")
+	testCmd.PersistentFlags().StringVar(&testResultsDir, "test-results", "", "Collect the test results of the stack in this directory, as junit.xml for the CI systems and summary.json.")
 
 }
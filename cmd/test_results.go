@@ -0,0 +1,369 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var testResultsDir string
+
+// containerTestResultsDir is mounted from a local directory with --test-results, the stack test scripts
+// find it in APPSODY_TEST_RESULTS_DIR and can write their results in it
+const containerTestResultsDir = "/appsody/test-results"
+
+// The formats of the test results of the stacks, APPSODY_TEST_RESULTS_FORMAT
+const (
+	testFormatJUnit  = "junit"
+	testFormatTAP    = "tap"
+	testFormatGoJSON = "go-json"
+)
+
+// testSummary is the summary.json written next to junit.xml
+type testSummary struct {
+	Tests    int                 `json:"tests"`
+	Passed   int                 `json:"passed"`
+	Failures int                 `json:"failures"`
+	Errors   int                 `json:"errors"`
+	Skipped  int                 `json:"skipped"`
+	Time     float64             `json:"time"`
+	Files    []string            `json:"files"`
+	Suites   []testSuiteSummary  `json:"suites"`
+	Failed   []testFailedSummary `json:"failed,omitempty"`
+}
+
+type testSuiteSummary struct {
+	Name     string  `json:"name"`
+	Tests    int     `json:"tests"`
+	Failures int     `json:"failures"`
+	Errors   int     `json:"errors"`
+	Skipped  int     `json:"skipped"`
+	Time     float64 `json:"time"`
+}
+
+type testFailedSummary struct {
+	Suite   string `json:"suite"`
+	Name    string `json:"name"`
+	Message string `json:"message,omitempty"`
+}
+
+// testResultsArgs returns the docker run arguments that mount the local directory the results are
+// collected in, with --test-results
+func testResultsArgs(mode string) ([]string, string, error) {
+	if mode != "test" || testResultsDir == "" {
+		return nil, "", nil
+	}
+	scratch, err := scratchDir()
+	if err != nil {
+		return nil, "", err
+	}
+	local := filepath.Join(scratch, "test-results")
+	if err = os.MkdirAll(local, 0777); err != nil {
+		return nil, "", err
+	}
+	// the tests can run as another user than the CLI
+	_ = os.Chmod(local, 0777)
+	return []string{"-v", filepath.ToSlash(local) + ":" + containerTestResultsDir, "-e", "APPSODY_TEST_RESULTS_DIR=" + containerTestResultsDir}, local, nil
+}
+
+// collectTestResults reads the results of the tests from the directory mounted by testResultsArgs, and
+// from the paths of APPSODY_TEST_RESULTS in the container mapped to the local directories of the mounts,
+// then writes them as junit.xml and summary.json in the --test-results directory
+func collectTestResults(mountedDir string, volumeArgs []string) error {
+	format, err := getEnvVar("APPSODY_TEST_RESULTS_FORMAT")
+	if err != nil {
+		return err
+	}
+	format = strings.ToLower(format)
+	if format == "" {
+		format = testFormatJUnit
+	}
+	if format != testFormatJUnit && format != testFormatTAP && format != testFormatGoJSON {
+		return errors.Errorf("The stack test results format %q is not supported, it must be junit, tap or go-json", format)
+	}
+	var files []string
+	if mountedDir != "" {
+		found, _ := filepath.Glob(filepath.Join(mountedDir, "*"))
+		files = append(files, found...)
+	}
+	containerPaths, err := getEnvVarList("APPSODY_TEST_RESULTS")
+	if err != nil {
+		return err
+	}
+	for _, containerPath := range containerPaths {
+		local, ok := localMountPath(containerPath, volumeArgs)
+		if !ok {
+			Warning.logf("The test results in %s are not in a directory mounted from the project, they can not be collected", containerPath)
+			continue
+		}
+		found, _ := filepath.Glob(local)
+		files = append(files, found...)
+	}
+	files = expandResultDirs(files)
+	if len(files) == 0 {
+		return errors.New("The tests left no results to collect. The stack declares where they are with APPSODY_TEST_RESULTS, or its test scripts write them in APPSODY_TEST_RESULTS_DIR.")
+	}
+	var suites junitTestSuites
+	for _, file := range files {
+		parsed, err := parseTestResults(file, format)
+		if err != nil {
+			Warning.logf("Could not read the test results of %s: %v", file, err)
+			continue
+		}
+		suites.Suites = append(suites.Suites, parsed...)
+	}
+	summary := summarizeTestSuites(&suites)
+	for _, file := range files {
+		summary.Files = append(summary.Files, filepath.ToSlash(file))
+	}
+	report, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(testResultsDir, 0755); err != nil {
+		return err
+	}
+	junitFile := filepath.Join(testResultsDir, "junit.xml")
+	if err = ioutil.WriteFile(junitFile, append([]byte(xml.Header), append(report, '\n')...), 0644); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(testResultsDir, "summary.json"), append(summaryJSON, '\n'), 0644); err != nil {
+		return err
+	}
+	Info.logf("Test results: %d tests, %d passed, %d failed, %d errors, %d skipped, written in %s", summary.Tests, summary.Passed, summary.Failures, summary.Errors, summary.Skipped, junitFile)
+	return nil
+}
+
+// localMountPath maps a path in the container to the local path of the mount holding it
+func localMountPath(containerPath string, volumeArgs []string) (string, bool) {
+	best, bestTarget := "", ""
+	for i := 0; i+1 < len(volumeArgs); i += 2 {
+		if volumeArgs[i] != "-v" {
+			continue
+		}
+		local, rest := splitLocalMountPath(volumeArgs[i+1])
+		target := strings.Split(rest, ":")[0]
+		if !filepath.IsAbs(local) {
+			// named volumes are not local
+			continue
+		}
+		if (containerPath == target || strings.HasPrefix(containerPath, strings.TrimSuffix(target, "/")+"/")) && len(target) > len(bestTarget) {
+			best, bestTarget = local, target
+		}
+	}
+	if bestTarget == "" {
+		return "", false
+	}
+	relative := strings.TrimPrefix(strings.TrimPrefix(path.Clean(containerPath), path.Clean(bestTarget)), "/")
+	return filepath.Join(best, filepath.FromSlash(relative)), true
+}
+
+// expandResultDirs replaces the directories with the files in them
+func expandResultDirs(paths []string) []string {
+	var files []string
+	for _, file := range paths {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, file)
+			continue
+		}
+		_ = filepath.Walk(file, func(walked string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, walked)
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func parseTestResults(file string, format string) ([]junitTestSuite, error) {
+	switch format {
+	case testFormatTAP:
+		return parseTAPResults(file)
+	case testFormatGoJSON:
+		return parseGoTestJSON(file)
+	}
+	if !strings.HasSuffix(strings.ToLower(file), ".xml") {
+		Debug.log("Skipping the test results file that is not XML: ", file)
+		return nil, nil
+	}
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var suites junitTestSuites
+	if err = xml.Unmarshal(source, &suites); err == nil {
+		return suites.Suites, nil
+	}
+	var suite junitTestSuite
+	if err = xml.Unmarshal(source, &suite); err != nil {
+		return nil, err
+	}
+	return []junitTestSuite{suite}, nil
+}
+
+var tapLine = regexp.MustCompile(`^(not ok|ok)\b\s*(\d+)?\s*-?\s*([^#]*)(#\s*(\w+)(.*))?$`)
+
+// parseTAPResults reads the Test Anything Protocol output, each file being a suite
+func parseTAPResults(file string) ([]junitTestSuite, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	suite := junitTestSuite{Name: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		match := tapLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		testCase := junitTestCase{Name: strings.TrimSpace(match[3]), ClassName: suite.Name, Time: "0.000"}
+		if testCase.Name == "" {
+			testCase.Name = "test " + match[2]
+		}
+		directive := strings.ToUpper(match[5])
+		switch {
+		case directive == "SKIP" || directive == "TODO":
+			testCase.Skipped = &junitFailure{Message: strings.TrimSpace(match[6])}
+		case match[1] == "not ok":
+			testCase.Failure = &junitFailure{Message: "not ok"}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	return []junitTestSuite{suite}, scanner.Err()
+}
+
+// goTestEvent is a line of go test -json
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// parseGoTestJSON reads go test -json output, each package being a suite
+func parseGoTestJSON(file string) ([]junitTestSuite, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var suites []junitTestSuite
+	suiteIndex := map[string]int{}
+	output := map[string]*strings.Builder{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event goTestEvent
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Test == "" {
+			continue
+		}
+		key := event.Package + "." + event.Test
+		if event.Action == "output" {
+			if output[key] == nil {
+				output[key] = &strings.Builder{}
+			}
+			output[key].WriteString(event.Output)
+			continue
+		}
+		if event.Action != "pass" && event.Action != "fail" && event.Action != "skip" {
+			continue
+		}
+		i, ok := suiteIndex[event.Package]
+		if !ok {
+			i = len(suites)
+			suiteIndex[event.Package] = i
+			suites = append(suites, junitTestSuite{Name: event.Package})
+		}
+		testCase := junitTestCase{Name: event.Test, ClassName: event.Package, Time: strconv.FormatFloat(event.Elapsed, 'f', 3, 64)}
+		var text string
+		if output[key] != nil {
+			text = output[key].String()
+		}
+		switch event.Action {
+		case "fail":
+			testCase.Failure = &junitFailure{Message: "failed", Contents: text}
+		case "skip":
+			testCase.Skipped = &junitFailure{Contents: text}
+		}
+		suites[i].TestCases = append(suites[i].TestCases, testCase)
+	}
+	return suites, scanner.Err()
+}
+
+// summarizeTestSuites counts the tests of each suite and of all of them
+func summarizeTestSuites(suites *junitTestSuites) testSummary {
+	var summary testSummary
+	total := 0.0
+	for i := range suites.Suites {
+		suite := &suites.Suites[i]
+		suiteTime, _ := strconv.ParseFloat(suite.Time, 64)
+		if len(suite.TestCases) > 0 {
+			suite.Tests, suite.Failures, suite.Errors, suite.Skipped = 0, 0, 0, 0
+			casesTime := 0.0
+			for _, testCase := range suite.TestCases {
+				suite.Tests++
+				caseTime, _ := strconv.ParseFloat(testCase.Time, 64)
+				casesTime += caseTime
+				switch {
+				case testCase.Failure != nil:
+					suite.Failures++
+					summary.Failed = append(summary.Failed, testFailedSummary{suite.Name, testCase.Name, testCase.Failure.Message})
+				case testCase.Error != nil:
+					suite.Errors++
+					summary.Failed = append(summary.Failed, testFailedSummary{suite.Name, testCase.Name, testCase.Error.Message})
+				case testCase.Skipped != nil:
+					suite.Skipped++
+				}
+			}
+			if suiteTime == 0 {
+				suite.Time = strconv.FormatFloat(casesTime, 'f', 3, 64)
+				suiteTime, _ = strconv.ParseFloat(suite.Time, 64)
+			}
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		total += suiteTime
+		summary.Suites = append(summary.Suites, testSuiteSummary{suite.Name, suite.Tests, suite.Failures, suite.Errors, suite.Skipped, suiteTime})
+	}
+	suites.Time = strconv.FormatFloat(total, 'f', 3, 64)
+	summary.Tests, summary.Failures, summary.Errors, summary.Skipped = suites.Tests, suites.Failures, suites.Errors, suites.Skipped
+	summary.Time, _ = strconv.ParseFloat(suites.Time, 64)
+	summary.Passed = summary.Tests - summary.Failures - summary.Errors - summary.Skipped
+	return summary
+}
@@ -0,0 +1,63 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// useTestHome creates a temporary appsody home, with the settings of config added to its CLI configuration, and
+// sets up the CLI configuration of it. repos is written as its repository file unless it is empty. The returned
+// function removes the home.
+func useTestHome(t *testing.T, config string, repos string) (string, string, func()) {
+	t.Helper()
+	configFile, home, cleanup, err := cmdtest.TempHome()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config != "" {
+		file, err := os.OpenFile(configFile, os.O_APPEND|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.WriteString(config)
+			file.Close()
+		}
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	if err = cmd.UseConfig(configFile); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if repos != "" {
+		writeRepoFile(t, home, repos)
+	}
+	return configFile, home, cleanup
+}
+
+// writeRepoFile writes the repository file of the appsody home
+func writeRepoFile(t *testing.T, home string, repos string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(home, "repository", "repository.yaml"), []byte(repos), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
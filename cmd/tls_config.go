@@ -0,0 +1,140 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The TLS options of the HTTP clients of the CLI, which win over the caFile, clientCert, clientKey and
+// insecureSkipTLSVerify settings of the CLI configuration
+var (
+	caFileFlag                string
+	clientCertFlag            string
+	clientKeyFlag             string
+	insecureSkipTLSVerifyFlag bool
+)
+
+var (
+	sharedTransportOnce sync.Once
+	sharedTransport     *http.Transport
+	sharedTransportErr  error
+)
+
+// tlsSetting returns the value of a TLS option, or of its setting in the configuration
+func tlsSetting(flag string, value string, key string) string {
+	if rootCmd.PersistentFlags().Changed(flag) {
+		return value
+	}
+	return cliConfig.GetString(key)
+}
+
+// httpTransport is the transport shared by the HTTP clients of the CLI: it goes through the proxy of the
+// HTTP_PROXY and HTTPS_PROXY environment variables, trusts the CA bundle of the configuration on top of the
+// system ones, presents the client certificate of the configuration, and reads file:// and oci:// URLs, and the
+// URLs of the object stores of the artifact fetchers, too
+func httpTransport() (*http.Transport, error) {
+	sharedTransportOnce.Do(func() {
+		tlsConfig, err := cliTLSConfig()
+		if err != nil {
+			sharedTransportErr = err
+			return
+		}
+		// the settings of http.DefaultTransport, which cannot be cloned with the Go 1.12 toolchain of the builds
+		t := &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig:       tlsConfig,
+		}
+		t.RegisterProtocol("file", fileTransport{})
+		t.RegisterProtocol("oci", ociTransport{t})
+		for scheme, fetcher := range artifactFetchers {
+			t.RegisterProtocol(scheme, fetcherTransport{base: t, fetcher: fetcher})
+		}
+		sharedTransport = t
+	})
+	return sharedTransport, sharedTransportErr
+}
+
+// newHTTPClient returns a client with the shared transport, giving up after the timeout unless it is 0
+func newHTTPClient(timeout time.Duration) (*http.Client, error) {
+	t, err := httpTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: cliTransport(t), Timeout: timeout}, nil
+}
+
+func cliTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile := tlsSetting("ca-file", caFileFlag, "caFile"); caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Errorf("Could not read the CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			Debug.log("Could not read the system certificates, trusting only the CA bundle: ", err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("The CA bundle %s has no PEM certificates", caFile)
+		}
+		config.RootCAs = pool
+	}
+	clientCert := tlsSetting("client-cert", clientCertFlag, "clientCert")
+	clientKey := tlsSetting("client-key", clientKeyFlag, "clientKey")
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, errors.New("A client certificate needs both clientCert and clientKey, or --client-cert and --client-key")
+		}
+		certificate, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, errors.Errorf("Could not load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	insecure := insecureSkipTLSVerifyFlag
+	if !rootCmd.PersistentFlags().Changed("insecure-skip-tls-verify") {
+		insecure = cliConfig.GetBool("insecureSkipTLSVerify")
+	}
+	if insecure {
+		Warning.log("The certificates of the servers are not verified, the downloads can be intercepted")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&caFileFlag, "ca-file", "", "PEM bundle of the CAs to trust on top of the system ones, such as the one of a TLS-intercepting proxy. Overrides caFile of the configuration.")
+	rootCmd.PersistentFlags().StringVar(&clientCertFlag, "client-cert", "", "PEM client certificate for the servers that require mutual TLS. Overrides clientCert of the configuration.")
+	rootCmd.PersistentFlags().StringVar(&clientKeyFlag, "client-key", "", "PEM private key of --client-cert. Overrides clientKey of the configuration.")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipTLSVerifyFlag, "insecure-skip-tls-verify", false, "Do not verify the certificates of the servers. Insecure, for testing only. Overrides insecureSkipTLSVerify of the configuration.")
+}
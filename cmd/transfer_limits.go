@@ -0,0 +1,158 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Bulk download commands, such as bundle export, can be told to go easy on shared artifact servers and office
+// links: --max-concurrent bounds the downloads at the same time, --limit-rate their combined bandwidth.
+var maxConcurrent int
+var limitRate string
+
+// transferLimiter paces the downloads of the command, nil when their bandwidth is not limited
+var transferLimiter *rateLimiter
+
+// transferRate matches a rate in bytes per second, with a k, m or g suffix for multiples of 1024
+var transferRate = regexp.MustCompile(`^([0-9]+)([kmgKMG]?)$`)
+
+// rateChunk is the most read from a limited download before it is paced, so that the rate stays smooth
+const rateChunk = 16 * 1024
+
+// rateLimiter paces the reads of all the downloads it is shared by to its rate
+type rateLimiter struct {
+	bytesPerSecond int64
+	lock           sync.Mutex
+	next           time.Time
+}
+
+// wait blocks until n more bytes can be read
+func (l *rateLimiter) wait(n int) {
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	delay := l.next.Sub(now)
+	l.lock.Unlock()
+	time.Sleep(delay)
+}
+
+// limitedReader reads through a rate limiter
+type limitedReader struct {
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r limitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateChunk {
+		p = p[:rateChunk]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
+
+// limitDownload paces a download when --limit-rate is set
+func limitDownload(reader io.Reader) io.Reader {
+	if transferLimiter == nil {
+		return reader
+	}
+	return limitedReader{reader, transferLimiter}
+}
+
+// parseRate returns the bytes per second of a rate such as 500k or 2m
+func parseRate(rate string) (int64, error) {
+	match := transferRate.FindStringSubmatch(strings.TrimSuffix(rate, "/s"))
+	if match == nil {
+		return 0, errors.Errorf("The rate %q is not a number of bytes per second, such as 500k or 2m", rate)
+	}
+	bytes, _ := strconv.ParseInt(match[1], 10, 64)
+	switch strings.ToLower(match[2]) {
+	case "k":
+		bytes *= 1024
+	case "m":
+		bytes *= 1024 * 1024
+	case "g":
+		bytes *= 1024 * 1024 * 1024
+	}
+	if bytes <= 0 {
+		return 0, errors.New("The rate must be more than 0")
+	}
+	return bytes, nil
+}
+
+// addTransferLimitFlags adds --max-concurrent and --limit-rate to a bulk download command
+func addTransferLimitFlags(cmd *cobra.Command, defaultConcurrent int) {
+	cmd.PersistentFlags().IntVar(&maxConcurrent, "max-concurrent", defaultConcurrent, "Number of files downloaded at the same time.")
+	cmd.PersistentFlags().StringVar(&limitRate, "limit-rate", "", "Bandwidth of the downloads together, in bytes per second with a k, m or g suffix, such as 500k or 2m. Not limited by default.")
+}
+
+// applyTransferLimits checks the --max-concurrent and --limit-rate options and sets up the limiter
+func applyTransferLimits() error {
+	if maxConcurrent < 1 {
+		return errors.New("--max-concurrent must be at least 1")
+	}
+	if limitRate == "" {
+		return nil
+	}
+	bytesPerSecond, err := parseRate(limitRate)
+	if err != nil {
+		return err
+	}
+	Debug.logf("Limiting the downloads to %d bytes per second", bytesPerSecond)
+	transferLimiter = &rateLimiter{bytesPerSecond: bytesPerSecond}
+	return nil
+}
+
+// forEachConcurrently calls fn for 0 to count-1 with --max-concurrent calls at the same time, and returns the
+// first error
+func forEachConcurrently(count int, fn func(i int) error) error {
+	errs := make([]error, count)
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxConcurrent; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// userAgentTransport sets the User-Agent of the requests of the CLI, so that proxies and artifact servers
+// can tell the appsody traffic apart
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// a RoundTripper must not modify the request it is given. Request.Clone is not in Go 1.12, the copy
+		// of WithContext shares the headers, so they are copied too.
+		header := make(http.Header, len(req.Header)+1)
+		for name, values := range req.Header {
+			header[name] = values
+		}
+		req = req.WithContext(req.Context())
+		req.Header = header
+		req.Header.Set("User-Agent", userAgent())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// userAgent is appsody-cli/<version> (<os>/<arch>), followed by the userAgentSuffix of the CLI configuration or
+// APPSODY_USER_AGENT_SUFFIX, for organizations that meter the traffic of their teams
+func userAgent() string {
+	version := VERSION
+	if version == "" {
+		version = "dev"
+	}
+	agent := "appsody-cli/" + strings.TrimPrefix(version, "v") + " (" + runtime.GOOS + "/" + runtime.GOARCH + ")"
+	suffix := os.Getenv("APPSODY_USER_AGENT_SUFFIX")
+	if suffix == "" && cliConfig != nil {
+		suffix = cliConfig.GetString("userAgentSuffix")
+	}
+	if suffix = strings.TrimSpace(suffix); suffix != "" {
+		agent += " " + suffix
+	}
+	return agent
+}
+
+// cliTransport wraps the transport of the HTTP clients of the CLI: it sets their User-Agent and traces them
+// with --trace-http, or answers them from the fixtures of APPSODY_FIXTURES
+func cliTransport(base http.RoundTripper) http.RoundTripper {
+	return userAgentTransport{traceTransport(fixturesTransport(base))}
+}
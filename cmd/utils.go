@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -26,12 +27,40 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
 )
 
+// ProjectConfig is the content of the .appsody-config.yaml file of a project
 type ProjectConfig struct {
-	Platform string
+	// ConfigVersion is the schema version of the file, see appsody migrate-config
+	ConfigVersion int    `yaml:"configVersion,omitempty"`
+	Platform      string `yaml:"stack"`
+	// StackDigest pins the stack image to a registry digest, sha256:...
+	StackDigest string                   `yaml:"stackDigest,omitempty"`
+	Services    []ServiceDependency      `yaml:"services,omitempty"`
+	Hooks       map[string][]ProjectHook `yaml:"hooks,omitempty"`
+	// Repository and RepositoryFile choose the catalog the stack of the project is resolved from
+	Repository     string `yaml:"repository,omitempty"`
+	RepositoryFile string `yaml:"repositoryFile,omitempty"`
+	// Availability is how deploy keeps the application available, see Availability
+	Availability *Availability `yaml:"availability,omitempty"`
+	// Probes override the probes of the stack, see Probe
+	Probes *Probes `yaml:"probes,omitempty"`
+	// Resources are the CPU and memory of the deployed container, see Resources
+	Resources *Resources `yaml:"resources,omitempty"`
+	// Environments are the settings of deploy --env, see Environment
+	Environments map[string]*Environment `yaml:"environments,omitempty"`
+	// Metrics overrides the metrics endpoint of the stack, see Metrics
+	Metrics *Metrics `yaml:"metrics,omitempty"`
+	// Telemetry is the collector of --otel, see Telemetry
+	Telemetry *Telemetry `yaml:"telemetry,omitempty"`
+	// Env are the variables of the application in run, debug, test and deploy. The values can refer to
+	// secrets with ${secret:<provider>:<ref>}, see expandSecretRefs.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Registry is the login of deploy --push, see RegistryLogin
+	Registry *RegistryLogin `yaml:"registry,omitempty"`
+	// Notifications tell when the builds, deploys and stack CI runs of the project end, see Notification
+	Notifications []Notification `yaml:"notifications,omitempty"`
 }
 
 type NotAnAppsodyProject string
@@ -58,36 +87,64 @@ func exists(path string) (bool, error) {
 	return true, err
 }
 
-func getEnvVar(searchEnvVar string) string {
-	// TODO cache this so the docker inspect command only runs once per cli invocation
+// fileExists tells whether a file can be found
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// stackImageConfigs are the Config sections of the docker image inspect of the stack images, by image
+var stackImageConfigs = make(map[string]map[string]interface{})
+
+// stackImageSettings pulls the stack image of the project and returns its configuration, each image is
+// inspected once per cli invocation
+func stackImageSettings() (map[string]interface{}, error) {
 	var data []map[string]interface{}
-	imageName := getProjectConfig().Platform
-	dockerPullImage(imageName)
+	config, err := readProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	imageName := config.Platform
+	if imageConfig, ok := stackImageConfigs[imageName]; ok {
+		return imageConfig, nil
+	}
+	if err = dockerPullImage(imageName); err != nil {
+		return nil, err
+	}
 	cmdName := "docker"
 	cmdArgs := []string{"image", "inspect", imageName}
 
-	inspectCmd := exec.Command(cmdName, cmdArgs...)
+	inspectCmd := runtimeCommand(cmdName, cmdArgs...)
 	inspectOut, inspectErr := inspectCmd.Output()
 	if inspectErr != nil {
-		Error.log("Could not inspect the image: ", inspectErr)
-		os.Exit(1)
+		return nil, fmt.Errorf("Could not inspect the image: %v", inspectErr)
 	}
 
-	err := json.Unmarshal([]byte(inspectOut), &data)
-	if err != nil {
-		Error.log("Error unmarshaling data from inspect command - exiting...")
-		os.Exit(1)
+	err = json.Unmarshal([]byte(inspectOut), &data)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("Error unmarshaling data from inspect command: %v", err)
 	}
-	config := data[0]["Config"].(map[string]interface{})
+	imageConfig, ok := data[0]["Config"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("The inspect command returned no configuration for the image %s", imageName)
+	}
+	stackImageConfigs[imageName] = imageConfig
+	return imageConfig, nil
+}
 
-	envVars := config["Env"].([]interface{})
+func getEnvVar(searchEnvVar string) (string, error) {
+	config, err := stackImageSettings()
+	if err != nil {
+		return "", err
+	}
+	envVars, _ := config["Env"].([]interface{})
 
 	Debug.log("Number of environment variables in stack image: ", len(envVars))
 	Debug.log("All environment variables in stack image: ", envVars)
 	var varFound = false
 	var envVarValue string
 	for _, envVar := range envVars {
-		if strings.HasPrefix(envVar.(string), searchEnvVar) {
+		if strings.HasPrefix(envVar.(string), searchEnvVar+"=") {
 			varFound = true
 			envVarValue = strings.SplitN(envVar.(string), "=", 2)[1]
 			break
@@ -99,18 +156,33 @@ func getEnvVar(searchEnvVar string) string {
 		Debug.log("Could not find env var: ", searchEnvVar)
 		envVarValue = ""
 	}
-	return envVarValue
+	return envVarValue, nil
+
+}
 
+func getEnvVarBool(searchEnvVar string) (bool, error) {
+	strVal, err := getEnvVar(searchEnvVar)
+	if err != nil {
+		return false, err
+	}
+	return strings.Compare(strings.TrimSpace(strings.ToUpper(strVal)), "TRUE") == 0, nil
 }
 
-func getEnvVarBool(searchEnvVar string) bool {
-	strVal := getEnvVar(searchEnvVar)
-	return strings.Compare(strings.TrimSpace(strings.ToUpper(strVal)), "TRUE") == 0
+// getEnvVarList returns the items of a ; separated list variable of the stack image
+func getEnvVarList(searchEnvVar string) ([]string, error) {
+	strVal, err := getEnvVar(searchEnvVar)
+	if err != nil {
+		return nil, err
+	}
+	return splitStackList(strVal), nil
 }
 
 func getEnvVarInt(searchEnvVar string) (int, error) {
 
-	strVal := getEnvVar(searchEnvVar)
+	strVal, err := getEnvVar(searchEnvVar)
+	if err != nil {
+		return 0, err
+	}
 	intVal, err := strconv.Atoi(strVal)
 	if err != nil {
 		return 0, err
@@ -119,12 +191,17 @@ func getEnvVarInt(searchEnvVar string) (int, error) {
 
 }
 
-func getVolumeArgs() []string {
+// getVolumeArgs returns the docker run arguments of the mounts of the stack, see stackMount. It fails
+// on the first mount that is not valid.
+func getVolumeArgs() ([]string, error) {
 	volumeArgs := []string{}
-	stackMounts := getEnvVar("APPSODY_MOUNTS")
+	stackMounts, err := getEnvVar("APPSODY_MOUNTS")
+	if err != nil {
+		return nil, err
+	}
 	if stackMounts == "" {
 		Warning.log("The stack image does not contain APPSODY_MOUNTS")
-		return volumeArgs
+		return volumeArgs, nil
 	}
 	stackMountList := strings.Split(stackMounts, ";")
 	homeDir := UserHomeDir()
@@ -137,10 +214,13 @@ func getVolumeArgs() []string {
 	}
 	projectDir, perr := getProjectDir()
 	if perr != nil {
-		Error.log(perr)
-		os.Exit(1)
+		return nil, perr
 	}
+	projectName, _ := getProjectName()
 	projectDirOverride := os.Getenv("APPSODY_MOUNT_PROJECT")
+	if wslVersion() > 0 {
+		homeDir, projectDirOverride = wslLinuxPath(homeDir), wslLinuxPath(projectDirOverride)
+	}
 	projectDirOverridden := false
 	if projectDirOverride != "" {
 		Debug.logf("Overriding project mount dir from '%s' to APPSODY_MOUNT_PROJECT value '%s' ", projectDir, projectDirOverride)
@@ -148,31 +228,36 @@ func getVolumeArgs() []string {
 		projectDirOverridden = true
 	}
 
-	for _, mount := range stackMountList {
-		if mount == "" {
+	for _, spec := range stackMountList {
+		if strings.TrimSpace(spec) == "" {
 			continue
 		}
-		var mappedMount string
-		var overridden bool
-		if strings.HasPrefix(mount, "~") {
-			mappedMount = strings.Replace(mount, "~", homeDir, 1)
-			overridden = homeDirOverridden
-		} else {
-			mappedMount = filepath.Join(projectDir, mount)
-			overridden = projectDirOverridden
+		mount, err := parseStackMount(strings.TrimSpace(spec), projectName, projectDir)
+		if err != nil {
+			return nil, err
 		}
-		// mappedMount contains local and container (linux) paths. When on windows, the Join above replaces all '/' with '\' and
-		// breaks the linux paths. This method is to always use '/' because windows docker tolerates this.
-		mappedMount = filepath.ToSlash(mappedMount)
-
-		if !overridden && !mountExistsLocally(mappedMount) {
-			Warning.log("Could not mount ", mappedMount, " because the local file was not found.")
-			continue
+		if mount.Kind == mountBind {
+			var overridden bool
+			// in WSL, the Windows paths of the overrides are the drives mounted in Linux
+			mount.Source = wslLinuxPath(mount.Source)
+			if strings.HasPrefix(mount.Source, "~") {
+				mount.Source = strings.Replace(mount.Source, "~", homeDir, 1)
+				overridden = homeDirOverridden
+			} else if !filepath.IsAbs(mount.Source) {
+				mount.Source = filepath.Join(projectDir, mount.Source)
+				overridden = projectDirOverridden
+			}
+			// Join replaces all '/' with '\' on windows, docker tolerates '/' in windows paths
+			mount.Source = filepath.ToSlash(mount.Source)
+			if !overridden && !mountExistsLocally(mount.Source+":"+mount.Target) {
+				Warning.log("Could not mount ", mount.Source, " because the local file was not found.")
+				continue
+			}
 		}
-		volumeArgs = append(volumeArgs, "-v", mappedMount)
+		volumeArgs = append(volumeArgs, mount.dockerArgs()...)
 	}
 	Debug.log("Mapped mount args: ", volumeArgs)
-	return volumeArgs
+	return volumeArgs, nil
 }
 
 func mountExistsLocally(mount string) bool {
@@ -217,27 +302,42 @@ func getProjectDir() (string, error) {
 	return dir, nil
 }
 
-func getProjectConfig() ProjectConfig {
+// readProjectConfig reads the configuration of the current project once
+func readProjectConfig() (ProjectConfig, error) {
 	if projectConfig == nil {
 		dir, perr := getProjectDir()
 		if perr != nil {
-			Error.log("The current directory is not a valid appsody project. Run appsody init <stack> to create one: ", perr)
-			os.Exit(1)
+			return ProjectConfig{}, fmt.Errorf("The current directory is not a valid appsody project. Run appsody init <stack> to create one: %v", perr)
 		}
-		appsodyConfig := filepath.Join(dir, ConfigFile)
-		viper.SetConfigFile(appsodyConfig)
-		Debug.log("Project config file set to: ", appsodyConfig)
-		err := viper.ReadInConfig()
+		config, err := loadProjectConfig(dir)
 		if err != nil {
-			Error.log("Error reading project config ", err)
-			os.Exit(1)
+			return ProjectConfig{}, fmt.Errorf("Error reading project config %v", err)
 		}
-		stack := viper.GetString("stack")
-		Debug.log("Project stack from config file: ", stack)
-		projectConfig = &ProjectConfig{stack}
+		if err = checkProjectConfigVersion(config); err != nil {
+			return ProjectConfig{}, err
+		}
+		Debug.log("Project stack from config file: ", config.Platform)
+		checkHooks(config)
+		projectConfig = &config
+	}
+	return *projectConfig, nil
+}
+
+// loadProjectConfig reads the .appsody-config.yaml file of the project in dir
+func loadProjectConfig(dir string) (ProjectConfig, error) {
+	var config ProjectConfig
+	appsodyConfig := filepath.Join(dir, ConfigFile)
+	Debug.log("Project config file set to: ", appsodyConfig)
+	// The config is not read with viper because viper lowercases map keys,
+	// which would break the environment variable names the config can contain
+	source, err := ioutil.ReadFile(appsodyConfig)
+	if err != nil {
+		return config, err
 	}
-	return *projectConfig
+	err = yaml.Unmarshal(source, &config)
+	return config, err
 }
+
 func getProjectName() (string, error) {
 	projectDir, err := getProjectDir()
 	if err != nil {
@@ -247,30 +347,7 @@ func getProjectName() (string, error) {
 	return projectName, nil
 }
 func execAndListen(command string, args []string, logger appsodylogger) (*exec.Cmd, error) {
-	return execAndListenWithWorkDir(command, args, logger, workDirNotSet) // no workdir
-}
-
-func execAndListenWithWorkDir(command string, args []string, logger appsodylogger, workdir string) (*exec.Cmd, error) {
-
-	cmd, err := execAndListenWithWorkDirReturnErr(command, args, logger, workdir)
-	if err != nil {
-		os.Exit(1)
-	}
-	return cmd, nil
-
-}
-func execAndWait(command string, args []string, logger appsodylogger) {
-
-	execAndWaitWithWorkDir(command, args, logger, workDirNotSet)
-}
-func execAndWaitWithWorkDir(command string, args []string, logger appsodylogger, workdir string) {
-
-	err := execAndWaitWithWorkDirReturnErr(command, args, logger, workdir)
-	if err != nil {
-		Error.log("Error running ", command, " command: ", err)
-		os.Exit(1)
-	}
-
+	return execAndListenWithWorkDirReturnErr(command, args, logger, workDirNotSet) // no workdir
 }
 
 // CopyFile uses OS commands to copy a file from a source to a destination
@@ -307,7 +384,7 @@ func CopyFile(source string, dest string) error {
 func MoveDir(fromDir string, toDir string) error {
 	Debug.log("Moving ", fromDir, " to ", toDir)
 	// Let's try os.Rename first
-	err := os.Rename(fromDir, toDir)
+	err := os.Rename(longPath(fromDir), longPath(toDir))
 	if err == nil {
 		// We did it - returning
 		//Error.log("Could not move ", extractDir, " to ", targetDir, " ", err)
@@ -330,19 +407,17 @@ func copyDir(fromDir string, toDir string) error {
 		return err
 	}
 
-	var execCmd string
-	var execArgs = []string{fromDir, toDir}
-
 	if runtime.GOOS == "windows" {
-		execCmd = "CMD"
-		winArgs := []string{"/C", "XCOPY", "/I", "/E", "/H", "/K"}
-		execArgs = append(winArgs[0:], execArgs...)
-
-	} else {
-		execCmd = "cp"
-		bashArgs := []string{"-rf"}
-		execArgs = append(bashArgs[0:], execArgs...)
+		// XCOPY fails on the files of deep trees, past MAX_PATH
+		if err = copyTree(fromDir, toDir); err != nil {
+			Error.logf("Could not copy %s to %s: %v", fromDir, toDir, err)
+			return err
+		}
+		Debug.logf("Directory copy of %s to %s was successful \n", fromDir, toDir)
+		return nil
 	}
+	execCmd := "cp"
+	execArgs := []string{"-rf", fromDir, toDir}
 	Debug.log("About to run: ", execCmd, execArgs)
 	copyCmd := exec.Command(execCmd, execArgs...)
 	cmdOutput, cmdErr := copyCmd.Output()
@@ -355,11 +430,47 @@ func copyDir(fromDir string, toDir string) error {
 	return nil
 }
 
+// copyTree copies a directory with its files and links, through long paths
+func copyTree(fromDir string, toDir string) error {
+	from, to := longPath(fromDir), longPath(toDir)
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// joining would clean the extended-length path
+		dest := to + path[len(from):]
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(dest, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dest)
+		}
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, source); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
 // CheckPrereqs checks the prerequisites to run the CLI
 func CheckPrereqs() error {
 	dockerCmd := "docker"
 	dockerArgs := []string{"ps"}
-	checkDockerCmd := exec.Command(dockerCmd, dockerArgs...)
+	checkDockerCmd := runtimeCommand(dockerCmd, dockerArgs...)
 	_, cmdErr := checkDockerCmd.Output()
 	if cmdErr != nil {
 		return errors.New("docker does not seem to be installed or running - failed to execute docker ps")
@@ -378,30 +489,13 @@ func UserHomeDir() string {
 	return homeDir
 }
 
-func getExposedPorts() []string {
-	// TODO cache this so the docker inspect command only runs once per cli invocation
-	var data []map[string]interface{}
+func getExposedPorts() ([]string, error) {
 	var portValues []string
-	imageName := getProjectConfig().Platform
-	dockerPullImage(imageName)
-	cmdName := "docker"
-	cmdArgs := []string{"image", "inspect", imageName}
-
-	inspectCmd := exec.Command(cmdName, cmdArgs...)
-	inspectOut, inspectErr := inspectCmd.Output()
-	if inspectErr != nil {
-		Error.log("Could not inspect the image: ", inspectErr)
-		os.Exit(1)
-	}
-
-	err := json.Unmarshal([]byte(inspectOut), &data)
+	config, err := stackImageSettings()
 	if err != nil {
-		Error.log("Error unmarshaling data from inspect command - exiting...")
-		os.Exit(1)
+		return nil, err
 	}
 
-	config := data[0]["Config"].(map[string]interface{})
-
 	if config["ExposedPorts"] != nil {
 		exposedPorts := config["ExposedPorts"].(map[string]interface{})
 
@@ -411,7 +505,7 @@ func getExposedPorts() []string {
 		}
 
 	}
-	return portValues
+	return portValues, nil
 
 }
 
@@ -422,18 +516,29 @@ func GenKnativeYaml(yamlTemplate string, deployPort int, serviceName string, dep
 		APIVersion string `yaml:"apiVersion"`
 		Kind       string `yaml:"kind"`
 		Metadata   struct {
-			Name      string `yaml:"name"`
-			Namespace string `yaml:"namespace,omitempty"`
+			Name      string            `yaml:"name"`
+			Namespace string            `yaml:"namespace,omitempty"`
+			Labels    map[string]string `yaml:"labels,omitempty"`
 		} `yaml:"metadata"`
 		Spec struct {
 			RunLatest struct {
 				Configuration struct {
 					RevisionTemplate struct {
+						Metadata struct {
+							Labels      map[string]string `yaml:"labels,omitempty"`
+							Annotations map[string]string `yaml:"annotations,omitempty"`
+						} `yaml:"metadata,omitempty"`
 						Spec struct {
-							Container struct {
-								Image           string           `yaml:"image"`
-								ImagePullPolicy string           `yaml:"imagePullPolicy"`
-								Ports           []map[string]int `yaml:"ports"`
+							TopologySpreadConstraints []TopologySpreadConstraint `yaml:"topologySpreadConstraints,omitempty"`
+							Container                 struct {
+								Image           string                   `yaml:"image"`
+								ImagePullPolicy string                   `yaml:"imagePullPolicy"`
+								Ports           []map[string]int         `yaml:"ports"`
+								LivenessProbe   *containerProbe          `yaml:"livenessProbe,omitempty"`
+								ReadinessProbe  *containerProbe          `yaml:"readinessProbe,omitempty"`
+								StartupProbe    *containerProbe          `yaml:"startupProbe,omitempty"`
+								Resources       *containerResources      `yaml:"resources,omitempty"`
+								Env             []map[string]interface{} `yaml:"env,omitempty"`
 							} `yaml:"container"`
 						} `yaml:"spec"`
 					} `yaml:"revisionTemplate"`
@@ -453,6 +558,64 @@ func GenKnativeYaml(yamlTemplate string, deployPort int, serviceName string, dep
 	if !pullImage {
 		yamlMap.Spec.RunLatest.Configuration.RevisionTemplate.Spec.Container.ImagePullPolicy = "Never"
 	}
+	//Label the service and its pods, appsody ps --k8s lists them
+	revisionTemplate := &yamlMap.Spec.RunLatest.Configuration.RevisionTemplate
+	for _, labels := range []*map[string]string{&yamlMap.Metadata.Labels, &revisionTemplate.Metadata.Labels} {
+		if *labels == nil {
+			*labels = map[string]string{}
+		}
+		for name, value := range managedLabels(serviceName) {
+			(*labels)[name] = value
+		}
+	}
+	//Spread the pods and keep enough of them for the disruption budget
+	if constraints := deployAvailability.topologySpreadConstraints(serviceName); constraints != nil {
+		revisionTemplate.Spec.TopologySpreadConstraints = constraints
+	}
+	for name, value := range deployMetrics.annotations(deployPort) {
+		if revisionTemplate.Metadata.Annotations == nil {
+			revisionTemplate.Metadata.Annotations = map[string]string{}
+		}
+		revisionTemplate.Metadata.Annotations[name] = value
+	}
+	if minScale := deployAvailability.minScale(); minScale > 0 {
+		if revisionTemplate.Metadata.Annotations == nil {
+			revisionTemplate.Metadata.Annotations = map[string]string{}
+		}
+		revisionTemplate.Metadata.Annotations["autoscaling.knative.dev/minScale"] = strconv.Itoa(minScale)
+	}
+	//Add the probes of the stack, unless the template has its own
+	container := &revisionTemplate.Spec.Container
+	if container.LivenessProbe == nil {
+		container.LivenessProbe = deployProbes.Liveness.containerProbe()
+	}
+	if container.ReadinessProbe == nil {
+		container.ReadinessProbe = deployProbes.Readiness.containerProbe()
+	}
+	if container.StartupProbe == nil {
+		container.StartupProbe = deployProbes.Startup.containerProbe()
+	}
+	//Point the application at the telemetry collector
+	for _, variable := range deployEnv {
+		parts := strings.SplitN(variable, "=", 2)
+		container.Env = append(container.Env, map[string]interface{}{"name": parts[0], "value": parts[1]})
+	}
+	//Set the env of the project, the secrets come from the Secret of the service
+	for _, variable := range deployAppEnv {
+		if variable.SecretName != "" {
+			ref := map[string]string{"name": variable.SecretName, "key": variable.SecretKey}
+			container.Env = append(container.Env, map[string]interface{}{"name": variable.Name, "valueFrom": map[string]interface{}{"secretKeyRef": ref}})
+		} else if variable.Secret {
+			ref := map[string]string{"name": envSecretName(serviceName), "key": variable.Name}
+			container.Env = append(container.Env, map[string]interface{}{"name": variable.Name, "valueFrom": map[string]interface{}{"secretKeyRef": ref}})
+		} else {
+			container.Env = append(container.Env, map[string]interface{}{"name": variable.Name, "value": variable.Value})
+		}
+	}
+	//Set the resources given in the project or as options
+	if resources := deployResources.containerResources(); resources != nil {
+		container.Resources = resources
+	}
 	//Set the containerPort
 	ports := yamlMap.Spec.RunLatest.Configuration.RevisionTemplate.Spec.Container.Ports
 	if len(ports) > 1 {
@@ -503,7 +666,7 @@ func GenKnativeYaml(yamlTemplate string, deployPort int, serviceName string, dep
 	// Generate a file name appsody-service-xxxxx.yaml
 	yamlFilePrefix := YamlFilePrefix + "-" + YamlFileSuffix + "-*.yaml"
 	if dryrun {
-		Info.log("Skipping creation of yaml file with prefix: ", yamlFilePrefix)
+		planned(planWrite, filepath.Join(dir, yamlFilePrefix), "Knative service manifest")
 		return yamlFilePrefix, nil
 	}
 	yamlFile, err := ioutil.TempFile(dir, yamlFilePrefix)
@@ -555,10 +718,10 @@ func DockerTag(imageToTag string, tag string) error {
 	cmdName := "docker"
 	cmdArgs := []string{"image", "tag", imageToTag, tag}
 	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", cmdArgs)
+		plannedStep(planTagImage, tag, cmdName, cmdArgs)
 		return nil
 	}
-	tagCmd := exec.Command(cmdName, cmdArgs...)
+	tagCmd := runtimeCommand(cmdName, cmdArgs...)
 	tagOut, tagErr := tagCmd.Output()
 	if tagErr != nil {
 		Error.log("Could not inspect the image: ", tagErr, " ", string(tagOut[:]))
@@ -568,16 +731,26 @@ func DockerTag(imageToTag string, tag string) error {
 	return nil
 }
 
-//DockerPush pushes a docker image to a docker registry (assumes that the user has done docker login)
+//DockerPush pushes a docker image to a docker registry. It logs in with the registry of the project
+//configuration, if any, otherwise it assumes that the user has done docker login.
 func DockerPush(imageToPush string) error {
+	config, err := readProjectConfig()
+	if err != nil {
+		return err
+	}
+	if registry := config.Registry; registry != nil {
+		if err := registry.login(imageToPush); err != nil {
+			return err
+		}
+	}
 	Info.log("Pushing docker image ", imageToPush)
 	cmdName := "docker"
 	cmdArgs := []string{"push", imageToPush}
 	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", cmdArgs)
+		plannedStep(planPushImage, imageToPush, cmdName, cmdArgs)
 		return nil
 	}
-	pushCmd := exec.Command(cmdName, cmdArgs...)
+	pushCmd := runtimeCommand(cmdName, cmdArgs...)
 	pushOut, pushErr := pushCmd.Output()
 	if pushErr != nil {
 		Error.log("Could not push the image: ", pushErr, " ", string(pushOut[:]))
@@ -591,7 +764,9 @@ func DockerPush(imageToPush string) error {
 func DockerRunBashCmd(options []string, image string, bashCmd string) (cmdOutput string, err error) {
 	cmdName := "docker"
 	var cmdArgs []string
-	dockerPullImage(image)
+	if err = dockerPullImage(image); err != nil {
+		return "", err
+	}
 	if len(options) >= 0 {
 		cmdArgs = append([]string{"run"}, options...)
 	} else {
@@ -599,7 +774,7 @@ func DockerRunBashCmd(options []string, image string, bashCmd string) (cmdOutput
 	}
 	cmdArgs = append(cmdArgs, "--entrypoint", "/bin/bash", image, "-c", bashCmd)
 	Info.log("Running command: ", cmdName, cmdArgs)
-	dockerCmd := exec.Command(cmdName, cmdArgs...)
+	dockerCmd := runtimeCommand(cmdName, cmdArgs...)
 	dockerOutBytes, err := dockerCmd.Output()
 	if err != nil {
 		Error.log("Could not run the docker image: ", err)
@@ -613,17 +788,14 @@ func DockerRunBashCmd(options []string, image string, bashCmd string) (cmdOutput
 func KubeApply(fileToApply string) error {
 	Info.log("Deploying your project to Kubernetes...")
 	kcmd := "kubectl"
-	kargs := []string{"apply", "-f", fileToApply}
-	if namespace != "" {
-		kargs = append(kargs, "--namespace", namespace)
-	}
+	kargs := kubectlArgs("apply", "-f", fileToApply)
 
 	if dryrun {
-		Info.log("Dry run - skipping execution of: ", kcmd, " ", kargs)
+		plannedStep(planApplyManifest, fileToApply, kcmd, kargs)
 		return nil
 	}
 	Info.log("Running command: ", kcmd, kargs)
-	execCmd := exec.Command(kcmd, kargs...)
+	execCmd := runtimeCommand(kcmd, kargs...)
 	kout, kerr := execCmd.Output()
 	if kerr != nil {
 		Error.log("kubectl apply failed: ", kerr, " ", string(kout[:]))
@@ -633,21 +805,36 @@ func KubeApply(fileToApply string) error {
 	return nil
 }
 
+// KubeApplyDryRun issues kubectl apply --dry-run=<mode> -f <filename>, which with server has the API server
+// and its admission webhooks validate the manifest without persisting anything
+func KubeApplyDryRun(fileToApply string, mode string) error {
+	kcmd := "kubectl"
+	kargs := kubectlArgs("apply", "--dry-run="+mode, "-f", fileToApply)
+	if dryrun {
+		plannedStep(planApplyManifest, fileToApply, kcmd, kargs)
+		return nil
+	}
+	Info.log("Running command: ", kcmd, kargs)
+	kout, kerr := runtimeCommand(kcmd, kargs...).CombinedOutput()
+	if kerr != nil {
+		return fmt.Errorf("The %s dry run rejected the manifest %s: %v\n%s", mode, fileToApply, kerr, strings.TrimSpace(string(kout)))
+	}
+	Info.log(strings.TrimSpace(string(kout)))
+	return nil
+}
+
 //KubeGetRouteURL issues kubectl get rt <service> -o jsonpath="{.status.url}" and prints the return URL
 func KubeGetRouteURL(service string) (url string, err error) {
 	kcmd := "kubectl"
 	kargs := append([]string{"get", "rt"}, service)
-	kargs = append(kargs, "-o", "jsonpath=\"{.status.url}\"")
-	if namespace != "" {
-		kargs = append(kargs, "--namespace", namespace)
-	}
+	kargs = kubectlArgs(append(kargs, "-o", "jsonpath=\"{.status.url}\"")...)
 
 	if dryrun {
-		Info.log("Dry run - skipping execution of: ", kcmd, " ", kargs)
+		Debug.log("Dry run - skipping execution of: ", kcmd, " ", kargs)
 		return "", nil
 	}
 	Info.log("Running command: ", kcmd, kargs)
-	execCmd := exec.Command(kcmd, kargs...)
+	execCmd := runtimeCommand(kcmd, kargs...)
 	kout, kerr := execCmd.Output()
 	if kerr != nil {
 		Error.log("kubectl get failed: ", kerr, " ", string(kout[:]))
@@ -662,7 +849,7 @@ func dockerPullCmd(imageToPull string) error {
 	cmdName := "docker"
 	pullArgs := []string{"pull", imageToPull}
 	if dryrun {
-		Info.log("Dry run - skipping execution of: ", cmdName, " ", pullArgs)
+		plannedStep(planPullImage, imageToPull, cmdName, pullArgs)
 		return nil
 	}
 	Debug.log("Pulling docker image ", imageToPull)
@@ -677,7 +864,7 @@ func dockerPullCmd(imageToPull string) error {
 func checkDockerImageExistsLocally(imageToPull string) bool {
 	cmdName := "docker"
 	cmdArgs := []string{"image", "ls", "-q", imageToPull}
-	imagelsCmd := exec.Command(cmdName, cmdArgs...)
+	imagelsCmd := runtimeCommand(cmdName, cmdArgs...)
 	imagelsOut, imagelsErr := imagelsCmd.Output()
 	imagelsOutStr := strings.TrimSpace(string(imagelsOut))
 	Debug.log("Docker image ls command output: ", imagelsOutStr)
@@ -695,12 +882,12 @@ func checkDockerImageExistsLocally(imageToPull string) bool {
 //dockerPullImage
 // pulls docker image, if APPSODY_PULL_POLICY set to IFNOTPRESENT
 //it checks for image in local repo and pulls if not in the repo
-func dockerPullImage(imageToPull string) {
+func dockerPullImage(imageToPull string) error {
 
 	Debug.logf("%s image pulled status: %t", imageToPull, imagePulled[imageToPull])
 	if imagePulled[imageToPull] {
 		Debug.log("Image has been pulled already: ", imageToPull)
-		return
+		return nil
 	}
 	imagePulled[imageToPull] = true
 
@@ -724,14 +911,14 @@ func dockerPullImage(imageToPull string) {
 				localImageFound = checkDockerImageExistsLocally(imageToPull)
 			}
 			if !localImageFound {
-				Error.log("Could not find the image either in docker hub or locally: ", imageToPull)
-				os.Exit(1)
+				return fmt.Errorf("Could not find the image either in docker hub or locally: %s", imageToPull)
 			}
 		}
 	}
 	if localImageFound {
 		Info.log("Using local cache for image ", imageToPull)
 	}
+	return nil
 
 }
 
@@ -739,10 +926,10 @@ func execAndListenWithWorkDirReturnErr(command string, args []string, logger app
 	var execCmd *exec.Cmd
 	var err error
 	if dryrun {
-		Info.log("Dry Run - Skipping command: ", command, args)
+		plannedCommand(command, args)
 	} else {
 		Info.log("Running command: ", command, args)
-		execCmd = exec.Command(command, args...)
+		execCmd = runtimeCommand(command, args...)
 		if workdir != "" {
 			execCmd.Dir = workdir
 		}
@@ -790,7 +977,7 @@ func execAndWaitWithWorkDirReturnErr(command string, args []string, logger appso
 	var err error
 	var execCmd *exec.Cmd
 	if dryrun {
-		Info.log("Dry Run - Skipping command: ", command, args)
+		plannedCommand(command, args)
 	} else {
 		execCmd, err = execAndListenWithWorkDirReturnErr(command, args, logger, workdir)
 		if err != nil {
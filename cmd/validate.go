@@ -0,0 +1,490 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// The kinds of files appsody validate checks, named after their files
+const (
+	schemaStack         = "stack"
+	schemaIndex         = "index"
+	schemaProjectConfig = "appsody-config"
+	schemaAppDeploy     = "app-deploy"
+)
+
+const schemaBaseURL = "https://appsody.dev/schemas/"
+
+var (
+	validateKind    string
+	printSchema     string
+	writeSchemasDir string
+)
+
+// schemaKinds are the kinds of files with a schema, in the order they are written
+var schemaKinds = []string{schemaProjectConfig, schemaAppDeploy, schemaIndex, schemaStack}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [file...]",
+	Short: "Check Appsody configuration files against their JSON Schemas",
+	Long: `This checks stack.yaml, index.yaml, .appsody-config.yaml and app-deploy.yaml files against their JSON Schemas,
+reporting the unknown fields, such as typos, and the values of the wrong type with their path in the file. The kind of
+a file comes from its name, use --kind for files named otherwise. Without files, the .appsody-config.yaml and
+app-deploy.yaml of the project in the current directory are checked.
+
+The schemas also let editors complete and check the files: print one with --schema <kind>, or write them all with
+--write-schemas <dir> and map them to the files in the settings of the editor. The kinds are appsody-config,
+app-deploy, index and stack.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if printSchema != "" {
+			schema, err := schemaJSON(printSchema)
+			if err != nil {
+				return err
+			}
+			Info.log(string(schema))
+			return nil
+		}
+		if writeSchemasDir != "" {
+			return writeSchemas(writeSchemasDir)
+		}
+		files := args
+		if len(files) == 0 {
+			for _, file := range []string{ConfigFile, "app-deploy.yaml"} {
+				if found, _ := exists(file); found {
+					files = append(files, file)
+				}
+			}
+			if len(files) == 0 {
+				return errors.Errorf("Specify the files to validate, there is no %s or app-deploy.yaml in the current directory", ConfigFile)
+			}
+		}
+		invalid := 0
+		for _, file := range files {
+			kind := validateKind
+			if kind == "" {
+				kind = schemaKindOf(file)
+			}
+			if kind == "" {
+				return errors.Errorf("Could not tell the kind of %s from its name, use --kind with one of %s", file, strings.Join(schemaKinds, ", "))
+			}
+			problems, err := validateFile(file, kind)
+			if err != nil {
+				return err
+			}
+			if len(problems) == 0 {
+				Info.logf("%s: valid %s file", file, kind)
+				continue
+			}
+			invalid++
+			Error.logf("%s: %d problem(s)", file, len(problems))
+			for _, problem := range problems {
+				Info.log("  ", problem)
+			}
+		}
+		if invalid > 0 {
+			return errors.Errorf("%d of the files are not valid", invalid)
+		}
+		return nil
+	},
+}
+
+// schemaKindOf tells the kind of a file from its name
+func schemaKindOf(file string) string {
+	name := strings.ToLower(filepath.Base(file))
+	switch {
+	case name == ConfigFile:
+		return schemaProjectConfig
+	case name == "stack.yaml":
+		return schemaStack
+	case name == "app-deploy.yaml":
+		return schemaAppDeploy
+	case name == "index.yaml" || strings.HasSuffix(name, "-index.yaml"):
+		return schemaIndex
+	}
+	return ""
+}
+
+// kindSchema returns the JSON Schema of a kind of file. The schemas of the files the CLI reads are made
+// from the types it reads them into, so they can not drift apart.
+func kindSchema(kind string) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	switch kind {
+	case schemaProjectConfig:
+		schema = typeSchema(reflect.TypeOf(ProjectConfig{}))
+		schema["required"] = []interface{}{"stack"}
+	case schemaStack:
+		schema = typeSchema(reflect.TypeOf(StackYaml{}))
+		schema["required"] = []interface{}{"name", "version"}
+	case schemaIndex:
+		schema = typeSchema(reflect.TypeOf(RepoIndex{}))
+		schema["required"] = []interface{}{"apiVersion"}
+	case schemaAppDeploy:
+		schema = appDeploySchema()
+	default:
+		return nil, errors.Errorf("There is no schema for %q, the kinds are %s", kind, strings.Join(schemaKinds, ", "))
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = schemaBaseURL + kind + ".json"
+	return schema, nil
+}
+
+func schemaJSON(kind string) ([]byte, error) {
+	schema, err := kindSchema(kind)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func writeSchemas(dir string) error {
+	for _, kind := range schemaKinds {
+		schema, err := schemaJSON(kind)
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(dir, kind+".schema.json")
+		if dryrun {
+			planned(planWrite, file, "JSON Schema of the "+kind+" files")
+			continue
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(file, append(schema, '\n'), 0644); err != nil {
+			return err
+		}
+		Info.log("Wrote ", file)
+	}
+	return nil
+}
+
+// typeSchema returns the schema of the values yaml reads into the type. Struct fields are named by their
+// yaml tags and no other field is allowed.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(ProjectHook{}) {
+		// a hook is a command, or the full hook
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			structSchema(t),
+		}}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		properties[name] = typeSchema(field.Type)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+// appDeploySchema is the schema of the AppsodyApplication resources of the Appsody operator
+func appDeploySchema() map[string]interface{} {
+	object := func(properties map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	}
+	str := map[string]interface{}{"type": "string"}
+	integer := map[string]interface{}{"type": "integer"}
+	boolean := map[string]interface{}{"type": "boolean"}
+	// the kubernetes types, such as probes and volumes, are only checked to be objects or arrays
+	anyObject := map[string]interface{}{"type": "object"}
+	anyArray := map[string]interface{}{"type": "array"}
+	spec := object(map[string]interface{}{
+		"applicationImage":     str,
+		"applicationName":      str,
+		"version":              str,
+		"stack":                str,
+		"architecture":         map[string]interface{}{"type": "array", "items": str},
+		"replicas":             integer,
+		"pullPolicy":           map[string]interface{}{"type": "string", "enum": []interface{}{"Always", "IfNotPresent", "Never"}},
+		"pullSecret":           str,
+		"serviceAccountName":   str,
+		"createKnativeService": boolean,
+		"expose":               boolean,
+		"createAppDefinition":  boolean,
+		"service": object(map[string]interface{}{
+			"port":        integer,
+			"type":        map[string]interface{}{"type": "string", "enum": []interface{}{"ClusterIP", "NodePort", "LoadBalancer", "ExternalName"}},
+			"annotations": map[string]interface{}{"type": "object", "additionalProperties": str},
+			"consumes":    anyArray,
+			"provides":    anyObject,
+			"certificate": anyObject,
+		}),
+		"route":               anyObject,
+		"autoscaling":         anyObject,
+		"resourceConstraints": anyObject,
+		"livenessProbe":       anyObject,
+		"readinessProbe":      anyObject,
+		"monitoring":          anyObject,
+		"storage":             anyObject,
+		"env":                 anyArray,
+		"envFrom":             anyArray,
+		"volumes":             anyArray,
+		"volumeMounts":        anyArray,
+		"initContainers":      anyArray,
+		"sidecarContainers":   anyArray,
+	})
+	spec["required"] = []interface{}{"applicationImage"}
+	schema := object(map[string]interface{}{
+		"apiVersion": map[string]interface{}{"type": "string", "pattern": "^appsody\\.dev/"},
+		"kind":       map[string]interface{}{"type": "string", "enum": []interface{}{"AppsodyApplication"}},
+		"metadata":   anyObject,
+		"spec":       spec,
+		"status":     anyObject,
+	})
+	schema["required"] = []interface{}{"apiVersion", "kind", "metadata", "spec"}
+	return schema
+}
+
+// validateFile checks a file against the schema of its kind and returns the problems found
+func validateFile(file string, kind string) ([]string, error) {
+	if _, err := kindSchema(kind); err != nil {
+		return nil, err
+	}
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return validateData(source, kind)
+}
+
+// validateData checks the YAML of a file of a kind against its schema and returns the problems found
+func validateData(source []byte, kind string) ([]string, error) {
+	schema, err := kindSchema(kind)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err = yaml.Unmarshal(source, &document); err != nil {
+		return []string{"not valid YAML: " + err.Error()}, nil
+	}
+	problems := validateValue(schema, jsonValue(document), "")
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// jsonValue converts the maps yaml reads into the maps of JSON, with string keys
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, item := range value {
+			converted[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return converted
+	case []interface{}:
+		for i := range value {
+			value[i] = jsonValue(value[i])
+		}
+	}
+	return value
+}
+
+// validateValue checks a value against the schema, supporting the type, properties, additionalProperties,
+// required, items, enum, pattern and anyOf keywords the appsody schemas use
+func validateValue(schema map[string]interface{}, value interface{}, path string) []string {
+	at := path
+	if at == "" {
+		at = "the document"
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var problems []string
+		for _, option := range anyOf {
+			optionProblems := validateValue(option.(map[string]interface{}), value, path)
+			if len(optionProblems) == 0 {
+				return nil
+			}
+			// the problems of the option of the type of the value say the most
+			if expected, ok := option.(map[string]interface{})["type"].(string); ok && schemaTypeMatches(expected, value) {
+				return optionProblems
+			}
+			problems = append(problems, optionProblems...)
+		}
+		return problems
+	}
+	if expected, ok := schema["type"].(string); ok && !schemaTypeMatches(expected, value) {
+		return []string{fmt.Sprintf("%s: expected %s, found %s", at, schemaTypeArticle(expected), schemaTypeName(value))}
+	}
+	var problems []string
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		var allowed []string
+		for _, item := range enum {
+			allowed = append(allowed, fmt.Sprint(item))
+			found = found || item == value
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %s", at, value, strings.Join(allowed, ", ")))
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if text, isString := value.(string); isString && !regexp.MustCompile(pattern).MatchString(text) {
+			problems = append(problems, fmt.Sprintf("%s: %q does not match %s", at, text, pattern))
+		}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, found := value[name.(string)]; !found {
+					problems = append(problems, fmt.Sprintf("%s: missing the required %s field", at, name))
+				}
+			}
+		}
+		for name, item := range value {
+			itemPath := name
+			if path != "" {
+				itemPath = path + "." + name
+			}
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, validateValue(property, item, itemPath)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					var names []string
+					for known := range properties {
+						names = append(names, known)
+					}
+					problems = append(problems, fmt.Sprintf("%s: unknown field.%s", itemPath, didYouMean(name, names)))
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateValue(additional, item, itemPath)...)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				problems = append(problems, validateValue(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return problems
+}
+
+func schemaTypeMatches(expected string, value interface{}) bool {
+	switch expected {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		switch value.(type) {
+		case string, time.Time:
+			return true
+		}
+	case "integer":
+		switch value.(type) {
+		case int, int64, uint64:
+			return true
+		}
+	case "number":
+		switch value.(type) {
+		case int, int64, uint64, float64:
+			return true
+		}
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	}
+	return false
+}
+
+func schemaTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nothing"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "a list"
+	case string, time.Time:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	}
+	return "an integer"
+}
+
+func schemaTypeArticle(schemaType string) string {
+	switch schemaType {
+	case "object", "integer":
+		return "an " + schemaType
+	case "array":
+		return "a list"
+	}
+	return "a " + schemaType
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.PersistentFlags().StringVar(&validateKind, "kind", "", "Kind of the files to validate: appsody-config, app-deploy, index or stack. By default it comes from the file names.")
+	validateCmd.PersistentFlags().StringVar(&printSchema, "schema", "", "Print the JSON Schema of a kind of file instead of validating files.")
+	validateCmd.PersistentFlags().StringVar(&writeSchemasDir, "write-schemas", "", "Write the JSON Schemas of all the kinds of files in this directory, as <kind>.schema.json.")
+}
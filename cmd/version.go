@@ -15,19 +15,50 @@
 package cmd
 
 import (
+	"github.com/gosuri/uitable"
 	"github.com/spf13/cobra"
 )
 
+var verifyVersion bool
+
 // versionCmd represents the version command
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show Appsody CLI version",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `This shows the version of the CLI, with the commit and the date of its build and the sha256 checksum of the binary.
+
+With --verify, the binary is checked against the release manifest of its version: the signature of the manifest is
+verified with cosign, with --key or, keyless, with --certificate-identity and --certificate-oidc-issuer, then the
+checksum of the binary is compared with the one the manifest has for the OS and architecture.`,
+	Example: `  appsody version --verify --key appsody-release.pub`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verifyVersion {
+			return verifyRelease()
+		}
+		if structured, err := structuredOutput(); structured || err != nil {
+			if err != nil {
+				return err
+			}
+			return printStructured(currentVersionInfo())
+		}
 		Info.log(rootCmd.Use, " ", VERSION)
+		info := currentVersionInfo()
+		table := uitable.New()
+		for _, field := range [][2]string{{"Commit:", info.Commit}, {"Built:", info.Date}, {"Checksum:", info.Checksum}} {
+			if field[1] != "" {
+				table.AddRow(field[0], field[1])
+			}
+		}
+		if len(table.Rows) > 0 {
+			Info.log(table)
+		}
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionCmd.PersistentFlags().BoolVar(&verifyVersion, "verify", false, "Verify the binary against the signed manifest of its release.")
+	versionCmd.PersistentFlags().StringVar(&versionManifestURL, "manifest-url", "", "URL of the release manifest. By default the checksums.txt of the GitHub release of the version.")
+	addVerifyFlags(versionCmd, "key")
 }
@@ -0,0 +1,167 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// releaseManifestURL is the checksum manifest of the binaries of a release, signed with cosign sign-blob. The
+// signature is next to it with a .sig extension, and the certificate of a keyless signature with a .pem one.
+const releaseManifestURL = "https://github.com/appsody/appsody/releases/download/%s/checksums.txt"
+
+var versionManifestURL string
+
+// buildCommit returns the commit and the time of the build, set during build or, for builds with go build in a
+// git checkout, recorded by go
+func buildCommit() (string, string) {
+	commit, date := COMMIT, DATE
+	if info, ok := debug.ReadBuildInfo(); ok && commit == "" {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			}
+		}
+	}
+	return commit, date
+}
+
+// binaryChecksum is the hex sha256 of the running appsody binary
+func binaryChecksum() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return "", err
+	}
+	file, err := os.Open(executable)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	checksum := sha256.New()
+	if _, err = io.Copy(checksum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// releaseBinaryName is the name of the binary of the running OS and architecture in the release manifest, the
+// one the Makefile builds
+func releaseBinaryName() string {
+	name := "appsody-" + VERSION + "-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// verifyRelease checks the signature of the release manifest of the version with cosign, then the checksum of
+// the running binary against the one of the manifest
+func verifyRelease() error {
+	if VERSION == "" || strings.HasPrefix(VERSION, "v") || VERSION == "0.0.0" {
+		return errors.Errorf("This appsody binary is a development build (%s), it has no release to verify it against", VERSION)
+	}
+	if err := checkCosign(); err != nil {
+		return err
+	}
+	if verifyKey == "" && (certificateIdentity == "" || certificateIssuer == "") {
+		return errors.New("Keyless verification needs --certificate-identity and --certificate-oidc-issuer, or use --key")
+	}
+	checksum, err := binaryChecksum()
+	if err != nil {
+		return errors.Errorf("Could not compute the checksum of the appsody binary: %v", err)
+	}
+	manifestURL := versionManifestURL
+	if manifestURL == "" {
+		manifestURL = strings.Replace(releaseManifestURL, "%s", VERSION, 1)
+	}
+	dir, err := scratchDir()
+	if err != nil {
+		return err
+	}
+	files := []string{manifestURL, manifestURL + ".sig"}
+	if verifyKey == "" {
+		files = append(files, manifestURL+".pem")
+	}
+	var local []string
+	for _, href := range files {
+		file := filepath.Join(dir, "release-"+filepath.Base(href))
+		if err = downloadFileToDisk(href, file); err != nil {
+			return errors.Errorf("Could not download %s: %v", href, err)
+		}
+		local = append(local, file)
+	}
+
+	args := []string{"verify-blob", "--signature", local[1]}
+	if verifyKey != "" {
+		args = append(args, "--key", verifyKey)
+	} else {
+		args = append(args, "--certificate", local[2], "--certificate-identity", certificateIdentity, "--certificate-oidc-issuer", certificateIssuer)
+	}
+	Info.log("Verifying the signature of the release manifest ", manifestURL)
+	if err = execAndWaitReturnErr("cosign", append(args, local[0]), Debug); err != nil {
+		return errors.Errorf("The signature of the release manifest %s could not be verified: %v", manifestURL, err)
+	}
+	if dryrun {
+		return nil
+	}
+
+	expected, err := manifestChecksum(local[0], releaseBinaryName())
+	if err != nil {
+		return err
+	}
+	if expected != checksum {
+		return errors.Errorf("The appsody binary is not the one of the %s release: its checksum is sha256:%s, the release manifest has sha256:%s for %s", VERSION, checksum, expected, releaseBinaryName())
+	}
+	Info.logf("The appsody binary is the %s of the %s release", releaseBinaryName(), VERSION)
+	return nil
+}
+
+// manifestChecksum reads the checksum of a file from a manifest in the format of sha256sum
+func manifestChecksum(manifest string, name string) (string, error) {
+	file, err := os.Open(manifest)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("The release manifest has no checksum for %s, the binary of %s/%s", name, runtime.GOOS, runtime.GOARCH)
+}
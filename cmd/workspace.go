@@ -0,0 +1,151 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// WorkspaceFile lists the appsody projects of a monorepo, it lives at the root of the repository
+var WorkspaceFile = "appsody-workspace.yaml"
+
+type Workspace struct {
+	Projects []WorkspaceProject `yaml:"projects"`
+}
+
+type WorkspaceProject struct {
+	Name string `yaml:"name"`
+	// Path of the project directory, relative to the workspace file
+	Path string `yaml:"path"`
+	// DependsOn names the projects that must be built before this one
+	DependsOn []string `yaml:"depends-on,omitempty"`
+}
+
+var workspaceProject string
+
+// findWorkspace looks for the workspace file in the current directory and its parents
+func findWorkspace() (string, *Workspace, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		workspaceFile := filepath.Join(dir, WorkspaceFile)
+		if found, _ := exists(workspaceFile); found {
+			Debug.log("Found workspace file ", workspaceFile)
+			source, err := ioutil.ReadFile(workspaceFile)
+			if err != nil {
+				return "", nil, err
+			}
+			var workspace Workspace
+			if err = yaml.Unmarshal(source, &workspace); err != nil {
+				return "", nil, errors.Errorf("%s formatting error: %v", workspaceFile, err)
+			}
+			return dir, &workspace, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, errors.Errorf("Could not find %s in the current directory or any of its parents", WorkspaceFile)
+		}
+		dir = parent
+	}
+}
+
+func (w *Workspace) project(name string) (*WorkspaceProject, error) {
+	var names []string
+	for i := range w.Projects {
+		if w.Projects[i].Name == name {
+			return &w.Projects[i], nil
+		}
+		names = append(names, w.Projects[i].Name)
+	}
+	return nil, errors.Errorf("The workspace does not have a project named %s. Available projects: %s", name, strings.Join(names, ", "))
+}
+
+// buildOrder sorts the workspace projects so that every project comes after the projects it depends on
+func (w *Workspace) buildOrder() ([]WorkspaceProject, error) {
+	var ordered []WorkspaceProject
+	// 0 = not visited, 1 = in progress, 2 = done
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return errors.Errorf("The workspace projects have a dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		project, err := w.project(name)
+		if err != nil {
+			return err
+		}
+		state[name] = 1
+		for _, dependency := range project.DependsOn {
+			if err = visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, *project)
+		return nil
+	}
+	for _, project := range w.Projects {
+		if err := visit(project.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// enterWorkspaceProject makes the named workspace project the current project, by changing into its directory
+// and resetting everything that was derived from the directory the command was started in.
+func enterWorkspaceProject(cmd *cobra.Command, name string) error {
+	workspaceDir, workspace, err := findWorkspace()
+	if err != nil {
+		return err
+	}
+	project, err := workspace.project(name)
+	if err != nil {
+		return err
+	}
+	return enterProjectDir(cmd, filepath.Join(workspaceDir, project.Path))
+}
+
+func enterProjectDir(cmd *cobra.Command, dir string) error {
+	Debug.log("Changing to project directory ", dir)
+	if err := os.Chdir(dir); err != nil {
+		return errors.Errorf("Could not change to the project directory: %v", err)
+	}
+	projectConfig = nil
+	projectName, err := getProjectName()
+	if err != nil {
+		return err
+	}
+	if flag := cmd.Flags().Lookup("name"); flag == nil || !flag.Changed {
+		containerName = projectName + "-dev"
+	}
+	if flag := cmd.Flags().Lookup("deps-volume"); flag == nil || !flag.Changed {
+		depsVolumeName = projectName + "-deps"
+	}
+	extractContainerName = projectName + "-extract"
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// workspaceParallel is the --parallel option of build --all and test --all, how many projects run at a time
+var workspaceParallel int
+
+// The statuses of the projects in the summary of a workspace command
+const (
+	workspaceSucceeded = "succeeded"
+	workspaceFailed    = "failed"
+	workspaceSkipped   = "skipped"
+)
+
+// workspaceResult is how the command went for one project of the workspace
+type workspaceResult struct {
+	Project  string
+	Status   string
+	Duration time.Duration
+	Details  string
+}
+
+// runWorkspaceCommand runs the command for every project of the workspace, each in its own appsody process,
+// --parallel of them at a time. A project starts once the projects it depends on succeeded, and is skipped
+// when one of them did not. The output of the projects is interleaved, each line prefixed with its project.
+func runWorkspaceCommand(cmd *cobra.Command) error {
+	if workspaceParallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+	_, workspace, err := findWorkspace()
+	if err != nil {
+		return err
+	}
+	projects, err := workspace.buildOrder()
+	if err != nil {
+		return err
+	}
+	// the child processes find the workspace, and the relative paths of the arguments, from the same directory
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	args := os.Args[1:]
+	if presetArgs != nil {
+		args = presetArgs
+	}
+	var output sync.Mutex
+	slots := make(chan struct{}, workspaceParallel)
+	done := map[string]chan struct{}{}
+	positions := map[string]int{}
+	for i, project := range projects {
+		done[project.Name] = make(chan struct{})
+		positions[project.Name] = i
+	}
+	results := make([]workspaceResult, len(projects))
+	var wait sync.WaitGroup
+	for i, project := range projects {
+		wait.Add(1)
+		go func(i int, project WorkspaceProject) {
+			defer wait.Done()
+			defer close(done[project.Name])
+			results[i] = workspaceResult{Project: project.Name}
+			// the projects come after their dependencies, which end before they start
+			for _, dependency := range project.DependsOn {
+				<-done[dependency]
+				if results[positions[dependency]].Status != workspaceSucceeded {
+					results[i].Status = workspaceSkipped
+					results[i].Details = "the " + dependency + " project did not succeed"
+					return
+				}
+			}
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			started := time.Now()
+			err := runWorkspaceProject(dir, cmd, args, project.Name, &output)
+			results[i].Duration = time.Since(started)
+			results[i].Status = workspaceSucceeded
+			if err != nil {
+				results[i].Status = workspaceFailed
+				results[i].Details = err.Error()
+			}
+		}(i, project)
+	}
+	wait.Wait()
+
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.AddRow("PROJECT", "STATUS", "DURATION", "DETAILS")
+	failed := 0
+	for _, result := range results {
+		duration := ""
+		if result.Status != workspaceSkipped {
+			duration = result.Duration.Round(100 * time.Millisecond).String()
+		}
+		if result.Status != workspaceSucceeded {
+			failed++
+		}
+		table.AddRow(result.Project, result.Status, duration, result.Details)
+	}
+	Info.log("\n", table.String())
+	if failed > 0 {
+		return errors.Errorf("appsody %s did not succeed for %d of the %d workspace projects", cmd.Name(), failed, len(projects))
+	}
+	Info.logf("appsody %s succeeded for the %d workspace projects", cmd.Name(), len(projects))
+	return nil
+}
+
+// runWorkspaceProject runs the command for a project in a child appsody process, with the arguments of this
+// command less the ones that select the projects
+func runWorkspaceProject(dir string, cmd *cobra.Command, args []string, project string, output *sync.Mutex) error {
+	var childArgs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") && arg != "-" && arg != "--" {
+			name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+			if name == "all" || name == "parallel" || name == "project" || name == "config" {
+				flag := lookupArgFlag(cmd, arg)
+				if flag != nil && flag.NoOptDefVal == "" && flag.Value.Type() != "bool" && !strings.Contains(arg, "=") {
+					i++
+				}
+				continue
+			}
+		}
+		childArgs = append(childArgs, arg)
+	}
+	childArgs = append(childArgs, "--project", project)
+	child, err := selfCommand(dir, childArgs)
+	if err != nil {
+		return err
+	}
+	// the presets are already in the arguments, and this command notifies for the whole workspace
+	child.Env = append(os.Environ(), noPresetsEnv+"=true", noNotifyEnv+"=true")
+	reader, writer := io.Pipe()
+	child.Stdout = writer
+	child.Stderr = writer
+	prefix := "[" + project + "] "
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			output.Lock()
+			fmt.Fprintln(os.Stdout, prefix+scanner.Text())
+			output.Unlock()
+		}
+		io.Copy(ioutil.Discard, reader)
+	}()
+	Debug.logf("Running %s in %s", commandLine("appsody", childArgs), dir)
+	err = child.Run()
+	writer.Close()
+	<-copied
+	return err
+}
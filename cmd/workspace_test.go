@@ -0,0 +1,47 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+var workspaceErrorTests = []struct {
+	testName      string
+	args          []string // input
+	expectedError string   // expected to be in the error message
+}{
+	{"Unknown project", []string{"run", "--project", "nope"}, "does not have a project named nope"},
+	{"Dependency cycle", []string{"build", "--all"}, "dependency cycle: frontend -> backend -> frontend"},
+	{"Tag with all", []string{"build", "--all", "--tag", "test"}, "--tag cannot be used with --all"},
+}
+
+func TestWorkspaceErrors(t *testing.T) {
+	for _, tt := range workspaceErrorTests {
+		// call t.Run so that we can name and report on individual tests
+		t.Run(tt.testName, func(t *testing.T) {
+			output, err := cmdtest.RunAppsodyCmdExec(tt.args, "testdata/workspace")
+
+			if err == nil {
+				t.Error("Expected non-zero exit code")
+			}
+			if !strings.Contains(output, tt.expectedError) {
+				t.Errorf("Did not find expected error '%s' in output", tt.expectedError)
+			}
+		})
+	}
+}
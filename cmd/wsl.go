@@ -0,0 +1,133 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// wslMountRoot is where WSL mounts the Windows drives, unless the automount root of /etc/wsl.conf moves them
+const wslMountRoot = "/mnt/"
+
+// windowsDrivePath matches the paths of the Windows drives, C:\dir or C:/dir
+var windowsDrivePath = regexp.MustCompile(`^([a-zA-Z]):([\\/].*)?$`)
+
+var (
+	wslOnce         sync.Once
+	wslDetected     int
+	wslAutomountDir string
+)
+
+// wslVersion returns 2 when the CLI runs in a WSL2 distribution, 1 in WSL1, and 0 elsewhere. WSL2 runs a real
+// Linux kernel, its release names microsoft-standard, and sets WSL_INTEROP.
+func wslVersion() int {
+	wslOnce.Do(func() {
+		wslAutomountDir = wslMountRoot
+		if runtime.GOOS != "linux" {
+			return
+		}
+		release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+		if err != nil || !strings.Contains(strings.ToLower(string(release)), "microsoft") {
+			return
+		}
+		wslDetected = 1
+		if os.Getenv("WSL_INTEROP") != "" || strings.Contains(strings.ToLower(string(release)), "wsl2") || strings.Contains(strings.ToLower(string(release)), "microsoft-standard") {
+			wslDetected = 2
+		}
+		wslAutomountDir = wslAutomountRoot("/etc/wsl.conf")
+		Debug.logw("Running in WSL", "version", wslDetected, "automount", wslAutomountDir)
+	})
+	return wslDetected
+}
+
+// wslAutomountRoot reads the root of the [automount] section of wsl.conf, with a trailing slash
+func wslAutomountRoot(confFile string) string {
+	file, err := os.Open(confFile)
+	if err != nil {
+		return wslMountRoot
+	}
+	defer file.Close()
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if section == "automount" && len(parts) == 2 && strings.TrimSpace(parts[0]) == "root" {
+			root := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+			if root != "" {
+				return strings.TrimSuffix(root, "/") + "/"
+			}
+		}
+	}
+	return wslMountRoot
+}
+
+// wslLinuxPath returns the path in WSL of a path of a Windows drive, /mnt/c/Users/me for C:\Users\me. Other paths
+// are returned as they are.
+func wslLinuxPath(path string) string {
+	match := windowsDrivePath.FindStringSubmatch(path)
+	if match == nil {
+		return path
+	}
+	wslVersion()
+	return wslAutomountDir + strings.ToLower(match[1]) + strings.Replace(match[2], `\`, "/", -1)
+}
+
+// wslWindowsDrive returns the letter of the Windows drive a path of WSL is on, such as c for /mnt/c/Users/me,
+// or an empty string for the paths of the Linux file system of the distribution
+func wslWindowsDrive(path string) string {
+	if wslVersion() == 0 || !strings.HasPrefix(path, wslAutomountDir) {
+		return ""
+	}
+	drive := strings.SplitN(strings.TrimPrefix(path, wslAutomountDir), "/", 2)[0]
+	if len(drive) == 1 && drive[0] >= 'a' && drive[0] <= 'z' {
+		return drive
+	}
+	return ""
+}
+
+// wslProjectProblem tells why a project on a Windows drive is a problem in WSL2, and where to move it, or
+// returns an empty string
+func wslProjectProblem(projectDir string) string {
+	drive := wslWindowsDrive(projectDir)
+	if wslVersion() != 2 || drive == "" {
+		return ""
+	}
+	target := filepath.Join("~", filepath.Base(projectDir))
+	where := ""
+	if distro := os.Getenv("WSL_DISTRO_NAME"); distro != "" {
+		where = `, and open it from Windows as \\wsl$\` + distro + `\home\<user>\` + filepath.Base(projectDir)
+	}
+	return "The project is on the Windows " + strings.ToUpper(drive) + ": drive, which WSL2 reaches through a network file system: " +
+		"the changes to its files do not reach the file watching of the container, and the builds are much slower. " +
+		"Move the project into the Linux file system of the distribution, such as " + target + where + "."
+}
+
+// checkWSLProject warns about the projects WSL2 runs poorly
+func checkWSLProject(projectDir string) {
+	if problem := wslProjectProblem(projectDir); problem != "" {
+		Warning.log(problem)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package functest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appsody/appsody/cmd/cmdtest"
+)
+
+// TestMain runs the functional tests without the network, the container runtime and the appsody home of the
+// user: the CLI runs with a temporary home, whose default repository holds the stacks of testdata/stacks, and
+// answers its other requests and its docker commands from the fixtures of testdata/fixtures.
+// APPSODY_FIXTURES_MODE=record runs the tests against the network and the container runtime instead, and
+// records their answers.
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	home, err := ioutil.TempDir("", "appsody-functest")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.Setenv("APPSODY_HOME", home)
+	os.Setenv("APPSODY_STATE_DIR", home)
+	index, err := packageTestStacks(filepath.Join("testdata", "stacks"), filepath.Join(home, "test-stacks"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(home, "repository"), 0755); err != nil {
+		log.Fatal(err)
+	}
+	indexURL, err := fileURL(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	repos := "apiVersion: v1\nrepositories:\n- name: incubator\n  url: " + indexURL + "\n  default: true\n"
+	if err = ioutil.WriteFile(filepath.Join(home, "repository", "repository.yaml"), []byte(repos), 0644); err != nil {
+		log.Fatal(err)
+	}
+	restore, err := cmdtest.UseFixtures(filepath.Join("testdata", "fixtures"), "replay")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer restore()
+	return m.Run()
+}
+
+// packageTestStacks writes the index of the stacks of dir into dest, with the archive of the template of
+// each stack, a directory of dir. It returns the index.
+func packageTestStacks(dir string, dest string) (string, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return "", err
+	}
+	templates, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, template := range templates {
+		if template.IsDir() {
+			if err = tarTemplate(filepath.Join(dir, template.Name()), filepath.Join(dest, template.Name()+".tar.gz")); err != nil {
+				return "", err
+			}
+		}
+	}
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.yaml"))
+	if err != nil {
+		return "", err
+	}
+	indexFile := filepath.Join(dest, "index.yaml")
+	return indexFile, ioutil.WriteFile(indexFile, index, 0644)
+}
+
+// tarTemplate writes the files of a template directory into a .tar.gz archive, as the stacks publish them
+func tarTemplate(dir string, archive string) error {
+	file, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zipped := gzip.NewWriter(file)
+	defer zipped.Close()
+	writer := tar.NewWriter(zipped)
+	defer writer.Close()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range files {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = "./" + info.Name()
+		if err = writer.WriteHeader(header); err != nil {
+			return err
+		}
+		content, err := os.Open(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileURL returns the file:// URL of a local file
+func fileURL(file string) (string, error) {
+	absolute, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return "file:///" + strings.TrimPrefix(filepath.ToSlash(absolute), "/"), nil
+}
+
+// requireRuntime skips the tests that need a running container, unless they run against the container runtime
+// to record their fixtures
+func requireRuntime(t *testing.T) {
+	if os.Getenv("APPSODY_FIXTURES_MODE") != "record" {
+		t.Skip("The test needs a running container, run the functional tests with APPSODY_FIXTURES_MODE=record to run it against the container runtime")
+	}
+}
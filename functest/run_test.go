@@ -26,6 +26,7 @@ import (
 )
 
 func TestRun(t *testing.T) {
+	requireRuntime(t)
 	// first add the test repo index
 	_, cleanup, err := cmdtest.AddLocalFileRepo("LocalTestRepo", "../cmd/testdata/index.yaml")
 	if err != nil {
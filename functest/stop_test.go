@@ -28,6 +28,7 @@ import (
 )
 
 func TestStopWithoutName(t *testing.T) {
+	requireRuntime(t)
 	// first add the test repo index
 	_, cleanup, err := cmdtest.AddLocalFileRepo("LocalTestRepo", "../cmd/testdata/index.yaml")
 	if err != nil {
@@ -118,6 +119,7 @@ func TestStopWithoutName(t *testing.T) {
 }
 
 func TestStopWithName(t *testing.T) {
+	requireRuntime(t)
 
 	// create a temporary dir to create the project and run the test
 	projectDir, err := ioutil.TempDir("", "appsody-stopName-test")
@@ -20,8 +20,12 @@ import (
 
 var (
 	VERSION = "vlatest"
+	COMMIT  = ""
+	DATE    = ""
 )
 
 func main() {
+	cmd.COMMIT = COMMIT
+	cmd.DATE = DATE
 	cmd.Execute(VERSION)
 }
@@ -0,0 +1,91 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package repomanager reads and changes the repositories of an appsody home for the tools that embed the CLI,
+// such as IDE plugins and test harnesses. Its methods return their errors rather than exiting.
+package repomanager
+
+import (
+	"github.com/appsody/appsody/cmd"
+)
+
+// Manager manages the repositories of the appsody home of a CLI configuration. It does not change the
+// configuration of the commands of the process.
+type Manager struct {
+	configFile string
+	config     *cmd.Config
+}
+
+// New reads the CLI configuration, configFile or $HOME/.appsody/.appsody.yaml when it is empty, and creates the
+// appsody home of the configuration when it does not exist yet
+func New(configFile string) (*Manager, error) {
+	m := &Manager{configFile: configFile, config: cmd.LoadConfig(configFile)}
+	if err := m.config.Run(func() error { return nil }); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ConfigFile returns the CLI configuration file of the manager, empty for the default one
+func (m *Manager) ConfigFile() string {
+	return m.configFile
+}
+
+// Home returns the appsody home of the repositories
+func (m *Manager) Home() string {
+	return m.config.Home()
+}
+
+// Repositories returns the repositories of the repository file
+func (m *Manager) Repositories() ([]*cmd.RepositoryEntry, error) {
+	var repos []*cmd.RepositoryEntry
+	err := m.config.Run(func() error {
+		var err error
+		repos, err = cmd.Repositories()
+		return err
+	})
+	return repos, err
+}
+
+// Add adds a repository, once its index has been read, the same as appsody repo add name url with the options
+func (m *Manager) Add(name string, url string, options cmd.RepoAddOptions) error {
+	return m.config.Run(func() error {
+		return cmd.AddRepository(name, url, options)
+	})
+}
+
+// Remove removes a repository, even the default one
+func (m *Manager) Remove(name string) error {
+	return m.config.Run(func() error {
+		return cmd.RemoveRepository(name)
+	})
+}
+
+// SetDefault makes a repository the default one. An empty name leaves no default repository.
+func (m *Manager) SetDefault(name string) error {
+	return m.config.Run(func() error {
+		return cmd.SetDefaultRepository(name)
+	})
+}
+
+// Index returns the merged index of the repositories
+func (m *Manager) Index() (*cmd.RepoIndex, error) {
+	var index *cmd.RepoIndex
+	err := m.config.Run(func() error {
+		var err error
+		index, err = cmd.GetIndex()
+		return err
+	})
+	return index, err
+}
@@ -0,0 +1,77 @@
+// Copyright © 2019 IBM Corporation and others.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repomanager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appsody/appsody/cmd"
+	"github.com/appsody/appsody/cmd/cmdtest"
+	"github.com/appsody/appsody/repomanager"
+)
+
+func TestManager(t *testing.T) {
+	configFile, home, cleanup, err := cmdtest.TempHome()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	indexFile := filepath.Join(home, "index.yaml")
+	if err = ioutil.WriteFile(indexFile, []byte("apiVersion: v2\nstacks: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := repomanager.New(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.Home() != home {
+		t.Errorf("Expected the home %s, got %s", home, manager.Home())
+	}
+	os.Setenv("APPSODY_TEST_API_KEY", "secret")
+	defer os.Unsetenv("APPSODY_TEST_API_KEY")
+	options := cmd.RepoAddOptions{Headers: map[string]string{"X-Api-Key": "env:APPSODY_TEST_API_KEY"}, Merge: "override"}
+	if err = manager.Add("local", "file://"+filepath.ToSlash(indexFile), options); err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Add("local", "file://"+filepath.ToSlash(indexFile), cmd.RepoAddOptions{}); err == nil {
+		t.Error("A repository with the same name was added twice")
+	}
+	if err = manager.SetDefault("local"); err != nil {
+		t.Fatal(err)
+	}
+	repos, err := manager.Repositories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[1].Name != "local" || !repos[1].Default {
+		t.Fatalf("Expected appsodyhub and the default local repository, got %v", repos)
+	}
+	if repos[1].Headers["X-Api-Key"] != "env:APPSODY_TEST_API_KEY" || repos[1].Merge != "override" {
+		t.Errorf("Expected the header reference and the merge strategy of the options, got %+v", repos[1])
+	}
+	if err = manager.Remove("local"); err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Remove("local"); err == nil {
+		t.Error("Removing a repository that does not exist did not fail")
+	}
+	if repos, _ = manager.Repositories(); len(repos) != 1 {
+		t.Errorf("Expected only appsodyhub, got %v", repos)
+	}
+}